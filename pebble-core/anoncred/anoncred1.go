@@ -395,15 +395,8 @@ func (set *anonCred1Set) Len() int {
 }
 
 func (set *anonCred1Set) Less(i, j int) bool {
-	a := set.creds[i]
-	b := set.creds[j]
-	for i = 0; i < 32; i++ {
-		// compare credentials based on their byte slices.
-		if a[i] >= b[i] {
-			return false
-		}
-	}
-	return true
+	// compare credentials based on their byte slices.
+	return bytes.Compare(set.creds[i], set.creds[j]) < 0
 }
 
 func (set *anonCred1Set) Swap(i, j int) {
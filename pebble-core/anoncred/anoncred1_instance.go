@@ -1,6 +1,7 @@
 package anoncred
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"os"
 )
@@ -26,6 +27,8 @@ func init() {
 		return
 	}
 	AnonCred1Instance = credSys
+	// Elections referencing these parameters by hash need not download them
+	loaded[sha256.Sum256(params)] = credSys
 	fmt.Println("AnonCred1Instance initialized")
 	fmt.Println()
 	fmt.Println("AnonCred1Instance: ", AnonCred1Instance)
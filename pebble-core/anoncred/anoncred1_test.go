@@ -74,3 +74,37 @@ func TestProveVerify(t *testing.T) {
 		t.Errorf("Error verifying proof: %s", err.Error())
 	}
 }
+
+func TestCredentialSetOrder(t *testing.T) {
+	params := AnonCred1{depth: depth}
+	var credentials []PublicCredential
+	for i := 0; i < 9; i++ {
+		sec, err := params.GenerateSecretCredential()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := sec.Public()
+		if err != nil {
+			t.Fatal(err)
+		}
+		credentials = append(credentials, pub)
+	}
+	set, err := params.MakeCredentialSet(credentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed := make([]PublicCredential, len(credentials))
+	for i, c := range credentials {
+		reversed[len(credentials)-1-i] = c
+	}
+	// Duplicates are removed
+	reversed = append(reversed, credentials[0])
+	other, err := params.MakeCredentialSet(reversed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := set.(*anonCred1Set), other.(*anonCred1Set)
+	if other.Len() != len(credentials) || string(a.root) != string(b.root) {
+		t.Error("credential set depends on the order of the credentials")
+	}
+}
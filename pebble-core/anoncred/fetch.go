@@ -0,0 +1,122 @@
+package anoncred
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var ErrParamsHash = errors.New("pebble: credential system parameters do not match their hash")
+
+// Maximum size of downloaded parameters.
+const maxParamsSize = 1 << 28
+
+var (
+	loadedMu sync.Mutex
+	// Parameters already parsed, by SHA-256 hash.
+	loaded = make(map[[32]byte]*AnonCred1)
+)
+
+// Returns the directory caching downloaded parameters, ~/.pebble.
+func DefaultCacheDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".pebble"), nil
+}
+
+// Parses params and keeps them for later loads with the same hash.
+func register(hash [32]byte, params []byte) (*AnonCred1, error) {
+	credSys := new(AnonCred1)
+	err := credSys.FromBytes(params)
+	if err != nil {
+		return nil, err
+	}
+	loadedMu.Lock()
+	loaded[hash] = credSys
+	loadedMu.Unlock()
+	return credSys, nil
+}
+
+func download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("pebble: downloading credential system parameters: %s", resp.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxParamsSize))
+}
+
+// Writes the file through a temporary file, so that concurrent readers never see a partial file.
+func writeCache(path string, params []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".anoncred1-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(params)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+/*
+Loads the AnonCred1 parameters whose SHA-256 hash is hash: from memory if already loaded,
+else from cacheDir, else downloaded from url and stored in cacheDir.
+Parameters are checked against hash before being parsed, so the cache and the server
+need not be trusted. An empty cacheDir disables the cache on disk.
+*/
+func FetchAnonCred1(ctx context.Context, url string, hash [32]byte, cacheDir string) (*AnonCred1, error) {
+	loadedMu.Lock()
+	credSys, ok := loaded[hash]
+	loadedMu.Unlock()
+	if ok {
+		return credSys, nil
+	}
+	var path string
+	if cacheDir != "" {
+		path = filepath.Join(cacheDir, "anoncred1-"+hex.EncodeToString(hash[:])+".bin")
+		params, err := ioutil.ReadFile(path)
+		if err == nil && sha256.Sum256(params) == hash {
+			return register(hash, params)
+		}
+	}
+	params, err := download(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if sha256.Sum256(params) != hash {
+		return nil, ErrParamsHash
+	}
+	if path != "" {
+		// The parameters are usable even if they cannot be cached
+		writeCache(path, params)
+	}
+	return register(hash, params)
+}
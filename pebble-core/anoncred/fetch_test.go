@@ -0,0 +1,64 @@
+package anoncred
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFetchAnonCred1(t *testing.T) {
+	credSys := new(AnonCred1)
+	if err := credSys.SetupCircuit(1); err != nil {
+		t.Fatal(err)
+	}
+	params, err := credSys.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(params)
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		w.Write(params)
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	dir := t.TempDir()
+	forget := func() {
+		loadedMu.Lock()
+		delete(loaded, hash)
+		loadedMu.Unlock()
+	}
+	defer forget()
+
+	if _, err = FetchAnonCred1(ctx, srv.URL, [32]byte{1}, dir); err != ErrParamsHash {
+		t.Errorf("fetched params with the wrong hash: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = FetchAnonCred1(ctx, srv.URL, hash, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("%d requests, expected one per hash", requests)
+	}
+	// Cached on disk
+	forget()
+	if _, err = FetchAnonCred1(ctx, srv.URL, hash, dir); err != nil || requests != 2 {
+		t.Errorf("cached params not used after %d requests: %v", requests, err)
+	}
+	// A corrupted cache is downloaded again
+	forget()
+	matches, _ := filepath.Glob(filepath.Join(dir, "anoncred1-*.bin"))
+	if len(matches) != 1 {
+		t.Fatalf("cache holds %v", matches)
+	}
+	os.WriteFile(matches[0], []byte("corrupted"), 0600)
+	if _, err = FetchAnonCred1(ctx, srv.URL, hash, dir); err != nil || requests != 3 {
+		t.Errorf("corrupted cache used after %d requests: %v", requests, err)
+	}
+}
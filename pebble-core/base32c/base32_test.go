@@ -2,6 +2,7 @@ package base32c
 
 import (
 	"bytes"
+	"math/rand"
 	"testing"
 )
 
@@ -26,3 +27,38 @@ func TestBase32(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckDecodeWithCorrection(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 20, 100, 400} {
+		p := make([]byte, n)
+		rng.Read(p)
+		s := CorrectableEncode(p)
+		b, pos, err := CheckDecodeWithCorrection(s)
+		if err != nil || pos != -1 || !bytes.Equal(b, p) {
+			t.Fatalf("length %d: decoded %x at %d, %v", n, b, pos, err)
+		}
+		for i := 0; i < len(s); i += 7 {
+			for _, c := range []byte{alpha[rng.Intn(32)], 'I', 'o'} {
+				if c == s[i] {
+					continue
+				}
+				typo := s[:i] + string(c) + s[i+1:]
+				b, pos, err = CheckDecodeWithCorrection(typo)
+				if err != nil || pos != i || !bytes.Equal(b, p) {
+					t.Fatalf("length %d, %q at %d: decoded at %d, %v", n, c, i, pos, err)
+				}
+			}
+		}
+	}
+	// Strings of CheckEncode still decode, without correction
+	p := []byte("legacy")
+	if b, _, err := CheckDecodeWithCorrection(CheckEncode(p)); err != nil || !bytes.Equal(b, p) {
+		t.Errorf("legacy string: %v", err)
+	}
+	s := []byte(CorrectableEncode(p))
+	s[1], s[3] = alpha[(decodeMap[rune(s[1])]+1)%32], alpha[(decodeMap[rune(s[3])]+1)%32]
+	if _, _, err := CheckDecodeWithCorrection(string(s)); err != ErrCheck {
+		t.Errorf("two errors: %v", err)
+	}
+}
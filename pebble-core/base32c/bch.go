@@ -0,0 +1,116 @@
+package base32c
+
+/*
+Error-correcting check encoding: the strings of CheckEncode followed by the 6-character
+BCH checksum of bech32m (BIP 350), computed over the base32 values of the characters.
+The code detects any 4 errors in strings of up to 89 characters, and any 2 errors up to
+1023 characters, so that a single mistyped character can be located and fixed.
+The SHA-256 check of CheckEncode is kept, guarding against wrong corrections.
+*/
+
+const (
+	bchLen = 6
+	// Longest string in which a single error is corrected.
+	bchMaxCorrect = 1023
+	bchConst      = 0x2bc830a3
+)
+
+var bchGenerator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		chk = mulx(chk) ^ uint32(v)
+	}
+	return chk
+}
+
+// Multiplies a checksum residue by x, as polymod does for each value.
+func mulx(chk uint32) uint32 {
+	b := chk >> 25
+	chk = (chk & 0x1ffffff) << 5
+	for i, g := range bchGenerator {
+		if (b>>i)&1 != 0 {
+			chk ^= g
+		}
+	}
+	return chk
+}
+
+// Encodes p with CheckEncode followed by a BCH checksum, decoded by CheckDecodeWithCorrection.
+func CorrectableEncode(p []byte) string {
+	s := CheckEncode(p)
+	values := make([]byte, len(s), len(s)+bchLen)
+	for i := 0; i < len(s); i++ {
+		values[i] = decodeMap[rune(s[i])]
+	}
+	mod := polymod(append(values, make([]byte, bchLen)...)) ^ bchConst
+	buf := []byte(s)
+	for i := 0; i < bchLen; i++ {
+		buf = append(buf, alpha[(mod>>(5*(bchLen-1-i)))&31])
+	}
+	return string(buf)
+}
+
+/*
+Decodes a string of CorrectableEncode, or of CheckEncode. A single wrong character of a
+string of CorrectableEncode, including a character outside the alphabet, is corrected.
+Returns the index of the corrected character, or -1 if none was.
+*/
+func CheckDecodeWithCorrection(s string) ([]byte, int, error) {
+	values := make([]byte, 0, len(s))
+	invalid := -1
+	for _, c := range s {
+		v, ok := decodeMap[c]
+		if !ok {
+			if invalid >= 0 || c >= 0x80 {
+				return nil, -1, ErrChar
+			}
+			invalid = len(values)
+		}
+		values = append(values, v)
+	}
+	if invalid < 0 {
+		if len(values) > bchLen && polymod(values) == bchConst {
+			p, err := CheckDecode(s[:len(s)-bchLen])
+			return p, -1, err
+		}
+		if p, err := CheckDecode(s); err == nil {
+			return p, -1, nil
+		}
+	}
+	if len(values) <= bchLen || len(values) > bchMaxCorrect {
+		return nil, -1, ErrCheck
+	}
+	// The checksum is linear: changing the value at i by d changes polymod by d·x^(n-1-i)
+	syndrome := polymod(values) ^ bchConst
+	var shifts [32]uint32
+	for d := range shifts {
+		shifts[d] = uint32(d)
+	}
+	for i := len(values) - 1; i >= 0; i-- {
+		// The value of an invalid character is taken as 0, which may be right
+		for d := 0; d < 32; d++ {
+			if shifts[d] != syndrome || (invalid >= 0 && i != invalid) || (invalid < 0 && d == 0) {
+				continue
+			}
+			buf := make([]byte, len(values)-bchLen)
+			for j := range buf {
+				buf[j] = alpha[values[j]]
+			}
+			if i < len(buf) {
+				buf[i] = alpha[values[i]^byte(d)]
+			}
+			if p, err := CheckDecode(string(buf)); err == nil {
+				return p, i, nil
+			}
+		}
+		for d := range shifts {
+			shifts[d] = mulx(shifts[d])
+		}
+	}
+	if invalid >= 0 {
+		return nil, -1, ErrChar
+	}
+	return nil, -1, ErrCheck
+}
@@ -0,0 +1,339 @@
+/*
+Package client is a typed Go client for the HTTP API of the pebble servers, for
+integrators creating and following elections without hand-writing requests.
+Requests are retried under a voting.RetryPolicy, and failures carry the stable
+error code of the server's error envelope, see voting.ErrorCodeOf.
+*/
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/server"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/methods"
+)
+
+var ErrSetupFailed = errors.New("pebble: election setup failed")
+
+// A client of one pebble server.
+type Client struct {
+	client   *http.Client
+	policy   voting.RetryPolicy
+	server   string
+	auth     bool
+	username string
+	password string
+}
+
+type Option func(*Client)
+
+// Sends the client's requests with c instead of http.DefaultClient.
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *Client) {
+		cl.client = c
+	}
+}
+
+// Sets the timeouts and retries of the client's requests.
+func WithRetryPolicy(p voting.RetryPolicy) Option {
+	return func(cl *Client) {
+		cl.policy = p
+	}
+}
+
+// Authenticates the client's requests with the server password, required to create elections
+// and read their setup on servers started with one.
+func WithPassword(username, password string) Option {
+	return func(cl *Client) {
+		cl.auth = true
+		cl.username, cl.password = username, password
+	}
+}
+
+// Creates a client of the server at the given base URL, e.g. https://pebble.example.org.
+func New(serverURL string, opts ...Option) *Client {
+	c := &Client{
+		client: http.DefaultClient,
+		policy: voting.DefaultRetryPolicy,
+		server: strings.TrimSuffix(serverURL, "/"),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// The setup status of an election, as returned by /setup.
+type SetupInfo struct {
+	// SetupError, InProgress or Done.
+	Status     string `json:"status"`
+	Message    string `json:"message,omitempty"`
+	BackendId  string `json:"backendId,omitempty"`
+	Invitation string `json:"invitation,omitempty"`
+}
+
+// The ballots of an election that were not counted.
+type Rejections struct {
+	Counts   map[string]int `json:"counts"`
+	Messages []struct {
+		Hash   string `json:"hash"`
+		Reason string `json:"reason"`
+	} `json:"messages,omitempty"`
+}
+
+/*
+The status of an election, as returned by /election. Status is the name of the phase;
+the other fields are set from the phases where the server reports them: Progress and Total
+from Cast, the counts and results from Tally, and Valid and the certification at End.
+*/
+type ElectionStatus struct {
+	Status     string           `json:"status"`
+	Progress   int              `json:"progress,omitempty"`
+	Valid      int              `json:"valid,omitempty"`
+	Total      int              `json:"total,omitempty"`
+	Counts     map[string]int   `json:"counts,omitempty"`
+	Blank      int              `json:"blank,omitempty"`
+	Winner     string           `json:"winner,omitempty"`
+	Seed       string           `json:"tieBreakSeed,omitempty"`
+	Results    []methods.Result `json:"results,omitempty"`
+	TallyHash  string           `json:"tallyHash,omitempty"`
+	Certified  bool             `json:"certified,omitempty"`
+	Trustees   []uint32         `json:"certifyingTrustees,omitempty"`
+	Conflicts  int              `json:"conflictingCertifications,omitempty"`
+	Rejections *Rejections      `json:"rejections,omitempty"`
+}
+
+// Sends a request to path with the given method and body, and returns the body of the response.
+func (c *Client) do(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.server+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if c.auth {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.policy.Do(ctx, c.client, req)
+}
+
+// Sends a GET request to path and decodes the JSON response into v.
+func (c *Client) getJson(ctx context.Context, path string, v interface{}) error {
+	body, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// Asks the server to create an election. Setup runs in the background; follow it with Setup or WaitSetup.
+func (c *Client) Create(ctx context.Context, params server.ElectionSetupParams) error {
+	body, err := json.Marshal(&params)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(ctx, http.MethodPost, "/create", body)
+	return err
+}
+
+// Returns the setup status of the election created with adminId.
+func (c *Client) Setup(ctx context.Context, adminId string) (info SetupInfo, err error) {
+	err = c.getJson(ctx, "/setup/"+url.PathEscape(adminId), &info)
+	return
+}
+
+/*
+Polls the setup status of the election created with adminId every interval until it is done,
+and returns it. Fails with an error wrapping ErrSetupFailed if the setup failed.
+*/
+func (c *Client) WaitSetup(ctx context.Context, adminId string, interval time.Duration) (SetupInfo, error) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		info, err := c.Setup(ctx, adminId)
+		if err != nil {
+			return info, err
+		}
+		switch info.Status {
+		case "Done":
+			return info, nil
+		case "SetupError":
+			return info, &setupError{info.Message}
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return info, ctx.Err()
+		}
+	}
+}
+
+type setupError struct {
+	message string
+}
+
+func (err *setupError) Error() string {
+	return ErrSetupFailed.Error() + ": " + err.message
+}
+
+func (err *setupError) Unwrap() error {
+	return ErrSetupFailed
+}
+
+// Returns the status of the election. With details, the rejected ballots are listed.
+func (c *Client) Election(ctx context.Context, backendId string, details bool) (status ElectionStatus, err error) {
+	path := "/election/" + url.PathEscape(backendId)
+	if details {
+		path += "?rejections=details"
+	}
+	err = c.getJson(ctx, path, &status)
+	return
+}
+
+// Returns the summary report of the election, see voting.Election.Report.
+func (c *Client) Report(ctx context.Context, backendId string) (report *voting.ElectionReport, err error) {
+	err = c.getJson(ctx, "/report/"+url.PathEscape(backendId), &report)
+	return
+}
+
+// Returns the public elections listed by the server, if it has discovery enabled.
+func (c *Client) Elections(ctx context.Context) (elections []server.PublicElection, err error) {
+	err = c.getJson(ctx, "/elections", &elections)
+	return
+}
+
+// Returns the elections hosted by the server, which requires the admin password.
+func (c *Client) Overview(ctx context.Context) ([]server.ElectionOverview, error) {
+	var resp struct {
+		Elections []server.ElectionOverview `json:"elections"`
+	}
+	err := c.getJson(ctx, "/admin/overview", &resp)
+	return resp.Elections, err
+}
+
+// Saves the setup params as the template of the name on the server, see server.TemplateService.
+func (c *Client) SaveTemplate(ctx context.Context, name string, params server.ElectionSetupParams) error {
+	body, err := json.Marshal(&params)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(ctx, http.MethodPut, "/template/"+url.PathEscape(name), body)
+	return err
+}
+
+// Saves the setup params of the election created with adminId as the template of the name.
+func (c *Client) SaveTemplateFrom(ctx context.Context, name, adminId string) error {
+	_, err := c.do(ctx, http.MethodPut, "/template/"+url.PathEscape(name)+"?from="+url.QueryEscape(adminId), nil)
+	return err
+}
+
+// Returns the template of the name.
+func (c *Client) Template(ctx context.Context, name string) (params server.ElectionSetupParams, err error) {
+	err = c.getJson(ctx, "/template/"+url.PathEscape(name), &params)
+	return
+}
+
+// Returns the names of the templates saved on the server.
+func (c *Client) Templates(ctx context.Context) (names []string, err error) {
+	err = c.getJson(ctx, "/templates", &names)
+	return
+}
+
+// Deletes the template of the name.
+func (c *Client) DeleteTemplate(ctx context.Context, name string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/template/"+url.PathEscape(name), nil)
+	return err
+}
+
+/*
+Asks the server to create an election from a template or a past election with new dates,
+and returns its admin ID. Setup runs in the background as for Create.
+*/
+func (c *Client) Clone(ctx context.Context, params server.CloneParams) (string, error) {
+	body, err := json.Marshal(&params)
+	if err != nil {
+		return "", err
+	}
+	body, err = c.do(ctx, http.MethodPost, "/clone", body)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		AdminId string `json:"adminId"`
+	}
+	err = json.Unmarshal(body, &resp)
+	return resp.AdminId, err
+}
+
+/*
+Adds voters missed at setup to the eligibility list of the election created with adminId while
+its registration is open, and returns how many were added. Keys already eligible are skipped.
+*/
+func (c *Client) AddVoters(ctx context.Context, adminId string, keys []string) (int, error) {
+	body, err := json.Marshal(struct {
+		Keys []string `json:"keys"`
+	}{keys})
+	if err != nil {
+		return 0, err
+	}
+	body, err = c.do(ctx, http.MethodPost, "/voters/"+url.PathEscape(adminId), body)
+	if err != nil {
+		return 0, err
+	}
+	var resp struct {
+		Added int `json:"added"`
+	}
+	err = json.Unmarshal(body, &resp)
+	return resp.Added, err
+}
+
+/*
+Returns the broadcast channel of the election on this server, which reads the params
+and the messages of the election and posts messages, decoding the binary framing.
+The params are not checked against a pinned organizer key; join from the invitation with
+voting.NewBroadcastClient to check them.
+*/
+func (c *Client) Channel(backendId string) (*voting.BroadcastClient, error) {
+	inv := voting.Invitation{Address: []byte(backendId), Servers: []string{c.server}}
+	opts := []voting.BroadcastClientOption{voting.WithHTTPClient(c.client), voting.WithRetryPolicy(c.policy)}
+	if c.auth {
+		opts = append(opts, voting.WithBasicAuth(c.username, c.password))
+	}
+	return voting.NewBroadcastClient(inv, opts...)
+}
+
+// Returns the params of the election.
+func (c *Client) Params(ctx context.Context, backendId string) (*voting.ElectionParams, error) {
+	bc, err := c.Channel(backendId)
+	if err != nil {
+		return nil, err
+	}
+	return bc.Params(ctx)
+}
+
+// Returns the messages of the election.
+func (c *Client) Messages(ctx context.Context, backendId string) ([]voting.Message, error) {
+	bc, err := c.Channel(backendId)
+	if err != nil {
+		return nil, err
+	}
+	return bc.Get(ctx)
+}
+
+// Posts messages to the election in one batch, which the server accepts or rejects as a whole.
+func (c *Client) Post(ctx context.Context, backendId string, msgs ...voting.Message) error {
+	bc, err := c.Channel(backendId)
+	if err != nil {
+		return err
+	}
+	return bc.PostAll(ctx, msgs)
+}
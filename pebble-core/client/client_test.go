@@ -0,0 +1,291 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/server"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+func respondError(w http.ResponseWriter, status int, code util.ErrorCode) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(util.ErrorEnvelope{Error: util.APIError{Code: code, Message: string(code)}})
+}
+
+func TestClient(t *testing.T) {
+	var created server.ElectionSetupParams
+	var posted []voting.Message
+	setupPolls, electionCalls := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, pass, ok := req.BasicAuth(); !ok || pass != "secret" {
+			respondError(w, 401, util.ErrorUnauthorized)
+			return
+		}
+		switch req.URL.Path {
+		case "/create":
+			json.NewDecoder(req.Body).Decode(&created)
+			w.Write([]byte("Election creation enqueued"))
+		case "/setup/admin":
+			setupPolls++
+			if setupPolls < 2 {
+				w.Write([]byte(`{"status":"InProgress"}`))
+			} else {
+				w.Write([]byte(`{"status":"Done","backendId":"B","invitation":"INV"}`))
+			}
+		case "/setup/failed":
+			w.Write([]byte(`{"status":"SetupError","message":"Election not found"}`))
+		case "/election/B":
+			electionCalls++
+			if electionCalls == 1 {
+				respondError(w, 503, util.ErrorUnavailable)
+				return
+			}
+			w.Write([]byte(`{"status":"Cast","progress":3,"total":10,"rejections":{"counts":{"duplicate serial number":1}}}`))
+		case "/elections":
+			w.Write([]byte(`[{"backendId":"B","title":"Title","phase":"CredGen","invitation":"INV"}]`))
+		case "/admin/overview":
+			w.Write([]byte(`{"elections":[{"adminId":"admin","backendId":"B","status":"Done","phase":"Cast","credentials":4,"ballots":3,"messages":7,"storageBytes":900}]}`))
+		case "/messages/B":
+			body, _ := io.ReadAll(req.Body)
+			posted, _ = voting.DecodeEnvelopeBatch(body)
+			w.Write([]byte("Message posted"))
+		default:
+			respondError(w, 404, util.ErrorNotFound)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	policy := voting.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	c := New(srv.URL+"/", WithPassword("admin", "secret"), WithRetryPolicy(policy))
+
+	err := c.Create(ctx, server.ElectionSetupParams{AdminId: "admin", Title: "Title"})
+	if err != nil || created.AdminId != "admin" || created.Title != "Title" {
+		t.Fatalf("created %+v: %v", created, err)
+	}
+	info, err := c.WaitSetup(ctx, "admin", time.Millisecond)
+	if err != nil || info.BackendId != "B" || info.Invitation != "INV" || setupPolls != 2 {
+		t.Fatalf("setup %+v after %d polls: %v", info, setupPolls, err)
+	}
+	if _, err = c.WaitSetup(ctx, "failed", time.Millisecond); !errors.Is(err, ErrSetupFailed) {
+		t.Errorf("failed setup: %v", err)
+	}
+	status, err := c.Election(ctx, "B", false)
+	if err != nil || status.Status != "Cast" || status.Progress != 3 || status.Total != 10 || status.Rejections.Counts["duplicate serial number"] != 1 {
+		t.Fatalf("election %+v: %v", status, err)
+	}
+	elections, err := c.Elections(ctx)
+	if err != nil || len(elections) != 1 || elections[0].Invitation != "INV" || elections[0].Phase != "CredGen" {
+		t.Fatalf("elections %+v: %v", elections, err)
+	}
+	overview, err := c.Overview(ctx)
+	if err != nil || len(overview) != 1 || overview[0].BackendId != "B" || overview[0].Ballots != 3 || overview[0].Storage != 900 {
+		t.Fatalf("overview %+v: %v", overview, err)
+	}
+	if _, err = c.Election(ctx, "missing", false); voting.ErrorCodeOf(err) != util.ErrorNotFound {
+		t.Errorf("missing election: %v", err)
+	}
+	if _, err = New(srv.URL).Setup(ctx, "admin"); voting.ErrorCodeOf(err) != util.ErrorUnauthorized {
+		t.Errorf("unauthenticated setup: %v", err)
+	}
+
+	msg := voting.Message{Decryption: &structs.DecryptionMessage{Output: []byte{2}, Proof: []byte{3}}}
+	err = c.Post(ctx, "B", msg)
+	if err != nil || len(posted) != 1 || posted[0].Decryption == nil {
+		t.Errorf("posted %+v: %v", posted, err)
+	}
+}
+
+func TestClientTemplates(t *testing.T) {
+	credSys := new(anoncred.AnonCred1)
+	if err := credSys.SetupCircuit(8); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(server.NewMockServer("http://localhost", nil, voting.WithCredentialSystem(credSys)))
+	defer srv.Close()
+	ctx := context.Background()
+	c := New(srv.URL)
+	start := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+	spar := server.ElectionSetupParams{
+		AdminId:   "board-january",
+		Title:     "Board meeting",
+		RegEnd:    start.Format(time.RFC3339),
+		VoteStart: start.Format(time.RFC3339),
+		VoteEnd:   start.Add(24 * time.Hour).Format(time.RFC3339),
+		Method:    "Plurality",
+		Choices:   []string{"Yes", "No"},
+	}
+	err := c.Create(ctx, spar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.SaveTemplateFrom(ctx, "board", "board-january")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := c.Templates(ctx)
+	if err != nil || len(names) != 1 || names[0] != "board" {
+		t.Fatalf("templates %v: %v", names, err)
+	}
+	tmpl, err := c.Template(ctx, "board")
+	if err != nil || tmpl.AdminId != "" || tmpl.Title != "Board meeting" {
+		t.Fatalf("template %+v: %v", tmpl, err)
+	}
+
+	// A month later, with the same schedule
+	next := start.AddDate(0, 1, 0)
+	adminId, err := c.Clone(ctx, server.CloneParams{From: "board-january", VoteStart: next.Format(time.RFC3339)})
+	if err != nil || adminId == "" {
+		t.Fatalf("clone %q: %v", adminId, err)
+	}
+	info, err := c.WaitSetup(ctx, adminId, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := c.Params(ctx, info.BackendId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Title != "Board meeting" || !params.CastStart.Equal(next) || !params.TallyStart.Equal(next.Add(24*time.Hour)) || !params.RegistrationEnd.Equal(next) {
+		t.Errorf("cloned params %+v", params)
+	}
+	_, err = c.Clone(ctx, server.CloneParams{Template: "board", AdminId: "board-february", Title: "Extraordinary meeting", VoteStart: next.Format(time.RFC3339)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Clone(ctx, server.CloneParams{Template: "board", AdminId: "board-february", VoteStart: next.Format(time.RFC3339)}); err == nil {
+		t.Error("cloned to an existing admin ID")
+	}
+	if _, err = c.Clone(ctx, server.CloneParams{Template: "missing", VoteStart: next.Format(time.RFC3339)}); voting.ErrorCodeOf(err) != util.ErrorNotFound {
+		t.Errorf("missing template: %v", err)
+	}
+	err = c.DeleteTemplate(ctx, "board")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Template(ctx, "board"); voting.ErrorCodeOf(err) != util.ErrorNotFound {
+		t.Errorf("deleted template: %v", err)
+	}
+}
+
+func TestClientLimits(t *testing.T) {
+	handler := server.NewMockServer("http://localhost", nil)
+	handler.SetLimits(server.Limits{MaxChoices: 3, MaxSchedule: 24 * time.Hour, MaxVdfDifficulty: 1000})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	ctx := context.Background()
+	c := New(srv.URL)
+	start := time.Now().Add(time.Hour)
+	spar := server.ElectionSetupParams{
+		AdminId:       "admin",
+		VoteStart:     start.Format(time.RFC3339),
+		VoteEnd:       start.Add(time.Hour).Format(time.RFC3339),
+		VdfDifficulty: "1000",
+		Method:        "Plurality",
+		Choices:       []string{"A", "B", "C", "D"},
+	}
+	for _, limit := range []string{"choices", "schedule", "vdfDifficulty"} {
+		switch limit {
+		case "schedule":
+			spar.Choices = spar.Choices[:3]
+			spar.VoteEnd = start.Add(48 * time.Hour).Format(time.RFC3339)
+		case "vdfDifficulty":
+			spar.VoteEnd = start.Add(time.Hour).Format(time.RFC3339)
+			spar.VdfDifficulty = "1001"
+		}
+		if err := c.Create(ctx, spar); voting.ErrorCodeOf(err) != util.ErrorLimitExceeded {
+			t.Errorf("%s limit: %v", limit, err)
+		}
+	}
+	err := spar.CheckLimits(server.Limits{MaxVoters: 1})
+	if err != nil {
+		t.Error(err)
+	}
+	spar.Voters = make([]server.ElectionSetupVoter, 2)
+	var aerr *util.APIError
+	if err = spar.CheckLimits(server.Limits{MaxVoters: 1}); !errors.As(err, &aerr) || aerr.Limit != "voters" || aerr.Max != 1 || aerr.Value != 2 {
+		t.Errorf("voters limit: %v", err)
+	}
+}
+
+func TestClientAddVoters(t *testing.T) {
+	credSys := new(anoncred.AnonCred1)
+	if err := credSys.SetupCircuit(2); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(server.NewMockServer("http://localhost", nil, voting.WithCredentialSystem(credSys)))
+	defer srv.Close()
+	ctx := context.Background()
+	c := New(srv.URL)
+	start := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+	err := c.Create(ctx, server.ElectionSetupParams{
+		AdminId:   "admin",
+		VoteStart: start.Format(time.RFC3339),
+		VoteEnd:   start.Add(time.Hour).Format(time.RFC3339),
+		Method:    "Plurality",
+		Choices:   []string{"Yes", "No"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := c.WaitSetup(ctx, "admin", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := k.Public().String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The missed voter cannot register before being added
+	sec, err := credSys.GenerateSecretCredential()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := sec.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := voting.DecodeInvitation(info.Invitation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eid, err := inv.ElectionId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred := &structs.CredentialMessage{Credential: pub.Bytes()}
+	if err = cred.Sign(k, eid); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Post(ctx, info.BackendId, voting.Message{Credential: cred}); voting.ErrorCodeOf(err) != util.ErrorNotEligible {
+		t.Fatalf("credential of a missed voter: %v", err)
+	}
+	added, err := c.AddVoters(ctx, "admin", []string{pk, pk})
+	if err != nil || added != 1 {
+		t.Fatalf("added %d voters: %v", added, err)
+	}
+	if added, err = c.AddVoters(ctx, "admin", []string{pk}); err != nil || added != 0 {
+		t.Errorf("added %d eligible voters: %v", added, err)
+	}
+	if err = c.Post(ctx, info.BackendId, voting.Message{Credential: cred}); err != nil {
+		t.Errorf("credential of an added voter: %v", err)
+	}
+	if _, err = c.AddVoters(ctx, "missing", []string{pk}); voting.ErrorCodeOf(err) != util.ErrorNotFound {
+		t.Errorf("unknown election: %v", err)
+	}
+}
@@ -0,0 +1,409 @@
+//go:build cgo
+// +build cgo
+
+/*
+C shared library exposing the voter side of pebble-core to desktop applications and
+scripting languages. Build with
+
+	go build -buildmode=c-shared -o libpebble.so ./cmd/libpebble
+
+which also writes the libpebble.h header. Every function returns a NUL-terminated
+JSON document owned by the caller, to be released with pebble_free. Failures return
+the error envelope of the broadcast servers, {"error": {"code": ..., "message": ...}}.
+Functions block until done and are safe to call from several threads.
+
+	pebble_set_credential_params(path)       loads the anoncred1-params.bin file
+	pebble_voter_key(secrets)                -> {"publicKey"}, generating the key on first use
+	pebble_join(invitation, secrets)         -> {"handle", "electionId", "phase"}
+	pebble_post_credential(handle)           -> {}
+	pebble_rotate_credential(handle)         -> {}, replacing the voter's credential while the
+	                                            registration is open (see voting.Election.RotateCredential)
+	pebble_vote(handle, choices)             -> {}, choices being a JSON array of contests,
+	                                            each an array of choice indices
+	pebble_reveal(handle)                    -> {}
+	pebble_progress(handle)                  -> {"phase", "count", "total", "results"}, as of the
+	                                            last background sync once there was one
+	pebble_ballots(handle)                   -> {"ballots": [{"time", "trackingCode", "posted"}]},
+	                                            the ballots signed by the voter, oldest first
+	pebble_choice_order(handle, contest)     -> {"order"}, the indices of the choices of the contest in
+	                                            the order to show them to the voter (see
+	                                            voting.ElectionParams.ChoiceOrder)
+	pebble_verify_ballot(handle)             -> {"phase", "trackingCode", "recorded", "inclusionProof",
+	                                            "validSignature", "decrypted", "counted", "rejection"},
+	                                            the verification of the voter's ballot (see
+	                                            voting.Election.VerifyBallot), the inclusion proof hex-encoded
+	pebble_close(handle)                     -> {}
+	pebble_set_sync(interval, jitter)        -> {}, the milliseconds between the background syncs
+	                                            of the elections joined afterwards, zero disabling them
+	pebble_set_cache(dir)                    -> {}, caching the messages of the elections joined
+	                                            afterwards in dir (see voting.WithMessageCache),
+	                                            an empty path disabling the cache
+
+secrets is the path of the JSON file holding the voter's secrets, which may be shared by elections,
+see secrets.FileManager; it is created readable by the owner only.
+
+Each joined election is synced in the background (see voting.Syncer), which also posts the
+decryption of the voter's ballot once the tally starts.
+*/
+package main
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/methods"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/secrets"
+)
+
+var errInvalidHandle = &util.APIError{Code: util.ErrorNotFound, Message: "invalid election handle"}
+
+var (
+	mu         sync.Mutex
+	elections        = make(map[int64]*joined)
+	nextHandle int64 = 1
+	syncConfig       = voting.SyncConfig{Interval: voting.DefaultSyncInterval, Jitter: voting.DefaultSyncInterval / 10, AutoReveal: true}
+	cacheDir   string
+)
+
+// A joined election, with its background sync if enabled.
+type joined struct {
+	election *voting.Election
+	client   *voting.BroadcastClient
+	syncer   *voting.Syncer
+	stop     context.CancelFunc
+}
+
+func main() {}
+
+// Returns v as a C string of JSON, or the error envelope of err.
+func result(v interface{}, err error) *C.char {
+	if err == nil {
+		var p []byte
+		p, err = json.Marshal(v)
+		if err == nil {
+			return C.CString(string(p))
+		}
+	}
+	env := util.ErrorEnvelope{Error: util.APIError{Code: voting.ErrorCodeOf(err), Message: err.Error()}}
+	if env.Error.Code == "" {
+		env.Error.Code = util.ErrorInternal
+	}
+	p, _ := json.Marshal(env)
+	return C.CString(string(p))
+}
+
+func election(handle C.int64_t) (*voting.Election, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	j, ok := elections[int64(handle)]
+	if !ok {
+		return nil, errInvalidHandle
+	}
+	return j.election, nil
+}
+
+//export pebble_free
+func pebble_free(p *C.char) {
+	C.free(unsafe.Pointer(p))
+}
+
+//export pebble_set_credential_params
+func pebble_set_credential_params(path *C.char) *C.char {
+	params, err := os.ReadFile(C.GoString(path))
+	if err != nil {
+		return result(nil, err)
+	}
+	credSys := new(anoncred.AnonCred1)
+	err = credSys.FromBytes(params)
+	if err != nil {
+		return result(nil, err)
+	}
+	mu.Lock()
+	anoncred.AnonCred1Instance = credSys
+	mu.Unlock()
+	return result(struct{}{}, nil)
+}
+
+//export pebble_voter_key
+func pebble_voter_key(secretsPath *C.char) *C.char {
+	sec, err := secrets.OpenFile(C.GoString(secretsPath))
+	if err != nil {
+		return result(nil, err)
+	}
+	k, err := sec.GetPrivateKey()
+	if err == secrets.ErrNoPrivateKey {
+		k, err = pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+		if err == nil {
+			err = sec.SetPrivateKey(k)
+		}
+	}
+	if err != nil {
+		return result(nil, err)
+	}
+	s, err := k.Public().String()
+	return result(map[string]string{"publicKey": s}, err)
+}
+
+//export pebble_join
+func pebble_join(invitation, secretsPath *C.char) *C.char {
+	inv, err := voting.DecodeInvitation(C.GoString(invitation))
+	if err != nil {
+		return result(nil, err)
+	}
+	sec, err := secrets.OpenFile(C.GoString(secretsPath))
+	if err != nil {
+		return result(nil, err)
+	}
+	var opts []voting.BroadcastClientOption
+	mu.Lock()
+	if cacheDir != "" {
+		opts = append(opts, voting.WithMessageCache(cacheDir))
+	}
+	mu.Unlock()
+	bc, err := voting.NewBroadcastClient(inv, opts...)
+	if err != nil {
+		return result(nil, err)
+	}
+	if bc.Id() == (voting.ElectionID{}) {
+		bc.Close()
+		return result(nil, voting.ErrInvalidInvitation)
+	}
+	e, err := voting.NewElection(context.Background(), bc, sec)
+	if err != nil {
+		bc.Close()
+		return result(nil, err)
+	}
+	mu.Lock()
+	handle := nextHandle
+	nextHandle++
+	j := &joined{election: e, client: bc}
+	if syncConfig.Interval > 0 {
+		var ctx context.Context
+		ctx, j.stop = context.WithCancel(context.Background())
+		j.syncer = voting.NewSyncer(e, syncConfig)
+		go j.syncer.Run(ctx)
+	}
+	elections[handle] = j
+	mu.Unlock()
+	id := e.Id()
+	return result(map[string]interface{}{
+		"handle":     handle,
+		"electionId": hex.EncodeToString(id[:]),
+		"phase":      e.Phase().String(),
+	}, nil)
+}
+
+//export pebble_post_credential
+func pebble_post_credential(handle C.int64_t) *C.char {
+	e, err := election(handle)
+	if err != nil {
+		return result(nil, err)
+	}
+	return result(struct{}{}, e.PostCredential(context.Background()))
+}
+
+//export pebble_rotate_credential
+func pebble_rotate_credential(handle C.int64_t) *C.char {
+	e, err := election(handle)
+	if err != nil {
+		return result(nil, err)
+	}
+	return result(struct{}{}, e.RotateCredential(context.Background()))
+}
+
+//export pebble_vote
+func pebble_vote(handle C.int64_t, choices *C.char) *C.char {
+	e, err := election(handle)
+	if err != nil {
+		return result(nil, err)
+	}
+	var contests [][]int
+	err = json.Unmarshal([]byte(C.GoString(choices)), &contests)
+	if err != nil {
+		return result(nil, &util.APIError{Code: util.ErrorInvalidRequest, Message: "choices must be an array of arrays of choice indices"})
+	}
+	return result(struct{}{}, e.VoteContests(context.Background(), contests))
+}
+
+//export pebble_reveal
+func pebble_reveal(handle C.int64_t) *C.char {
+	e, err := election(handle)
+	if err != nil {
+		return result(nil, err)
+	}
+	return result(struct{}{}, e.RevealBallotDecryption(context.Background()))
+}
+
+//export pebble_reveal_key
+func pebble_reveal_key(handle C.int64_t) *C.char {
+	e, err := election(handle)
+	if err != nil {
+		return result(nil, err)
+	}
+	return result(struct{}{}, e.RevealBallotKey(context.Background()))
+}
+
+//export pebble_progress
+func pebble_progress(handle C.int64_t) *C.char {
+	mu.Lock()
+	j, ok := elections[int64(handle)]
+	mu.Unlock()
+	if !ok {
+		return result(nil, errInvalidHandle)
+	}
+	e := j.election
+	var p voting.ElectionProgress
+	var synced time.Time
+	if j.syncer != nil {
+		p, synced, _ = j.syncer.Progress()
+	}
+	if synced.IsZero() {
+		var err error
+		p, err = e.Progress(context.Background())
+		if err != nil {
+			return result(nil, err)
+		}
+	}
+	res := struct {
+		Phase   string           `json:"phase"`
+		Count   int              `json:"count"`
+		Total   int              `json:"total"`
+		Results []methods.Result `json:"results,omitempty"`
+	}{Phase: p.Phase.String(), Count: p.Count, Total: p.Total}
+	if p.Phase == voting.End {
+		res.Results = e.Results(p)
+	}
+	return result(res, nil)
+}
+
+//export pebble_ballots
+func pebble_ballots(handle C.int64_t) *C.char {
+	e, err := election(handle)
+	if err != nil {
+		return result(nil, err)
+	}
+	rs, err := e.Ballots()
+	if err != nil {
+		return result(nil, err)
+	}
+	posted, err := e.PostedBallot(context.Background())
+	if err != nil {
+		return result(nil, err)
+	}
+	type ballot struct {
+		Time         time.Time `json:"time"`
+		TrackingCode string    `json:"trackingCode"`
+		Posted       bool      `json:"posted"`
+	}
+	res := struct {
+		Ballots []ballot `json:"ballots"`
+	}{Ballots: make([]ballot, len(rs))}
+	for i, r := range rs {
+		res.Ballots[i] = ballot{Time: r.Time, TrackingCode: hex.EncodeToString(r.TrackingCode[:])}
+		res.Ballots[i].Posted = posted != nil && posted.TrackingCode == r.TrackingCode
+	}
+	return result(res, nil)
+}
+
+//export pebble_choice_order
+func pebble_choice_order(handle, contest C.int64_t) *C.char {
+	e, err := election(handle)
+	if err != nil {
+		return result(nil, err)
+	}
+	order, err := e.ChoiceOrder(int(contest))
+	if err != nil {
+		return result(nil, err)
+	}
+	return result(struct {
+		Order []int `json:"order"`
+	}{order}, nil)
+}
+
+//export pebble_verify_ballot
+func pebble_verify_ballot(handle C.int64_t) *C.char {
+	e, err := election(handle)
+	if err != nil {
+		return result(nil, err)
+	}
+	v, err := e.VerifyBallot(context.Background())
+	if err != nil {
+		return result(nil, err)
+	}
+	res := struct {
+		Phase          string `json:"phase"`
+		TrackingCode   string `json:"trackingCode,omitempty"`
+		Recorded       bool   `json:"recorded"`
+		InclusionProof string `json:"inclusionProof,omitempty"`
+		ValidSignature bool   `json:"validSignature"`
+		Decrypted      bool   `json:"decrypted"`
+		Counted        bool   `json:"counted"`
+		Rejection      string `json:"rejection,omitempty"`
+	}{Phase: v.Phase.String(), Recorded: v.Recorded, ValidSignature: v.ValidSignature, Decrypted: v.Decrypted, Counted: v.Counted}
+	if v.TrackingCode != (util.HashValue{}) {
+		res.TrackingCode = hex.EncodeToString(v.TrackingCode[:])
+	}
+	if v.Inclusion != nil {
+		res.InclusionProof = hex.EncodeToString(v.Inclusion.Bytes())
+	}
+	if v.Rejection != 0 {
+		res.Rejection = v.Rejection.String()
+	}
+	return result(res, nil)
+}
+
+//export pebble_close
+func pebble_close(handle C.int64_t) *C.char {
+	mu.Lock()
+	defer mu.Unlock()
+	j, ok := elections[int64(handle)]
+	if !ok {
+		return result(nil, errInvalidHandle)
+	}
+	if j.stop != nil {
+		j.stop()
+	}
+	delete(elections, int64(handle))
+	return result(struct{}{}, j.client.Close())
+}
+
+//export pebble_set_sync
+func pebble_set_sync(interval, jitter C.int64_t) *C.char {
+	if interval < 0 || jitter < 0 {
+		return result(nil, &util.APIError{Code: util.ErrorInvalidRequest, Message: "sync interval and jitter must not be negative"})
+	}
+	mu.Lock()
+	syncConfig.Interval = time.Duration(interval) * time.Millisecond
+	syncConfig.Jitter = time.Duration(jitter) * time.Millisecond
+	mu.Unlock()
+	return result(struct{}{}, nil)
+}
+
+//export pebble_set_cache
+func pebble_set_cache(dir *C.char) *C.char {
+	path := C.GoString(dir)
+	if path != "" {
+		if err := os.MkdirAll(path, 0700); err != nil {
+			return result(nil, err)
+		}
+	}
+	mu.Lock()
+	cacheDir = path
+	mu.Unlock()
+	return result(struct{}{}, nil)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/base32c"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/secrets"
+)
+
+var errConflictingCertifications = errors.New("certifications were posted for another result than the recount")
+
+/*
+Audits an ended election without any voter secrets: downloads its params and messages from the
+invitation, or reads them from the transcript given by -transcript, recounts the result with the
+declared method (see voting.Election.Audit) and writes the audit report signed with the auditor
+key of the -key secrets file, generated on first use. Fails if certifications sign another result.
+*/
+func audit(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	keyFile := fs.String("key", "", "secrets file keeping the auditor key")
+	output := fs.String("o", "", "file receiving the signed report, instead of the standard output")
+	transcriptFile := fs.String("transcript", "", "transcript of the election, given by its ID instead of an invitation")
+	paramsFile := fs.String("params", "", "params of the transcript, if it does not start with them")
+	fs.Parse(args)
+	if *keyFile == "" || fs.NArg() != 1 {
+		return errUsage
+	}
+	key, err := auditorKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	bc, err := openChannel(fs.Arg(0), *transcriptFile, *paramsFile)
+	if err != nil {
+		return err
+	}
+	e, err := voting.NewElection(ctx, bc, nil)
+	if err != nil {
+		return err
+	}
+	report, err := e.Audit(ctx)
+	if err == voting.ErrWrongPhase {
+		return fmt.Errorf("election has not ended: %v", err)
+	} else if err != nil {
+		return err
+	}
+	err = report.Sign(key)
+	if err != nil {
+		return err
+	}
+	body, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		fmt.Println(string(body))
+	} else if err = os.WriteFile(*output, append(body, '\n'), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Audited %q: %d messages, %d ballots counted, certified: %v\n",
+		report.Title, report.Messages, report.Result.Valid, report.Certified)
+	if report.Conflicting != 0 {
+		return errConflictingCertifications
+	}
+	return nil
+}
+
+// Reads the auditor key from the secrets file, generating and storing it on first use.
+func auditorKey(file string) (pubkey.PrivateKey, error) {
+	fm, err := secrets.OpenFile(file)
+	if err != nil {
+		return pubkey.PrivateKey{}, err
+	}
+	key, err := fm.GetPrivateKey()
+	if err == secrets.ErrNoPrivateKey {
+		key, err = pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+		if err == nil {
+			err = fm.SetPrivateKey(key)
+		}
+	}
+	return key, err
+}
+
+// Opens the channel of the invitation, or the transcript file of the election with the ID if set.
+func openChannel(arg, transcriptFile, paramsFile string) (voting.BroadcastChannel, error) {
+	if transcriptFile != "" {
+		return readTranscript(arg, transcriptFile, paramsFile)
+	}
+	inv, err := voting.DecodeInvitation(arg)
+	if err != nil {
+		return nil, err
+	}
+	return voting.NewBroadcastClient(inv)
+}
+
+// Mounts the transcript of the election with the ID, given in hex or base32c.
+func readTranscript(election, file, paramsFile string) (*voting.TranscriptChannel, error) {
+	var id voting.ElectionID
+	b, err := hex.DecodeString(election)
+	if err != nil || len(b) != len(id) {
+		b, err = base32c.Decode(election)
+	}
+	if err != nil || len(b) != len(id) {
+		return nil, fmt.Errorf("invalid election ID %q", election)
+	}
+	copy(id[:], b)
+	var params *voting.ElectionParams
+	if paramsFile != "" {
+		b, err := os.ReadFile(paramsFile)
+		if err != nil {
+			return nil, err
+		}
+		params = new(voting.ElectionParams)
+		err = params.FromBytes(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	transcript, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return voting.ReadTranscript(id, transcript, params)
+}
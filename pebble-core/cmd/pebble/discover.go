@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/client"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/server"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/secrets"
+)
+
+// Lists the public elections of a server.
+func elections(args []string) error {
+	fs := flag.NewFlagSet("elections", flag.ExitOnError)
+	serverURL := fs.String("server", "", "server listing its public elections")
+	fs.Parse(args)
+	if *serverURL == "" {
+		return errUsage
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	list, err := client.New(*serverURL).Elections(ctx)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		fmt.Println("No public elections")
+	}
+	for i, e := range list {
+		fmt.Printf("%d. %s [%s]\n   Backend ID: %s\n", i+1, e.Title, e.Phase, e.BackendId)
+		if e.Description != "" {
+			fmt.Printf("   %s\n", e.Description)
+		}
+	}
+	return nil
+}
+
+/*
+Joins a public election of a server, given its backend ID or its number in the listing,
+checking its params. With -secrets, the voter key is read from the secrets file, or generated
+and stored there, and the voter registers if the registration is open.
+*/
+func joinPublic(args []string) error {
+	fs := flag.NewFlagSet("join", flag.ExitOnError)
+	serverURL := fs.String("server", "", "server listing the election")
+	secretsFile := fs.String("secrets", "", "file keeping the voter key and secrets, for registering")
+	fs.Parse(args)
+	if *serverURL == "" || fs.NArg() != 1 {
+		return errUsage
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	list, err := client.New(*serverURL).Elections(ctx)
+	if err != nil {
+		return err
+	}
+	listed, err := findElection(list, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	inv, err := voting.DecodeInvitation(listed.Invitation)
+	if err != nil {
+		return err
+	}
+	bc, err := voting.NewBroadcastClient(inv)
+	if err != nil {
+		return err
+	}
+	var sec secrets.SecretsManager
+	var key pubkey.PrivateKey
+	if *secretsFile != "" {
+		fm, err := secrets.OpenFile(*secretsFile)
+		if err != nil {
+			return err
+		}
+		key, err = fm.GetPrivateKey()
+		if err == secrets.ErrNoPrivateKey {
+			key, err = pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+			if err == nil {
+				err = fm.SetPrivateKey(key)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		sec = fm
+	}
+	e, err := voting.NewElection(ctx, bc, sec)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Joined %q [%s]\nInvitation: %s\n", e.Params().Title, e.Phase(), listed.Invitation)
+	if sec == nil {
+		return nil
+	}
+	pk, err := key.Public().String()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Voter key: %s\n", pk)
+	if e.Phase() != voting.CredGen {
+		fmt.Println("Registration is closed")
+		return nil
+	}
+	err = e.PostCredential(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Registered")
+	return nil
+}
+
+// Finds a listed election by backend ID or by its 1-based number in the list.
+func findElection(list []server.PublicElection, arg string) (server.PublicElection, error) {
+	for _, e := range list {
+		if e.BackendId == arg {
+			return e, nil
+		}
+	}
+	if n, err := strconv.Atoi(arg); err == nil && n >= 1 && n <= len(list) {
+		return list[n-1], nil
+	}
+	fmt.Fprintf(os.Stderr, "%d public elections listed\n", len(list))
+	return server.PublicElection{}, fmt.Errorf("no public election %q", arg)
+}
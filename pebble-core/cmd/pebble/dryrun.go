@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/bits"
+	"os"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/manifest"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/sim"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/methods"
+)
+
+/*
+Runs a throwaway election with the params of a manifest in memory, on the clock of package sim
+compressing each phase to seconds, and prints the tally of the simulated voters, so that
+organizers check their configuration before the real election.
+*/
+func dryrun(args []string) error {
+	fs := flag.NewFlagSet("dryrun", flag.ExitOnError)
+	file := fs.String("f", "", "election manifest (YAML or JSON)")
+	numVoters := fs.Int("voters", 5, "number of simulated voters")
+	abstentions := fs.Int("abstentions", 1, "simulated voters registering without voting")
+	phase := fs.Duration("phase", 10*time.Second, "length of each phase on the simulated clock")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "seed of the choices of the voters")
+	credParams := fs.String("credential-params", "", "credential system parameters; a throwaway system is set up if not set")
+	fs.Parse(args)
+	if *file == "" || *numVoters < 1 || *abstentions < 0 || *abstentions > *numVoters || *phase <= 0 {
+		return errUsage
+	}
+	m, err := manifest.Read(*file)
+	if err != nil {
+		return err
+	}
+	_, params, err := m.SetupParams()
+	if err != nil {
+		return err
+	}
+	credSys := new(anoncred.AnonCred1)
+	if *credParams != "" {
+		p, err := os.ReadFile(*credParams)
+		if err != nil {
+			return err
+		}
+		err = credSys.FromBytes(p)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Deep enough for the credentials of the voters
+		depth := bits.Len(uint(*numVoters - 1))
+		if depth < 2 {
+			depth = 2
+		}
+		fmt.Println("Setting up a throwaway credential system...")
+		err = credSys.SetupCircuit(depth)
+		if err != nil {
+			return err
+		}
+	}
+	ctx := context.Background()
+	s, err := sim.New(ctx, sim.Config{
+		Voters:           *numVoters,
+		Abstentions:      *abstentions,
+		Registration:     *phase,
+		Voting:           *phase,
+		Tally:            *phase,
+		Seed:             *seed,
+		CredentialSystem: credSys,
+		Params:           params,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Dry run of %q with %d voters, %d abstaining, in phases of %v\n", params.Title, *numVoters, *abstentions, *phase)
+	res, err := s.Run(ctx)
+	if err != nil {
+		return err
+	}
+	registered, voted, revealed := 0, 0, 0
+	for _, v := range s.Voters {
+		if v.Err != nil {
+			fmt.Printf("Voter %d failed: %v\n", v.Index, v.Err)
+			continue
+		}
+		registered++
+		if v.Voted {
+			voted++
+		}
+		if v.Revealed {
+			revealed++
+		}
+	}
+	fmt.Printf("Registered %d, voted %d, revealed %d\n", registered, voted, revealed)
+	prog := res.Progress
+	fmt.Printf("Counted %d ballots, rejected %d\n", prog.Count, len(prog.Rejected))
+	for reason, n := range prog.Rejections {
+		fmt.Printf("  %s: %d\n", reason, n)
+	}
+	for i, c := range s.Params.ContestList() {
+		if i >= len(prog.Tallies) {
+			break
+		}
+		fmt.Printf("%s (%s)\n", c.Title, c.VotingMethod)
+		for _, tc := range prog.Tallies[i] {
+			name := "Blank"
+			if tc.Index != methods.BlankIndex {
+				name = c.Choices[tc.Index]
+			}
+			fmt.Printf("  %-24s %d\n", name, tc.Count)
+		}
+	}
+	if err = res.Check(); err != nil {
+		return err
+	}
+	fmt.Println("Tally matches the ballots cast")
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+/*
+Converts an eligibility list between formats, chosen by file extension:
+.csv and .json voter lists, or the binary EligibilityList otherwise.
+Prints the import report and the Merkle root of the list.
+*/
+func eligibility(args []string) error {
+	fs := flag.NewFlagSet("eligibility", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errUsage
+	}
+	in, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var list *structs.EligibilityList
+	var report *structs.EligibilityReport
+	switch strings.ToLower(filepath.Ext(fs.Arg(0))) {
+	case ".csv":
+		list, report, err = structs.ReadEligibilityCSV(bytes.NewReader(in))
+	case ".json":
+		list, report, err = structs.ReadEligibilityJSON(bytes.NewReader(in))
+	default:
+		list = structs.NewEligibilityList()
+		err = list.FromBytes(in)
+	}
+	if err != nil {
+		return err
+	}
+	if report != nil {
+		fmt.Print(report)
+	}
+	var out bytes.Buffer
+	switch strings.ToLower(filepath.Ext(fs.Arg(1))) {
+	case ".csv":
+		err = list.WriteCSV(&out)
+	case ".json":
+		err = list.WriteJSON(&out)
+	default:
+		_, err = out.Write(list.Bytes())
+	}
+	if err != nil {
+		return err
+	}
+	return writeEligibility(fs.Arg(1), list, out.Bytes())
+}
+
+// Prints the size and Merkle root of list and writes its encoding to output.
+func writeEligibility(output string, list *structs.EligibilityList, encoded []byte) error {
+	root := list.Root()
+	fmt.Printf("%d voters, root %s\n", list.Len(), hex.EncodeToString(root[:]))
+	return os.WriteFile(output, encoded, 0644)
+}
@@ -0,0 +1,229 @@
+/*
+Command line tool for election organizers.
+
+	pebble create -f election.yaml [-server url]
+
+creates the election described by the manifest (see package manifest) on its server,
+waits for the setup and prints the invitation to share with the voters. The server
+password, if any, is read from the PEBBLE_PASSWORD environment variable.
+
+	pebble simulate -voters 1000 -method Approval [-server url]
+
+load-tests a server, or a local mock server: it creates an election for synthetic voters,
+which register, vote and reveal their ballots concurrently, and reports the throughput and
+latency of each step, the time taken to verify all the ballots, and whether the tally
+matches the ballots cast.
+
+	pebble dryrun -f election.yaml [-voters 5] [-abstentions 1] [-phase 10s]
+
+runs a throwaway election with the params of the manifest in memory before the real one, on a
+simulated clock compressing each phase to seconds: a few simulated voters register, vote with
+random choices and reveal their ballots, and the tally of each contest is printed and checked.
+
+	pebble elections -server url
+	pebble join -server url [-secrets file] <backend ID or number>
+
+list the public elections of a server, and join one of them from the listing instead of an
+invitation. With -secrets, the voter key is kept in the secrets file, generated on first use,
+and the voter registers while the registration is open.
+
+	pebble vectors [-o vectors.json] [-voters 2]
+
+writes test vectors for other implementations of the protocol: the params and messages of
+a simulated election as encoded by this implementation, with their hashes and decoded fields.
+Ballots carry fresh randomness, so implementations check their decoding against a generated
+file rather than regenerate it.
+
+	pebble solve [-interval 1m] [-once] <invitation>
+
+opens the late ballots of an election: during the Tally phase, it solves the VDF puzzles of the
+ballots whose voters did not reveal them, up to the maximum difficulty of the params, and posts
+the solutions, scanning the election again at each interval until the tally ends.
+
+	pebble verify-ballot -secrets file <invitation>
+
+tells a voter whether the ballot cast with the secrets file is recorded, with the inclusion proof
+of the server if it proves inclusion, validly signed, decrypted and counted. It exits with an
+error if the ballot is not counted once the election ended.
+
+	pebble rotate-credential -secrets file <invitation>
+
+replaces the credential registered with the secrets file by a new one while the registration is
+open, for voters who suspect their secrets leaked. The new credential is signed with the voter
+key of the secrets file, and the earlier one cannot be registered again.
+
+	pebble audit -key file [-o report.json] <invitation>
+	pebble audit -key file [-o report.json] -transcript file [-params file] <election ID>
+
+audits an ended election without voter secrets: it downloads the params and messages, or reads
+them from a transcript, recounts the result with the declared method, and writes a report of the
+result, the rejected ballots and the certifications found, signed with the auditor key kept in
+the -key secrets file.
+
+	pebble report [-o report.json] <invitation>
+	pebble report [-o report.json] -transcript file [-params file] <election ID>
+
+writes the summary report of an election for publication alongside its result: params, schedule,
+turnout, message counts by phase and type, the result and its certifications, and the anomalies
+found, such as rejected ballots or messages received outside their phase.
+
+	pebble template save -server url -f election.yaml <name>
+	pebble template save -server url -from <admin ID> <name>
+	pebble template list|show|delete -server url [<name>]
+
+saves the election described by a manifest, or the setup of an election created on the server,
+as a template of the server, lists the templates, prints one as JSON or deletes it.
+
+	pebble clone -server url -template name -start 2026-12-07T18:00:00Z [-end time] [-title title]
+	pebble clone -server url -from <admin ID> -start 2026-12-07T18:00:00Z [-end time] [-title title]
+
+creates an election from a template or a past election, with the same params and voters, for
+recurring votes such as monthly board meetings. Its dates move with the vote start, keeping the
+length of each phase unless -end is given. It prints the invitation as pebble create does.
+
+	pebble add-voters -server url -admin <admin ID> <voter key>...
+
+adds voters missed at setup to the eligibility list of an election while its registration is
+open, with an update signed by the organizer that the clients merge into the list.
+
+	pebble eligibility <input> <output>
+
+converts an eligibility list between formats, chosen by file extension: .csv and .json voter
+lists, or the binary list of the params otherwise. It prints the import report, such as the
+duplicate or invalid keys skipped, and the Merkle root of the list.
+
+	pebble tezos-holders -token <contract> [-token-id id] -level <level> [-weights] <output>
+	pebble tezos-holders -baker <address> -cycle <cycle> <output>
+
+builds an eligibility list from the holders of a Tezos token at a block level, or the delegators
+of a baker at a cycle, as indexed by TzKT (-tzkt). Holders whose public key is not revealed are
+skipped and printed. The output is written as pebble eligibility does, except that JSON output
+keeps the holder addresses and, with -weights, their balances.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/client"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/manifest"
+)
+
+var errUsage = errors.New("usage: pebble create -f <manifest> [-server <url>] | pebble simulate [-voters <n>] [-method <name>] [-server <url>] | " +
+	"pebble dryrun -f <manifest> [-voters <n>] [-abstentions <n>] [-phase <duration>] | " +
+	"pebble elections -server <url> | pebble join -server <url> [-secrets <file>] <election> | pebble vectors [-o <file>] | " +
+	"pebble solve [-interval <duration>] [-once] <invitation> | pebble verify-ballot -secrets <file> <invitation> | " +
+	"pebble rotate-credential -secrets <file> <invitation> | " +
+	"pebble audit -key <file> [-o <file>] [-transcript <file> [-params <file>]] <invitation or election> | " +
+	"pebble report [-o <file>] [-transcript <file> [-params <file>]] <invitation or election> | " +
+	"pebble template save|list|show|delete -server <url> [-f <manifest> | -from <admin ID>] [<name>] | " +
+	"pebble clone -server <url> (-template <name> | -from <admin ID>) -start <time> [-end <time>] [-title <title>] [-admin <admin ID>] | " +
+	"pebble add-voters -server <url> -admin <admin ID> <voter key>... | pebble eligibility <input> <output> | " +
+	"pebble tezos-holders (-token <contract> [-token-id <id>] -level <level> | -baker <address> -cycle <cycle>) [-weights] <output>")
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, errUsage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "create":
+		err = create(os.Args[2:])
+	case "simulate":
+		err = simulate(os.Args[2:])
+	case "dryrun":
+		err = dryrun(os.Args[2:])
+	case "elections":
+		err = elections(os.Args[2:])
+	case "join":
+		err = joinPublic(os.Args[2:])
+	case "vectors":
+		err = vectors(os.Args[2:])
+	case "solve":
+		err = solve(os.Args[2:])
+	case "verify-ballot":
+		err = verifyBallot(os.Args[2:])
+	case "rotate-credential":
+		err = rotateCredential(os.Args[2:])
+	case "audit":
+		err = audit(os.Args[2:])
+	case "report":
+		err = report(os.Args[2:])
+	case "template":
+		err = template(os.Args[2:])
+	case "clone":
+		err = clone(os.Args[2:])
+	case "add-voters":
+		err = addVoters(os.Args[2:])
+	case "eligibility":
+		err = eligibility(os.Args[2:])
+	case "tezos-holders":
+		err = tezosHolders(os.Args[2:])
+	default:
+		err = errUsage
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func create(args []string) error {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	file := fs.String("f", "", "election manifest (YAML or JSON)")
+	serverURL := fs.String("server", "", "server creating the election, overriding the backend of the manifest")
+	timeout := fs.Duration("timeout", 5*time.Minute, "time to wait for the election setup")
+	fs.Parse(args)
+	if *file == "" {
+		return errUsage
+	}
+	m, err := manifest.Read(*file)
+	if err != nil {
+		return err
+	}
+	if *serverURL != "" {
+		m.Backend.Server = *serverURL
+	}
+	if m.Backend.Server == "" {
+		return manifest.ErrNoServer
+	}
+	spar, params, err := m.SetupParams()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Election %q: %d voters, voting from %s to %s\n", params.Title, len(spar.Voters),
+		params.CastStart.Format(time.RFC3339), params.TallyStart.Format(time.RFC3339))
+	c := adminClient(m.Backend.Server)
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	err = c.Create(ctx, spar)
+	if err != nil {
+		return err
+	}
+	return waitSetup(ctx, c, spar.AdminId)
+}
+
+// Returns a client of the server authenticated with the password of PEBBLE_PASSWORD, if set.
+func adminClient(serverURL string) *client.Client {
+	var opts []client.Option
+	if pass, ok := os.LookupEnv("PEBBLE_PASSWORD"); ok {
+		opts = append(opts, client.WithPassword("admin", pass))
+	}
+	return client.New(serverURL, opts...)
+}
+
+// Waits for the setup of the election created with adminId and prints its invitation.
+func waitSetup(ctx context.Context, c *client.Client, adminId string) error {
+	info, err := c.WaitSetup(ctx, adminId, time.Second)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Admin ID: %s\nBackend ID: %s\nInvitation: %s\n", adminId, info.BackendId, info.Invitation)
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+)
+
+/*
+Writes the summary report of an election (see voting.Election.Report), from its invitation or
+from the transcript given by -transcript, for publication alongside its result.
+*/
+func report(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	output := fs.String("o", "", "file receiving the report, instead of the standard output")
+	transcriptFile := fs.String("transcript", "", "transcript of the election, given by its ID instead of an invitation")
+	paramsFile := fs.String("params", "", "params of the transcript, if it does not start with them")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+	bc, err := openChannel(fs.Arg(0), *transcriptFile, *paramsFile)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	e, err := voting.NewElection(ctx, bc, nil)
+	if err != nil {
+		return err
+	}
+	r, err := e.Report(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		fmt.Println(string(body))
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Report of %q [%s]: %d messages, %d anomalies\n", r.Title, r.Phase, r.Messages, len(r.Anomalies))
+	return os.WriteFile(*output, append(body, '\n'), 0644)
+}
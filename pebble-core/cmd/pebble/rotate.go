@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/secrets"
+)
+
+/*
+Replaces the credential registered with a secrets file by a new one while the registration is
+open (see voting.Election.RotateCredential), for voters who suspect their secrets file leaked.
+*/
+func rotateCredential(args []string) error {
+	fs := flag.NewFlagSet("rotate-credential", flag.ExitOnError)
+	secretsFile := fs.String("secrets", "", "file keeping the voter key and credential")
+	fs.Parse(args)
+	if *secretsFile == "" || fs.NArg() != 1 {
+		return errUsage
+	}
+	inv, err := voting.DecodeInvitation(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	bc, err := voting.NewBroadcastClient(inv)
+	if err != nil {
+		return err
+	}
+	sec, err := secrets.OpenFile(*secretsFile)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	e, err := voting.NewElection(ctx, bc, sec)
+	if err != nil {
+		return err
+	}
+	err = e.RotateCredential(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Credential of %q replaced\n", e.Params().Title)
+	return nil
+}
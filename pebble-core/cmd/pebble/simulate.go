@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/client"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/server"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/methods"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/secrets"
+)
+
+var errTallyMismatch = errors.New("pebble: tally does not match the ballots cast")
+
+// A synthetic voter and the choices it votes for.
+type simVoter struct {
+	index    int
+	key      pubkey.PrivateKey
+	choices  []int
+	election *voting.Election
+}
+
+// Durations of the operations of one kind, and the failures.
+type simStats struct {
+	name      string
+	durations []time.Duration
+	failures  int
+	lastErr   error
+	elapsed   time.Duration
+}
+
+func (s *simStats) print() {
+	n := len(s.durations)
+	fmt.Printf("%-12s %6d ok %4d failed", s.name, n, s.failures)
+	if n != 0 {
+		sort.Slice(s.durations, func(i, j int) bool {
+			return s.durations[i] < s.durations[j]
+		})
+		p := func(q float64) time.Duration {
+			return s.durations[int(q*float64(n-1))].Round(time.Millisecond)
+		}
+		fmt.Printf("  %8.1f/s  p50 %v  p95 %v  max %v", float64(n)/s.elapsed.Seconds(), p(0.5), p(0.95), p(1))
+	}
+	fmt.Println()
+	if s.lastErr != nil {
+		fmt.Printf("%-12s last error: %v\n", "", s.lastErr)
+	}
+}
+
+// Runs op for each voter on the given number of workers, measuring each call.
+func runVoters(name string, voters []*simVoter, workers int, op func(v *simVoter) error) *simStats {
+	s := &simStats{name: name}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	next := make(chan *simVoter)
+	start := time.Now()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range next {
+				t := time.Now()
+				err := op(v)
+				d := time.Since(t)
+				mu.Lock()
+				if err != nil {
+					s.failures++
+					s.lastErr = err
+				} else {
+					s.durations = append(s.durations, d)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, v := range voters {
+		next <- v
+	}
+	close(next)
+	wg.Wait()
+	s.elapsed = time.Since(start)
+	return s
+}
+
+// Starts a mock server on a local port, returning its URL.
+func startMockServer() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	url := "http://" + l.Addr().String()
+	go http.Serve(l, server.NewMockServer(url, nil))
+	return url, nil
+}
+
+// Picks random choices valid for the method: one choice, or a non-empty subset for approval voting.
+func randomChoices(method string, numChoices int) []int {
+	if method != "Approval" {
+		return []int{rand.Intn(numChoices)}
+	}
+	var choices []int
+	for len(choices) == 0 {
+		for i := 0; i < numChoices; i++ {
+			if rand.Intn(2) == 0 {
+				choices = append(choices, i)
+			}
+		}
+	}
+	return choices
+}
+
+func waitPhase(ctx context.Context, e *voting.Election, phase voting.ElectionPhase) error {
+	for e.Phase() < phase {
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func simulate(args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	numVoters := fs.Int("voters", 100, "number of synthetic voters")
+	method := fs.String("method", "Plurality", "voting method")
+	numChoices := fs.Int("choices", 3, "number of choices")
+	serverURL := fs.String("server", "", "server hosting the election; a local mock server is started if not set")
+	workers := fs.Int("concurrency", 16, "number of voters acting at the same time")
+	register := fs.Duration("register", 30*time.Second, "length of the registration phase")
+	vote := fs.Duration("vote", 30*time.Second, "length of the voting phase")
+	credParams := fs.String("credential-params", "anoncred1-params.bin", "credential system parameters")
+	timeout := fs.Duration("timeout", 10*time.Minute, "time limit of the simulation")
+	fs.Parse(args)
+	if *numVoters < 1 || *numChoices < 2 || *workers < 1 {
+		return errUsage
+	}
+	if _, err := methods.Get(*method, *numChoices, nil); err != nil {
+		return fmt.Errorf("%w: %s", err, *method)
+	}
+	p, err := os.ReadFile(*credParams)
+	if err != nil {
+		return err
+	}
+	credSys := new(anoncred.AnonCred1)
+	err = credSys.FromBytes(p)
+	if err != nil {
+		return err
+	}
+	anoncred.AnonCred1Instance = credSys
+	dir, err := os.MkdirTemp("", "pebble-simulate")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if *serverURL == "" {
+		*serverURL, err = startMockServer()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Mock server listening on", *serverURL)
+	}
+	choices := make([]string, *numChoices)
+	for i := range choices {
+		choices[i] = fmt.Sprintf("Choice %d", i+1)
+	}
+	spar := server.ElectionSetupParams{
+		AdminId: fmt.Sprintf("simulate-%d", time.Now().UnixNano()),
+		Title:   "Simulated election",
+		Method:  *method,
+		Choices: choices,
+	}
+	voters := make([]*simVoter, *numVoters)
+	expected := make([]uint64, *numChoices)
+	for i := range voters {
+		k, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+		if err != nil {
+			return err
+		}
+		key, err := k.Public().String()
+		if err != nil {
+			return err
+		}
+		voters[i] = &simVoter{index: i, key: k, choices: randomChoices(*method, *numChoices)}
+		for _, c := range voters[i].choices {
+			expected[c]++
+		}
+		spar.Voters = append(spar.Voters, server.ElectionSetupVoter{Id: fmt.Sprintf("voter-%d", i), Key: key})
+	}
+	// The setup time is included in the registration phase
+	voteStart := time.Now().Add(*register).Truncate(time.Second)
+	spar.RegEnd = voteStart.Format(time.RFC3339)
+	spar.VoteStart = spar.RegEnd
+	spar.VoteEnd = voteStart.Add(*vote).Format(time.RFC3339)
+
+	var opts []client.Option
+	if pass, ok := os.LookupEnv("PEBBLE_PASSWORD"); ok {
+		opts = append(opts, client.WithPassword("admin", pass))
+	}
+	c := client.New(*serverURL, opts...)
+	start := time.Now()
+	err = c.Create(ctx, spar)
+	if err != nil {
+		return err
+	}
+	info, err := c.WaitSetup(ctx, spar.AdminId, 100*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Election %s set up in %v, voting from %s\n", info.BackendId, time.Since(start).Round(time.Millisecond), spar.VoteStart)
+	inv, err := voting.DecodeInvitation(info.Invitation)
+	if err != nil {
+		return err
+	}
+	join := func(sec secrets.SecretsManager) (*voting.Election, error) {
+		bc, err := voting.NewBroadcastClient(inv)
+		if err != nil {
+			return nil, err
+		}
+		return voting.NewElection(ctx, bc, sec)
+	}
+
+	var stats []*simStats
+	stats = append(stats, runVoters("register", voters, *workers, func(v *simVoter) error {
+		sec, err := secrets.OpenFile(filepath.Join(dir, fmt.Sprintf("voter-%d.json", v.index)))
+		if err != nil {
+			return err
+		}
+		err = sec.SetPrivateKey(v.key)
+		if err != nil {
+			return err
+		}
+		v.election, err = join(sec)
+		if err != nil {
+			return err
+		}
+		return v.election.PostCredential(ctx)
+	}))
+	var joined []*simVoter
+	for _, v := range voters {
+		if v.election != nil {
+			joined = append(joined, v)
+		}
+	}
+	if len(joined) == 0 {
+		stats[0].print()
+		return stats[0].lastErr
+	}
+	observer, err := join(nil)
+	if err != nil {
+		return err
+	}
+	if err = waitPhase(ctx, observer, voting.Cast); err != nil {
+		return err
+	}
+	stats = append(stats, runVoters("vote", joined, *workers, func(v *simVoter) error {
+		return v.election.Vote(ctx, v.choices...)
+	}))
+	if err = waitPhase(ctx, observer, voting.Tally); err != nil {
+		return err
+	}
+	stats = append(stats, runVoters("reveal", joined, *workers, func(v *simVoter) error {
+		return v.election.RevealBallotDecryption(ctx)
+	}))
+	// Verifies all the ballots, as any observer does
+	verify := &simStats{name: "verify"}
+	t := time.Now()
+	prog, err := observer.Progress(ctx)
+	verify.elapsed = time.Since(t)
+	if err != nil {
+		verify.failures, verify.lastErr = 1, err
+	} else {
+		verify.durations = []time.Duration{verify.elapsed}
+	}
+	stats = append(stats, verify)
+	fmt.Printf("Simulated %d voters in %v\n", len(voters), time.Since(start).Round(time.Millisecond))
+	for _, s := range stats {
+		s.print()
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Counted %d ballots, rejected %d\n", prog.Count, len(prog.Rejected))
+	for reason, n := range prog.Rejections {
+		fmt.Printf("  %s: %d\n", reason, n)
+	}
+	for _, s := range stats[:3] {
+		if s.failures != 0 {
+			fmt.Println("Some voters failed, the tally is not checked")
+			return nil
+		}
+	}
+	for _, tc := range prog.Tally {
+		if tc.Index != methods.BlankIndex && tc.Count != expected[tc.Index] {
+			return errTallyMismatch
+		}
+	}
+	fmt.Println("Tally matches the ballots cast")
+	return nil
+}
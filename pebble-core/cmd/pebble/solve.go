@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+)
+
+/*
+Opens the late ballots of an election: during the Tally phase, solves the VDF puzzles of
+the ballots that no decryption opens and posts their solutions, scanning again at each
+interval until the tally ends or the worker is interrupted.
+*/
+func solve(args []string) error {
+	fs := flag.NewFlagSet("solve", flag.ExitOnError)
+	interval := fs.Duration("interval", time.Minute, "time between scans of the election")
+	once := fs.Bool("once", false, "scan the election once instead of until the tally ends")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+	inv, err := voting.DecodeInvitation(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	bc, err := voting.NewBroadcastClient(inv)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	e, err := voting.NewElection(ctx, bc, nil)
+	if err != nil {
+		return err
+	}
+	params := e.Params()
+	fmt.Printf("Election %q [%s], tally from %s to %s\n", params.Title, e.Phase(),
+		params.TallyStart.Format(time.RFC3339), params.TallyEnd.Format(time.RFC3339))
+	for {
+		switch e.Phase() {
+		case voting.Tally:
+			n, err := e.SolveBallots(ctx)
+			if err != nil {
+				return err
+			}
+			if n != 0 {
+				fmt.Printf("%s: opened %d ballots\n", e.Now().Format(time.RFC3339), n)
+			}
+		case voting.End:
+			fmt.Println("The tally has ended")
+			return nil
+		}
+		if *once {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
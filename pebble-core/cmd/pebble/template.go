@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/manifest"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/server"
+)
+
+// Saves, lists, shows or deletes the election templates of a server, see server.TemplateService.
+func template(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	fs := flag.NewFlagSet("template "+args[0], flag.ExitOnError)
+	serverURL := fs.String("server", "", "server keeping the templates")
+	file := fs.String("f", "", "election manifest saved as the template")
+	from := fs.String("from", "", "admin ID of the election saved as the template")
+	fs.Parse(args[1:])
+	if *serverURL == "" {
+		return errUsage
+	}
+	c := adminClient(*serverURL)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if args[0] == "list" {
+		names, err := c.Templates(ctx)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+	}
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+	name := fs.Arg(0)
+	switch args[0] {
+	case "save":
+		if (*file == "") == (*from == "") {
+			return errUsage
+		}
+		if *from != "" {
+			return c.SaveTemplateFrom(ctx, name, *from)
+		}
+		m, err := manifest.Read(*file)
+		if err != nil {
+			return err
+		}
+		spar, _, err := m.SetupParams()
+		if err != nil {
+			return err
+		}
+		return c.SaveTemplate(ctx, name, spar)
+	case "show":
+		spar, err := c.Template(ctx, name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(&spar)
+	case "delete":
+		return c.DeleteTemplate(ctx, name)
+	}
+	return errUsage
+}
+
+// Creates an election from a template or a past election with new dates, see server.CloneParams.
+func clone(args []string) error {
+	fs := flag.NewFlagSet("clone", flag.ExitOnError)
+	serverURL := fs.String("server", "", "server creating the election")
+	var cp server.CloneParams
+	fs.StringVar(&cp.Template, "template", "", "template of the election")
+	fs.StringVar(&cp.From, "from", "", "admin ID of the election to clone")
+	fs.StringVar(&cp.VoteStart, "start", "", "start of the vote (RFC 3339)")
+	fs.StringVar(&cp.VoteEnd, "end", "", "end of the vote (RFC 3339), keeping the length of the vote of the source by default")
+	fs.StringVar(&cp.Title, "title", "", "title of the election, instead of the title of the source")
+	fs.StringVar(&cp.AdminId, "admin", "", "admin ID of the election, generated by default")
+	timeout := fs.Duration("timeout", 5*time.Minute, "time to wait for the election setup")
+	fs.Parse(args)
+	if *serverURL == "" || cp.VoteStart == "" || (cp.Template == "") == (cp.From == "") {
+		return errUsage
+	}
+	c := adminClient(*serverURL)
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	adminId, err := c.Clone(ctx, cp)
+	if err != nil {
+		return err
+	}
+	return waitSetup(ctx, c, adminId)
+}
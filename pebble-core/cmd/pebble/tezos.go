@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/tzkt"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+/*
+Builds an eligibility list from the holders of a Tezos token (-token, -token-id, -level)
+or the delegators of a baker (-baker, -cycle), as indexed by TzKT.
+JSON output keeps the holder addresses and, with -weights, their balances.
+*/
+func tezosHolders(args []string) error {
+	fs := flag.NewFlagSet("tezos-holders", flag.ExitOnError)
+	indexer := fs.String("tzkt", "https://api.tzkt.io", "TzKT indexer listing the holders")
+	token := fs.String("token", "", "FA1.2 or FA2 token contract whose holders are eligible")
+	tokenId := fs.String("token-id", "0", "FA2 token ID")
+	level := fs.Int64("level", 0, "snapshot block level of token balances")
+	baker := fs.String("baker", "", "baker whose delegators are eligible")
+	cycle := fs.Int("cycle", 0, "snapshot cycle of delegations")
+	weights := fs.Bool("weights", false, "include balances as weights in JSON output")
+	fs.Parse(args)
+	if fs.NArg() != 1 || (*token == "") == (*baker == "") {
+		return errUsage
+	}
+	output := fs.Arg(0)
+	ctx := context.Background()
+	ix := tzkt.NewIndexer(*indexer)
+	var holders []tzkt.Holder
+	var err error
+	if *token != "" {
+		holders, err = ix.TokenHolders(ctx, *token, *tokenId, *level)
+	} else {
+		holders, err = ix.Delegators(ctx, *baker, *cycle)
+	}
+	if err != nil {
+		return err
+	}
+	entries, unrevealed, err := ix.EligibilityEntries(ctx, holders, *weights)
+	if err != nil {
+		return err
+	}
+	for _, addr := range unrevealed {
+		fmt.Printf("%s: public key not revealed\n", addr)
+	}
+	list, report := structs.NewEligibilityListFromEntries(entries)
+	fmt.Print(report)
+	var out bytes.Buffer
+	switch strings.ToLower(filepath.Ext(output)) {
+	case ".csv":
+		err = list.WriteCSV(&out)
+	case ".json":
+		enc := json.NewEncoder(&out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(entries)
+	default:
+		_, err = out.Write(list.Bytes())
+	}
+	if err != nil {
+		return err
+	}
+	return writeEligibility(output, list, out.Bytes())
+}
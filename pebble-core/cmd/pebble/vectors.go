@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/sim"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/vdf"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+)
+
+var errVectorRoundTrip = errors.New("pebble: test vector does not decode to the same bytes")
+
+// Version of the test vector file format.
+const testVectorsVersion = 1
+
+/*
+A test vector: bytes encoded by this implementation, their SHA-256 hash, and the fields
+that decoding them yields, with byte fields hex-encoded. Messages are encoded with their
+type byte, as hashed for duplicates and tracking codes, and also in a framing version 2
+envelope (see voting.DecodeEnvelopes).
+*/
+type testVector struct {
+	Name     string                 `json:"name"`
+	Type     string                 `json:"type"`
+	Hex      string                 `json:"hex"`
+	Hash     string                 `json:"hash"`
+	Envelope string                 `json:"envelope,omitempty"`
+	Fields   map[string]interface{} `json:"fields"`
+}
+
+type testVectors struct {
+	Version    int          `json:"version"`
+	ElectionId string       `json:"electionId"`
+	Vectors    []testVector `json:"vectors"`
+}
+
+func hexHash(h util.HashValue) string {
+	return hex.EncodeToString(h[:])
+}
+
+func newTestVector(name, kind string, p []byte, fields map[string]interface{}) testVector {
+	return testVector{Name: name, Type: kind, Hex: hex.EncodeToString(p), Hash: hexHash(util.Hash(p)), Fields: fields}
+}
+
+func paramsVector(p *voting.ElectionParams) (testVector, error) {
+	b := p.Bytes()
+	var decoded voting.ElectionParams
+	if err := decoded.FromBytes(b); err != nil {
+		return testVector{}, err
+	}
+	if !bytes.Equal(decoded.Bytes(), b) {
+		return testVector{}, errVectorRoundTrip
+	}
+	return newTestVector("params", "params", b, map[string]interface{}{
+		"version":          p.Version,
+		"title":            p.Title,
+		"votingMethod":     p.VotingMethod,
+		"choices":          p.Choices,
+		"credGenStart":     p.CredGenStart.Unix(),
+		"registrationEnd":  p.RegistrationEnd.Unix(),
+		"castStart":        p.CastStart.Unix(),
+		"tallyStart":       p.TallyStart.Unix(),
+		"tallyEnd":         p.TallyEnd.Unix(),
+		"maxVdfDifficulty": p.MaxVdfDifficulty,
+		"organizer":        hex.EncodeToString(p.Organizer),
+		"signature":        hex.EncodeToString(p.Signature),
+		"eligibleVoters":   p.EligibilityList.Len(),
+		"paramsHash":       hexHash(p.Hash()),
+		"electionId":       hexHash(p.ElectionId(voting.ServerNetwork)),
+	}), nil
+}
+
+// Returns the vector of a message, checking that the message and its envelope decode to the same bytes.
+func messageVector(name string, m voting.Message, fields map[string]interface{}) (testVector, error) {
+	m.Sequence, m.Received = 0, time.Time{}
+	b := m.Bytes()
+	decoded, err := voting.MessageFromBytes(b)
+	if err != nil {
+		return testVector{}, err
+	}
+	env := voting.EncodeEnvelopes([]voting.Message{m})
+	fromEnv, err := voting.DecodeEnvelopes(env)
+	if err != nil {
+		return testVector{}, err
+	}
+	if !bytes.Equal(decoded.Bytes(), b) || len(fromEnv) != 1 || !bytes.Equal(fromEnv[0].Bytes(), b) {
+		return testVector{}, errVectorRoundTrip
+	}
+	v := newTestVector(name, "message", b, fields)
+	v.Envelope = hex.EncodeToString(env)
+	return v, nil
+}
+
+/*
+Runs a simulated election and returns the vectors of its params and of the messages posted:
+credentials, signed ballots and the decryptions opening them, with the plaintext ballots.
+*/
+func generateVectors(ctx context.Context, credSys anoncred.CredentialSystem, voters int) (*testVectors, error) {
+	s, err := sim.New(ctx, sim.Config{
+		Voters:           voters,
+		Choices:          3,
+		VdfDifficulty:    7200,
+		Seed:             1,
+		Start:            time.Unix(1700000000, 0),
+		CredentialSystem: credSys,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = res.Check(); err != nil {
+		return nil, err
+	}
+	id := s.Params.ElectionId(voting.ServerNetwork)
+	tv := &testVectors{Version: testVectorsVersion, ElectionId: hexHash(id)}
+	v, err := paramsVector(s.Params)
+	if err != nil {
+		return nil, err
+	}
+	tv.Vectors = append(tv.Vectors, v)
+	msgs, err := s.Network.Channel().Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Ballots by the hash of their VDF input, opened by the decryptions
+	ballots := make(map[util.HashValue]voting.Message)
+	names := make(map[util.HashValue]string)
+	counts := make(map[string]int)
+	for _, m := range msgs {
+		var name string
+		var fields map[string]interface{}
+		switch {
+		case m.Credential != nil:
+			c := m.Credential
+			name = fmt.Sprintf("credential/%d", counts["credential"])
+			fields = map[string]interface{}{
+				"credential":     hex.EncodeToString(c.Credential),
+				"publicKey":      hex.EncodeToString(c.PublicKey),
+				"signature":      hex.EncodeToString(c.Signature),
+				"signatureValid": c.Verify(id) == nil,
+			}
+			if c.Epoch != 0 {
+				fields["epoch"] = c.Epoch
+			}
+			counts["credential"]++
+		case m.SignedBallot != nil:
+			b := m.SignedBallot
+			name = fmt.Sprintf("ballot/%d", counts["ballot"])
+			fields = map[string]interface{}{
+				"serialNo":     hex.EncodeToString(b.SerialNo),
+				"signature":    hex.EncodeToString(b.Signature),
+				"vdfInput":     hex.EncodeToString(b.EncryptedBallot.VdfInput),
+				"payload":      hex.EncodeToString(b.EncryptedBallot.Payload),
+				"trackingCode": hexHash(voting.BallotTrackingCode(*b)),
+			}
+			h := util.Hash(b.EncryptedBallot.VdfInput)
+			ballots[h], names[h] = m, name
+			counts["ballot"]++
+		case m.Decryption != nil:
+			d := m.Decryption
+			name = fmt.Sprintf("decryption/%d", counts["decryption"])
+			fields = map[string]interface{}{
+				"inputHash": hexHash(d.InputHash),
+				"output":    hex.EncodeToString(d.Output),
+				"proof":     hex.EncodeToString(d.Proof),
+			}
+			if b, ok := ballots[d.InputHash]; ok {
+				eb := b.SignedBallot.EncryptedBallot
+				plain, err := eb.Decrypt(vdf.VdfSolution{Input: eb.VdfInput, Output: d.Output, Proof: d.Proof})
+				if err != nil {
+					return nil, err
+				}
+				fields["opens"] = names[d.InputHash]
+				fields["ballot"] = hex.EncodeToString(plain)
+			}
+			counts["decryption"]++
+		default:
+			continue
+		}
+		v, err := messageVector(name, m, fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		tv.Vectors = append(tv.Vectors, v)
+	}
+	return tv, nil
+}
+
+func vectors(args []string) error {
+	fs := flag.NewFlagSet("vectors", flag.ExitOnError)
+	out := fs.String("o", "", "output file, standard output if not set")
+	numVoters := fs.Int("voters", 2, "number of voters of the election")
+	credParams := fs.String("credential-params", "anoncred1-params.bin", "credential system parameters")
+	fs.Parse(args)
+	if *numVoters < 1 {
+		return errUsage
+	}
+	p, err := os.ReadFile(*credParams)
+	if err != nil {
+		return err
+	}
+	credSys := new(anoncred.AnonCred1)
+	err = credSys.FromBytes(p)
+	if err != nil {
+		return err
+	}
+	tv, err := generateVectors(context.Background(), credSys, *numVoters)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(tv, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if *out == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(*out, b, 0644)
+}
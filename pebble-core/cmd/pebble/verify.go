@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/secrets"
+)
+
+var errBallotNotCounted = errors.New("the ballot is not counted")
+
+/*
+Tells a voter whether their ballot is recorded, validly signed, decrypted and counted
+(see voting.Election.VerifyBallot), from the secrets file they voted with. Fails if the
+ballot is not counted once the election ended.
+*/
+func verifyBallot(args []string) error {
+	fs := flag.NewFlagSet("verify-ballot", flag.ExitOnError)
+	secretsFile := fs.String("secrets", "", "file keeping the voter key and ballots")
+	fs.Parse(args)
+	if *secretsFile == "" || fs.NArg() != 1 {
+		return errUsage
+	}
+	inv, err := voting.DecodeInvitation(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	bc, err := voting.NewBroadcastClient(inv)
+	if err != nil {
+		return err
+	}
+	sec, err := secrets.OpenFile(*secretsFile)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	e, err := voting.NewElection(ctx, bc, sec)
+	if err != nil {
+		return err
+	}
+	v, err := e.VerifyBallot(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Election %q [%s]\n", e.Params().Title, v.Phase)
+	if v.TrackingCode == (util.HashValue{}) {
+		fmt.Println("No ballot was cast with these secrets")
+		return nil
+	}
+	fmt.Printf("Tracking code: %s\n", hex.EncodeToString(v.TrackingCode[:]))
+	fmt.Printf("Recorded: %s\n", yesNo(v.Recorded))
+	if !v.Recorded {
+		return nil
+	}
+	if v.Inclusion != nil {
+		c := v.Inclusion.Checkpoint
+		fmt.Printf("Inclusion: message %d of %d, root %s signed by the organizer\n",
+			v.Inclusion.Index+1, c.Count, hex.EncodeToString(c.Root[:]))
+	} else {
+		fmt.Println("Inclusion: no proof from the server")
+	}
+	fmt.Printf("Valid signature: %s\n", yesNo(v.ValidSignature))
+	if v.Phase < voting.Tally {
+		fmt.Println("Decrypted: not before the tally")
+		return nil
+	}
+	fmt.Printf("Decrypted: %s\n", yesNo(v.Decrypted))
+	if v.Rejection != 0 {
+		fmt.Printf("Counted: no (%s)\n", v.Rejection)
+	} else {
+		fmt.Printf("Counted: %s\n", yesNo(v.Counted))
+	}
+	if !v.Counted && v.Phase == voting.End {
+		return errBallotNotCounted
+	}
+	return nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
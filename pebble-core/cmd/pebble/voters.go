@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// Adds the voters missed at setup to an election while its registration is open, see server.VoterService.
+func addVoters(args []string) error {
+	fs := flag.NewFlagSet("add-voters", flag.ExitOnError)
+	serverURL := fs.String("server", "", "server hosting the election")
+	adminId := fs.String("admin", "", "admin ID of the election")
+	fs.Parse(args)
+	if *serverURL == "" || *adminId == "" || fs.NArg() == 0 {
+		return errUsage
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	added, err := adminClient(*serverURL).AddVoters(ctx, *adminId, fs.Args())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Added %d voters, %d already eligible\n", added, fs.NArg()-added)
+	return nil
+}
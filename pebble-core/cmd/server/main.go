@@ -2,18 +2,83 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"flag"
 	"fmt"
 	"net/http"
+	"net/smtp"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/giry-dev/pebble-voting-app/pebble-core/base32c"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/registration"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/server"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/timesource"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/trustee"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
 	"golang.org/x/term"
 )
 
-var flagPassHash = flag.String("passhash", "", "server password hash (sha256)")
+var (
+	flagPassHash = flag.String("passhash", "", "server password hash (sha256)")
+	flagNtp      = flag.String("ntp", "", "NTP server used as election time source (host:port)")
+	flagTezosRpc = flag.String("tezos-rpc", "", "Tezos node whose head block time is used as election time source")
+
+	flagSmtp     = flag.String("smtp", "", "SMTP server (host:port) sending email invitations in mock mode")
+	flagSmtpFrom = flag.String("smtp-from", "", "sender address of email invitations")
+	flagSmtpUser = flag.String("smtp-user", "", "SMTP username; the password is read from the PEBBLE_SMTP_PASSWORD environment variable")
+	flagLinkBase = flag.String("link-base", "", "base URL of registration links, followed by the token")
+
+	flagOidcIssuer   = flag.String("oidc-issuer", "", "OpenID Connect issuer authenticating voters in register mode")
+	flagOidcClient   = flag.String("oidc-client-id", "", "OpenID Connect client ID")
+	flagOidcSecret   = flag.String("oidc-client-secret", "", "OpenID Connect client secret")
+	flagOidcRedirect = flag.String("oidc-redirect", "", "OpenID Connect redirect URI, ending in /register/callback")
+	flagOidcEmail    = flag.Bool("oidc-verified-email", false, "only register identities with a verified email")
+
+	flagTranscript = flag.String("transcript", "", "archived message log recounted by tally, as served by /messages with framing=3")
+	flagParams     = flag.String("params", "", "election params used by tally instead of those in the transcript, as served by /params")
+	flagArchive    = flag.String("archive", "", "signed election archive replayed by tally, as served by /archive")
+
+	flagQuarantine = flag.Int("quarantine", 0, "number of rejected posts kept in memory for auditors at /quarantine in mock mode")
+
+	flagWebhooks = flag.String("webhooks", "", "comma-separated URLs notified when elections enter Tally and end, in mock mode; "+
+		"payloads are signed with the PEBBLE_WEBHOOK_SECRET environment variable")
+
+	flagDiscovery = flag.Bool("discovery", false, "list the public elections at /elections in mock mode")
+	flagTestMode  = flag.Bool("test-mode", false, "let /phase move elections to a later phase regardless of the time, in mock mode; never use for real elections")
+
+	flagMaxChoices  = flag.Int("max-choices", 0, "maximum number of choices of the elections created, summed over their contests; 0 for no limit")
+	flagMaxVoters   = flag.Int("max-voters", 0, "maximum number of eligible voters of the elections created; 0 for no limit")
+	flagMaxSchedule = flag.Duration("max-schedule", 0, "maximum time from the creation of an election to the end of its vote; 0 for no limit")
+	flagMaxVdf      = flag.Uint64("max-vdf-difficulty", 0, "maximum VDF difficulty of the elections created; 0 for no limit")
+
+	flagData = flag.String("data", "", "directory where the messages of each election are appended to a file in mock mode, instead of kept in memory")
+
+	flagHybrid = flag.Bool("hybrid", false, "deal trustees hybrid post-quantum keys, wrapping the key of each trustee ciphertext with ML-KEM and X25519")
+)
+
+// Returns the election options for the configured time source, if any.
+func timeSourceOptions() []voting.ElectionOption {
+	var ts *timesource.Synced
+	if *flagNtp != "" {
+		ts = timesource.NewNTP(*flagNtp)
+	} else if *flagTezosRpc != "" {
+		ts = timesource.NewTezosHead(*flagTezosRpc)
+	} else {
+		return nil
+	}
+	err := ts.Sync(context.Background())
+	if err != nil {
+		fmt.Println("Error syncing time source: ", err)
+	}
+	go ts.Run(context.Background(), 10*time.Minute)
+	return []voting.ElectionOption{voting.WithTimeSource(ts)}
+}
 
 func main() {
 	var passHash []byte
@@ -48,11 +113,213 @@ func main() {
 		fmt.Println(hex.EncodeToString(output[:]))
 	case "mock":
 		endpoint := flag.Arg(1)
-		handler := server.NewMockServer(endpoint, passHash)
+		handler := server.NewMockServer(endpoint, passHash, timeSourceOptions()...)
+		if *flagSmtp != "" {
+			handler.SetMailer(smtpMailer(), *flagLinkBase)
+		}
+		if *flagQuarantine > 0 {
+			handler.SetQuarantine(voting.NewMemoryQuarantine(*flagQuarantine))
+		}
+		if *flagWebhooks != "" {
+			var hooks []server.Webhook
+			for _, u := range strings.Split(*flagWebhooks, ",") {
+				hooks = append(hooks, server.Webhook{URL: u, Secret: []byte(os.Getenv("PEBBLE_WEBHOOK_SECRET"))})
+			}
+			handler.SetWebhooks(hooks, func(err error) {
+				fmt.Println(err)
+			})
+		}
+		handler.SetDiscovery(*flagDiscovery)
+		handler.SetTestMode(*flagTestMode)
+		handler.SetLimits(server.Limits{
+			MaxChoices:       *flagMaxChoices,
+			MaxVoters:        *flagMaxVoters,
+			MaxSchedule:      *flagMaxSchedule,
+			MaxVdfDifficulty: *flagMaxVdf,
+		})
+		if *flagData != "" {
+			handler.SetMessageStores(func(id voting.ElectionID) (voting.MessageStore, error) {
+				return voting.OpenFileStore(filepath.Join(*flagData, base32c.Encode(id[:])+".messages"))
+			})
+		}
 		fmt.Println("Starting mock server...")
 		err = http.ListenAndServe(endpoint, handler)
 		if err != nil {
 			fmt.Println(err)
 		}
+	case "trustees":
+		err = dealTrustees(flag.Arg(1), flag.Arg(2), flag.Arg(3))
+		if err != nil {
+			fmt.Println(err)
+		}
+	case "register":
+		err = serveRegistration(flag.Arg(1))
+		if err != nil {
+			fmt.Println(err)
+		}
+	case "tally":
+		// Flags may follow the mode, as in tally -transcript <file> <election>
+		flag.CommandLine.Parse(flag.Args()[1:])
+		err = tallyTranscript(flag.Arg(0))
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// Returns the mailer for the configured SMTP server.
+func smtpMailer() server.Mailer {
+	m := &server.SMTPMailer{Addr: *flagSmtp, From: *flagSmtpFrom}
+	if *flagSmtpUser != "" {
+		host := *flagSmtp
+		if i := strings.LastIndexByte(host, ':'); i >= 0 {
+			host = host[:i]
+		}
+		m.Auth = smtp.PlainAuth("", *flagSmtpUser, os.Getenv("PEBBLE_SMTP_PASSWORD"), host)
+	}
+	return m
+}
+
+/*
+Serves voter registration on endpoint, authenticating voters with the configured
+OpenID Connect provider. The pending eligibility list is served at /register/pending.
+*/
+func serveRegistration(endpoint string) error {
+	provider, err := registration.Discover(context.Background(), registration.OIDCConfig{
+		Issuer:       *flagOidcIssuer,
+		ClientId:     *flagOidcClient,
+		ClientSecret: *flagOidcSecret,
+		RedirectURL:  *flagOidcRedirect,
+		Scopes:       []string{"email"},
+	})
+	if err != nil {
+		return err
+	}
+	reg := registration.NewRegistrar(provider)
+	reg.RequireVerifiedEmail = *flagOidcEmail
+	fmt.Println("Starting registration server...")
+	return http.ListenAndServe(endpoint, reg)
+}
+
+/*
+Deals a t-of-n trustee setup into dir: keyset.bin, to be base64-encoded into the
+"trustees" field of the election setup, and share-<i>.bin for each trustee.
+With -hybrid, each trustee also gets a hybrid key, kept in its share file.
+*/
+func dealTrustees(threshold, n, dir string) error {
+	t, err1 := strconv.Atoi(threshold)
+	count, err2 := strconv.Atoi(n)
+	if err1 != nil || err2 != nil || dir == "" {
+		return fmt.Errorf("usage: trustees [-hybrid] <threshold> <count> <dir>")
+	}
+	deal := trustee.Deal
+	if *flagHybrid {
+		deal = trustee.DealHybrid
+	}
+	ks, shares, err := deal(t, count)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(dir, "keyset.bin"), ks.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+	for _, s := range shares {
+		err = os.WriteFile(filepath.Join(dir, fmt.Sprintf("share-%d.bin", s.Index)), s.Bytes(), 0600)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decodes an election ID given in hex or, like backend IDs, in base32c.
+func parseElectionId(s string) (id voting.ElectionID, err error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(id) {
+		b, err = base32c.Decode(s)
+	}
+	if err != nil || len(b) != len(id) {
+		return id, fmt.Errorf("invalid election ID %q", s)
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+/*
+Recounts an ended election offline from the transcript given by -transcript, with the params
+given by -params or else those at the start of the transcript, or from the signed archive given
+by -archive. Prints the canonical result, its hash and the certifications found in the messages.
+*/
+func tallyTranscript(election string) error {
+	if (*flagTranscript == "") == (*flagArchive == "") || election == "" {
+		return fmt.Errorf("usage: tally [-transcript <file> [-params <file>] | -archive <file>] <election>")
+	}
+	id, err := parseElectionId(election)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if *flagArchive != "" {
+		f, err := os.Open(*flagArchive)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		a, err := voting.ReadArchive(f, id)
+		if err != nil {
+			return err
+		}
+		replay, err := voting.ReplayArchive(ctx, a)
+		if err == voting.ErrWrongPhase {
+			return fmt.Errorf("election has not ended: %v", err)
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("archive of %d messages created %s, transcript hash %s\n", len(a.Messages), a.Created.UTC().Format(time.RFC3339), hex.EncodeToString(replay.TranscriptHash[:]))
+		printVerification(replay.Verification)
+		return nil
+	}
+	var params *voting.ElectionParams
+	if *flagParams != "" {
+		b, err := os.ReadFile(*flagParams)
+		if err != nil {
+			return err
+		}
+		params = new(voting.ElectionParams)
+		err = params.FromBytes(b)
+		if err != nil {
+			return err
+		}
+	}
+	transcript, err := os.ReadFile(*flagTranscript)
+	if err != nil {
+		return err
+	}
+	bc, err := voting.ReadTranscript(id, transcript, params)
+	if err != nil {
+		return err
+	}
+	e, err := voting.NewElection(ctx, bc, nil)
+	if err != nil {
+		return err
+	}
+	v, err := e.Verify(ctx)
+	if err == voting.ErrWrongPhase {
+		return fmt.Errorf("election has not ended: %v", err)
+	} else if err != nil {
+		return err
+	}
+	printVerification(v)
+	return nil
+}
+
+func printVerification(v voting.Verification) {
+	fmt.Println(string(v.Result.CanonicalJSON()))
+	fmt.Printf("result hash %s\n", hex.EncodeToString(v.TallyHash[:]))
+	cert := v.Certification
+	fmt.Printf("certified: %v (organizer %v, trustees %v)\n", cert.Certified, cert.Organizer, cert.Trustees)
+	if len(cert.Conflicting) != 0 {
+		fmt.Printf("%d certifications of a different result\n", len(cert.Conflicting))
 	}
 }
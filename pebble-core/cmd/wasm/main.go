@@ -0,0 +1,405 @@
+//go:build js && wasm
+// +build js,wasm
+
+/*
+WebAssembly build of pebble-core for the browser UI, so that voter secrets stay client-side
+instead of being handed to a local daemon. Build with
+
+	GOOS=js GOARCH=wasm go build -o pebble.wasm ./cmd/wasm
+
+and load it with the wasm_exec.js support file of the Go distribution. The module
+sets a global pebble object; byte strings are passed as Uint8Arrays. Functions return
+Promises, rejected with an Error on failure, so that slow operations such as VDF puzzles
+and credential proofs do not block the page:
+
+	pebble.setCredentialParams(params)            loads the anoncred1-params.bin file
+	pebble.decodeInvitation(invitation)           -> {network, address, servers, organizer, serverPin}
+	pebble.generateCredential()                   -> {secret, public}
+	pebble.openElection(electionId, messages[, params]) -> election
+	election.phase()                              -> phase name
+	election.encryptBallot(choices)               -> {ballot, vdfSolution}
+	election.signBallot(ballot, secret)           -> message
+	pebble.credentialSigningBytes(electionId, credential) -> bytes signed by the voter key
+	pebble.credentialMessage(credential, publicKey, signature[, proof]) -> message
+	pebble.decryptionMessage(vdfSolution)         -> message
+	pebble.encodeMessages(messages[, framing])    -> body
+	pebble.decodeMessages(body[, framing])        -> [{type, bytes}]
+
+Messages and bodies use the wire formats of the broadcast servers: openElection reads the
+body of GET /messages/{backendId}?framing=3, optionally preceded by the params,
+and signBallot returns a message to POST to /messages/{backendId}.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"syscall/js"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/vdf"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+var errArguments = errors.New("pebble: invalid arguments")
+
+func main() {
+	api := map[string]interface{}{
+		"setCredentialParams":    function(setCredentialParams),
+		"decodeInvitation":       function(decodeInvitation),
+		"generateCredential":     function(generateCredential),
+		"openElection":           function(openElection),
+		"credentialSigningBytes": function(credentialSigningBytes),
+		"credentialMessage":      function(credentialMessage),
+		"decryptionMessage":      function(decryptionMessage),
+		"encodeMessages":         function(encodeMessages),
+		"decodeMessages":         function(decodeMessages),
+	}
+	js.Global().Set("pebble", js.ValueOf(api))
+	// Keep the exported functions alive
+	select {}
+}
+
+// Wraps f as a JavaScript function returning a Promise, running f outside of the event loop.
+// Go cannot throw JavaScript exceptions, so errors reject the Promise.
+func function(f func(args []js.Value) (interface{}, error)) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return js.Global().Get("Promise").New(js.FuncOf(func(this js.Value, cb []js.Value) interface{} {
+			resolve, reject := cb[0], cb[1]
+			go func() {
+				res, err := f(args)
+				if err != nil {
+					reject.Invoke(js.Global().Get("Error").New(err.Error()))
+				} else {
+					resolve.Invoke(res)
+				}
+			}()
+			return nil
+		}))
+	})
+}
+
+func bytesArg(args []js.Value, i int) ([]byte, error) {
+	if i >= len(args) || args[i].Type() != js.TypeObject || args[i].Get("length").Type() != js.TypeNumber {
+		return nil, errArguments
+	}
+	b := make([]byte, args[i].Get("length").Int())
+	js.CopyBytesToGo(b, args[i])
+	return b, nil
+}
+
+// Returns the optional byte string argument i, or nil if it is missing or undefined.
+func optionalBytesArg(args []js.Value, i int) ([]byte, error) {
+	if i >= len(args) || args[i].IsUndefined() || args[i].IsNull() {
+		return nil, nil
+	}
+	return bytesArg(args, i)
+}
+
+func jsBytes(b []byte) js.Value {
+	a := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(a, b)
+	return a
+}
+
+func electionIdArg(args []js.Value, i int) (id voting.ElectionID, err error) {
+	b, err := bytesArg(args, i)
+	if err != nil || len(b) != len(id) {
+		return id, errArguments
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+func setCredentialParams(args []js.Value) (interface{}, error) {
+	params, err := bytesArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	credSys := new(anoncred.AnonCred1)
+	err = credSys.FromBytes(params)
+	if err != nil {
+		return nil, err
+	}
+	anoncred.AnonCred1Instance = credSys
+	return nil, nil
+}
+
+func decodeInvitation(args []js.Value) (interface{}, error) {
+	if len(args) < 1 || args[0].Type() != js.TypeString {
+		return nil, errArguments
+	}
+	inv, err := voting.DecodeInvitation(args[0].String())
+	if err != nil {
+		return nil, err
+	}
+	servers := make([]interface{}, len(inv.Servers))
+	for i, s := range inv.Servers {
+		servers[i] = s
+	}
+	res := map[string]interface{}{
+		"network": inv.Network,
+		"address": string(inv.Address),
+		"servers": servers,
+	}
+	if inv.Organizer != nil {
+		res["organizer"], err = inv.Organizer.String()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if inv.ServerPin != nil {
+		res["serverPin"] = jsBytes(inv.ServerPin)
+	}
+	return res, nil
+}
+
+func generateCredential(args []js.Value) (interface{}, error) {
+	if anoncred.AnonCred1Instance == nil {
+		return nil, errors.New("pebble: credential params not set")
+	}
+	sec, err := anoncred.AnonCred1Instance.GenerateSecretCredential()
+	if err != nil {
+		return nil, err
+	}
+	pub, err := sec.Public()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"secret": jsBytes(sec.Bytes()), "public": jsBytes(pub.Bytes())}, nil
+}
+
+/*
+Opens an election from a transcript of its messages, such as the body of GET /messages
+with framing 3, optionally overriding its params. The election is read-only:
+it encrypts and signs ballots, which the caller posts to the broadcast server.
+*/
+func openElection(args []js.Value) (interface{}, error) {
+	id, err := electionIdArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	transcript, err := bytesArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	var params *voting.ElectionParams
+	if p, err := optionalBytesArg(args, 2); err != nil {
+		return nil, err
+	} else if p != nil {
+		params = new(voting.ElectionParams)
+		if err = params.FromBytes(p); err != nil {
+			return nil, err
+		}
+	}
+	bc, err := voting.ReadTranscript(id, transcript, params)
+	if err != nil {
+		return nil, err
+	}
+	e, err := voting.NewElection(context.Background(), bc, nil)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"phase": function(func(args []js.Value) (interface{}, error) {
+			return e.Phase().String(), nil
+		}),
+		"encryptBallot": function(func(args []js.Value) (interface{}, error) {
+			return encryptBallot(e, args)
+		}),
+		"signBallot": function(func(args []js.Value) (interface{}, error) {
+			return signBallot(e, args)
+		}),
+	}, nil
+}
+
+// Reads choices given as an array of contests, each an array of choice indices.
+func choicesArg(args []js.Value, i int) ([][]int, error) {
+	if i >= len(args) || args[i].Type() != js.TypeObject {
+		return nil, errArguments
+	}
+	contests := make([][]int, args[i].Length())
+	for c := range contests {
+		contest := args[i].Index(c)
+		if contest.Type() != js.TypeObject {
+			return nil, errArguments
+		}
+		contests[c] = make([]int, contest.Length())
+		for j := range contests[c] {
+			contests[c][j] = contest.Index(j).Int()
+		}
+	}
+	return contests, nil
+}
+
+func encryptBallot(e *voting.Election, args []js.Value) (interface{}, error) {
+	choices, err := choicesArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	eb, sol, err := e.EncryptBallot(context.Background(), choices)
+	if err != nil {
+		return nil, err
+	}
+	ballot := map[string]interface{}{"vdfInput": jsBytes(eb.VdfInput), "payload": jsBytes(eb.Payload)}
+	if eb.Trustee != nil {
+		ballot["trustee"] = jsBytes(eb.Trustee)
+	}
+	if eb.Suite != structs.SuiteAESGCM {
+		ballot["suite"] = int(eb.Suite)
+	}
+	return map[string]interface{}{"ballot": ballot, "vdfSolution": jsSolution(sol)}, nil
+}
+
+func signBallot(e *voting.Election, args []js.Value) (interface{}, error) {
+	if len(args) < 2 || args[0].Type() != js.TypeObject {
+		return nil, errArguments
+	}
+	ballot := []js.Value{args[0].Get("vdfInput"), args[0].Get("payload"), args[0].Get("trustee")}
+	var eb structs.EncryptedBallot
+	var err error
+	if eb.VdfInput, err = optionalBytesArg(ballot, 0); err != nil {
+		return nil, err
+	}
+	if eb.Payload, err = bytesArg(ballot, 1); err != nil {
+		return nil, err
+	}
+	if eb.Trustee, err = optionalBytesArg(ballot, 2); err != nil {
+		return nil, err
+	}
+	if suite := args[0].Get("suite"); suite.Type() == js.TypeNumber {
+		eb.Suite = structs.CipherSuite(suite.Int())
+	}
+	secret, err := bytesArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	sec, err := anoncred.AnonCred1Instance.ReadSecretCredential(secret)
+	if err != nil {
+		return nil, err
+	}
+	sb, err := e.SignBallot(context.Background(), eb, sec)
+	if err != nil {
+		return nil, err
+	}
+	return jsBytes(voting.Message{SignedBallot: &sb}.Bytes()), nil
+}
+
+func jsSolution(sol vdf.VdfSolution) map[string]interface{} {
+	return map[string]interface{}{"input": jsBytes(sol.Input), "output": jsBytes(sol.Output), "proof": jsBytes(sol.Proof)}
+}
+
+// Returns the bytes of the credential message that the voter signs with their key.
+func credentialSigningBytes(args []js.Value) (interface{}, error) {
+	id, err := electionIdArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := bytesArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	msg := structs.CredentialMessage{Credential: cred}
+	return jsBytes(msg.SigningBytes(id)), nil
+}
+
+// Assembles a credential message from the credential, the voter's public key and their signature,
+// so that the signing key can stay in the voter's wallet.
+func credentialMessage(args []js.Value) (interface{}, error) {
+	cred, err := bytesArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < 2 || args[1].Type() != js.TypeString {
+		return nil, errArguments
+	}
+	msg := &structs.CredentialMessage{Credential: cred}
+	if msg.PublicKey, err = pubkey.Parse(args[1].String()); err != nil {
+		return nil, err
+	}
+	if msg.Signature, err = bytesArg(args, 2); err != nil {
+		return nil, err
+	}
+	if p, err := optionalBytesArg(args, 3); err != nil {
+		return nil, err
+	} else if p != nil {
+		msg.Proof = new(structs.EligibilityProof)
+		if err = msg.Proof.FromBytes(p); err != nil {
+			return nil, err
+		}
+	}
+	return jsBytes(voting.Message{Credential: msg}.Bytes()), nil
+}
+
+func decryptionMessage(args []js.Value) (interface{}, error) {
+	if len(args) < 1 || args[0].Type() != js.TypeObject {
+		return nil, errArguments
+	}
+	fields := []js.Value{args[0].Get("input"), args[0].Get("output"), args[0].Get("proof")}
+	var sol vdf.VdfSolution
+	var err error
+	if sol.Input, err = bytesArg(fields, 0); err != nil {
+		return nil, err
+	}
+	if sol.Output, err = bytesArg(fields, 1); err != nil {
+		return nil, err
+	}
+	if sol.Proof, err = bytesArg(fields, 2); err != nil {
+		return nil, err
+	}
+	msg := structs.CreateDecryptionMessage(sol)
+	return jsBytes(voting.Message{Decryption: &msg}.Bytes()), nil
+}
+
+// Reads the optional framing argument: 2 for message envelopes, anything else for the original framing.
+func framingArg(args []js.Value, i int) int {
+	if i < len(args) && args[i].Type() == js.TypeNumber {
+		return args[i].Int()
+	}
+	return 0
+}
+
+func encodeMessages(args []js.Value) (interface{}, error) {
+	if len(args) < 1 || args[0].Type() != js.TypeObject {
+		return nil, errArguments
+	}
+	msgs := make([]voting.Message, args[0].Length())
+	for i := range msgs {
+		p, err := bytesArg([]js.Value{args[0].Index(i)}, 0)
+		if err != nil {
+			return nil, err
+		}
+		msgs[i], err = voting.MessageFromBytes(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if framingArg(args, 1) == 2 {
+		return jsBytes(voting.EncodeEnvelopes(msgs)), nil
+	}
+	return jsBytes(voting.EncodeMessages(msgs)), nil
+}
+
+func decodeMessages(args []js.Value) (interface{}, error) {
+	body, err := bytesArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []voting.Message
+	if framingArg(args, 1) == 2 {
+		msgs, err = voting.DecodeEnvelopes(body)
+	} else {
+		msgs, err = voting.DecodeMessages(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := make([]interface{}, len(msgs))
+	for i, m := range msgs {
+		p := m.Bytes()
+		res[i] = map[string]interface{}{"type": int(p[0]), "bytes": jsBytes(p)}
+	}
+	return res, nil
+}
@@ -4,9 +4,13 @@ go 1.16
 
 require (
 	blockwatch.cc/tzgo v1.14.1
+	filippo.io/edwards25519 v1.0.0
 	github.com/consensys/gnark v0.5.2
 	github.com/consensys/gnark-crypto v0.5.3
-	github.com/decred/dcrd/dcrec/secp256k1 v1.0.3 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1 v1.0.3
 	github.com/fatih/color v1.13.0 // indirect
-	golang.org/x/term v0.1.0 // indirect
+	github.com/zeebo/blake3 v0.2.3
+	golang.org/x/crypto v0.0.0-20220722155217-630584e8d5aa
+	golang.org/x/term v0.1.0
+	gopkg.in/yaml.v3 v3.0.1
 )
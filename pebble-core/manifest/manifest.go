@@ -0,0 +1,258 @@
+/*
+Package manifest reads election manifests, YAML or JSON files describing an election
+to create: its title, choices, schedule, voting method, eligible voters and the server
+hosting it. For example:
+
+	title: Board election
+	method: Plurality
+	choices: [Alice, Bob, Carol]
+	schedule:
+	  registrationEnd: 2026-11-02T09:00:00Z
+	  voteStart: 2026-11-02T09:00:00Z
+	  voteEnd: 2026-11-09T09:00:00Z
+	eligibility:
+	  file: voters.csv
+	backend:
+	  server: https://pebble.example.org
+	translations:
+	  - language: fr
+	    title: Élection du conseil
+
+Files named in a manifest are relative to the directory of the manifest.
+*/
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/base32c"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/server"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+var (
+	ErrNoVoters      = errors.New("pebble: manifest lists no eligible voters")
+	ErrVoterKey      = errors.New("pebble: eligibility file entries need public keys")
+	ErrNoServer      = errors.New("pebble: manifest names no server")
+	ErrUnknownFormat = errors.New("pebble: unknown eligibility file format")
+)
+
+type Manifest struct {
+	Title       string    `yaml:"title" json:"title"`
+	Description string    `yaml:"description" json:"description"`
+	Method      string    `yaml:"method" json:"method"`
+	Choices     []string  `yaml:"choices" json:"choices"`
+	Contests    []Contest `yaml:"contests" json:"contests"`
+	Schedule    Schedule  `yaml:"schedule" json:"schedule"`
+	Eligibility Eligible  `yaml:"eligibility" json:"eligibility"`
+	Backend     Backend   `yaml:"backend" json:"backend"`
+	Options     Options   `yaml:"options" json:"options"`
+	// Texts of the election in other languages.
+	Translations []Translation `yaml:"translations" json:"translations"`
+	dir          string
+}
+
+// A contest of an election with several contests, replacing the method and choices of the manifest.
+type Contest struct {
+	Title   string   `yaml:"title" json:"title"`
+	Method  string   `yaml:"method" json:"method"`
+	Choices []string `yaml:"choices" json:"choices"`
+}
+
+/*
+The title, description, choices and contests of the election in the language of a BCP 47 tag,
+in the order of the manifest. Texts left out are shown in the language of the manifest.
+*/
+type Translation struct {
+	Language    string               `yaml:"language" json:"language"`
+	Title       string               `yaml:"title" json:"title"`
+	Description string               `yaml:"description" json:"description"`
+	Choices     []string             `yaml:"choices" json:"choices"`
+	Contests    []ContestTranslation `yaml:"contests" json:"contests"`
+}
+
+type ContestTranslation struct {
+	Title   string   `yaml:"title" json:"title"`
+	Choices []string `yaml:"choices" json:"choices"`
+}
+
+// The phase boundaries of the election, as RFC 3339 times. Registration is optional.
+type Schedule struct {
+	RegistrationStart string `yaml:"registrationStart" json:"registrationStart"`
+	RegistrationEnd   string `yaml:"registrationEnd" json:"registrationEnd"`
+	VoteStart         string `yaml:"voteStart" json:"voteStart"`
+	VoteEnd           string `yaml:"voteEnd" json:"voteEnd"`
+}
+
+/*
+The eligible voters, listed in the manifest, read from a CSV or JSON file in the formats
+of structs.ReadEligibilityCSV and structs.ReadEligibilityJSON, or both.
+Entries of the file must hold public keys. With merkle, the params only carry the
+Merkle root of the eligibility list.
+*/
+type Eligible struct {
+	Voters []server.ElectionSetupVoter `yaml:"voters" json:"voters"`
+	File   string                      `yaml:"file" json:"file"`
+	Merkle bool                        `yaml:"merkle" json:"merkle"`
+}
+
+// The server creating the election. The admin ID is generated if not set.
+type Backend struct {
+	Server  string `yaml:"server" json:"server"`
+	AdminId string `yaml:"adminId" json:"adminId"`
+	// List the election publicly on servers with discovery enabled.
+	Public bool `yaml:"public" json:"public"`
+	// Only let holders of the invitation read the election.
+	Private bool `yaml:"private" json:"private"`
+}
+
+type Options struct {
+	// File holding the serialized trustee.KeySet, as dealt by the server trustees mode.
+	Trustees      string `yaml:"trustees" json:"trustees"`
+	HashAlgorithm string `yaml:"hashAlgorithm" json:"hashAlgorithm"`
+	PowDifficulty uint8  `yaml:"powDifficulty" json:"powDifficulty"`
+	// URL and hex SHA-256 hash of the credential system parameters downloaded by the voters.
+	CredentialParams     string `yaml:"credentialParams" json:"credentialParams"`
+	CredentialParamsHash string `yaml:"credentialParamsHash" json:"credentialParamsHash"`
+	// Show the choices to each voter in a different order.
+	RandomizeChoices bool `yaml:"randomizeChoices" json:"randomizeChoices"`
+}
+
+// Reads the manifest at path. Unknown fields are rejected, so that misspelled options are not ignored.
+func Read(path string) (*Manifest, error) {
+	p, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// JSON documents are YAML documents
+	dec := yaml.NewDecoder(bytes.NewReader(p))
+	dec.KnownFields(true)
+	m := new(Manifest)
+	err = dec.Decode(m)
+	if err != nil {
+		return nil, err
+	}
+	m.dir = filepath.Dir(path)
+	return m, nil
+}
+
+// Returns the path of a file named in the manifest.
+func (m *Manifest) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(m.dir, name)
+}
+
+// Reads the voters of the eligibility file, if any, after those listed in the manifest.
+func (m *Manifest) voters() ([]server.ElectionSetupVoter, error) {
+	voters := append([]server.ElectionSetupVoter(nil), m.Eligibility.Voters...)
+	if m.Eligibility.File == "" {
+		return voters, nil
+	}
+	f, err := os.Open(m.path(m.Eligibility.File))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []structs.EligibilityEntry
+	switch strings.ToLower(filepath.Ext(m.Eligibility.File)) {
+	case ".csv":
+		entries, err = structs.ReadEligibilityEntriesCSV(f)
+	case ".json":
+		err = json.NewDecoder(f).Decode(&entries)
+	default:
+		err = ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Key == "" {
+			return nil, ErrVoterKey
+		}
+		voters = append(voters, server.ElectionSetupVoter{Id: e.Id, Key: e.Key})
+	}
+	return voters, nil
+}
+
+/*
+Returns the setup parameters of the election for the server, and the election params
+they produce, which are checked with ElectionParams.Validate.
+*/
+func (m *Manifest) SetupParams() (server.ElectionSetupParams, *voting.ElectionParams, error) {
+	spar := server.ElectionSetupParams{
+		AdminId:           m.Backend.AdminId,
+		Title:             m.Title,
+		Description:       m.Description,
+		RegStart:          m.Schedule.RegistrationStart,
+		RegEnd:            m.Schedule.RegistrationEnd,
+		VoteStart:         m.Schedule.VoteStart,
+		VoteEnd:           m.Schedule.VoteEnd,
+		Method:            m.Method,
+		Choices:           m.Choices,
+		MerkleEligibility: m.Eligibility.Merkle,
+		HashAlgorithm:     m.Options.HashAlgorithm,
+		PowDifficulty:     m.Options.PowDifficulty,
+		RandomizeChoices:  m.Options.RandomizeChoices,
+		Public:            m.Backend.Public,
+		Private:           m.Backend.Private,
+
+		CredentialParamsURL:  m.Options.CredentialParams,
+		CredentialParamsHash: m.Options.CredentialParamsHash,
+	}
+	for _, c := range m.Contests {
+		spar.Contests = append(spar.Contests, server.ElectionSetupContest{Title: c.Title, Method: c.Method, Choices: c.Choices})
+	}
+	for _, t := range m.Translations {
+		st := server.ElectionSetupTranslation{Language: t.Language, Title: t.Title, Description: t.Description, Choices: t.Choices}
+		for _, c := range t.Contests {
+			st.Contests = append(st.Contests, server.ElectionSetupContestTranslation{Title: c.Title, Choices: c.Choices})
+		}
+		spar.Translations = append(spar.Translations, st)
+	}
+	var err error
+	spar.Voters, err = m.voters()
+	if err != nil {
+		return spar, nil, err
+	}
+	if len(spar.Voters) == 0 {
+		return spar, nil, ErrNoVoters
+	}
+	// The server skips invalid keys
+	for _, v := range spar.Voters {
+		if _, err = pubkey.Parse(v.Key); err != nil {
+			return spar, nil, fmt.Errorf("pebble: voter %q: %w", v.Id, err)
+		}
+	}
+	if m.Options.Trustees != "" {
+		spar.Trustees, err = os.ReadFile(m.path(m.Options.Trustees))
+		if err != nil {
+			return spar, nil, err
+		}
+	}
+	if spar.AdminId == "" {
+		id, err := util.RandomId()
+		if err != nil {
+			return spar, nil, err
+		}
+		spar.AdminId = base32c.Encode(id[:20])
+	}
+	// Validates the params
+	params, err := spar.Params()
+	if err != nil {
+		return spar, nil, err
+	}
+	return spar, params, nil
+}
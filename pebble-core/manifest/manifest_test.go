@@ -0,0 +1,99 @@
+package manifest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/server"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func publicKey(t *testing.T) string {
+	k, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := k.Public().String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "voters.csv", "key,id\n"+publicKey(t)+",alice\n"+publicKey(t)+",bob\n")
+	path := writeFile(t, dir, "election.yaml", `
+title: Board election
+method: Plurality
+choices: [Alice, Bob]
+schedule:
+  registrationEnd: 2026-11-02T09:00:00Z
+  voteStart: 2026-11-02T09:00:00Z
+  voteEnd: 2026-11-09T09:00:00Z
+eligibility:
+  voters:
+    - id: carol
+      key: `+publicKey(t)+`
+  file: voters.csv
+backend:
+  server: https://pebble.example.org
+`)
+	m, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spar, params, err := m.SetupParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spar.Voters) != 3 || spar.Voters[0].Id != "carol" || spar.Voters[2].Id != "bob" || spar.AdminId == "" {
+		t.Errorf("setup params %+v", spar)
+	}
+	if params.Title != "Board election" || params.EligibilityList.Len() != 3 || params.RegistrationEnd != params.CastStart {
+		t.Errorf("params %+v", params)
+	}
+
+	// Misspelled fields are rejected
+	path = writeFile(t, dir, "misspelled.yaml", "title: T\nchoice: [A, B]\n")
+	if _, err = Read(path); err == nil {
+		t.Error("read manifest with unknown field")
+	}
+	// The schedule is validated
+	path = writeFile(t, dir, "schedule.json", `{"method": "Plurality", "choices": ["A", "B"],
+		"schedule": {"voteStart": "2026-11-09T09:00:00Z", "voteEnd": "2026-11-02T09:00:00Z"},
+		"eligibility": {"file": "voters.csv"}}`)
+	if m, err = Read(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = m.SetupParams(); err == nil {
+		t.Error("accepted election ending before it starts")
+	}
+	// Private elections cannot be listed publicly
+	path = writeFile(t, dir, "listed.yaml", "method: Plurality\nchoices: [A, B]\neligibility:\n  file: voters.csv\nbackend:\n  public: true\n  private: true\n")
+	if m, err = Read(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = m.SetupParams(); err != server.ErrPublicPrivate {
+		t.Errorf("public private election: %v", err)
+	}
+	// Eligibility files must hold keys
+	writeFile(t, dir, "hashes.csv", "keyHash\n00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff\n")
+	path = writeFile(t, dir, "hashes.yaml", "method: Plurality\nchoices: [A, B]\neligibility:\n  file: hashes.csv\n")
+	if m, err = Read(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = m.SetupParams(); !errors.Is(err, ErrVoterKey) {
+		t.Errorf("eligibility file without keys: %v", err)
+	}
+}
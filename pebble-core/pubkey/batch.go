@@ -0,0 +1,157 @@
+package pubkey
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"runtime"
+	"sync"
+
+	"filippo.io/edwards25519"
+)
+
+// Ed25519 signatures are verified in batches of at most this size.
+const ed25519BatchSize = 256
+
+// A parsed Ed25519 signature: R + [k]A = [s]B where k is the challenge hash.
+type ed25519Entry struct {
+	a, r *edwards25519.Point
+	s, k *edwards25519.Scalar
+}
+
+func parseEd25519(key PublicKey, msg, sig []byte) (e ed25519Entry, ok bool) {
+	if len(key) != 33 || len(sig) != 64 {
+		return e, false
+	}
+	var err error
+	if e.a, err = new(edwards25519.Point).SetBytes(key[1:]); err != nil {
+		return e, false
+	}
+	if e.r, err = new(edwards25519.Point).SetBytes(sig[:32]); err != nil {
+		return e, false
+	}
+	if e.s, err = new(edwards25519.Scalar).SetCanonicalBytes(sig[32:]); err != nil {
+		return e, false
+	}
+	h := sha512.New()
+	h.Write(sig[:32])
+	h.Write(key[1:])
+	h.Write(msg)
+	e.k, _ = new(edwards25519.Scalar).SetUniformBytes(h.Sum(nil))
+	return e, true
+}
+
+/*
+Checks the signatures of entries idx at once with the cofactored batch equation
+[8](Σ z_i R_i + Σ z_i k_i A_i - (Σ z_i s_i) B) = 0 for random 128-bit z_i.
+*/
+func ed25519BatchEquation(entries []ed25519Entry, idx []int) (bool, error) {
+	rnd := make([]byte, 16*len(idx))
+	if _, err := rand.Read(rnd); err != nil {
+		return false, err
+	}
+	scalars := make([]*edwards25519.Scalar, 0, 2*len(idx)+1)
+	points := make([]*edwards25519.Point, 0, 2*len(idx)+1)
+	sum := edwards25519.NewScalar()
+	var wide [64]byte
+	for j, i := range idx {
+		e := entries[i]
+		copy(wide[:16], rnd[16*j:])
+		z, _ := new(edwards25519.Scalar).SetUniformBytes(wide[:])
+		sum.MultiplyAdd(z, e.s, sum)
+		scalars = append(scalars, z, new(edwards25519.Scalar).Multiply(z, e.k))
+		points = append(points, e.r, e.a)
+	}
+	scalars = append(scalars, sum.Negate(sum))
+	points = append(points, edwards25519.NewGeneratorPoint())
+	p := new(edwards25519.Point).VarTimeMultiScalarMult(scalars, points)
+	p.MultByCofactor(p)
+	return p.Equal(edwards25519.NewIdentityPoint()) == 1, nil
+}
+
+// Marks the valid signatures among entries idx, splitting failed batches in halves to find the invalid ones.
+func verifyEd25519Batch(keys []PublicKey, msgs, sigs [][]byte, entries []ed25519Entry, idx []int, valid []bool) {
+	ok, err := ed25519BatchEquation(entries, idx)
+	if err != nil {
+		for _, i := range idx {
+			valid[i] = keys[i].Verify(msgs[i], sigs[i]) == nil
+		}
+		return
+	}
+	if ok {
+		for _, i := range idx {
+			valid[i] = true
+		}
+		return
+	}
+	if len(idx) == 1 {
+		return
+	}
+	verifyEd25519Batch(keys, msgs, sigs, entries, idx[:len(idx)/2], valid)
+	verifyEd25519Batch(keys, msgs, sigs, entries, idx[len(idx)/2:], valid)
+}
+
+/*
+Verifies many signatures, where keys[i] signed msgs[i] with sigs[i], and reports which are valid.
+Ed25519 signatures are verified in concurrent batches, and BLS12-381 signatures in a single pairing check;
+failed batches are split to find the invalid signatures. Other keys are verified one by one.
+
+Batches use the cofactored verification equation, which also accepts signatures with
+small-order components that Verify rejects. Honest signers never produce these, and each
+signature is judged by the same equation whatever batch it falls in, so results do not
+depend on the other signatures.
+*/
+func VerifyAll(keys []PublicKey, msgs, sigs [][]byte) []bool {
+	valid := make([]bool, len(keys))
+	entries := make([]ed25519Entry, len(keys))
+	var ed, bls []int
+	for i, k := range keys {
+		switch k.Type() {
+		case KeyTypeEd25519:
+			ed = append(ed, i)
+		case KeyTypeBLS12381:
+			bls = append(bls, i)
+		default:
+			valid[i] = k.Verify(msgs[i], sigs[i]) == nil
+		}
+	}
+	// Batches are parsed and verified concurrently, each marking its own signatures
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for start := 0; start < len(ed); start += ed25519BatchSize {
+		end := start + ed25519BatchSize
+		if end > len(ed) {
+			end = len(ed)
+		}
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(idx []int) {
+			defer wg.Done()
+			var parsed []int
+			for _, i := range idx {
+				var ok bool
+				if entries[i], ok = parseEd25519(keys[i], msgs[i], sigs[i]); ok {
+					parsed = append(parsed, i)
+				}
+			}
+			if len(parsed) != 0 {
+				verifyEd25519Batch(keys, msgs, sigs, entries, parsed, valid)
+			}
+			<-workers
+		}(ed[start:end])
+	}
+	wg.Wait()
+	if len(bls) == 0 {
+		return valid
+	}
+	blsKeys := make([]PublicKey, len(bls))
+	blsMsgs := make([][]byte, len(bls))
+	blsSigs := make([][]byte, len(bls))
+	for j, i := range bls {
+		blsKeys[j], blsMsgs[j], blsSigs[j] = keys[i], msgs[i], sigs[i]
+	}
+	batchValid := BatchVerify(blsKeys, blsMsgs, blsSigs) == nil
+	for _, i := range bls {
+		valid[i] = batchValid || keys[i].Verify(msgs[i], sigs[i]) == nil
+	}
+	return valid
+}
@@ -0,0 +1,235 @@
+package pubkey
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fp"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+)
+
+/*
+BLS signatures over BLS12-381, with public keys in G2 (96 bytes compressed)
+and signatures in G1 (48 bytes compressed), so that aggregating thousands of
+signatures only involves cheap G1 additions.
+Messages are augmented with the signer public key before hashing to G1,
+which makes aggregation safe against rogue-key attacks without proofs of possession.
+*/
+
+const (
+	blsPublicKeyLength = bls12381.SizeOfG2AffineCompressed
+	blsSignatureLength = bls12381.SizeOfG1AffineCompressed
+)
+
+// Domain separation tag for hashing messages to G1.
+var blsDst = []byte("PEBBLE-BLS-SIG-BLS12381G1-TAI-AUG")
+
+var ErrBatchLength = errors.New("pebble: mismatched batch lengths")
+
+var (
+	blsG2Gen    bls12381.G2Affine
+	blsG2GenNeg bls12381.G2Affine
+	// Coefficient b of the G1 curve y² = x³ + b.
+	blsG1B fp.Element
+)
+
+func init() {
+	_, _, _, blsG2Gen = bls12381.Generators()
+	blsG2GenNeg.Neg(&blsG2Gen)
+	blsG1B.SetUint64(4)
+}
+
+func generateBLS() (PrivateKey, error) {
+	var sk fr.Element
+	for sk.IsZero() {
+		if _, err := sk.SetRandom(); err != nil {
+			return PrivateKey{}, err
+		}
+	}
+	secret := sk.Bytes()
+	var pk bls12381.G2Affine
+	pk.ScalarMultiplication(&blsG2Gen, new(big.Int).SetBytes(secret[:]))
+	pkBytes := pk.Bytes()
+	return PrivateKey{p: newPublicKey(KeyTypeBLS12381, pkBytes[:]), s: secret[:]}, nil
+}
+
+/*
+Hashes pk || msg to a point of G1 by try-and-increment:
+candidate x coordinates are derived from SHA-512 with an increasing counter
+until x³ + b is a square, then the cofactor is cleared.
+The hash-to-curve maps shipped with gnark-crypto v0.5 are not usable for signatures.
+*/
+func blsHashToG1(pk, msg []byte) bls12381.G1Affine {
+	var p bls12381.G1Affine
+	var ctr [4]byte
+	for i := uint32(0); ; i++ {
+		binary.BigEndian.PutUint32(ctr[:], i)
+		h := sha512.New()
+		h.Write(blsDst)
+		h.Write(ctr[:])
+		h.Write(pk)
+		h.Write(msg)
+		digest := h.Sum(nil)
+		var x, y fp.Element
+		x.SetBytes(digest)
+		y.Square(&x).Mul(&y, &x).Add(&y, &blsG1B)
+		if y.Legendre() != 1 {
+			continue
+		}
+		y.Sqrt(&y)
+		if y.LexicographicallyLargest() != (digest[0]&1 == 1) {
+			y.Neg(&y)
+		}
+		p.X, p.Y = x, y
+		p.ClearCofactor(&p)
+		if !p.IsInfinity() {
+			return p
+		}
+	}
+}
+
+// Decodes a public key, rejecting the point at infinity and points outside the subgroup.
+func blsPublicKey(k []byte) (bls12381.G2Affine, error) {
+	var pk bls12381.G2Affine
+	if len(k) != blsPublicKeyLength {
+		return pk, ErrInvalidKeyLength
+	}
+	if _, err := pk.SetBytes(k); err != nil || pk.IsInfinity() {
+		return pk, ErrInvalidKeyLength
+	}
+	return pk, nil
+}
+
+func blsSignature(sig []byte) (bls12381.G1Affine, error) {
+	var s bls12381.G1Affine
+	if len(sig) != blsSignatureLength {
+		return s, ErrInvalidSignature
+	}
+	if _, err := s.SetBytes(sig); err != nil || s.IsInfinity() {
+		return s, ErrInvalidSignature
+	}
+	return s, nil
+}
+
+func signBLS(pub PublicKey, secret, msg []byte) ([]byte, error) {
+	h := blsHashToG1(pub[1:], msg)
+	var sig bls12381.G1Affine
+	sig.ScalarMultiplication(&h, new(big.Int).SetBytes(secret))
+	b := sig.Bytes()
+	return b[:], nil
+}
+
+// Checks e(sig, g2) == prod e(H(pk_i || msg_i), pk_i) with a single pairing check.
+func blsPairingCheck(pks []bls12381.G2Affine, keys []PublicKey, msgs [][]byte, sig *bls12381.G1Affine) error {
+	P := make([]bls12381.G1Affine, 1, len(pks)+1)
+	Q := make([]bls12381.G2Affine, 1, len(pks)+1)
+	P[0] = *sig
+	Q[0] = blsG2GenNeg
+	for i := range pks {
+		P = append(P, blsHashToG1(keys[i][1:], msgs[i]))
+		Q = append(Q, pks[i])
+	}
+	ok, err := bls12381.PairingCheck(P, Q)
+	if err != nil || !ok {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func verifyBLS(k PublicKey, msg, sig []byte) error {
+	pk, err := blsPublicKey(k[1:])
+	if err != nil {
+		return err
+	}
+	s, err := blsSignature(sig)
+	if err != nil {
+		return err
+	}
+	return blsPairingCheck([]bls12381.G2Affine{pk}, []PublicKey{k}, [][]byte{msg}, &s)
+}
+
+func blsPublicKeys(keys []PublicKey) ([]bls12381.G2Affine, error) {
+	pks := make([]bls12381.G2Affine, len(keys))
+	for i, k := range keys {
+		if k.Type() != KeyTypeBLS12381 {
+			return nil, ErrUnknownKeyType
+		}
+		var err error
+		pks[i], err = blsPublicKey(k[1:])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pks, nil
+}
+
+// Aggregates BLS signatures into a single signature.
+func AggregateSignatures(sigs [][]byte) ([]byte, error) {
+	var acc bls12381.G1Jac
+	for _, sig := range sigs {
+		s, err := blsSignature(sig)
+		if err != nil {
+			return nil, err
+		}
+		acc.AddMixed(&s)
+	}
+	var agg bls12381.G1Affine
+	agg.FromJacobian(&acc)
+	b := agg.Bytes()
+	return b[:], nil
+}
+
+// Verifies an aggregate signature, where keys[i] signed msgs[i].
+// All keys must be BLS12-381 keys.
+func VerifyAggregate(keys []PublicKey, msgs [][]byte, sig []byte) error {
+	if len(keys) != len(msgs) || len(keys) == 0 {
+		return ErrBatchLength
+	}
+	pks, err := blsPublicKeys(keys)
+	if err != nil {
+		return err
+	}
+	s, err := blsSignature(sig)
+	if err != nil {
+		return err
+	}
+	return blsPairingCheck(pks, keys, msgs, &s)
+}
+
+/*
+Verifies independent BLS signatures in one pairing check, where keys[i] signed msgs[i] with sigs[i].
+Each signature is weighted by a random 64-bit scalar so that invalid signatures
+cannot cancel each other out. A failed batch does not tell which signature is invalid;
+callers should fall back to verifying individually.
+*/
+func BatchVerify(keys []PublicKey, msgs [][]byte, sigs [][]byte) error {
+	if len(keys) != len(msgs) || len(keys) != len(sigs) || len(keys) == 0 {
+		return ErrBatchLength
+	}
+	pks, err := blsPublicKeys(keys)
+	if err != nil {
+		return err
+	}
+	var acc bls12381.G1Jac
+	var rnd [8]byte
+	for i, sig := range sigs {
+		s, err := blsSignature(sig)
+		if err != nil {
+			return err
+		}
+		if _, err := rand.Read(rnd[:]); err != nil {
+			return err
+		}
+		r := new(big.Int).SetUint64(binary.LittleEndian.Uint64(rnd[:]) | 1)
+		s.ScalarMultiplication(&s, r)
+		acc.AddMixed(&s)
+		pks[i].ScalarMultiplication(&pks[i], r)
+	}
+	var agg bls12381.G1Affine
+	agg.FromJacobian(&acc)
+	return blsPairingCheck(pks, keys, msgs, &agg)
+}
@@ -0,0 +1,109 @@
+package pubkey
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1"
+	"golang.org/x/crypto/sha3"
+)
+
+// Length of an Ethereum address, the key data of KeyTypeEthereum public keys.
+const ethereumAddressLength = 20
+
+var ErrInvalidAddressChecksum = errors.New("pebble: invalid Ethereum address checksum")
+
+func keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, p := range data {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+// Returns the EIP-191 (version 0x45, personal_sign) hash of a message.
+func ethereumMessageHash(msg []byte) []byte {
+	prefix := "\x19Ethereum Signed Message:\n" + strconv.Itoa(len(msg))
+	return keccak256([]byte(prefix), msg)
+}
+
+// Derives the Ethereum address of a secp256k1 public key.
+func ethereumAddress(pub *secp256k1.PublicKey) []byte {
+	return keccak256(pub.SerializeUncompressed()[1:])[12:]
+}
+
+// Signs a message with personal_sign semantics.
+// The signature is r || s || v, with v = 27 + recovery id.
+func signEthereum(secret, msg []byte) ([]byte, error) {
+	priv, _ := secp256k1.PrivKeyFromBytes(secret)
+	compact, err := secp256k1.SignCompact(priv, ethereumMessageHash(msg), false)
+	if err != nil {
+		return nil, err
+	}
+	// compact is v || r || s
+	sig := make([]byte, 65)
+	copy(sig, compact[1:])
+	sig[64] = compact[0]
+	return sig, nil
+}
+
+// Verifies a personal_sign signature by recovering the signer address.
+// Accepts v as either 0/1 or 27/28.
+func verifyEthereum(address, msg, sig []byte) error {
+	if len(address) != ethereumAddressLength {
+		return ErrInvalidKeyLength
+	}
+	if len(sig) != 65 {
+		return ErrInvalidSignature
+	}
+	v := sig[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 1 {
+		return ErrInvalidSignature
+	}
+	compact := make([]byte, 65)
+	compact[0] = 27 + v
+	copy(compact[1:], sig[:64])
+	pub, _, err := secp256k1.RecoverCompact(compact, ethereumMessageHash(msg))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !bytes.Equal(ethereumAddress(pub), address) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Formats an address with the EIP-55 mixed-case checksum.
+func formatEthereumAddress(address []byte) string {
+	lower := hex.EncodeToString(address)
+	hash := keccak256([]byte(lower))
+	res := []byte(lower)
+	for i, c := range res {
+		if c >= 'a' && hash[i/2]>>(4*uint(1-i%2))&15 >= 8 {
+			res[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(res)
+}
+
+// Parses a 0x-prefixed hex address. Mixed-case addresses must carry a valid EIP-55 checksum.
+func parseEthereumAddress(s string) ([]byte, error) {
+	hexPart := s[2:]
+	address, err := hex.DecodeString(hexPart)
+	if err != nil {
+		return nil, err
+	}
+	if len(address) != ethereumAddressLength {
+		return nil, ErrInvalidKeyLength
+	}
+	if hexPart != strings.ToLower(hexPart) && hexPart != strings.ToUpper(hexPart) && formatEthereumAddress(address) != s {
+		return nil, ErrInvalidAddressChecksum
+	}
+	return address, nil
+}
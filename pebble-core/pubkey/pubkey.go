@@ -1,6 +1,7 @@
 package pubkey
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ed25519"
 	"crypto/rand"
@@ -8,6 +9,7 @@ import (
 	"strings"
 
 	"blockwatch.cc/tzgo/tezos"
+	"github.com/decred/dcrd/dcrec/secp256k1"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/base32c"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
 )
@@ -20,6 +22,8 @@ type PublicKey []byte
 type PrivateKey struct {
 	p PublicKey
 	s []byte
+	// Set for Tezos keys whose secret stays in an external signer.
+	ext *tezosSigner
 }
 
 type KeyType byte
@@ -28,6 +32,12 @@ const (
 	KeyTypeUnknown KeyType = iota
 	KeyTypeEd25519
 	KeyTypeTezos
+	// Ethereum accounts: the key data is the 20-byte address,
+	// signatures are EIP-191 personal_sign signatures.
+	KeyTypeEthereum
+	// BLS12-381 keys: the key data is a compressed G2 point.
+	// Signatures can be aggregated, see AggregateSignatures and BatchVerify.
+	KeyTypeBLS12381
 )
 
 var (
@@ -36,6 +46,8 @@ var (
 	ErrUnknownKeyType = errors.New("pebble: unknown key type")
 
 	ErrInvalidSignature = errors.New("pebble: invalid signature")
+
+	ErrExternalKey = errors.New("pebble: private key held by an external signer")
 )
 
 var noHashSignerOpts crypto.SignerOpts = crypto.Hash(0)
@@ -66,15 +78,55 @@ func (k PrivateKey) Public() PublicKey {
 }
 
 // Returns the secret key data of a PrivateKey instance.
+// Keys held by an external signer have no secret data.
 func (k PrivateKey) Secret() []byte {
 	return k.s
 }
 
+/*
+Serializes the private key for storage by the voter, as the public key followed by the secret key data.
+Keys held by an external signer cannot be serialized.
+*/
+func (k PrivateKey) Bytes() ([]byte, error) {
+	if k.ext != nil || len(k.s) == 0 {
+		return nil, ErrExternalKey
+	}
+	var w util.BufferWriter
+	w.WriteVector(k.p)
+	w.Write(k.s)
+	return w.Buffer, nil
+}
+
+// Reads a private key serialized with PrivateKey.Bytes.
+func PrivateKeyFromBytes(p []byte) (k PrivateKey, err error) {
+	r := util.NewBufferReader(p)
+	k.p, err = r.ReadVector()
+	if err != nil {
+		return k, err
+	}
+	k.s = r.ReadRemaining()
+	switch k.Type() {
+	case KeyTypeEd25519:
+		if len(k.s) != ed25519.SeedSize {
+			return k, ErrInvalidKeyLength
+		}
+	case KeyTypeTezos, KeyTypeEthereum, KeyTypeBLS12381:
+		if len(k.s) == 0 {
+			return k, ErrInvalidKeyLength
+		}
+	default:
+		return k, ErrUnknownKeyType
+	}
+	return k, nil
+}
+
 /*
 It generates a new private key based on the specified key type.
-The function supports key types KeyTypeEd25519 and KeyTypeTezos.
+The function supports key types KeyTypeEd25519, KeyTypeTezos, KeyTypeEthereum and KeyTypeBLS12381.
 For KeyTypeEd25519, it uses the ed25519 package to generate the key pair.
 For KeyTypeTezos, it uses the tezos package.
+For KeyTypeEthereum, it generates a secp256k1 key and derives its address.
+For KeyTypeBLS12381, it draws a random scalar and derives the G2 public key.
 */
 func GenerateKey(keyType KeyType) (k PrivateKey, err error) {
 	switch keyType {
@@ -83,25 +135,37 @@ func GenerateKey(keyType KeyType) (k PrivateKey, err error) {
 		if err != nil {
 			return k, err
 		}
-		return PrivateKey{newPublicKey(keyType, pub), priv.Seed()}, nil
+		return PrivateKey{p: newPublicKey(keyType, pub), s: priv.Seed()}, nil
 	case KeyTypeTezos:
 		priv, err := tezos.GenerateKey(tezos.KeyTypeEd25519)
 		if err != nil {
 			return k, err
 		}
 		pub := priv.Public()
-		return PrivateKey{newPublicKey(keyType, pub.Bytes()), []byte(priv.String())}, nil
+		return PrivateKey{p: newPublicKey(keyType, pub.Bytes()), s: []byte(priv.String())}, nil
+	case KeyTypeEthereum:
+		priv, err := secp256k1.GeneratePrivateKey()
+		if err != nil {
+			return k, err
+		}
+		return PrivateKey{p: newPublicKey(keyType, ethereumAddress(priv.PubKey())), s: priv.Serialize()}, nil
+	case KeyTypeBLS12381:
+		return generateBLS()
 	default:
 		return k, ErrUnknownKeyType
 	}
 }
 
 // Signs a message using the private key.
+// Tezos keys created with NewTezosSigner delegate to their external signer.
 func (k PrivateKey) Sign(msg []byte) ([]byte, error) {
 	switch k.Type() {
 	case KeyTypeEd25519:
 		return ed25519.NewKeyFromSeed(k.s).Sign(rand.Reader, msg, noHashSignerOpts)
 	case KeyTypeTezos:
+		if k.ext != nil {
+			return k.ext.sign(msg)
+		}
 		key, err := tezos.ParsePrivateKey(string(k.s))
 		if err != nil {
 			return nil, err
@@ -112,6 +176,10 @@ func (k PrivateKey) Sign(msg []byte) ([]byte, error) {
 			return nil, err
 		}
 		return sig.Bytes(), nil
+	case KeyTypeEthereum:
+		return signEthereum(k.s, msg)
+	case KeyTypeBLS12381:
+		return signBLS(k.p, k.s, msg)
 	default:
 		return nil, ErrUnknownKeyType
 	}
@@ -138,16 +206,25 @@ func (k PublicKey) Verify(msg, sig []byte) error {
 			return err
 		}
 		var tzsig tezos.Signature
-		err = tzsig.UnmarshalBinary(sig)
+		// Signature.UnmarshalBinary drops the first signature byte in tzgo v1.14
+		err = tzsig.DecodeBuffer(bytes.NewBuffer(sig))
 		if err != nil {
 			return ErrInvalidSignature
 		}
 		hash := util.Hash(msg)
 		err = pk.Verify(hash[:], tzsig)
+		if err != nil {
+			// Signature delegated to an external signer
+			err = pk.Verify(tezosMessageDigest(msg), tzsig)
+		}
 		if err != nil {
 			return ErrInvalidSignature
 		}
 		return nil
+	case KeyTypeEthereum:
+		return verifyEthereum(k[1:], msg, sig)
+	case KeyTypeBLS12381:
+		return verifyBLS(k, msg, sig)
 	default:
 		return ErrUnknownKeyType
 	}
@@ -158,6 +235,8 @@ It converts a PublicKey to its string representation.
 The function supports key types KeyTypeEd25519 and KeyTypeTezos.
 For KeyTypeEd25519, it uses the base32c encoding.
 For KeyTypeTezos, it converts the PublicKey to a tezos.Key type and returns its string representation.
+For KeyTypeEthereum, it returns the EIP-55 checksummed 0x address.
+For KeyTypeBLS12381, it uses the base32c encoding with a "BPK" prefix.
 */
 func (k PublicKey) String() (string, error) {
 	if len(k) == 0 {
@@ -176,6 +255,17 @@ func (k PublicKey) String() (string, error) {
 			return "", err
 		}
 		return pk.String(), nil
+	case KeyTypeEthereum:
+		if len(k) != ethereumAddressLength+1 {
+			return "", ErrInvalidKeyLength
+		}
+		return formatEthereumAddress(k[1:]), nil
+	case KeyTypeBLS12381:
+		p := make([]byte, 2, len(k)+1)
+		p[0] = 235
+		p[1] = 78
+		p = append(p, k[1:]...)
+		return base32c.CheckEncode(p), nil
 	default:
 		return "", ErrUnknownKeyType
 	}
@@ -212,6 +302,7 @@ func (k PublicKey) String() (string, error) {
 // }
 
 // Updated version of Parse that also return the key type as prefix of the public key.
+// Ethereum addresses are parsed from their 0x-prefixed hex form.
 func Parse(s string) (PublicKey, error) {
 	if strings.HasPrefix(s, "EPK") {
 		p, err := base32c.CheckDecode(s)
@@ -223,7 +314,16 @@ func Parse(s string) (PublicKey, error) {
 		}
 		// Create a new public key with type and append the actual key part
 		return newPublicKey(KeyTypeEd25519, p[2:]), nil //<-- here we add the key type
-	} else if strings.HasPrefix(s, "tz") {
+	} else if strings.HasPrefix(s, "BPK") {
+		p, err := base32c.CheckDecode(s)
+		if err != nil {
+			return nil, err
+		}
+		if len(p) != blsPublicKeyLength+2 || p[0] != 235 || p[1] != 78 {
+			return nil, ErrUnknownKeyType
+		}
+		return newPublicKey(KeyTypeBLS12381, p[2:]), nil
+	} else if strings.HasPrefix(s, "tz") || isTezosKey(s) {
 		var key tezos.Key
 		err := key.UnmarshalText([]byte(s))
 		if err != nil {
@@ -235,13 +335,29 @@ func Parse(s string) (PublicKey, error) {
 		}
 		// Create a new public key with type and append the actual key part
 		return newPublicKey(KeyTypeTezos, keyBytes), nil
+	} else if strings.HasPrefix(s, "0x") {
+		address, err := parseEthereumAddress(s)
+		if err != nil {
+			return nil, err
+		}
+		return newPublicKey(KeyTypeEthereum, address), nil
 	}
 	return nil, ErrUnknownKeyType
 }
 
+// Reports whether s has the prefix of a base58 Tezos public key.
+func isTezosKey(s string) bool {
+	for _, prefix := range []string{"edpk", "sppk", "p2pk"} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // Add a new function to validate Ed25519 public keys
 func IsValidPublicKey(key string) (bool, error) {
-	parsedKey, err := ParsePublicKey(key)
+	parsedKey, err := Parse(key)
 	if err != nil {
 		return false, err
 	}
@@ -1,6 +1,8 @@
 package pubkey
 
 import (
+	"bytes"
+	"encoding/hex"
 	"fmt"
 	"testing"
 )
@@ -67,3 +69,168 @@ func TestGenerateKeyAndOperations(t *testing.T) {
 		}
 	}
 }
+
+func TestEthereumPersonalSign(t *testing.T) {
+	// Vector from the web3.js accounts.sign documentation.
+	address := "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"
+	sig, _ := hex.DecodeString("b91467e570a6466aa9e9876cbcd013baba02900b8979d43fe208a4a4f339f5fd6007e74cd82e037b800186422fc2da167c747ef045e5d18a5f5d4300f8e1a0291c")
+	k, err := Parse(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Type() != KeyTypeEthereum {
+		t.Fatal("expected an Ethereum key")
+	}
+	if err = k.Verify([]byte("Some data"), sig); err != nil {
+		t.Fatal(err)
+	}
+	if k.Verify([]byte("Other data"), sig) != ErrInvalidSignature {
+		t.Error("signature should not verify for another message")
+	}
+	if s, _ := k.String(); s != address {
+		t.Errorf("unexpected checksummed address %s", s)
+	}
+	if _, err = Parse("0x2c7536e3605D9C16a7a3D7b1898e529396a65c23"); err != ErrInvalidAddressChecksum {
+		t.Error("expected checksum error")
+	}
+
+	key, err := GenerateKey(KeyTypeEthereum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("Hello, World!")
+	sig, err = key.Sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = key.Public().Verify(msg, sig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBLSAggregation(t *testing.T) {
+	const n = 4
+	keys := make([]PublicKey, n)
+	msgs := make([][]byte, n)
+	sigs := make([][]byte, n)
+	for i := range keys {
+		k, err := GenerateKey(KeyTypeBLS12381)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = k.Public()
+		msgs[i] = []byte(fmt.Sprintf("message %d", i))
+		sigs[i], err = k.Sign(msgs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = keys[i].Verify(msgs[i], sigs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := keys[0].String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(s)
+	if err != nil || string(parsed) != string(keys[0]) {
+		t.Fatalf("BLS key %s does not round trip", s)
+	}
+	agg, err := AggregateSignatures(sigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyAggregate(keys, msgs, agg); err != nil {
+		t.Fatal(err)
+	}
+	if err = BatchVerify(keys, msgs, sigs); err != nil {
+		t.Fatal(err)
+	}
+	sigs[0], sigs[1] = sigs[1], sigs[0]
+	if BatchVerify(keys, msgs, sigs) != ErrInvalidSignature {
+		t.Error("batch with swapped signatures should not verify")
+	}
+	if err = VerifyAggregate(keys[1:], msgs[1:], agg); err != ErrInvalidSignature {
+		t.Errorf("aggregate should not verify with a missing signer: %v", err)
+	}
+}
+
+func TestParseTezosKey(t *testing.T) {
+	k, err := GenerateKey(KeyTypeTezos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := k.Public().String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(parsed) != string(k.Public()) {
+		t.Errorf("Tezos key %s does not round trip", s)
+	}
+}
+
+func TestVerifyAll(t *testing.T) {
+	var keys []PublicKey
+	var msgs, sigs [][]byte
+	add := func(keyType KeyType, n int) {
+		for i := 0; i < n; i++ {
+			k, err := GenerateKey(keyType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := []byte(fmt.Sprintf("message %d", len(msgs)))
+			sig, err := k.Sign(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys, msgs, sigs = append(keys, k.Public()), append(msgs, msg), append(sigs, sig)
+		}
+	}
+	add(KeyTypeEd25519, ed25519BatchSize+44)
+	add(KeyTypeBLS12381, 2)
+	add(KeyTypeEthereum, 1)
+	invalid := map[int]bool{3: true, ed25519BatchSize + 1: true, len(keys) - 2: true}
+	for i := range invalid {
+		msgs[i] = []byte("forged")
+	}
+	// A signature with a non-canonical s is rejected
+	sigs[5] = append(append([]byte(nil), sigs[5][:32]...), bytes.Repeat([]byte{0xFF}, 32)...)
+	invalid[5] = true
+	for i, ok := range VerifyAll(keys, msgs, sigs) {
+		if ok == invalid[i] {
+			t.Errorf("signature %d: valid = %v", i, ok)
+		}
+	}
+}
+
+func TestPrivateKeyBytes(t *testing.T) {
+	for _, keyType := range []KeyType{KeyTypeEd25519, KeyTypeTezos, KeyTypeEthereum, KeyTypeBLS12381} {
+		k, err := GenerateKey(keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := k.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		read, err := PrivateKeyFromBytes(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := []byte("Hello, World!")
+		sig, err := read.Sign(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = k.Public().Verify(msg, sig); err != nil {
+			t.Errorf("key type %d does not round trip: %v", keyType, err)
+		}
+	}
+	if _, err := PrivateKeyFromBytes([]byte{1, byte(KeyTypeEd25519), 2}); err != ErrInvalidKeyLength {
+		t.Errorf("truncated key read: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package pubkey
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+
+	"blockwatch.cc/tzgo/tezos"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+/*
+The subset of the tzgo signer.Signer interface used to delegate Tezos signatures
+to an external signer, such as a Ledger device or a remote signer.
+Any tzgo signer implementation satisfies it.
+*/
+type TezosSigner interface {
+	GetKey(context.Context, tezos.Address) (tezos.Key, error)
+	SignMessage(context.Context, tezos.Address, string) (tezos.Signature, error)
+}
+
+/*
+Devices refuse to blind-sign raw hashes, so external signers sign the hex-encoded
+message hash as the arbitrary text of a failing_noop operation instead,
+which the Ledger Tezos app can display to the user.
+*/
+type tezosSigner struct {
+	signer  TezosSigner
+	address tezos.Address
+}
+
+const (
+	tezosOperationWatermark byte = 3
+	tezosFailingNoopTag     byte = 17
+)
+
+// Returns a Tezos PrivateKey whose signatures are delegated to s for the given address.
+// The returned key has no secret data.
+func NewTezosSigner(ctx context.Context, s TezosSigner, address tezos.Address) (PrivateKey, error) {
+	key, err := s.GetKey(ctx, address)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	return PrivateKey{p: newPublicKey(KeyTypeTezos, key.Bytes()), ext: &tezosSigner{s, address}}, nil
+}
+
+// Returns the text signed by external signers for a message.
+func tezosMessageText(msg []byte) string {
+	hash := util.Hash(msg)
+	return hex.EncodeToString(hash[:])
+}
+
+// Returns the digest signed by external signers for a message.
+func tezosMessageDigest(msg []byte) []byte {
+	return tezosFailingNoopDigest(tezosMessageText(msg))
+}
+
+// Returns the digest of the watermarked failing_noop operation with a zero branch carrying text.
+func tezosFailingNoopDigest(text string) []byte {
+	p := make([]byte, 0, 1+32+1+4+len(text))
+	p = append(p, tezosOperationWatermark)
+	p = append(p, tezos.ZeroBlockHash.Bytes()...)
+	p = append(p, tezosFailingNoopTag)
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(text)))
+	p = append(p, n[:]...)
+	p = append(p, text...)
+	d := tezos.Digest(p)
+	return d[:]
+}
+
+func (t *tezosSigner) sign(msg []byte) ([]byte, error) {
+	sig, err := t.signer.SignMessage(context.Background(), t.address, tezosMessageText(msg))
+	if err != nil {
+		return nil, err
+	}
+	return sig.Bytes(), nil
+}
@@ -0,0 +1,61 @@
+package pubkey
+
+import (
+	"context"
+	"testing"
+
+	"blockwatch.cc/tzgo/tezos"
+)
+
+// Signs failing_noop operations with their watermark, like a Ledger device does.
+type ledgerSigner struct {
+	key tezos.PrivateKey
+}
+
+func (s ledgerSigner) GetKey(_ context.Context, _ tezos.Address) (tezos.Key, error) {
+	return s.key.Public(), nil
+}
+
+func (s ledgerSigner) SignMessage(_ context.Context, _ tezos.Address, msg string) (tezos.Signature, error) {
+	return s.key.Sign(tezosFailingNoopDigest(msg))
+}
+
+func TestTezosSigner(t *testing.T) {
+	key, err := tezos.GenerateKey(tezos.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := NewTezosSigner(context.Background(), ledgerSigner{key}, key.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Secret() != nil {
+		t.Error("delegated key should not expose a secret")
+	}
+	msg := []byte("credential")
+	sig, err := k.Sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = k.Public().Verify(msg, sig); err != nil {
+		t.Fatal(err)
+	}
+	if k.Public().Verify([]byte("other"), sig) != ErrInvalidSignature {
+		t.Error("signature should not verify for another message")
+	}
+}
+
+func TestTezosKey(t *testing.T) {
+	k, err := GenerateKey(KeyTypeTezos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("credential")
+	sig, err := k.Sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = k.Public().Verify(msg, sig); err != nil {
+		t.Fatal(err)
+	}
+}
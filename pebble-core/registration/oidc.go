@@ -0,0 +1,362 @@
+package registration
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidIdToken     = errors.New("pebble: invalid OIDC ID token")
+	ErrUnsupportedAlg     = errors.New("pebble: unsupported OIDC signature algorithm")
+	ErrUnknownSigningKey  = errors.New("pebble: unknown OIDC signing key")
+	ErrIdTokenExpired     = errors.New("pebble: OIDC ID token expired")
+	ErrIdTokenClaims      = errors.New("pebble: OIDC ID token issuer, audience or nonce mismatch")
+	ErrMissingIdToken     = errors.New("pebble: OIDC token response has no ID token")
+	ErrIssuerMismatch     = errors.New("pebble: OIDC discovery issuer mismatch")
+	ErrUnsupportedJWKType = errors.New("pebble: unsupported JWK key type")
+)
+
+// Tolerated clock skew when checking token expiry.
+const clockSkew = time.Minute
+
+// Configures an OpenID Connect relying party using the authorization code flow.
+type OIDCConfig struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectURL  string
+	// Additional scopes requested besides "openid".
+	Scopes []string
+}
+
+// The claims of a verified ID token used for registration.
+type Claims struct {
+	Issuer        string `json:"iss"`
+	Subject       string `json:"sub"`
+	Nonce         string `json:"nonce"`
+	Expiry        int64  `json:"exp"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// Identifies the user across registrations: the issuer and subject, which OIDC guarantees to be stable.
+func (c *Claims) Identity() string {
+	return c.Issuer + "#" + c.Subject
+}
+
+/*
+An OpenID Connect provider discovered from its issuer URL.
+Signing keys are fetched from the provider JWKS endpoint and refreshed
+when a token is signed with an unknown key.
+*/
+type Provider struct {
+	config   OIDCConfig
+	client   http.Client
+	authURL  string
+	tokenURL string
+	jwksURL  string
+
+	mu   sync.Mutex
+	keys map[string]crypto.PublicKey
+	now  func() time.Time
+}
+
+func getJson(ctx context.Context, client *http.Client, uri string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("pebble: OIDC status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Fetches the provider metadata from {issuer}/.well-known/openid-configuration.
+func Discover(ctx context.Context, config OIDCConfig) (*Provider, error) {
+	p := &Provider{config: config, now: time.Now}
+	var meta struct {
+		Issuer   string `json:"issuer"`
+		AuthURL  string `json:"authorization_endpoint"`
+		TokenURL string `json:"token_endpoint"`
+		JwksURL  string `json:"jwks_uri"`
+	}
+	issuer := strings.TrimSuffix(config.Issuer, "/")
+	err := getJson(ctx, &p.client, issuer+"/.well-known/openid-configuration", &meta)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != issuer {
+		return nil, ErrIssuerMismatch
+	}
+	p.config.Issuer = meta.Issuer
+	p.authURL, p.tokenURL, p.jwksURL = meta.AuthURL, meta.TokenURL, meta.JwksURL
+	return p, nil
+}
+
+// Returns the URL to redirect the user to for authentication.
+func (p *Provider) AuthURL(state, nonce string) string {
+	q := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.config.ClientId},
+		"redirect_uri":  {p.config.RedirectURL},
+		"scope":         {strings.Join(append([]string{"openid"}, p.config.Scopes...), " ")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	sep := "?"
+	if strings.Contains(p.authURL, "?") {
+		sep = "&"
+	}
+	return p.authURL + sep + q.Encode()
+}
+
+// Exchanges an authorization code for the raw ID token.
+func (p *Provider) Exchange(ctx context.Context, code string) (string, error) {
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {p.config.RedirectURL},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientId), url.QueryEscape(p.config.ClientSecret))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("pebble: OIDC token status %d", resp.StatusCode)
+	}
+	var tok struct {
+		IdToken string `json:"id_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&tok)
+	if err != nil {
+		return "", err
+	}
+	if tok.IdToken == "" {
+		return "", ErrMissingIdToken
+	}
+	return tok.IdToken, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, ErrUnsupportedJWKType
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, ErrUnsupportedJWKType
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !pub.Curve.IsOnCurve(x, y) {
+			return nil, ErrUnsupportedJWKType
+		}
+		return pub, nil
+	default:
+		return nil, ErrUnsupportedJWKType
+	}
+}
+
+func (p *Provider) refreshKeys(ctx context.Context) error {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := getJson(ctx, &p.client, p.jwksURL, &set)
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		pub, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	p.keys = keys
+	return nil
+}
+
+func (p *Provider) signingKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	err := p.refreshKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	digest := sha256.Sum256(signed)
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrUnsupportedAlg
+		}
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return ErrInvalidIdToken
+		}
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return ErrInvalidIdToken
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrInvalidIdToken
+		}
+	default:
+		return ErrUnsupportedAlg
+	}
+	return nil
+}
+
+/*
+Verifies the signature of an ID token against the provider keys and checks
+its issuer, audience, expiry and nonce. Supports RS256 and ES256 signatures.
+*/
+func (p *Provider) Verify(ctx context.Context, rawIdToken, nonce string) (*Claims, error) {
+	parts := strings.Split(rawIdToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIdToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidIdToken
+	}
+	key, err := p.signingKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	err = verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig)
+	if err != nil {
+		return nil, err
+	}
+	var claims Claims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	var aud struct {
+		Aud audience `json:"aud"`
+	}
+	if err = decodeSegment(parts[1], &aud); err != nil {
+		return nil, err
+	}
+	if claims.Issuer != p.config.Issuer || !aud.Aud.contains(p.config.ClientId) || claims.Nonce != nonce {
+		return nil, ErrIdTokenClaims
+	}
+	if p.now().After(time.Unix(claims.Expiry, 0).Add(clockSkew)) {
+		return nil, ErrIdTokenExpired
+	}
+	return &claims, nil
+}
+
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return ErrInvalidIdToken
+	}
+	if json.Unmarshal(b, v) != nil {
+		return ErrInvalidIdToken
+	}
+	return nil
+}
+
+// The "aud" claim, either a single string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+func (a audience) contains(s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+package registration
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+var (
+	ErrUnknownState       = errors.New("pebble: unknown or expired registration state")
+	ErrAlreadyRegistered  = errors.New("pebble: identity already registered with another key")
+	ErrKeyRegistered      = errors.New("pebble: key already registered")
+	ErrUnverifiedEmail    = errors.New("pebble: OIDC email not verified")
+	ErrRegistrationClosed = errors.New("pebble: registration closed")
+	ErrStateBinding       = errors.New("pebble: registration started in another browser")
+	ErrTooManyPending     = errors.New("pebble: too many registrations in progress")
+)
+
+const (
+	// Time a voter has to complete authentication after starting a registration.
+	stateLifetime = 10 * time.Minute
+	// Registrations started within stateLifetime, bounding the memory of unauthenticated requests.
+	maxPendingStates = 10000
+	// Cookie binding a registration to the browser that started it.
+	bindingCookie = "pebble_registration"
+)
+
+/*
+A registration waiting for the OIDC callback. The callback must present the binding
+returned by Start, so that a provider URL sent to someone else cannot register
+the key of its sender under their identity.
+*/
+type pendingAuth struct {
+	pkh     util.HashValue
+	nonce   string
+	binding string
+	expires time.Time
+}
+
+// A completed registration, returned to the voter.
+type Registration struct {
+	KeyHash      string `json:"keyHash"`
+	IdCommitment string `json:"idCommitment"`
+	// Random salt of the identity commitment, which only the voter learns.
+	Salt string `json:"salt"`
+}
+
+/*
+Computes the identity commitment of an OIDC identity.
+The salt hides the identity from readers of the eligibility list,
+while the voter can open the commitment by revealing it.
+*/
+func IdentityCommitment(identity string, salt []byte) util.HashValue {
+	return util.HashAll([]byte("pebble-identity"), []byte(identity), salt)
+}
+
+/*
+Registers voters authenticated with an OpenID Connect provider.
+Each identity registers a single public key, whose hash is added with the identity
+commitment to a pending eligibility list. The organizer publishes the pending list,
+e.g. with Election.UpdateEligibility, during the Setup or CredGen phase.
+*/
+type Registrar struct {
+	provider *Provider
+	// If set, only identities with a verified email are accepted.
+	RequireVerifiedEmail bool
+
+	mu         sync.Mutex
+	closed     bool
+	states     map[string]pendingAuth
+	order      []string // states by expiry, including completed ones not expired yet
+	maxPending int
+	identities map[string]util.HashValue
+	pending    *structs.EligibilityList
+	now        func() time.Time
+}
+
+func NewRegistrar(provider *Provider) *Registrar {
+	return &Registrar{
+		provider:   provider,
+		states:     make(map[string]pendingAuth),
+		maxPending: maxPendingStates,
+		identities: make(map[string]util.HashValue),
+		pending:    structs.NewEligibilityList(),
+		now:        time.Now,
+	}
+}
+
+// Returns a copy of the pending eligibility list.
+func (r *Registrar) Pending() *structs.EligibilityList {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := new(structs.EligibilityList)
+	list.FromBytes(r.pending.Bytes())
+	return list
+}
+
+// Stops accepting registrations, e.g. once the pending list has been published for the last time.
+func (r *Registrar) Close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+}
+
+func randomToken() (string, error) {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:]), nil
+}
+
+/*
+Starts the registration of key, returning the provider URL to redirect the voter to,
+and the binding to keep in the browser of the voter until the callback.
+*/
+func (r *Registrar) Start(key pubkey.PublicKey) (string, string, error) {
+	state, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	binding, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	pkh := r.pending.HashKey(key)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return "", "", ErrRegistrationClosed
+	}
+	if r.pending.Contains(pkh) {
+		return "", "", ErrKeyRegistered
+	}
+	now := r.now()
+	// States share their lifetime, so the expired ones are at the front
+	for len(r.order) != 0 {
+		p, ok := r.states[r.order[0]]
+		if ok && !now.After(p.expires) {
+			break
+		}
+		delete(r.states, r.order[0])
+		r.order = r.order[1:]
+	}
+	if len(r.order) >= r.maxPending {
+		return "", "", ErrTooManyPending
+	}
+	r.states[state] = pendingAuth{pkh: pkh, nonce: nonce, binding: binding, expires: now.Add(stateLifetime)}
+	r.order = append(r.order, state)
+	return r.provider.AuthURL(state, nonce), binding, nil
+}
+
+// Completes a registration with the state and authorization code of the OIDC callback, and the binding returned by Start.
+func (r *Registrar) Callback(ctx context.Context, state, binding, code string) (*Registration, error) {
+	r.mu.Lock()
+	auth, ok := r.states[state]
+	delete(r.states, state)
+	r.mu.Unlock()
+	if !ok || r.now().After(auth.expires) {
+		return nil, ErrUnknownState
+	}
+	if subtle.ConstantTimeCompare([]byte(binding), []byte(auth.binding)) != 1 {
+		return nil, ErrStateBinding
+	}
+	rawIdToken, err := r.provider.Exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := r.provider.Verify(ctx, rawIdToken, auth.nonce)
+	if err != nil {
+		return nil, err
+	}
+	if r.RequireVerifiedEmail && !claims.EmailVerified {
+		return nil, ErrUnverifiedEmail
+	}
+	salt := make([]byte, 32)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+	identity := claims.Identity()
+	idCom := IdentityCommitment(identity, salt)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, ErrRegistrationClosed
+	}
+	if _, exists := r.identities[identity]; exists {
+		return nil, ErrAlreadyRegistered
+	}
+	if !r.pending.Add(auth.pkh, idCom) {
+		return nil, ErrKeyRegistered
+	}
+	r.identities[identity] = auth.pkh
+	return &Registration{
+		KeyHash:      hex.EncodeToString(auth.pkh[:]),
+		IdCommitment: hex.EncodeToString(idCom[:]),
+		Salt:         hex.EncodeToString(salt),
+	}, nil
+}
+
+// Sends a JSON error envelope with the code of err.
+func respondError(w http.ResponseWriter, statusCode int, err error) {
+	body, _ := json.Marshal(util.ErrorEnvelope{Error: util.APIError{Code: codeOf(err, statusCode), Message: err.Error()}})
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+func codeOf(err error, statusCode int) util.ErrorCode {
+	switch err {
+	case ErrAlreadyRegistered, ErrKeyRegistered:
+		return util.ErrorAlreadyRegistered
+	case ErrRegistrationClosed:
+		return util.ErrorWrongPhase
+	case ErrTooManyPending:
+		return util.ErrorRateLimited
+	default:
+		return util.StatusErrorCode(statusCode)
+	}
+}
+
+func statusOf(err error) int {
+	switch err {
+	case ErrTooManyPending:
+		return http.StatusServiceUnavailable
+	case ErrUnknownState, ErrStateBinding, ErrInvalidIdToken, ErrIdTokenClaims, ErrIdTokenExpired, ErrUnverifiedEmail:
+		return http.StatusUnauthorized
+	case ErrAlreadyRegistered, ErrKeyRegistered, ErrRegistrationClosed:
+		return http.StatusConflict
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// HTTP handler of the registration endpoints.
+func (r *Registrar) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.Path
+	switch {
+	/*
+		/register?key={key} (HTTP GET):
+
+		Description: Start the registration of a public key.
+		Response: Redirect to the OIDC provider, with a cookie binding the registration to the browser.
+	*/
+	case strings.HasSuffix(path, "/register"):
+		key, err := pubkey.Parse(req.URL.Query().Get("key"))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		uri, binding, err := r.Start(key)
+		if err != nil {
+			respondError(w, statusOf(err), err)
+			return
+		}
+		// Lax, as the provider redirects to the callback from another site
+		http.SetCookie(w, &http.Cookie{
+			Name:     bindingCookie,
+			Value:    binding,
+			Path:     path,
+			MaxAge:   int(stateLifetime / time.Second),
+			Secure:   req.TLS != nil,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, req, uri, http.StatusFound)
+	/*
+		/register/callback?state={state}&code={code} (HTTP GET):
+
+		Description: OIDC redirect URI completing a registration, in the browser that started it.
+		Response: JSON Registration with the key hash, identity commitment and salt.
+	*/
+	case strings.HasSuffix(path, "/register/callback"):
+		q := req.URL.Query()
+		if e := q.Get("error"); e != "" {
+			respondError(w, http.StatusUnauthorized, errors.New("pebble: OIDC error: "+e))
+			return
+		}
+		var binding string
+		if c, err := req.Cookie(bindingCookie); err == nil {
+			binding = c.Value
+		}
+		reg, err := r.Callback(req.Context(), q.Get("state"), binding, q.Get("code"))
+		if err != nil {
+			respondError(w, statusOf(err), err)
+			return
+		}
+		content, err := json.Marshal(reg)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.Header().Add("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content)
+	/*
+		/register/pending (HTTP GET):
+
+		Description: Get the pending eligibility list.
+		Response: The serialized EligibilityList.
+	*/
+	case strings.HasSuffix(path, "/register/pending"):
+		content := r.Pending().Bytes()
+		w.Header().Add("Content-Type", "application/octet-stream")
+		w.Header().Add("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content)
+	default:
+		respondError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
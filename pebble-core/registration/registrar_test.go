@@ -0,0 +1,195 @@
+package registration
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+// A minimal OIDC provider issuing RS256 ID tokens for the subject of each authorization code.
+type fakeProvider struct {
+	srv   *httptest.Server
+	key   *rsa.PrivateKey
+	codes map[string]string
+	nonce string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := &fakeProvider{key: key, codes: make(map[string]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 fp.srv.URL,
+			"authorization_endpoint": fp.srv.URL + "/auth",
+			"token_endpoint":         fp.srv.URL + "/token",
+			"jwks_uri":               fp.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		id, _, _ := r.BasicAuth()
+		sub, ok := fp.codes[r.PostForm.Get("code")]
+		if !ok || id != "client" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": fp.sign(t, map[string]interface{}{
+			"iss":   fp.srv.URL,
+			"sub":   sub,
+			"aud":   []string{"client"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": fp.nonce,
+		})})
+	})
+	fp.srv = httptest.NewServer(mux)
+	return fp
+}
+
+func (fp *fakeProvider) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, fp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// Follows the redirect to the provider: records the subject for a new code and returns the callback state.
+func (fp *fakeProvider) authorize(t *testing.T, authURL, sub, code string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp.codes[code] = sub
+	fp.nonce = u.Query().Get("nonce")
+	return u.Query().Get("state")
+}
+
+func TestRegistration(t *testing.T) {
+	fp := newFakeProvider(t)
+	defer fp.srv.Close()
+	provider, err := Discover(context.Background(), OIDCConfig{Issuer: fp.srv.URL, ClientId: "client", ClientSecret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := NewRegistrar(provider)
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+	newBrowser := func() *http.Client {
+		jar, _ := cookiejar.New(nil)
+		return &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+	}
+	client := newBrowser()
+
+	register := func(key pubkey.PublicKey, sub, code string) (*http.Response, error) {
+		keyStr, err := key.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Get(srv.URL + "/register?key=" + url.QueryEscape(keyStr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusFound {
+			return resp, nil
+		}
+		state := fp.authorize(t, resp.Header.Get("Location"), sub, code)
+		return client.Get(srv.URL + "/register/callback?state=" + url.QueryEscape(state) + "&code=" + code)
+	}
+
+	k1, _ := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	resp, err := register(k1.Public(), "alice", "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("registration status %d", resp.StatusCode)
+	}
+	var r Registration
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	salt, _ := hex.DecodeString(r.Salt)
+	idCom := IdentityCommitment(fp.srv.URL+"#alice", salt)
+	pkh := util.Hash(k1.Public())
+	if got, ok := reg.Pending().IdCommitment(pkh); !ok || got != idCom || r.IdCommitment != hex.EncodeToString(idCom[:]) {
+		t.Error("registered key missing from pending list")
+	}
+
+	// The same identity cannot register a second key
+	k2, _ := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if resp, _ = register(k2.Public(), "alice", "c2"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("second key of identity: status %d", resp.StatusCode)
+	}
+	// A registered key cannot start another registration
+	if resp, _ = register(k1.Public(), "bob", "c3"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("registered key: status %d", resp.StatusCode)
+	}
+	// Tokens with another nonce are rejected
+	uri, binding, err := reg.Start(k2.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := fp.authorize(t, uri, "bob", "c4")
+	fp.nonce = "replayed"
+	if _, err = reg.Callback(context.Background(), state, binding, "c4"); err != ErrIdTokenClaims {
+		t.Errorf("wrong nonce: %v", err)
+	}
+	// A provider URL completed in another browser does not register the key of the sender
+	keyStr, _ := k2.Public().String()
+	resp, _ = client.Get(srv.URL + "/register?key=" + url.QueryEscape(keyStr))
+	state = fp.authorize(t, resp.Header.Get("Location"), "carol", "c5")
+	resp, _ = newBrowser().Get(srv.URL + "/register/callback?state=" + url.QueryEscape(state) + "&code=c5")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("callback in another browser: status %d", resp.StatusCode)
+	}
+	// Registrations in progress are bounded
+	reg.maxPending = 1
+	if _, _, err = reg.Start(k2.Public()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = reg.Start(k2.Public()); err != ErrTooManyPending {
+		t.Errorf("registration over the bound: %v", err)
+	}
+	reg.now = func() time.Time { return time.Now().Add(stateLifetime + time.Second) }
+	if _, _, err = reg.Start(k2.Public()); err != nil || len(reg.order) != 1 {
+		t.Errorf("expired registrations kept: %v, %d", err, len(reg.order))
+	}
+	if reg.Pending().Len() != 1 {
+		t.Error("pending list should have one voter")
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+)
+
+/*
+Implemented by election services hosting private elections, which are only readable with
+the access token carried by their invitation (see voting.Invitation). The token is required
+on /params, /messages, /eligibility, /election, /countdown and /result, in the Pebble-Access-Token header.
+*/
+type AccessTokenService interface {
+	// Returns the access token of the election, or nil if the election is not private.
+	AccessToken(backendId string) []byte
+}
+
+// Checks the access token of a request to a private election, responding 403 without it.
+func (s *Server) allowedAccess(w http.ResponseWriter, req *http.Request, backendId string) bool {
+	tokens, ok := s.srv.(AccessTokenService)
+	if !ok {
+		return true
+	}
+	token := tokens.AccessToken(backendId)
+	if token == nil {
+		return true
+	}
+	given, err := hex.DecodeString(req.Header.Get(voting.AccessTokenHeader))
+	if err == nil && subtle.ConstantTimeCompare(given, token) == 1 {
+		return true
+	}
+	respondErrorCode(w, http.StatusForbidden, util.ErrorForbidden, "Access token required")
+	return false
+}
+
+func (s *mockService) AccessToken(backendId string) []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tokens[backendId]
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+)
+
+var errNotEnded = errors.New("pebble: election has not ended")
+
+/*
+Implemented by election services holding the organizer keys of their elections,
+which sign archives of them (see voting.ArchiveWriter) before they are retired.
+*/
+type ArchiveService interface {
+	// Writes the archive of the election set up with adminId.
+	Archive(ctx context.Context, adminId string, w io.Writer) error
+	// Stops hosting the election set up with adminId, which must have ended.
+	Retire(adminId string) error
+}
+
+func (s *mockService) Archive(ctx context.Context, adminId string, w io.Writer) error {
+	s.mu.RLock()
+	backendId, ok := s.ids[adminId]
+	election, organizer := s.elections[backendId], s.organizers[backendId]
+	s.mu.RUnlock()
+	if !ok {
+		return errNotFound
+	}
+	return election.WriteArchive(ctx, w, organizer)
+}
+
+func (s *mockService) Retire(adminId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	backendId, ok := s.ids[adminId]
+	if !ok {
+		return errNotFound
+	}
+	if s.elections[backendId].Phase() != voting.End {
+		return errNotEnded
+	}
+	delete(s.ids, adminId)
+	delete(s.elections, backendId)
+	delete(s.organizers, backendId)
+	delete(s.tokens, backendId)
+	delete(s.clocks, backendId)
+	for _, inv := range s.inviteList[adminId] {
+		delete(s.invites, inv.token)
+	}
+	delete(s.inviteList, adminId)
+	delete(s.public, adminId)
+	return nil
+}
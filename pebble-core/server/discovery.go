@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+// Implemented by election services hosting public elections, for /elections.
+type PublicElectionLister interface {
+	// Returns the setup of the public elections whose setup is done.
+	PublicElections() []SetupInfo
+}
+
+// A public election, as listed by /elections.
+type PublicElection struct {
+	BackendId   string `json:"backendId"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Phase       string `json:"phase"`
+	Invitation  string `json:"invitation"`
+}
+
+// Sets whether the server lists the public elections it hosts at /elections.
+func (s *Server) SetDiscovery(enabled bool) {
+	s.discovery = enabled
+}
+
+// Answers /elections with the public elections of the service.
+func (s *Server) serveDiscovery(w http.ResponseWriter) {
+	lister, ok := s.srv.(PublicElectionLister)
+	if !s.discovery || !ok {
+		respondErrorCode(w, 404, util.ErrorNotFound, "Server does not list elections")
+		return
+	}
+	elections := []PublicElection{}
+	for _, info := range lister.PublicElections() {
+		e, err := s.srv.Election(info.BackendId)
+		if err != nil {
+			continue
+		}
+		params := e.Params()
+		elections = append(elections, PublicElection{
+			BackendId:   info.BackendId,
+			Title:       params.Title,
+			Description: params.Description,
+			Phase:       e.Phase().String(),
+			Invitation:  info.Invitation,
+		})
+	}
+	respondJson(w, elections)
+}
+
+func (s *mockService) PublicElections() []SetupInfo {
+	s.mu.RLock()
+	var ids []string
+	for adminId := range s.public {
+		ids = append(ids, adminId)
+	}
+	s.mu.RUnlock()
+	sort.Strings(ids)
+	var infos []SetupInfo
+	for _, adminId := range ids {
+		if info := s.Setup(adminId); info.Status == SetupDone {
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
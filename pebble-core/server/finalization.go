@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+)
+
+/*
+Implemented by election services holding the organizer keys of their elections, which
+finalize ended elections by posting the organizer certification of their result
+(see voting.Election.Certify) the first time the result is read from /election.
+*/
+type ResultCertifier interface {
+	// Posts the organizer certification of the result of the ended election.
+	CertifyResult(ctx context.Context, backendId string) error
+}
+
+func (s *mockService) CertifyResult(ctx context.Context, backendId string) error {
+	s.mu.RLock()
+	election, organizer := s.elections[backendId], s.organizers[backendId]
+	s.mu.RUnlock()
+	if election == nil {
+		return errNotFound
+	}
+	err := election.Certify(ctx, organizer)
+	if err == voting.ErrDuplicateMessage || err == voting.ErrAmendmentUnsigned {
+		// Concurrent requests certified the same result, or the params predate certifications
+		err = nil
+	}
+	return err
+}
+
+// Has the service certify the result of the ended election if the organizer did not, and returns the updated status.
+func (s *Server) finalize(ctx context.Context, backendId string, election *voting.Election, prog voting.ElectionProgress, cert voting.CertificationStatus) (voting.CertificationStatus, error) {
+	certifier, ok := s.srv.(ResultCertifier)
+	if cert.Organizer || !ok {
+		return cert, nil
+	}
+	if err := certifier.CertifyResult(ctx, backendId); err != nil {
+		return cert, err
+	}
+	return election.Certification(ctx, prog)
+}
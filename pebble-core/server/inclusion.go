@@ -0,0 +1,26 @@
+package server
+
+import (
+	"context"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+)
+
+/*
+Implemented by election services holding the organizer keys of their elections, which prove
+that messages are on the board against a checkpoint of the log they sign (see /inclusion).
+*/
+type InclusionService interface {
+	// Returns the proof that the message is in the current log of the election, or voting.ErrMessageNotFound.
+	InclusionProof(ctx context.Context, backendId string, id voting.MessageID) (*voting.InclusionProof, error)
+}
+
+func (s *mockService) InclusionProof(ctx context.Context, backendId string, id voting.MessageID) (*voting.InclusionProof, error) {
+	s.mu.RLock()
+	election, organizer := s.elections[backendId], s.organizers[backendId]
+	s.mu.RUnlock()
+	if election == nil {
+		return nil, errNotFound
+	}
+	return election.ProveInclusion(ctx, id, organizer)
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+)
+
+var (
+	errInvalidToken   = errors.New("pebble: invalid or already used registration link")
+	errMerkleInvite   = errors.New("pebble: email invitations need a full eligibility list")
+	errNoMailer       = errors.New("pebble: server has no mailer")
+	errInvalidAddress = errors.New("pebble: invalid email address")
+)
+
+// A single-use registration link issued to an email address.
+type EmailInvite struct {
+	Email string
+	Token string
+}
+
+// The state of an invitation, without its token.
+type InviteStatus struct {
+	Email    string `json:"email"`
+	Redeemed bool   `json:"redeemed"`
+	KeyHash  string `json:"keyHash,omitempty"`
+}
+
+/*
+Implemented by election services issuing eligibility by email.
+The organizer invites email addresses, each of which receives a single-use token;
+redeeming a token binds the voter key into the eligibility list of the election,
+with the hash of the email address, under the hash scheme of the election, as identity commitment.
+*/
+type InvitationService interface {
+	// Issues tokens for the emails not invited yet.
+	Invite(adminId string, emails []string) ([]EmailInvite, error)
+	Invitations(adminId string) ([]InviteStatus, error)
+	// Binds key into the eligibility list and returns the backend ID of the election.
+	Redeem(ctx context.Context, token string, key pubkey.PublicKey) (string, error)
+}
+
+// Sends registration links to voters.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// Sends mail through an SMTP server.
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return errInvalidAddress
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", m.From, to, subject, body)
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{to}, []byte(msg))
+}
+
+// Checks that s looks like a single email address.
+func validEmail(s string) bool {
+	at := strings.LastIndexByte(s, '@')
+	return at > 0 && at < len(s)-1 && !strings.ContainsAny(s, " \t\r\n<>,;")
+}
+
+/*
+Sets the mailer sending registration links, which point to linkBase followed by the token.
+The page at linkBase generates the voter key and redeems the token at /redeem/{token}.
+*/
+func (s *Server) SetMailer(m Mailer, linkBase string) {
+	s.mailer = m
+	s.linkBase = linkBase
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+/*
+Operational limits on the elections a server creates, so that a hosted server cannot be asked
+to commit to elections it cannot serve. Zero fields are not limited.
+*/
+type Limits struct {
+	// Choices of an election, summed over its contests.
+	MaxChoices int
+	// Voters of the eligibility list at creation.
+	MaxVoters int
+	// Time from the creation of an election to the end of its vote.
+	MaxSchedule time.Duration
+	// Maximum VDF difficulty of the ballots.
+	MaxVdfDifficulty uint64
+}
+
+// Sets the limits on the elections created from then on by /create and /clone.
+func (s *Server) SetLimits(l Limits) {
+	s.limits = l
+}
+
+// Returns the error of an election exceeding a limit, with code util.ErrorLimitExceeded and the message format of the value and maximum.
+func limitError(limit string, max, value uint64, format string) *util.APIError {
+	return &util.APIError{
+		Code:    util.ErrorLimitExceeded,
+		Message: fmt.Sprintf(format, value, max),
+		Limit:   limit,
+		Max:     max,
+		Value:   value,
+	}
+}
+
+/*
+Checks the setup params against the limits of a server, returning a *util.APIError naming the
+limit exceeded. The schedule is measured from now. Params failing to parse are left to Params.
+The VDF difficulty is only checked here; the params of the election keep the default difficulty.
+*/
+func (sp *ElectionSetupParams) CheckLimits(l Limits) error {
+	choices := len(sp.Choices)
+	if len(sp.Contests) != 0 {
+		choices = 0
+		for _, c := range sp.Contests {
+			choices += len(c.Choices)
+		}
+	}
+	if l.MaxChoices != 0 && choices > l.MaxChoices {
+		return limitError("choices", uint64(l.MaxChoices), uint64(choices), "election has %d choices, the server allows at most %d")
+	}
+	if l.MaxVoters != 0 && len(sp.Voters) > l.MaxVoters {
+		return limitError("voters", uint64(l.MaxVoters), uint64(len(sp.Voters)), "election has %d voters, the server allows at most %d")
+	}
+	if voteEnd, err := time.Parse(time.RFC3339, sp.VoteEnd); err == nil && l.MaxSchedule != 0 {
+		if d := time.Until(voteEnd); d > l.MaxSchedule {
+			return limitError("schedule", uint64(l.MaxSchedule/time.Second), uint64(d/time.Second), "election votes until %d seconds from now, the server allows at most %d")
+		}
+	}
+	if difficulty, err := strconv.ParseUint(sp.VdfDifficulty, 10, 64); err == nil && l.MaxVdfDifficulty != 0 {
+		if difficulty > l.MaxVdfDifficulty {
+			return limitError("vdfDifficulty", l.MaxVdfDifficulty, difficulty, "election has a VDF difficulty of %d, the server allows at most %d")
+		}
+	}
+	return nil
+}
+
+// Answers with the JSON error envelope of an error returned by CheckLimits.
+func respondLimitError(w http.ResponseWriter, err error) {
+	aerr, ok := err.(*util.APIError)
+	if !ok {
+		respondError(w, 400, err)
+		return
+	}
+	content, _ := json.Marshal(util.ErrorEnvelope{Error: *aerr})
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(400)
+	w.Write(content)
+}
@@ -3,33 +3,79 @@ package server
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"sort"
+	"sync"
 
 	"github.com/giry-dev/pebble-voting-app/pebble-core/base32c"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/timesource"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
 )
 
 var (
-	errNotFound = errors.New("pebble: election not found")
-	errExists   = errors.New("pebble: election id already exists")
+	errNotFound    = errors.New("pebble: election not found")
+	errExists      = errors.New("pebble: election id already exists")
+	errKeyEligible = errors.New("pebble: key already eligible")
 )
 
 type mockService struct {
-	elections map[string]*voting.Election
-	ids       map[string]string
-	url       string
+	// Guards the maps and invitations, which concurrent requests read and update.
+	mu         sync.RWMutex
+	elections  map[string]*voting.Election
+	ids        map[string]string
+	organizers map[string]pubkey.PrivateKey
+	invites    map[string]*mockInvite
+	inviteList map[string][]*mockInvite
+	url        string
+	opts       []voting.ElectionOption
+	openStore  StoreOpener
+	// Admin IDs of the elections listed at /elections.
+	public map[string]bool
+	// Access tokens of the private elections, by backend ID.
+	tokens map[string][]byte
+	// Whether new elections run on a clock advanced by ForcePhase, and their clocks by backend ID.
+	testMode bool
+	clocks   map[string]*timesource.Shifted
+	// Setup params of the elections by admin ID, kept after they are retired, and the templates by name.
+	setups    map[string]ElectionSetupParams
+	templates map[string]ElectionSetupParams
 }
 
-func NewMockServer(url string, passHash []byte) *Server {
+// Opens the store of the messages of a new election.
+type StoreOpener func(id voting.ElectionID) (voting.MessageStore, error)
+
+type mockInvite struct {
+	backendId string
+	email     string
+	token     string
+	keyHash   util.HashValue
+	redeemed  bool
+}
+
+// Creates a server hosting elections on mock broadcast channels.
+// The options are applied to every hosted election, e.g. voting.WithTimeSource.
+func NewMockServer(url string, passHash []byte, opts ...voting.ElectionOption) *Server {
 	if len(passHash) != 0 && len(passHash) != sha256.Size {
 		panic("server: invalid password hash length")
 	}
 	return &Server{
 		srv: &mockService{
-			elections: make(map[string]*voting.Election),
-			ids:       make(map[string]string),
-			url:       url,
+			elections:  make(map[string]*voting.Election),
+			ids:        make(map[string]string),
+			organizers: make(map[string]pubkey.PrivateKey),
+			invites:    make(map[string]*mockInvite),
+			inviteList: make(map[string][]*mockInvite),
+			public:     make(map[string]bool),
+			tokens:     make(map[string][]byte),
+			clocks:     make(map[string]*timesource.Shifted),
+			setups:     make(map[string]ElectionSetupParams),
+			templates:  make(map[string]ElectionSetupParams),
+			url:        url,
+			opts:       opts,
 		},
 		passHash: passHash,
 		create:   true,
@@ -37,7 +83,21 @@ func NewMockServer(url string, passHash []byte) *Server {
 	}
 }
 
-func (s *mockService) Create(spar ElectionSetupParams) error {
+/*
+Sets how a server created by NewMockServer stores the messages of the elections
+created from then on, instead of in memory. Other servers ignore it.
+*/
+func (s *Server) SetMessageStores(open StoreOpener) {
+	if ms, ok := s.srv.(*mockService); ok {
+		ms.mu.Lock()
+		ms.openStore = open
+		ms.mu.Unlock()
+	}
+}
+
+func (s *mockService) Create(ctx context.Context, spar ElectionSetupParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if _, exists := s.ids[spar.AdminId]; exists {
 		return errExists
 	}
@@ -45,22 +105,69 @@ func (s *mockService) Create(spar ElectionSetupParams) error {
 	if err != nil {
 		return err
 	}
-	id, err := util.RandomId()
+	// The service acts as organizer, signing the params and eligibility updates
+	organizer, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		return err
+	}
+	err = epar.Sign(organizer)
+	if err != nil {
+		return err
+	}
+	id := epar.ElectionId(voting.ServerNetwork)
+	var store voting.MessageStore = voting.NewMemoryStore()
+	if s.openStore != nil {
+		store, err = s.openStore(id)
+		if err != nil {
+			return err
+		}
+	}
+	bc, err := voting.NewStoreChannel(ctx, id, epar, store)
+	if err != nil {
+		return err
+	}
+	bc.SetReportDuplicates(true)
+	err = bc.SetQuotas(ctx, voting.DefaultPostingQuotas)
 	if err != nil {
 		return err
 	}
-	bc := voting.NewMockBroadcastChannel(id, epar)
-	election, err := voting.NewElection(context.Background(), bc, nil)
+	if spar.MerkleEligibility {
+		bc.SetEligibilityList(spar.eligibilityList())
+	}
+	election, err := voting.NewElection(ctx, bc, nil, s.opts...)
 	if err != nil {
 		return err
 	}
+	var token [32]byte
+	if spar.Private {
+		token, err = util.RandomId()
+		if err != nil {
+			return err
+		}
+	}
 	eid := base32c.Encode(id[:])
+	if s.testMode {
+		clock := timesource.NewShifted(election.Clock())
+		voting.WithTimeSource(clock)(election)
+		bc.SetTimeSource(clock)
+		s.clocks[eid] = clock
+	}
 	s.elections[eid] = election
+	s.organizers[eid] = organizer
 	s.ids[spar.AdminId] = eid
+	s.setups[spar.AdminId] = spar
+	if spar.Public {
+		s.public[spar.AdminId] = true
+	}
+	if spar.Private {
+		s.tokens[eid] = token[:]
+	}
 	return nil
 }
 
 func (s *mockService) Setup(adminId string) (info SetupInfo) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	backendId, ok := s.ids[adminId]
 	if !ok {
 		info.Status = SetupError
@@ -73,18 +180,112 @@ func (s *mockService) Setup(adminId string) (info SetupInfo) {
 		return
 	}
 	var inv voting.Invitation
-	inv.Network = "mock"
+	inv.Network = voting.ServerNetwork
 	inv.Address = []byte(backendId)
 	inv.Servers = append(inv.Servers, s.url)
+	inv.Organizer = s.elections[backendId].Params().Organizer
+	inv.AccessToken = s.tokens[backendId]
 	info.Status = SetupDone
 	info.BackendId = backendId
 	info.Invitation = inv.String()
 	return
 }
 
+func (s *mockService) AdminIds() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.ids))
+	for adminId := range s.ids {
+		ids = append(ids, adminId)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
 func (s *mockService) Election(id string) (*voting.Election, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	if el, ok := s.elections[id]; ok {
 		return el, nil
 	}
 	return nil, errNotFound
 }
+
+func (s *mockService) Invite(adminId string, emails []string) ([]EmailInvite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	backendId, ok := s.ids[adminId]
+	if !ok {
+		return nil, errNotFound
+	}
+	if s.elections[backendId].Params().EligibilityList.RootOnly() {
+		return nil, errMerkleInvite
+	}
+	invited := make(map[string]bool)
+	for _, inv := range s.inviteList[adminId] {
+		invited[inv.email] = true
+	}
+	var res []EmailInvite
+	for _, email := range emails {
+		if !validEmail(email) {
+			return nil, errInvalidAddress
+		}
+		if invited[email] {
+			continue
+		}
+		invited[email] = true
+		id, err := util.RandomId()
+		if err != nil {
+			return nil, err
+		}
+		inv := &mockInvite{backendId: backendId, email: email, token: base32c.Encode(id[:20])}
+		s.invites[inv.token] = inv
+		s.inviteList[adminId] = append(s.inviteList[adminId], inv)
+		res = append(res, EmailInvite{Email: email, Token: inv.token})
+	}
+	return res, nil
+}
+
+func (s *mockService) Invitations(adminId string) ([]InviteStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.ids[adminId]; !ok {
+		return nil, errNotFound
+	}
+	res := make([]InviteStatus, 0, len(s.inviteList[adminId]))
+	for _, inv := range s.inviteList[adminId] {
+		status := InviteStatus{Email: inv.email, Redeemed: inv.redeemed}
+		if inv.redeemed {
+			status.KeyHash = hex.EncodeToString(inv.keyHash[:])
+		}
+		res = append(res, status)
+	}
+	return res, nil
+}
+
+func (s *mockService) Redeem(ctx context.Context, token string, key pubkey.PublicKey) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.invites[token]
+	if !ok || inv.redeemed {
+		return "", errInvalidToken
+	}
+	election := s.elections[inv.backendId]
+	params := election.Params()
+	list := new(structs.EligibilityList)
+	err := list.FromBytes(params.EligibilityList.Bytes())
+	if err != nil {
+		return "", err
+	}
+	pkh := list.HashKey(key)
+	if !list.Add(pkh, params.HashScheme().Sum(util.DomainIdentity, []byte(inv.email))) {
+		return "", errKeyEligible
+	}
+	err = election.UpdateEligibility(ctx, s.organizers[inv.backendId], list)
+	if err != nil {
+		return "", err
+	}
+	inv.redeemed = true
+	inv.keyHash = pkh
+	return inv.backendId, nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+)
+
+// Implemented by election services listing the elections they host, for /admin/overview.
+type ElectionLister interface {
+	// Returns the admin IDs of the elections, including those whose setup failed or is in progress.
+	AdminIds() []string
+}
+
+// State of a hosted election, as listed by /admin/overview. Setup errors leave the other fields empty.
+type ElectionOverview struct {
+	AdminId   string `json:"adminId"`
+	BackendId string `json:"backendId,omitempty"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Phase     string `json:"phase,omitempty"`
+	// Credential and ballot messages on the channel, counted whether valid or not.
+	Credentials int `json:"credentials"`
+	Ballots     int `json:"ballots"`
+	Messages    int `json:"messages"`
+	// Total size of the messages in bytes.
+	Storage int `json:"storageBytes"`
+}
+
+// Answers /admin/overview with the state of every election of the service.
+func (s *Server) serveOverview(ctx context.Context, w http.ResponseWriter) {
+	lister, ok := s.srv.(ElectionLister)
+	if !ok {
+		respondErrorCode(w, 404, util.ErrorNotFound, "Server does not list elections")
+		return
+	}
+	elections := []ElectionOverview{}
+	for _, adminId := range lister.AdminIds() {
+		info := s.srv.Setup(adminId)
+		o := ElectionOverview{AdminId: adminId}
+		switch info.Status {
+		case SetupError:
+			o.Status, o.Error = "SetupError", info.Error
+		case SetupInProgress:
+			o.Status = "InProgress"
+		case SetupDone:
+			o.Status, o.BackendId = "Done", info.BackendId
+			err := electionStats(ctx, s.srv, &o)
+			if err != nil {
+				o.Error = err.Error()
+			}
+		}
+		elections = append(elections, o)
+	}
+	respondJson(w, struct {
+		Elections []ElectionOverview `json:"elections"`
+	}{elections})
+}
+
+// Fills in the phase and the message counts of the election.
+func electionStats(ctx context.Context, srv ElectionService, o *ElectionOverview) error {
+	e, err := srv.Election(o.BackendId)
+	if err != nil {
+		return err
+	}
+	o.Title = e.Params().Title
+	o.Phase = e.Phase().String()
+	return voting.ForEachMessage(ctx, e.Channel(), func(m voting.Message) error {
+		o.Messages++
+		o.Storage += len(m.Bytes())
+		if m.Credential != nil {
+			o.Credentials++
+		} else if m.SignedBallot != nil {
+			o.Ballots++
+		}
+		return nil
+	})
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+)
+
+/*
+Sets the sink recording the posted messages that the server rejects because they cannot be read
+or fail verification. Sinks implementing voting.QuarantineStore are searchable at /quarantine.
+*/
+func (s *Server) SetQuarantine(sink voting.QuarantineSink) {
+	s.quarantine = sink
+}
+
+// Records a rejected post of data to the election if a quarantine sink is set.
+func (s *Server) quarantinePost(req *http.Request, backendId string, data []byte, reason string) {
+	if s.quarantine == nil {
+		return
+	}
+	s.quarantine.Quarantine(voting.QuarantinedMessage{
+		Time:   time.Now(),
+		Source: "/messages/" + backendId + " from " + req.RemoteAddr,
+		Reason: reason,
+		Data:   data,
+	})
+}
+
+// The JSON form of a quarantined message, with the data base64-encoded.
+type quarantineEntry struct {
+	Time   int64  `json:"time"`
+	Source string `json:"source"`
+	Reason string `json:"reason"`
+	Data   string `json:"data"`
+}
+
+/*
+Answers an auditor query of the quarantine: the messages quarantined since the Unix time
+in the since query parameter, if any, posted to the election in the election parameter, if any.
+*/
+func (s *Server) serveQuarantine(w http.ResponseWriter, req *http.Request) {
+	store, ok := s.quarantine.(voting.QuarantineStore)
+	if !ok {
+		respondErrorCode(w, 404, util.ErrorNotFound, "Quarantine not available")
+		return
+	}
+	var since time.Time
+	if v := req.URL.Query().Get("since"); v != "" {
+		t, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondErrorCode(w, 400, util.ErrorInvalidRequest, "Invalid since")
+			return
+		}
+		since = time.Unix(t, 0)
+	}
+	var keep func(voting.QuarantinedMessage) bool
+	if election := req.URL.Query().Get("election"); election != "" {
+		keep = func(m voting.QuarantinedMessage) bool {
+			return strings.HasPrefix(m.Source, "/messages/"+election+" ")
+		}
+	}
+	entries := []quarantineEntry{}
+	for _, m := range store.Query(since, keep) {
+		entries = append(entries, quarantineEntry{m.Time.Unix(), m.Source, m.Reason, base64.StdEncoding.EncodeToString(m.Data)})
+	}
+	respondJson(w, entries)
+}
@@ -1,18 +1,27 @@
 package server
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/methods"
 )
 
 type SetupStatus uint8
@@ -24,10 +33,11 @@ const (
 	SetupDone
 )
 
-// Represents a server error and includes the status code and message.
+// Represents a server error and includes the status code, message and error code.
 type ServerError struct {
 	StatusCode int
 	Body       string
+	Code       util.ErrorCode
 }
 
 // It implements the Error() method to return a formatted error message.
@@ -47,9 +57,11 @@ type SetupInfo struct {
 Interface defines the methods for managing elections.
 It includes methods like Create for creating an election,
 Setup for retrieving setup information, and Election for getting an election instance.
+The context passed to Create is the one of the request, which is cancelled when the client goes away;
+work enqueued to outlive the request must not use it.
 */
 type ElectionService interface {
-	Create(params ElectionSetupParams) error
+	Create(ctx context.Context, params ElectionSetupParams) error
 	Setup(adminId string) SetupInfo
 	Election(backendId string) (*voting.Election, error)
 }
@@ -63,6 +75,14 @@ type Server struct {
 	srv          ElectionService
 	passHash     []byte
 	create, post bool
+	mailer       Mailer
+	linkBase     string
+	quarantine   voting.QuarantineSink
+	webhooks     []Webhook
+	webhookErr   func(err error)
+	discovery    bool
+	testMode     bool
+	limits       Limits
 }
 
 // Utility function that sends a plain text response with the given status code and body.
@@ -73,11 +93,255 @@ func respondText(w http.ResponseWriter, statusCode int, body string) {
 	w.Write([]byte(body))
 }
 
+// Sends a JSON error envelope with the code of err, or the generic code of the status code if err has none.
+func respondError(w http.ResponseWriter, statusCode int, err error) {
+	respondErrorCode(w, statusCode, voting.ErrorCodeOf(err), err.Error())
+}
+
+// Sends a JSON error envelope with the given code and message, or the generic code of the status code if code is empty.
+func respondErrorCode(w http.ResponseWriter, statusCode int, code util.ErrorCode, message string) {
+	if code == "" {
+		code = util.StatusErrorCode(statusCode)
+	}
+	content, _ := json.Marshal(util.ErrorEnvelope{Error: util.APIError{Code: code, Message: message}})
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(statusCode)
+	w.Write(content)
+}
+
+// Returns the error forbidding to post a message.
+func forbidden(err error) *ServerError {
+	return &ServerError{403, err.Error(), voting.ErrorCodeOf(err)}
+}
+
+// Checks that a message may be posted to the election by an untrusted client.
+func checkMessage(election *voting.Election, msg voting.Message) *ServerError {
+	list := election.Params().EligibilityList
+	if msg.Credential != nil {
+		_, err := list.Verify(list.HashKey(msg.Credential.PublicKey), msg.Credential.Proof)
+		if err != nil {
+			return forbidden(err)
+		}
+	}
+	if msg.Delegation != nil {
+		// Delegations change the credential set, which must not change once voting starts
+		if election.Phase() != voting.CredGen {
+			return forbidden(voting.ErrWrongPhase)
+		}
+		_, err := list.Verify(list.HashKey(msg.Delegation.PublicKey), msg.Delegation.Proof)
+		if err != nil {
+			return forbidden(err)
+		}
+	}
+	// Keys revealed before the tally would open ballots while voting is in progress
+	if msg.KeyReveal != nil && election.Phase() < voting.Tally {
+		return forbidden(voting.ErrWrongPhase)
+	}
+	if msg.Certification != nil {
+		err := msg.Certification.Verify(election.Params(), election.Id())
+		if err != nil {
+			return forbidden(err)
+		}
+	}
+	return nil
+}
+
+// Bodies smaller than this are sent uncompressed.
+const minCompressSize = 1024
+
+// Reports whether the request accepts the gzip content encoding.
+func acceptsGzip(req *http.Request) bool {
+	for _, enc := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(enc, ";")
+		if strings.TrimSpace(params[0]) != "gzip" {
+			continue
+		}
+		for _, param := range params[1:] {
+			if q := strings.TrimSpace(param); strings.HasPrefix(q, "q=") {
+				v, err := strconv.ParseFloat(q[2:], 64)
+				return err == nil && v > 0
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Sends a binary body, compressed with gzip when it is large and the client accepts it.
+// Range requests get the requested part of the uncompressed body.
+func respondBytes(w http.ResponseWriter, req *http.Request, body []byte) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if req.Header.Get("Range") != "" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(body))
+		return
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	if len(body) >= minCompressSize && acceptsGzip(req) {
+		var buf bytes.Buffer
+		gz, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+		gz.Write(body)
+		gz.Close()
+		body = buf.Bytes()
+		w.Header().Add("Content-Encoding", "gzip")
+	}
+	w.Header().Add("Content-Type", "application/octet-stream")
+	w.Header().Add("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(200)
+	w.Write(body)
+}
+
+// Sends the messages with the framing requested by the client, see the /messages endpoint.
+// JSON view of a stored message.
+type messageView struct {
+	Sequence uint64    `json:"sequence"`
+	Received time.Time `json:"received"`
+	Hash     string    `json:"hash"`
+	Data     []byte    `json:"data"`
+}
+
+func respondMessages(w http.ResponseWriter, req *http.Request, framing string, msgs []voting.Message) {
+	switch framing {
+	case "":
+		// Legacy framing with 1 or 2-byte lengths
+		var body []byte
+		for _, msg := range msgs {
+			p := msg.Bytes()
+			if len(p) < 128 {
+				body = append(body, byte(len(p)))
+			} else {
+				body = append(body, byte(len(p)>>8)|128, byte(len(p)))
+			}
+			body = append(body, p...)
+		}
+		respondBytes(w, req, body)
+	case "json":
+		views := make([]messageView, len(msgs))
+		for i, msg := range msgs {
+			p := msg.Bytes()
+			h := util.Hash(p)
+			views[i] = messageView{Sequence: msg.Sequence, Received: msg.Received, Hash: hex.EncodeToString(h[:]), Data: p}
+		}
+		respondJson(w, views)
+	case "1":
+		w.Header().Set("Pebble-Framing", "1")
+		respondBytes(w, req, voting.EncodeMessages(msgs))
+	case "2":
+		w.Header().Set("Pebble-Framing", "2")
+		respondBytes(w, req, voting.EncodeEnvelopes(msgs))
+	default:
+		w.Header().Set("Pebble-Framing", "3")
+		respondBytes(w, req, voting.EncodeReceiptEnvelopes(msgs))
+	}
+}
+
+// Longest wait of a long-polling request.
+const maxLongPollWait = time.Minute
+
+var errInvalidLongPoll = errors.New("pebble: invalid since or wait parameter")
+
+// Parses the since and wait parameters of a long-polling request, capping the wait.
+func longPollParams(query url.Values) (since int, wait time.Duration, err error) {
+	if s := query.Get("since"); s != "" {
+		since, err = strconv.Atoi(s)
+		if err != nil || since < 0 {
+			return 0, 0, errInvalidLongPoll
+		}
+	}
+	if s := query.Get("wait"); s != "" {
+		wait, err = time.ParseDuration(s)
+		if err != nil || wait < 0 {
+			return 0, 0, errInvalidLongPoll
+		}
+		if wait > maxLongPollWait {
+			wait = maxLongPollWait
+		}
+	}
+	return since, wait, nil
+}
+
+/*
+Returns the messages of the channel once there are more than since of them,
+or after waiting for wait, or when ctx is done.
+*/
+func waitForMessages(ctx context.Context, bc voting.BroadcastChannel, since int, wait time.Duration) ([]voting.Message, error) {
+	msgs, err := bc.Get(ctx)
+	if err != nil || len(msgs) > since || wait <= 0 {
+		return msgs, err
+	}
+	wctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	posted, err := bc.Watch(wctx)
+	if err != nil {
+		return nil, err
+	}
+	// Messages posted before the watch started are not sent on it
+	msgs, err = bc.Get(ctx)
+	if err != nil || len(msgs) > since {
+		return msgs, err
+	}
+	select {
+	case <-posted:
+	case <-wctx.Done():
+	}
+	return bc.Get(ctx)
+}
+
+/*
+Streams the messages of the channel in envelopes (framing version 2, or 3 with receipts) without
+buffering the log, compressing the stream with gzip if the client accepts it.
+Errors after the response has started abort the response.
+*/
+func streamEnvelopes(ctx context.Context, w http.ResponseWriter, req *http.Request, bc voting.BroadcastChannel, receipts bool) {
+	it, err := voting.StreamMessages(ctx, bc)
+	if err != nil {
+		respondError(w, 500, err)
+		return
+	}
+	defer it.Close()
+	encode := voting.EncodeEnvelopes
+	if receipts {
+		encode = voting.EncodeReceiptEnvelopes
+		w.Header().Set("Pebble-Framing", "3")
+	} else {
+		w.Header().Set("Pebble-Framing", "2")
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	w.Header().Add("Content-Type", "application/octet-stream")
+	w.Header().Set("Accept-Ranges", "bytes")
+	out := io.Writer(w)
+	var gz *gzip.Writer
+	if acceptsGzip(req) {
+		w.Header().Add("Content-Encoding", "gzip")
+		gz, _ = gzip.NewWriterLevel(w, gzip.BestSpeed)
+		out = gz
+	}
+	w.WriteHeader(200)
+	for {
+		m, err := it.Next()
+		if err == io.EOF {
+			// Only complete streams get the gzip trailer
+			if gz != nil {
+				gz.Close()
+			}
+			return
+		}
+		if err != nil {
+			panic(http.ErrAbortHandler)
+		}
+		_, err = out.Write(encode([]voting.Message{m}))
+		if err != nil {
+			return
+		}
+	}
+}
+
 // Utility function that marshals an object to JSON and sends it as the response with the appropriate content type.
 func respondJson(w http.ResponseWriter, o interface{}) {
 	content, err := json.Marshal(o)
 	if err != nil {
-		respondText(w, 500, err.Error())
+		respondError(w, 500, err)
 	} else {
 		w.Header().Add("Content-Type", "application/json")
 		w.Header().Add("Content-Length", strconv.Itoa(len(content)))
@@ -86,29 +350,82 @@ func respondJson(w http.ResponseWriter, o interface{}) {
 	}
 }
 
+// Maps the tally of the first contest to choice names, and returns the blank ballot count separately.
+func tallyCounts(params *voting.ElectionParams, tally methods.Tally) (map[string]int, int) {
+	choices := params.ContestList()[0].Choices
+	counts := make(map[string]int, len(choices))
+	for _, c := range tally.Choices() {
+		if c.Index < len(choices) {
+			counts[choices[c.Index]] = int(c.Count)
+		}
+	}
+	return counts, int(tally.Blank())
+}
+
+// The ballots of an election that were not counted: counts by reason and, on request, each rejected message.
+type rejectionReport struct {
+	Counts   map[string]int    `json:"counts"`
+	Messages []rejectedMessage `json:"messages,omitempty"`
+}
+
+type rejectedMessage struct {
+	Hash   string `json:"hash"`
+	Reason string `json:"reason"`
+}
+
+// Builds the rejection report of the progress, or returns nil if all ballots were counted.
+func rejections(prog voting.ElectionProgress, details bool) *rejectionReport {
+	if len(prog.Rejections) == 0 {
+		return nil
+	}
+	r := &rejectionReport{Counts: make(map[string]int, len(prog.Rejections))}
+	for reason, n := range prog.Rejections {
+		r.Counts[reason.String()] = n
+	}
+	if details {
+		for _, m := range prog.Rejected {
+			r.Messages = append(r.Messages, rejectedMessage{hex.EncodeToString(m.Hash[:]), m.Reason.String()})
+		}
+	}
+	return r
+}
+
 // Decodes JSON data from the given reader into the provided interface.
+// Maximum size of the JSON payloads and of the message batches posted to the server.
+const (
+	maxJsonSize = 1 << 26
+	maxPostSize = 1 << 26
+)
+
+// Decodes a JSON payload, reading at most maxJsonSize bytes.
 func decodeJson(r io.Reader, v interface{}) error {
-	return json.NewDecoder(r).Decode(v)
+	return json.NewDecoder(io.LimitReader(r, maxJsonSize)).Decode(v)
 }
 
-// Main handler for incoming HTTP requests.
+/*
+Main handler for incoming HTTP requests.
+Errors are answered with a JSON error envelope {"error": {"code": ..., "message": ...}},
+where code is a stable util.ErrorCode such as "wrong-phase" or "not-eligible".
+*/
 func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	ctx := context.Background()
+	// Cancelled when the client goes away, stopping tally and verification work
+	ctx := req.Context()
 	path := req.URL.Path
 	/*
 		/create (HTTP POST):
 
-		Description: Create an election.
+		Description: Create an election. Elections exceeding the limits of the server (see Limits) are answered with status 400
+			and code limit-exceeded, naming the limit (limit) with its maximum (max) and the value requested (value).
 		Payload: JSON payload containing election setup parameters (ElectionSetupParams).
 		Response: Plain text response indicating the status of the request.
 	*/
 	if path == "/create" {
 		if req.Method != http.MethodPost {
-			respondText(w, http.StatusMethodNotAllowed, "Method not allowed")
+			respondErrorCode(w, http.StatusMethodNotAllowed, util.ErrorMethodNotAllowed, "Method not allowed")
 			return
 		}
 		if !s.create {
-			respondText(w, http.StatusForbidden, "Server does not create elections")
+			respondErrorCode(w, http.StatusForbidden, util.ErrorForbidden, "Server does not create elections")
 			return
 		}
 		if !s.authorized(w, req) {
@@ -117,14 +434,22 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		var params ElectionSetupParams
 		err := decodeJson(req.Body, &params)
 		if err != nil {
-			respondText(w, 400, err.Error())
+			respondError(w, 400, err)
+			return
+		}
+		err = params.CheckLimits(s.limits)
+		if err != nil {
+			respondLimitError(w, err)
 			return
 		}
-		err = s.srv.Create(params)
+		err = s.srv.Create(ctx, params)
 		if err != nil {
-			respondText(w, 500, err.Error())
+			respondError(w, 500, err)
 			return
 		}
+		if len(s.webhooks) != 0 {
+			go s.watchWebhooks(params.AdminId)
+		}
 		respondText(w, 200, "Election creation enqueued")
 		return
 
@@ -137,11 +462,11 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		*/
 	} else if adminId, ok := util.GetSuffix(path, "/setup/"); ok {
 		if req.Method != http.MethodGet {
-			respondText(w, 405, "Method not allowed")
+			respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
 			return
 		}
 		if !s.create {
-			respondText(w, http.StatusForbidden, "Server does not create elections")
+			respondErrorCode(w, http.StatusForbidden, util.ErrorForbidden, "Server does not create elections")
 			return
 		}
 		if !s.authorized(w, req) {
@@ -165,7 +490,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			resp.BackendId = info.BackendId
 			resp.Invitation = info.Invitation
 		default:
-			respondText(w, 500, "Unknown status")
+			respondErrorCode(w, 500, util.ErrorInternal, "Unknown status")
 			return
 		}
 		respondJson(w, resp)
@@ -173,25 +498,31 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		/*
 			/election/{backendId} (HTTP GET):
 
-			Description: Get the status of an election.
+			Description: Get the status of an election. Private elections require their access token (see AccessTokenService).
 			Parameters: backendId - The backend ID associated with the election.
+			Query: rejections - Optional; "details" lists each ballot that was not counted with the reason,
+				in addition to the counts by reason.
 			Response: JSON object representing the status of the election with fields specific to the progress phase of the election (voting.Election).
 		*/
 	} else if backendId, ok := util.GetSuffix(path, "/election/"); ok {
 		if req.Method != http.MethodGet {
-			respondText(w, 405, "Method not allowed")
+			respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if !s.allowedAccess(w, req, backendId) {
 			return
 		}
 		election, err := s.srv.Election(backendId)
 		if err != nil {
-			respondText(w, 500, err.Error())
+			respondError(w, 500, err)
 			return
 		}
 		prog, err := election.Progress(ctx)
 		if err != nil {
-			respondText(w, 500, err.Error())
+			respondError(w, 500, err)
 			return
 		}
+		details := req.URL.Query().Get("rejections") == "details"
 		switch prog.Phase {
 		case voting.Setup:
 			var resp struct {
@@ -210,10 +541,13 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 				Status   string `json:"status"`
 				Progress int    `json:"progress"`
 				Total    int    `json:"total"`
+				// Ballots not counted
+				Rejections *rejectionReport `json:"rejections,omitempty"`
 			}
 			resp.Status = "Cast"
 			resp.Progress = prog.Count
 			resp.Total = prog.Total
+			resp.Rejections = rejections(prog, details)
 			respondJson(w, resp)
 		case voting.Tally:
 			var resp struct {
@@ -221,8 +555,19 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 				Progress int            `json:"progress"`
 				Total    int            `json:"total"`
 				Counts   map[string]int `json:"counts"`
+				Blank    int            `json:"blank"`
+				Seed     string         `json:"tieBreakSeed"`
+				// Provisional per-contest results
+				Results    []methods.Result `json:"results"`
+				Rejections *rejectionReport `json:"rejections,omitempty"`
 			}
 			resp.Status = "Tally"
+			resp.Progress = prog.Count
+			resp.Total = prog.Total
+			resp.Rejections = rejections(prog, details)
+			resp.Counts, resp.Blank = tallyCounts(election.Params(), prog.Tally)
+			resp.Seed = hex.EncodeToString(prog.TieBreakSeed[:])
+			resp.Results = election.Results(prog)
 			respondJson(w, resp)
 		case voting.End:
 			var resp struct {
@@ -230,29 +575,66 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 				Valid  int            `json:"valid"`
 				Total  int            `json:"total"`
 				Counts map[string]int `json:"counts"`
+				Blank  int            `json:"blank"`
+				Winner string         `json:"winner,omitempty"`
+				Seed   string         `json:"tieBreakSeed"`
+				// Per-contest results, in the order of the contests of the params
+				Results []methods.Result `json:"results"`
+				// Hash of the result, and whether the organizer and the trustees certified it
+				TallyHash string   `json:"tallyHash"`
+				Certified bool     `json:"certified"`
+				Trustees  []uint32 `json:"certifyingTrustees,omitempty"`
+				Conflicts int      `json:"conflictingCertifications,omitempty"`
+				// Ballots not counted
+				Rejections *rejectionReport `json:"rejections,omitempty"`
+			}
+			cert, err := election.Certification(ctx, prog)
+			if err == nil {
+				cert, err = s.finalize(ctx, backendId, election, prog, cert)
+			}
+			if err != nil {
+				respondError(w, 500, err)
+				return
 			}
 			resp.Status = "End"
+			resp.Valid = prog.Count
+			resp.Total = prog.Total
+			resp.Rejections = rejections(prog, details)
+			resp.Counts, resp.Blank = tallyCounts(election.Params(), prog.Tally)
+			if winner, ok := prog.Tally.Winner(prog.TieBreakSeed); ok {
+				resp.Winner = election.Params().ContestList()[0].Choices[winner]
+			}
+			resp.Seed = hex.EncodeToString(prog.TieBreakSeed[:])
+			resp.Results = election.Results(prog)
+			resp.TallyHash = hex.EncodeToString(cert.TallyHash[:])
+			resp.Certified = cert.Certified
+			resp.Trustees = cert.Trustees
+			resp.Conflicts = len(cert.Conflicting)
 			respondJson(w, resp)
 		}
 
 		/*
 			/params/{backendId} (HTTP GET):
 
-			Description: Get the parameters of an election.
+			Description: Get the parameters of an election. Private elections require their access token (see AccessTokenService).
 			Parameters: backendId - The backend ID associated with the election.
 			Response: Byte slice representing the serialized parameters of the election.
 		*/
 	} else if backendId, ok := util.GetSuffix(path, "/params/"); ok {
 		if req.Method != http.MethodGet {
-			respondText(w, 405, "Method not allowed")
+			respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if !s.allowedAccess(w, req, backendId) {
 			return
 		}
 		election, err := s.srv.Election(backendId)
 		if err != nil {
-			respondText(w, 500, err.Error())
+			respondError(w, 500, err)
 			return
 		}
-		body := election.Params().Bytes()
+		// Clients apply the amendments themselves, and check the ID against the published params
+		body := election.PublishedParams().Bytes()
 		w.Header().Add("Content-Length", strconv.Itoa(len(body)))
 		w.WriteHeader(200)
 		w.Write(body)
@@ -260,78 +642,640 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		/*
 			/messages/{backendId} (HTTP GET and POST):
 
-			Description: Get or post messages related to an election.
+			Description: Get or post messages related to an election. Private elections require their access token (see AccessTokenService).
 			Parameters: backendId - The backend ID associated with the election.
-			GET Response: Byte slice representing the serialized messages retrieved from the election channel.
+			GET Query: framing - Optional framing version; version 1 prefixes each message with its length as a varint,
+				version 2 wraps each message in a versioned envelope (see voting.DecodeEnvelopes), and version 3
+				adds to the envelopes the sequence number of each message and the time it was received.
+				Newer versions are answered with version 3. The framing used is returned in the Pebble-Framing header.
+				Messages are listed in the order they were stored, with sequence numbers counting from 1 without gaps.
+			GET Query: format - Optional; json lists the messages as a JSON array with the sequence number (sequence),
+				the time received (received), the hash (hash) and the base64-encoded bytes (data) of each message.
+			GET Query: since - Optional number of messages already known to the client, which are left out of the response.
+			GET Query: id - Optional hex-encoded ID of a message (voting.MessageID), the only message then listed.
+				Unknown messages are answered with status 404.
+			GET Query: wait - Optional duration such as 30s, at most a minute, to wait for messages after the first since ones
+				before responding (long polling). With since or wait, the total number of messages is returned in the
+				Pebble-Message-Count header.
+			GET Response: Byte slice representing the serialized messages retrieved from the election channel,
+				gzip-compressed if large and accepted by the client (Accept-Encoding).
+				Except in JSON, a Range header requests part of the uncompressed response with status 206, so that clients
+				resume interrupted downloads: the log only grows, so the bytes already received stay valid.
+			POST Query: framing - Optional framing version; version 1 posts a batch of messages, each prefixed with its length as a varint,
+				and version 2 a batch of message envelopes, which carry the proofs of work required by the params.
 			POST Payload: Raw message bytes to be posted to the election channel.
+				A batch is validated as a whole, and no message is posted if any is rejected.
+				A message identical to one already posted is rejected with status 409.
+				Messages exceeding the posting quotas, such as a second credential of a key, are rejected with status 429.
+				Payloads larger than 64 MiB are rejected with status 413.
 			POST Response: Plain text response indicating the status of the message posting.
 		*/
 	} else if backendId, ok := util.GetSuffix(path, "/messages/"); ok {
+		if !s.allowedAccess(w, req, backendId) {
+			return
+		}
 		election, err := s.srv.Election(backendId)
 		if err != nil {
-			respondText(w, 500, err.Error())
+			respondError(w, 500, err)
 			return
 		}
 		if req.Method == http.MethodGet {
-			msgs, err := election.Channel().Get(ctx)
-			if err != nil {
-				respondText(w, 500, err.Error())
+			query := req.URL.Query()
+			framing := query.Get("framing")
+			if query.Get("format") == "json" {
+				framing = "json"
+			}
+			if id := query.Get("id"); id != "" {
+				mid, err := hex.DecodeString(id)
+				if err != nil || len(mid) != len(voting.MessageID{}) {
+					respondErrorCode(w, 400, util.ErrorInvalidRequest, "Invalid message ID")
+					return
+				}
+				var msgId voting.MessageID
+				copy(msgId[:], mid)
+				msg, err := voting.GetMessageById(ctx, election.Channel(), msgId)
+				if err == voting.ErrMessageNotFound {
+					respondError(w, 404, err)
+					return
+				} else if err != nil {
+					respondError(w, 500, err)
+					return
+				}
+				respondMessages(w, req, framing, []voting.Message{msg})
 				return
 			}
-			w.WriteHeader(200)
-			l := []byte{0, 0}
-			for _, msg := range msgs {
-				p := msg.Bytes()
-				if len(p) < 128 {
-					l[0] = byte(len(p))
-					w.Write(l[:1])
-				} else {
-					l[0] = byte(len(p)>>8) | 128
-					l[1] = byte(len(p))
-					w.Write(l)
+			if query.Get("since") != "" || query.Get("wait") != "" {
+				since, wait, err := longPollParams(query)
+				if err != nil {
+					respondError(w, 400, err)
+					return
 				}
-				w.Write(p)
+				msgs, err := waitForMessages(req.Context(), election.Channel(), since, wait)
+				if err != nil {
+					respondError(w, 500, err)
+					return
+				}
+				w.Header().Set("Pebble-Message-Count", strconv.Itoa(len(msgs)))
+				if since > len(msgs) {
+					since = len(msgs)
+				}
+				respondMessages(w, req, framing, msgs[since:])
+				return
 			}
+			// Clients requesting a newer framing get the latest supported one, streamed unless resuming a download
+			if framing != "" && framing != "1" && framing != "json" && req.Header.Get("Range") == "" {
+				streamEnvelopes(ctx, w, req, election.Channel(), framing != "2")
+				return
+			}
+			msgs, err := election.Channel().Get(ctx)
+			if err != nil {
+				respondError(w, 500, err)
+				return
+			}
+			respondMessages(w, req, framing, msgs)
 		} else if req.Method == http.MethodPost {
 			if !s.post {
-				respondText(w, 403, "Server does not post messages")
+				respondErrorCode(w, 403, util.ErrorForbidden, "Server does not post messages")
 				return
 			}
-			p, err := io.ReadAll(req.Body)
+			p, err := io.ReadAll(io.LimitReader(req.Body, maxPostSize+1))
 			if err != nil {
-				respondText(w, 400, err.Error())
+				respondError(w, 400, err)
 				return
 			}
-			msg, err := voting.MessageFromBytes(p)
-			if err != nil {
-				respondText(w, 400, err.Error())
+			if len(p) > maxPostSize {
+				respondErrorCode(w, http.StatusRequestEntityTooLarge, util.ErrorTooLarge, "Message batch too large")
 				return
 			}
-			err = election.Channel().Post(ctx, msg)
+			var msgs []voting.Message
+			switch req.URL.Query().Get("framing") {
+			case "1":
+				msgs, err = voting.DecodeMessageBatch(p)
+			case "2":
+				msgs, err = voting.DecodeEnvelopeBatch(p)
+			default:
+				var msg voting.Message
+				msg, err = voting.MessageFromBytes(p)
+				msgs = []voting.Message{msg}
+			}
 			if err != nil {
-				respondText(w, 500, err.Error())
-			} else {
+				s.quarantinePost(req, backendId, p, err.Error())
+				respondErrorCode(w, 400, util.ErrorInvalidMessage, err.Error())
+				return
+			}
+			refresh := false
+			for i, msg := range msgs {
+				if e := checkMessage(election, msg); e != nil {
+					s.quarantinePost(req, backendId, msg.Bytes(), e.Body)
+					if len(msgs) > 1 {
+						e.Body = fmt.Sprintf("message %d: %s", i, e.Body)
+					}
+					respondErrorCode(w, e.StatusCode, e.Code, e.Body)
+					return
+				}
+				refresh = refresh || msg.EligibilityUpdate != nil || msg.Amendment != nil
+			}
+			err = voting.PostAll(ctx, election.Channel(), msgs)
+			if err == nil && refresh {
+				err = election.Refresh(ctx)
+			}
+			if err == voting.ErrDuplicateMessage {
+				respondError(w, 409, err)
+			} else if err == voting.ErrInsufficientWork {
+				s.quarantinePost(req, backendId, p, err.Error())
+				respondError(w, 403, err)
+			} else if err == voting.ErrQuotaExceeded {
+				respondError(w, 429, err)
+			} else if err != nil {
+				respondError(w, 500, err)
+			} else if len(msgs) == 1 {
 				respondText(w, 200, "Message posted")
+			} else {
+				respondText(w, 200, fmt.Sprintf("%d messages posted", len(msgs)))
+			}
+		} else {
+			respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+		}
+
+		/*
+			/elections (HTTP GET):
+
+			Description: List the public elections hosted by the server, on servers with discovery enabled,
+				so that voters find open elections without an invitation shared out of band.
+			Response: JSON array of the elections (PublicElection), with their backend ID (backendId),
+				title (title), description (description), phase (phase) and invitation (invitation).
+		*/
+	} else if path == "/elections" {
+		if req.Method != http.MethodGet {
+			respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+			return
+		}
+		s.serveDiscovery(w)
+
+		/*
+			/admin/overview (HTTP GET):
+
+			Description: List the elections hosted by the server, for operators. Requires the server password, and is disabled
+				without one since admin IDs grant access to the setup of their elections.
+			Response: JSON object with the list of elections (elections), each with its admin and backend IDs (adminId, backendId),
+				setup status (status) and error (error), title (title), phase (phase), the numbers of credential, ballot
+				and total messages on its channel (credentials, ballots, messages) and their size in bytes (storageBytes).
+		*/
+	} else if path == "/admin/overview" {
+		if req.Method != http.MethodGet {
+			respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if len(s.passHash) == 0 {
+			respondErrorCode(w, 403, util.ErrorForbidden, "Overview requires a server password")
+			return
+		}
+		if !s.authorized(w, req) {
+			return
+		}
+		s.serveOverview(ctx, w)
+
+		/*
+			/archive/{adminId} (HTTP GET and DELETE):
+
+			Description: Export the signed archive of an election (see voting.ArchiveWriter), or retire an ended election
+				from the server once it is archived. Requires the server password if one is set.
+			Parameters: adminId - The admin ID associated with the election setup.
+			GET Response: The archive, including the final result once the election ended.
+			DELETE Response: Confirmation text. Elections that have not ended are answered with status 409.
+		*/
+	} else if adminId, ok := util.GetSuffix(path, "/archive/"); ok {
+		archSrv, ok := s.srv.(ArchiveService)
+		if !ok {
+			respondErrorCode(w, 404, util.ErrorNotFound, "Server does not archive elections")
+			return
+		}
+		if !s.authorized(w, req) {
+			return
+		}
+		if req.Method == http.MethodGet {
+			var buf bytes.Buffer
+			err := archSrv.Archive(ctx, adminId, &buf)
+			if err == errNotFound {
+				respondError(w, 404, err)
+				return
+			} else if err != nil {
+				respondError(w, 500, err)
+				return
+			}
+			respondBytes(w, req, buf.Bytes())
+		} else if req.Method == http.MethodDelete {
+			err := archSrv.Retire(adminId)
+			if err == errNotFound {
+				respondError(w, 404, err)
+			} else if err == errNotEnded {
+				respondErrorCode(w, 409, util.ErrorWrongPhase, err.Error())
+			} else if err != nil {
+				respondError(w, 500, err)
+			} else {
+				respondText(w, 200, "Election retired")
+			}
+		} else {
+			respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+		}
+
+		/*
+			/phase/{adminId} (HTTP POST):
+
+			Description: Move an election to the start of a later phase regardless of the time, on servers in test mode
+				(see Server.SetTestMode). Requires the server password if one is set.
+			Parameters: adminId - The admin ID associated with the election setup.
+			Payload: JSON object with the name of the phase (phase), e.g. "Tally".
+			Response: Confirmation text. Phases that have passed are answered with status 409.
+		*/
+	} else if adminId, ok := util.GetSuffix(path, "/phase/"); ok {
+		s.servePhase(ctx, w, req, adminId)
+		/*
+			/templates (HTTP GET):
+
+			Description: List the election templates saved on the server (see TemplateService). Requires the server password if one is set.
+			Response: JSON array of the names of the templates, sorted.
+		*/
+	} else if path == "/templates" {
+		s.serveTemplates(w, req)
+		/*
+			/template/{name} (HTTP GET, PUT and DELETE):
+
+			Description: Read, save or delete an election template, reusable setup params for recurring elections.
+				Requires the server password if one is set.
+			Parameters: name - The name of the template.
+			Query: from - Optional on PUT; the admin ID of an election whose setup params are saved instead of the payload.
+			PUT Payload: JSON setup parameters (ElectionSetupParams); the admin ID is not kept.
+			GET Response: JSON setup parameters of the template (ElectionSetupParams).
+			PUT and DELETE Response: Confirmation text.
+		*/
+	} else if name, ok := util.GetSuffix(path, "/template/"); ok {
+		s.serveTemplate(w, req, name)
+		/*
+			/clone (HTTP POST):
+
+			Description: Create an election from a template or a past election with new dates, see CloneParams.
+				Requires the server password if one is set.
+			Payload: JSON object with the template (template) or the admin ID of the election (from) to clone, the new
+				vote start (voteStart) and optionally the admin ID (adminId), title (title) and other dates of the clone.
+			Response: JSON object with the admin ID of the new election (adminId), whose setup follows as for /create.
+		*/
+	} else if path == "/clone" {
+		s.serveClone(ctx, w, req)
+		/*
+			/voters/{adminId} (HTTP POST):
+
+			Description: Add voters missed at setup to the eligibility list while the registration is open, with an
+				organizer-signed eligibility update merged by the clients. Requires the server password if one is set.
+			Parameters: adminId - The admin ID associated with the election setup.
+			Payload: JSON object with the public keys of the voters (keys); keys already eligible are skipped.
+			Response: JSON object with the number of voters added (added).
+		*/
+	} else if adminId, ok := util.GetSuffix(path, "/voters/"); ok {
+		s.serveVoters(ctx, w, req, adminId)
+		/*
+			/quarantine (HTTP GET):
+
+			Description: List the posted messages that were rejected because they could not be read or failed verification,
+				for auditors investigating attacks. Requires the server password if one is set.
+			Query: since - Optional Unix time; only messages rejected from then on are listed.
+			Query: election - Optional backend ID; only messages posted to that election are listed.
+			Response: JSON array of the rejected messages, oldest first, with the time they were rejected (time),
+				the election and address they were posted from (source), the reason (reason) and the base64-encoded raw bytes (data).
+		*/
+	} else if path == "/quarantine" {
+		if req.Method != http.MethodGet {
+			respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if !s.authorized(w, req) {
+			return
+		}
+		s.serveQuarantine(w, req)
+
+		/*
+			/countdown/{backendId} (HTTP GET):
+
+			Description: Get the current phase of an election and the time left until the next phase boundary, by the server's clock.
+				Private elections require their access token (see AccessTokenService).
+			Parameters: backendId - The backend ID associated with the election.
+			Response: JSON object (voting.PhaseCountdown) with the phase and next phase names (phase, nextPhase),
+				the Unix time at which the next phase starts (deadline), the seconds remaining until then (remaining),
+				and during registration the seconds left to register (registrationOpen, registrationRemaining).
+				Deadlines are omitted once the election ended.
+		*/
+	} else if backendId, ok := util.GetSuffix(path, "/countdown/"); ok {
+		if req.Method != http.MethodGet {
+			respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if !s.allowedAccess(w, req, backendId) {
+			return
+		}
+		election, err := s.srv.Election(backendId)
+		if err == errNotFound {
+			respondError(w, 404, err)
+			return
+		} else if err != nil {
+			respondError(w, 500, err)
+			return
+		}
+		respondJson(w, election.Countdown())
+
+		/*
+			/result/{backendId} (HTTP GET):
+
+			Description: Get the final result of an election once it ended. Private elections require their access token (see AccessTokenService).
+			Parameters: backendId - The backend ID associated with the election.
+			Response: Canonical JSON encoding of the result (voting.ResultExport), which result certifications sign over.
+				Its hash with the hash scheme of the election is returned in the Pebble-Result-Hash header, hex-encoded.
+				Elections that have not ended are answered with status 409.
+		*/
+	} else if backendId, ok := util.GetSuffix(path, "/result/"); ok {
+		if req.Method != http.MethodGet {
+			respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if !s.allowedAccess(w, req, backendId) {
+			return
+		}
+		election, err := s.srv.Election(backendId)
+		if err != nil {
+			respondError(w, 500, err)
+			return
+		}
+		prog, err := election.Progress(ctx)
+		if err != nil {
+			respondError(w, 500, err)
+			return
+		}
+		export, err := election.ExportResult(prog)
+		if err != nil {
+			respondError(w, 409, err)
+			return
+		}
+		hash := election.TallyHash(prog)
+		body := export.CanonicalJSON()
+		w.Header().Add("Content-Type", "application/json")
+		w.Header().Add("Content-Length", strconv.Itoa(len(body)))
+		w.Header().Add("Pebble-Result-Hash", hex.EncodeToString(hash[:]))
+		w.WriteHeader(200)
+		w.Write(body)
+
+		/*
+			/report/{backendId} (HTTP GET):
+
+			Description: Get the summary report of an election, for publication alongside its result.
+				Private elections require their access token (see AccessTokenService).
+			Parameters: backendId - The backend ID associated with the election.
+			Response: JSON object (voting.ElectionReport) with the params, schedule, turnout, message counts
+				by phase and type, the result and its certifications once the election ended, and the anomalies found.
+		*/
+	} else if backendId, ok := util.GetSuffix(path, "/report/"); ok {
+		if req.Method != http.MethodGet {
+			respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if !s.allowedAccess(w, req, backendId) {
+			return
+		}
+		election, err := s.srv.Election(backendId)
+		if err != nil {
+			respondError(w, 500, err)
+			return
+		}
+		report, err := election.Report(ctx)
+		if err != nil {
+			respondError(w, 500, err)
+			return
+		}
+		respondJson(w, report)
+
+		/*
+			/eligibility/{backendId} (HTTP GET):
+
+			Description: Get the full eligibility list of an election, or the inclusion proof of a voter.
+				Private elections require their access token (see AccessTokenService).
+			Parameters: backendId - The backend ID associated with the election.
+			Query: key - Optional hex-encoded public key hash of the voter.
+			Response: Byte slice representing the serialized eligibility list, or the serialized inclusion proof if key is set.
+		*/
+	} else if backendId, ok := util.GetSuffix(path, "/eligibility/"); ok {
+		if req.Method != http.MethodGet {
+			respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if !s.allowedAccess(w, req, backendId) {
+			return
+		}
+		election, err := s.srv.Election(backendId)
+		if err != nil {
+			respondError(w, 500, err)
+			return
+		}
+		provider, ok := election.Channel().(voting.EligibilityProvider)
+		if !ok {
+			respondErrorCode(w, 404, util.ErrorNotFound, "Eligibility list not available")
+			return
+		}
+		var body []byte
+		if key := req.URL.Query().Get("key"); key != "" {
+			var pkh util.HashValue
+			b, err := hex.DecodeString(key)
+			if err != nil || len(b) != len(pkh) {
+				respondErrorCode(w, 400, util.ErrorInvalidRequest, "Invalid key hash")
+				return
+			}
+			copy(pkh[:], b)
+			proof, err := provider.EligibilityProof(ctx, pkh)
+			if err != nil {
+				respondError(w, 404, err)
+				return
 			}
+			body = proof.Bytes()
 		} else {
-			respondText(w, 405, "Method not allowed")
+			list, err := provider.EligibilityList(ctx)
+			if err != nil {
+				respondError(w, 500, err)
+				return
+			}
+			body = list.Bytes()
+		}
+		w.Header().Add("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(200)
+		w.Write(body)
+
+		/*
+			/inclusion/{backendId} (HTTP GET):
+
+			Description: Prove that a message is on the board of an election, against a checkpoint of its
+				current log signed by the organizer (see voting.InclusionProof).
+				Private elections require their access token (see AccessTokenService).
+			Parameters: backendId - The backend ID associated with the election.
+			Query: id - Hex-encoded message ID (see voting.Message.Id).
+			Response: Byte slice representing the serialized inclusion proof.
+				Unknown messages, and services that do not prove inclusion, are answered with status 404.
+		*/
+	} else if backendId, ok := util.GetSuffix(path, "/inclusion/"); ok {
+		if req.Method != http.MethodGet {
+			respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if !s.allowedAccess(w, req, backendId) {
+			return
+		}
+		inclusionSrv, ok := s.srv.(InclusionService)
+		if !ok {
+			respondErrorCode(w, 404, util.ErrorNotFound, "Inclusion proofs not available")
+			return
+		}
+		var id voting.MessageID
+		b, err := hex.DecodeString(req.URL.Query().Get("id"))
+		if err != nil || len(b) != len(id) {
+			respondErrorCode(w, 400, util.ErrorInvalidRequest, "Invalid message ID")
+			return
+		}
+		copy(id[:], b)
+		proof, err := inclusionSrv.InclusionProof(ctx, backendId, id)
+		if err == errNotFound || err == voting.ErrMessageNotFound {
+			respondError(w, 404, err)
+			return
+		} else if err == voting.ErrCheckpointUnsigned {
+			respondErrorCode(w, 404, util.ErrorNotFound, err.Error())
+			return
+		} else if err != nil {
+			respondError(w, 500, err)
+			return
 		}
+		body := proof.Bytes()
+		w.Header().Add("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(200)
+		w.Write(body)
+
+		/*
+			/invite/{adminId} (HTTP GET and POST):
+
+			Description: Invite voters of an election by email, or list the invitations.
+			Parameters: adminId - The admin ID associated with the election setup.
+			POST Payload: JSON object with the list of email addresses to invite (emails).
+			POST Response: JSON object with the number of links sent and the addresses that could not be mailed.
+			GET Response: JSON array of invitations (InviteStatus) with their redemption status.
+		*/
+	} else if adminId, ok := util.GetSuffix(path, "/invite/"); ok {
+		invSrv, ok := s.srv.(InvitationService)
+		if !ok || !s.create {
+			respondErrorCode(w, http.StatusForbidden, util.ErrorForbidden, "Server does not issue invitations")
+			return
+		}
+		if !s.authorized(w, req) {
+			return
+		}
+		if req.Method == http.MethodGet {
+			statuses, err := invSrv.Invitations(adminId)
+			if err != nil {
+				respondError(w, 404, err)
+				return
+			}
+			respondJson(w, statuses)
+			return
+		} else if req.Method != http.MethodPost {
+			respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if s.mailer == nil {
+			respondError(w, 503, errNoMailer)
+			return
+		}
+		var payload struct {
+			Emails []string `json:"emails"`
+		}
+		err := decodeJson(req.Body, &payload)
+		if err != nil {
+			respondError(w, 400, err)
+			return
+		}
+		invites, err := invSrv.Invite(adminId, payload.Emails)
+		if err != nil {
+			respondError(w, 400, err)
+			return
+		}
+		var resp struct {
+			Sent   int      `json:"sent"`
+			Failed []string `json:"failed,omitempty"`
+		}
+		for _, inv := range invites {
+			body := "You are invited to vote. Open the following single-use link to register your voting key:\n\n" + s.linkBase + inv.Token
+			if s.mailer.Send(inv.Email, "Voter registration", body) != nil {
+				resp.Failed = append(resp.Failed, inv.Email)
+			} else {
+				resp.Sent++
+			}
+		}
+		respondJson(w, resp)
+
+		/*
+			/redeem/{token} (HTTP POST):
+
+			Description: Redeem a single-use registration link, adding the voter key to the eligibility list.
+			Parameters: token - The token of the registration link.
+			Payload: JSON object with the public key of the voter (key).
+			Response: JSON object with the backend ID of the election and the hex-encoded key hash.
+		*/
+	} else if token, ok := util.GetSuffix(path, "/redeem/"); ok {
+		if req.Method != http.MethodPost {
+			respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+			return
+		}
+		invSrv, ok := s.srv.(InvitationService)
+		if !ok {
+			respondErrorCode(w, 404, util.ErrorNotFound, "Server does not issue invitations")
+			return
+		}
+		var payload struct {
+			Key string `json:"key"`
+		}
+		err := decodeJson(req.Body, &payload)
+		if err != nil {
+			respondError(w, 400, err)
+			return
+		}
+		key, err := pubkey.Parse(payload.Key)
+		if err != nil {
+			respondError(w, 400, err)
+			return
+		}
+		backendId, err := invSrv.Redeem(ctx, token, key)
+		if err == errInvalidToken {
+			respondError(w, 403, err)
+			return
+		} else if err != nil {
+			respondError(w, 409, err)
+			return
+		}
+		pkh := util.Hash(key)
+		var resp struct {
+			BackendId string `json:"backendId"`
+			KeyHash   string `json:"keyHash"`
+		}
+		resp.BackendId = backendId
+		resp.KeyHash = hex.EncodeToString(pkh[:])
+		respondJson(w, resp)
 
 	} else if depthStr, ok := util.GetSuffix(path, "/user-init/"); ok {
 		if req.Method != http.MethodGet {
-			respondText(w, http.StatusMethodNotAllowed, "Method not allowed")
+			respondErrorCode(w, http.StatusMethodNotAllowed, util.ErrorMethodNotAllowed, "Method not allowed")
 			return
 		}
 
 		depth, err := strconv.Atoi(depthStr)
 		if err != nil {
-			respondText(w, 400, fmt.Sprintf("Invalid depth value: %v", err))
+			respondErrorCode(w, 400, util.ErrorInvalidRequest, fmt.Sprintf("Invalid depth value: %v", err))
 			return
 		}
 		// // Read the parameters from file
 		// params, err := ioutil.ReadFile("anoncred1-params.bin")
 		// if err != nil {
-		// 	respondText(w, 500, fmt.Sprintf("Failed to read parameters file: %v", err))
+		// 	respondErrorCode(w, 500, util.ErrorInternal, fmt.Sprintf("Failed to read parameters file: %v", err))
 		// 	return
 		// }
 
@@ -344,7 +1288,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 		err = credSys.SetupCircuit(depth)
 		if err != nil {
-			respondText(w, 500, fmt.Sprintf("Failed to setup circuit: %v", err))
+			respondErrorCode(w, 500, util.ErrorInternal, fmt.Sprintf("Failed to setup circuit: %v", err))
 			return
 		}
 
@@ -352,13 +1296,13 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 		pkBytes, err := credSys.ProvingKeyToBytes()
 		if err != nil {
-			respondText(w, 500, fmt.Sprintf("Failed to serialize ProvingKey: %v", err))
+			respondErrorCode(w, 500, util.ErrorInternal, fmt.Sprintf("Failed to serialize ProvingKey: %v", err))
 			return
 		}
 
 		vkBytes, err := credSys.VerifyingKeyToBytes()
 		if err != nil {
-			respondText(w, 500, fmt.Sprintf("Failed to serialize VerifyingKey: %v", err))
+			respondErrorCode(w, 500, util.ErrorInternal, fmt.Sprintf("Failed to serialize VerifyingKey: %v", err))
 			return
 		}
 
@@ -381,7 +1325,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		// Convert the struct to JSON
 		jsonKeys, err := json.Marshal(keys)
 		if err != nil {
-			respondText(w, 500, fmt.Sprintf("Failed to serialize keys to JSON: %v", err))
+			respondErrorCode(w, 500, util.ErrorInternal, fmt.Sprintf("Failed to serialize keys to JSON: %v", err))
 			return
 		}
 
@@ -393,7 +1337,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		w.Write(jsonKeys)
 
 	} else {
-		respondText(w, 404, "Endpoint not found --> Default handler")
+		respondErrorCode(w, 404, util.ErrorNotFound, "Endpoint not found --> Default handler")
 	}
 }
 
@@ -409,6 +1353,6 @@ func (s *Server) authorized(w http.ResponseWriter, req *http.Request) bool {
 		}
 	}
 	w.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
-	respondText(w, http.StatusUnauthorized, "Unauthorized")
+	respondErrorCode(w, http.StatusUnauthorized, util.ErrorUnauthorized, "Unauthorized")
 	return false
 }
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+)
+
+// Returns setup params of an election voting in an hour, for an hour.
+func testSetupParams(adminId string) ElectionSetupParams {
+	start := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+	return ElectionSetupParams{
+		AdminId:   adminId,
+		Title:     "Title",
+		VoteStart: start.Format(time.RFC3339),
+		VoteEnd:   start.Add(time.Hour).Format(time.RFC3339),
+		Method:    "Plurality",
+		Choices:   []string{"Yes", "No"},
+	}
+}
+
+// Sends a request to the server, with the access token if not nil, and returns the response.
+func testRequest(t *testing.T, s *Server, method, path string, body interface{}, token []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	if token != nil {
+		req.Header.Set(voting.AccessTokenHeader, hex.EncodeToString(token))
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+// Creates an election and waits for its setup, returning its backend ID.
+func testCreate(t *testing.T, s *Server, spar ElectionSetupParams) string {
+	t.Helper()
+	if w := testRequest(t, s, http.MethodPost, "/create", spar, nil); w.Code != 200 {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	for i := 0; i < 1000; i++ {
+		var info struct {
+			Status    string `json:"status"`
+			Message   string `json:"message"`
+			BackendId string `json:"backendId"`
+		}
+		w := testRequest(t, s, http.MethodGet, "/setup/"+spar.AdminId, nil, nil)
+		if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+			t.Fatal(err)
+		}
+		switch info.Status {
+		case "Done":
+			return info.BackendId
+		case "InProgress":
+			time.Sleep(time.Millisecond)
+		default:
+			t.Fatalf("setup %s: %s", info.Status, info.Message)
+		}
+	}
+	t.Fatal("setup not done")
+	return ""
+}
+
+func newTestServer(t *testing.T) *Server {
+	credSys := new(anoncred.AnonCred1)
+	if err := credSys.SetupCircuit(2); err != nil {
+		t.Fatal(err)
+	}
+	return NewMockServer("http://localhost", nil, voting.WithCredentialSystem(credSys))
+}
+
+func TestAccessToken(t *testing.T) {
+	s := newTestServer(t)
+	spar := testSetupParams("private")
+	spar.Private = true
+	backendId := testCreate(t, s, spar)
+	token := s.srv.(AccessTokenService).AccessToken(backendId)
+	if token == nil {
+		t.Fatal("private election without an access token")
+	}
+	for _, path := range []string{"/params/", "/messages/", "/election/", "/countdown/", "/eligibility/"} {
+		if w := testRequest(t, s, http.MethodGet, path+backendId, nil, nil); w.Code != http.StatusForbidden {
+			t.Errorf("%s without a token: %d", path, w.Code)
+		}
+		if w := testRequest(t, s, http.MethodGet, path+backendId, nil, []byte("wrong")); w.Code != http.StatusForbidden {
+			t.Errorf("%s with a wrong token: %d", path, w.Code)
+		}
+		if w := testRequest(t, s, http.MethodGet, path+backendId, nil, token); w.Code != 200 {
+			t.Errorf("%s with the token: %d %s", path, w.Code, w.Body)
+		}
+	}
+	public := testCreate(t, s, testSetupParams("public"))
+	if w := testRequest(t, s, http.MethodGet, "/countdown/"+public, nil, nil); w.Code != 200 {
+		t.Errorf("countdown of a public election: %d", w.Code)
+	}
+	if w := testRequest(t, s, http.MethodGet, "/countdown/unknown", nil, nil); w.Code != 404 {
+		t.Errorf("countdown of an unknown election: %d", w.Code)
+	}
+
+	// Listing a private election would publish its token with the invitation
+	s.SetDiscovery(true)
+	listed := testSetupParams("listed")
+	listed.Public, listed.Private = true, true
+	if w := testRequest(t, s, http.MethodPost, "/create", listed, nil); w.Code == 200 {
+		t.Error("created a public private election")
+	}
+	var elections []PublicElection
+	if err := json.Unmarshal(testRequest(t, s, http.MethodGet, "/elections", nil, nil).Body.Bytes(), &elections); err != nil {
+		t.Fatal(err)
+	}
+	if len(elections) != 0 {
+		t.Errorf("listed %+v", elections)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	s := newTestServer(t)
+	s.SetLimits(Limits{MaxChoices: 2, MaxVoters: 1, MaxSchedule: 3 * time.Hour, MaxVdfDifficulty: 1000})
+	choices := testSetupParams("choices")
+	choices.Choices = append(choices.Choices, "Maybe")
+	voters := testSetupParams("voters")
+	voters.Voters = []ElectionSetupVoter{{Id: "a"}, {Id: "b"}}
+	schedule := testSetupParams("schedule")
+	schedule.VoteEnd = time.Now().Add(4 * time.Hour).UTC().Format(time.RFC3339)
+	difficulty := testSetupParams("difficulty")
+	difficulty.VdfDifficulty = "2000"
+	for _, c := range []struct {
+		limit string
+		spar  ElectionSetupParams
+	}{{"choices", choices}, {"voters", voters}, {"schedule", schedule}, {"vdfDifficulty", difficulty}} {
+		w := testRequest(t, s, http.MethodPost, "/create", c.spar, nil)
+		var env util.ErrorEnvelope
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != 400 || env.Error.Code != util.ErrorLimitExceeded || env.Error.Limit != c.limit {
+			t.Errorf("%s limit: %d %+v", c.limit, w.Code, env.Error)
+		}
+		if s.srv.Setup(c.spar.AdminId).Status != SetupError {
+			t.Errorf("%s limit: election created", c.limit)
+		}
+	}
+	testCreate(t, s, testSetupParams("within"))
+	// The difficulty only counts against the limit
+	if params, err := difficulty.Params(); err != nil || params.MaxVdfDifficulty != 0 {
+		t.Errorf("VDF difficulty set in the params: %v", err)
+	}
+}
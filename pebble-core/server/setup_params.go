@@ -1,32 +1,108 @@
 package server
 
 import (
+	"encoding/hex"
+	"errors"
 	"time"
 
 	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/trustee"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
 )
 
+// Public elections are listed with their invitation, which would hand out the access token of a private one.
+var ErrPublicPrivate = errors.New("pebble: an election cannot be both public and private")
+
 type ElectionSetupVoter struct {
 	Id  string `json:"id"`
 	Key string `json:"key"`
 }
 
+// MethodParams is the opaque, method-specific parameters blob (base64 in JSON).
+type ElectionSetupContest struct {
+	Title        string   `json:"title"`
+	Method       string   `json:"method"`
+	MethodParams []byte   `json:"methodParams,omitempty"`
+	Choices      []string `json:"choices"`
+}
+
+// The texts of an election in another language, see voting.Translation.
+type ElectionSetupTranslation struct {
+	Language    string                            `json:"language"`
+	Title       string                            `json:"title,omitempty"`
+	Description string                            `json:"description,omitempty"`
+	Choices     []string                          `json:"choices,omitempty"`
+	Contests    []ElectionSetupContestTranslation `json:"contests,omitempty"`
+}
+
+type ElectionSetupContestTranslation struct {
+	Title   string   `json:"title,omitempty"`
+	Choices []string `json:"choices,omitempty"`
+}
+
 type ElectionSetupParams struct {
-	AdminId       string               `json:"adminId"`
-	Title         string               `json:"title"`
-	Description   string               `json:"description"`
-	VoteStart     string               `json:"voteStart"`
-	VoteEnd       string               `json:"voteEnd"`
-	VdfDifficulty string               `json:"vdfDifficulty"`
-	Method        string               `json:"method"`
-	Choices       []string             `json:"choices"`
-	Voters        []ElectionSetupVoter `json:"voters"`
+	AdminId       string                 `json:"adminId"`
+	Title         string                 `json:"title"`
+	Description   string                 `json:"description"`
+	RegStart      string                 `json:"registrationStart,omitempty"`
+	RegEnd        string                 `json:"registrationEnd,omitempty"`
+	VoteStart     string                 `json:"voteStart"`
+	VoteEnd       string                 `json:"voteEnd"`
+	VdfDifficulty string                 `json:"vdfDifficulty"`
+	Method        string                 `json:"method"`
+	MethodParams  []byte                 `json:"methodParams,omitempty"`
+	Choices       []string               `json:"choices"`
+	Contests      []ElectionSetupContest `json:"contests,omitempty"`
+	Voters        []ElectionSetupVoter   `json:"voters"`
+	// Publish only the Merkle root of the eligibility list in the params;
+	// the full list and inclusion proofs are served separately.
+	MerkleEligibility bool `json:"merkleEligibility,omitempty"`
+	// Serialized trustee.KeySet (base64 in JSON) enabling threshold decryption of ballots,
+	// with hybrid post-quantum keys if dealt with trustee.DealHybrid.
+	Trustees []byte `json:"trustees,omitempty"`
+	// Hash algorithm of the election, "sha256" or "blake3", enabling domain-separated hashing.
+	HashAlgorithm string `json:"hashAlgorithm,omitempty"`
+	// Cipher suite of the ballots, "aes-gcm" or "xchacha20-poly1305", the former by default.
+	CipherSuite string `json:"cipherSuite,omitempty"`
+	// Leading zero bits of the proof of work required to post each message, limiting spam on open servers.
+	PowDifficulty uint8 `json:"powDifficulty,omitempty"`
+	// URL and hex SHA-256 hash of the anoncred1 parameters of the election, downloaded by the clients.
+	CredentialParamsURL  string `json:"credentialParamsUrl,omitempty"`
+	CredentialParamsHash string `json:"credentialParamsHash,omitempty"`
+	// List the election at /elections, on servers with discovery enabled.
+	Public bool `json:"public,omitempty"`
+	// Require the access token carried by the invitation to read the election.
+	Private bool `json:"private,omitempty"`
+	// Texts of the election in other languages, keyed by BCP 47 tags.
+	Translations []ElectionSetupTranslation `json:"translations,omitempty"`
+	// Show the choices to each voter in a different order, mitigating the bias towards the first choices.
+	RandomizeChoices bool `json:"randomizeChoices,omitempty"`
+}
+
+// Builds the full eligibility list from the voters, hashing their keys with the hash algorithm
+// of the election. Voters with invalid keys are skipped.
+func (sp *ElectionSetupParams) eligibilityList() *structs.EligibilityList {
+	list := structs.NewEligibilityList()
+	if alg, err := util.ParseHashAlgorithm(sp.HashAlgorithm); err == nil {
+		list = structs.NewEligibilityListWithAlgorithm(alg)
+	}
+	for _, voter := range sp.Voters {
+		pk, err := pubkey.Parse(voter.Key)
+		if err != nil {
+			continue
+		}
+		idCom := util.Hash([]byte(voter.Id))
+		list.Add(list.HashKey(pk), idCom)
+	}
+	return list
 }
 
 func (sp *ElectionSetupParams) Params() (*voting.ElectionParams, error) {
+	if sp.Public && sp.Private {
+		return nil, ErrPublicPrivate
+	}
 	castStart, err := time.Parse(time.RFC3339, sp.VoteStart)
 	if err != nil {
 		return nil, err
@@ -37,7 +113,7 @@ func (sp *ElectionSetupParams) Params() (*voting.ElectionParams, error) {
 	}
 	tallyEnd := tallyStart.Add(tallyStart.Sub(castStart) * 100)
 	ep := &voting.ElectionParams{
-		Version:         0,
+		Version:         voting.ParamsVersion0,
 		CastStart:       castStart,
 		TallyStart:      tallyStart,
 		TallyEnd:        tallyEnd,
@@ -45,15 +121,104 @@ func (sp *ElectionSetupParams) Params() (*voting.ElectionParams, error) {
 		Description:     sp.Description,
 		VotingMethod:    sp.Method,
 		Choices:         sp.Choices,
-		EligibilityList: structs.NewEligibilityList(),
+		EligibilityList: sp.eligibilityList(),
 	}
-	for _, voter := range sp.Voters {
-		pk, err := pubkey.Parse(voter.Key)
+	if sp.RegStart != "" || sp.RegEnd != "" {
+		ep.Version = voting.ParamsVersion1
+		ep.CredGenStart = time.Now()
+		ep.RegistrationEnd = castStart
+		if sp.RegStart != "" {
+			ep.CredGenStart, err = time.Parse(time.RFC3339, sp.RegStart)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if sp.RegEnd != "" {
+			ep.RegistrationEnd, err = time.Parse(time.RFC3339, sp.RegEnd)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	hasMethodParams := len(sp.MethodParams) != 0
+	for _, c := range sp.Contests {
+		ep.Contests = append(ep.Contests, voting.Contest{
+			Title:        c.Title,
+			VotingMethod: c.Method,
+			MethodParams: c.MethodParams,
+			Choices:      c.Choices,
+		})
+		hasMethodParams = hasMethodParams || len(c.MethodParams) != 0
+	}
+	if hasMethodParams {
+		ep.Version = voting.ParamsVersion4
+		ep.MethodParams = sp.MethodParams
+	} else if len(sp.Contests) != 0 {
+		ep.Version = voting.ParamsVersion3
+	}
+	if len(sp.Trustees) != 0 {
+		ep.Version = voting.ParamsVersion5
+		ep.Trustees = new(trustee.KeySet)
+		err = ep.Trustees.FromBytes(sp.Trustees)
 		if err != nil {
-			continue
+			return nil, err
 		}
-		idCom := util.Hash([]byte(voter.Id))
-		ep.EligibilityList.Add(util.Hash(pk), idCom)
+	}
+	if sp.HashAlgorithm != "" {
+		ep.Version = voting.ParamsVersion7
+		ep.HashAlgorithm, err = util.ParseHashAlgorithm(sp.HashAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if sp.MerkleEligibility {
+		ep.EligibilityList = ep.EligibilityList.Commitment()
+	}
+	// New elections bind ballot signatures to the election, and derive its ID from the params
+	ep.Upgrade(voting.ParamsVersion11)
+	if sp.PowDifficulty != 0 {
+		ep.PowDifficulty = sp.PowDifficulty
+	}
+	if sp.CipherSuite != "" {
+		ep.CipherSuite, err = structs.ParseCipherSuite(sp.CipherSuite)
+		if err != nil {
+			return nil, err
+		}
+		if ep.CipherSuite != structs.SuiteAESGCM {
+			ep.Upgrade(voting.ParamsVersion12)
+		}
+	}
+	if ep.Trustees != nil && ep.Trustees.HybridKeys != nil {
+		ep.Upgrade(voting.ParamsVersion13)
+	}
+	for _, t := range sp.Translations {
+		tr := voting.Translation{Language: t.Language, Title: t.Title, Description: t.Description, Choices: t.Choices}
+		for _, c := range t.Contests {
+			tr.Contests = append(tr.Contests, voting.ContestTranslation{Title: c.Title, Choices: c.Choices})
+		}
+		ep.Translations = append(ep.Translations, tr)
+	}
+	if len(ep.Translations) != 0 {
+		ep.Upgrade(voting.ParamsVersion15)
+	}
+	if sp.RandomizeChoices {
+		ep.Upgrade(voting.ParamsVersion16)
+		ep.ChoiceOrderSeed, err = util.RandomId()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if sp.CredentialParamsURL != "" {
+		ep.CredentialParamsURL = sp.CredentialParamsURL
+		h, err := hex.DecodeString(sp.CredentialParamsHash)
+		if err != nil || len(h) != len(ep.CredentialParamsHash) {
+			return nil, voting.ErrInvalidCredentialParams
+		}
+		copy(ep.CredentialParamsHash[:], h)
+	}
+	err = ep.Validate()
+	if err != nil {
+		return nil, err
 	}
 	return ep, nil
 }
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/base32c"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+var (
+	errTemplateNotFound = errors.New("pebble: template not found")
+	errTemplateName     = errors.New("pebble: invalid template name")
+	errCloneSource      = errors.New("pebble: clone needs either a template or an election to clone")
+)
+
+/*
+Implemented by election services keeping the setup params of their elections, so that recurring
+votes, such as monthly board meetings, are created from a saved template or a past election
+instead of entering the params and voters again (see CloneParams).
+*/
+type TemplateService interface {
+	// Saves the setup params as the template of the name, replacing any template of that name.
+	SaveTemplate(name string, spar ElectionSetupParams) error
+	// Returns the template of the name.
+	Template(name string) (ElectionSetupParams, error)
+	// Returns the names of the templates, sorted.
+	Templates() []string
+	// Deletes the template of the name.
+	DeleteTemplate(name string) error
+	// Returns the setup params of the election set up with adminId, including retired elections.
+	SetupParams(adminId string) (ElectionSetupParams, error)
+}
+
+/*
+Creates an election from a template or from the election set up with the admin ID From, with the
+same params and voters. The dates of the source move by the offset of the vote start, keeping the
+length of each phase, unless they are given. The admin ID is generated if not set.
+*/
+type CloneParams struct {
+	AdminId   string `json:"adminId,omitempty"`
+	Template  string `json:"template,omitempty"`
+	From      string `json:"from,omitempty"`
+	Title     string `json:"title,omitempty"`
+	RegStart  string `json:"registrationStart,omitempty"`
+	RegEnd    string `json:"registrationEnd,omitempty"`
+	VoteStart string `json:"voteStart"`
+	VoteEnd   string `json:"voteEnd,omitempty"`
+}
+
+// Reports whether the name can be used in the path of /template/{name}.
+func validTemplateName(name string) bool {
+	return name != "" && len(name) <= 100 && !strings.ContainsAny(name, "/?#%")
+}
+
+// Returns the setup params of the clone of src.
+func (cp *CloneParams) apply(src ElectionSetupParams) (ElectionSetupParams, error) {
+	spar := src
+	start, err := time.Parse(time.RFC3339, cp.VoteStart)
+	if err != nil {
+		return spar, err
+	}
+	srcStart, err := time.Parse(time.RFC3339, src.VoteStart)
+	if err != nil {
+		return spar, err
+	}
+	offset := start.Sub(srcStart)
+	shift := func(date, override string) (string, error) {
+		if override != "" || date == "" {
+			return override, nil
+		}
+		t, err := time.Parse(time.RFC3339, date)
+		if err != nil {
+			return "", err
+		}
+		return t.Add(offset).Format(time.RFC3339), nil
+	}
+	spar.VoteStart = cp.VoteStart
+	if spar.VoteEnd, err = shift(src.VoteEnd, cp.VoteEnd); err != nil {
+		return spar, err
+	}
+	if spar.RegStart, err = shift(src.RegStart, cp.RegStart); err != nil {
+		return spar, err
+	}
+	if spar.RegEnd, err = shift(src.RegEnd, cp.RegEnd); err != nil {
+		return spar, err
+	}
+	if cp.Title != "" {
+		spar.Title = cp.Title
+	}
+	spar.AdminId = cp.AdminId
+	if spar.AdminId == "" {
+		id, err := util.RandomId()
+		if err != nil {
+			return spar, err
+		}
+		spar.AdminId = base32c.Encode(id[:20])
+	}
+	return spar, nil
+}
+
+func (s *mockService) SaveTemplate(name string, spar ElectionSetupParams) error {
+	if !validTemplateName(name) {
+		return errTemplateName
+	}
+	// Validates the params before keeping them
+	if _, err := spar.Params(); err != nil {
+		return err
+	}
+	spar.AdminId = ""
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.templates[name] = spar
+	return nil
+}
+
+func (s *mockService) Template(name string) (ElectionSetupParams, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	spar, ok := s.templates[name]
+	if !ok {
+		return spar, errTemplateNotFound
+	}
+	return spar, nil
+}
+
+func (s *mockService) Templates() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.templates))
+	for name := range s.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *mockService) DeleteTemplate(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.templates[name]; !ok {
+		return errTemplateNotFound
+	}
+	delete(s.templates, name)
+	return nil
+}
+
+func (s *mockService) SetupParams(adminId string) (ElectionSetupParams, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	spar, ok := s.setups[adminId]
+	if !ok {
+		return spar, errNotFound
+	}
+	return spar, nil
+}
+
+// Returns the template service of the server, answering the request with an error if there is none.
+func (s *Server) templateService(w http.ResponseWriter, req *http.Request) (TemplateService, bool) {
+	tmplSrv, ok := s.srv.(TemplateService)
+	if !ok {
+		respondErrorCode(w, 404, util.ErrorNotFound, "Server does not keep templates")
+		return nil, false
+	}
+	if !s.create {
+		respondErrorCode(w, http.StatusForbidden, util.ErrorForbidden, "Server does not create elections")
+		return nil, false
+	}
+	return tmplSrv, s.authorized(w, req)
+}
+
+// Answers /templates, listing the names of the templates.
+func (s *Server) serveTemplates(w http.ResponseWriter, req *http.Request) {
+	tmplSrv, ok := s.templateService(w, req)
+	if !ok {
+		return
+	}
+	if req.Method != http.MethodGet {
+		respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+		return
+	}
+	respondJson(w, tmplSrv.Templates())
+}
+
+// Answers /template/{name}, reading, saving or deleting the template.
+func (s *Server) serveTemplate(w http.ResponseWriter, req *http.Request, name string) {
+	tmplSrv, ok := s.templateService(w, req)
+	if !ok {
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		spar, err := tmplSrv.Template(name)
+		if err != nil {
+			respondError(w, 404, err)
+			return
+		}
+		respondJson(w, spar)
+	case http.MethodPut:
+		var spar ElectionSetupParams
+		var err error
+		if from := req.URL.Query().Get("from"); from != "" {
+			spar, err = tmplSrv.SetupParams(from)
+			if err != nil {
+				respondError(w, 404, err)
+				return
+			}
+		} else if err = decodeJson(req.Body, &spar); err != nil {
+			respondError(w, 400, err)
+			return
+		}
+		err = tmplSrv.SaveTemplate(name, spar)
+		if err != nil {
+			respondError(w, 400, err)
+			return
+		}
+		respondText(w, 200, "Template saved")
+	case http.MethodDelete:
+		err := tmplSrv.DeleteTemplate(name)
+		if err != nil {
+			respondError(w, 404, err)
+			return
+		}
+		respondText(w, 200, "Template deleted")
+	default:
+		respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// Answers /clone, creating an election from a template or a past election.
+func (s *Server) serveClone(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	tmplSrv, ok := s.templateService(w, req)
+	if !ok {
+		return
+	}
+	if req.Method != http.MethodPost {
+		respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var cp CloneParams
+	err := decodeJson(req.Body, &cp)
+	if err != nil {
+		respondError(w, 400, err)
+		return
+	}
+	var src ElectionSetupParams
+	if (cp.Template == "") == (cp.From == "") {
+		respondError(w, 400, errCloneSource)
+		return
+	} else if cp.Template != "" {
+		src, err = tmplSrv.Template(cp.Template)
+	} else {
+		src, err = tmplSrv.SetupParams(cp.From)
+	}
+	if err != nil {
+		respondError(w, 404, err)
+		return
+	}
+	spar, err := cp.apply(src)
+	if err != nil {
+		respondError(w, 400, err)
+		return
+	}
+	err = spar.CheckLimits(s.limits)
+	if err != nil {
+		respondLimitError(w, err)
+		return
+	}
+	err = s.srv.Create(ctx, spar)
+	if err == errExists {
+		respondError(w, 409, err)
+		return
+	} else if err != nil {
+		respondError(w, 500, err)
+		return
+	}
+	if len(s.webhooks) != 0 {
+		go s.watchWebhooks(spar.AdminId)
+	}
+	respondJson(w, struct {
+		AdminId string `json:"adminId"`
+	}{spar.AdminId})
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+)
+
+var (
+	errPhasePassed = errors.New("pebble: election is past the phase")
+	errNoTestClock = errors.New("pebble: election was created outside test mode")
+)
+
+/*
+Implemented by election services able to move their elections to a later phase regardless of
+the time, for staging deployments and demos. Only servers in test mode expose it, see SetTestMode.
+*/
+type PhaseService interface {
+	// Moves the election set up with adminId to the start of the phase, which must not have passed.
+	ForcePhase(ctx context.Context, adminId string, phase voting.ElectionPhase) error
+}
+
+/*
+Sets whether the server runs in test mode, where /phase moves elections to a later phase.
+In mock mode, the elections created from then on run on a clock that /phase advances, which
+also dates the messages they receive. Test mode must not be enabled for real elections.
+*/
+func (s *Server) SetTestMode(enabled bool) {
+	s.testMode = enabled
+	if ms, ok := s.srv.(*mockService); ok {
+		ms.mu.Lock()
+		ms.testMode = enabled
+		ms.mu.Unlock()
+	}
+}
+
+func (s *mockService) ForcePhase(ctx context.Context, adminId string, phase voting.ElectionPhase) error {
+	s.mu.RLock()
+	backendId, ok := s.ids[adminId]
+	election, clock := s.elections[backendId], s.clocks[backendId]
+	s.mu.RUnlock()
+	if !ok {
+		return errNotFound
+	}
+	if clock == nil {
+		return errNoTestClock
+	}
+	// Amendments may have moved the schedule
+	err := election.Refresh(ctx)
+	if err != nil {
+		return err
+	}
+	if phase < election.Phase() {
+		return errPhasePassed
+	}
+	clock.AdvanceTo(election.Params().PhaseStart(phase))
+	return nil
+}
+
+// Answers /phase/{adminId}, moving the election to the phase of the payload.
+func (s *Server) servePhase(ctx context.Context, w http.ResponseWriter, req *http.Request, adminId string) {
+	phaseSrv, ok := s.srv.(PhaseService)
+	if !s.testMode || !ok {
+		respondErrorCode(w, 404, util.ErrorNotFound, "Server is not in test mode")
+		return
+	}
+	if req.Method != http.MethodPost {
+		respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !s.authorized(w, req) {
+		return
+	}
+	var payload struct {
+		Phase string `json:"phase"`
+	}
+	err := decodeJson(req.Body, &payload)
+	if err != nil {
+		respondError(w, 400, err)
+		return
+	}
+	phase, err := voting.ParsePhase(payload.Phase)
+	if err != nil {
+		respondError(w, 400, err)
+		return
+	}
+	err = phaseSrv.ForcePhase(ctx, adminId, phase)
+	if err == errNotFound {
+		respondError(w, 404, err)
+		return
+	} else if err == errPhasePassed || err == errNoTestClock {
+		respondErrorCode(w, 409, util.ErrorWrongPhase, err.Error())
+		return
+	} else if err != nil {
+		respondError(w, 500, err)
+		return
+	}
+	respondText(w, 200, "Election moved to "+phase.String())
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+)
+
+/*
+Implemented by election services adding voters missed at setup to the eligibility list of an
+election while its registration is open, with an organizer-signed eligibility update that every
+client merges into the list (see voting.Election.AddVoters).
+*/
+type VoterService interface {
+	// Adds the keys not eligible yet to the election set up with adminId, and returns how many were added.
+	AddVoters(ctx context.Context, adminId string, keys []pubkey.PublicKey) (int, error)
+}
+
+func (s *mockService) AddVoters(ctx context.Context, adminId string, keys []pubkey.PublicKey) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	backendId, ok := s.ids[adminId]
+	if !ok {
+		return 0, errNotFound
+	}
+	election := s.elections[backendId]
+	before := election.Params().EligibilityList.Len()
+	err := election.AddVoters(ctx, s.organizers[backendId], keys...)
+	if err != nil {
+		return 0, err
+	}
+	return election.Params().EligibilityList.Len() - before, nil
+}
+
+// Answers /voters/{adminId}, adding the posted keys to the eligibility list of the election.
+func (s *Server) serveVoters(ctx context.Context, w http.ResponseWriter, req *http.Request, adminId string) {
+	voterSrv, ok := s.srv.(VoterService)
+	if !ok || !s.create {
+		respondErrorCode(w, http.StatusForbidden, util.ErrorForbidden, "Server does not add voters")
+		return
+	}
+	if !s.authorized(w, req) {
+		return
+	}
+	if req.Method != http.MethodPost {
+		respondErrorCode(w, 405, util.ErrorMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var payload struct {
+		Keys []string `json:"keys"`
+	}
+	err := decodeJson(req.Body, &payload)
+	if err != nil {
+		respondError(w, 400, err)
+		return
+	}
+	keys := make([]pubkey.PublicKey, len(payload.Keys))
+	for i, k := range payload.Keys {
+		keys[i], err = pubkey.Parse(k)
+		if err != nil {
+			respondError(w, 400, err)
+			return
+		}
+	}
+	added, err := voterSrv.AddVoters(ctx, adminId, keys)
+	if err == errNotFound {
+		respondError(w, 404, err)
+		return
+	} else if err == voting.ErrEligibilityUpdateNotAllowed {
+		respondError(w, 409, err)
+		return
+	} else if err != nil {
+		respondError(w, 400, err)
+		return
+	}
+	respondJson(w, struct {
+		Added int `json:"added"`
+	}{added})
+}
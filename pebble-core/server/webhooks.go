@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+)
+
+// Webhook events.
+const (
+	// The election entered the Tally phase: no more ballots are accepted.
+	WebhookTally = "tally"
+	// The election ended, with its final result.
+	WebhookResult = "result"
+)
+
+// Deliveries of a webhook event, including the first one.
+const webhookAttempts = 4
+
+var webhookClient = &http.Client{Timeout: 30 * time.Second}
+
+/*
+A URL notified of election events with JSON POST requests.
+If Secret is set, the request carries the HMAC-SHA256 of the body with the secret,
+hex-encoded in the Pebble-Signature header as sha256=<hmac>.
+*/
+type Webhook struct {
+	URL    string
+	Secret []byte
+}
+
+// Body of webhook requests. Result and TallyHash are only set for the result event.
+type webhookPayload struct {
+	Event      string    `json:"event"`
+	BackendId  string    `json:"backendId"`
+	ElectionId string    `json:"electionId"`
+	Time       time.Time `json:"time"`
+	// Canonical result export, as hashed by the tally hash.
+	Result    json.RawMessage `json:"result,omitempty"`
+	TallyHash string          `json:"tallyHash,omitempty"`
+}
+
+/*
+Sets the webhooks notified when elections created from then on enter the Tally phase and
+when their final result is computed. Failed deliveries are retried a few times, then
+reported to onError if not nil.
+*/
+func (s *Server) SetWebhooks(hooks []Webhook, onError func(err error)) {
+	s.webhooks = hooks
+	s.webhookErr = onError
+}
+
+// Returns the HMAC-SHA256 signature of a webhook body, as sent in the Pebble-Signature header.
+func WebhookSignature(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Waits for the setup of the election to finish, then fires the webhooks on its events.
+func (s *Server) watchWebhooks(adminId string) {
+	ctx := context.Background()
+	var info SetupInfo
+	for info = s.srv.Setup(adminId); info.Status == SetupInProgress; info = s.srv.Setup(adminId) {
+		time.Sleep(time.Second)
+	}
+	if info.Status != SetupDone {
+		return
+	}
+	e, err := s.srv.Election(info.BackendId)
+	if err != nil {
+		s.webhookError(err)
+		return
+	}
+	id := e.Id()
+	payload := webhookPayload{BackendId: info.BackendId, ElectionId: hex.EncodeToString(id[:])}
+	tallied := false
+	for {
+		phase := e.Phase()
+		if phase >= voting.Tally && !tallied {
+			tallied = true
+			payload.Event, payload.Time = WebhookTally, e.Now()
+			s.fireWebhooks(payload)
+		}
+		if phase == voting.End {
+			break
+		}
+		// Amendments may move the deadline while waiting, which is then checked again
+		wait := e.Countdown().Remaining
+		if wait < time.Second {
+			wait = time.Second
+		} else if wait > time.Hour {
+			wait = time.Hour
+		}
+		if s.testMode && wait > time.Second {
+			// The phase may be forced at any time
+			wait = time.Second
+		}
+		time.Sleep(wait)
+	}
+	prog, err := e.Progress(ctx)
+	if err != nil {
+		s.webhookError(err)
+		return
+	}
+	export, err := e.ExportResult(prog)
+	if err != nil {
+		s.webhookError(err)
+		return
+	}
+	hash := e.TallyHash(prog)
+	payload.Event, payload.Time = WebhookResult, e.Now()
+	payload.Result = export.CanonicalJSON()
+	payload.TallyHash = hex.EncodeToString(hash[:])
+	s.fireWebhooks(payload)
+}
+
+// Delivers the payload to every webhook concurrently.
+func (s *Server) fireWebhooks(payload webhookPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		s.webhookError(err)
+		return
+	}
+	for _, h := range s.webhooks {
+		go func(h Webhook) {
+			err := deliverWebhook(h, body)
+			if err != nil {
+				s.webhookError(fmt.Errorf("pebble: webhook %s, %s event of %s: %w", h.URL, payload.Event, payload.BackendId, err))
+			}
+		}(h)
+	}
+}
+
+// Posts the body to the webhook, retrying with a doubling delay until it is accepted with a 2xx status.
+func deliverWebhook(h Webhook, body []byte) (err error) {
+	delay := time.Second
+	for attempt := 0; attempt < webhookAttempts; attempt++ {
+		if attempt != 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if len(h.Secret) != 0 {
+			req.Header.Set("Pebble-Signature", WebhookSignature(h.Secret, body))
+		}
+		var resp *http.Response
+		resp, err = webhookClient.Do(req)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+		err = fmt.Errorf("responded %s", resp.Status)
+	}
+	return err
+}
+
+func (s *Server) webhookError(err error) {
+	if s.webhookErr != nil {
+		s.webhookErr(err)
+	}
+}
@@ -0,0 +1,206 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+var ErrDropped = errors.New("pebble: message dropped by the simulated network")
+
+// A virtual clock, only moving when set. It is the time source of the simulated elections.
+type Clock struct {
+	mu  sync.RWMutex
+	now time.Time
+}
+
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.now
+}
+
+// Moves the clock to t, unless t is before the current time.
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.After(c.now) {
+		c.now = t
+	}
+}
+
+func (c *Clock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Faults of the simulated network between the voters and the broadcast channel.
+type NetworkConfig struct {
+	// Virtual time a posted message takes to reach the channel.
+	Latency time.Duration
+	// Maximum random delay added to the latency of each message, so that messages arrive out of order.
+	Jitter time.Duration
+	// Probability that a post is lost, failing with ErrDropped.
+	DropRate float64
+}
+
+// Counts of the messages posted through the network.
+type NetworkStats struct {
+	Posted, Dropped, Delivered int
+	// Messages delivered but refused by the channel, and the last reason.
+	Rejected  int
+	LastError error
+}
+
+// A message on its way to the channel.
+type flight struct {
+	m   voting.Message
+	due time.Time
+	seq int
+}
+
+/*
+A simulated network in front of a broadcast channel, delaying, dropping and reordering
+the posted messages according to its NetworkConfig. Messages in flight reach the channel
+once the clock passes their arrival time, when the next call goes through the network
+or Deliver is called. Reads are served by the channel without faults.
+*/
+type Network struct {
+	config  NetworkConfig
+	clock   *Clock
+	channel *voting.StoreChannel
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	seq      int
+	inFlight []flight
+	stats    NetworkStats
+}
+
+// Creates a network in front of the channel, drawing its faults from the seed.
+func NewNetwork(config NetworkConfig, clock *Clock, channel *voting.StoreChannel, seed int64) *Network {
+	return &Network{
+		config:  config,
+		clock:   clock,
+		channel: channel,
+		rand:    rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (n *Network) Channel() *voting.StoreChannel {
+	return n.channel
+}
+
+func (n *Network) Stats() NetworkStats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.stats
+}
+
+// Returns the number of messages posted that did not reach the channel yet.
+func (n *Network) InFlight() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.inFlight)
+}
+
+// Posts the messages arrived by the current time of the clock to the channel, in order of arrival.
+func (n *Network) Deliver(ctx context.Context) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.deliver(ctx)
+}
+
+func (n *Network) deliver(ctx context.Context) {
+	now := n.clock.Now()
+	sort.SliceStable(n.inFlight, func(i, j int) bool {
+		a, b := n.inFlight[i], n.inFlight[j]
+		return a.due.Before(b.due) || (a.due.Equal(b.due) && a.seq < b.seq)
+	})
+	i := 0
+	for ; i < len(n.inFlight) && !n.inFlight[i].due.After(now); i++ {
+		n.post(ctx, n.inFlight[i].m)
+	}
+	n.inFlight = n.inFlight[i:]
+}
+
+func (n *Network) post(ctx context.Context, m voting.Message) error {
+	err := n.channel.Post(ctx, m)
+	n.stats.Delivered++
+	if err != nil {
+		n.stats.Rejected++
+		n.stats.LastError = err
+	}
+	return err
+}
+
+// Sends a message, posting it at once if it has no delay.
+func (n *Network) send(ctx context.Context, m voting.Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.deliver(ctx)
+	n.stats.Posted++
+	if n.config.DropRate > 0 && n.rand.Float64() < n.config.DropRate {
+		n.stats.Dropped++
+		return ErrDropped
+	}
+	delay := n.config.Latency
+	if n.config.Jitter > 0 {
+		delay += time.Duration(n.rand.Int63n(int64(n.config.Jitter)))
+	}
+	if delay <= 0 {
+		return n.post(ctx, m)
+	}
+	n.seq++
+	n.inFlight = append(n.inFlight, flight{m: m, due: n.clock.Now().Add(delay), seq: n.seq})
+	return nil
+}
+
+// Returns a broadcast channel going through the network, as seen by one participant.
+func (n *Network) Link() voting.BroadcastChannel {
+	return &link{n}
+}
+
+// A participant's view of the channel behind the network.
+type link struct {
+	n *Network
+}
+
+func (l *link) Id() voting.ElectionID {
+	return l.n.channel.Id()
+}
+
+func (l *link) Params(ctx context.Context) (*voting.ElectionParams, error) {
+	return l.n.channel.Params(ctx)
+}
+
+func (l *link) Get(ctx context.Context) ([]voting.Message, error) {
+	l.n.Deliver(ctx)
+	return l.n.channel.Get(ctx)
+}
+
+func (l *link) Post(ctx context.Context, m voting.Message) error {
+	return l.n.send(ctx, m)
+}
+
+func (l *link) Watch(ctx context.Context) (<-chan voting.Message, error) {
+	return l.n.channel.Watch(ctx)
+}
+
+func (l *link) EligibilityList(ctx context.Context) (*structs.EligibilityList, error) {
+	return l.n.channel.EligibilityList(ctx)
+}
+
+func (l *link) EligibilityProof(ctx context.Context, pkh util.HashValue) (*structs.EligibilityProof, error) {
+	return l.n.channel.EligibilityProof(ctx, pkh)
+}
@@ -0,0 +1,81 @@
+package sim
+
+import (
+	"sync"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/vdf"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/secrets"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+// Secrets of a simulated voter, kept in memory for its single election.
+type voterSecrets struct {
+	mu         sync.Mutex
+	key        pubkey.PrivateKey
+	credential anoncred.SecretCredential
+	ballots    []secrets.BallotRecord
+	solutions  map[string]vdf.VdfSolution
+}
+
+func newVoterSecrets(k pubkey.PrivateKey) *voterSecrets {
+	return &voterSecrets{key: k, solutions: make(map[string]vdf.VdfSolution)}
+}
+
+func (s *voterSecrets) GetPrivateKey() (pubkey.PrivateKey, error) {
+	return s.key, nil
+}
+
+func (s *voterSecrets) GetSecretCredential(sys anoncred.CredentialSystem) (anoncred.SecretCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.credential == nil {
+		sec, err := sys.GenerateSecretCredential()
+		if err != nil {
+			return nil, err
+		}
+		s.credential = sec
+	}
+	return s.credential, nil
+}
+
+func (s *voterSecrets) GetBallot(electionId [32]byte) (structs.SignedBallot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rs := secrets.ElectionBallots(s.ballots, electionId)
+	if len(rs) == 0 {
+		return structs.SignedBallot{}, secrets.ErrNoBallot
+	}
+	return rs[len(rs)-1].Ballot, nil
+}
+
+func (s *voterSecrets) AddBallot(r secrets.BallotRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ballots = append(s.ballots, r)
+	return nil
+}
+
+func (s *voterSecrets) GetBallots() ([]secrets.BallotRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]secrets.BallotRecord(nil), s.ballots...), nil
+}
+
+func (s *voterSecrets) GetVdfSolution(electionId [32]byte, serialNo []byte) (vdf.VdfSolution, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sol, ok := s.solutions[string(serialNo)]
+	if !ok {
+		return vdf.VdfSolution{}, secrets.ErrNoVdfSolution
+	}
+	return sol, nil
+}
+
+func (s *voterSecrets) SetVdfSolution(electionId [32]byte, serialNo []byte, sol vdf.VdfSolution) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.solutions[string(serialNo)] = sol
+	return nil
+}
@@ -0,0 +1,416 @@
+/*
+Package sim runs whole elections in memory, for testing protocol changes end to end in
+seconds: the voters, the organizer and an observer follow a virtual clock instead of
+sleeping through the phases, and reach the broadcast channel through a simulated network
+injecting latency, drops and reordering. The final tally is checked against the
+ballots the voters cast.
+*/
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/methods"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/secrets"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+var (
+	ErrTallyMismatch = errors.New("pebble: tally does not match the ballots cast")
+
+	ErrNoCredentialSystem = errors.New("pebble: no credential system for the simulation")
+	ErrTrusteesRequired   = errors.New("pebble: simulations do not decrypt ballots with trustees")
+
+	errInvalidConfig = errors.New("pebble: invalid simulation config")
+)
+
+// Configures a simulated election. Zero fields take the defaults documented.
+type Config struct {
+	// Number of voters, 1 by default.
+	Voters int
+	// Voters registering without voting, among the Voters.
+	Abstentions int
+	// Voting method and number of choices, Plurality and 3 by default.
+	Method  string
+	Choices int
+	// Virtual length of the registration, voting and tally phases, an hour by default.
+	Registration, Voting, Tally time.Duration
+	// Maximum VDF difficulty of the params, keeping the ballots instant to open when 0.
+	VdfDifficulty uint64
+	// Cipher suite of the ballots, structs.SuiteAESGCM by default.
+	CipherSuite structs.CipherSuite
+	Network     NetworkConfig
+	// Attempts of each operation of a voter failing with ErrDropped, 3 by default.
+	Attempts int
+	// Seed of the choices, the times at which voters act and the network faults.
+	Seed int64
+	// Virtual start of the election, the current time by default.
+	Start time.Time
+	// Credential system of the election, anoncred.AnonCred1Instance by default.
+	CredentialSystem anoncred.CredentialSystem
+	/*
+		Params to simulate instead of a contest of Method and Choices, such as those of a manifest
+		in a dry run. Their schedule follows the simulated phases, their eligibility list lists the
+		voters, and they are signed by the organizer of the simulation. Params with trustees are not
+		supported, and those referencing credential params use CredentialSystem instead.
+	*/
+	Params *voting.ElectionParams
+}
+
+func (c *Config) setDefaults() {
+	if c.Voters == 0 {
+		c.Voters = 1
+	}
+	if c.Method == "" {
+		c.Method = "Plurality"
+	}
+	if c.Choices == 0 {
+		c.Choices = 3
+	}
+	for _, d := range []*time.Duration{&c.Registration, &c.Voting, &c.Tally} {
+		if *d == 0 {
+			*d = time.Hour
+		}
+	}
+	if c.Attempts == 0 {
+		c.Attempts = 3
+	}
+	if c.Start.IsZero() {
+		c.Start = time.Now().Truncate(time.Second)
+	}
+	if c.CredentialSystem == nil {
+		c.CredentialSystem = anoncred.AnonCred1Instance
+	}
+}
+
+// A simulated voter and the choices it votes for.
+type Voter struct {
+	Index int
+	Key   pubkey.PrivateKey
+	// Choices of each contest, Choices being those of the first.
+	Choices  []int
+	Contests [][]int
+	// Whether the voter votes, and whether its ballot was posted and opened.
+	Votes           bool
+	Voted, Revealed bool
+	Election        *voting.Election
+	// Last error of the operations of the voter.
+	Err error
+}
+
+// The outcome of a simulated election.
+type Result struct {
+	Progress *voting.ElectionProgress
+	// Count of each choice of the first contest, and of each contest, among the ballots cast and opened.
+	Expected         []uint64
+	ExpectedContests [][]uint64
+	Network          NetworkStats
+}
+
+// A simulated election.
+type Sim struct {
+	config    Config
+	rand      *rand.Rand
+	Clock     *Clock
+	Network   *Network
+	Params    *voting.ElectionParams
+	Organizer pubkey.PrivateKey
+	Voters    []*Voter
+	// Election of a participant only reading the channel.
+	Observer *voting.Election
+}
+
+/*
+Returns the params of the simulated election, unsigned and without eligibility list: version 11
+params of a contest of Method and Choices, or 12 with another cipher suite, unless Params is set.
+*/
+func (c *Config) params() (*voting.ElectionParams, error) {
+	var params *voting.ElectionParams
+	if c.Params != nil {
+		if c.Params.Trustees != nil {
+			return nil, ErrTrusteesRequired
+		}
+		p := *c.Params
+		p.Upgrade(voting.ParamsVersion11)
+		p.Organizer, p.Signature = nil, nil
+		p.CredentialParamsURL, p.CredentialParamsHash = "", util.HashValue{}
+		params = &p
+	} else {
+		if c.Choices < 2 {
+			return nil, errInvalidConfig
+		}
+		choices := make([]string, c.Choices)
+		for i := range choices {
+			choices[i] = fmt.Sprintf("Choice %d", i+1)
+		}
+		params = &voting.ElectionParams{
+			Version:          voting.ParamsVersion1,
+			Title:            "Simulated election",
+			VotingMethod:     c.Method,
+			Choices:          choices,
+			MaxVdfDifficulty: c.VdfDifficulty,
+		}
+		params.Upgrade(voting.ParamsVersion11)
+		if c.CipherSuite != structs.SuiteAESGCM {
+			params.Upgrade(voting.ParamsVersion12)
+			params.CipherSuite = c.CipherSuite
+		}
+	}
+	params.CredGenStart = c.Start
+	params.RegistrationEnd = c.Start.Add(c.Registration)
+	params.CastStart = params.RegistrationEnd
+	params.TallyStart = params.CastStart.Add(c.Voting)
+	params.TallyEnd = params.TallyStart.Add(c.Tally)
+	return params, nil
+}
+
+/*
+Sets up the election of Config.Params, or of version 11 params, or 12 with another cipher suite,
+signed by a new organizer key, its voters and the network in front of its channel. Every voter
+is eligible, and joins the election through its own link to the network.
+*/
+func New(ctx context.Context, config Config) (*Sim, error) {
+	config.setDefaults()
+	if config.CredentialSystem == nil {
+		return nil, ErrNoCredentialSystem
+	}
+	if config.Abstentions > config.Voters {
+		return nil, errInvalidConfig
+	}
+	params, err := config.params()
+	if err != nil {
+		return nil, err
+	}
+	s := &Sim{
+		config: config,
+		rand:   rand.New(rand.NewSource(config.Seed)),
+		Clock:  NewClock(config.Start),
+	}
+	s.Organizer, err = pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		return nil, err
+	}
+	list := structs.NewEligibilityList()
+	if params.Version >= voting.ParamsVersion7 {
+		list = structs.NewEligibilityListWithAlgorithm(params.HashAlgorithm)
+	}
+	s.Voters = make([]*Voter, config.Voters)
+	for i := range s.Voters {
+		k, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+		if err != nil {
+			return nil, err
+		}
+		v := &Voter{
+			Index: i,
+			Key:   k,
+			Votes: i < config.Voters-config.Abstentions,
+		}
+		for _, c := range params.ContestList() {
+			v.Contests = append(v.Contests, s.randomChoices(c))
+		}
+		v.Choices = v.Contests[0]
+		s.Voters[i] = v
+		list.Add(list.HashKey(k.Public()), [32]byte{})
+	}
+	params.EligibilityList = list
+	if err = params.Validate(); err != nil {
+		return nil, err
+	}
+	if err = params.Sign(s.Organizer); err != nil {
+		return nil, err
+	}
+	s.Params = params
+	channel := voting.NewMockBroadcastChannel(params.ElectionId(voting.ServerNetwork), params)
+	channel.SetTimeSource(s.Clock)
+	s.Network = NewNetwork(config.Network, s.Clock, channel, s.rand.Int63())
+	s.Observer, err = s.join(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range s.Voters {
+		v.Election, err = s.join(ctx, newVoterSecrets(v.Key))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Sim) join(ctx context.Context, sec secrets.SecretsManager) (*voting.Election, error) {
+	return voting.NewElection(ctx, s.Network.Link(), sec,
+		voting.WithTimeSource(s.Clock),
+		voting.WithCredentialSystem(s.config.CredentialSystem),
+		voting.WithCredentialCache(""))
+}
+
+/*
+Picks random choices valid for the method of the contest: one choice, or a non-empty subset
+of at most the maximum number of approvals for approval voting.
+*/
+func (s *Sim) randomChoices(c voting.Contest) []int {
+	n := len(c.Choices)
+	if c.VotingMethod != "Approval" {
+		return []int{s.rand.Intn(n)}
+	}
+	var p methods.ApprovalParams
+	if len(c.MethodParams) != 0 {
+		p.FromBytes(c.MethodParams)
+	}
+	var choices []int
+	for len(choices) == 0 || (p.MaxApprovals != 0 && len(choices) > int(p.MaxApprovals)) {
+		choices = nil
+		for i := 0; i < n; i++ {
+			if s.rand.Intn(2) == 0 {
+				choices = append(choices, i)
+			}
+		}
+	}
+	return choices
+}
+
+// Moves the clock to t and delivers the messages arrived by then.
+func (s *Sim) advance(ctx context.Context, t time.Time) {
+	s.Clock.Set(t)
+	s.Network.Deliver(ctx)
+}
+
+/*
+Runs op for the voters in a random order, each at a random time of the phase from start,
+leaving the last tenth of the phase for the messages in flight. The operations failing
+with ErrDropped are attempted again, up to Config.Attempts times.
+Returns the number of voters whose operation failed.
+*/
+func (s *Sim) runPhase(ctx context.Context, voters []*Voter, start time.Time, length time.Duration, op func(v *Voter) error) int {
+	times := make([]time.Duration, len(voters))
+	if span := int64(length) * 9 / 10; span > 0 {
+		for i := range times {
+			times[i] = time.Duration(s.rand.Int63n(span))
+		}
+	}
+	sort.Slice(times, func(i, j int) bool {
+		return times[i] < times[j]
+	})
+	order := s.rand.Perm(len(voters))
+	failed := 0
+	for i, j := range order {
+		v := voters[j]
+		s.advance(ctx, start.Add(times[i]))
+		var err error
+		for a := 0; a < s.config.Attempts; a++ {
+			if err = op(v); err != ErrDropped {
+				break
+			}
+		}
+		if err != nil {
+			v.Err = err
+			failed++
+		}
+	}
+	return failed
+}
+
+// Posts the credentials of all the voters during registration.
+func (s *Sim) Register(ctx context.Context) int {
+	return s.runPhase(ctx, s.Voters, s.Params.CredGenStart, s.config.Registration, func(v *Voter) error {
+		return v.Election.PostCredential(ctx)
+	})
+}
+
+// Casts the ballots of the voters who vote, from the start of the Cast phase.
+func (s *Sim) Vote(ctx context.Context) int {
+	var voters []*Voter
+	for _, v := range s.Voters {
+		if v.Votes && v.Err == nil {
+			voters = append(voters, v)
+		}
+	}
+	return s.runPhase(ctx, voters, s.Params.CastStart, s.config.Voting, func(v *Voter) error {
+		err := v.Election.VoteContests(ctx, v.Contests)
+		v.Voted = err == nil
+		return err
+	})
+}
+
+// Posts the decryptions of the ballots cast, from the start of the Tally phase.
+func (s *Sim) Reveal(ctx context.Context) int {
+	var voters []*Voter
+	for _, v := range s.Voters {
+		if v.Voted {
+			voters = append(voters, v)
+		}
+	}
+	return s.runPhase(ctx, voters, s.Params.TallyStart, s.config.Tally, func(v *Voter) error {
+		err := v.Election.RevealBallotDecryption(ctx)
+		v.Revealed = err == nil
+		return err
+	})
+}
+
+// Returns the count of each choice of the first contest among the ballots cast and opened.
+func (s *Sim) Expected() []uint64 {
+	return s.ExpectedContests()[0]
+}
+
+// Returns the count of each choice of each contest among the ballots cast and opened.
+func (s *Sim) ExpectedContests() [][]uint64 {
+	contests := s.Params.ContestList()
+	expected := make([][]uint64, len(contests))
+	for i, c := range contests {
+		expected[i] = make([]uint64, len(c.Choices))
+	}
+	for _, v := range s.Voters {
+		if v.Revealed {
+			for i, choices := range v.Contests {
+				for _, c := range choices {
+					expected[i][c]++
+				}
+			}
+		}
+	}
+	return expected
+}
+
+// Runs the election to its end, returning the final progress read by the observer.
+func (s *Sim) Run(ctx context.Context) (*Result, error) {
+	s.Register(ctx)
+	s.Vote(ctx)
+	s.Reveal(ctx)
+	s.advance(ctx, s.Params.TallyEnd)
+	prog, err := s.Observer.Progress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	expected := s.ExpectedContests()
+	return &Result{Progress: &prog, Expected: expected[0], ExpectedContests: expected, Network: s.Network.Stats()}, nil
+}
+
+// Checks that the tally of each contest counts each choice as often as the voters whose ballot was opened chose it.
+func (r *Result) Check() error {
+	tallies, expected := r.Progress.Tallies, r.ExpectedContests
+	if len(tallies) == 0 {
+		tallies, expected = []methods.Tally{r.Progress.Tally}, [][]uint64{r.Expected}
+	}
+	if len(tallies) != len(expected) {
+		return ErrTallyMismatch
+	}
+	for i, tally := range tallies {
+		for _, tc := range tally {
+			if tc.Index == methods.BlankIndex {
+				continue
+			}
+			if tc.Index >= len(expected[i]) || tc.Count != expected[i][tc.Index] {
+				return ErrTallyMismatch
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+package sim
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/methods"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+func TestSim(t *testing.T) {
+	ctx := context.Background()
+	credSys := new(anoncred.AnonCred1)
+	if err := credSys.SetupCircuit(8); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(ctx, Config{
+		Voters:      6,
+		Abstentions: 1,
+		Network: NetworkConfig{
+			Latency:  time.Second,
+			Jitter:   time.Minute,
+			DropRate: 0.2,
+		},
+		Attempts:         10,
+		Seed:             1,
+		CredentialSystem: credSys,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := s.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range s.Voters {
+		if v.Err != nil || v.Revealed != v.Votes {
+			t.Errorf("voter %d: %v", v.Index, v.Err)
+		}
+	}
+	if res.Progress.Count != 5 || len(res.Progress.Rejected) != 0 {
+		t.Errorf("%d ballots counted, %d rejected", res.Progress.Count, len(res.Progress.Rejected))
+	}
+	if err = res.Check(); err != nil {
+		t.Error(err)
+	}
+	if res.Network.Dropped == 0 || s.Network.InFlight() != 0 {
+		t.Errorf("network %+v", res.Network)
+	}
+	// Receipts follow the virtual clock
+	msgs, _ := s.Network.Channel().Get(ctx)
+	if len(msgs) == 0 || msgs[len(msgs)-1].Received.After(s.Params.TallyEnd) {
+		t.Error("messages not received in virtual time")
+	}
+}
+
+func TestSimCipherSuite(t *testing.T) {
+	ctx := context.Background()
+	credSys := new(anoncred.AnonCred1)
+	if err := credSys.SetupCircuit(2); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(ctx, Config{
+		Voters:           2,
+		CipherSuite:      structs.SuiteXChaCha20Poly1305,
+		CredentialSystem: credSys,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := s.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Progress.Count != 2 || len(res.Progress.Rejected) != 0 {
+		t.Errorf("%d ballots counted, %d rejected", res.Progress.Count, len(res.Progress.Rejected))
+	}
+	if err = res.Check(); err != nil {
+		t.Error(err)
+	}
+	msgs, _ := s.Network.Channel().Get(ctx)
+	for _, m := range msgs {
+		if m.SignedBallot != nil && m.SignedBallot.EncryptedBallot.Suite != structs.SuiteXChaCha20Poly1305 {
+			t.Error("ballot not encrypted with the suite of the params")
+		}
+	}
+}
+
+func TestSimParams(t *testing.T) {
+	ctx := context.Background()
+	credSys := new(anoncred.AnonCred1)
+	if err := credSys.SetupCircuit(3); err != nil {
+		t.Fatal(err)
+	}
+	params := &voting.ElectionParams{
+		Version: voting.ParamsVersion3,
+		Title:   "Board meeting",
+		Contests: []voting.Contest{
+			{Title: "Chair", VotingMethod: "Plurality", Choices: []string{"Alice", "Bob"}},
+			{Title: "Motions", VotingMethod: "Approval", MethodParams: methods.ApprovalParams{MaxApprovals: 2}.Bytes(), Choices: []string{"A", "B", "C", "D"}},
+		},
+	}
+	params.Upgrade(voting.ParamsVersion4)
+	s, err := New(ctx, Config{
+		Voters:           5,
+		Abstentions:      1,
+		Registration:     10 * time.Second,
+		Voting:           10 * time.Second,
+		Tally:            10 * time.Second,
+		CredentialSystem: credSys,
+		Params:           params,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Params.Title != "Board meeting" || s.Params.TallyEnd.Sub(s.Params.CredGenStart) != 30*time.Second {
+		t.Errorf("simulated params %+v", s.Params)
+	}
+	for _, v := range s.Voters {
+		if len(v.Contests) != 2 || len(v.Contests[1]) == 0 || len(v.Contests[1]) > 2 {
+			t.Errorf("voter %d chose %v", v.Index, v.Contests)
+		}
+	}
+	res, err := s.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Progress.Count != 4 || len(res.Progress.Tallies) != 2 {
+		t.Errorf("%d ballots counted in %d contests", res.Progress.Count, len(res.Progress.Tallies))
+	}
+	if err = res.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSimSolveBallots(t *testing.T) {
+	ctx := context.Background()
+	credSys := new(anoncred.AnonCred1)
+	if err := credSys.SetupCircuit(2); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(ctx, Config{Voters: 3, VdfDifficulty: 1000, CredentialSystem: credSys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Register(ctx)
+	s.Vote(ctx)
+	// Only the first voter reveals, the solver opens the other ballots
+	s.advance(ctx, s.Params.TallyStart)
+	if err = s.Voters[0].Election.RevealBallotDecryption(ctx); err != nil {
+		t.Fatal(err)
+	}
+	s.advance(ctx, s.Params.TallyStart.Add(time.Minute))
+	unopened, err := s.Observer.UnopenedBallots(ctx)
+	if err != nil || len(unopened) != 2 {
+		t.Fatalf("%d unopened ballots: %v", len(unopened), err)
+	}
+	n, err := s.Observer.SolveBallots(ctx)
+	if err != nil || n != 2 {
+		t.Fatalf("%d ballots solved: %v", n, err)
+	}
+	s.advance(ctx, s.Params.TallyEnd)
+	if unopened, _ = s.Observer.UnopenedBallots(ctx); len(unopened) != 0 {
+		t.Errorf("%d ballots still unopened", len(unopened))
+	}
+	prog, err := s.Observer.Progress(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prog.Count != 3 || len(prog.Rejected) != 0 {
+		t.Errorf("%d ballots counted, %d rejected", prog.Count, len(prog.Rejected))
+	}
+}
+
+type opCounter struct {
+	mu  sync.Mutex
+	ops map[string]int
+}
+
+func (c *opCounter) Start(ctx context.Context, op string) (context.Context, func(error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ops[op]++
+	return ctx, func(error) {}
+}
+
+func (c *opCounter) Add(ctx context.Context, counter string, n int64) {}
+
+func (c *opCounter) Record(ctx context.Context, histogram string, value float64) {}
+
+func TestSimFinalProgress(t *testing.T) {
+	ctx := context.Background()
+	credSys := new(anoncred.AnonCred1)
+	if err := credSys.SetupCircuit(2); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(ctx, Config{Voters: 2, CredentialSystem: credSys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := s.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := &opCounter{ops: make(map[string]int)}
+	voting.WithInstrumentation(ops)(s.Observer)
+	for i := 0; i < 2; i++ {
+		prog, err := s.Observer.Progress(ctx)
+		if err != nil || prog.Count != res.Progress.Count {
+			t.Fatalf("%d ballots counted: %v", prog.Count, err)
+		}
+	}
+	if ops.ops["pebble.progress"] != 2 || ops.ops["pebble.credential_set"] != 0 {
+		t.Errorf("ended election verified again: %v", ops.ops)
+	}
+	// Messages posted after the end invalidate the cached progress
+	batch := voting.Message{DecryptionBatch: &structs.DecryptionBatchMessage{}}
+	if err = s.Network.Channel().Post(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Observer.Progress(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ops.ops["pebble.credential_set"] != 1 {
+		t.Errorf("progress not recomputed: %v", ops.ops)
+	}
+}
+
+func TestSimSyncer(t *testing.T) {
+	ctx := context.Background()
+	credSys := new(anoncred.AnonCred1)
+	if err := credSys.SetupCircuit(2); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(ctx, Config{Voters: 2, CredentialSystem: credSys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Register(ctx)
+	s.Vote(ctx)
+	s.advance(ctx, s.Params.TallyStart)
+	// The syncers reveal the ballots in place of the voters
+	var syncers []*voting.Syncer
+	for _, v := range s.Voters {
+		syncer := voting.NewSyncer(v.Election, voting.SyncConfig{AutoReveal: true})
+		if _, synced, _ := syncer.Progress(); !synced.IsZero() {
+			t.Error("synced before the first sync")
+		}
+		if err = syncer.Sync(ctx); err != nil {
+			t.Fatal(err)
+		}
+		syncers = append(syncers, syncer)
+	}
+	s.advance(ctx, s.Params.TallyStart.Add(time.Minute))
+	if err = syncers[0].Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	prog, synced, err := syncers[0].Progress()
+	if err != nil || !synced.Equal(s.Clock.Now()) {
+		t.Fatalf("last sync at %v: %v", synced, err)
+	}
+	if prog.Phase != voting.Tally || prog.Count != 2 {
+		t.Errorf("%d ballots counted in %v", prog.Count, prog.Phase)
+	}
+}
+
+func TestSimVerifyBallot(t *testing.T) {
+	ctx := context.Background()
+	credSys := new(anoncred.AnonCred1)
+	if err := credSys.SetupCircuit(2); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(ctx, Config{Voters: 2, CredentialSystem: credSys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Register(ctx)
+	e := s.Voters[0].Election
+	v, err := e.VerifyBallot(ctx)
+	if err != nil || v.Recorded || v.TrackingCode != (util.HashValue{}) {
+		t.Fatalf("before voting: %+v, %v", v, err)
+	}
+	s.Vote(ctx)
+	v, err = e.VerifyBallot(ctx)
+	if err != nil || !v.Recorded || !v.ValidSignature || v.Decrypted {
+		t.Fatalf("after voting: %+v, %v", v, err)
+	}
+	s.Reveal(ctx)
+	v, err = e.VerifyBallot(ctx)
+	if err != nil || !v.Decrypted || !v.Counted || v.Rejection != 0 {
+		t.Errorf("after the reveal: %+v, %v", v, err)
+	}
+}
+
+func TestSimAudit(t *testing.T) {
+	ctx := context.Background()
+	credSys := new(anoncred.AnonCred1)
+	if err := credSys.SetupCircuit(2); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(ctx, Config{Voters: 2, CredentialSystem: credSys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := s.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := s.Observer.Audit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, _ := s.Network.Channel().Get(ctx)
+	if report.Result.Valid != res.Progress.Count || report.Messages != len(msgs) {
+		t.Errorf("audited %d ballots in %d messages", report.Result.Valid, report.Messages)
+	}
+	auditor, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = report.Sign(auditor); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(report)
+	var decoded voting.AuditReport
+	if err = json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err = decoded.Verify(); err != nil {
+		t.Error(err)
+	}
+	decoded.Result.Valid++
+	if decoded.Verify() == nil {
+		t.Error("tampered report verified")
+	}
+}
+
+func TestSimReport(t *testing.T) {
+	ctx := context.Background()
+	credSys := new(anoncred.AnonCred1)
+	if err := credSys.SetupCircuit(4); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(ctx, Config{Voters: 3, Abstentions: 1, CredentialSystem: credSys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.Observer.Report(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Phase != "End" || r.Result == nil || r.Certification == nil {
+		t.Fatalf("report %+v", r)
+	}
+	if r.Turnout.Registered != 3 || r.Turnout.Cast != 2 || r.Turnout.Counted != 2 {
+		t.Errorf("turnout %+v", r.Turnout)
+	}
+	if r.MessagesByType["credential"] != 3 || r.MessagesByType["ballot"] != 2 || r.MessagesByPhase["Cast"] != 2 {
+		t.Errorf("messages by type %v, by phase %v", r.MessagesByType, r.MessagesByPhase)
+	}
+	// The simulated organizer does not certify the result
+	if len(r.Anomalies) != 1 || r.Anomalies[0].Kind != "uncertified-result" {
+		t.Errorf("anomalies %+v", r.Anomalies)
+	}
+}
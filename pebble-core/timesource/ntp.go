@@ -0,0 +1,59 @@
+package timesource
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+var ErrInvalidNtpResponse = errors.New("pebble: invalid NTP response")
+
+// Seconds between the NTP epoch (1900) and the Unix epoch (1970).
+const ntpEpochOffset = 2208988800
+
+// Creates a source synchronized with an NTP server, e.g. "pool.ntp.org:123".
+func NewNTP(server string) *Synced {
+	return NewSynced(func(ctx context.Context) (time.Time, time.Duration, error) {
+		return queryNTP(ctx, server)
+	})
+}
+
+// Sends a single SNTP (RFC 4330) client request and returns the server transmit time.
+func queryNTP(ctx context.Context, server string) (time.Time, time.Duration, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+	req := make([]byte, 48)
+	// LI = 0, VN = 4, Mode = 3 (client)
+	req[0] = 0x23
+	_, err = conn.Write(req)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	if n < 48 || resp[0]&7 != 4 || resp[1] == 0 {
+		return time.Time{}, 0, ErrInvalidNtpResponse
+	}
+	secs := binary.BigEndian.Uint32(resp[40:])
+	frac := binary.BigEndian.Uint32(resp[44:])
+	nanos := (int64(frac) * 1e9) >> 32
+	t := time.Unix(int64(secs)-ntpEpochOffset, nanos)
+	// Root dispersion, in NTP short format, bounds the server error.
+	disp := binary.BigEndian.Uint32(resp[8:])
+	uncertainty := time.Duration((int64(disp) * 1e9) >> 16)
+	return t, uncertainty, nil
+}
@@ -0,0 +1,45 @@
+package timesource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Tezos produces a block roughly every BlockInterval; the head timestamp lags real time by up to that much.
+const TezosBlockInterval = 30 * time.Second
+
+/*
+Creates a source following the timestamp of the head block of a Tezos node,
+e.g. "https://mainnet.api.tez.ie". Block timestamps are agreed on by the chain
+and cannot be skewed by a single party, at the cost of block-interval precision.
+*/
+func NewTezosHead(rpcURL string) *Synced {
+	uri := strings.TrimSuffix(rpcURL, "/") + "/chains/main/blocks/head/header"
+	return NewSynced(func(ctx context.Context) (time.Time, time.Duration, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return time.Time{}, 0, fmt.Errorf("pebble: tezos rpc status %d", resp.StatusCode)
+		}
+		var header struct {
+			Timestamp time.Time `json:"timestamp"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&header)
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+		// The head was produced at some point during the last block interval.
+		return header.Timestamp.Add(TezosBlockInterval / 2), TezosBlockInterval / 2, nil
+	})
+}
@@ -0,0 +1,139 @@
+package timesource
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Provides the current time used for election phase decisions.
+type Source interface {
+	Now() time.Time
+}
+
+// The local system clock.
+type System struct{}
+
+func (System) Now() time.Time {
+	return time.Now()
+}
+
+// Returns the time of a remote reference clock, and the uncertainty of the measurement.
+type QueryFunc func(ctx context.Context) (remote time.Time, uncertainty time.Duration, err error)
+
+// Default skew above which Synced reports a warning.
+const DefaultSkewThreshold = 5 * time.Second
+
+/*
+A Source following a remote reference clock.
+Sync measures the offset between the local clock and the reference; Now returns
+the local time corrected by the last measured offset.
+When the offset exceeds SkewThreshold, OnSkew is called (by default a log warning).
+*/
+type Synced struct {
+	query         QueryFunc
+	SkewThreshold time.Duration
+	OnSkew        func(skew time.Duration)
+
+	mu     sync.RWMutex
+	offset time.Duration
+	synced bool
+}
+
+func NewSynced(query QueryFunc) *Synced {
+	return &Synced{
+		query:         query,
+		SkewThreshold: DefaultSkewThreshold,
+		OnSkew: func(skew time.Duration) {
+			log.Printf("pebble: local clock differs from reference time by %v", skew)
+		},
+	}
+}
+
+func (s *Synced) Now() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return time.Now().Add(s.offset)
+}
+
+// Returns the last measured offset of the reference clock relative to the local clock,
+// and whether a measurement succeeded yet.
+func (s *Synced) Offset() (time.Duration, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.offset, s.synced
+}
+
+// Queries the reference clock and updates the offset.
+func (s *Synced) Sync(ctx context.Context) error {
+	start := time.Now()
+	remote, uncertainty, err := s.query(ctx)
+	if err != nil {
+		return err
+	}
+	rtt := time.Since(start)
+	offset := remote.Add(rtt / 2).Sub(time.Now())
+	s.mu.Lock()
+	s.offset = offset
+	s.synced = true
+	s.mu.Unlock()
+	skew := offset
+	if skew < 0 {
+		skew = -skew
+	}
+	if s.OnSkew != nil && s.SkewThreshold > 0 && skew > s.SkewThreshold+uncertainty {
+		s.OnSkew(offset)
+	}
+	return nil
+}
+
+// Syncs every interval until the context is done. Failed syncs keep the previous offset.
+func (s *Synced) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := s.Sync(ctx)
+		if err != nil {
+			log.Printf("pebble: time sync failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+A Source running ahead of a base source, such as to skip the waits of an election in test
+deployments. The offset only grows, so that times read from the source never go backwards.
+*/
+type Shifted struct {
+	base Source
+
+	mu     sync.RWMutex
+	offset time.Duration
+}
+
+func NewShifted(base Source) *Shifted {
+	return &Shifted{base: base}
+}
+
+func (s *Shifted) Now() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.base.Now().Add(s.offset)
+}
+
+// Moves the time forward to t, and returns whether it did: times in the past are ignored.
+func (s *Shifted) AdvanceTo(t time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := t.Sub(s.base.Now().Add(s.offset))
+	if d <= 0 {
+		return false
+	}
+	s.offset += d
+	return true
+}
@@ -0,0 +1,38 @@
+package timesource
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSyncedSkew(t *testing.T) {
+	var reported time.Duration
+	s := NewSynced(func(ctx context.Context) (time.Time, time.Duration, error) {
+		return time.Now().Add(time.Minute), 0, nil
+	})
+	s.OnSkew = func(skew time.Duration) {
+		reported = skew
+	}
+	err := s.Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reported < 59*time.Second {
+		t.Errorf("skew not reported, got %v", reported)
+	}
+	if d := s.Now().Sub(time.Now()); d < 59*time.Second || d > 61*time.Second {
+		t.Errorf("unexpected corrected time offset %v", d)
+	}
+}
+
+func TestShifted(t *testing.T) {
+	s := NewShifted(System{})
+	target := time.Now().Add(time.Hour)
+	if !s.AdvanceTo(target) || s.Now().Before(target) {
+		t.Errorf("time not advanced: %v", s.Now())
+	}
+	if s.AdvanceTo(time.Now()) || s.Now().Before(target) {
+		t.Error("time moved backwards")
+	}
+}
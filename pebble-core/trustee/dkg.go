@@ -0,0 +1,420 @@
+package trustee
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+/*
+Distributed key generation, replacing Deal when no trusted dealer is available
+(joint-Feldman DKG). Each trustee i deals a random polynomial f_i of degree Threshold - 1:
+it publishes the commitments f_i,k·G of its coefficients with a proof of knowledge of f_i,0,
+and the share f_i(j) of each trustee j, encrypted to the encryption key of trustee j.
+Trustees complain about dealers whose share does not match the commitments, revealing the
+decryption key of that share with a proof, so that anyone can check the complaint.
+The dealers with a valid dealing and no justified complaint are qualified: the joint public key
+is the sum of their f_i,0·G, and the share of trustee j is the sum of their f_i(j).
+The joint key may be biased by dishonest dealers, which does not weaken ElGamal encryption;
+its secret stays unknown as long as one qualified dealer is honest.
+*/
+
+const (
+	dealingContext   = "pebble-trustee-dkg-dealing"
+	dkgShareContext  = "pebble-trustee-dkg-share"
+	complaintContext = "pebble-trustee-dkg-complaint"
+
+	// Length of encrypted shares: an ephemeral point and a sealed scalar.
+	encryptedShareLength = PointLength + fr.Bytes + 16
+)
+
+var (
+	ErrInvalidDealing   = errors.New("pebble: invalid trustee dealing")
+	ErrInvalidComplaint = errors.New("pebble: invalid trustee complaint")
+	ErrNotEnoughDealers = errors.New("pebble: not enough qualified trustee dealings")
+)
+
+// Generates the key pair receiving the shares dealt to a trustee.
+func GenerateEncryptionKey() (secret, public []byte, err error) {
+	var x fr.Element
+	if _, err = x.SetRandom(); err != nil {
+		return
+	}
+	p := mul(&g1Gen, &x)
+	b := x.Bytes()
+	return b[:], pointBytes(&p), nil
+}
+
+/*
+The dealing of trustee Dealer (1-based): the commitments to its polynomial,
+the proof of knowledge of its constant term, and the encrypted share of each trustee,
+where trustee j has Shares[j-1].
+*/
+type Dealing struct {
+	Dealer      uint32
+	Commitments [][]byte
+	Proof       []byte
+	Shares      [][]byte
+}
+
+// A justified complaint reveals that the share of trustee Accuser dealt by Dealer is invalid.
+type Complaint struct {
+	Dealer  uint32
+	Accuser uint32
+	// The shared point e·R of the encrypted share, and the proof that it matches the encryption key of Accuser.
+	Point []byte
+	Proof []byte
+}
+
+// Binds proofs and share encryption to the ceremony, the dealer and, for shares, the recipient.
+func dkgBinding(binding []byte, indices ...uint32) []byte {
+	var w util.BufferWriter
+	w.WriteVector(binding)
+	for _, i := range indices {
+		w.WriteUint32(i)
+	}
+	return w.Buffer
+}
+
+// Each encrypted share has its own key, so a fixed nonce is safe.
+func shareCipher(binding []byte, ephemeral *bls12381.G1Affine, shared *bls12381.G1Affine) (cipher.AEAD, []byte, error) {
+	key := sha256.Sum256(util.Concat([]byte(dkgShareContext), binding, pointBytes(ephemeral), pointBytes(shared)))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, make([]byte, aead.NonceSize()), nil
+}
+
+/*
+Deals a random polynomial as trustee dealer of a threshold setup of len(encryptionKeys) trustees,
+encrypting the share of trustee j to encryptionKeys[j-1]. binding identifies the ceremony,
+so that dealings cannot be replayed in another one.
+*/
+func NewDealing(dealer uint32, threshold int, encryptionKeys [][]byte, binding []byte) (*Dealing, error) {
+	n := len(encryptionKeys)
+	if threshold < 1 || threshold > n || dealer < 1 || int(dealer) > n {
+		return nil, ErrInvalidThreshold
+	}
+	coeffs := make([]fr.Element, threshold)
+	d := &Dealing{Dealer: dealer}
+	for i := range coeffs {
+		if _, err := coeffs[i].SetRandom(); err != nil {
+			return nil, err
+		}
+		c := mul(&g1Gen, &coeffs[i])
+		d.Commitments = append(d.Commitments, pointBytes(&c))
+	}
+	// Schnorr proof of knowledge of the constant term, against rogue-key dealings
+	var k fr.Element
+	if _, err := k.SetRandom(); err != nil {
+		return nil, err
+	}
+	c0, _ := parsePoint(d.Commitments[0])
+	A := mul(&g1Gen, &k)
+	c := hashScalar(dealingContext, dkgBinding(binding, dealer), &c0, &A)
+	var z fr.Element
+	z.Mul(&c, &coeffs[0]).Add(&z, &k)
+	d.Proof = scalarBytes(c, z)
+	for j, ek := range encryptionKeys {
+		E, err := parsePoint(ek)
+		if err != nil {
+			return nil, err
+		}
+		var r fr.Element
+		if _, err = r.SetRandom(); err != nil {
+			return nil, err
+		}
+		R := mul(&g1Gen, &r)
+		shared := mul(&E, &r)
+		aead, nonce, err := shareCipher(dkgBinding(binding, dealer, uint32(j+1)), &R, &shared)
+		if err != nil {
+			return nil, err
+		}
+		s := evalPoly(coeffs, uint32(j+1))
+		sb := s.Bytes()
+		d.Shares = append(d.Shares, aead.Seal(pointBytes(&R), nonce, sb[:], nil))
+	}
+	return d, nil
+}
+
+// Checks the structure of a dealing for n trustees and the proof of knowledge of its constant term.
+func (d *Dealing) Verify(threshold, n int, binding []byte) error {
+	if len(d.Commitments) != threshold || len(d.Shares) != n || d.Dealer < 1 || int(d.Dealer) > n {
+		return ErrInvalidDealing
+	}
+	for _, c := range d.Commitments {
+		if _, err := parsePoint(c); err != nil {
+			return ErrInvalidDealing
+		}
+	}
+	for _, s := range d.Shares {
+		if len(s) != encryptedShareLength {
+			return ErrInvalidDealing
+		}
+	}
+	if len(d.Proof) != ProofLength {
+		return ErrInvalidDealing
+	}
+	var c, z fr.Element
+	c.SetBytes(d.Proof[:fr.Bytes])
+	z.SetBytes(d.Proof[fr.Bytes:])
+	c0, _ := parsePoint(d.Commitments[0])
+	A := commitment(&z, &c, &g1Gen, &c0)
+	if expected := hashScalar(dealingContext, dkgBinding(binding, d.Dealer), &c0, &A); !expected.Equal(&c) {
+		return ErrInvalidDealing
+	}
+	return nil
+}
+
+// Returns the commitment to the share of trustee index: the sum of Commitments[k]·index^k.
+func (d *Dealing) shareCommitment(index uint32) bls12381.G1Affine {
+	points := make([]bls12381.G1Affine, len(d.Commitments))
+	powers := make([]fr.Element, len(d.Commitments))
+	var x fr.Element
+	x.SetUint64(uint64(index))
+	for k := range d.Commitments {
+		points[k], _ = parsePoint(d.Commitments[k])
+		if k == 0 {
+			powers[k].SetOne()
+		} else {
+			powers[k].Mul(&powers[k-1], &x)
+		}
+	}
+	return combine(points, powers)
+}
+
+// Decrypts the share of trustee index with the shared point, and checks it against the commitments.
+func (d *Dealing) openWith(index uint32, shared *bls12381.G1Affine, binding []byte) (Share, error) {
+	enc := d.Shares[index-1]
+	R, err := parsePoint(enc[:PointLength])
+	if err != nil {
+		return Share{}, ErrInvalidShare
+	}
+	aead, nonce, err := shareCipher(dkgBinding(binding, d.Dealer, index), &R, shared)
+	if err != nil {
+		return Share{}, err
+	}
+	sb, err := aead.Open(nil, nonce, enc[PointLength:], nil)
+	if err != nil {
+		return Share{}, ErrInvalidShare
+	}
+	var s fr.Element
+	s.SetBytes(sb)
+	if b := s.Bytes(); string(b[:]) != string(sb) {
+		// Not a canonical scalar
+		return Share{}, ErrInvalidShare
+	}
+	expected := d.shareCommitment(index)
+	if p := mul(&g1Gen, &s); !p.Equal(&expected) {
+		return Share{}, ErrInvalidShare
+	}
+	return Share{Index: index, Secret: sb}, nil
+}
+
+// Returns the ephemeral point of the share of trustee index.
+func (d *Dealing) ephemeral(index uint32) (bls12381.G1Affine, error) {
+	if index < 1 || int(index) > len(d.Shares) || len(d.Shares[index-1]) != encryptedShareLength {
+		return bls12381.G1Affine{}, ErrInvalidShare
+	}
+	return parsePoint(d.Shares[index-1][:PointLength])
+}
+
+/*
+Decrypts and checks the share dealt to trustee index, whose encryption key is secret.
+Fails with ErrInvalidShare if the share does not match the commitments, in which case
+the trustee should post a Complaint.
+*/
+func (d *Dealing) Open(index uint32, secret []byte, binding []byte) (Share, error) {
+	R, err := d.ephemeral(index)
+	if err != nil {
+		return Share{}, err
+	}
+	var e fr.Element
+	e.SetBytes(secret)
+	shared := mul(&R, &e)
+	return d.openWith(index, &shared, binding)
+}
+
+// Complains about the share dealt to trustee index, revealing its shared point with a proof.
+func (d *Dealing) Complain(index uint32, secret []byte, binding []byte) (*Complaint, error) {
+	R, err := d.ephemeral(index)
+	if err != nil {
+		return nil, err
+	}
+	var e fr.Element
+	e.SetBytes(secret)
+	E := mul(&g1Gen, &e)
+	D := mul(&R, &e)
+	// Proves log_G E = log_R D
+	proof, err := proveDLEQ(complaintContext, dkgBinding(binding, d.Dealer, index), &R, &E, &D, &e)
+	if err != nil {
+		return nil, err
+	}
+	return &Complaint{Dealer: d.Dealer, Accuser: index, Point: pointBytes(&D), Proof: proof}, nil
+}
+
+/*
+Checks a complaint against the dealing it accuses, given the encryption key of the accuser.
+Returns whether the complaint is justified, that is the revealed share is invalid, or
+ErrInvalidComplaint if the complaint does not reveal the shared point of the share.
+*/
+func (c *Complaint) Justified(d *Dealing, encryptionKey []byte, binding []byte) (bool, error) {
+	if c.Dealer != d.Dealer {
+		return false, ErrInvalidComplaint
+	}
+	R, err := d.ephemeral(c.Accuser)
+	if err != nil {
+		// A malformed share is invalid
+		return err == ErrInvalidShare, nil
+	}
+	E, err := parsePoint(encryptionKey)
+	if err != nil {
+		return false, ErrInvalidComplaint
+	}
+	D, err := parsePoint(c.Point)
+	if err != nil {
+		return false, ErrInvalidComplaint
+	}
+	if verifyDLEQ(complaintContext, dkgBinding(binding, c.Dealer, c.Accuser), &R, &E, &D, c.Proof) != nil {
+		return false, ErrInvalidComplaint
+	}
+	_, err = d.openWith(c.Accuser, &D, binding)
+	return err == ErrInvalidShare, nil
+}
+
+/*
+Computes the key set of n trustees from the dealings of the qualified dealers,
+which must have been checked with Dealing.Verify. At least threshold dealings are required,
+so that the joint secret is unknown unless threshold trustees collude.
+*/
+func JointKeySet(threshold, n int, dealings []*Dealing) (*KeySet, error) {
+	if threshold < 1 || threshold > n {
+		return nil, ErrInvalidThreshold
+	}
+	if len(dealings) < threshold {
+		return nil, ErrNotEnoughDealers
+	}
+	ones := make([]fr.Element, len(dealings))
+	for i := range ones {
+		ones[i].SetOne()
+	}
+	sum := func(point func(d *Dealing) bls12381.G1Affine) []byte {
+		points := make([]bls12381.G1Affine, len(dealings))
+		for i, d := range dealings {
+			points[i] = point(d)
+		}
+		p := combine(points, ones)
+		return pointBytes(&p)
+	}
+	ks := &KeySet{Threshold: uint32(threshold)}
+	ks.PublicKey = sum(func(d *Dealing) bls12381.G1Affine {
+		c0, _ := parsePoint(d.Commitments[0])
+		return c0
+	})
+	for j := 1; j <= n; j++ {
+		ks.VerificationKeys = append(ks.VerificationKeys, sum(func(d *Dealing) bls12381.G1Affine {
+			return d.shareCommitment(uint32(j))
+		}))
+	}
+	return ks, nil
+}
+
+// Combines the shares of a trustee opened from the dealings of the qualified dealers into its share of the joint key.
+func JointShare(index uint32, shares []Share) Share {
+	var x fr.Element
+	for _, s := range shares {
+		var y fr.Element
+		y.SetBytes(s.Secret)
+		x.Add(&x, &y)
+	}
+	b := x.Bytes()
+	return Share{Index: index, Secret: b[:]}
+}
+
+func (d *Dealing) Bytes() []byte {
+	var w util.BufferWriter
+	w.WriteUint32(d.Dealer)
+	w.WriteUvarint(uint64(len(d.Commitments)))
+	for _, c := range d.Commitments {
+		w.Write(c)
+	}
+	w.Write(d.Proof)
+	for _, s := range d.Shares {
+		w.Write(s)
+	}
+	return w.Buffer
+}
+
+// Maximum number of commitments of a dealing, bounding the threshold.
+const maxDealingCommitments = 1 << 10
+
+func (d *Dealing) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	d.Dealer, err = r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	t, err := r.ReadCount(maxDealingCommitments, PointLength)
+	if err != nil {
+		return err
+	}
+	d.Commitments = make([][]byte, t)
+	for i := range d.Commitments {
+		d.Commitments[i], err = r.ReadBytes(PointLength)
+		if err != nil {
+			return err
+		}
+	}
+	d.Proof, err = r.ReadBytes(ProofLength)
+	if err != nil {
+		return err
+	}
+	d.Shares = nil
+	for r.Len() != 0 {
+		s, err := r.ReadBytes(encryptedShareLength)
+		if err != nil {
+			return err
+		}
+		d.Shares = append(d.Shares, s)
+	}
+	return nil
+}
+
+func (c *Complaint) Bytes() []byte {
+	var w util.BufferWriter
+	w.WriteUint32(c.Dealer)
+	w.WriteUint32(c.Accuser)
+	w.Write(c.Point)
+	w.Write(c.Proof)
+	return w.Buffer
+}
+
+func (c *Complaint) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	c.Dealer, err = r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	c.Accuser, err = r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	c.Point, err = r.ReadBytes(PointLength)
+	if err != nil {
+		return err
+	}
+	c.Proof, err = r.ReadBytes(ProofLength)
+	return err
+}
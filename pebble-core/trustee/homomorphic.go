@@ -0,0 +1,351 @@
+package trustee
+
+import (
+	"crypto/sha512"
+	"errors"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+/*
+Homomorphic vector ballots: each slot of a ballot is an exponential ElGamal encryption
+(r·G, m·G + r·PK) of m ∈ {0, 1} with a disjunctive Chaum-Pedersen proof that m is 0 or 1,
+and a ballot-wide proof that the slots sum to exactly 1.
+Summing the slots of many ballots yields encrypted per-slot counts, which the trustees
+decrypt without decrypting any individual ballot.
+*/
+
+const (
+	bitProofLength = 4 * fr.Bytes
+	bitContext     = "pebble-trustee-bit"
+	sumContext     = "pebble-trustee-sum"
+)
+
+var (
+	ErrInvalidVote       = errors.New("pebble: homomorphic vote is not a single 0/1 choice")
+	ErrInvalidRangeProof = errors.New("pebble: invalid homomorphic ballot proof")
+	ErrCountOutOfRange   = errors.New("pebble: decrypted count out of range")
+)
+
+// An exponential ElGamal ciphertext (A, B) = (r·G, m·G + r·PK).
+type ElGamal struct {
+	A, B []byte
+}
+
+// An encrypted 0/1 vector with validity proofs.
+type VectorBallot struct {
+	Slots     []ElGamal
+	BitProofs [][]byte
+	SumProof  []byte
+}
+
+func hashScalar(context string, binding []byte, points ...*bls12381.G1Affine) fr.Element {
+	h := sha512.New()
+	h.Write([]byte(context))
+	h.Write(binding)
+	for _, p := range points {
+		h.Write(pointBytes(p))
+	}
+	var c fr.Element
+	c.SetBytes(h.Sum(nil))
+	return c
+}
+
+func scalarBytes(s ...fr.Element) []byte {
+	var w util.BufferWriter
+	for i := range s {
+		b := s[i].Bytes()
+		w.Write(b[:])
+	}
+	return w.Buffer
+}
+
+// Returns z·P - c·Q.
+func commitment(z, c *fr.Element, P, Q *bls12381.G1Affine) bls12381.G1Affine {
+	var negC fr.Element
+	negC.Neg(c)
+	return combine([]bls12381.G1Affine{*P, *Q}, []fr.Element{*z, negC})
+}
+
+/*
+Encrypts a vector of 0/1 votes summing to 1. binding is included in all proof challenges,
+e.g. the election ID, so that ballots cannot be replayed in another context.
+*/
+func (ks *KeySet) EncryptVector(votes []byte, binding []byte) (*VectorBallot, error) {
+	pk, err := parsePoint(ks.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	sum := 0
+	for _, v := range votes {
+		if v > 1 {
+			return nil, ErrInvalidVote
+		}
+		sum += int(v)
+	}
+	if sum != 1 {
+		return nil, ErrInvalidVote
+	}
+	vb := new(VectorBallot)
+	var rSum fr.Element
+	var aSum, bSum bls12381.G1Jac
+	for _, v := range votes {
+		var r fr.Element
+		if _, err := r.SetRandom(); err != nil {
+			return nil, err
+		}
+		rSum.Add(&rSum, &r)
+		A := mul(&g1Gen, &r)
+		B := mul(&pk, &r)
+		if v == 1 {
+			B.Add(&B, &g1Gen)
+		}
+		proof, err := proveBit(&pk, &A, &B, &r, int(v), binding)
+		if err != nil {
+			return nil, err
+		}
+		aSum.AddMixed(&A)
+		bSum.AddMixed(&B)
+		vb.Slots = append(vb.Slots, ElGamal{pointBytes(&A), pointBytes(&B)})
+		vb.BitProofs = append(vb.BitProofs, proof)
+	}
+	var A, B bls12381.G1Affine
+	A.FromJacobian(&aSum)
+	B.FromJacobian(&bSum)
+	B.Sub(&B, &g1Gen)
+	vb.SumProof, err = proveDLEQ(sumContext, binding, &pk, &A, &B, &rSum)
+	if err != nil {
+		return nil, err
+	}
+	return vb, nil
+}
+
+// Proves that (A, B) = (r·G, r·PK), that is B encrypts 0 under PK.
+func proveDLEQ(context string, binding []byte, pk, A, B *bls12381.G1Affine, r *fr.Element) ([]byte, error) {
+	var w fr.Element
+	if _, err := w.SetRandom(); err != nil {
+		return nil, err
+	}
+	a := mul(&g1Gen, &w)
+	b := mul(pk, &w)
+	c := hashScalar(context, binding, pk, A, B, &a, &b)
+	var z fr.Element
+	z.Mul(&c, r).Add(&z, &w)
+	return scalarBytes(c, z), nil
+}
+
+func verifyDLEQ(context string, binding []byte, pk, A, B *bls12381.G1Affine, proof []byte) error {
+	if len(proof) != ProofLength {
+		return ErrInvalidRangeProof
+	}
+	var c, z fr.Element
+	c.SetBytes(proof[:fr.Bytes])
+	z.SetBytes(proof[fr.Bytes:])
+	a := commitment(&z, &c, &g1Gen, A)
+	b := commitment(&z, &c, pk, B)
+	if expected := hashScalar(context, binding, pk, A, B, &a, &b); !expected.Equal(&c) {
+		return ErrInvalidRangeProof
+	}
+	return nil
+}
+
+// Proves that (A, B) encrypts v ∈ {0, 1} with randomness r, simulating the proof for 1 - v.
+func proveBit(pk, A, B *bls12381.G1Affine, r *fr.Element, v int, binding []byte) ([]byte, error) {
+	// Targets B - j·G for j = 0, 1
+	var targets [2]bls12381.G1Affine
+	targets[0] = *B
+	targets[1].Sub(B, &g1Gen)
+	var c, z [2]fr.Element
+	var a, b [2]bls12381.G1Affine
+	u := 1 - v
+	if _, err := c[u].SetRandom(); err != nil {
+		return nil, err
+	}
+	if _, err := z[u].SetRandom(); err != nil {
+		return nil, err
+	}
+	a[u] = commitment(&z[u], &c[u], &g1Gen, A)
+	b[u] = commitment(&z[u], &c[u], pk, &targets[u])
+	var w fr.Element
+	if _, err := w.SetRandom(); err != nil {
+		return nil, err
+	}
+	a[v] = mul(&g1Gen, &w)
+	b[v] = mul(pk, &w)
+	ch := hashScalar(bitContext, binding, pk, A, B, &a[0], &b[0], &a[1], &b[1])
+	c[v].Sub(&ch, &c[u])
+	z[v].Mul(&c[v], r).Add(&z[v], &w)
+	return scalarBytes(c[0], c[1], z[0], z[1]), nil
+}
+
+func verifyBit(pk, A, B *bls12381.G1Affine, proof []byte, binding []byte) error {
+	if len(proof) != bitProofLength {
+		return ErrInvalidRangeProof
+	}
+	var targets [2]bls12381.G1Affine
+	targets[0] = *B
+	targets[1].Sub(B, &g1Gen)
+	var c, z [2]fr.Element
+	var a, b [2]bls12381.G1Affine
+	for j := 0; j < 2; j++ {
+		c[j].SetBytes(proof[j*fr.Bytes : (j+1)*fr.Bytes])
+		z[j].SetBytes(proof[(j+2)*fr.Bytes : (j+3)*fr.Bytes])
+		a[j] = commitment(&z[j], &c[j], &g1Gen, A)
+		b[j] = commitment(&z[j], &c[j], pk, &targets[j])
+	}
+	var sum fr.Element
+	sum.Add(&c[0], &c[1])
+	if expected := hashScalar(bitContext, binding, pk, A, B, &a[0], &b[0], &a[1], &b[1]); !expected.Equal(&sum) {
+		return ErrInvalidRangeProof
+	}
+	return nil
+}
+
+// Checks the proofs of a vector ballot with the given number of slots.
+func (ks *KeySet) VerifyVector(vb *VectorBallot, slots int, binding []byte) error {
+	if len(vb.Slots) != slots || len(vb.BitProofs) != slots {
+		return ErrInvalidRangeProof
+	}
+	pk, err := parsePoint(ks.PublicKey)
+	if err != nil {
+		return err
+	}
+	var aSum, bSum bls12381.G1Jac
+	for i, s := range vb.Slots {
+		A, err := parsePoint(s.A)
+		if err != nil {
+			return err
+		}
+		B, err := parsePoint(s.B)
+		if err != nil {
+			return err
+		}
+		err = verifyBit(&pk, &A, &B, vb.BitProofs[i], binding)
+		if err != nil {
+			return err
+		}
+		aSum.AddMixed(&A)
+		bSum.AddMixed(&B)
+	}
+	var A, B bls12381.G1Affine
+	A.FromJacobian(&aSum)
+	B.FromJacobian(&bSum)
+	B.Sub(&B, &g1Gen)
+	return verifyDLEQ(sumContext, binding, &pk, &A, &B, vb.SumProof)
+}
+
+/*
+Sums the slots of verified vector ballots with the given number of slots.
+The A components of the sums are what the trustees partially decrypt.
+*/
+func AggregateVectors(ballots []*VectorBallot, slots int) ([]ElGamal, error) {
+	aSums := make([]bls12381.G1Jac, slots)
+	bSums := make([]bls12381.G1Jac, slots)
+	for _, vb := range ballots {
+		if len(vb.Slots) != slots {
+			return nil, ErrInvalidRangeProof
+		}
+		for i, s := range vb.Slots {
+			A, err := parsePoint(s.A)
+			if err != nil {
+				return nil, err
+			}
+			B, err := parsePoint(s.B)
+			if err != nil {
+				return nil, err
+			}
+			aSums[i].AddMixed(&A)
+			bSums[i].AddMixed(&B)
+		}
+	}
+	res := make([]ElGamal, slots)
+	for i := range res {
+		var A, B bls12381.G1Affine
+		A.FromJacobian(&aSums[i])
+		B.FromJacobian(&bSums[i])
+		// Sums of no ballots are the identity, encoded like any other point
+		res[i] = ElGamal{pointBytes(&A), pointBytes(&B)}
+	}
+	return res, nil
+}
+
+/*
+Decrypts an aggregated count from the partial decryptions of its A component,
+searching the count in [0, max].
+Invalid partials are skipped; at least Threshold valid partials from distinct trustees are required.
+*/
+func (ks *KeySet) DecryptCount(c ElGamal, indices []uint32, partials []PartialDecryption, max uint64) (uint64, error) {
+	var A, B bls12381.G1Affine
+	if _, err := B.SetBytes(c.B); err != nil {
+		return 0, ErrInvalidPoint
+	}
+	if _, err := A.SetBytes(c.A); err != nil {
+		return 0, ErrInvalidPoint
+	}
+	var M bls12381.G1Jac
+	M.FromAffine(&B)
+	// With no ballots, A is the identity and so are the partials
+	if !A.IsInfinity() {
+		shared, _, err := ks.combinePartials(c.A, indices, partials, nil)
+		if err != nil {
+			return 0, err
+		}
+		var S bls12381.G1Jac
+		S.FromAffine(&shared)
+		M.SubAssign(&S)
+	}
+	var acc bls12381.G1Jac
+	for m := uint64(0); m <= max; m++ {
+		if acc.Equal(&M) {
+			return m, nil
+		}
+		acc.AddMixed(&g1Gen)
+	}
+	return 0, ErrCountOutOfRange
+}
+
+func (vb *VectorBallot) Bytes() []byte {
+	var w util.BufferWriter
+	w.WriteByte(byte(len(vb.Slots)))
+	for i, s := range vb.Slots {
+		w.Write(s.A)
+		w.Write(s.B)
+		w.Write(vb.BitProofs[i])
+	}
+	w.Write(vb.SumProof)
+	return w.Buffer
+}
+
+func (vb *VectorBallot) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	n, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if !r.Holds(int(n), 2*PointLength+bitProofLength) {
+		return util.ErrTooLarge
+	}
+	vb.Slots = make([]ElGamal, n)
+	vb.BitProofs = make([][]byte, n)
+	for i := range vb.Slots {
+		if vb.Slots[i].A, err = r.ReadBytes(PointLength); err != nil {
+			return err
+		}
+		if vb.Slots[i].B, err = r.ReadBytes(PointLength); err != nil {
+			return err
+		}
+		if vb.BitProofs[i], err = r.ReadBytes(bitProofLength); err != nil {
+			return err
+		}
+	}
+	vb.SumProof, err = r.ReadBytes(ProofLength)
+	if err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return ErrInvalidRangeProof
+	}
+	return nil
+}
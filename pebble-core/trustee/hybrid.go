@@ -0,0 +1,261 @@
+package trustee
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"golang.org/x/crypto/curve25519"
+)
+
+/*
+Hybrid post-quantum wrapping of trustee ciphertexts.
+
+The ElGamal key of a ciphertext falls to anyone able to compute discrete logarithms,
+so a recorded ballot would become readable once quantum computers are. When the key set
+has hybrid keys, the payload key is additionally derived from a random secret s, which the
+sender Shamir-shares among the trustees with the same threshold. The share of trustee i is
+wrapped to its hybrid key, an ML-KEM-768 key and an X25519 key whose shared secrets are
+both hashed into the wrapping key, so that the share stays hidden while either holds.
+The ciphertext also carries a hash committing to each share. With their partial decryption,
+trustees post their unwrapped share, which is checked against its commitment, and
+Threshold shares are combined by Lagrange interpolation into s.
+*/
+
+const (
+	// Lengths of the ML-KEM-768 encapsulation key, decapsulation key seed and ciphertext.
+	mlkemPublicKeyLength  = 1184
+	mlkemSeedLength       = 64
+	mlkemCiphertextLength = 1088
+
+	// Length of hybrid public keys: an ML-KEM-768 encapsulation key followed by an X25519 public key.
+	HybridPublicKeyLength = mlkemPublicKeyLength + curve25519.PointSize
+	// Length of hybrid secret keys: an ML-KEM-768 seed followed by an X25519 scalar.
+	HybridSecretLength = mlkemSeedLength + curve25519.ScalarSize
+	// Length of a share wrapped to a hybrid key: ML-KEM ciphertext, X25519 ephemeral key and sealed share.
+	wrappedShareLength = mlkemCiphertextLength + curve25519.PointSize + fr.Bytes + 16
+	// Length of each trustee's commitment and wrapped share in hybrid ciphertexts.
+	hybridShareLength = 32 + wrappedShareLength
+
+	/*
+		Maximum number of trustees of key sets with hybrid keys. Each ciphertext carries a
+		wrapped share per trustee, and must fit in the trustee field of ballots.
+	*/
+	MaxHybridTrustees = 16
+)
+
+const (
+	hybridWrapContext   = "pebble-trustee-hybrid-wrap"
+	hybridCommitContext = "pebble-trustee-hybrid-share"
+)
+
+// Marks hybrid ciphertexts. Valid compressed points, which start legacy ciphertexts, never start with it.
+const hybridCiphertextVersion byte = 1
+
+var (
+	ErrHybridUnavailable = errors.New("pebble: hybrid trustee keys need ML-KEM, available from Go 1.24")
+	ErrInvalidHybridKey  = errors.New("pebble: invalid hybrid trustee key")
+	ErrInvalidHybridWrap = errors.New("pebble: invalid hybrid trustee share")
+	ErrNoHybridKey       = errors.New("pebble: trustee share has no hybrid key")
+)
+
+// A trustee's Shamir share of the hybrid secret of a ciphertext, wrapped to its hybrid key, and the hash committing to it.
+type WrappedShare struct {
+	Commitment util.HashValue
+	Wrapped    []byte
+}
+
+// Generates the hybrid key of a trustee. The public key goes in KeySet.HybridKeys, the secret in Share.Hybrid.
+func GenerateHybridKey() (secret, public []byte, err error) {
+	seed, mlkemPublic, err := mlkemGenerate()
+	if err != nil {
+		return nil, nil, err
+	}
+	scalar := make([]byte, curve25519.ScalarSize)
+	if _, err = io.ReadFull(rand.Reader, scalar); err != nil {
+		return nil, nil, err
+	}
+	xPublic, err := curve25519.X25519(scalar, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	return util.Concat(seed, scalar), util.Concat(mlkemPublic, xPublic), nil
+}
+
+/*
+Deals a t-of-n trustee setup like Deal, with a new hybrid key for each trustee,
+so that ciphertexts encrypted to the key set are also wrapped with ML-KEM.
+*/
+func DealHybrid(threshold, n int) (*KeySet, []Share, error) {
+	if n > MaxHybridTrustees {
+		return nil, nil, ErrInvalidThreshold
+	}
+	ks, shares, err := Deal(threshold, n)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range shares {
+		secret, public, err := GenerateHybridKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		shares[i].Hybrid = secret
+		ks.HybridKeys = append(ks.HybridKeys, public)
+	}
+	return ks, shares, nil
+}
+
+// Hashes both shared secrets with the transcript into the AEAD key of a wrapped share.
+func hybridCipher(mlkemShared, mlkemCiphertext, xShared, xEphemeral, public, binding []byte) (cipher.AEAD, []byte, error) {
+	key := sha256.Sum256(util.Concat([]byte(hybridWrapContext), mlkemShared, xShared, mlkemCiphertext, xEphemeral, public, binding))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Each wrapping has its own key, so a fixed nonce is safe
+	return aead, make([]byte, aead.NonceSize()), nil
+}
+
+// Wraps a share to a hybrid public key, bound to the ciphertext and trustee by binding.
+func wrapShare(public, share, binding []byte) ([]byte, error) {
+	if len(public) != HybridPublicKeyLength {
+		return nil, ErrInvalidHybridKey
+	}
+	mlkemShared, mlkemCiphertext, err := mlkemEncapsulate(public[:mlkemPublicKeyLength])
+	if err != nil {
+		return nil, err
+	}
+	scalar := make([]byte, curve25519.ScalarSize)
+	if _, err = io.ReadFull(rand.Reader, scalar); err != nil {
+		return nil, err
+	}
+	xEphemeral, err := curve25519.X25519(scalar, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	xShared, err := curve25519.X25519(scalar, public[mlkemPublicKeyLength:])
+	if err != nil {
+		return nil, ErrInvalidHybridKey
+	}
+	aead, nonce, err := hybridCipher(mlkemShared, mlkemCiphertext, xShared, xEphemeral, public, binding)
+	if err != nil {
+		return nil, err
+	}
+	return util.Concat(mlkemCiphertext, xEphemeral, aead.Seal(nil, nonce, share, nil)), nil
+}
+
+// Unwraps a share with the hybrid secret key.
+func unwrapShare(secret, public, wrapped, binding []byte) ([]byte, error) {
+	if len(secret) != HybridSecretLength || len(public) != HybridPublicKeyLength {
+		return nil, ErrInvalidHybridKey
+	}
+	if len(wrapped) != wrappedShareLength {
+		return nil, ErrInvalidHybridWrap
+	}
+	mlkemCiphertext := wrapped[:mlkemCiphertextLength]
+	xEphemeral := wrapped[mlkemCiphertextLength : mlkemCiphertextLength+curve25519.PointSize]
+	mlkemShared, err := mlkemDecapsulate(secret[:mlkemSeedLength], mlkemCiphertext)
+	if err != nil {
+		return nil, ErrInvalidHybridWrap
+	}
+	xShared, err := curve25519.X25519(secret[mlkemSeedLength:], xEphemeral)
+	if err != nil {
+		return nil, ErrInvalidHybridWrap
+	}
+	aead, nonce, err := hybridCipher(mlkemShared, mlkemCiphertext, xShared, xEphemeral, public, binding)
+	if err != nil {
+		return nil, err
+	}
+	share, err := aead.Open(nil, nonce, wrapped[mlkemCiphertextLength+curve25519.PointSize:], nil)
+	if err != nil {
+		return nil, ErrInvalidHybridWrap
+	}
+	return share, nil
+}
+
+// Binds the wrapped share of trustee index to the ciphertext with ephemeral key R.
+func hybridBinding(ephemeral []byte, index uint32) []byte {
+	var w util.BufferWriter
+	w.Write(ephemeral)
+	w.WriteUint32(index)
+	return w.Buffer
+}
+
+func shareCommitment(ephemeral []byte, index uint32, share []byte) util.HashValue {
+	return util.HashAll([]byte(hybridCommitContext), hybridBinding(ephemeral, index), share)
+}
+
+/*
+Shares a new hybrid secret among the trustees of the key set, returning its bytes and
+the share of each trustee wrapped to its hybrid key, for the ciphertext with ephemeral key R.
+*/
+func (ks *KeySet) wrapHybridSecret(ephemeral []byte) ([]byte, []WrappedShare, error) {
+	coeffs := make([]fr.Element, ks.Threshold)
+	for i := range coeffs {
+		if _, err := coeffs[i].SetRandom(); err != nil {
+			return nil, nil, err
+		}
+	}
+	wrapped := make([]WrappedShare, len(ks.HybridKeys))
+	for i, public := range ks.HybridKeys {
+		index := uint32(i + 1)
+		x := evalPoly(coeffs, index)
+		b := x.Bytes()
+		w, err := wrapShare(public, b[:], hybridBinding(ephemeral, index))
+		if err != nil {
+			return nil, nil, err
+		}
+		wrapped[i] = WrappedShare{Commitment: shareCommitment(ephemeral, index, b[:]), Wrapped: w}
+	}
+	secret := coeffs[0].Bytes()
+	return secret[:], wrapped, nil
+}
+
+// Checks the hybrid share posted by trustee index against its commitment in the ciphertext.
+func (c *Ciphertext) verifyHybridShare(index uint32, share []byte) bool {
+	if index < 1 || int(index) > len(c.Hybrid) || len(share) != fr.Bytes {
+		return false
+	}
+	return shareCommitment(c.Ephemeral, index, share) == c.Hybrid[index-1].Commitment
+}
+
+// Combines the hybrid shares of the trustees with the given indices into the hybrid secret.
+func combineHybridShares(indices []uint32, shares [][]byte) []byte {
+	coeffs := lagrange(indices, 0)
+	var secret fr.Element
+	for i, share := range shares {
+		var x fr.Element
+		x.SetBytes(share)
+		x.Mul(&x, &coeffs[i])
+		secret.Add(&secret, &x)
+	}
+	b := secret.Bytes()
+	return b[:]
+}
+
+// Unwraps the share of the hybrid secret of the ciphertext for this trustee.
+func (s *Share) unwrapHybrid(ks *KeySet, c Ciphertext) ([]byte, error) {
+	if s.Hybrid == nil {
+		return nil, ErrNoHybridKey
+	}
+	if s.Index < 1 || int(s.Index) > len(c.Hybrid) || int(s.Index) > len(ks.HybridKeys) {
+		return nil, ErrInvalidHybridWrap
+	}
+	share, err := unwrapShare(s.Hybrid, ks.HybridKeys[s.Index-1], c.Hybrid[s.Index-1].Wrapped, hybridBinding(c.Ephemeral, s.Index))
+	if err != nil {
+		return nil, err
+	}
+	if !c.verifyHybridShare(s.Index, share) {
+		return nil, ErrInvalidHybridWrap
+	}
+	return share, nil
+}
@@ -0,0 +1,33 @@
+//go:build go1.24
+// +build go1.24
+
+package trustee
+
+import "crypto/mlkem"
+
+const mlkemAvailable = true
+
+func mlkemGenerate() (seed, public []byte, err error) {
+	dk, err := mlkem.GenerateKey768()
+	if err != nil {
+		return nil, nil, err
+	}
+	return dk.Bytes(), dk.EncapsulationKey().Bytes(), nil
+}
+
+func mlkemEncapsulate(public []byte) (shared, ciphertext []byte, err error) {
+	ek, err := mlkem.NewEncapsulationKey768(public)
+	if err != nil {
+		return nil, nil, ErrInvalidHybridKey
+	}
+	shared, ciphertext = ek.Encapsulate()
+	return shared, ciphertext, nil
+}
+
+func mlkemDecapsulate(seed, ciphertext []byte) ([]byte, error) {
+	dk, err := mlkem.NewDecapsulationKey768(seed)
+	if err != nil {
+		return nil, ErrInvalidHybridKey
+	}
+	return dk.Decapsulate(ciphertext)
+}
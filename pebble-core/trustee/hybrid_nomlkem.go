@@ -0,0 +1,19 @@
+//go:build !go1.24
+// +build !go1.24
+
+package trustee
+
+// ML-KEM is only in the standard library from Go 1.24.
+const mlkemAvailable = false
+
+func mlkemGenerate() (seed, public []byte, err error) {
+	return nil, nil, ErrHybridUnavailable
+}
+
+func mlkemEncapsulate(public []byte) (shared, ciphertext []byte, err error) {
+	return nil, nil, ErrHybridUnavailable
+}
+
+func mlkemDecapsulate(seed, ciphertext []byte) ([]byte, error) {
+	return nil, ErrHybridUnavailable
+}
@@ -0,0 +1,642 @@
+/*
+Package trustee implements threshold decryption by a t-of-n set of trustees.
+
+Payloads are encrypted to the joint trustee key with hashed ElGamal over the
+G1 group of BLS12-381: the sender picks r, publishes R = r·G and derives an
+AES-GCM key from r·PK. Trustee i holds a Shamir share x_i of the joint secret and
+publishes its verification key x_i·G. To decrypt, at least t trustees post
+partial decryptions x_i·R with a Chaum-Pedersen proof that they used their share;
+the partials are combined by Lagrange interpolation in the exponent.
+Key sets may also have hybrid post-quantum keys, see hybrid.go.
+*/
+package trustee
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"math/big"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+const (
+	// Length of compressed group elements.
+	PointLength = bls12381.SizeOfG1AffineCompressed
+	// Length of partial decryption proofs.
+	ProofLength = 2 * fr.Bytes
+)
+
+const (
+	keyContext       = "pebble-trustee-key"
+	proofContext     = "pebble-trustee-dleq"
+	signatureContext = "pebble-trustee-signature"
+)
+
+var (
+	ErrInvalidThreshold   = errors.New("pebble: invalid trustee threshold")
+	ErrInvalidPoint       = errors.New("pebble: invalid trustee group element")
+	ErrInvalidShare       = errors.New("pebble: trustee share does not match verification key")
+	ErrInvalidKeySet      = errors.New("pebble: inconsistent trustee verification keys")
+	ErrInvalidPartial     = errors.New("pebble: invalid partial decryption")
+	ErrNotEnoughPartials  = errors.New("pebble: not enough valid partial decryptions")
+	ErrCiphertextTooShort = errors.New("pebble: trustee ciphertext too short")
+	ErrInvalidSignature   = errors.New("pebble: invalid trustee signature")
+)
+
+var g1Gen bls12381.G1Affine
+
+func init() {
+	_, _, g1Gen, _ = bls12381.Generators()
+}
+
+func bigInt(s *fr.Element) *big.Int {
+	b := s.Bytes()
+	return new(big.Int).SetBytes(b[:])
+}
+
+func mul(p *bls12381.G1Affine, s *fr.Element) bls12381.G1Affine {
+	var r bls12381.G1Affine
+	r.ScalarMultiplication(p, bigInt(s))
+	return r
+}
+
+func pointBytes(p *bls12381.G1Affine) []byte {
+	b := p.Bytes()
+	return b[:]
+}
+
+// Decodes a compressed point, rejecting the identity and points outside the subgroup.
+func parsePoint(b []byte) (bls12381.G1Affine, error) {
+	var p bls12381.G1Affine
+	if len(b) != PointLength {
+		return p, ErrInvalidPoint
+	}
+	if _, err := p.SetBytes(b); err != nil || p.IsInfinity() {
+		return p, ErrInvalidPoint
+	}
+	return p, nil
+}
+
+/*
+The public part of a trustee setup: the decryption threshold, the joint public key,
+and the verification key of each trustee, where trustee i (1-based) has VerificationKeys[i-1].
+If set, HybridKeys[i-1] is the hybrid public key of trustee i.
+*/
+type KeySet struct {
+	Threshold        uint32
+	PublicKey        []byte
+	VerificationKeys [][]byte
+	HybridKeys       [][]byte
+}
+
+// The secret share of trustee Index (1-based), and its hybrid secret key if the key set has hybrid keys.
+type Share struct {
+	Index  uint32
+	Secret []byte
+	Hybrid []byte
+}
+
+// Evaluates the polynomial with the given coefficients at x.
+func evalPoly(coeffs []fr.Element, x uint32) fr.Element {
+	var res, fx fr.Element
+	fx.SetUint64(uint64(x))
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		res.Mul(&res, &fx).Add(&res, &coeffs[i])
+	}
+	return res
+}
+
+/*
+Generates a t-of-n trustee setup with a trusted dealer, which must erase the joint secret afterwards.
+Each trustee should check its share with KeySet.VerifyShare, and everyone the key set with KeySet.Validate.
+*/
+func Deal(threshold, n int) (*KeySet, []Share, error) {
+	if threshold < 1 || threshold > n {
+		return nil, nil, ErrInvalidThreshold
+	}
+	coeffs := make([]fr.Element, threshold)
+	for i := range coeffs {
+		if _, err := coeffs[i].SetRandom(); err != nil {
+			return nil, nil, err
+		}
+	}
+	pk := mul(&g1Gen, &coeffs[0])
+	ks := &KeySet{Threshold: uint32(threshold), PublicKey: pointBytes(&pk)}
+	shares := make([]Share, n)
+	for i := range shares {
+		x := evalPoly(coeffs, uint32(i+1))
+		vk := mul(&g1Gen, &x)
+		b := x.Bytes()
+		shares[i] = Share{Index: uint32(i + 1), Secret: b[:]}
+		ks.VerificationKeys = append(ks.VerificationKeys, pointBytes(&vk))
+	}
+	return ks, shares, nil
+}
+
+// Computes the Lagrange coefficients at x for the given 1-based indices.
+func lagrange(indices []uint32, x uint32) []fr.Element {
+	coeffs := make([]fr.Element, len(indices))
+	var fx fr.Element
+	fx.SetUint64(uint64(x))
+	for i, xi := range indices {
+		var num, den, fi fr.Element
+		num.SetOne()
+		den.SetOne()
+		fi.SetUint64(uint64(xi))
+		for j, xj := range indices {
+			if i == j {
+				continue
+			}
+			var fj, t fr.Element
+			fj.SetUint64(uint64(xj))
+			num.Mul(&num, t.Sub(&fx, &fj))
+			den.Mul(&den, t.Sub(&fi, &fj))
+		}
+		coeffs[i].Div(&num, &den)
+	}
+	return coeffs
+}
+
+// Computes sum(coeffs[i]·points[i]).
+func combine(points []bls12381.G1Affine, coeffs []fr.Element) bls12381.G1Affine {
+	var acc bls12381.G1Jac
+	for i := range points {
+		var p bls12381.G1Jac
+		p.FromAffine(&points[i])
+		p.ScalarMultiplication(&p, bigInt(&coeffs[i]))
+		acc.AddAssign(&p)
+	}
+	var res bls12381.G1Affine
+	res.FromJacobian(&acc)
+	return res
+}
+
+func (ks *KeySet) verificationKey(index uint32) (bls12381.G1Affine, error) {
+	if index < 1 || int(index) > len(ks.VerificationKeys) {
+		return bls12381.G1Affine{}, ErrInvalidShare
+	}
+	return parsePoint(ks.VerificationKeys[index-1])
+}
+
+/*
+Checks that the verification keys are shares of the joint public key
+for a polynomial of degree Threshold - 1: the first Threshold keys must interpolate
+to the public key at 0 and to every other verification key.
+*/
+func (ks *KeySet) Validate() error {
+	t := int(ks.Threshold)
+	if t < 1 || t > len(ks.VerificationKeys) {
+		return ErrInvalidThreshold
+	}
+	pk, err := parsePoint(ks.PublicKey)
+	if err != nil {
+		return err
+	}
+	vks := make([]bls12381.G1Affine, len(ks.VerificationKeys))
+	indices := make([]uint32, t)
+	for i := range vks {
+		vks[i], err = parsePoint(ks.VerificationKeys[i])
+		if err != nil {
+			return err
+		}
+		if i < t {
+			indices[i] = uint32(i + 1)
+		}
+	}
+	if ks.HybridKeys != nil {
+		if len(ks.HybridKeys) != len(vks) || len(vks) > MaxHybridTrustees {
+			return ErrInvalidKeySet
+		}
+		for _, k := range ks.HybridKeys {
+			if len(k) != HybridPublicKeyLength {
+				return ErrInvalidHybridKey
+			}
+		}
+	}
+	for x := 0; x <= len(vks); x++ {
+		if x >= 1 && x <= t {
+			continue
+		}
+		p := combine(vks[:t], lagrange(indices, uint32(x)))
+		expected := pk
+		if x != 0 {
+			expected = vks[x-1]
+		}
+		if !p.Equal(&expected) {
+			return ErrInvalidKeySet
+		}
+	}
+	return nil
+}
+
+// Checks a trustee share against its verification key.
+func (ks *KeySet) VerifyShare(s Share) error {
+	vk, err := ks.verificationKey(s.Index)
+	if err != nil {
+		return err
+	}
+	var x fr.Element
+	x.SetBytes(s.Secret)
+	p := mul(&g1Gen, &x)
+	if !p.Equal(&vk) {
+		return ErrInvalidShare
+	}
+	return nil
+}
+
+/*
+Serializes the key set. Key sets with hybrid keys start with a zero word, never a valid threshold,
+followed by the threshold, the public key, the count of trustees, their verification keys and their hybrid keys.
+*/
+func (ks *KeySet) Bytes() []byte {
+	var w util.BufferWriter
+	if ks.HybridKeys != nil {
+		w.WriteUint32(0)
+	}
+	w.WriteUint32(ks.Threshold)
+	w.Write(ks.PublicKey)
+	if ks.HybridKeys != nil {
+		w.WriteUvarint(uint64(len(ks.VerificationKeys)))
+	}
+	for _, vk := range ks.VerificationKeys {
+		w.Write(vk)
+	}
+	for _, k := range ks.HybridKeys {
+		w.Write(k)
+	}
+	return w.Buffer
+}
+
+func (ks *KeySet) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	ks.Threshold, err = r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	ks.HybridKeys = nil
+	if ks.Threshold == 0 {
+		return ks.hybridFromBytes(r)
+	}
+	ks.PublicKey, err = r.ReadBytes(PointLength)
+	if err != nil {
+		return err
+	}
+	ks.VerificationKeys = nil
+	for r.Len() != 0 {
+		vk, err := r.ReadBytes(PointLength)
+		if err != nil {
+			return err
+		}
+		ks.VerificationKeys = append(ks.VerificationKeys, vk)
+	}
+	return nil
+}
+
+func (ks *KeySet) hybridFromBytes(r *util.BufferReader) error {
+	var err error
+	ks.Threshold, err = r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	ks.PublicKey, err = r.ReadBytes(PointLength)
+	if err != nil {
+		return err
+	}
+	n, err := r.ReadCount(MaxHybridTrustees, PointLength+HybridPublicKeyLength)
+	if err != nil {
+		return err
+	}
+	ks.VerificationKeys = make([][]byte, n)
+	for i := range ks.VerificationKeys {
+		ks.VerificationKeys[i], _ = r.ReadBytes(PointLength)
+	}
+	ks.HybridKeys = make([][]byte, n)
+	for i := range ks.HybridKeys {
+		ks.HybridKeys[i], _ = r.ReadBytes(HybridPublicKeyLength)
+	}
+	if r.Len() != 0 {
+		return ErrInvalidKeySet
+	}
+	return nil
+}
+
+func (s *Share) Bytes() []byte {
+	var w util.BufferWriter
+	w.WriteUint32(s.Index)
+	w.Write(s.Secret)
+	w.Write(s.Hybrid)
+	return w.Buffer
+}
+
+func (s *Share) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	s.Index, err = r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	s.Secret, err = r.ReadBytes(fr.Bytes)
+	if err != nil {
+		return err
+	}
+	s.Hybrid = nil
+	if r.Len() != 0 {
+		s.Hybrid, err = r.ReadBytes(HybridSecretLength)
+	}
+	return err
+}
+
+// A payload encrypted to the joint trustee key, with the wrapped shares of its hybrid secret if any.
+type Ciphertext struct {
+	Ephemeral []byte
+	Payload   []byte
+	Hybrid    []WrappedShare
+}
+
+/*
+Serializes the ciphertext. Hybrid ciphertexts start with hybridCiphertextVersion, followed by
+the ephemeral key, the count of shares, each commitment and wrapped share, and the payload.
+*/
+func (c *Ciphertext) Bytes() []byte {
+	if c.Hybrid == nil {
+		return util.Concat(c.Ephemeral, c.Payload)
+	}
+	var w util.BufferWriter
+	w.WriteByte(hybridCiphertextVersion)
+	w.Write(c.Ephemeral)
+	w.WriteUvarint(uint64(len(c.Hybrid)))
+	for _, s := range c.Hybrid {
+		w.Write32(s.Commitment)
+		w.Write(s.Wrapped)
+	}
+	w.Write(c.Payload)
+	return w.Buffer
+}
+
+func (c *Ciphertext) FromBytes(p []byte) error {
+	c.Hybrid = nil
+	if len(p) != 0 && p[0] == hybridCiphertextVersion {
+		return c.hybridFromBytes(p[1:])
+	}
+	if len(p) < PointLength {
+		return ErrCiphertextTooShort
+	}
+	c.Ephemeral = p[:PointLength]
+	c.Payload = p[PointLength:]
+	return nil
+}
+
+func (c *Ciphertext) hybridFromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	c.Ephemeral, err = r.ReadBytes(PointLength)
+	if err != nil {
+		return ErrCiphertextTooShort
+	}
+	n, err := r.ReadCount(MaxHybridTrustees, hybridShareLength)
+	if err != nil {
+		return err
+	}
+	c.Hybrid = make([]WrappedShare, n)
+	for i := range c.Hybrid {
+		c.Hybrid[i].Commitment, _ = r.Read32()
+		c.Hybrid[i].Wrapped, _ = r.ReadBytes(wrappedShareLength)
+	}
+	c.Payload = r.ReadRemaining()
+	return nil
+}
+
+/*
+Each ciphertext has its own key, so a fixed nonce is safe.
+The key of hybrid ciphertexts is also derived from their hybrid secret.
+*/
+func createCipher(ephemeral []byte, shared *bls12381.G1Affine, hybrid []byte) (cipher.AEAD, []byte, error) {
+	key := sha256.Sum256(util.Concat([]byte(keyContext), ephemeral, pointBytes(shared), hybrid))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, make([]byte, aead.NonceSize()), nil
+}
+
+// Encrypts a payload to the joint trustee key, wrapping its key with the hybrid keys if the key set has them.
+func (ks *KeySet) Encrypt(payload []byte) (c Ciphertext, err error) {
+	pk, err := parsePoint(ks.PublicKey)
+	if err != nil {
+		return
+	}
+	var r fr.Element
+	if _, err = r.SetRandom(); err != nil {
+		return
+	}
+	R := mul(&g1Gen, &r)
+	shared := mul(&pk, &r)
+	c.Ephemeral = pointBytes(&R)
+	var hybrid []byte
+	if ks.HybridKeys != nil {
+		hybrid, c.Hybrid, err = ks.wrapHybridSecret(c.Ephemeral)
+		if err != nil {
+			return
+		}
+	}
+	aead, nonce, err := createCipher(c.Ephemeral, &shared, hybrid)
+	if err != nil {
+		return
+	}
+	c.Payload = aead.Seal(nil, nonce, payload, nil)
+	return
+}
+
+/*
+A trustee's share of the decryption of a ciphertext: x_i·R and the proof that it matches the verification key,
+and for hybrid ciphertexts the unwrapped share of their hybrid secret.
+*/
+type PartialDecryption struct {
+	Point []byte
+	Proof []byte
+	Share []byte
+}
+
+func challenge(vk, R, D, A, B *bls12381.G1Affine) fr.Element {
+	h := sha512.New()
+	h.Write([]byte(proofContext))
+	for _, p := range []*bls12381.G1Affine{vk, R, D, A, B} {
+		h.Write(pointBytes(p))
+	}
+	var c fr.Element
+	c.SetBytes(h.Sum(nil))
+	return c
+}
+
+// Computes the partial decryption of the ciphertext with ephemeral key R.
+func (s *Share) Decrypt(ephemeral []byte) (pd PartialDecryption, err error) {
+	R, err := parsePoint(ephemeral)
+	if err != nil {
+		return
+	}
+	var x, k fr.Element
+	x.SetBytes(s.Secret)
+	if _, err = k.SetRandom(); err != nil {
+		return
+	}
+	vk := mul(&g1Gen, &x)
+	D := mul(&R, &x)
+	A := mul(&g1Gen, &k)
+	B := mul(&R, &k)
+	c := challenge(&vk, &R, &D, &A, &B)
+	var z fr.Element
+	z.Mul(&c, &x).Add(&z, &k)
+	cb, zb := c.Bytes(), z.Bytes()
+	pd.Point = pointBytes(&D)
+	pd.Proof = util.Concat(cb[:], zb[:])
+	return
+}
+
+// Computes the partial decryption of the ciphertext, unwrapping the share of its hybrid secret if it has one.
+func (s *Share) DecryptCiphertext(ks *KeySet, c Ciphertext) (PartialDecryption, error) {
+	pd, err := s.Decrypt(c.Ephemeral)
+	if err != nil || c.Hybrid == nil {
+		return pd, err
+	}
+	pd.Share, err = s.unwrapHybrid(ks, c)
+	return pd, err
+}
+
+// Checks the proof of a partial decryption by trustee index of the ciphertext with ephemeral key R.
+func (ks *KeySet) VerifyPartial(index uint32, ephemeral []byte, pd PartialDecryption) error {
+	vk, err := ks.verificationKey(index)
+	if err != nil {
+		return err
+	}
+	R, err := parsePoint(ephemeral)
+	if err != nil {
+		return err
+	}
+	D, err := parsePoint(pd.Point)
+	if err != nil {
+		return ErrInvalidPartial
+	}
+	if len(pd.Proof) != ProofLength {
+		return ErrInvalidPartial
+	}
+	var c, z fr.Element
+	c.SetBytes(pd.Proof[:fr.Bytes])
+	z.SetBytes(pd.Proof[fr.Bytes:])
+	// A = z·G - c·VK, B = z·R - c·D
+	var negC fr.Element
+	negC.Neg(&c)
+	A := combine([]bls12381.G1Affine{g1Gen, vk}, []fr.Element{z, negC})
+	B := combine([]bls12381.G1Affine{R, D}, []fr.Element{z, negC})
+	if expected := challenge(&vk, &R, &D, &A, &B); !expected.Equal(&c) {
+		return ErrInvalidPartial
+	}
+	return nil
+}
+
+/*
+Combines the valid partial decryptions of the ciphertext with ephemeral key R into x·R,
+skipping those rejected by accept if not nil. Returns the positions of the partials combined.
+*/
+func (ks *KeySet) combinePartials(ephemeral []byte, indices []uint32, partials []PartialDecryption, accept func(i int) bool) (bls12381.G1Affine, []int, error) {
+	var valid []uint32
+	var used []int
+	var points []bls12381.G1Affine
+	seen := make(map[uint32]bool)
+	for i, pd := range partials {
+		if len(valid) == int(ks.Threshold) {
+			break
+		}
+		if seen[indices[i]] || (accept != nil && !accept(i)) || ks.VerifyPartial(indices[i], ephemeral, pd) != nil {
+			continue
+		}
+		D, _ := parsePoint(pd.Point)
+		seen[indices[i]] = true
+		valid = append(valid, indices[i])
+		used = append(used, i)
+		points = append(points, D)
+	}
+	if len(valid) < int(ks.Threshold) || len(valid) == 0 {
+		return bls12381.G1Affine{}, nil, ErrNotEnoughPartials
+	}
+	return combine(points, lagrange(valid, 0)), used, nil
+}
+
+/*
+Decrypts a ciphertext from the partial decryptions of the given trustees.
+Invalid partials are skipped; at least Threshold valid partials from distinct trustees are required.
+Partials of hybrid ciphertexts are only valid with the share of the hybrid secret committed to.
+*/
+func (ks *KeySet) Combine(c Ciphertext, indices []uint32, partials []PartialDecryption) ([]byte, error) {
+	var accept func(i int) bool
+	if c.Hybrid != nil {
+		accept = func(i int) bool {
+			return c.verifyHybridShare(indices[i], partials[i].Share)
+		}
+	}
+	shared, used, err := ks.combinePartials(c.Ephemeral, indices, partials, accept)
+	if err != nil {
+		return nil, err
+	}
+	var hybrid []byte
+	if c.Hybrid != nil {
+		valid := make([]uint32, len(used))
+		shares := make([][]byte, len(used))
+		for j, i := range used {
+			valid[j], shares[j] = indices[i], partials[i].Share
+		}
+		hybrid = combineHybridShares(valid, shares)
+	}
+	aead, nonce, err := createCipher(c.Ephemeral, &shared, hybrid)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, nonce, c.Payload, nil)
+}
+
+/*
+Signs msg with the share, so that the trustee can vouch for statements such as election results.
+The signature is a Schnorr signature (c, z) under the verification key x_i·G,
+with A = k·G, c = H(msg, x_i·G, A) and z = k + c·x_i.
+*/
+func (s *Share) Sign(msg []byte) ([]byte, error) {
+	var x, k fr.Element
+	x.SetBytes(s.Secret)
+	if _, err := k.SetRandom(); err != nil {
+		return nil, err
+	}
+	vk := mul(&g1Gen, &x)
+	A := mul(&g1Gen, &k)
+	c := hashScalar(signatureContext, msg, &vk, &A)
+	var z fr.Element
+	z.Mul(&c, &x).Add(&z, &k)
+	return scalarBytes(c, z), nil
+}
+
+// Checks a signature made by trustee index with Share.Sign.
+func (ks *KeySet) VerifySignature(index uint32, msg, sig []byte) error {
+	vk, err := ks.verificationKey(index)
+	if err != nil {
+		return err
+	}
+	if len(sig) != ProofLength {
+		return ErrInvalidSignature
+	}
+	var c, z fr.Element
+	c.SetBytes(sig[:fr.Bytes])
+	z.SetBytes(sig[fr.Bytes:])
+	A := commitment(&z, &c, &g1Gen, &vk)
+	if expected := hashScalar(signatureContext, msg, &vk, &A); !expected.Equal(&c) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package trustee
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestThresholdDecryption(t *testing.T) {
+	ks, shares, err := Deal(3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded KeySet
+	if err = decoded.FromBytes(ks.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err = decoded.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range shares {
+		if err = decoded.VerifyShare(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msg := []byte("ballot")
+	c, err := decoded.Encrypt(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indices []uint32
+	var partials []PartialDecryption
+	for _, i := range []int{4, 1, 2} {
+		pd, err := shares[i].Decrypt(c.Ephemeral)
+		if err != nil {
+			t.Fatal(err)
+		}
+		indices = append(indices, shares[i].Index)
+		partials = append(partials, pd)
+	}
+	if _, err = ks.Combine(c, indices[:2], partials[:2]); err != ErrNotEnoughPartials {
+		t.Error("two partials should not be enough")
+	}
+	// A partial attributed to the wrong trustee is rejected
+	if err = ks.VerifyPartial(indices[1], c.Ephemeral, partials[0]); err != ErrInvalidPartial {
+		t.Error("misattributed partial accepted")
+	}
+	p, err := ks.Combine(c, indices, partials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p, msg) {
+		t.Error("wrong plaintext")
+	}
+	ks.VerificationKeys[4] = ks.VerificationKeys[3]
+	if ks.Validate() != ErrInvalidKeySet {
+		t.Error("inconsistent key set accepted")
+	}
+}
+
+func TestHomomorphicTally(t *testing.T) {
+	ks, shares, err := Deal(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binding := []byte("election")
+	votes := [][]byte{{1, 0, 0}, {0, 0, 1}, {1, 0, 0}}
+	var ballots []*VectorBallot
+	for _, v := range votes {
+		vb, err := ks.EncryptVector(v, binding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded VectorBallot
+		if err = decoded.FromBytes(vb.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		if err = ks.VerifyVector(&decoded, 3, binding); err != nil {
+			t.Fatal(err)
+		}
+		if ks.VerifyVector(&decoded, 3, []byte("other")) != ErrInvalidRangeProof {
+			t.Error("proof verified with another binding")
+		}
+		ballots = append(ballots, &decoded)
+	}
+	if _, err = ks.EncryptVector([]byte{1, 1, 0}, binding); err != ErrInvalidVote {
+		t.Error("double vote encrypted")
+	}
+	// Swapping the slots of two ballots breaks the sum proof
+	forged := *ballots[0]
+	forged.Slots = []ElGamal{ballots[0].Slots[0], ballots[1].Slots[2], ballots[0].Slots[2]}
+	forged.BitProofs = [][]byte{ballots[0].BitProofs[0], ballots[1].BitProofs[2], ballots[0].BitProofs[2]}
+	if ks.VerifyVector(&forged, 3, binding) != ErrInvalidRangeProof {
+		t.Error("forged ballot verified")
+	}
+	sums, err := AggregateVectors(ballots, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []uint64{2, 0, 1} {
+		var indices []uint32
+		var partials []PartialDecryption
+		for _, s := range shares[:2] {
+			pd, err := s.Decrypt(sums[i].A)
+			if err != nil {
+				t.Fatal(err)
+			}
+			indices = append(indices, s.Index)
+			partials = append(partials, pd)
+		}
+		count, err := ks.DecryptCount(sums[i], indices, partials, uint64(len(ballots)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != expected {
+			t.Errorf("slot %d: count %d, expected %d", i, count, expected)
+		}
+	}
+	empty, err := AggregateVectors(nil, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := ks.DecryptCount(empty[0], nil, nil, 0); err != nil || count != 0 {
+		t.Error("empty aggregate should decrypt to 0")
+	}
+}
+
+func TestTrusteeSignature(t *testing.T) {
+	ks, shares, err := Deal(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("result")
+	sig, err := shares[1].Sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ks.VerifySignature(shares[1].Index, msg, sig); err != nil {
+		t.Fatal(err)
+	}
+	if ks.VerifySignature(shares[0].Index, msg, sig) != ErrInvalidSignature {
+		t.Error("misattributed signature accepted")
+	}
+	if ks.VerifySignature(shares[1].Index, []byte("other"), sig) != ErrInvalidSignature {
+		t.Error("signature of another message accepted")
+	}
+}
+
+func TestDKG(t *testing.T) {
+	const threshold, n = 2, 3
+	binding := []byte("ceremony")
+	secrets := make([][]byte, n)
+	encKeys := make([][]byte, n)
+	for i := range secrets {
+		var err error
+		secrets[i], encKeys[i], err = GenerateEncryptionKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var dealings []*Dealing
+	for i := 1; i <= n; i++ {
+		d, err := NewDealing(uint32(i), threshold, encKeys, binding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Dealing
+		if err = decoded.FromBytes(d.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		if err = decoded.Verify(threshold, n, binding); err != nil {
+			t.Fatal(err)
+		}
+		dealings = append(dealings, &decoded)
+	}
+	if dealings[0].Verify(threshold, n, []byte("other")) != ErrInvalidDealing {
+		t.Error("dealing replayed in another ceremony")
+	}
+	// Dealer 3 corrupts the share of trustee 2, which complains
+	dealings[2].Shares[1] = dealings[1].Shares[1]
+	if _, err := dealings[2].Open(2, secrets[1], binding); err != ErrInvalidShare {
+		t.Fatalf("opened corrupted share: %v", err)
+	}
+	c, err := dealings[2].Complain(2, secrets[1], binding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Complaint
+	if err = decoded.FromBytes(c.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := decoded.Justified(dealings[2], encKeys[1], binding); !ok || err != nil {
+		t.Fatalf("justified complaint rejected: %v", err)
+	}
+	// Complaints against valid shares, or with the wrong key, are not justified
+	c, _ = dealings[0].Complain(2, secrets[1], binding)
+	if ok, err := c.Justified(dealings[0], encKeys[1], binding); ok || err != nil {
+		t.Errorf("unjustified complaint: %v, %v", ok, err)
+	}
+	c, _ = dealings[0].Complain(2, secrets[0], binding)
+	if _, err := c.Justified(dealings[0], encKeys[1], binding); err != ErrInvalidComplaint {
+		t.Errorf("complaint with the wrong key: %v", err)
+	}
+
+	// Dealer 3 is disqualified
+	qualified := dealings[:2]
+	ks, err := JointKeySet(threshold, n, qualified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ks.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = JointKeySet(threshold, n, qualified[:1]); err != ErrNotEnoughDealers {
+		t.Error("joint key of a single dealer")
+	}
+	shares := make([]Share, n)
+	for j := 1; j <= n; j++ {
+		var opened []Share
+		for _, d := range qualified {
+			s, err := d.Open(uint32(j), secrets[j-1], binding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opened = append(opened, s)
+		}
+		shares[j-1] = JointShare(uint32(j), opened)
+		if err = ks.VerifyShare(shares[j-1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msg := []byte("ballot")
+	ct, err := ks.Encrypt(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var partials []PartialDecryption
+	for _, s := range shares[1:] {
+		pd, err := s.Decrypt(ct.Ephemeral)
+		if err != nil {
+			t.Fatal(err)
+		}
+		partials = append(partials, pd)
+	}
+	if p, err := ks.Combine(ct, []uint32{2, 3}, partials); err != nil || !bytes.Equal(p, msg) {
+		t.Errorf("decrypted %q: %v", p, err)
+	}
+}
+
+func TestHybridDecryption(t *testing.T) {
+	if !mlkemAvailable {
+		t.Skip(ErrHybridUnavailable)
+	}
+	ks, shares, err := DealHybrid(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded KeySet
+	if err = decoded.FromBytes(ks.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err = decoded.Validate(); err != nil || len(decoded.HybridKeys) != 3 {
+		t.Fatalf("hybrid key set: %v", err)
+	}
+	var share Share
+	if err = share.FromBytes(shares[2].Bytes()); err != nil || !bytes.Equal(share.Hybrid, shares[2].Hybrid) {
+		t.Fatalf("hybrid share: %v", err)
+	}
+	msg := []byte("ballot")
+	c, err := decoded.Encrypt(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed Ciphertext
+	if err = parsed.FromBytes(c.Bytes()); err != nil || len(parsed.Hybrid) != 3 {
+		t.Fatalf("hybrid ciphertext: %v", err)
+	}
+	var indices []uint32
+	var partials []PartialDecryption
+	for _, i := range []int{2, 0} {
+		pd, err := shares[i].DecryptCiphertext(ks, parsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		indices = append(indices, shares[i].Index)
+		partials = append(partials, pd)
+	}
+	p, err := ks.Combine(parsed, indices, partials)
+	if err != nil || !bytes.Equal(p, msg) {
+		t.Fatalf("hybrid ciphertext not decrypted: %v", err)
+	}
+	// The ElGamal partials alone, as a quantum attacker could compute them, do not decrypt
+	partials[1].Share = partials[0].Share
+	if _, err = ks.Combine(parsed, indices, partials); err != ErrNotEnoughPartials {
+		t.Errorf("partial with a wrong hybrid share accepted: %v", err)
+	}
+	partials[0].Share, partials[1].Share = nil, nil
+	if _, err = ks.Combine(parsed, indices, partials); err != ErrNotEnoughPartials {
+		t.Errorf("partials without hybrid shares accepted: %v", err)
+	}
+	// Wrapped shares are bound to their trustee
+	parsed.Hybrid[0], parsed.Hybrid[2] = parsed.Hybrid[2], parsed.Hybrid[0]
+	if _, err = shares[2].DecryptCiphertext(ks, parsed); err != ErrInvalidHybridWrap {
+		t.Errorf("moved wrapped share: %v", err)
+	}
+	if _, err = (&Share{Index: 1, Secret: shares[0].Secret}).DecryptCiphertext(ks, c); err != ErrNoHybridKey {
+		t.Errorf("share without hybrid key: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package tzkt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+// Maximum page size accepted by the TzKT API.
+const pageSize = 10000
+
+// Number of addresses per public key lookup.
+const keyBatchSize = 100
+
+/*
+Queries a TzKT indexer, e.g. "https://api.tzkt.io", to bootstrap eligibility lists
+from Tezos token holders or baker delegators.
+*/
+type Indexer struct {
+	url    string
+	client http.Client
+}
+
+func NewIndexer(url string) *Indexer {
+	return &Indexer{url: strings.TrimSuffix(url, "/")}
+}
+
+// A Tezos account holding a balance at a snapshot. Balances are decimal strings
+// in the smallest unit of the token (or mutez for delegators).
+type Holder struct {
+	Address string
+	Balance string
+}
+
+func (ix *Indexer) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ix.url+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := ix.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("pebble: tzkt status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+/*
+Returns the holders of a positive balance of an FA1.2 or FA2 token at the given block level.
+FA1.2 tokens have token ID "0".
+*/
+func (ix *Indexer) TokenHolders(ctx context.Context, contract, tokenId string, level int64) ([]Holder, error) {
+	var holders []Holder
+	for offset := 0; ; offset += pageSize {
+		query := url.Values{
+			"token.contract": {contract},
+			"token.tokenId":  {tokenId},
+			"balance.gt":     {"0"},
+			"select":         {"account,balance"},
+			"limit":          {strconv.Itoa(pageSize)},
+			"offset":         {strconv.Itoa(offset)},
+		}
+		var page []struct {
+			Account struct {
+				Address string `json:"address"`
+			} `json:"account"`
+			Balance string `json:"balance"`
+		}
+		err := ix.get(ctx, "/v1/tokens/historical_balances/"+strconv.FormatInt(level, 10), query, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range page {
+			holders = append(holders, Holder{b.Account.Address, b.Balance})
+		}
+		if len(page) < pageSize {
+			return holders, nil
+		}
+	}
+}
+
+// Returns the delegators of a baker at the snapshot of the given cycle, with their delegated balance.
+func (ix *Indexer) Delegators(ctx context.Context, baker string, cycle int) ([]Holder, error) {
+	var holders []Holder
+	for offset := 0; ; offset += pageSize {
+		query := url.Values{
+			"limit":  {strconv.Itoa(pageSize)},
+			"offset": {strconv.Itoa(offset)},
+		}
+		var split struct {
+			Delegators []struct {
+				Address          string `json:"address"`
+				DelegatedBalance int64  `json:"delegatedBalance"`
+			} `json:"delegators"`
+		}
+		err := ix.get(ctx, "/v1/rewards/split/"+baker+"/"+strconv.Itoa(cycle), query, &split)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range split.Delegators {
+			if d.DelegatedBalance > 0 {
+				holders = append(holders, Holder{d.Address, strconv.FormatInt(d.DelegatedBalance, 10)})
+			}
+		}
+		if len(split.Delegators) < pageSize {
+			return holders, nil
+		}
+	}
+}
+
+// Returns the public keys of the revealed accounts among addresses.
+func (ix *Indexer) PublicKeys(ctx context.Context, addresses []string) (map[string]string, error) {
+	keys := make(map[string]string, len(addresses))
+	for i := 0; i < len(addresses); i += keyBatchSize {
+		batch := addresses[i:]
+		if len(batch) > keyBatchSize {
+			batch = batch[:keyBatchSize]
+		}
+		query := url.Values{
+			"address.in": {strings.Join(batch, ",")},
+			"select":     {"address,publicKey"},
+			"limit":      {strconv.Itoa(len(batch))},
+		}
+		var accounts []struct {
+			Address   string `json:"address"`
+			PublicKey string `json:"publicKey"`
+		}
+		err := ix.get(ctx, "/v1/accounts", query, &accounts)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range accounts {
+			if a.PublicKey != "" {
+				keys[a.Address] = a.PublicKey
+			}
+		}
+	}
+	return keys, nil
+}
+
+/*
+Looks up the public keys of the holders and returns their eligibility entries,
+identified by address and optionally weighted by balance.
+Holders that never revealed their public key cannot sign credentials;
+their addresses are returned separately.
+*/
+func (ix *Indexer) EligibilityEntries(ctx context.Context, holders []Holder, weights bool) (entries []structs.EligibilityEntry, unrevealed []string, err error) {
+	addresses := make([]string, len(holders))
+	for i, h := range holders {
+		addresses[i] = h.Address
+	}
+	keys, err := ix.PublicKeys(ctx, addresses)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, h := range holders {
+		key, ok := keys[h.Address]
+		if !ok {
+			unrevealed = append(unrevealed, h.Address)
+			continue
+		}
+		e := structs.EligibilityEntry{Key: key, Id: h.Address}
+		if weights {
+			e.Weight = h.Balance
+		}
+		entries = append(entries, e)
+	}
+	return entries, unrevealed, nil
+}
@@ -0,0 +1,54 @@
+package tzkt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTokenHolders(t *testing.T) {
+	const key = "edpkuBknW28nW72KG6RoHtYW7p12T6GKc7nAbwYX5m8Wd9sDVC9yav"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/tokens/historical_balances/100"):
+			if r.URL.Query().Get("token.contract") != "KT1Token" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`[{"account":{"address":"tz1Revealed"},"balance":"42"},{"account":{"address":"tz1Hidden"},"balance":"7"}]`))
+		case r.URL.Path == "/v1/accounts":
+			json.NewEncoder(w).Encode([]map[string]string{
+				{"address": "tz1Revealed", "publicKey": key},
+				{"address": "tz1Hidden"},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	ix := NewIndexer(srv.URL + "/")
+	holders, err := ix.TokenHolders(ctx, "KT1Token", "0", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holders) != 2 || holders[0] != (Holder{"tz1Revealed", "42"}) {
+		t.Fatalf("unexpected holders %v", holders)
+	}
+	entries, unrevealed, err := ix.EligibilityEntries(ctx, holders, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Key != key || entries[0].Id != "tz1Revealed" || entries[0].Weight != "42" {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	if len(unrevealed) != 1 || unrevealed[0] != "tz1Hidden" {
+		t.Fatalf("unexpected unrevealed %v", unrevealed)
+	}
+	if _, err := ix.Delegators(ctx, "tz1Baker", 1); err == nil {
+		t.Fatal("expected status error")
+	}
+}
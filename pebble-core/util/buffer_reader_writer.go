@@ -9,7 +9,15 @@ type BufferReader struct {
 	buf []byte
 }
 
-var errNonCanonicalVector = errors.New("pebble: non canonical length encoding")
+var (
+	errNonCanonicalVector = errors.New("pebble: non canonical length encoding")
+	errNonCanonicalVarint = errors.New("pebble: non canonical varint encoding")
+	errVarintOverflow     = errors.New("pebble: varint overflows 64 bits")
+	ErrTooLarge           = errors.New("pebble: length or count exceeds maximum")
+)
+
+// Maximum encoded length of a 64-bit varint.
+const maxVarintLen = 10
 
 func NewBufferReader(buf []byte) *BufferReader {
 	return &BufferReader{buf}
@@ -73,6 +81,92 @@ func (r *BufferReader) ReadVector() (p []byte, err error) {
 	return r.ReadBytes(l)
 }
 
+/*
+Reads an unsigned LEB128 varint, as written by WriteUvarint.
+Rejects encodings with redundant trailing zero groups, so each value has a single encoding.
+*/
+func (r *BufferReader) ReadUvarint() (uint64, error) {
+	var n uint64
+	for i := 0; i < maxVarintLen; i++ {
+		if i >= len(r.buf) {
+			return 0, io.ErrShortBuffer
+		}
+		b := r.buf[i]
+		if i == maxVarintLen-1 && b > 1 {
+			return 0, errVarintOverflow
+		}
+		n |= uint64(b&0x7F) << (7 * i)
+		if b < 0x80 {
+			if b == 0 && i > 0 {
+				return 0, errNonCanonicalVarint
+			}
+			r.buf = r.buf[i+1:]
+			return n, nil
+		}
+	}
+	return 0, errVarintOverflow
+}
+
+// Reads a varint count or length, failing with ErrTooLarge if it exceeds max.
+func (r *BufferReader) ReadUvarintMax(max uint64) (uint64, error) {
+	n, err := r.ReadUvarint()
+	if err != nil {
+		return 0, err
+	}
+	if n > max {
+		return 0, ErrTooLarge
+	}
+	return n, nil
+}
+
+// Reports whether the remaining bytes can hold n items of at least size bytes each.
+func (r *BufferReader) Holds(n, size int) bool {
+	return size <= 0 || n <= len(r.buf)/size
+}
+
+/*
+Reads a varint count of items taking at least minSize bytes each. Fails with ErrTooLarge
+if the count exceeds max or the remaining bytes cannot hold that many items, so that
+callers may allocate the items before reading them.
+*/
+func (r *BufferReader) ReadCount(max uint64, minSize int) (int, error) {
+	n, err := r.ReadUvarintMax(max)
+	if err != nil {
+		return 0, err
+	}
+	if !r.Holds(int(n), minSize) {
+		return 0, ErrTooLarge
+	}
+	return int(n), nil
+}
+
+/*
+Reads a varint length-prefixed vector, as written by WriteVarVector.
+Fails with ErrTooLarge if the length exceeds max, before reading the contents.
+*/
+func (r *BufferReader) ReadVarVector(max int) ([]byte, error) {
+	l, err := r.ReadUvarintMax(uint64(max))
+	if err != nil {
+		return nil, err
+	}
+	if l == 0 {
+		return nil, nil
+	}
+	return r.ReadBytes(int(l))
+}
+
+// Reads a legacy vector, failing with ErrTooLarge if its length exceeds max.
+func (r *BufferReader) ReadVectorMax(max int) ([]byte, error) {
+	p, err := r.ReadVector()
+	if err != nil {
+		return nil, err
+	}
+	if len(p) > max {
+		return nil, ErrTooLarge
+	}
+	return p, nil
+}
+
 func (r *BufferReader) ReadByte() (byte, error) {
 	if len(r.buf) == 0 {
 		return 0, io.ErrShortBuffer
@@ -171,3 +265,18 @@ func (w *BufferWriter) WriteUint32(n uint32) {
 func (w *BufferWriter) WriteUint64(n uint64) {
 	w.Buffer = append(w.Buffer, byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32), byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
 }
+
+// Writes n as an unsigned LEB128 varint of 1 to 10 bytes.
+func (w *BufferWriter) WriteUvarint(n uint64) {
+	for n >= 0x80 {
+		w.Buffer = append(w.Buffer, byte(n)|0x80)
+		n >>= 7
+	}
+	w.Buffer = append(w.Buffer, byte(n))
+}
+
+// Writes p prefixed with its length as a varint. Unlike WriteVector, p may have any length.
+func (w *BufferWriter) WriteVarVector(p []byte) {
+	w.WriteUvarint(uint64(len(p)))
+	w.Buffer = append(w.Buffer, p...)
+}
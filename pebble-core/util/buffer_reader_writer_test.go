@@ -0,0 +1,105 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestUvarintRoundTrip(t *testing.T) {
+	values := []uint64{0, 1, 127, 128, 255, 300, 16383, 16384, 1<<32 - 1, 1 << 32, 1<<63 - 1, 1 << 63, math.MaxUint64}
+	var w BufferWriter
+	for _, n := range values {
+		w.WriteUvarint(n)
+	}
+	r := NewBufferReader(w.Buffer)
+	for _, n := range values {
+		m, err := r.ReadUvarint()
+		if err != nil {
+			t.Fatalf("%d: %v", n, err)
+		}
+		if m != n {
+			t.Errorf("read %d, expected %d", m, n)
+		}
+	}
+	if r.Len() != 0 {
+		t.Error("trailing bytes")
+	}
+	w = BufferWriter{}
+	w.WriteUvarint(math.MaxUint64)
+	if len(w.Buffer) != maxVarintLen {
+		t.Errorf("max uint64 takes %d bytes", len(w.Buffer))
+	}
+}
+
+func TestUvarintInvalid(t *testing.T) {
+	cases := []struct {
+		name string
+		p    []byte
+		err  error
+	}{
+		{"empty", nil, io.ErrShortBuffer},
+		{"truncated", []byte{0x80, 0x80}, io.ErrShortBuffer},
+		{"redundant zero group", []byte{0x81, 0x00}, errNonCanonicalVarint},
+		{"padded zero", []byte{0x80, 0x00}, errNonCanonicalVarint},
+		{"65 bits", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x02}, errVarintOverflow},
+		{"11 bytes", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x81, 0x00}, errVarintOverflow},
+	}
+	for _, c := range cases {
+		r := NewBufferReader(c.p)
+		if _, err := r.ReadUvarint(); err != c.err {
+			t.Errorf("%s: got %v, expected %v", c.name, err, c.err)
+		}
+	}
+}
+
+func TestVarVector(t *testing.T) {
+	long := bytes.Repeat([]byte{7}, 0x10000)
+	var w BufferWriter
+	w.WriteVarVector(nil)
+	w.WriteVarVector([]byte("pebble"))
+	w.WriteVarVector(long)
+	r := NewBufferReader(w.Buffer)
+	for _, expected := range [][]byte{nil, []byte("pebble"), long} {
+		p, err := r.ReadVarVector(len(long))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(p, expected) {
+			t.Error("vector mismatch")
+		}
+	}
+	// The length is checked against the maximum before the contents are read
+	r = NewBufferReader(w.Buffer[1:])
+	r.ReadVarVector(6)
+	if _, err := r.ReadVarVector(len(long) - 1); err != ErrTooLarge {
+		t.Errorf("oversized vector: %v", err)
+	}
+	// A length beyond the buffer fails without allocating
+	r = NewBufferReader([]byte{0xFF, 0xFF, 0xFF, 0x7F})
+	if _, err := r.ReadVarVector(math.MaxInt32); err != io.ErrShortBuffer {
+		t.Errorf("truncated vector: %v", err)
+	}
+	w = BufferWriter{}
+	w.WriteVector(bytes.Repeat([]byte{1}, 200))
+	if _, err := NewBufferReader(w.Buffer).ReadVectorMax(199); err != ErrTooLarge {
+		t.Errorf("oversized legacy vector: %v", err)
+	}
+}
+
+func TestReadCount(t *testing.T) {
+	var w BufferWriter
+	w.WriteUvarint(3)
+	w.Write(make([]byte, 6))
+	if n, err := NewBufferReader(w.Buffer).ReadCount(3, 2); err != nil || n != 3 {
+		t.Errorf("count: %d, %v", n, err)
+	}
+	if _, err := NewBufferReader(w.Buffer).ReadCount(2, 2); err != ErrTooLarge {
+		t.Errorf("count above the maximum: %v", err)
+	}
+	// The remaining bytes cannot hold 3 items of 3 bytes
+	if _, err := NewBufferReader(w.Buffer).ReadCount(3, 3); err != ErrTooLarge {
+		t.Errorf("count beyond the buffer: %v", err)
+	}
+}
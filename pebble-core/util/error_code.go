@@ -0,0 +1,88 @@
+package util
+
+import "fmt"
+
+// Stable machine-readable code of an error reported by the HTTP APIs, so that frontends can show meaningful messages.
+type ErrorCode string
+
+const (
+	// The operation is not allowed in the current election phase, or the registration window is closed.
+	ErrorWrongPhase ErrorCode = "wrong-phase"
+	// The invitation or registration link cannot be read or has been used.
+	ErrorInvalidInvitation ErrorCode = "invalid-invitation"
+	// The key is not in the eligibility list, or its eligibility proof is invalid.
+	ErrorNotEligible ErrorCode = "not-eligible"
+	// Creating or verifying a VDF solution failed.
+	ErrorVdfFailed ErrorCode = "vdf-failed"
+	// The message cannot be read, or its signature is invalid.
+	ErrorInvalidMessage ErrorCode = "invalid-message"
+	// The message was posted before.
+	ErrorDuplicate ErrorCode = "duplicate"
+	// The message lacks the proof of work required by the election.
+	ErrorInsufficientWork ErrorCode = "insufficient-work"
+	// The identity or key is already registered.
+	ErrorAlreadyRegistered ErrorCode = "already-registered"
+	// The request, or a length or count it encodes, exceeds the limits of the server.
+	ErrorTooLarge ErrorCode = "too-large"
+	// The election to create exceeds an operational limit of the server, named by APIError.Limit.
+	ErrorLimitExceeded ErrorCode = "limit-exceeded"
+
+	// Generic codes of the HTTP status codes, for errors without a more specific code.
+	ErrorInvalidRequest   ErrorCode = "invalid-request"
+	ErrorUnauthorized     ErrorCode = "unauthorized"
+	ErrorForbidden        ErrorCode = "forbidden"
+	ErrorNotFound         ErrorCode = "not-found"
+	ErrorMethodNotAllowed ErrorCode = "method-not-allowed"
+	ErrorConflict         ErrorCode = "conflict"
+	ErrorRateLimited      ErrorCode = "rate-limited"
+	ErrorInternal         ErrorCode = "internal"
+	ErrorUpstream         ErrorCode = "upstream"
+	ErrorUnavailable      ErrorCode = "unavailable"
+)
+
+// Returns the generic code of errors reported with the HTTP status code.
+func StatusErrorCode(statusCode int) ErrorCode {
+	switch statusCode {
+	case 401:
+		return ErrorUnauthorized
+	case 403:
+		return ErrorForbidden
+	case 404:
+		return ErrorNotFound
+	case 405:
+		return ErrorMethodNotAllowed
+	case 409:
+		return ErrorConflict
+	case 413:
+		return ErrorTooLarge
+	case 429:
+		return ErrorRateLimited
+	case 502:
+		return ErrorUpstream
+	case 503:
+		return ErrorUnavailable
+	}
+	if statusCode >= 500 {
+		return ErrorInternal
+	}
+	return ErrorInvalidRequest
+}
+
+// An error reported by an HTTP API, with a code and a human-readable message.
+type APIError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// For limit-exceeded errors, the limit exceeded, its maximum and the value requested.
+	Limit string `json:"limit,omitempty"`
+	Max   uint64 `json:"max,omitempty"`
+	Value uint64 `json:"value,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("pebble: %s: %s", e.Code, e.Message)
+}
+
+// The JSON body of the error responses of the HTTP APIs: {"error": {"code": ..., "message": ...}}.
+type ErrorEnvelope struct {
+	Error APIError `json:"error"`
+}
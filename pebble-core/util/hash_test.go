@@ -0,0 +1,56 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHashScheme(t *testing.T) {
+	a, b := []byte("pebble"), []byte("voting")
+	if LegacyHashScheme.Sum(DomainBallot, a, b) != HashAll(a, b) {
+		t.Error("legacy scheme differs from HashAll")
+	}
+	if LegacyHashScheme.Sum(DomainBallot, a) != LegacyHashScheme.Sum(DomainParams, a) {
+		t.Error("legacy scheme depends on the domain")
+	}
+	for _, alg := range []HashAlgorithm{SHA256, BLAKE3} {
+		s := HashScheme{Algorithm: alg, Separated: true}
+		h := s.Sum(DomainBallot, a, b)
+		if h == HashAll(a, b) {
+			t.Errorf("%v: separated hash equals legacy hash", alg)
+		}
+		if h == s.Sum(DomainCredential, a, b) {
+			t.Errorf("%v: domains not separated", alg)
+		}
+		if h == s.Sum(DomainBallot, []byte("pebblev"), []byte("oting")) {
+			t.Errorf("%v: part boundaries not separated", alg)
+		}
+	}
+	sha := HashScheme{Algorithm: SHA256, Separated: true}
+	b3 := HashScheme{Algorithm: BLAKE3, Separated: true}
+	if sha.Sum(DomainBallot, a) == b3.Sum(DomainBallot, a) {
+		t.Error("algorithms produce the same hash")
+	}
+}
+
+func TestHashAlgorithmRegistry(t *testing.T) {
+	for _, name := range []string{"sha256", "blake3"} {
+		alg, err := ParseHashAlgorithm(name)
+		if err != nil || alg.String() != name || !alg.Available() {
+			t.Errorf("%s not registered", name)
+		}
+	}
+	if _, err := ParseHashAlgorithm("md5"); err != ErrUnknownHashAlgorithm {
+		t.Errorf("unknown name: %v", err)
+	}
+	if _, err := HashAlgorithm(0xFF).New(); err != ErrUnknownHashAlgorithm {
+		t.Errorf("unknown algorithm: %v", err)
+	}
+	f, _ := BLAKE3.New()
+	f.Write([]byte("abc"))
+	// BLAKE3 test vector for "abc"
+	expected := []byte{0x64, 0x37, 0xb3, 0xac, 0x38, 0x46, 0x51, 0x33}
+	if !bytes.Equal(f.Sum(nil)[:8], expected) {
+		t.Errorf("unexpected BLAKE3 digest %x", f.Sum(nil))
+	}
+}
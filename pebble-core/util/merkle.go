@@ -0,0 +1,94 @@
+package util
+
+/*
+Merkle trees over leaf hashes in order. Inner nodes are H(0x01 || left || right), and a node
+without a sibling is promoted to the next level unchanged. Leaves are hashed by the callers,
+prefixed with 0x00 so that they cannot be mistaken for inner nodes. Paths hold the sibling
+hashes from the leaf up.
+*/
+
+func merkleNode(left, right HashValue) HashValue {
+	return HashAll([]byte{1}, left[:], right[:])
+}
+
+// Computes the next level of the tree.
+func merkleParents(level []HashValue) []HashValue {
+	next := make([]HashValue, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 < len(level) {
+			next = append(next, merkleNode(level[i], level[i+1]))
+		} else {
+			next = append(next, level[i])
+		}
+	}
+	return next
+}
+
+// Computes the Merkle root of the leaves. The root of an empty tree is the zero hash.
+func MerkleRoot(leaves []HashValue) HashValue {
+	if len(leaves) == 0 {
+		return HashValue{}
+	}
+	for len(leaves) > 1 {
+		leaves = merkleParents(leaves)
+	}
+	return leaves[0]
+}
+
+// Collects the sibling hashes of the leaf at index.
+func MerklePath(leaves []HashValue, index int) []HashValue {
+	var path []HashValue
+	for len(leaves) > 1 {
+		if sib := index ^ 1; sib < len(leaves) {
+			path = append(path, leaves[sib])
+		}
+		leaves = merkleParents(leaves)
+		index /= 2
+	}
+	return path
+}
+
+// Computes every level of the tree, from the leaves up to the root.
+func MerkleLevels(leaves []HashValue) [][]HashValue {
+	levels := [][]HashValue{leaves}
+	for len(leaves) > 1 {
+		leaves = merkleParents(leaves)
+		levels = append(levels, leaves)
+	}
+	return levels
+}
+
+// Collects the sibling hashes of the leaf at index from levels computed with MerkleLevels.
+func MerkleLevelsPath(levels [][]HashValue, index int) []HashValue {
+	var path []HashValue
+	for _, level := range levels[:len(levels)-1] {
+		if sib := index ^ 1; sib < len(level) {
+			path = append(path, level[sib])
+		}
+		index /= 2
+	}
+	return path
+}
+
+// Checks the path of the leaf at index against the root of a tree with count leaves.
+func VerifyMerklePath(root HashValue, count, index uint64, leaf HashValue, path []HashValue) bool {
+	if index >= count {
+		return false
+	}
+	h := leaf
+	for n := count; n > 1; index, n = index/2, (n+1)/2 {
+		if index^1 >= n {
+			continue
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if index%2 == 0 {
+			h = merkleNode(h, path[0])
+		} else {
+			h = merkleNode(path[0], h)
+		}
+		path = path[1:]
+	}
+	return len(path) == 0 && h == root
+}
@@ -17,9 +17,14 @@ var (
 	twoExpDelta = new(big.Int).Exp(two, big.NewInt(delta), nil)
 )
 
+/*
+Pietrzak VDF over RSA groups. Inputs declare the difficulty of their puzzle, the number of
+squarings, which must be even and within [MinDifficulty, MaxDifficulty] to verify.
+*/
 type PietrzakVdf struct {
 	MaxDifficulty        uint64
 	DifficultyConversion uint64
+	MinDifficulty        uint64
 }
 
 type intSerializer struct {
@@ -109,6 +114,40 @@ func (vdf *PietrzakVdf) Create(seconds uint64) (sol VdfSolution, err error) {
 	if t > vdf.MaxDifficulty {
 		t = vdf.MaxDifficulty
 	}
+	// Verify only accepts even difficulties
+	t -= t % 2
+	if t < vdf.MinDifficulty {
+		t = vdf.MinDifficulty + vdf.MinDifficulty%2
+	}
+	return vdf.create(t)
+}
+
+// Creates a puzzle of the given difficulty, such as fits the device that will solve it.
+func (vdf *PietrzakVdf) CreateWithDifficulty(t uint64) (VdfSolution, error) {
+	if err := vdf.checkDifficulty(t); err != nil {
+		return VdfSolution{}, err
+	}
+	return vdf.create(t)
+}
+
+// Returns the difficulty declared by the input, or an error if it is out of bounds.
+func (vdf *PietrzakVdf) Difficulty(input []byte) (uint64, error) {
+	ser := intSerializer{input}
+	t := ser.ReadUint64()
+	return t, vdf.checkDifficulty(t)
+}
+
+func (vdf *PietrzakVdf) checkDifficulty(t uint64) error {
+	if t < vdf.MinDifficulty || t > vdf.MaxDifficulty {
+		return newError("time difficulty out of bounds")
+	}
+	if t%2 != 0 {
+		return newError("time difficulty not even")
+	}
+	return nil
+}
+
+func (vdf *PietrzakVdf) create(t uint64) (sol VdfSolution, err error) {
 	p, err := rand.Prime(rand.Reader, modulusBits/2)
 	if err != nil {
 		return sol, err
@@ -181,7 +220,7 @@ func (vdf *PietrzakVdf) solve(input []byte, sqr squarer) (sol VdfSolution, err e
 	}
 	x.Rem(x, n)
 	if sqr == nil {
-		sqr = &repeatedSquarer{n}
+		sqr = newSquarer(n)
 	}
 	y := sqr.Eval(x, t)
 	sol.Input = input
@@ -218,11 +257,11 @@ func (vdf *PietrzakVdf) Verify(sol VdfSolution) error {
 	t := ser.ReadUint64()
 	n := ser.Read()
 	x := ser.Read()
-	if t > vdf.MaxDifficulty || n == nil || x == nil {
+	if n == nil || x == nil {
 		return newError("failed to parse vdf input")
 	}
-	if t%2 != 0 {
-		return newError("time difficulty not even")
+	if err := vdf.checkDifficulty(t); err != nil {
+		return err
 	}
 	x.Rem(x, n)
 	y := new(big.Int)
@@ -269,7 +308,7 @@ func (vdf *PietrzakVdf) Verify(sol VdfSolution) error {
 		x = expAndMul(x, r, mu, n)
 		y = expAndMul(mu, r, y, n)
 	}
-	if (&repeatedSquarer{n}).Eval(x, t).Cmp(y) != 0 {
+	if newSquarer(n).Eval(x, t).Cmp(y) != 0 {
 		return newError("final evaluation check failed")
 	}
 	return nil
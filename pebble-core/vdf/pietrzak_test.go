@@ -1,12 +1,13 @@
 package vdf
 
 import (
+	"math/big"
 	"math/rand"
 	"testing"
 )
 
 func TestSolvePietrzak(t *testing.T) {
-	var vdf VDF = &PietrzakVdf{1 << 63, 10001}
+	var vdf VDF = &PietrzakVdf{MaxDifficulty: 1 << 63, DifficultyConversion: 10001}
 	puz, err := vdf.Create(uint64(1 + rand.Int31n(10)))
 	if err != nil {
 		t.Error(err.Error())
@@ -24,3 +25,76 @@ func TestSolvePietrzak(t *testing.T) {
 		t.Error(err.Error())
 	}
 }
+
+func TestPietrzakDifficulty(t *testing.T) {
+	vdf := &PietrzakVdf{MaxDifficulty: 1000, DifficultyConversion: 100, MinDifficulty: 200}
+	puz, err := vdf.CreateWithDifficulty(300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err := vdf.Difficulty(puz.Input); err != nil || d != 300 {
+		t.Errorf("difficulty %d: %v", d, err)
+	}
+	if err = vdf.Verify(puz); err != nil {
+		t.Error(err)
+	}
+	for _, d := range []uint64{100, 301, 2000} {
+		if _, err = vdf.CreateWithDifficulty(d); err == nil {
+			t.Errorf("difficulty %d accepted", d)
+		}
+	}
+	// Puzzles below the minimum of the verifier do not verify
+	stricter := &PietrzakVdf{MaxDifficulty: 1000, MinDifficulty: 400}
+	if err = stricter.Verify(puz); err == nil {
+		t.Error("puzzle below the minimum difficulty verified")
+	}
+	puz, err = vdf.Create(1)
+	if d, _ := vdf.Difficulty(puz.Input); err != nil || d != 200 {
+		t.Errorf("short puzzle of difficulty %d: %v", d, err)
+	}
+}
+
+// Returns a random modulus of the size used by the VDF, and an element of its group.
+func randomGroup(tb testing.TB) (n, x *big.Int) {
+	puz, err := (&PietrzakVdf{MaxDifficulty: 2}).Create(0)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	ser := intSerializer{puz.Input}
+	ser.ReadUint64()
+	return ser.Read(), ser.Read()
+}
+
+func TestSquarer(t *testing.T) {
+	n, x := randomGroup(t)
+	for _, steps := range []uint64{0, 1, delta - 1, delta, 2*delta + 3} {
+		want := (&repeatedSquarer{n}).Eval(x, steps)
+		if got := newSquarer(n).Eval(x, steps); got.Cmp(want) != 0 {
+			t.Errorf("%s: %d squarings differ", SquaringBackend, steps)
+		}
+	}
+}
+
+func BenchmarkSquarer(b *testing.B) {
+	n, x := randomGroup(b)
+	sqr := newSquarer(n)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sqr.Eval(x, 1<<16)
+	}
+}
+
+func BenchmarkSolve(b *testing.B) {
+	vdf := &PietrzakVdf{MaxDifficulty: 1 << 16, DifficultyConversion: 1 << 16}
+	puz, err := vdf.Create(1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err = vdf.Solve(puz.Input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
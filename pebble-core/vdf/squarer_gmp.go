@@ -0,0 +1,69 @@
+//go:build gmp && cgo
+// +build gmp,cgo
+
+package vdf
+
+/*
+#cgo LDFLAGS: -lgmp
+#include <stdlib.h>
+#include <string.h>
+#include <gmp.h>
+
+// Squares x modulo n t times, by exponentiations to 2^delta, writing the result
+// to out, which holds as many bytes as n, big-endian.
+static void pebble_square(const unsigned char *x, size_t xlen, const unsigned char *n, size_t nlen,
+		unsigned long long t, unsigned long delta, unsigned char *out) {
+	mpz_t r, m, e;
+	size_t size, count;
+	mpz_inits(r, m, e, NULL);
+	mpz_import(r, xlen, 1, 1, 1, 0, x);
+	mpz_import(m, nlen, 1, 1, 1, 0, n);
+	mpz_setbit(e, delta);
+	for (; t >= delta; t -= delta) {
+		mpz_powm(r, r, e, m);
+	}
+	for (; t > 0; t--) {
+		mpz_mul(r, r, r);
+		mpz_mod(r, r, m);
+	}
+	memset(out, 0, nlen);
+	size = (mpz_sizeinbase(r, 2) + 7) / 8;
+	if (size <= nlen) {
+		mpz_export(out + nlen - size, &count, 1, 1, 1, 0, r);
+	}
+	mpz_clears(r, m, e, NULL);
+}
+*/
+import "C"
+
+import (
+	"math/big"
+	"unsafe"
+)
+
+// Name of the backend of the repeated squarings of the VDF.
+const SquaringBackend = "gmp"
+
+// Evaluates the repeated squarings with GMP, about twice as fast as math/big on amd64.
+type gmpSquarer struct {
+	n []byte
+}
+
+func newSquarer(n *big.Int) squarer {
+	return &gmpSquarer{n.Bytes()}
+}
+
+func (s *gmpSquarer) Eval(x *big.Int, t uint64) *big.Int {
+	xb := x.Bytes()
+	out := make([]byte, len(s.n))
+	C.pebble_square(cBytes(xb), C.size_t(len(xb)), cBytes(s.n), C.size_t(len(s.n)),
+		C.ulonglong(t), C.ulong(delta), cBytes(out))
+	return new(big.Int).SetBytes(out)
+}
+
+func cBytes(b []byte) *C.uchar {
+	if len(b) == 0 {
+		return nil
+	}
+	return (*C.uchar)(unsafe.Pointer(&b[0]))
+}
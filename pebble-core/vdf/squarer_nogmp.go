@@ -0,0 +1,13 @@
+//go:build !gmp || !cgo
+// +build !gmp !cgo
+
+package vdf
+
+import "math/big"
+
+// Name of the backend of the repeated squarings of the VDF. Build with the gmp tag and cgo for GMP.
+const SquaringBackend = "math/big"
+
+func newSquarer(n *big.Int) squarer {
+	return &repeatedSquarer{n}
+}
@@ -10,6 +10,13 @@ type VDF interface {
 	Verify(sol VdfSolution) error
 }
 
+// Implemented by VDFs whose inputs declare the difficulty of their puzzle, which the creator may choose.
+type DifficultyVDF interface {
+	VDF
+	CreateWithDifficulty(t uint64) (VdfSolution, error)
+	Difficulty(input []byte) (uint64, error)
+}
+
 type VdfError struct {
 	s string
 }
@@ -0,0 +1,217 @@
+package voting
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+var (
+	ErrAmendmentNotAllowed = errors.New("pebble: amendment not allowed in this phase")
+	ErrAmendmentShortens   = errors.New("pebble: amendment may only extend deadlines")
+	ErrAmendmentUnsigned   = errors.New("pebble: amendments require organizer-signed params")
+)
+
+// Prefixed to the amendment bytes before signing.
+const amendmentSignatureContext = "pebble-amendment"
+
+// Flags selecting which fields an Amendment changes.
+const (
+	AmendTallyStart byte = 1 << iota
+	AmendTallyEnd
+	AmendTitle
+	AmendDescription
+)
+
+/*
+Represents an organizer-signed change to the election parameters.
+Sequence orders amendments; Phase is the election phase the amendment was issued in,
+which clients check against the time the channel received it, and determines which fields may change:
+
+	Setup, CredGen: TallyStart, TallyEnd, Title, Description
+	Cast, Tally:    TallyEnd
+	End:            nothing
+
+Deadlines may only be extended.
+*/
+type Amendment struct {
+	Sequence             uint32
+	Phase                ElectionPhase
+	Flags                byte
+	TallyStart, TallyEnd time.Time
+	Title, Description   string
+	Signature            []byte
+}
+
+func (a *Amendment) encode(withSignature bool) []byte {
+	var w util.BufferWriter
+	w.WriteUint32(a.Sequence)
+	w.WriteByte(byte(a.Phase))
+	w.WriteByte(a.Flags)
+	if a.Flags&AmendTallyStart != 0 {
+		w.WriteUint64(uint64(a.TallyStart.Unix()))
+	}
+	if a.Flags&AmendTallyEnd != 0 {
+		w.WriteUint64(uint64(a.TallyEnd.Unix()))
+	}
+	if a.Flags&AmendTitle != 0 {
+		w.WriteVector([]byte(a.Title))
+	}
+	if a.Flags&AmendDescription != 0 {
+		w.WriteVector([]byte(a.Description))
+	}
+	if withSignature {
+		w.Write(a.Signature)
+	}
+	return w.Buffer
+}
+
+func (a *Amendment) Bytes() []byte {
+	return a.encode(true)
+}
+
+func (a *Amendment) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	a.Sequence, err = r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	phase, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	a.Phase = ElectionPhase(phase)
+	a.Flags, err = r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if a.Flags&AmendTallyStart != 0 {
+		t, err := r.ReadUint64()
+		if err != nil {
+			return err
+		}
+		a.TallyStart = time.Unix(int64(t), 0)
+	}
+	if a.Flags&AmendTallyEnd != 0 {
+		t, err := r.ReadUint64()
+		if err != nil {
+			return err
+		}
+		a.TallyEnd = time.Unix(int64(t), 0)
+	}
+	if a.Flags&AmendTitle != 0 {
+		b, err := r.ReadVector()
+		if err != nil {
+			return err
+		}
+		a.Title = string(b)
+	}
+	if a.Flags&AmendDescription != 0 {
+		b, err := r.ReadVector()
+		if err != nil {
+			return err
+		}
+		a.Description = string(b)
+	}
+	a.Signature = r.ReadRemaining()
+	return nil
+}
+
+func (a *Amendment) signingBytes(eid ElectionID) []byte {
+	return util.Concat([]byte(amendmentSignatureContext), eid[:], a.encode(false))
+}
+
+// Signs the amendment with the organizer key for the given election.
+func (a *Amendment) Sign(k pubkey.PrivateKey, eid ElectionID) error {
+	var err error
+	a.Signature, err = k.Sign(a.signingBytes(eid))
+	return err
+}
+
+// Verifies the amendment signature against the organizer key or set in the params.
+func (a *Amendment) Verify(p *ElectionParams, eid ElectionID) error {
+	return p.verifyOrganizerAction(a.signingBytes(eid), a.Signature)
+}
+
+// Returns a copy of the params with the amendment applied,
+// or an error if the amendment breaks the rules for its phase.
+func (a *Amendment) Apply(p *ElectionParams) (*ElectionParams, error) {
+	var allowed byte
+	switch a.Phase {
+	case Setup, CredGen:
+		allowed = AmendTallyStart | AmendTallyEnd | AmendTitle | AmendDescription
+	case Cast, Tally:
+		allowed = AmendTallyEnd
+	}
+	if a.Flags&^allowed != 0 {
+		return nil, ErrAmendmentNotAllowed
+	}
+	q := *p
+	if a.Flags&AmendTallyStart != 0 {
+		if a.TallyStart.Before(p.TallyStart) {
+			return nil, ErrAmendmentShortens
+		}
+		q.TallyStart = a.TallyStart
+	}
+	if a.Flags&AmendTallyEnd != 0 {
+		if a.TallyEnd.Before(p.TallyEnd) {
+			return nil, ErrAmendmentShortens
+		}
+		q.TallyEnd = a.TallyEnd
+	}
+	if a.Flags&AmendTitle != 0 {
+		q.Title = a.Title
+	}
+	if a.Flags&AmendDescription != 0 {
+		q.Description = a.Description
+	}
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// Applies the valid amendments found in msgs, in sequence order, to the params.
+// Amendments with an invalid signature or lacking the signatures of the organizer set, a reused sequence number or breaking the rules are skipped,
+// as are amendments received in another phase than the one they claim, by the schedule amended so far,
+// or without a receive time in elections that require one.
+func applyAmendments(p *ElectionParams, eid ElectionID, msgs []Message) *ElectionParams {
+	var amendments []Message
+	for _, msg := range msgs {
+		if msg.Amendment != nil {
+			amendments = append(amendments, msg)
+		}
+	}
+	if len(amendments) == 0 || p.Version < ParamsVersion2 {
+		return p
+	}
+	sort.SliceStable(amendments, func(i, j int) bool {
+		return amendments[i].Amendment.Sequence < amendments[j].Amendment.Sequence
+	})
+	applied := false
+	var last uint32
+	for _, msg := range amendments {
+		a := msg.Amendment
+		if applied && a.Sequence <= last {
+			continue
+		}
+		if p.missingReceiveTime(msg) || (!msg.Received.IsZero() && p.PhaseAt(msg.Received) != a.Phase) {
+			continue
+		}
+		if a.Verify(p, eid) != nil {
+			continue
+		}
+		q, err := a.Apply(p)
+		if err != nil {
+			continue
+		}
+		p = q
+		last = a.Sequence
+		applied = true
+	}
+	return p
+}
@@ -0,0 +1,76 @@
+package voting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+)
+
+func TestAmendmentRules(t *testing.T) {
+	params := generateParamsV1()
+	a := Amendment{Phase: Cast, Flags: AmendTitle, Title: "New title"}
+	if _, err := a.Apply(params); err != ErrAmendmentNotAllowed {
+		t.Error("title changes should not be allowed once casting began")
+	}
+	a = Amendment{Phase: Tally, Flags: AmendTallyEnd, TallyEnd: params.TallyEnd.Add(-time.Second)}
+	if _, err := a.Apply(params); err != ErrAmendmentShortens {
+		t.Error("deadlines should not be shortened")
+	}
+	a = Amendment{Phase: CredGen, Flags: AmendTallyStart | AmendTitle, TallyStart: params.TallyStart.Add(time.Second), Title: "New title"}
+	q, err := a.Apply(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Title != "New title" || !q.TallyStart.Equal(params.TallyStart.Add(time.Second)) || params.Title != "Title" {
+		t.Error("amendment not applied to a copy of the params")
+	}
+}
+
+func TestApplyAmendments(t *testing.T) {
+	organizer, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := generateParamsV1()
+	err = params.Sign(organizer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var eid ElectionID
+	first := Amendment{Sequence: 0, Phase: CredGen, Flags: AmendTitle, Title: "First"}
+	second := Amendment{Sequence: 1, Phase: CredGen, Flags: AmendTitle, Title: "Second"}
+	forged := Amendment{Sequence: 2, Phase: CredGen, Flags: AmendTitle, Title: "Forged"}
+	for _, a := range []*Amendment{&first, &second} {
+		if err := a.Sign(organizer, eid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	forged.Signature = second.Signature
+	msgs := []Message{{Amendment: &second}, {Amendment: &forged}, {Amendment: &first}}
+	q := applyAmendments(params, eid, msgs)
+	if q.Title != "Second" {
+		t.Errorf("unexpected title %q", q.Title)
+	}
+
+	// An amendment posted during Tally claiming an earlier phase is ignored
+	late := Amendment{Sequence: 3, Phase: CredGen, Flags: AmendTallyStart, TallyStart: params.TallyEnd}
+	if err := late.Sign(organizer, eid); err != nil {
+		t.Fatal(err)
+	}
+	msg := Message{Amendment: &late, Received: params.TallyStart.Add(time.Second)}
+	if q = applyAmendments(params, eid, append(msgs, msg)); !q.TallyStart.Equal(params.TallyStart) {
+		t.Error("amendment with a forged phase applied")
+	}
+	msg.Received = params.CredGenStart.Add(time.Second)
+	if q = applyAmendments(params, eid, append(msgs, msg)); !q.TallyStart.Equal(params.TallyEnd) {
+		t.Error("amendment received in its phase not applied")
+	}
+	// Elections from version 11 need the receive time
+	recent := *params
+	recent.Version = ParamsVersion11
+	msg.Received = time.Time{}
+	if q = applyAmendments(&recent, eid, []Message{msg}); !q.TallyStart.Equal(params.TallyStart) {
+		t.Error("amendment without a receive time applied")
+	}
+}
@@ -0,0 +1,480 @@
+package voting
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+var (
+	ErrArchiveFormat     = errors.New("pebble: invalid election archive")
+	ErrArchiveVersion    = errors.New("pebble: unsupported election archive version")
+	ErrArchiveElection   = errors.New("pebble: election archive of another election")
+	ErrArchiveCheckpoint = errors.New("pebble: election archive checkpoint does not match its messages")
+	ErrArchiveResult     = errors.New("pebble: election archive result does not match its tally hash")
+	ErrArchiveUnsigned   = errors.New("pebble: elections without an organizer key cannot be archived")
+	ErrArchiveClosed     = errors.New("pebble: election archive already closed")
+)
+
+/*
+Election archives keep a completed election verifiable after it is retired from the servers,
+signed by the organizer so that they can be trusted from the election ID alone.
+
+An archive is a header followed by sections. The header is the magic "PBLA", a version byte,
+the election ID, the Unix time of creation in nanoseconds as a varint and, from version 2,
+the variable-length name of the network of the election. Each section is a tag
+byte and a variable-length body, in this order:
+  - params: the params the election ID was derived from; amendments are among the messages.
+  - eligibility (optional): the full eligibility list of elections whose params only hold its root.
+  - segments: up to archiveSegmentSize messages in envelopes as served with framing version 3,
+    followed by a checkpoint: the number of messages archived so far, their ChainHead and
+    the organizer signature of both.
+  - result (optional): the canonical JSON export of the final result and its tally hash.
+  - seal: the organizer signature of the SHA-256 hash of everything before it, so that
+    a truncated archive is detected.
+*/
+const (
+	archiveMagic    = "PBLA"
+	archiveVersion1 = 1
+	// Adds the network of the election, which archives of version 1 leave to ServerNetwork.
+	archiveVersion2    = 2
+	archiveSegmentSize = 4096
+)
+
+const (
+	archiveParams byte = 1 + iota
+	archiveEligibility
+	archiveSegment
+	archiveResult
+	archiveSeal
+)
+
+// Prefixed to the signed bytes of checkpoints and seals.
+const (
+	archiveCheckpointContext = "pebble-archive-checkpoint"
+	archiveSealContext       = "pebble-archive-seal"
+)
+
+// Bounds the sections read, so that a corrupt length does not allocate more.
+const maxArchiveSection = 1 << 30
+
+// The state of the message log at the end of an archive segment, signed by the organizer.
+type ArchiveCheckpoint struct {
+	Count     uint64
+	Head      util.HashValue
+	Signature []byte
+}
+
+func (c *ArchiveCheckpoint) signingBytes(eid ElectionID) []byte {
+	var w util.BufferWriter
+	w.Write([]byte(archiveCheckpointContext))
+	w.Write(eid[:])
+	w.WriteUvarint(c.Count)
+	w.Write32(c.Head)
+	return w.Buffer
+}
+
+func archiveSealBytes(eid ElectionID, digest []byte) []byte {
+	return util.Concat([]byte(archiveSealContext), eid[:], digest)
+}
+
+/*
+Writes an election archive. Messages are written in order with Write, and the archive
+is completed by Close, before which it is not valid.
+*/
+type ArchiveWriter struct {
+	w      io.Writer
+	digest hash.Hash
+	id     ElectionID
+	params *ElectionParams
+	key    pubkey.PrivateKey
+	// Messages of the current segment.
+	pending []Message
+	count   uint64
+	head    util.HashValue
+	closed  bool
+}
+
+/*
+Starts the archive of election id on network by writing its header, params and, if not nil,
+full eligibility list. The archive is signed with the organizer key k of the params.
+*/
+func NewArchiveWriter(w io.Writer, id ElectionID, network string, params *ElectionParams, eligibility *structs.EligibilityList, k pubkey.PrivateKey) (*ArchiveWriter, error) {
+	if params.Version < ParamsVersion2 {
+		return nil, ErrArchiveUnsigned
+	}
+	if !bytes.Equal(k.Public(), params.Organizer) {
+		return nil, ErrOrganizerMismatch
+	}
+	aw := &ArchiveWriter{w: w, digest: sha256.New(), id: id, params: params, key: k}
+	var h util.BufferWriter
+	h.Write([]byte(archiveMagic))
+	h.WriteByte(archiveVersion2)
+	h.Write(id[:])
+	h.WriteUvarint(uint64(time.Now().UnixNano()))
+	h.WriteVarVector([]byte(network))
+	err := aw.write(h.Buffer)
+	if err == nil {
+		err = aw.writeSection(archiveParams, params.Bytes())
+	}
+	if err == nil && eligibility != nil {
+		err = aw.writeSection(archiveEligibility, eligibility.Bytes())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+func (aw *ArchiveWriter) write(p []byte) error {
+	aw.digest.Write(p)
+	_, err := aw.w.Write(p)
+	return err
+}
+
+func (aw *ArchiveWriter) writeSection(tag byte, body []byte) error {
+	var w util.BufferWriter
+	w.WriteByte(tag)
+	w.WriteVarVector(body)
+	return aw.write(w.Buffer)
+}
+
+// Adds messages to the archive, in the order of the channel.
+func (aw *ArchiveWriter) Write(msgs ...Message) error {
+	if aw.closed {
+		return ErrArchiveClosed
+	}
+	for _, m := range msgs {
+		aw.pending = append(aw.pending, m)
+		if len(aw.pending) == archiveSegmentSize {
+			err := aw.flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Writes the pending messages as a segment with its checkpoint.
+func (aw *ArchiveWriter) flush() error {
+	if len(aw.pending) == 0 {
+		return nil
+	}
+	for _, m := range aw.pending {
+		aw.head = ChainHead(aw.head, m)
+	}
+	aw.count += uint64(len(aw.pending))
+	c := ArchiveCheckpoint{Count: aw.count, Head: aw.head}
+	sig, err := aw.key.Sign(c.signingBytes(aw.id))
+	if err != nil {
+		return err
+	}
+	var w util.BufferWriter
+	w.WriteVarVector(EncodeReceiptEnvelopes(aw.pending))
+	w.WriteUvarint(c.Count)
+	w.Write32(c.Head)
+	w.Write(sig)
+	aw.pending = aw.pending[:0]
+	return aw.writeSection(archiveSegment, w.Buffer)
+}
+
+/*
+Completes the archive with the final result, if not nil, and the seal.
+The result is hashed with the hash scheme of the params, as the tally hash of the election.
+*/
+func (aw *ArchiveWriter) Close(result *ResultExport) error {
+	if aw.closed {
+		return ErrArchiveClosed
+	}
+	aw.closed = true
+	err := aw.flush()
+	if err != nil {
+		return err
+	}
+	if result != nil {
+		var w util.BufferWriter
+		w.WriteVarVector(result.CanonicalJSON())
+		w.Write32(result.Hash(aw.params.HashScheme()))
+		err = aw.writeSection(archiveResult, w.Buffer)
+		if err != nil {
+			return err
+		}
+	}
+	sig, err := aw.key.Sign(archiveSealBytes(aw.id, aw.digest.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	return aw.writeSection(archiveSeal, sig)
+}
+
+/*
+Writes the archive of the election, signed with the organizer key k: its messages and,
+once it has ended, its final result. Root-only eligibility lists are archived in full
+if the channel distributes them.
+*/
+func (e *Election) WriteArchive(ctx context.Context, w io.Writer, k pubkey.PrivateKey) error {
+	params := e.PublishedParams()
+	var eligibility *structs.EligibilityList
+	if params.EligibilityList != nil && params.EligibilityList.RootOnly() {
+		if p, ok := e.channel.(EligibilityProvider); ok {
+			list, err := p.EligibilityList(ctx)
+			if err == nil && !list.RootOnly() {
+				eligibility = list
+			}
+		}
+	}
+	aw, err := NewArchiveWriter(w, e.Id(), ChannelNetwork(e.channel), params, eligibility, k)
+	if err != nil {
+		return err
+	}
+	err = ForEachMessage(ctx, e.channel, func(m Message) error {
+		return aw.Write(m)
+	})
+	if err != nil {
+		return err
+	}
+	var result *ResultExport
+	if e.Phase() == End {
+		prog, err := e.Progress(ctx)
+		if err != nil {
+			return err
+		}
+		result = e.resultExport(prog)
+	}
+	return aw.Close(result)
+}
+
+// The contents of an election archive, whose signatures and checkpoints were verified by ReadArchive.
+type Archive struct {
+	Id          ElectionID
+	Network     string
+	Created     time.Time
+	Params      *ElectionParams
+	Eligibility *structs.EligibilityList
+	Messages    []Message
+	Checkpoints []ArchiveCheckpoint
+	// Canonical JSON export of the final result, nil if the election had not ended.
+	Result    json.RawMessage
+	TallyHash util.HashValue
+}
+
+/*
+Reads and verifies the archive of election id: the params must be those of the election
+and signed by its organizer, every checkpoint must match the messages before it and be signed
+by the organizer, the result must match its tally hash, and the archive must be sealed.
+Verifying the messages and recounting the result is left to the caller.
+*/
+func ReadArchive(r io.Reader, id ElectionID) (*Archive, error) {
+	br := &digestReader{bufio.NewReader(r), sha256.New()}
+	var header [len(archiveMagic) + 1 + 32]byte
+	_, err := io.ReadFull(br, header[:])
+	if err != nil {
+		return nil, err
+	}
+	if string(header[:len(archiveMagic)]) != archiveMagic {
+		return nil, ErrArchiveFormat
+	}
+	version := header[len(archiveMagic)]
+	if version != archiveVersion1 && version != archiveVersion2 {
+		return nil, ErrArchiveVersion
+	}
+	a := new(Archive)
+	copy(a.Id[:], header[len(archiveMagic)+1:])
+	if a.Id != id {
+		return nil, ErrArchiveElection
+	}
+	created, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	a.Created = time.Unix(0, int64(created))
+	a.Network = ServerNetwork
+	if version >= archiveVersion2 {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if n > maxInvitationVector {
+			return nil, ErrArchiveFormat
+		}
+		network := make([]byte, n)
+		if _, err = io.ReadFull(br, network); err != nil {
+			return nil, err
+		}
+		a.Network = string(network)
+	}
+	var head util.HashValue
+	var last byte
+	for {
+		// The seal signs everything read before its section
+		sum := br.digest.Sum(nil)
+		tag, body, err := readArchiveSection(br)
+		if err != nil {
+			return nil, err
+		}
+		if tag < last || (tag == last && tag != archiveSegment) || (tag != archiveParams && a.Params == nil) {
+			return nil, ErrArchiveFormat
+		}
+		last = tag
+		switch tag {
+		case archiveParams:
+			err = a.readParams(body)
+		case archiveEligibility:
+			err = a.readEligibility(body)
+		case archiveSegment:
+			head, err = a.readSegment(body, head)
+		case archiveResult:
+			err = a.readResult(body)
+		case archiveSeal:
+			return a, a.Params.Organizer.Verify(archiveSealBytes(a.Id, sum), body)
+		default:
+			err = ErrArchiveFormat
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Hashes the bytes read.
+type digestReader struct {
+	r      *bufio.Reader
+	digest hash.Hash
+}
+
+func (r *digestReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.digest.Write(p[:n])
+	return n, err
+}
+
+func (r *digestReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.digest.Write([]byte{b})
+	}
+	return b, err
+}
+
+// Reads a section, returning io.ErrUnexpectedEOF if the archive ends before the seal.
+func readArchiveSection(r *digestReader) (byte, []byte, error) {
+	tag, err := r.ReadByte()
+	if err == nil {
+		var l uint64
+		l, err = binary.ReadUvarint(r)
+		if err == nil && l > maxArchiveSection {
+			return 0, nil, util.ErrTooLarge
+		}
+		if err == nil {
+			body := make([]byte, l)
+			_, err = io.ReadFull(r, body)
+			if err == nil {
+				return tag, body, nil
+			}
+		}
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return 0, nil, err
+}
+
+func (a *Archive) readParams(body []byte) error {
+	a.Params = new(ElectionParams)
+	err := a.Params.FromBytes(body)
+	if err != nil {
+		return err
+	}
+	if a.Params.Version < ParamsVersion2 {
+		return ErrArchiveUnsigned
+	}
+	err = a.Params.Validate()
+	if err != nil {
+		return err
+	}
+	err = a.Params.VerifySignature()
+	if err != nil {
+		return err
+	}
+	if a.Params.Version >= ParamsVersion11 && a.Params.ElectionId(a.Network) != a.Id {
+		return ErrElectionIdMismatch
+	}
+	return nil
+}
+
+func (a *Archive) readEligibility(body []byte) error {
+	a.Eligibility = structs.NewEligibilityList()
+	err := a.Eligibility.FromBytes(body)
+	if err != nil {
+		return err
+	}
+	root := a.Params.EligibilityList
+	if root == nil || !root.RootOnly() || a.Eligibility.Root() != root.Root() {
+		return ErrArchiveFormat
+	}
+	return nil
+}
+
+// Reads a segment following messages with the given head, and returns the head at its checkpoint.
+func (a *Archive) readSegment(body []byte, head util.HashValue) (util.HashValue, error) {
+	r := util.NewBufferReader(body)
+	envs, err := r.ReadVarVector(maxArchiveSection)
+	if err != nil {
+		return head, err
+	}
+	msgs, err := DecodeEnvelopeBatch(envs)
+	if err != nil {
+		return head, err
+	}
+	var c ArchiveCheckpoint
+	c.Count, err = r.ReadUvarint()
+	if err == nil {
+		c.Head, err = r.Read32()
+	}
+	if err != nil {
+		return head, err
+	}
+	c.Signature = r.ReadRemaining()
+	for _, m := range msgs {
+		head = ChainHead(head, m)
+	}
+	a.Messages = append(a.Messages, msgs...)
+	if c.Count != uint64(len(a.Messages)) || c.Head != head {
+		return head, ErrArchiveCheckpoint
+	}
+	err = a.Params.Organizer.Verify(c.signingBytes(a.Id), c.Signature)
+	if err != nil {
+		return head, err
+	}
+	a.Checkpoints = append(a.Checkpoints, c)
+	return head, nil
+}
+
+func (a *Archive) readResult(body []byte) error {
+	r := util.NewBufferReader(body)
+	result, err := r.ReadVarVector(maxArchiveSection)
+	if err != nil {
+		return err
+	}
+	a.TallyHash, err = r.Read32()
+	if err != nil {
+		return err
+	}
+	if a.Params.HashScheme().Sum(util.DomainTally, result) != a.TallyHash {
+		return ErrArchiveResult
+	}
+	a.Result = result
+	return nil
+}
@@ -0,0 +1,103 @@
+package voting
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+func TestArchive(t *testing.T) {
+	k, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := generateParamsV1()
+	params.Upgrade(ParamsVersion11)
+	if err = params.Sign(k); err != nil {
+		t.Fatal(err)
+	}
+	id := params.ElectionId(ServerNetwork)
+	var buf bytes.Buffer
+	aw, err := NewArchiveWriter(&buf, id, ServerNetwork, params, nil, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Spans two segments
+	n := archiveSegmentSize + 3
+	for i := 0; i < n; i++ {
+		m := Message{Decryption: &structs.DecryptionMessage{Output: []byte{byte(i), byte(i >> 8)}}, Sequence: uint64(i + 1)}
+		if err = aw.Write(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result := &ResultExport{Election: "e", Valid: 2, Total: 3, Contests: []ContestExport{}}
+	if err = aw.Close(result); err != nil {
+		t.Fatal(err)
+	}
+	p := buf.Bytes()
+
+	a, err := ReadArchive(bytes.NewReader(p), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Messages) != n || len(a.Checkpoints) != 2 || a.Checkpoints[1].Count != uint64(n) || a.Messages[n-1].Sequence != uint64(n) {
+		t.Fatalf("%d messages, checkpoints %+v", len(a.Messages), a.Checkpoints)
+	}
+	if !bytes.Equal(a.Result, result.CanonicalJSON()) || a.TallyHash != result.Hash(params.HashScheme()) {
+		t.Error("result not archived")
+	}
+	if msgs, _ := a.Channel().Get(context.Background()); len(msgs) != n || a.TranscriptHash() != a.Checkpoints[1].Head {
+		t.Error("archive not mounted")
+	}
+	if _, err = ReadArchive(bytes.NewReader(p), ElectionID{1}); err != ErrArchiveElection {
+		t.Errorf("archive of another election: %v", err)
+	}
+	if _, err = ReadArchive(bytes.NewReader(p[:len(p)-10]), id); err == nil {
+		t.Error("truncated archive accepted")
+	}
+	var unsealed bytes.Buffer
+	aw, _ = NewArchiveWriter(&unsealed, id, ServerNetwork, params, nil, k)
+	aw.Write(a.Messages[:archiveSegmentSize]...)
+	if _, err = ReadArchive(&unsealed, id); err != io.ErrUnexpectedEOF {
+		t.Errorf("unsealed archive: %v", err)
+	}
+	// The network is part of the election ID
+	var elsewhere bytes.Buffer
+	aw, _ = NewArchiveWriter(&elsewhere, id, "other", params, nil, k)
+	if _, err = ReadArchive(&elsewhere, id); err != ErrElectionIdMismatch {
+		t.Errorf("archive of another network: %v", err)
+	}
+	elsewhere.Reset()
+	otherId := params.ElectionId("other")
+	aw, _ = NewArchiveWriter(&elsewhere, otherId, "other", params, nil, k)
+	aw.Close(nil)
+	if a, err = ReadArchive(&elsewhere, otherId); err != nil || a.Channel().Network() != "other" {
+		t.Errorf("archive of network other: %v", err)
+	}
+	tampered := append([]byte(nil), p...)
+	tampered[len(tampered)/2] ^= 1
+	if _, err = ReadArchive(bytes.NewReader(tampered), id); err == nil {
+		t.Error("tampered archive accepted")
+	}
+
+	// Params that cannot derive their ID are rejected before hashing
+	params.HashAlgorithm = 200
+	if err = params.Sign(k); err != nil {
+		t.Fatal(err)
+	}
+	var malformed bytes.Buffer
+	NewArchiveWriter(&malformed, id, ServerNetwork, params, nil, k)
+	if _, err = ReadArchive(&malformed, id); err != util.ErrUnknownHashAlgorithm {
+		t.Errorf("archive with an unknown hash algorithm: %v", err)
+	}
+
+	other, _ := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if _, err = NewArchiveWriter(&buf, id, ServerNetwork, params, nil, other); err != ErrOrganizerMismatch {
+		t.Errorf("archive signed by another key: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package voting
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+var ErrAuditUnsigned = errors.New("pebble: audit report is not signed")
+
+// Prefixed to the signed bytes of audit reports.
+const auditReportContext = "pebble-audit-report"
+
+/*
+The findings of an independent recount of an ended election (see Election.Audit), as a JSON
+document signed by the auditor. TranscriptHash is the head of the message log as in archives
+(see ChainHead), so that the report refers to the exact messages recounted. Hashes, keys and
+signatures are hex-encoded, except the auditor key, which is encoded by pubkey.PublicKey.String.
+*/
+type AuditReport struct {
+	Election       string         `json:"election"`
+	Title          string         `json:"title"`
+	Audited        time.Time      `json:"audited"`
+	Messages       int            `json:"messages"`
+	TranscriptHash string         `json:"transcriptHash"`
+	Result         *ResultExport  `json:"result"`
+	TallyHash      string         `json:"tallyHash"`
+	Rejections     map[string]int `json:"rejections,omitempty"`
+	// Whether the organizer, and a threshold of trustees if any, certified the recounted result.
+	Certified bool `json:"certified"`
+	// Whether the organizer certified the recounted result, and the indices of the trustees who did.
+	OrganizerCertified bool     `json:"organizerCertified"`
+	Trustees           []uint32 `json:"trustees,omitempty"`
+	// Number of certifications posted for another result than the recount.
+	Conflicting int    `json:"conflicting"`
+	Auditor     string `json:"auditor,omitempty"`
+	Signature   string `json:"signature,omitempty"`
+}
+
+/*
+Recounts the ended election from all the messages of its channel with Election.Verify,
+without any secrets, and reports the result along with the rejected ballots and the
+certifications found. The report is to be signed by the auditor with Sign.
+*/
+func (e *Election) Audit(ctx context.Context) (*AuditReport, error) {
+	v, err := e.Verify(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var head util.HashValue
+	n := 0
+	err = ForEachMessage(ctx, e.channel, func(m Message) error {
+		head = ChainHead(head, m)
+		n++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	r := &AuditReport{
+		Election:           v.Result.Election,
+		Title:              e.Params().Title,
+		Audited:            e.Now().UTC(),
+		Messages:           n,
+		TranscriptHash:     hex.EncodeToString(head[:]),
+		Result:             v.Result,
+		TallyHash:          hex.EncodeToString(v.TallyHash[:]),
+		Certified:          v.Certification.Certified,
+		OrganizerCertified: v.Certification.Organizer,
+		Trustees:           v.Certification.Trustees,
+		Conflicting:        len(v.Certification.Conflicting),
+	}
+	for reason, count := range v.Progress.Rejections {
+		if r.Rejections == nil {
+			r.Rejections = make(map[string]int)
+		}
+		r.Rejections[reason.String()] = count
+	}
+	return r, nil
+}
+
+// The encoding of the report without its signature, in the canonical form of ResultExport.CanonicalJSON.
+func (r *AuditReport) signingBytes() []byte {
+	unsigned := *r
+	unsigned.Signature = ""
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(&unsigned)
+	return util.Concat([]byte(auditReportContext), bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
+
+// Signs the report with the auditor key k, which the report then names.
+func (r *AuditReport) Sign(k pubkey.PrivateKey) error {
+	var err error
+	r.Auditor, err = k.Public().String()
+	if err != nil {
+		return err
+	}
+	r.Signature = ""
+	sig, err := k.Sign(r.signingBytes())
+	if err != nil {
+		return err
+	}
+	r.Signature = hex.EncodeToString(sig)
+	return nil
+}
+
+// Verifies the signature of the report against the auditor key it names.
+func (r *AuditReport) Verify() error {
+	if r.Auditor == "" || r.Signature == "" {
+		return ErrAuditUnsigned
+	}
+	auditor, err := pubkey.Parse(r.Auditor)
+	if err != nil {
+		return err
+	}
+	sig, err := hex.DecodeString(r.Signature)
+	if err != nil {
+		return err
+	}
+	return auditor.Verify(r.signingBytes(), sig)
+}
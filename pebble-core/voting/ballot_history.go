@@ -0,0 +1,66 @@
+package voting
+
+import (
+	"context"
+	"errors"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/secrets"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+var ErrAlreadyVoted = errors.New("pebble: a ballot of the voter is already on the channel")
+
+/*
+Returns the tracking code of a signed ballot: the hash of its message, as hashed by the
+channels to detect duplicates. Voters look up their ballot on the channel with it.
+*/
+func BallotTrackingCode(sb structs.SignedBallot) util.HashValue {
+	return util.Hash(Message{SignedBallot: &sb}.Bytes())
+}
+
+// Returns the ballots the voter signed in the election, oldest first.
+func (e *Election) Ballots() ([]secrets.BallotRecord, error) {
+	if e.secrets == nil {
+		return nil, nil
+	}
+	all, err := e.secrets.GetBallots()
+	if err != nil {
+		return nil, err
+	}
+	rs := secrets.ElectionBallots(all, e.Id())
+	for i := range rs {
+		// Ballots stored before the history was kept have no tracking code
+		if rs[i].TrackingCode == (util.HashValue{}) {
+			rs[i].TrackingCode = BallotTrackingCode(rs[i].Ballot)
+		}
+	}
+	return rs, nil
+}
+
+/*
+Returns the first ballot of the voter's history found on the channel, the one counted
+since later ballots reuse its serial number, or nil if none was posted.
+A voter whose ballot did not reach the channel can vote again.
+*/
+func (e *Election) PostedBallot(ctx context.Context) (*secrets.BallotRecord, error) {
+	rs, err := e.Ballots()
+	if err != nil || len(rs) == 0 {
+		return nil, err
+	}
+	codes := make(map[util.HashValue]int, len(rs))
+	for i := range rs {
+		codes[rs[i].TrackingCode] = i
+	}
+	var found *secrets.BallotRecord
+	err = ForEachMessage(ctx, e.channel, func(m Message) error {
+		if found != nil || m.SignedBallot == nil {
+			return nil
+		}
+		if i, ok := codes[util.Hash(m.Bytes())]; ok {
+			found = &rs[i]
+		}
+		return nil
+	})
+	return found, err
+}
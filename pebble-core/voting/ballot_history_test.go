@@ -0,0 +1,59 @@
+package voting
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/secrets"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+func TestPostedBallot(t *testing.T) {
+	ctx := context.Background()
+	sm := &mockSecretsManager{}
+	e := &Election{channel: NewMockBroadcastChannel(ElectionID{}, nil), secrets: sm}
+	first := structs.SignedBallot{SerialNo: []byte("s"), Signature: []byte("first")}
+	second := structs.SignedBallot{SerialNo: []byte("s"), Signature: []byte("second")}
+	// The first ballot has no tracking code, as if stored before the history was kept
+	sm.AddBallot(secrets.BallotRecord{Ballot: first})
+	sm.AddBallot(secrets.BallotRecord{Ballot: second, TrackingCode: BallotTrackingCode(second)})
+	rs, err := e.Ballots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 2 || rs[0].TrackingCode != util.Hash(Message{SignedBallot: &first}.Bytes()) {
+		t.Fatalf("ballots %+v", rs)
+	}
+	posted, err := e.PostedBallot(ctx)
+	if err != nil || posted != nil {
+		t.Fatalf("posted %v, %v", posted, err)
+	}
+	e.channel.Post(ctx, Message{SignedBallot: &second})
+	posted, err = e.PostedBallot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if posted == nil || string(posted.Ballot.Signature) != "second" {
+		t.Errorf("posted %+v", posted)
+	}
+}
+
+func TestBallotsOfElection(t *testing.T) {
+	sm := &mockSecretsManager{}
+	a := &Election{channel: NewMockBroadcastChannel(ElectionID{1}, nil), secrets: sm}
+	b := &Election{channel: NewMockBroadcastChannel(ElectionID{2}, nil), secrets: sm}
+	sm.AddBallot(secrets.BallotRecord{ElectionId: a.Id(), Ballot: structs.SignedBallot{SerialNo: []byte("s"), Signature: []byte("a")}})
+	sm.AddBallot(secrets.BallotRecord{ElectionId: b.Id(), Ballot: structs.SignedBallot{SerialNo: []byte("s"), Signature: []byte("b")}})
+	rs, err := a.Ballots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 || string(rs[0].Ballot.Signature) != "a" {
+		t.Errorf("ballots of the election %+v", rs)
+	}
+	if own := a.ownBallot(); own == nil || !bytes.Equal(own, Message{SignedBallot: &rs[0].Ballot}.Bytes()) {
+		t.Error("own ballot of another election")
+	}
+}
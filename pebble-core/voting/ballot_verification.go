@@ -0,0 +1,116 @@
+package voting
+
+import (
+	"context"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+// What a voter can check about their ballot, see Election.VerifyBallot.
+type BallotVerification struct {
+	// Phase of the election at the time of the verification.
+	Phase ElectionPhase
+	// Tracking code of the posted ballot, or of the last ballot signed if none was posted; zero if the voter signed none.
+	TrackingCode util.HashValue
+	// Whether the ballot is on the channel.
+	Recorded bool
+	// Proof that the ballot is on the board, verified against the params; nil if the channel does not prove inclusion.
+	Inclusion *InclusionProof
+	// Whether the ballot signature verifies against the credential set.
+	ValidSignature bool
+	// Whether the ballot was opened by its decryption, its key or the trustees. Homomorphic
+	// ballots are never opened one by one, and count as decrypted once their sums are.
+	Decrypted bool
+	// Whether the ballot is counted in the tally.
+	Counted bool
+	// Why the ballot is not counted, if Progress rejects it.
+	Rejection RejectionReason
+}
+
+/*
+Checks the ballot of the voter against the channel in one go, for voters who want to know whether
+their vote counts: whether it was recorded, with the inclusion proof of the server if it proves
+them, validly signed, decrypted and counted. A proof that does not verify is returned as an error.
+*/
+func (e *Election) VerifyBallot(ctx context.Context) (v BallotVerification, err error) {
+	v.Phase = e.Phase()
+	posted, err := e.PostedBallot(ctx)
+	if err != nil {
+		return
+	}
+	if posted == nil {
+		rs, err := e.Ballots()
+		if len(rs) != 0 {
+			v.TrackingCode = rs[len(rs)-1].TrackingCode
+		}
+		return v, err
+	}
+	v.TrackingCode, v.Recorded = posted.TrackingCode, true
+	if _, ok := e.channel.(InclusionProvider); ok {
+		v.Inclusion, err = e.BallotInclusionProof(ctx)
+		// Servers without the organizer key cannot prove inclusion
+		if err == ErrMessageNotFound || err == ErrCheckpointUnsigned {
+			err = nil
+		}
+		if err != nil {
+			return
+		}
+	}
+	p, err := e.Progress(ctx)
+	if err != nil {
+		return
+	}
+	v.Phase = p.Phase
+	for _, r := range p.Rejected {
+		if r.Hash == v.TrackingCode {
+			v.Rejection = r.Reason
+		}
+	}
+	set, err := e.GetCredentialSet(ctx)
+	if err != nil {
+		return
+	}
+	v.ValidSignature = posted.Ballot.Verify(set, e.ballotDomain()) == nil
+	if !v.ValidSignature || v.Rejection != 0 || p.Phase < Tally {
+		return
+	}
+	if _, ok := e.homomorphicMethod(); ok {
+		// Count is only set once the trustees decrypted the sums
+		v.Decrypted = p.Count != 0
+	} else {
+		v.Decrypted, err = e.ballotOpened(ctx, posted.Ballot.EncryptedBallot)
+		if err != nil {
+			return
+		}
+	}
+	v.Counted = v.Decrypted
+	return
+}
+
+// Reports whether the messages of the channel open the encrypted ballot, as Progress opens them.
+func (e *Election) ballotOpened(ctx context.Context, eb structs.EncryptedBallot) (bool, error) {
+	msgs, err := e.readMessages(ctx, func(m Message) bool {
+		return m.Decryption != nil || m.DecryptionBatch != nil || m.TrusteeDecryption != nil || m.KeyReveal != nil
+	})
+	if err != nil {
+		return false, err
+	}
+	var decMsgs []structs.DecryptionMessage
+	var trusteeMsgs []structs.TrusteeDecryptionMessage
+	var reveals []structs.KeyRevealMessage
+	for _, msg := range msgs {
+		if msg.Decryption != nil || msg.DecryptionBatch != nil {
+			decMsgs = appendDecryptions(decMsgs, msg)
+		} else if msg.TrusteeDecryption != nil {
+			trusteeMsgs = append(trusteeMsgs, *msg.TrusteeDecryption)
+		} else if msg.KeyReveal != nil && !msg.Received.Before(e.Params().TallyStart) {
+			reveals = append(reveals, *msg.KeyReveal)
+		}
+	}
+	_, _, err = decryptBallot(eb, decMsgs, reveals, e.timedVdf(ctx))
+	if err == ErrDecryptionNotFound {
+		_, err = decryptTrusteeBallot(eb, e.Params().Trustees, collectTrusteePartials(trusteeMsgs))
+	}
+	return err == nil, nil
+}
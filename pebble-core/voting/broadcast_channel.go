@@ -3,7 +3,12 @@ package voting
 import (
 	"context"
 	"errors"
+	"io"
+	"sync"
+	"time"
 
+	"github.com/giry-dev/pebble-voting-app/pebble-core/timesource"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
 )
 
@@ -13,8 +18,57 @@ type Message struct {
 	Credential     *structs.CredentialMessage
 	SignedBallot   *structs.SignedBallot
 	Decryption     *structs.DecryptionMessage
+	Amendment      *Amendment
+	// Organizer-signed change to the eligibility list.
+	EligibilityUpdate *EligibilityUpdate
+	// Partial decryptions of trustee ballot ciphertexts.
+	TrusteeDecryption *structs.TrusteeDecryptionMessage
+	// Voter delegation of ballot weight, and claim of the delegated weight by a delegate.
+	Delegation    *structs.DelegationMessage
+	DelegateClaim *structs.DelegateClaimMessage
+	// Organizer or trustee signature of the final result.
+	Certification *ResultCertification
+	// Trustee key generation messages.
+	DKGDealing   *DKGDealing
+	DKGComplaint *DKGComplaint
+	// Key of a voter's ballot, revealed in the tally phase to decrypt it before its VDF is solved.
+	KeyReveal *structs.KeyRevealMessage
+	// VDF solutions of many ballots, each counted as a Decryption.
+	DecryptionBatch *structs.DecryptionBatchMessage
+	// Proof-of-work nonce, carried in the message envelope rather than in the message bytes.
+	PowNonce uint64
+	// Position of the message in the channel, from 1, and time at which the channel stored it.
+	// Set by the channel rather than the poster, and carried in envelopes from framing version 3.
+	// Zero if unknown.
+	Sequence uint64
+	Received time.Time
 }
 
+// Type bytes of messages that are not tied to a single election phase.
+// Phase-bound messages use their ElectionPhase as type byte.
+const (
+	messageTypeAmendment byte = 0x10 + iota
+	// Credential message carrying an eligibility proof.
+	messageTypeCredentialProof
+	messageTypeEligibilityUpdate
+	// Signed ballot carrying a trustee ciphertext.
+	messageTypeTrusteeBallot
+	messageTypeTrusteeDecryption
+	messageTypeDelegation
+	messageTypeDelegateClaim
+	messageTypeCertification
+	messageTypeDKGDealing
+	messageTypeDKGComplaint
+	// Signed ballot encrypted with another cipher suite than structs.SuiteAESGCM.
+	messageTypeSuiteBallot
+	// Partial decryptions carrying shares of the hybrid secrets of trustee ciphertexts.
+	messageTypeHybridTrusteeDecryption
+	messageTypeKeyReveal
+	messageTypeDecryptionBatch
+	// Credential message of a nonzero epoch, with or without an eligibility proof.
+	messageTypeEpochCredential
+)
+
 /*
 Specifies the methods that a broadcast channel implementation must provide.
 
@@ -22,17 +76,79 @@ Id(): returns the identifier of the election associated with the broadcast chann
 Params(ctx context.Context): retrieves the election parameters from the broadcast channel.
 Get(ctx context.Context): retrieves the messages from the broadcast channel.
 Post(ctx context.Context, m Message): posts a new message to the broadcast channel.
+Watch(ctx context.Context): returns a channel receiving, in order, the messages posted after the call.
+The channel is closed once ctx is done or the connection to the broadcast channel is lost.
 */
 type BroadcastChannel interface {
 	Id() ElectionID
 	Params(ctx context.Context) (*ElectionParams, error)
 	Get(ctx context.Context) ([]Message, error)
 	Post(ctx context.Context, m Message) error
+	Watch(ctx context.Context) (<-chan Message, error)
+}
+
+// Name of the network of the broadcast servers, in the invitations of their elections.
+const ServerNetwork = "mock"
+
+/*
+Optionally implemented by broadcast channels reporting the network they belong to,
+whose name is part of the election ID, see ElectionParams.ElectionId.
+
+Network(): returns the name of the network, as in the invitations of its elections.
+*/
+type NetworkChannel interface {
+	Network() string
+}
+
+// Returns the network of the channel, ServerNetwork unless it implements NetworkChannel.
+func ChannelNetwork(bc BroadcastChannel) string {
+	if nc, ok := bc.(NetworkChannel); ok {
+		return nc.Network()
+	}
+	return ServerNetwork
+}
+
+/*
+Optionally implemented by broadcast channels to distribute the full EligibilityList
+of elections whose params only carry its Merkle root.
+
+EligibilityList(ctx context.Context): retrieves the full eligibility list.
+EligibilityProof(ctx context.Context, pkh util.HashValue): retrieves the inclusion proof of a public key hash.
+*/
+type EligibilityProvider interface {
+	EligibilityList(ctx context.Context) (*structs.EligibilityList, error)
+	EligibilityProof(ctx context.Context, pkh util.HashValue) (*structs.EligibilityProof, error)
+}
+
+/*
+Optionally implemented by broadcast channels that can post many messages in a single request,
+such as an organizer bootstrapping an election with many credential pre-registrations.
+
+PostAll(ctx context.Context, msgs []Message): posts the messages to the broadcast channel in order.
+*/
+type BatchPoster interface {
+	PostAll(ctx context.Context, msgs []Message) error
+}
+
+// Posts the messages to the channel in order, in a single batch if the channel is a BatchPoster.
+func PostAll(ctx context.Context, bc BroadcastChannel, msgs []Message) error {
+	if b, ok := bc.(BatchPoster); ok {
+		return b.PostAll(ctx, msgs)
+	}
+	for _, m := range msgs {
+		err := bc.Post(ctx, m)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 var (
 	ErrInvalidMessageType = errors.New("pebble: invalid message type")
 	ErrInvalidMessageSize = errors.New("pebble: invalid message size")
+	ErrDuplicateMessage   = errors.New("pebble: duplicate message")
+	ErrStaleCredential    = errors.New("pebble: credential of an epoch replaced by a later credential")
 )
 
 /*
@@ -42,25 +158,70 @@ Calls the corresponding Bytes() method on the non-nil field to serialize its con
 Prepends the byte value representing the message type to the serialized payload.
 */
 func (m Message) Bytes() []byte {
-	var phase ElectionPhase
+	var kind byte
 	var p []byte
 	if m.ElectionParams != nil {
-		phase = Setup
+		kind = byte(Setup)
 		p = m.ElectionParams.Bytes()
+	} else if m.Credential != nil && m.Credential.Epoch != 0 {
+		kind = messageTypeEpochCredential
+		p = m.Credential.BytesWithEpoch()
+	} else if m.Credential != nil && m.Credential.Proof != nil {
+		kind = messageTypeCredentialProof
+		p = m.Credential.BytesWithProof()
 	} else if m.Credential != nil {
-		phase = CredGen
+		kind = byte(CredGen)
 		p = m.Credential.Bytes()
+	} else if m.SignedBallot != nil && m.SignedBallot.EncryptedBallot.Suite != structs.SuiteAESGCM {
+		kind = messageTypeSuiteBallot
+		p = m.SignedBallot.BytesWithSuite()
+	} else if m.SignedBallot != nil && m.SignedBallot.EncryptedBallot.Trustee != nil {
+		kind = messageTypeTrusteeBallot
+		p = m.SignedBallot.BytesWithTrustee()
 	} else if m.SignedBallot != nil {
-		phase = Cast
+		kind = byte(Cast)
 		p = m.SignedBallot.Bytes()
 	} else if m.Decryption != nil {
-		phase = Tally
+		kind = byte(Tally)
 		p = m.Decryption.Bytes()
+	} else if m.Amendment != nil {
+		kind = messageTypeAmendment
+		p = m.Amendment.Bytes()
+	} else if m.EligibilityUpdate != nil {
+		kind = messageTypeEligibilityUpdate
+		p = m.EligibilityUpdate.Bytes()
+	} else if m.TrusteeDecryption != nil && m.TrusteeDecryption.HasShares() {
+		kind = messageTypeHybridTrusteeDecryption
+		p = m.TrusteeDecryption.BytesWithShares()
+	} else if m.TrusteeDecryption != nil {
+		kind = messageTypeTrusteeDecryption
+		p = m.TrusteeDecryption.Bytes()
+	} else if m.Delegation != nil {
+		kind = messageTypeDelegation
+		p = m.Delegation.Bytes()
+	} else if m.DelegateClaim != nil {
+		kind = messageTypeDelegateClaim
+		p = m.DelegateClaim.Bytes()
+	} else if m.Certification != nil {
+		kind = messageTypeCertification
+		p = m.Certification.Bytes()
+	} else if m.DKGDealing != nil {
+		kind = messageTypeDKGDealing
+		p = m.DKGDealing.Bytes()
+	} else if m.DKGComplaint != nil {
+		kind = messageTypeDKGComplaint
+		p = m.DKGComplaint.Bytes()
+	} else if m.KeyReveal != nil {
+		kind = messageTypeKeyReveal
+		p = m.KeyReveal.Bytes()
+	} else if m.DecryptionBatch != nil {
+		kind = messageTypeDecryptionBatch
+		p = m.DecryptionBatch.Bytes()
 	} else {
 		panic("pebble: invalid message type")
 	}
 	r := make([]byte, 1, len(p)+1)
-	r[0] = byte(phase)
+	r[0] = kind
 	r = append(r, p...)
 	return r
 }
@@ -74,51 +235,617 @@ func MessageFromBytes(p []byte) (m Message, err error) {
 	if len(p) < 1 {
 		return m, ErrInvalidMessageSize
 	}
-	switch ElectionPhase(p[0]) {
-	case Setup:
+	// Params are bounded by their own, larger, limit
+	if len(p) > maxMessageSize && p[0] != byte(Setup) {
+		return m, util.ErrTooLarge
+	}
+	switch p[0] {
+	case byte(Setup):
 		m.ElectionParams = new(ElectionParams)
 		err = m.ElectionParams.FromBytes(p[1:])
-	case CredGen:
+	case byte(CredGen):
 		m.Credential = new(structs.CredentialMessage)
 		err = m.Credential.FromBytes(p[1:])
-	case Cast:
+	case byte(Cast):
 		m.SignedBallot = new(structs.SignedBallot)
 		err = m.SignedBallot.FromBytes(p[1:])
-	case Tally:
+	case byte(Tally):
 		m.Decryption = new(structs.DecryptionMessage)
 		err = m.Decryption.FromBytes(p[1:])
+	case messageTypeAmendment:
+		m.Amendment = new(Amendment)
+		err = m.Amendment.FromBytes(p[1:])
+	case messageTypeCredentialProof:
+		m.Credential = new(structs.CredentialMessage)
+		err = m.Credential.FromBytesWithProof(p[1:])
+	case messageTypeEpochCredential:
+		m.Credential = new(structs.CredentialMessage)
+		err = m.Credential.FromBytesWithEpoch(p[1:])
+	case messageTypeEligibilityUpdate:
+		m.EligibilityUpdate = new(EligibilityUpdate)
+		err = m.EligibilityUpdate.FromBytes(p[1:])
+	case messageTypeTrusteeBallot:
+		m.SignedBallot = new(structs.SignedBallot)
+		err = m.SignedBallot.FromBytesWithTrustee(p[1:])
+	case messageTypeSuiteBallot:
+		m.SignedBallot = new(structs.SignedBallot)
+		err = m.SignedBallot.FromBytesWithSuite(p[1:])
+	case messageTypeTrusteeDecryption:
+		m.TrusteeDecryption = new(structs.TrusteeDecryptionMessage)
+		err = m.TrusteeDecryption.FromBytes(p[1:])
+	case messageTypeHybridTrusteeDecryption:
+		m.TrusteeDecryption = new(structs.TrusteeDecryptionMessage)
+		err = m.TrusteeDecryption.FromBytesWithShares(p[1:])
+	case messageTypeDelegation:
+		m.Delegation = new(structs.DelegationMessage)
+		err = m.Delegation.FromBytes(p[1:])
+	case messageTypeDelegateClaim:
+		m.DelegateClaim = new(structs.DelegateClaimMessage)
+		err = m.DelegateClaim.FromBytes(p[1:])
+	case messageTypeCertification:
+		m.Certification = new(ResultCertification)
+		err = m.Certification.FromBytes(p[1:])
+	case messageTypeDKGDealing:
+		m.DKGDealing = new(DKGDealing)
+		err = m.DKGDealing.FromBytes(p[1:])
+	case messageTypeDKGComplaint:
+		m.DKGComplaint = new(DKGComplaint)
+		err = m.DKGComplaint.FromBytes(p[1:])
+	case messageTypeKeyReveal:
+		m.KeyReveal = new(structs.KeyRevealMessage)
+		err = m.KeyReveal.FromBytes(p[1:])
+	case messageTypeDecryptionBatch:
+		m.DecryptionBatch = new(structs.DecryptionBatchMessage)
+		err = m.DecryptionBatch.FromBytes(p[1:])
 	default:
 		return m, ErrInvalidMessageType
 	}
 	return
 }
 
-type MockBroadcastChannel struct {
-	messages []Message
-	params   *ElectionParams
-	id       ElectionID
+// Maximum size of a message in a message list.
+const maxMessageSize = 1 << 24
+
+/*
+Serializes a list of messages, each prefixed with its length as a varint.
+Broadcast servers use this framing when clients request framing version 1.
+*/
+func EncodeMessages(msgs []Message) []byte {
+	var w util.BufferWriter
+	for _, msg := range msgs {
+		w.WriteVarVector(msg.Bytes())
+	}
+	return w.Buffer
+}
+
+// Deserializes a list of messages encoded by EncodeMessages, skipping messages of unknown type.
+func DecodeMessages(p []byte) ([]Message, error) {
+	return decodeMessages(p, nil)
 }
 
-func NewMockBroadcastChannel(id ElectionID, params *ElectionParams) *MockBroadcastChannel {
-	return &MockBroadcastChannel{
+// Like DecodeMessages, calling skipped, if not nil, with each message that cannot be read.
+func decodeMessages(p []byte, skipped func(b []byte, err error)) ([]Message, error) {
+	r := util.NewBufferReader(p)
+	var msgs []Message
+	for r.Len() != 0 {
+		b, err := r.ReadVarVector(maxMessageSize)
+		if err != nil {
+			return nil, err
+		}
+		m, err := MessageFromBytes(b)
+		if err == nil {
+			msgs = append(msgs, m)
+		} else if skipped != nil {
+			skipped(b, err)
+		}
+	}
+	return msgs, nil
+}
+
+/*
+Message envelopes, the framing of message lists from framing version 2.
+Each envelope is prefixed with its length as a varint, and starts with the envelope version
+and the envelope flags as a varint, followed in version 1 by the message bytes.
+Readers skip messages of unknown type and envelopes of unknown version unless they are
+flagged critical, so that new message kinds can be introduced without breaking older clients.
+Later envelope versions keep the version and flags first.
+
+Servers list messages in the order they stored them, which is the same for every reader:
+a message listed after another was stored after it. From framing version 3, envelopes carry
+the sequence number of each message, counting from 1 without gaps, and the time at which the
+server received it, which never decreases along the sequence. Both are evidence of the order
+and timing of the messages, such as a ballot being posted before TallyStart, as far as the
+server is trusted.
+*/
+const envelopeVersion1 byte = 1
+
+// Envelope flags. Readers ignore flags they do not know.
+const (
+	// The message must not be skipped by readers that do not understand it.
+	EnvelopeCritical uint64 = 1 << iota
+	// The envelope carries a proof-of-work nonce as a varint before the message bytes.
+	EnvelopePow
+	// The envelope carries the sequence number of the message and the Unix time in nanoseconds
+	// at which it was received as varints, after the nonce. Only sent with framing version 3,
+	// since older readers would take them for message bytes.
+	EnvelopeReceipt
+)
+
+var ErrUnsupportedEnvelope = errors.New("pebble: unsupported critical message envelope")
+
+// Serializes a list of messages in envelopes of the latest version, with their proof-of-work nonces.
+func EncodeEnvelopes(msgs []Message) []byte {
+	return encodeEnvelopes(msgs, false)
+}
+
+// Serializes a list of messages in envelopes for framing version 3, with their sequence numbers and receive times.
+func EncodeReceiptEnvelopes(msgs []Message) []byte {
+	return encodeEnvelopes(msgs, true)
+}
+
+func encodeEnvelopes(msgs []Message, receipts bool) []byte {
+	var w util.BufferWriter
+	var env util.BufferWriter
+	for _, msg := range msgs {
+		env.Buffer = env.Buffer[:0]
+		env.WriteByte(envelopeVersion1)
+		var flags uint64
+		if msg.PowNonce != 0 {
+			flags |= EnvelopePow
+		}
+		receipt := receipts && msg.Sequence != 0
+		if receipt {
+			flags |= EnvelopeReceipt
+		}
+		env.WriteUvarint(flags)
+		if msg.PowNonce != 0 {
+			env.WriteUvarint(msg.PowNonce)
+		}
+		if receipt {
+			env.WriteUvarint(msg.Sequence)
+			env.WriteUvarint(uint64(msg.Received.UnixNano()))
+		}
+		env.Write(msg.Bytes())
+		w.WriteVarVector(env.Buffer)
+	}
+	return w.Buffer
+}
+
+/*
+Deserializes a list of messages encoded in envelopes.
+Skips envelopes of unknown version and messages of unknown type or that fail to deserialize,
+unless they are flagged critical, in which case the whole list is rejected.
+*/
+func DecodeEnvelopes(p []byte) ([]Message, error) {
+	return decodeEnvelopes(p, false, nil)
+}
+
+// Deserializes a batch of posted messages encoded by EncodeEnvelopes.
+// Unlike DecodeEnvelopes, any message that cannot be read fails the whole batch.
+func DecodeEnvelopeBatch(p []byte) ([]Message, error) {
+	return decodeEnvelopes(p, true, nil)
+}
+
+// Calls skipped, if not nil, with each message that is skipped because it cannot be read.
+func decodeEnvelopes(p []byte, strict bool, skipped func(b []byte, err error)) ([]Message, error) {
+	r := util.NewBufferReader(p)
+	var msgs []Message
+	for r.Len() != 0 {
+		b, err := r.ReadVarVector(maxMessageSize)
+		if err != nil {
+			return nil, err
+		}
+		m, ok, err := decodeEnvelope(b, strict, skipped)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs, nil
+}
+
+// Deserializes the message in an envelope. Returns false if the message is skipped,
+// calling skipped, if not nil, with the message bytes if they cannot be read.
+func decodeEnvelope(b []byte, strict bool, skipped func(b []byte, err error)) (Message, bool, error) {
+	env := util.NewBufferReader(b)
+	version, err := env.ReadByte()
+	if err != nil {
+		return Message{}, false, err
+	}
+	flags, err := env.ReadUvarint()
+	if err != nil {
+		return Message{}, false, err
+	}
+	critical := strict || flags&EnvelopeCritical != 0
+	if version != envelopeVersion1 {
+		if critical {
+			return Message{}, false, ErrUnsupportedEnvelope
+		}
+		return Message{}, false, nil
+	}
+	var nonce, seq, received uint64
+	if flags&EnvelopePow != 0 {
+		nonce, err = env.ReadUvarint()
+		if err != nil {
+			return Message{}, false, err
+		}
+	}
+	if flags&EnvelopeReceipt != 0 {
+		seq, err = env.ReadUvarint()
+		if err == nil {
+			received, err = env.ReadUvarint()
+		}
+		if err != nil {
+			return Message{}, false, err
+		}
+	}
+	raw := env.ReadRemaining()
+	m, err := MessageFromBytes(raw)
+	if err != nil {
+		if critical {
+			return Message{}, false, err
+		}
+		if skipped != nil {
+			skipped(raw, err)
+		}
+		return Message{}, false, nil
+	}
+	m.PowNonce = nonce
+	if seq != 0 {
+		m.Sequence = seq
+		m.Received = time.Unix(0, int64(received))
+	}
+	return m, true, nil
+}
+
+// Deserializes a batch of posted messages encoded by EncodeMessages.
+// Unlike DecodeMessages, a message of unknown type fails the whole batch.
+func DecodeMessageBatch(p []byte) ([]Message, error) {
+	r := util.NewBufferReader(p)
+	var msgs []Message
+	for r.Len() != 0 {
+		b, err := r.ReadVarVector(maxMessageSize)
+		if err != nil {
+			return nil, err
+		}
+		m, err := MessageFromBytes(b)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, nil
+}
+
+/*
+A broadcast channel storing its messages in a MessageStore. Messages identical to an
+earlier one are dropped, and reported to the poster with ErrDuplicateMessage if enabled
+by SetReportDuplicates. Messages without the proof of work required by the params,
+or exceeding the quotas set by SetQuotas, are rejected, as are credential messages of an
+epoch below the last credential of their voter, see structs.CredentialMessage.
+The channel must be the only writer of its store.
+*/
+type StoreChannel struct {
+	mu    sync.Mutex
+	store MessageStore
+	// Closed and replaced whenever messages are posted, waking up watchers.
+	posted      chan struct{}
+	params      *ElectionParams
+	id          ElectionID
+	eligibility *structs.EligibilityList
+	// Sequence numbers of the stored messages, by ID.
+	seen             map[MessageID]uint64
+	reportDuplicates bool
+	quotas           PostingQuotas
+	counts           map[string]int
+	n                uint64
+	// Highest epoch of the stored credential messages, by public key hash.
+	epochs map[util.HashValue]uint32
+	// Receive time of the last message, which the next ones never precede.
+	last time.Time
+	// Clock of the receive times, the local clock if nil.
+	clock timesource.Source
+}
+
+// Opens the channel over the messages already in the store.
+func NewStoreChannel(ctx context.Context, id ElectionID, params *ElectionParams, store MessageStore) (*StoreChannel, error) {
+	bc := &StoreChannel{
+		store:  store,
 		params: params,
 		id:     id,
+		seen:   make(map[MessageID]uint64),
+		counts: make(map[string]int),
+		epochs: make(map[util.HashValue]uint32),
+	}
+	err := bc.forEach(ctx, func(m Message) {
+		bc.n++
+		bc.seen[m.Id()] = bc.n
+		bc.last = m.Received
+		bc.recordEpoch(m)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return bc, nil
 }
 
-func (bc *MockBroadcastChannel) Id() ElectionID {
+// A StoreChannel keeping its messages in memory.
+type MockBroadcastChannel = StoreChannel
+
+func NewMockBroadcastChannel(id ElectionID, params *ElectionParams) *MockBroadcastChannel {
+	// Opening an empty memory store cannot fail
+	bc, _ := NewStoreChannel(context.Background(), id, params, NewMemoryStore())
+	return bc
+}
+
+// Returns the store of the channel, whose length and head may be read while the channel is used.
+func (bc *StoreChannel) Store() MessageStore {
+	return bc.store
+}
+
+func (bc *StoreChannel) Id() ElectionID {
 	return bc.id
 }
 
-func (bc *MockBroadcastChannel) Params(ctx context.Context) (*ElectionParams, error) {
+func (bc *StoreChannel) Params(ctx context.Context) (*ElectionParams, error) {
 	return bc.params, nil
 }
 
-func (bc *MockBroadcastChannel) Get(ctx context.Context) ([]Message, error) {
-	return bc.messages, nil
+func (bc *StoreChannel) Get(ctx context.Context) ([]Message, error) {
+	var msgs []Message
+	err := bc.forEach(ctx, func(m Message) {
+		msgs = append(msgs, m)
+	})
+	return msgs, err
 }
 
-func (bc *MockBroadcastChannel) Post(ctx context.Context, m Message) error {
-	bc.messages = append(bc.messages, m)
+func (bc *StoreChannel) Stream(ctx context.Context) (MessageIterator, error) {
+	return bc.store.Iterate(ctx, 0)
+}
+
+// Calls f on each stored message.
+func (bc *StoreChannel) forEach(ctx context.Context, f func(Message)) error {
+	it, err := bc.store.Iterate(ctx, 0)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for {
+		m, err := it.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		f(m)
+	}
+}
+
+// Returns a channel closed when messages are next posted.
+func (bc *StoreChannel) nextPost() <-chan struct{} {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if bc.posted == nil {
+		bc.posted = make(chan struct{})
+	}
+	return bc.posted
+}
+
+func (bc *StoreChannel) Watch(ctx context.Context) (<-chan Message, error) {
+	next, err := bc.store.Len(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan Message)
+	go func() {
+		defer close(ch)
+		for {
+			// Taken before reading, so that messages posted while reading wake it up
+			posted := bc.nextPost()
+			it, err := bc.store.Iterate(ctx, next)
+			if err != nil {
+				return
+			}
+			sent, err := sendAll(ctx, it, ch)
+			it.Close()
+			next += sent
+			if err != nil {
+				return
+			}
+			if sent != 0 {
+				continue
+			}
+			select {
+			case <-posted:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Sends the messages of the iterator on ch, and returns how many were sent.
+func sendAll(ctx context.Context, it MessageIterator, ch chan<- Message) (uint64, error) {
+	var sent uint64
+	for {
+		m, err := it.Next()
+		if err == io.EOF {
+			return sent, nil
+		} else if err != nil {
+			return sent, err
+		}
+		select {
+		case ch <- m:
+			sent++
+		case <-ctx.Done():
+			return sent, ctx.Err()
+		}
+	}
+}
+
+func (bc *StoreChannel) Post(ctx context.Context, m Message) error {
+	return bc.PostAll(ctx, []Message{m})
+}
+
+// Posts the messages that were not posted before. A batch containing a message that is rejected,
+// including a duplicate if duplicates are reported, is rejected as a whole.
+func (bc *StoreChannel) PostAll(ctx context.Context, msgs []Message) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	hashes := make([]MessageID, len(msgs))
+	batch := make(map[MessageID]bool, len(msgs))
+	used := make(map[string]int)
+	// Highest epoch of the credentials of the batch, so that a batch cannot mix stale and newer epochs
+	epochs := make(map[util.HashValue]uint32)
+	for i, m := range msgs {
+		if bc.params != nil {
+			if err := m.VerifyPow(bc.id, bc.params.PowDifficulty); err != nil {
+				return err
+			}
+		}
+		hashes[i] = m.Id()
+		_, seen := bc.seen[hashes[i]]
+		duplicate := seen || batch[hashes[i]]
+		if duplicate && bc.reportDuplicates {
+			return ErrDuplicateMessage
+		}
+		batch[hashes[i]] = true
+		if err := bc.checkEpoch(m, epochs); err != nil && !duplicate {
+			return err
+		}
+		if c := m.Credential; c != nil && !duplicate {
+			if pkh := util.Hash(c.PublicKey); c.Epoch > epochs[pkh] {
+				epochs[pkh] = c.Epoch
+			}
+		}
+		if key, limit := bc.quotas.key(m); key != "" && !duplicate {
+			used[key]++
+			if bc.counts[key]+used[key] > limit {
+				return ErrQuotaExceeded
+			}
+		}
+	}
+	now := time.Now()
+	if bc.clock != nil {
+		now = bc.clock.Now()
+	}
+	if now.Before(bc.last) {
+		now = bc.last
+	}
+	var stored []Message
+	added := make(map[MessageID]bool, len(msgs))
+	for i, m := range msgs {
+		if _, seen := bc.seen[hashes[i]]; !seen && !added[hashes[i]] {
+			added[hashes[i]] = true
+			m.Sequence = bc.n + uint64(len(stored)) + 1
+			m.Received = now
+			stored = append(stored, m)
+		}
+	}
+	if len(stored) == 0 {
+		return nil
+	}
+	err := bc.store.Append(ctx, stored)
+	if err != nil {
+		return err
+	}
+	for _, m := range stored {
+		bc.seen[m.Id()] = m.Sequence
+		if key, _ := bc.quotas.key(m); key != "" {
+			bc.counts[key]++
+		}
+		bc.recordEpoch(m)
+	}
+	bc.n += uint64(len(stored))
+	bc.last = now
+	if bc.posted != nil {
+		close(bc.posted)
+		bc.posted = nil
+	}
+	return nil
+}
+
+/*
+Rejects a credential message of an epoch below the stored credentials of its voter, or below
+the credentials of the voter earlier in the batch (see PostAll), with ErrStaleCredential.
+Credentials of a nonzero epoch must be validly signed, lest a forged epoch lock the voter
+out of their registration.
+*/
+func (bc *StoreChannel) checkEpoch(m Message, batch map[util.HashValue]uint32) error {
+	c := m.Credential
+	if c == nil {
+		return nil
+	}
+	pkh := util.Hash(c.PublicKey)
+	if c.Epoch < bc.epochs[pkh] || c.Epoch < batch[pkh] {
+		return ErrStaleCredential
+	}
+	if c.Epoch != 0 {
+		return c.Verify(bc.id)
+	}
+	return nil
+}
+
+// Records the epoch of a stored credential message.
+func (bc *StoreChannel) recordEpoch(m Message) {
+	if c := m.Credential; c != nil {
+		pkh := util.Hash(c.PublicKey)
+		if c.Epoch > bc.epochs[pkh] {
+			bc.epochs[pkh] = c.Epoch
+		}
+	}
+}
+
+// Sets the limits on the messages accepted by the channel, counting the messages already posted.
+func (bc *StoreChannel) SetQuotas(ctx context.Context, q PostingQuotas) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	counts := make(map[string]int)
+	err := bc.forEach(ctx, func(m Message) {
+		if key, _ := q.key(m); key != "" {
+			counts[key]++
+		}
+	})
+	if err != nil {
+		return err
+	}
+	bc.quotas, bc.counts = q, counts
 	return nil
 }
+
+// Sets whether posting a message identical to an earlier one fails with ErrDuplicateMessage.
+func (bc *StoreChannel) SetReportDuplicates(report bool) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.reportDuplicates = report
+}
+
+// Sets the clock of the receive times of the messages posted, such as the clock of a simulation.
+func (bc *StoreChannel) SetTimeSource(ts timesource.Source) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.clock = ts
+}
+
+// Sets the full eligibility list distributed by the channel.
+func (bc *StoreChannel) SetEligibilityList(list *structs.EligibilityList) {
+	bc.eligibility = list
+}
+
+func (bc *StoreChannel) EligibilityList(ctx context.Context) (*structs.EligibilityList, error) {
+	if bc.eligibility == nil {
+		return bc.params.EligibilityList, nil
+	}
+	return bc.eligibility, nil
+}
+
+func (bc *StoreChannel) EligibilityProof(ctx context.Context, pkh util.HashValue) (*structs.EligibilityProof, error) {
+	list, err := bc.EligibilityList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return list.Proof(pkh)
+}
@@ -0,0 +1,680 @@
+package voting
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+func TestEncodeMessages(t *testing.T) {
+	msgs := []Message{
+		{SignedBallot: &structs.SignedBallot{SerialNo: []byte("serial"), EncryptedBallot: structs.EncryptedBallot{Payload: bytes.Repeat([]byte{1}, 0x9000)}}},
+		{Decryption: &structs.DecryptionMessage{Output: []byte("output")}},
+	}
+	p := EncodeMessages(msgs)
+	// Messages of unknown type are skipped
+	p = append(p, 2, 0xFF, 0)
+	decoded, err := DecodeMessages(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 || decoded[0].SignedBallot == nil || decoded[1].Decryption == nil {
+		t.Fatal("messages not decoded")
+	}
+	if !bytes.Equal(decoded[0].Bytes(), msgs[0].Bytes()) {
+		t.Error("large message not preserved")
+	}
+	if _, err = DecodeMessages(p[:len(p)-5]); err == nil {
+		t.Error("truncated list decoded")
+	}
+}
+
+func TestBroadcastClientGzip(t *testing.T) {
+	msgs := []Message{
+		{SignedBallot: &structs.SignedBallot{SerialNo: []byte("serial"), EncryptedBallot: structs.EncryptedBallot{Payload: bytes.Repeat([]byte{1}, 0x9000)}}},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Accept-Encoding") != "gzip" {
+			t.Error("gzip not requested")
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write(EncodeMessages(msgs))
+		gz.Close()
+	}))
+	defer srv.Close()
+	bc, err := NewBroadcastClient(Invitation{Address: []byte("election"), Servers: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := bc.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || !bytes.Equal(decoded[0].Bytes(), msgs[0].Bytes()) {
+		t.Error("compressed messages not decoded")
+	}
+}
+
+func TestBroadcastClientPostAll(t *testing.T) {
+	msgs := []Message{
+		{Decryption: &structs.DecryptionMessage{Output: []byte("first")}},
+		{Decryption: &structs.DecryptionMessage{Output: []byte("second")}},
+	}
+	mock := NewMockBroadcastChannel(ElectionID{}, nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("framing") != "2" {
+			t.Error("batch not framed")
+		}
+		p, _ := io.ReadAll(req.Body)
+		batch, err := DecodeEnvelopeBatch(p)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		PostAll(req.Context(), mock, batch)
+	}))
+	defer srv.Close()
+	bc, err := NewBroadcastClient(Invitation{Address: []byte("election"), Servers: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bc.PostAll(context.Background(), msgs); err != nil {
+		t.Fatal(err)
+	}
+	posted, _ := mock.Get(context.Background())
+	if len(posted) != 2 || string(posted[1].Decryption.Output) != "second" {
+		t.Error("batch not posted in order")
+	}
+	if _, err = DecodeEnvelopeBatch([]byte{3, 1, 0, 0xFF}); err != ErrInvalidMessageType {
+		t.Errorf("unknown message type in batch: %v", err)
+	}
+	if _, err = DecodeMessageBatch([]byte{2, 0xFF, 0}); err != ErrInvalidMessageType {
+		t.Errorf("unknown message type in legacy batch: %v", err)
+	}
+}
+
+func TestBroadcastClientRetry(t *testing.T) {
+	mock := NewMockBroadcastChannel(ElectionID{}, nil)
+	mock.SetReportDuplicates(true)
+	failures, requests := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Method == http.MethodPost {
+			p, _ := io.ReadAll(req.Body)
+			m, err := MessageFromBytes(p)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			err = mock.Post(req.Context(), m)
+			if err == ErrDuplicateMessage {
+				http.Error(w, err.Error(), http.StatusConflict)
+			} else if failures > 0 {
+				// The message is posted but the response is lost
+				failures--
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			}
+			return
+		}
+		if failures > 0 {
+			failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		msgs, _ := mock.Get(req.Context())
+		w.Write(EncodeMessages(msgs))
+	}))
+	defer srv.Close()
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 4 * time.Millisecond}
+	bc, err := NewBroadcastClient(Invitation{Address: []byte("election"), Servers: []string{srv.URL}}, WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	m := Message{Decryption: &structs.DecryptionMessage{Output: []byte("output")}}
+	failures = 1
+	if err = bc.Post(ctx, m); err != nil {
+		t.Fatalf("retried post failed: %v", err)
+	}
+	if err = bc.Post(ctx, m); err == nil {
+		t.Error("duplicate accepted on first attempt")
+	}
+	failures, requests = 2, 0
+	msgs, err := bc.Get(ctx)
+	if err != nil || len(msgs) != 1 || requests != 3 {
+		t.Errorf("get not retried: %v", err)
+	}
+	failures, requests = 3, 0
+	if _, err = bc.Get(ctx); err == nil || requests != 3 {
+		t.Error("attempts not bounded")
+	}
+	failures, requests = 0, 0
+	if err = bc.post(ctx, bc.messagesURI, []byte{0xFF}); err == nil || requests != 1 {
+		t.Error("client error retried")
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = bc.Get(cctx); err == nil {
+		t.Error("cancelled request succeeded")
+	}
+}
+
+func TestMockBroadcastChannelDedupe(t *testing.T) {
+	ctx := context.Background()
+	a := Message{Decryption: &structs.DecryptionMessage{Output: []byte("a")}}
+	b := Message{Decryption: &structs.DecryptionMessage{Output: []byte("b")}}
+	bc := NewMockBroadcastChannel(ElectionID{}, nil)
+	if err := PostAll(ctx, bc, []Message{a, a, b}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Post(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, _ := bc.Get(ctx); len(msgs) != 2 {
+		t.Errorf("%d messages stored", len(msgs))
+	}
+	bc.SetReportDuplicates(true)
+	if err := bc.Post(ctx, a); err != ErrDuplicateMessage {
+		t.Errorf("duplicate not reported: %v", err)
+	}
+	c := Message{Decryption: &structs.DecryptionMessage{Output: []byte("c")}}
+	if err := bc.PostAll(ctx, []Message{c, b}); err != ErrDuplicateMessage {
+		t.Errorf("duplicate in batch not reported: %v", err)
+	}
+	if msgs, _ := bc.Get(ctx); len(msgs) != 2 {
+		t.Error("batch with a duplicate partially posted")
+	}
+}
+
+func TestDecodeEnvelopes(t *testing.T) {
+	msg := Message{Decryption: &structs.DecryptionMessage{Output: []byte("output")}}
+	p := EncodeEnvelopes([]Message{msg})
+	var w util.BufferWriter
+	// Unknown message type
+	w.WriteVarVector([]byte{1, 0, 0xFF, 1, 2})
+	// Unknown envelope version
+	w.WriteVarVector([]byte{2, 0, 1, 2, 3})
+	// Unknown flag
+	w.WriteVarVector(append([]byte{1, 0x40}, msg.Bytes()...))
+	p = append(p, w.Buffer...)
+	msgs, err := DecodeEnvelopes(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || !bytes.Equal(msgs[1].Bytes(), msg.Bytes()) {
+		t.Errorf("decoded %d messages", len(msgs))
+	}
+	w = util.BufferWriter{}
+	w.WriteVarVector([]byte{1, byte(EnvelopeCritical), 0xFF, 1, 2})
+	if _, err = DecodeEnvelopes(append(p, w.Buffer...)); err != ErrInvalidMessageType {
+		t.Errorf("critical message of unknown type: %v", err)
+	}
+	w = util.BufferWriter{}
+	w.WriteVarVector([]byte{2, byte(EnvelopeCritical)})
+	if _, err = DecodeEnvelopes(append(p, w.Buffer...)); err != ErrUnsupportedEnvelope {
+		t.Errorf("critical envelope of unknown version: %v", err)
+	}
+}
+
+func TestEnvelopeReceipts(t *testing.T) {
+	ctx := context.Background()
+	bc := NewMockBroadcastChannel(ElectionID{}, nil)
+	var posted []Message
+	for i := 0; i < 3; i++ {
+		posted = append(posted, Message{Decryption: &structs.DecryptionMessage{Output: []byte{byte(i)}}, PowNonce: uint64(i)})
+	}
+	if err := bc.Post(ctx, posted[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.PostAll(ctx, posted[1:]); err != nil {
+		t.Fatal(err)
+	}
+	msgs, _ := bc.Get(ctx)
+	for i, m := range msgs {
+		if m.Sequence != uint64(i+1) || m.Received.IsZero() || (i != 0 && m.Received.Before(msgs[i-1].Received)) {
+			t.Errorf("message %d: sequence %d received %v", i, m.Sequence, m.Received)
+		}
+	}
+	decoded, err := DecodeEnvelopes(EncodeReceiptEnvelopes(msgs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range decoded {
+		if m.Sequence != msgs[i].Sequence || !m.Received.Equal(msgs[i].Received) || m.PowNonce != msgs[i].PowNonce {
+			t.Errorf("message %d: decoded %d %v %d", i, m.Sequence, m.Received, m.PowNonce)
+		}
+	}
+	// Framing version 2 has no receipts
+	decoded, _ = DecodeEnvelopes(EncodeEnvelopes(msgs))
+	if decoded[0].Sequence != 0 || !decoded[0].Received.IsZero() {
+		t.Error("receipt in framing version 2")
+	}
+}
+
+func TestMockBroadcastChannelQuotas(t *testing.T) {
+	ctx := context.Background()
+	ballot := func(serialNo, payload string) Message {
+		return Message{SignedBallot: &structs.SignedBallot{SerialNo: []byte(serialNo), EncryptedBallot: structs.EncryptedBallot{Payload: []byte(payload)}}}
+	}
+	bc := NewMockBroadcastChannel(ElectionID{}, nil)
+	bc.Post(ctx, ballot("a", "1"))
+	bc.SetQuotas(ctx, PostingQuotas{BallotsPerSerialNo: 2})
+	if err := bc.Post(ctx, ballot("a", "2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Post(ctx, ballot("a", "3")); err != ErrQuotaExceeded {
+		t.Errorf("third ballot of a serial number: %v", err)
+	}
+	// Duplicates are not counted
+	if err := bc.Post(ctx, ballot("a", "2")); err != nil {
+		t.Errorf("duplicate ballot: %v", err)
+	}
+	if err := bc.PostAll(ctx, []Message{ballot("b", "1"), ballot("b", "2"), ballot("b", "3")}); err != ErrQuotaExceeded {
+		t.Errorf("batch exceeding quota: %v", err)
+	}
+	if msgs, _ := bc.Get(ctx); len(msgs) != 2 {
+		t.Errorf("%d messages stored", len(msgs))
+	}
+	bc.SetQuotas(ctx, DefaultPostingQuotas)
+	cred := Message{Credential: &structs.CredentialMessage{PublicKey: []byte("key"), Credential: []byte("1")}}
+	if err := bc.Post(ctx, cred); err != nil {
+		t.Fatal(err)
+	}
+	cred = Message{Credential: &structs.CredentialMessage{PublicKey: []byte("key"), Credential: []byte("2")}}
+	if err := bc.Post(ctx, cred); err != ErrQuotaExceeded {
+		t.Errorf("second credential of a key: %v", err)
+	}
+}
+
+func TestMockBroadcastChannelCredentialEpochs(t *testing.T) {
+	ctx := context.Background()
+	k, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := ElectionID{1}
+	cred := func(credential string, epoch uint32) Message {
+		c := &structs.CredentialMessage{Credential: []byte(credential), Epoch: epoch}
+		if err := c.Sign(k, id); err != nil {
+			t.Fatal(err)
+		}
+		return Message{Credential: c}
+	}
+	bc := NewMockBroadcastChannel(id, nil)
+	bc.SetQuotas(ctx, DefaultPostingQuotas)
+	early := cred("1", 0)
+	if err = bc.Post(ctx, early); err != nil {
+		t.Fatal(err)
+	}
+	rotated := cred("2", 1)
+	decoded, err := MessageFromBytes(rotated.Bytes())
+	if err != nil || decoded.Credential.Epoch != 1 || decoded.Credential.Verify(id) != nil {
+		t.Fatalf("credential epoch not preserved: %v", err)
+	}
+	if err = bc.Post(ctx, rotated); err != nil {
+		t.Fatal(err)
+	}
+	// Without quotas, replays of the earlier epoch are still rejected
+	if err = bc.SetQuotas(ctx, PostingQuotas{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = bc.Post(ctx, cred("3", 0)); err != ErrStaleCredential {
+		t.Errorf("credential of a replaced epoch: %v", err)
+	}
+	forged := cred("4", 2)
+	forged.Credential.Credential = []byte("5")
+	if err = bc.Post(ctx, forged); err == nil {
+		t.Error("credential of a forged epoch accepted")
+	}
+	// Reopening the store keeps the epochs
+	reopened, err := NewStoreChannel(ctx, id, nil, bc.Store())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reopened.Post(ctx, cred("6", 0)); err != ErrStaleCredential {
+		t.Errorf("credential of a replaced epoch after reopening: %v", err)
+	}
+	if ErrorCodeOf(ErrStaleCredential) != util.ErrorDuplicate {
+		t.Error("stale credential not reported as a duplicate")
+	}
+	// Counting the epoch up does not renew the quota of the voter
+	bc = NewMockBroadcastChannel(id, nil)
+	bc.SetQuotas(ctx, DefaultPostingQuotas)
+	for epoch := uint32(1); epoch <= uint32(DefaultPostingQuotas.RotationsPerKey); epoch++ {
+		if err = bc.Post(ctx, cred(strconv.Itoa(int(epoch)), epoch)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = bc.Post(ctx, cred("next", 100)); err != ErrQuotaExceeded {
+		t.Errorf("rotation over the quota: %v", err)
+	}
+	// A batch cannot mix stale and newer epochs
+	bc = NewMockBroadcastChannel(id, nil)
+	if err = bc.PostAll(ctx, []Message{cred("a", 2), cred("b", 1)}); err != ErrStaleCredential {
+		t.Errorf("batch of a stale epoch: %v", err)
+	}
+	if msgs, _ := bc.Get(ctx); len(msgs) != 0 {
+		t.Errorf("%d messages of a rejected batch stored", len(msgs))
+	}
+}
+
+func TestBroadcastClientStream(t *testing.T) {
+	var msgs []Message
+	for i := 0; i < 100; i++ {
+		msgs = append(msgs, Message{Decryption: &structs.DecryptionMessage{Output: []byte{byte(i)}}})
+	}
+	framing := "2"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if framing == "2" {
+			w.Header().Set("Pebble-Framing", "2")
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			for _, m := range msgs {
+				gz.Write(EncodeEnvelopes([]Message{m}))
+			}
+			gz.Close()
+		} else {
+			w.Write(EncodeMessages(msgs))
+		}
+	}))
+	defer srv.Close()
+	bc, err := NewBroadcastClient(Invitation{Address: []byte("election"), Servers: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, framing = range []string{"2", "1"} {
+		it, err := bc.Stream(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for {
+			m, err := it.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Decryption == nil || m.Decryption.Output[0] != byte(n) {
+				t.Fatalf("framing %s: message %d out of order", framing, n)
+			}
+			n++
+		}
+		it.Close()
+		if n != len(msgs) {
+			t.Errorf("framing %s: streamed %d messages", framing, n)
+		}
+	}
+}
+
+func TestBroadcastClientResume(t *testing.T) {
+	var msgs []Message
+	for i := 0; i < 100; i++ {
+		msgs = append(msgs, Message{Decryption: &structs.DecryptionMessage{Output: []byte{byte(i)}}})
+	}
+	body := EncodeEnvelopes(msgs)
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		w.Header().Set("Pebble-Framing", "2")
+		if len(ranges) == 1 {
+			// The connection drops halfway through the body
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Write(body[:len(body)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(body))
+	}))
+	defer srv.Close()
+	policy := RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	bc, err := NewBroadcastClient(Invitation{Address: []byte("election"), Servers: []string{srv.URL}}, WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := bc.Get(context.Background())
+	if err != nil || len(got) != len(msgs) {
+		t.Fatalf("%d messages: %v", len(got), err)
+	}
+	if len(ranges) != 2 || ranges[1] != "bytes="+strconv.Itoa(len(body)/2)+"-" {
+		t.Errorf("download not resumed: %q", ranges)
+	}
+}
+
+func TestMockBroadcastChannelWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	bc := NewMockBroadcastChannel(ElectionID{}, nil)
+	bc.Post(ctx, Message{Decryption: &structs.DecryptionMessage{Output: []byte{0}}})
+	ch, err := bc.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for i := 1; i <= 3; i++ {
+			bc.Post(ctx, Message{Decryption: &structs.DecryptionMessage{Output: []byte{byte(i)}}})
+		}
+	}()
+	for i := 1; i <= 3; i++ {
+		select {
+		case m := <-ch:
+			if m.Decryption.Output[0] != byte(i) {
+				t.Fatalf("received message %d, expected %d", m.Decryption.Output[0], i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+	}
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Error("watch not closed")
+	}
+}
+
+func TestBroadcastClientPinning(t *testing.T) {
+	requests := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write(EncodeMessages(nil))
+	}))
+	defer srv.Close()
+	inv := Invitation{Address: []byte("election"), Servers: []string{srv.URL}, ServerPin: ServerPin(srv.Certificate())}
+	bc, err := NewBroadcastClient(inv, WithBearerToken("token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bc.Get(context.Background()); err != nil {
+		t.Fatalf("pinned server not trusted: %v", err)
+	}
+	bc, _ = NewBroadcastClient(inv)
+	if _, err = bc.Get(context.Background()); err == nil {
+		t.Error("unauthenticated request succeeded")
+	}
+	requests = 0
+	bc, _ = NewBroadcastClient(inv, WithServerPin(make([]byte, 32)), WithBearerToken("token"))
+	if _, err = bc.Get(context.Background()); !errors.Is(err, ErrServerKeyMismatch) || requests != 0 {
+		t.Errorf("server with another key trusted: %v", err)
+	}
+	inv.Servers[0] = "http://a.example"
+	if _, err = NewBroadcastClient(inv); err != ErrServerNotPinnable {
+		t.Error("pinned server over plain http")
+	}
+}
+
+func TestBroadcastClientProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		proxied = req.URL.Host
+		w.Write(EncodeMessages(nil))
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	inv := Invitation{Address: []byte("election"), Servers: []string{"http://server.onion"}}
+	bc, err := NewBroadcastClient(inv, WithProxy(proxyURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bc.Get(context.Background()); err != nil || proxied != "server.onion" {
+		t.Errorf("request not proxied: %v", err)
+	}
+	bc, _ = NewBroadcastClient(inv, WithTor("127.0.0.1:9050"))
+	req, _ := http.NewRequest(http.MethodGet, bc.messagesURI, nil)
+	tor := bc.client.Transport.(*http.Transport).Proxy
+	u1, _ := tor(req)
+	u2, _ := tor(req)
+	if u1.Scheme != "socks5" || u1.Host != "127.0.0.1:9050" || u1.User.String() == u2.User.String() {
+		t.Error("requests not isolated on Tor circuits")
+	}
+}
+
+func TestBroadcastClientLongPoll(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	mock := NewMockBroadcastChannel(ElectionID{}, nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		msgs, _ := mock.Get(ctx)
+		since, _ := strconv.Atoi(req.URL.Query().Get("since"))
+		if len(msgs) <= since && req.URL.Query().Get("wait") != "" {
+			posted, _ := mock.Watch(req.Context())
+			<-posted
+			msgs, _ = mock.Get(ctx)
+		}
+		w.Header().Set("Pebble-Framing", "2")
+		w.Header().Set("Pebble-Message-Count", strconv.Itoa(len(msgs)))
+		if since > len(msgs) {
+			since = len(msgs)
+		}
+		w.Write(EncodeEnvelopes(msgs[since:]))
+	}))
+	defer srv.Close()
+	// Ends the pending long poll before the server closes
+	defer cancel()
+	bc, err := NewBroadcastClient(Invitation{Address: []byte("election"), Servers: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.Post(ctx, Message{Decryption: &structs.DecryptionMessage{Output: []byte{0}}})
+	watch, err := bc.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.Post(ctx, Message{Decryption: &structs.DecryptionMessage{Output: []byte{1}}})
+	select {
+	case m := <-watch:
+		if m.Decryption.Output[0] != 1 {
+			t.Error("watched message already posted")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered by long polling")
+	}
+	legacy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		msgs, _ := mock.Get(ctx)
+		w.Write(EncodeMessages(msgs))
+	}))
+	defer legacy.Close()
+	bc, _ = NewBroadcastClient(Invitation{Address: []byte("election"), Servers: []string{legacy.URL}})
+	msgs, total, err := bc.GetSince(ctx, 1, time.Second)
+	if err != nil || total != 2 || len(msgs) != 1 || msgs[0].Decryption.Output[0] != 1 {
+		t.Errorf("messages not skipped without long polling: %v", err)
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	params := generateParamsV1()
+	msgs := []Message{
+		{Credential: &structs.CredentialMessage{Credential: []byte{1}, PublicKey: []byte{2}, Signature: []byte{3}}},
+		{Decryption: &structs.DecryptionMessage{Proof: []byte{4}}, PowNonce: 5},
+	}
+	bc, err := ReadTranscript(ElectionID{1}, EncodeTranscript(params, msgs), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := bc.Get(context.Background())
+	if len(got) != 2 || got[1].PowNonce != 5 || !bytes.Equal(got[0].Bytes(), msgs[0].Bytes()) {
+		t.Errorf("messages not preserved: %v", got)
+	}
+	if p, _ := bc.Params(context.Background()); !bytes.Equal(p.Bytes(), params.Bytes()) {
+		t.Error("params not preserved")
+	}
+	if bc.Post(context.Background(), msgs[0]) != ErrReadOnlyChannel {
+		t.Error("transcript accepted a post")
+	}
+	if _, err = ReadTranscript(ElectionID{1}, EncodeEnvelopes(msgs), nil); err != ErrTranscriptNoParams {
+		t.Error("transcript without params accepted")
+	}
+}
+
+func TestBroadcastClientQuarantine(t *testing.T) {
+	msg := Message{Decryption: &structs.DecryptionMessage{Output: []byte("output")}}
+	var w util.BufferWriter
+	w.WriteVarVector([]byte{1, 0, 0xFF, 1, 2})
+	body := append(EncodeEnvelopes([]Message{msg}), w.Buffer...)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Pebble-Framing", "2")
+		w.Write(body)
+	}))
+	defer srv.Close()
+	q := NewMemoryQuarantine(1)
+	bc, err := NewBroadcastClient(Invitation{Address: []byte("election"), Servers: []string{srv.URL}}, WithQuarantine(q))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		msgs, err := bc.Get(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 1 {
+			t.Errorf("decoded %d messages", len(msgs))
+		}
+	}
+	entries := q.Query(time.Time{}, nil)
+	if len(entries) != 1 || !bytes.Equal(entries[0].Data, []byte{0xFF, 1, 2}) || entries[0].Reason != ErrInvalidMessageType.Error() {
+		t.Fatalf("quarantined %+v", entries)
+	}
+	if len(q.Query(entries[0].Time.Add(time.Second), nil)) != 0 {
+		t.Error("query ignores since")
+	}
+	if len(q.Query(time.Time{}, func(m QuarantinedMessage) bool { return m.Source != entries[0].Source })) != 0 {
+		t.Error("query ignores filter")
+	}
+}
+
+func TestBroadcastClientErrorCode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error":{"code":"wrong-phase","message":"pebble: wrong election phase"}}`))
+	}))
+	defer srv.Close()
+	bc, err := NewBroadcastClient(Invitation{Address: []byte("election"), Servers: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bc.Post(context.Background(), Message{Decryption: &structs.DecryptionMessage{Output: []byte("output")}})
+	if ErrorCodeOf(err) != util.ErrorWrongPhase {
+		t.Errorf("code of %v: %q", err, ErrorCodeOf(err))
+	}
+	if err.Error() != "pebble: server error 403 (wrong-phase): pebble: wrong election phase" {
+		t.Errorf("error %q", err)
+	}
+	if ErrorCodeOf(ErrRegistrationClosed) != util.ErrorWrongPhase || ErrorCodeOf(errors.New("other")) != "" {
+		t.Error("codes of local errors")
+	}
+}
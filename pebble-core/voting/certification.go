@@ -0,0 +1,192 @@
+package voting
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/trustee"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+var ErrCertificationSigner = errors.New("pebble: result certification by an unknown signer")
+
+// Prefixed to the certification bytes before signing.
+const certificationSignatureContext = "pebble-result-certification"
+
+/*
+Represents a signed statement that the final result of the election hashes to TallyHash,
+the hash of its canonical export (see ResultExport).
+Trustee is zero for certifications by the organizer, who signs with the organizer key,
+and the 1-based index of the trustee otherwise, who signs with their share.
+*/
+type ResultCertification struct {
+	TallyHash util.HashValue
+	Trustee   uint32
+	Signature []byte
+}
+
+func (c *ResultCertification) encode(withSignature bool) []byte {
+	var w util.BufferWriter
+	w.Write32(c.TallyHash)
+	w.WriteUint32(c.Trustee)
+	if withSignature {
+		w.Write(c.Signature)
+	}
+	return w.Buffer
+}
+
+func (c *ResultCertification) Bytes() []byte {
+	return c.encode(true)
+}
+
+func (c *ResultCertification) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	c.TallyHash, err = r.Read32()
+	if err != nil {
+		return err
+	}
+	c.Trustee, err = r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	c.Signature = r.ReadRemaining()
+	return nil
+}
+
+func (c *ResultCertification) signingBytes(eid ElectionID) []byte {
+	return util.Concat([]byte(certificationSignatureContext), eid[:], c.encode(false))
+}
+
+// Signs the certification with the organizer key for the given election.
+func (c *ResultCertification) Sign(k pubkey.PrivateKey, eid ElectionID) error {
+	var err error
+	c.Trustee = 0
+	c.Signature, err = k.Sign(c.signingBytes(eid))
+	return err
+}
+
+// Signs the certification with a trustee share for the given election.
+func (c *ResultCertification) SignTrustee(share trustee.Share, eid ElectionID) error {
+	var err error
+	c.Trustee = share.Index
+	c.Signature, err = share.Sign(c.signingBytes(eid))
+	return err
+}
+
+// Verifies the certification signature against the organizer key or set, or the trustee key in the params.
+func (c *ResultCertification) Verify(p *ElectionParams, eid ElectionID) error {
+	if c.Trustee == 0 {
+		if p.Version < ParamsVersion2 {
+			return ErrCertificationSigner
+		}
+		return p.verifyOrganizerAction(c.signingBytes(eid), c.Signature)
+	}
+	if p.Trustees == nil {
+		return ErrCertificationSigner
+	}
+	return p.Trustees.VerifySignature(c.Trustee, c.signingBytes(eid), c.Signature)
+}
+
+/*
+Computes the final result and posts its certification, signed by the organizer.
+Elections with an organizer set need the signatures of several organizers, see Cosign.
+*/
+func (e *Election) Certify(ctx context.Context, k pubkey.PrivateKey) error {
+	m, err := e.PrepareCertification(ctx)
+	if err != nil {
+		return err
+	}
+	err = e.Cosign(k, &m)
+	if err != nil {
+		return err
+	}
+	return e.PostOrganizerAction(ctx, m)
+}
+
+// Computes the final result and posts its certification, signed by the trustee holding share.
+func (e *Election) CertifyAsTrustee(ctx context.Context, share trustee.Share) error {
+	if e.Params().Trustees == nil {
+		return ErrNoTrustees
+	}
+	err := e.Params().Trustees.VerifyShare(share)
+	if err != nil {
+		return err
+	}
+	c, err := e.certification(ctx)
+	if err != nil {
+		return err
+	}
+	err = c.SignTrustee(share, e.Id())
+	if err != nil {
+		return err
+	}
+	return e.post(ctx, Message{Certification: c})
+}
+
+// Returns an unsigned certification of the final result.
+func (e *Election) certification(ctx context.Context) (*ResultCertification, error) {
+	p, err := e.Progress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p.Phase != End {
+		return nil, ErrWrongPhase
+	}
+	return &ResultCertification{TallyHash: e.TallyHash(p)}, nil
+}
+
+/*
+Reports which signers certified a result.
+Organizer and Trustees are the signers that certified TallyHash; Conflicting are the certifications
+of other results with a valid signature. The result is certified once the organizer certified it
+and, in elections with trustees, at least a threshold of trustees did.
+*/
+type CertificationStatus struct {
+	TallyHash   util.HashValue
+	Organizer   bool
+	Trustees    []uint32
+	Conflicting []ResultCertification
+	Certified   bool
+}
+
+// Collects and verifies the certifications posted for the result in the progress, which must be in the End phase.
+func (e *Election) Certification(ctx context.Context, p ElectionProgress) (s CertificationStatus, err error) {
+	if p.Phase != End {
+		return s, ErrWrongPhase
+	}
+	s.TallyHash = e.TallyHash(p)
+	msgs, err := e.readMessages(ctx, func(m Message) bool {
+		return m.Certification != nil
+	})
+	if err != nil {
+		return
+	}
+	signed := make(map[uint32]bool)
+	for _, msg := range msgs {
+		c := msg.Certification
+		if c.Verify(e.Params(), e.Id()) != nil {
+			continue
+		}
+		if c.TallyHash != s.TallyHash {
+			s.Conflicting = append(s.Conflicting, *c)
+			continue
+		}
+		if signed[c.Trustee] {
+			continue
+		}
+		signed[c.Trustee] = true
+		if c.Trustee == 0 {
+			s.Organizer = true
+		} else {
+			s.Trustees = append(s.Trustees, c.Trustee)
+		}
+	}
+	sort.Slice(s.Trustees, func(i, j int) bool {
+		return s.Trustees[i] < s.Trustees[j]
+	})
+	s.Certified = s.Organizer && (e.Params().Trustees == nil || len(s.Trustees) >= int(e.Params().Trustees.Threshold))
+	return
+}
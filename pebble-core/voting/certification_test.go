@@ -0,0 +1,134 @@
+package voting
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/trustee"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/methods"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+func TestResultCertification(t *testing.T) {
+	organizer, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, shares, err := trustee.Deal(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := generateParamsV1()
+	params.Version = ParamsVersion5
+	params.Trustees = ks
+	if err = params.Sign(organizer); err != nil {
+		t.Fatal(err)
+	}
+	eid := ElectionID{1}
+	bc := NewMockBroadcastChannel(eid, params)
+	method, err := methods.Get("Plurality", len(params.Choices), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Election{channel: bc, params: params, method: method}
+
+	p := ElectionProgress{Phase: End, Count: 3, Total: 3}
+	p.Tallies = []methods.Tally{{{Index: 0, Count: 2}, {Index: methods.BlankIndex, Count: 1}}}
+	reordered := p
+	reordered.Tallies = []methods.Tally{{{Index: methods.BlankIndex, Count: 1}, {Index: 0, Count: 2}}}
+	if e.TallyHash(p) != e.TallyHash(reordered) {
+		t.Error("tally hash depends on entry order")
+	}
+	other := p
+	other.Tallies = []methods.Tally{{{Index: 0, Count: 3}}}
+	if e.TallyHash(p) == e.TallyHash(other) {
+		t.Error("different results have the same hash")
+	}
+
+	post := func(c *ResultCertification) {
+		m, err := MessageFromBytes(Message{Certification: c}.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = bc.Post(context.Background(), m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := ResultCertification{TallyHash: e.TallyHash(p)}
+	if err = c.Sign(organizer, eid); err != nil {
+		t.Fatal(err)
+	}
+	post(&c)
+	// A certification by a trustee claiming to be another is ignored
+	forged := ResultCertification{TallyHash: e.TallyHash(p)}
+	if err = forged.SignTrustee(shares[0], eid); err != nil {
+		t.Fatal(err)
+	}
+	forged.Trustee = shares[1].Index
+	post(&forged)
+	conflicting := ResultCertification{TallyHash: e.TallyHash(other)}
+	if err = conflicting.SignTrustee(shares[2], eid); err != nil {
+		t.Fatal(err)
+	}
+	post(&conflicting)
+	s, err := e.Certification(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Organizer || len(s.Trustees) != 0 || len(s.Conflicting) != 1 || s.Certified {
+		t.Errorf("unexpected status %+v", s)
+	}
+
+	for _, share := range shares[:2] {
+		c := ResultCertification{TallyHash: e.TallyHash(p)}
+		if err = c.SignTrustee(share, eid); err != nil {
+			t.Fatal(err)
+		}
+		post(&c)
+	}
+	s, err = e.Certification(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Trustees) != 2 || !s.Certified {
+		t.Errorf("result not certified: %+v", s)
+	}
+}
+
+func TestResultExport(t *testing.T) {
+	params := generateParamsV1()
+	params.Choices = []string{"A & B", "C"}
+	method, err := methods.Get("Plurality", len(params.Choices), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Election{channel: NewMockBroadcastChannel(ElectionID{}, params), params: params, method: method}
+	p := ElectionProgress{Phase: Tally, Count: 3, Total: 4}
+	var ballots []structs.Ballot
+	for _, choices := range [][]int{{1}, {}, {1}} {
+		b, err := method.Vote(choices...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ballots = append(ballots, b)
+	}
+	p.Tallies = []methods.Tally{method.Tally(ballots)}
+	if _, err = e.ExportResult(p); err != ErrWrongPhase {
+		t.Error("result exported before the end")
+	}
+	p.Phase = End
+	export, err := e.ExportResult(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"election":"` + strings.Repeat("0", 64) + `","valid":3,"total":4,"tieBreakSeed":"` + strings.Repeat("0", 64) +
+		`","contests":[{"title":"Title","method":"Plurality","choices":[{"name":"A & B","count":0},{"name":"C","count":2}],"blank":1,"winners":[1]}]}`
+	if string(export.CanonicalJSON()) != expected {
+		t.Errorf("unexpected export %s", export.CanonicalJSON())
+	}
+	if export.Hash(params.HashScheme()) != e.TallyHash(p) {
+		t.Error("tally hash is not the hash of the export")
+	}
+}
@@ -0,0 +1,83 @@
+package voting
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+var ErrNoSecrets = errors.New("pebble: election joined without voter secrets")
+
+// Draws uniform numbers from the hashes of a seed and a counter.
+type orderStream struct {
+	scheme  util.HashScheme
+	seed    []byte
+	counter uint32
+	buf     []byte
+}
+
+func (s *orderStream) uint64() uint64 {
+	if len(s.buf) < 8 {
+		var c [4]byte
+		binary.BigEndian.PutUint32(c[:], s.counter)
+		s.counter++
+		h := s.scheme.Sum(util.DomainChoiceOrder, s.seed, c[:])
+		s.buf = h[:]
+	}
+	n := binary.BigEndian.Uint64(s.buf)
+	s.buf = s.buf[8:]
+	return n
+}
+
+// Returns a uniform number in [0, n), rejecting the draws that would bias the modulo.
+func (s *orderStream) intn(n int) int {
+	max := ^uint64(0) - ^uint64(0)%uint64(n)
+	for {
+		if x := s.uint64(); x < max {
+			return int(x % uint64(n))
+		}
+	}
+}
+
+/*
+Returns the order in which the choices of the contest are presented to the voter with the
+credential serial number, from params with a choice order seed: position k shows the choice of
+index order[k]. Every voter gets a different order, spreading the bias towards the first choices,
+while ballots keep the canonical indices. Without a seed, the choices keep the order of the params.
+*/
+func (p *ElectionParams) ChoiceOrder(serialNo []byte, contest int) []int {
+	contests := p.ContestList()
+	if contest < 0 || contest >= len(contests) {
+		return nil
+	}
+	order := make([]int, len(contests[contest].Choices))
+	for i := range order {
+		order[i] = i
+	}
+	if p.ChoiceOrderSeed == (util.HashValue{}) {
+		return order
+	}
+	var c [4]byte
+	binary.BigEndian.PutUint32(c[:], uint32(contest))
+	seed := p.HashScheme().Sum(util.DomainChoiceOrder, p.ChoiceOrderSeed[:], serialNo, c[:])
+	s := &orderStream{scheme: p.HashScheme(), seed: seed[:]}
+	// Fisher-Yates shuffle
+	for i := len(order) - 1; i > 0; i-- {
+		j := s.intn(i + 1)
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
+
+// Returns the order in which the choices of the contest are presented to the voter, see ElectionParams.ChoiceOrder.
+func (e *Election) ChoiceOrder(contest int) ([]int, error) {
+	if e.secrets == nil {
+		return nil, ErrNoSecrets
+	}
+	sec, err := e.secrets.GetSecretCredential(e.credSys)
+	if err != nil {
+		return nil, err
+	}
+	return e.Params().ChoiceOrder(sec.SerialNo(), contest), nil
+}
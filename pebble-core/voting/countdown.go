@@ -0,0 +1,114 @@
+package voting
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrInvalidPhase = errors.New("pebble: invalid election phase")
+
+/*
+Describes the phase of an election at some time and how long it lasts.
+The phase ends at Deadline, when the Next phase starts, Remaining after the time it describes;
+both are zero in the End phase. During registration, RegistrationRemaining is the time left to post credentials.
+*/
+type PhaseCountdown struct {
+	Phase                 ElectionPhase
+	Next                  ElectionPhase
+	Deadline              time.Time
+	Remaining             time.Duration
+	RegistrationOpen      bool
+	RegistrationRemaining time.Duration
+}
+
+// Returns the countdown to the next phase boundary at the given time.
+func (p *ElectionParams) CountdownAt(now time.Time) (c PhaseCountdown) {
+	c.Phase = p.PhaseAt(now)
+	c.Next = c.Phase
+	switch c.Phase {
+	case Setup:
+		c.Deadline = p.CredGenStart
+	case CredGen:
+		c.Deadline = p.CastStart
+	case Cast:
+		c.Deadline = p.TallyStart
+	case Tally:
+		c.Deadline = p.TallyEnd
+	default:
+		return
+	}
+	c.Next++
+	c.Remaining = c.Deadline.Sub(now)
+	c.RegistrationOpen = p.RegistrationOpenAt(now)
+	if c.RegistrationOpen {
+		c.RegistrationRemaining = c.Remaining
+		if p.Version >= ParamsVersion1 {
+			c.RegistrationRemaining = p.RegistrationEnd.Sub(now)
+		}
+	}
+	return
+}
+
+// The JSON form of a countdown, with phase names, Unix deadlines and durations in seconds.
+type phaseCountdownJSON struct {
+	Phase                 string `json:"phase"`
+	Next                  string `json:"nextPhase,omitempty"`
+	Deadline              int64  `json:"deadline,omitempty"`
+	Remaining             int64  `json:"remaining"`
+	RegistrationOpen      bool   `json:"registrationOpen"`
+	RegistrationRemaining int64  `json:"registrationRemaining,omitempty"`
+}
+
+// Rounds up, so that a countdown only reaches zero once the deadline has passed.
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+func (c PhaseCountdown) MarshalJSON() ([]byte, error) {
+	j := phaseCountdownJSON{
+		Phase:                 c.Phase.String(),
+		Remaining:             ceilSeconds(c.Remaining),
+		RegistrationOpen:      c.RegistrationOpen,
+		RegistrationRemaining: ceilSeconds(c.RegistrationRemaining),
+	}
+	if c.Phase != End {
+		j.Next = c.Next.String()
+		j.Deadline = c.Deadline.Unix()
+	}
+	return json.Marshal(j)
+}
+
+func (c *PhaseCountdown) UnmarshalJSON(p []byte) error {
+	var j phaseCountdownJSON
+	err := json.Unmarshal(p, &j)
+	if err != nil {
+		return err
+	}
+	*c = PhaseCountdown{
+		Remaining:             time.Duration(j.Remaining) * time.Second,
+		RegistrationOpen:      j.RegistrationOpen,
+		RegistrationRemaining: time.Duration(j.RegistrationRemaining) * time.Second,
+	}
+	if c.Phase, err = ParsePhase(j.Phase); err != nil {
+		return err
+	}
+	c.Next = c.Phase
+	if c.Phase != End {
+		if c.Next, err = ParsePhase(j.Next); err != nil {
+			return err
+		}
+		c.Deadline = time.Unix(j.Deadline, 0)
+	}
+	return nil
+}
+
+// Returns the phase with the given name, as returned by ElectionPhase.String.
+func ParsePhase(name string) (ElectionPhase, error) {
+	for i, n := range phaseNames {
+		if n == name {
+			return ElectionPhase(i), nil
+		}
+	}
+	return 0, ErrInvalidPhase
+}
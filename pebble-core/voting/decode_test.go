@@ -0,0 +1,154 @@
+package voting
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/base32c"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/trustee"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/methods"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+// Valid encodings of the structures read from untrusted input, as decoded by decode.
+func decodeSamples(t *testing.T) (samples [][]byte, decode []func(p []byte) error) {
+	k, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := generateParamsV1()
+	params.Contests = []Contest{{Title: "A", VotingMethod: "Plurality", Choices: []string{"x", "y"}}}
+	params.Upgrade(ParamsVersion11)
+	if err = params.Sign(k); err != nil {
+		t.Fatal(err)
+	}
+	h := util.Hash([]byte("key"))
+	msgs := []Message{
+		{ElectionParams: params},
+		{Credential: &structs.CredentialMessage{Credential: h[:], PublicKey: k.Public(), Signature: h[:]}},
+		{Credential: &structs.CredentialMessage{Credential: h[:], PublicKey: k.Public(), Signature: h[:], Proof: &structs.EligibilityProof{Path: []util.HashValue{h, h}}}},
+		{SignedBallot: &structs.SignedBallot{SerialNo: h[:], Signature: h[:], EncryptedBallot: structs.EncryptedBallot{VdfInput: h[:], Payload: h[:]}}},
+		{SignedBallot: &structs.SignedBallot{SerialNo: h[:], Signature: h[:], EncryptedBallot: structs.EncryptedBallot{VdfInput: h[:], Payload: h[:], Suite: structs.SuiteXChaCha20Poly1305}}},
+		{Decryption: &structs.DecryptionMessage{InputHash: h, Output: h[:], Proof: h[:]}},
+		{KeyReveal: &structs.KeyRevealMessage{InputHash: h, Key: h[:]}},
+		{DecryptionBatch: &structs.DecryptionBatchMessage{Decryptions: []structs.DecryptionMessage{{InputHash: h, Output: h[:], Proof: h[:]}}}},
+		{TrusteeDecryption: &structs.TrusteeDecryptionMessage{Index: 1, Partials: []structs.TrusteePartial{{EphemeralHash: h, PartialDecryption: trustee.PartialDecryption{
+			Point: make([]byte, trustee.PointLength), Proof: make([]byte, trustee.ProofLength), Share: h[:]}}}}},
+		{Amendment: &Amendment{Sequence: 1, Phase: Cast, Title: "Title", TallyEnd: time.Unix(1700000000, 0), Signature: h[:]}},
+		{EligibilityUpdate: &EligibilityUpdate{Sequence: 1, Diff: structs.EligibilityDiff{Added: []structs.EligibilityChange{{KeyHash: h}}}, Signature: h[:]}},
+	}
+	for _, m := range msgs {
+		samples = append(samples, m.Bytes())
+		decode = append(decode, func(p []byte) error {
+			_, err := MessageFromBytes(p)
+			return err
+		})
+	}
+	samples = append(samples, EncodeEnvelopes(msgs[1:]), EncodeReceiptEnvelopes(msgs[1:]))
+	decode = append(decode, func(p []byte) error {
+		_, err := DecodeEnvelopes(p)
+		return err
+	}, func(p []byte) error {
+		_, err := DecodeEnvelopeBatch(p)
+		return err
+	})
+	inv := Invitation{Address: []byte("election"), Servers: []string{"https://a.example"}, Organizer: k.Public(), AccessToken: h[:]}
+	for _, inv := range []Invitation{inv, {Address: []byte("election"), Servers: []string{"https://a.example"}}} {
+		p, _, err := base32c.CheckDecodeWithCorrection(inv.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		samples = append(samples, p)
+		decode = append(decode, func(p []byte) error {
+			_, err := decodeInvitation(p)
+			return err
+		})
+	}
+	result := methods.Result{Choices: []methods.ChoiceResult{{Index: 0, Count: 3}}, Winners: []int{0}, Rounds: []methods.RoundResult{{Elected: []int{0}}}}
+	samples = append(samples, result.Bytes())
+	decode = append(decode, func(p []byte) error {
+		var r methods.Result
+		return r.FromBytes(p)
+	})
+	return
+}
+
+/*
+Decodes random mutations of valid encodings: flipped and random bytes, truncations,
+and large varints spliced in, which lengths and counts must not trust. The decoders
+must fail without panicking, and only allocate in proportion to their input.
+*/
+func TestDecodeMutations(t *testing.T) {
+	samples, decode := decodeSamples(t)
+	rnd := rand.New(rand.NewSource(1))
+	large := []byte{0xFF, 0xFF, 0xFF, 0x7F}
+	for i, sample := range samples {
+		if err := decode[i](sample); err != nil {
+			t.Fatalf("sample %d: %v", i, err)
+		}
+		for n := 0; n < 2000; n++ {
+			p := append([]byte(nil), sample...)
+			switch pos := rnd.Intn(len(p)); rnd.Intn(4) {
+			case 0:
+				p[pos] ^= byte(1 << rnd.Intn(8))
+			case 1:
+				p[pos] = byte(rnd.Intn(256))
+			case 2:
+				p = p[:pos]
+			case 3:
+				p = append(p[:pos:pos], append(large, p[pos:]...)...)
+			}
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Fatalf("sample %d mutated to %x: panic %v", i, p, r)
+					}
+				}()
+				decode[i](p)
+			}()
+		}
+	}
+}
+
+func TestDecodeBounds(t *testing.T) {
+	// Counts larger than the remaining bytes are rejected before allocating
+	var w util.BufferWriter
+	w.WriteUint32(ParamsVersion11)
+	for i := 0; i < 6; i++ {
+		w.WriteUvarint(0)
+	}
+	for i := 0; i < 3; i++ {
+		w.WriteVarVector(nil)
+	}
+	w.WriteUvarint(maxCount)
+	var p ElectionParams
+	if err := p.FromBytes(w.Buffer); err != util.ErrTooLarge {
+		t.Errorf("params with too many choices: %v", err)
+	}
+	w = util.BufferWriter{}
+	w.WriteUint32(invitationVersion2)
+	w.WriteVarVector([]byte("election"))
+	w.WriteUvarint(maxInvitationServers)
+	if _, err := decodeInvitation(w.Buffer); err != util.ErrTooLarge {
+		t.Errorf("invitation with too many servers: %v", err)
+	}
+	if _, err := DecodeInvitation(string(bytes.Repeat([]byte{'a'}, maxInvitationLength+1))); err != util.ErrTooLarge {
+		t.Errorf("long invitation: %v", err)
+	}
+	large := make([]byte, maxMessageSize+1)
+	large[0] = byte(Tally)
+	if _, err := MessageFromBytes(large); err != util.ErrTooLarge {
+		t.Errorf("large message: %v", err)
+	}
+	proof := structs.EligibilityProof{Path: make([]util.HashValue, 33)}
+	if err := proof.FromBytes(proof.Bytes()); err != util.ErrTooLarge {
+		t.Errorf("eligibility proof of depth 33: %v", err)
+	}
+	if ErrorCodeOf(util.ErrTooLarge) != util.ErrorTooLarge {
+		t.Error("no error code")
+	}
+}
@@ -0,0 +1,99 @@
+package voting
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/vdf"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+var ErrDecryptionBatchSize = errors.New("pebble: empty or too large decryption batch")
+
+/*
+Posts the VDF solutions of many ballots in a single message, such as solved by a service
+revealing the ballots of voters who did not. Each solution counts as if posted with PostBallotDecryption.
+Returns an error if the phase is not Tally or the batch is empty or larger than structs.MaxDecryptionBatch.
+*/
+func (e *Election) PostDecryptionBatch(ctx context.Context, sols []vdf.VdfSolution) error {
+	if e.Phase() != Tally {
+		return ErrWrongPhase
+	}
+	if len(sols) == 0 || len(sols) > structs.MaxDecryptionBatch {
+		return ErrDecryptionBatchSize
+	}
+	msg := &structs.DecryptionBatchMessage{Decryptions: make([]structs.DecryptionMessage, len(sols))}
+	for i, sol := range sols {
+		msg.Decryptions[i] = structs.CreateDecryptionMessage(sol)
+	}
+	return e.post(ctx, Message{DecryptionBatch: msg})
+}
+
+/*
+Verifies the VDF solutions of a tally together, on concurrent workers, ahead of decryptBallot,
+which then finds their results instead of verifying them ballot by ballot.
+Solutions not verified ahead are verified by the underlying VDF.
+*/
+type batchVerifier struct {
+	vdf.VDF
+	mu      sync.Mutex
+	results map[util.HashValue]error
+}
+
+func newBatchVerifier(v vdf.VDF) *batchVerifier {
+	return &batchVerifier{VDF: v, results: make(map[util.HashValue]error)}
+}
+
+func solutionHash(sol vdf.VdfSolution) util.HashValue {
+	return util.HashAll(sol.Input, sol.Output, sol.Proof)
+}
+
+/*
+Verifies the first decryption of each ballot, the one decryptBallot tries first.
+Later decryptions of a ballot are only verified if the first is invalid.
+*/
+func (v *batchVerifier) verifyFirst(ballots []structs.SignedBallot, msgs []structs.DecryptionMessage) {
+	first := make(map[util.HashValue]int)
+	for i := len(msgs) - 1; i >= 0; i-- {
+		first[msgs[i].InputHash] = i
+	}
+	var sols []vdf.VdfSolution
+	for i := range ballots {
+		input := ballots[i].EncryptedBallot.VdfInput
+		h := util.Hash(input)
+		if j, ok := first[h]; ok {
+			sols = append(sols, vdf.VdfSolution{Input: input, Output: msgs[j].Output, Proof: msgs[j].Proof})
+			// Ballots sharing an input are verified once
+			delete(first, h)
+		}
+	}
+	parallelFor(len(sols), func(i int) {
+		err := v.VDF.Verify(sols[i])
+		v.mu.Lock()
+		v.results[solutionHash(sols[i])] = err
+		v.mu.Unlock()
+	})
+}
+
+func (v *batchVerifier) Verify(sol vdf.VdfSolution) error {
+	v.mu.Lock()
+	err, ok := v.results[solutionHash(sol)]
+	v.mu.Unlock()
+	if ok {
+		return err
+	}
+	return v.VDF.Verify(sol)
+}
+
+// Appends the decryptions carried by the message, alone or in a batch.
+func appendDecryptions(msgs []structs.DecryptionMessage, m Message) []structs.DecryptionMessage {
+	if m.Decryption != nil {
+		msgs = append(msgs, *m.Decryption)
+	}
+	if m.DecryptionBatch != nil {
+		msgs = append(msgs, m.DecryptionBatch.Decryptions...)
+	}
+	return msgs
+}
@@ -0,0 +1,73 @@
+package voting
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/vdf"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+type countingVdf struct {
+	vdf.VDF
+	verifications int64
+}
+
+func (v *countingVdf) Verify(sol vdf.VdfSolution) error {
+	atomic.AddInt64(&v.verifications, 1)
+	return v.VDF.Verify(sol)
+}
+
+func TestDecryptionBatch(t *testing.T) {
+	pv := &vdf.PietrzakVdf{MaxDifficulty: 100, DifficultyConversion: 100}
+	var ballots []structs.SignedBallot
+	var sols []vdf.VdfSolution
+	for i := 0; i < 3; i++ {
+		sol, err := pv.Create(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		eb, err := structs.Ballot{byte(i)}.Encrypt(sol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ballots = append(ballots, structs.SignedBallot{EncryptedBallot: eb})
+		sols = append(sols, sol)
+	}
+	// A bogus decryption of the first ballot precedes its solution
+	bogus := structs.CreateDecryptionMessage(sols[0])
+	bogus.Output = sols[1].Output
+	batch := structs.DecryptionBatchMessage{Decryptions: []structs.DecryptionMessage{bogus}}
+	for _, sol := range sols {
+		batch.Decryptions = append(batch.Decryptions, structs.CreateDecryptionMessage(sol))
+	}
+	m, err := MessageFromBytes(Message{DecryptionBatch: &batch}.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := appendDecryptions(nil, m)
+	if len(msgs) != len(batch.Decryptions) {
+		t.Fatalf("%d decryptions in the batch", len(msgs))
+	}
+	cv := &countingVdf{VDF: pv}
+	bv := newBatchVerifier(cv)
+	bv.verifyFirst(ballots, msgs)
+	if cv.verifications != int64(len(ballots)) {
+		t.Errorf("%d verifications ahead", cv.verifications)
+	}
+	for i, sb := range ballots {
+		b, proof, err := decryptBallot(sb.EncryptedBallot, msgs, nil, bv)
+		if err != nil || len(b) != 1 || b[0] != byte(i) {
+			t.Fatalf("ballot %d not decrypted: %v", i, err)
+		}
+		// Decryptions in a batch count as if posted alone
+		d := structs.CreateDecryptionMessage(sols[i])
+		if string(proof) != string(d.Bytes()) {
+			t.Errorf("ballot %d opened by another decryption", i)
+		}
+	}
+	// Only the solution after the bogus decryption was verified again
+	if cv.verifications != int64(len(ballots)+1) {
+		t.Errorf("%d verifications in total", cv.verifications)
+	}
+}
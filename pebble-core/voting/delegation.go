@@ -0,0 +1,239 @@
+package voting
+
+import (
+	"context"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+/*
+Liquid-democracy delegation: during registration, a voter may delegate their ballot
+weight to the holder of another credential with a DelegationMessage. The credential
+of a delegator is left out of the credential set, so delegators cannot vote themselves.
+Delegations are resolved transitively: weight delegated to a delegator flows on to
+their own delegate, and weight caught in a cycle is discarded. The final delegate
+receives the weight by posting a DelegateClaimMessage for their ballot during the Cast phase;
+their ballot is then tallied once for themselves and once for each voter delegating to them.
+*/
+
+/*
+Returns the eligible voters with valid credential messages, keyed by public key hash.
+A credential message of a voter replaces those of lower epochs, and the later message
+of the same epoch replaces the earlier ones.
+Eligibility proofs are verified concurrently, and signatures in batches,
+skipping the messages whose signature was verified by an earlier call.
+*/
+func (e *Election) verifiedCredentials(msgs []Message) map[util.HashValue]*structs.CredentialMessage {
+	var all []*structs.CredentialMessage
+	for _, msg := range msgs {
+		if msg.Credential != nil {
+			all = append(all, msg.Credential)
+		}
+	}
+	eligible := make([]bool, len(all))
+	parallelFor(len(all), func(i int) {
+		_, err := e.Params().EligibilityList.Verify(e.Params().EligibilityList.HashKey(all[i].PublicKey), all[i].Proof)
+		eligible[i] = err == nil
+	})
+	var credMsgs []*structs.CredentialMessage
+	var keys []util.HashValue
+	for i, c := range all {
+		if eligible[i] {
+			credMsgs = append(credMsgs, c)
+			if c.Epoch != 0 {
+				keys = append(keys, signatureCacheScheme.Sum("credential", c.BytesWithEpoch()))
+			} else {
+				keys = append(keys, signatureCacheScheme.Sum("credential", c.Bytes()))
+			}
+		}
+	}
+	eid := e.Id()
+	valid := e.signatures.verify(keys, func(idx []int) []bool {
+		unknown := make([]*structs.CredentialMessage, len(idx))
+		for j, i := range idx {
+			unknown[j] = credMsgs[i]
+		}
+		return structs.VerifyCredentialMessages(unknown, eid)
+	})
+	res := make(map[util.HashValue]*structs.CredentialMessage)
+	for i, msg := range credMsgs {
+		if !valid[i] {
+			continue
+		}
+		pkh := util.Hash(msg.PublicKey)
+		if prev, ok := res[pkh]; !ok || msg.Epoch >= prev.Epoch {
+			res[pkh] = msg
+		}
+	}
+	return res
+}
+
+/*
+Returns the delegate credential hash of each eligible voter with a validly signed delegation.
+A voter who posted delegations to different credentials delegates to none of them,
+but is still a delegator.
+*/
+func (e *Election) delegations(msgs []Message) map[util.HashValue]util.HashValue {
+	var eligible []*structs.DelegationMessage
+	for _, msg := range msgs {
+		d := msg.Delegation
+		if d == nil {
+			continue
+		}
+		if _, err := e.Params().EligibilityList.Verify(e.Params().EligibilityList.HashKey(d.PublicKey), d.Proof); err == nil {
+			eligible = append(eligible, d)
+		}
+	}
+	keys := make([]util.HashValue, len(eligible))
+	for i, d := range eligible {
+		keys[i] = signatureCacheScheme.Sum("delegation", d.PublicKey, d.Delegate[:], d.Signature)
+	}
+	eid := e.Id()
+	valid := e.signatures.verify(keys, func(idx []int) []bool {
+		unknown := make([]*structs.DelegationMessage, len(idx))
+		for j, i := range idx {
+			unknown[j] = eligible[i]
+		}
+		return structs.VerifyDelegationMessages(unknown, eid)
+	})
+	res := make(map[util.HashValue]util.HashValue)
+	for i, d := range eligible {
+		if !valid[i] {
+			continue
+		}
+		pkh := util.Hash(d.PublicKey)
+		if prev, ok := res[pkh]; ok && prev != d.Delegate {
+			// No credential hashes to zero
+			res[pkh] = util.HashValue{}
+		} else {
+			res[pkh] = d.Delegate
+		}
+	}
+	return res
+}
+
+/*
+Resolves delegations transitively. Delegations maps delegators to delegate credential hashes,
+and owners maps credential hashes to the public key hash of their holder.
+Returns the number of voters whose weight reaches each final delegate, that is
+each delegate who did not delegate in turn. Weight delegated to unknown credentials
+or caught in a delegation cycle is discarded.
+*/
+func resolveDelegations(delegations map[util.HashValue]util.HashValue, owners map[util.HashValue]util.HashValue) map[util.HashValue]uint64 {
+	weights := make(map[util.HashValue]uint64)
+	for delegator := range delegations {
+		seen := map[util.HashValue]bool{delegator: true}
+		cur := delegator
+		for {
+			owner, ok := owners[delegations[cur]]
+			if !ok || seen[owner] {
+				break
+			}
+			if _, delegated := delegations[owner]; !delegated {
+				weights[owner]++
+				break
+			}
+			seen[owner] = true
+			cur = owner
+		}
+	}
+	return weights
+}
+
+/*
+Returns the weight delegated to the ballot of each serial number claimed by a final delegate.
+Claims of a delegate for different serial numbers are all ignored.
+*/
+func (e *Election) delegatedWeights(set anoncred.CredentialSet, msgs []Message) map[string]uint64 {
+	hasDelegations := false
+	for _, msg := range msgs {
+		if msg.Delegation != nil {
+			hasDelegations = true
+			break
+		}
+	}
+	if !hasDelegations {
+		return nil
+	}
+	owners := make(map[util.HashValue]util.HashValue)
+	for pkh, c := range e.verifiedCredentials(msgs) {
+		owners[e.hash(util.DomainCredential, c.Credential)] = pkh
+	}
+	weights := resolveDelegations(e.delegations(msgs), owners)
+	eid := e.Id()
+	claims := make(map[util.HashValue][]byte)
+	conflicts := make(map[util.HashValue]bool)
+	for _, msg := range msgs {
+		c := msg.DelegateClaim
+		if c == nil {
+			continue
+		}
+		pkh := util.Hash(c.PublicKey)
+		if _, ok := weights[pkh]; !ok {
+			continue
+		}
+		if c.Verify(set, eid) != nil {
+			continue
+		}
+		if prev, ok := claims[pkh]; ok && string(prev) != string(c.SerialNo) {
+			conflicts[pkh] = true
+		}
+		claims[pkh] = c.SerialNo
+	}
+	res := make(map[string]uint64)
+	for pkh, serialNo := range claims {
+		if !conflicts[pkh] {
+			res[string(serialNo)] = weights[pkh]
+		}
+	}
+	return res
+}
+
+/*
+Delegates the ballot weight of the voter holding k to the holder of the public credential delegate.
+Like credentials, delegations are posted in the CredGen phase while registration is open.
+*/
+func (e *Election) Delegate(ctx context.Context, k pubkey.PrivateKey, delegate []byte) error {
+	if e.Phase() != CredGen {
+		return ErrWrongPhase
+	}
+	if !e.Params().RegistrationOpenAt(e.Now()) {
+		return ErrRegistrationClosed
+	}
+	msg := &structs.DelegationMessage{Delegate: e.hash(util.DomainCredential, delegate)}
+	err := msg.Sign(k, e.Id())
+	if err != nil {
+		return err
+	}
+	if e.Params().EligibilityList.RootOnly() {
+		msg.Proof, err = e.eligibilityProof(ctx, e.Params().EligibilityList.HashKey(k.Public()))
+		if err != nil {
+			return err
+		}
+	}
+	return e.post(ctx, Message{Delegation: msg})
+}
+
+// Claims the weight delegated to the voter holding k for their ballot, revealing which ballot is theirs.
+func (e *Election) ClaimDelegations(ctx context.Context, k pubkey.PrivateKey) error {
+	if e.Phase() != Cast {
+		return ErrWrongPhase
+	}
+	set, err := e.GetCredentialSet(ctx)
+	if err != nil {
+		return err
+	}
+	sec, err := e.secrets.GetSecretCredential(e.credSys)
+	if err != nil {
+		return err
+	}
+	msg := new(structs.DelegateClaimMessage)
+	err = msg.Sign(k, set, sec, e.Id())
+	if err != nil {
+		return err
+	}
+	return e.post(ctx, Message{DelegateClaim: msg})
+}
@@ -0,0 +1,137 @@
+package voting
+
+import (
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+func TestResolveDelegations(t *testing.T) {
+	voter := func(name string) (pkh, cred util.HashValue) {
+		return util.Hash([]byte(name)), util.Hash([]byte("credential of " + name))
+	}
+	alice, aliceCred := voter("alice")
+	bob, bobCred := voter("bob")
+	carol, carolCred := voter("carol")
+	dave, daveCred := voter("dave")
+	erin, erinCred := voter("erin")
+	frank, _ := voter("frank")
+	owners := map[util.HashValue]util.HashValue{
+		aliceCred: alice, bobCred: bob, carolCred: carol, daveCred: dave, erinCred: erin,
+	}
+	delegations := map[util.HashValue]util.HashValue{
+		// alice -> bob -> carol
+		alice: bobCred,
+		bob:   carolCred,
+		// dave <-> erin
+		dave: erinCred,
+		erin: daveCred,
+		// frank delegates to an unknown credential
+		frank: util.Hash([]byte("unknown")),
+	}
+	weights := resolveDelegations(delegations, owners)
+	if len(weights) != 1 || weights[carol] != 2 {
+		t.Errorf("unexpected weights %v", weights)
+	}
+}
+
+func TestDelegationMessage(t *testing.T) {
+	k, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eid := util.Hash([]byte("election"))
+	d := structs.DelegationMessage{Delegate: util.Hash([]byte("credential"))}
+	if err = d.Sign(k, eid); err != nil {
+		t.Fatal(err)
+	}
+	m, err := MessageFromBytes(Message{Delegation: &d}.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Delegation == nil || m.Delegation.Delegate != d.Delegate || m.Delegation.Proof != nil {
+		t.Fatal("delegation not decoded")
+	}
+	if err = m.Delegation.Verify(eid); err != nil {
+		t.Error(err)
+	}
+	if m.Delegation.Verify(util.Hash([]byte("other"))) == nil {
+		t.Error("delegation verified for another election")
+	}
+}
+
+func TestVerifiedCredentialEpochs(t *testing.T) {
+	eid := util.Hash([]byte("election"))
+	k, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := structs.NewEligibilityList()
+	list.Add(util.Hash(k.Public()), util.HashValue{})
+	cred := func(credential string, epoch uint32) Message {
+		c := &structs.CredentialMessage{Credential: []byte(credential), Epoch: epoch}
+		if err := c.Sign(k, eid); err != nil {
+			t.Fatal(err)
+		}
+		return Message{Credential: c}
+	}
+	e := &Election{
+		channel: NewMockBroadcastChannel(eid, nil),
+		params:  &ElectionParams{EligibilityList: list},
+	}
+	// A replay of the first registration after the rotation is ignored
+	creds := e.verifiedCredentials([]Message{cred("old", 0), cred("new", 1), cred("old", 0)})
+	if c := creds[util.Hash(k.Public())]; c == nil || string(c.Credential) != "new" {
+		t.Error("credential of the later epoch not kept")
+	}
+	unsigned := cred("newer", 2)
+	unsigned.Credential.Epoch = 3
+	creds = e.verifiedCredentials([]Message{cred("new", 1), unsigned})
+	if c := creds[util.Hash(k.Public())]; c == nil || string(c.Credential) != "new" {
+		t.Error("credential of an unsigned epoch kept")
+	}
+}
+
+func BenchmarkVerifiedCredentials(b *testing.B) {
+	const voters = 10000
+	eid := util.Hash([]byte("election"))
+	list := structs.NewEligibilityList()
+	msgs := make([]Message, voters)
+	for i := range msgs {
+		k, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+		if err != nil {
+			b.Fatal(err)
+		}
+		list.Add(util.Hash(k.Public()), util.HashValue{})
+		cred := util.Hash(k.Public())
+		msgs[i].Credential = &structs.CredentialMessage{Credential: cred[:]}
+		if err = msgs[i].Credential.Sign(k, eid); err != nil {
+			b.Fatal(err)
+		}
+	}
+	newElection := func() *Election {
+		return &Election{
+			channel: NewMockBroadcastChannel(eid, nil),
+			params:  &ElectionParams{EligibilityList: list},
+		}
+	}
+	b.Run("uncached", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			if len(newElection().verifiedCredentials(msgs)) != voters {
+				b.Fatal("credentials not verified")
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		e := newElection()
+		e.verifiedCredentials(msgs)
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			if len(e.verifiedCredentials(msgs)) != voters {
+				b.Fatal("credentials not verified")
+			}
+		}
+	})
+}
@@ -0,0 +1,388 @@
+package voting
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/trustee"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+var (
+	ErrInvalidDKGParams = errors.New("pebble: invalid key generation params")
+	ErrDKGSigner        = errors.New("pebble: key generation message by an unknown trustee")
+	ErrNotDKGTrustee    = errors.New("pebble: private key does not match the trustee")
+)
+
+// Prefixed to the key generation message bytes before signing.
+const dkgSignatureContext = "pebble-trustee-dkg"
+
+// Maximum number of trustees of a key generation ceremony.
+const maxDKGTrustees = 1 << 10
+
+// A trustee taking part in key generation: its identity key, signing its messages,
+// and the key receiving its shares (see trustee.GenerateEncryptionKey).
+type DKGTrustee struct {
+	Key           pubkey.PublicKey
+	EncryptionKey []byte
+}
+
+/*
+The params of a key generation ceremony, agreed on by the trustees beforehand.
+Trustee i (1-based) is Trustees[i-1]. The ceremony produces the trustee.KeySet
+to put in the ElectionParams, without a trusted dealer knowing the joint secret.
+*/
+type DKGParams struct {
+	Threshold uint32
+	Trustees  []DKGTrustee
+}
+
+func (p *DKGParams) Bytes() []byte {
+	var w util.BufferWriter
+	w.WriteUint32(p.Threshold)
+	w.WriteUvarint(uint64(len(p.Trustees)))
+	for _, t := range p.Trustees {
+		w.WriteVector(t.Key)
+		w.WriteVector(t.EncryptionKey)
+	}
+	return w.Buffer
+}
+
+func (p *DKGParams) FromBytes(b []byte) error {
+	r := util.NewBufferReader(b)
+	var err error
+	p.Threshold, err = r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	// Each trustee has two vectors
+	n, err := r.ReadCount(maxDKGTrustees, 2)
+	if err != nil {
+		return err
+	}
+	p.Trustees = make([]DKGTrustee, n)
+	for i := range p.Trustees {
+		var key []byte
+		key, err = r.ReadVector()
+		if err != nil {
+			return err
+		}
+		p.Trustees[i].Key = pubkey.PublicKey(key)
+		p.Trustees[i].EncryptionKey, err = r.ReadVector()
+		if err != nil {
+			return err
+		}
+	}
+	if r.Len() != 0 {
+		return ErrInvalidDKGParams
+	}
+	return nil
+}
+
+// Identifies the ceremony; messages of other ceremonies are ignored.
+func (p *DKGParams) Id() util.HashValue {
+	return util.Hash(p.Bytes())
+}
+
+func (p *DKGParams) Validate() error {
+	if p.Threshold < 1 || int(p.Threshold) > len(p.Trustees) || len(p.Trustees) > maxDKGTrustees {
+		return ErrInvalidDKGParams
+	}
+	for _, t := range p.Trustees {
+		if len(t.Key) == 0 || len(t.EncryptionKey) != trustee.PointLength {
+			return ErrInvalidDKGParams
+		}
+	}
+	return nil
+}
+
+// Returns the encryption keys of the trustees.
+func (p *DKGParams) encryptionKeys() [][]byte {
+	keys := make([][]byte, len(p.Trustees))
+	for i, t := range p.Trustees {
+		keys[i] = t.EncryptionKey
+	}
+	return keys
+}
+
+// Checks that k is the identity key of trustee index.
+func (p *DKGParams) checkSigner(index uint32, k pubkey.PrivateKey) error {
+	if index < 1 || int(index) > len(p.Trustees) {
+		return ErrDKGSigner
+	}
+	if string(k.Public()) != string(p.Trustees[index-1].Key) {
+		return ErrNotDKGTrustee
+	}
+	return nil
+}
+
+// Verifies the signature of a message by trustee index.
+func (p *DKGParams) verify(index uint32, signing, sig []byte) error {
+	if index < 1 || int(index) > len(p.Trustees) {
+		return ErrDKGSigner
+	}
+	return p.Trustees[index-1].Key.Verify(signing, sig)
+}
+
+// The dealing of a trustee, signed with its identity key.
+type DKGDealing struct {
+	Ceremony  util.HashValue
+	Dealing   trustee.Dealing
+	Signature []byte
+}
+
+// The complaint of a trustee about the share dealt to it, signed with its identity key.
+type DKGComplaint struct {
+	Ceremony  util.HashValue
+	Complaint trustee.Complaint
+	Signature []byte
+}
+
+func dkgSigningBytes(ceremony util.HashValue, payload []byte) []byte {
+	return util.Concat([]byte(dkgSignatureContext), ceremony[:], payload)
+}
+
+func (m *DKGDealing) Bytes() []byte {
+	var w util.BufferWriter
+	w.Write32(m.Ceremony)
+	w.WriteVector(m.Dealing.Bytes())
+	w.Write(m.Signature)
+	return w.Buffer
+}
+
+func (m *DKGDealing) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	m.Ceremony, err = r.Read32()
+	if err != nil {
+		return err
+	}
+	d, err := r.ReadVector()
+	if err != nil {
+		return err
+	}
+	err = m.Dealing.FromBytes(d)
+	if err != nil {
+		return err
+	}
+	m.Signature = r.ReadRemaining()
+	return nil
+}
+
+// Verifies the signature of the dealing against the identity key of its dealer.
+func (m *DKGDealing) Verify(p *DKGParams) error {
+	return p.verify(m.Dealing.Dealer, dkgSigningBytes(m.Ceremony, m.Dealing.Bytes()), m.Signature)
+}
+
+func (m *DKGComplaint) Bytes() []byte {
+	var w util.BufferWriter
+	w.Write32(m.Ceremony)
+	w.WriteVector(m.Complaint.Bytes())
+	w.Write(m.Signature)
+	return w.Buffer
+}
+
+func (m *DKGComplaint) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	m.Ceremony, err = r.Read32()
+	if err != nil {
+		return err
+	}
+	c, err := r.ReadVector()
+	if err != nil {
+		return err
+	}
+	err = m.Complaint.FromBytes(c)
+	if err != nil {
+		return err
+	}
+	m.Signature = r.ReadRemaining()
+	return nil
+}
+
+// Verifies the signature of the complaint against the identity key of its accuser.
+func (m *DKGComplaint) Verify(p *DKGParams) error {
+	return p.verify(m.Complaint.Accuser, dkgSigningBytes(m.Ceremony, m.Complaint.Bytes()), m.Signature)
+}
+
+/*
+Runs a key generation ceremony over a broadcast channel, typically one dedicated to the ceremony.
+The ceremony has two rounds, whose deadlines are agreed on by the trustees:
+every trustee posts its dealing with Deal, then checks the shares dealt to it with Complain.
+Once complaints are over, Result returns the joint key set and Share the share of a trustee.
+*/
+type DKG struct {
+	bc     BroadcastChannel
+	params *DKGParams
+	id     util.HashValue
+}
+
+// The outcome of a ceremony: the joint key set and the dealers it is made of.
+type DKGResult struct {
+	KeySet    *trustee.KeySet
+	Qualified []uint32
+}
+
+func NewDKG(bc BroadcastChannel, params *DKGParams) (*DKG, error) {
+	err := params.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &DKG{bc: bc, params: params, id: params.Id()}, nil
+}
+
+func (d *DKG) Id() util.HashValue {
+	return d.id
+}
+
+// Posts the dealing of trustee index, signed with its identity key k.
+func (d *DKG) Deal(ctx context.Context, index uint32, k pubkey.PrivateKey) error {
+	err := d.params.checkSigner(index, k)
+	if err != nil {
+		return err
+	}
+	dealing, err := trustee.NewDealing(index, int(d.params.Threshold), d.params.encryptionKeys(), d.id[:])
+	if err != nil {
+		return err
+	}
+	m := &DKGDealing{Ceremony: d.id, Dealing: *dealing}
+	m.Signature, err = k.Sign(dkgSigningBytes(d.id, m.Dealing.Bytes()))
+	if err != nil {
+		return err
+	}
+	return d.bc.Post(ctx, Message{DKGDealing: m})
+}
+
+// The valid dealings and justified complaints posted so far, keyed by dealer.
+type dkgState struct {
+	dealings  map[uint32]*trustee.Dealing
+	complaint map[uint32]bool
+}
+
+func (d *DKG) state(ctx context.Context) (*dkgState, error) {
+	msgs, err := d.bc.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := &dkgState{dealings: make(map[uint32]*trustee.Dealing), complaint: make(map[uint32]bool)}
+	var complaints []*DKGComplaint
+	n := len(d.params.Trustees)
+	for _, msg := range msgs {
+		if m := msg.DKGDealing; m != nil && m.Ceremony == d.id {
+			// Only the first dealing of each dealer counts
+			if _, ok := s.dealings[m.Dealing.Dealer]; ok || m.Verify(d.params) != nil {
+				continue
+			}
+			if m.Dealing.Verify(int(d.params.Threshold), n, d.id[:]) == nil {
+				s.dealings[m.Dealing.Dealer] = &m.Dealing
+			}
+		} else if m := msg.DKGComplaint; m != nil && m.Ceremony == d.id {
+			complaints = append(complaints, m)
+		}
+	}
+	for _, m := range complaints {
+		dealing, ok := s.dealings[m.Complaint.Dealer]
+		if !ok || m.Verify(d.params) != nil {
+			continue
+		}
+		ok, err := m.Complaint.Justified(dealing, d.params.Trustees[m.Complaint.Accuser-1].EncryptionKey, d.id[:])
+		if ok && err == nil {
+			s.complaint[m.Complaint.Dealer] = true
+		}
+	}
+	return s, nil
+}
+
+// Returns the dealers with a valid dealing and no justified complaint, in order.
+func (s *dkgState) qualified() []uint32 {
+	var res []uint32
+	for dealer := range s.dealings {
+		if !s.complaint[dealer] {
+			res = append(res, dealer)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+	return res
+}
+
+/*
+Checks the shares dealt to trustee index, whose encryption key is encSecret,
+and posts a complaint, signed with its identity key k, about every invalid one.
+Returns the number of complaints posted.
+*/
+func (d *DKG) Complain(ctx context.Context, index uint32, k pubkey.PrivateKey, encSecret []byte) (int, error) {
+	err := d.params.checkSigner(index, k)
+	if err != nil {
+		return 0, err
+	}
+	s, err := d.state(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, dealer := range s.qualified() {
+		dealing := s.dealings[dealer]
+		_, err = dealing.Open(index, encSecret, d.id[:])
+		if err != trustee.ErrInvalidShare {
+			continue
+		}
+		c, err := dealing.Complain(index, encSecret, d.id[:])
+		if err != nil {
+			return count, err
+		}
+		m := &DKGComplaint{Ceremony: d.id, Complaint: *c}
+		m.Signature, err = k.Sign(dkgSigningBytes(d.id, m.Complaint.Bytes()))
+		if err != nil {
+			return count, err
+		}
+		err = d.bc.Post(ctx, Message{DKGComplaint: m})
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Returns the joint key set of the qualified dealers, or trustee.ErrNotEnoughDealers.
+func (d *DKG) Result(ctx context.Context) (*DKGResult, error) {
+	s, err := d.state(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q := s.qualified()
+	dealings := make([]*trustee.Dealing, len(q))
+	for i, dealer := range q {
+		dealings[i] = s.dealings[dealer]
+	}
+	ks, err := trustee.JointKeySet(int(d.params.Threshold), len(d.params.Trustees), dealings)
+	if err != nil {
+		return nil, err
+	}
+	return &DKGResult{KeySet: ks, Qualified: q}, nil
+}
+
+// Returns the share of the joint key of trustee index, whose encryption key is encSecret.
+func (d *DKG) Share(ctx context.Context, index uint32, encSecret []byte) (trustee.Share, error) {
+	s, err := d.state(ctx)
+	if err != nil {
+		return trustee.Share{}, err
+	}
+	q := s.qualified()
+	if len(q) < int(d.params.Threshold) {
+		return trustee.Share{}, trustee.ErrNotEnoughDealers
+	}
+	shares := make([]trustee.Share, len(q))
+	for i, dealer := range q {
+		shares[i], err = s.dealings[dealer].Open(index, encSecret, d.id[:])
+		if err != nil {
+			return trustee.Share{}, err
+		}
+	}
+	return trustee.JointShare(index, shares), nil
+}
@@ -0,0 +1,108 @@
+package voting
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/trustee"
+)
+
+func TestDKG(t *testing.T) {
+	ctx := context.Background()
+	const n = 3
+	params := &DKGParams{Threshold: 2}
+	keys := make([]pubkey.PrivateKey, n)
+	encSecrets := make([][]byte, n)
+	for i := range keys {
+		var err error
+		keys[i], err = pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var encKey []byte
+		encSecrets[i], encKey, err = trustee.GenerateEncryptionKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		params.Trustees = append(params.Trustees, DKGTrustee{Key: keys[i].Public(), EncryptionKey: encKey})
+	}
+	var decoded DKGParams
+	if err := decoded.FromBytes(params.Bytes()); err != nil || decoded.Id() != params.Id() {
+		t.Fatalf("decoded params %+v: %v", decoded, err)
+	}
+	bc := NewMockBroadcastChannel(ElectionID{1}, nil)
+	dkg, err := NewDKG(bc, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dkg.Deal(ctx, 1, keys[1]); err != ErrNotDKGTrustee {
+		t.Errorf("dealt with the key of another trustee: %v", err)
+	}
+	for i := uint32(1); i <= 2; i++ {
+		if err = dkg.Deal(ctx, i, keys[i-1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msgs, _ := bc.Get(ctx)
+	if m, err := MessageFromBytes(msgs[0].Bytes()); err != nil || m.DKGDealing.Verify(params) != nil {
+		t.Fatalf("decoded dealing %+v: %v", m, err)
+	}
+	// Trustee 3 deals an invalid share to trustee 1
+	d, err := trustee.NewDealing(3, 2, params.encryptionKeys(), dkg.id[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Shares[0] = d.Shares[1]
+	m := &DKGDealing{Ceremony: dkg.id, Dealing: *d}
+	m.Signature, _ = keys[2].Sign(dkgSigningBytes(dkg.id, m.Dealing.Bytes()))
+	bc.Post(ctx, Message{DKGDealing: m})
+	// Forged dealings are ignored
+	forged := &DKGDealing{Ceremony: dkg.id, Dealing: *d, Signature: m.Signature}
+	forged.Dealing.Dealer = 2
+	bc.Post(ctx, Message{DKGDealing: forged})
+
+	for i := uint32(1); i <= n; i++ {
+		count, err := dkg.Complain(ctx, i, keys[i-1], encSecrets[i-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := map[uint32]int{1: 1}[i]; count != expected {
+			t.Errorf("trustee %d posted %d complaints", i, count)
+		}
+	}
+	res, err := dkg.Result(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Qualified) != 2 || res.Qualified[0] != 1 || res.Qualified[1] != 2 {
+		t.Errorf("qualified dealers %v", res.Qualified)
+	}
+	if err = res.KeySet.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	var shares []trustee.Share
+	for i := uint32(1); i <= n; i++ {
+		s, err := dkg.Share(ctx, i, encSecrets[i-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.KeySet.VerifyShare(s); err != nil {
+			t.Fatal(err)
+		}
+		shares = append(shares, s)
+	}
+	c, err := res.KeySet.Encrypt([]byte("ballot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var partials []trustee.PartialDecryption
+	for _, s := range shares[:2] {
+		pd, _ := s.Decrypt(c.Ephemeral)
+		partials = append(partials, pd)
+	}
+	if p, err := res.KeySet.Combine(c, []uint32{1, 2}, partials); err != nil || !bytes.Equal(p, []byte("ballot")) {
+		t.Errorf("decrypted %q: %v", p, err)
+	}
+}
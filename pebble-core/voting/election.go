@@ -1,10 +1,16 @@
 package voting
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/timesource"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/vdf"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/methods"
@@ -15,7 +21,17 @@ import (
 var (
 	ErrWrongPhase = errors.New("pebble: wrong election phase")
 
+	ErrRegistrationClosed = errors.New("pebble: registration window closed")
+
+	ErrNoEligibilityProof = errors.New("pebble: broadcast channel does not provide eligibility proofs")
+
 	ErrDecryptionNotFound = errors.New("pebble: ballot decryption not found")
+
+	ErrElectionIdMismatch = errors.New("pebble: election ID does not match the params")
+
+	ErrVdfDifficulty = errors.New("pebble: VDF does not support choosing the difficulty")
+
+	ErrCredentialRotation = errors.New("pebble: secrets manager cannot rotate the secret credential")
 )
 
 type ElectionID = [32]byte
@@ -25,66 +41,363 @@ type Election struct {
 	credSys anoncred.CredentialSystem
 	channel BroadcastChannel
 	secrets secrets.SecretsManager
-	vdf     vdf.VDF
-	method  methods.VotingMethod
-	params  *ElectionParams
+	// Guards params and vdf, which Refresh replaces when the organizer amends the election.
+	paramsMu sync.RWMutex
+	vdf      vdf.VDF
+	method   methods.VotingMethod
+	// Set for params of version 3 and above, which encode ballots per contest.
+	contests *methods.MultiContest
+	params   *ElectionParams
+	// Params as published by the organizer, before amendments.
+	base  *ElectionParams
+	clock timesource.Source
+	// Signatures of credential and delegation messages already verified.
+	signatures signatureCache
+	// Receives traces and metrics of the processing, if set.
+	inst Instrumentation
+	// Directory caching downloaded credential system parameters.
+	credCache string
+	// Difficulty of the VDF puzzles of the ballots cast with this election, or zero for the default.
+	vdfDifficulty uint64
+	// Rejects params whose version does not derive the election ID, see RequireDerivedId.
+	requireDerivedId bool
+	// Progress of the ended election, and the number of messages it was computed from.
+	finalMu       sync.Mutex
+	final         *ElectionProgress
+	finalMessages int
+}
+
+// Configures optional components of an Election.
+type ElectionOption func(e *Election)
+
+// Makes the election decide phases using the given time source instead of the local clock.
+func WithTimeSource(ts timesource.Source) ElectionOption {
+	return func(e *Election) {
+		e.clock = ts
+	}
+}
+
+// Makes the election use the given credential system instead of anoncred.AnonCred1Instance,
+// unless the params reference their own.
+func WithCredentialSystem(cs anoncred.CredentialSystem) ElectionOption {
+	return func(e *Election) {
+		e.credSys = cs
+	}
+}
+
+/*
+Caches the credential system parameters downloaded for elections referencing them by URL
+in dir instead of ~/.pebble. An empty dir disables the cache on disk.
+*/
+func WithCredentialCache(dir string) ElectionOption {
+	return func(e *Election) {
+		e.credCache = dir
+	}
+}
+
+/*
+Makes the ballots cast with this election declare VDF puzzles of the given difficulty, such as
+fits the device, instead of the difficulty of the whole Cast phase. The difficulty must be even
+and within the bounds of the params, or casting fails.
+*/
+func WithVdfDifficulty(t uint64) ElectionOption {
+	return func(e *Election) {
+		e.vdfDifficulty = t
+	}
+}
+
+/*
+Rejects params older than version 11, whose election ID is assigned by the channel rather than
+derived from the params, for elections known to be created with version 11 or above, such as
+those created by the servers of this module. Otherwise a channel may serve such params under
+the ID of any election.
+*/
+func RequireDerivedId() ElectionOption {
+	return func(e *Election) {
+		e.requireDerivedId = true
+	}
 }
 
 // Represents the progress of an election, including the current phase,
 // the count and total number of processed items, and the tally (if applicable).
+// Tallies holds one tally per contest; Tally is the tally of the first contest.
 type ElectionProgress struct {
 	Phase        ElectionPhase
 	Count, Total int
 	Tally        methods.Tally
+	Tallies      []methods.Tally
+	// Seed for breaking ties with methods.Tally.Rank: the hash of the sorted
+	// hashes of the decryption messages that opened the counted ballots
+	// (or of the trustee ciphertext and ballot, for ballots opened by the trustees).
+	TieBreakSeed util.HashValue
+	// Number of ballots not counted for each reason, and the rejected ballot messages.
+	Rejections map[RejectionReason]int
+	Rejected   []RejectedMessage
 }
 
 /*
 Creates a new Election instance.
 Initializes the credential system, voting method, VDF, and other components based on the provided broadcast channel and secrets manager.
-Retrieves the election parameters from the broadcast channel.
+The credential system is anoncred.AnonCred1Instance, unless the params reference their own, which is then downloaded if not cached.
+Applies the given options, such as WithTimeSource.
+Retrieves the election parameters from the broadcast channel and verifies the organizer signature,
+and from version 11 that the ID of the channel is derived from the params and its network.
+A channel may serve params of an older version under any ID; callers knowing that the election
+was created with version 11 or above rule this out with RequireDerivedId.
 Returns the created Election instance or an error.
 */
-func NewElection(ctx context.Context, bc BroadcastChannel, sec secrets.SecretsManager) (*Election, error) {
-	if anoncred.AnonCred1Instance == nil {
-		return nil, errors.New("pebble: anoncred.AnonCred1Instance is nil")
-	}
+func NewElection(ctx context.Context, bc BroadcastChannel, sec secrets.SecretsManager, opts ...ElectionOption) (*Election, error) {
 	params, err := bc.Params(ctx)
 	if err != nil {
 		return nil, err
 	}
-	method, err := methods.Get(params.VotingMethod, len(params.Choices))
+	err = params.Validate()
 	if err != nil {
 		return nil, err
 	}
-	vdf := &vdf.PietrzakVdf{
-		MaxDifficulty:        params.MaxVdfDifficulty,
-		DifficultyConversion: uint64(float64(params.MaxVdfDifficulty) / params.TallyStart.Sub(params.CastStart).Seconds()),
+	err = params.VerifySignature()
+	if err != nil {
+		return nil, err
 	}
-	return &Election{
+	e := &Election{
 		credSys: anoncred.AnonCred1Instance,
 		channel: bc,
 		secrets: sec,
-		vdf:     vdf,
-		method:  method,
+		vdf:     newVdf(params),
 		params:  params,
-	}, nil
+		base:    params,
+	}
+	e.credCache, _ = anoncred.DefaultCacheDir()
+	for _, opt := range opts {
+		opt(e)
+	}
+	if params.Version < ParamsVersion11 && e.requireDerivedId {
+		return nil, ErrElectionIdMismatch
+	}
+	if params.Version >= ParamsVersion11 && params.ElectionId(ChannelNetwork(bc)) != bc.Id() {
+		return nil, ErrElectionIdMismatch
+	}
+	if params.CredentialParamsURL != "" {
+		e.credSys, err = anoncred.FetchAnonCred1(ctx, params.CredentialParamsURL, params.CredentialParamsHash, e.credCache)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if e.credSys == nil {
+		return nil, errors.New("pebble: anoncred.AnonCred1Instance is nil")
+	}
+	if params.Version >= ParamsVersion3 {
+		e.contests = new(methods.MultiContest)
+		for _, c := range params.ContestList() {
+			method, err := methods.Get(c.VotingMethod, len(c.Choices), c.MethodParams)
+			if err != nil {
+				return nil, err
+			}
+			e.contests.Methods = append(e.contests.Methods, method)
+		}
+		e.method = e.contests.Methods[0]
+	} else {
+		e.method, err = methods.Get(params.VotingMethod, len(params.Choices), params.MethodParams)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if params.Version >= ParamsVersion2 {
+		err = e.Refresh(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func newVdf(params *ElectionParams) vdf.VDF {
+	return &vdf.PietrzakVdf{
+		MinDifficulty:        params.MinVdfDifficulty,
+		MaxDifficulty:        params.MaxVdfDifficulty,
+		DifficultyConversion: uint64(float64(params.MaxVdfDifficulty) / params.TallyStart.Sub(params.CastStart).Seconds()),
+	}
+}
+
+// Reloads the organizer amendments and eligibility updates from the broadcast channel
+// and applies them to the published params.
+func (e *Election) Refresh(ctx context.Context) error {
+	if e.base == nil || e.base.Version < ParamsVersion2 {
+		return nil
+	}
+	msgs, err := e.readMessages(ctx, func(m Message) bool {
+		return m.Amendment != nil || m.EligibilityUpdate != nil
+	})
+	if err != nil {
+		return err
+	}
+	params := applyAmendments(e.base, e.Id(), msgs)
+	e.updateParams(applyEligibilityUpdates(params, e.Id(), msgs))
+	return nil
+}
+
+func (e *Election) updateParams(params *ElectionParams) {
+	e.paramsMu.Lock()
+	defer e.paramsMu.Unlock()
+	if !params.TallyStart.Equal(e.params.TallyStart) {
+		e.vdf = newVdf(params)
+	}
+	e.params = params
+}
+
+// Returns the VDF of the current params.
+func (e *Election) currentVdf() vdf.VDF {
+	e.paramsMu.RLock()
+	defer e.paramsMu.RUnlock()
+	return e.vdf
+}
+
+/*
+Posts an organizer amendment to the broadcast channel.
+Fills in the next sequence number and the current phase, checks the amendment
+against the rules for that phase, signs it with the organizer key and posts it.
+Elections with an organizer set need the signatures of several organizers, see Cosign.
+*/
+func (e *Election) Amend(ctx context.Context, k pubkey.PrivateKey, a Amendment) error {
+	m, err := e.PrepareAmendment(ctx, a)
+	if err != nil {
+		return err
+	}
+	err = e.Cosign(k, &m)
+	if err != nil {
+		return err
+	}
+	return e.PostOrganizerAction(ctx, m)
+}
+
+/*
+Replaces the eligibility list during the registration window.
+Posts an organizer-signed EligibilityUpdate carrying the diff from the current list to list.
+*/
+func (e *Election) UpdateEligibility(ctx context.Context, k pubkey.PrivateKey, list *structs.EligibilityList) error {
+	m, err := e.PrepareEligibilityUpdate(ctx, list)
+	if err == ErrEligibilityUnchanged {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	err = e.Cosign(k, &m)
+	if err != nil {
+		return err
+	}
+	return e.PostOrganizerAction(ctx, m)
+}
+
+/*
+Adds voters missed at setup to the eligibility list during the registration window, without
+identity commitments, so that they register without recreating the election.
+Posts an organizer-signed EligibilityUpdate adding the keys not eligible yet, which every client
+merges into the list of the params. Nothing is posted if all the keys are eligible already.
+*/
+func (e *Election) AddVoters(ctx context.Context, k pubkey.PrivateKey, keys ...pubkey.PublicKey) error {
+	u, err := e.eligibilityUpdate(ctx, func(current *structs.EligibilityList) (*structs.EligibilityDiff, error) {
+		diff := new(structs.EligibilityDiff)
+		added := make(map[util.HashValue]bool)
+		for _, key := range keys {
+			pkh := current.HashKey(key)
+			if current.Contains(pkh) || added[pkh] {
+				continue
+			}
+			added[pkh] = true
+			diff.Added = append(diff.Added, structs.EligibilityChange{KeyHash: pkh})
+		}
+		return diff, nil
+	})
+	if err != nil || u == nil {
+		return err
+	}
+	m := Message{EligibilityUpdate: u}
+	err = e.Cosign(k, &m)
+	if err != nil {
+		return err
+	}
+	return e.PostOrganizerAction(ctx, m)
+}
+
+// Returns the unsigned eligibility update of the diff returned by f from the current list, or nil if the diff is empty.
+func (e *Election) eligibilityUpdate(ctx context.Context, f func(*structs.EligibilityList) (*structs.EligibilityDiff, error)) (*EligibilityUpdate, error) {
+	if e.base == nil || e.base.Version < ParamsVersion2 {
+		return nil, ErrAmendmentUnsigned
+	}
+	err := e.Refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !e.Params().eligibilityUpdatesOpenAt(e.Now()) {
+		return nil, ErrEligibilityUpdateNotAllowed
+	}
+	diff, err := f(e.Params().EligibilityList)
+	if err != nil {
+		return nil, err
+	}
+	if diff.Empty() {
+		return nil, nil
+	}
+	msgs, err := e.channel.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u := EligibilityUpdate{Phase: e.Phase(), Diff: *diff}
+	for _, msg := range msgs {
+		if msg.EligibilityUpdate != nil && msg.EligibilityUpdate.Sequence >= u.Sequence {
+			u.Sequence = msg.EligibilityUpdate.Sequence + 1
+		}
+	}
+	_, err = u.Apply(e.Params())
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
 }
 
 // Returns the election parameters of the Election instance.
 func (e *Election) Params() *ElectionParams {
+	e.paramsMu.RLock()
+	defer e.paramsMu.RUnlock()
 	return e.params
 }
 
 //  Returns the current phase of the election.
 func (e *Election) Phase() ElectionPhase {
-	return e.params.Phase()
+	return e.Params().PhaseAt(e.Now())
+}
+
+// Returns the countdown to the next phase boundary according to the election's time source.
+func (e *Election) Countdown() PhaseCountdown {
+	return e.Params().CountdownAt(e.Now())
+}
+
+// Returns the current time according to the election's time source.
+func (e *Election) Now() time.Time {
+	if e.clock == nil {
+		return time.Now()
+	}
+	return e.clock.Now()
+}
+
+// Returns the time source of the election, the local clock unless set by WithTimeSource.
+func (e *Election) Clock() timesource.Source {
+	if e.clock == nil {
+		return timesource.System{}
+	}
+	return e.clock
 }
 
-// Returns the ID of the election.
+// Returns the ID of the election, checked by NewElection to be derived from the params from version 11.
 func (e *Election) Id() ElectionID {
 	return e.channel.Id()
 }
 
+// Returns the params as published by the organizer, without amendments and eligibility updates.
+func (e *Election) PublishedParams() *ElectionParams {
+	return e.base
+}
+
 // Returns the broadcast channel associated with the election.
 func (e *Election) Channel() BroadcastChannel {
 	return e.channel
@@ -92,16 +405,21 @@ func (e *Election) Channel() BroadcastChannel {
 
 /*
 Posts the credential message to the broadcast channel.
-Checks if the current phase of the election allows posting credentials.
+Checks if the current phase of the election allows posting credentials
+and that the registration window is still open.
 Retrieves the private key and secret credential from the secrets manager.
 Creates and signs the credential message.
+If the eligibility list only holds a Merkle root, attaches the voter's inclusion proof.
 Posts the message to the broadcast channel.
 Returns an error if the phase is incorrect or any step fails.
 */
 func (e *Election) PostCredential(ctx context.Context) error {
-	if e.params.Phase() != CredGen {
+	if e.Phase() != CredGen {
 		return ErrWrongPhase
 	}
+	if !e.Params().RegistrationOpenAt(e.Now()) {
+		return ErrRegistrationClosed
+	}
 	priv, err := e.secrets.GetPrivateKey()
 	if err != nil {
 		return err
@@ -120,43 +438,163 @@ func (e *Election) PostCredential(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	return e.channel.Post(ctx, Message{Credential: msg})
+	if e.Params().EligibilityList.RootOnly() {
+		msg.Proof, err = e.eligibilityProof(ctx, e.Params().EligibilityList.HashKey(priv.Public()))
+		if err != nil {
+			return err
+		}
+	}
+	return e.post(ctx, Message{Credential: msg})
+}
+
+/*
+Replaces the credential of the voter, such as when they suspect their secret credential leaked,
+without involving the organizer.
+Checks that the registration window is still open during the CredGen phase.
+Generates a new secret credential and posts its public credential with the epoch following the
+voter's credentials on the broadcast channel, signed with the voter key, then has the secrets
+manager, which must implement secrets.CredentialRotator, store it in place of the previous one.
+GetCredentialSet keeps the credential of the highest epoch, and the channels refuse the
+credentials of earlier epochs from then on, so the old credential cannot be registered again.
+If posting fails, the secrets manager keeps the previous credential, which stays registered.
+If storing fails after posting, calling it again rotates the credential again.
+*/
+func (e *Election) RotateCredential(ctx context.Context) error {
+	if e.Phase() != CredGen {
+		return ErrWrongPhase
+	}
+	if !e.Params().RegistrationOpenAt(e.Now()) {
+		return ErrRegistrationClosed
+	}
+	rotator, ok := e.secrets.(secrets.CredentialRotator)
+	if !ok {
+		return ErrCredentialRotation
+	}
+	priv, err := e.secrets.GetPrivateKey()
+	if err != nil {
+		return err
+	}
+	epoch, err := e.credentialEpoch(ctx, priv.Public())
+	if err != nil {
+		return err
+	}
+	sec, err := e.credSys.GenerateSecretCredential()
+	if err != nil {
+		return err
+	}
+	pub, err := sec.Public()
+	if err != nil {
+		return err
+	}
+	msg := &structs.CredentialMessage{Credential: pub.Bytes(), Epoch: epoch + 1}
+	err = msg.Sign(priv, e.Id())
+	if err != nil {
+		return err
+	}
+	if e.Params().EligibilityList.RootOnly() {
+		msg.Proof, err = e.eligibilityProof(ctx, e.Params().EligibilityList.HashKey(priv.Public()))
+		if err != nil {
+			return err
+		}
+	}
+	err = e.post(ctx, Message{Credential: msg})
+	if err != nil {
+		return err
+	}
+	return rotator.SetSecretCredential(sec)
+}
+
+// Returns the highest epoch of the validly signed credential messages of the voter key on the broadcast channel.
+func (e *Election) credentialEpoch(ctx context.Context, pk pubkey.PublicKey) (uint32, error) {
+	msgs, err := e.readMessages(ctx, func(m Message) bool {
+		return m.Credential != nil && bytes.Equal(m.Credential.PublicKey, pk)
+	})
+	if err != nil {
+		return 0, err
+	}
+	var epoch uint32
+	for _, m := range msgs {
+		if m.Credential.Epoch > epoch && m.Credential.Verify(e.Id()) == nil {
+			epoch = m.Credential.Epoch
+		}
+	}
+	return epoch, nil
+}
+
+// Fetches and checks the inclusion proof of pkh from the broadcast channel.
+func (e *Election) eligibilityProof(ctx context.Context, pkh util.HashValue) (*structs.EligibilityProof, error) {
+	provider, ok := e.channel.(EligibilityProvider)
+	if !ok {
+		return nil, ErrNoEligibilityProof
+	}
+	proof, err := provider.EligibilityProof(ctx, pkh)
+	if err != nil {
+		return nil, err
+	}
+	_, err = e.Params().EligibilityList.Verify(pkh, proof)
+	if err != nil {
+		return nil, err
+	}
+	return proof, nil
 }
 
 /*
 Retrieves the credential set from the broadcast channel.
 Checks if the current phase of the election allows retrieving credentials.
 Fetches the messages from the broadcast channel.
-Verifies and reads the public credentials from the received messages.
-Constructs the credential set using the credential system.
+Keeps the credential messages of eligible voters and verifies their signatures.
+Reads the public credentials from the remaining messages, leaving out the credentials of delegators.
+Constructs the credential set using the credential system, from the credentials ordered by the
+SHA-256 hash of the voter public key: this order is part of the protocol, so that every voter and
+verifier builds the same set whatever order the messages were read in.
 Returns the credential set or an error if the phase is incorrect or any step fails.
 */
-func (e *Election) GetCredentialSet(ctx context.Context) (anoncred.CredentialSet, error) {
-	if e.params.Phase() <= CredGen {
+func (e *Election) GetCredentialSet(ctx context.Context) (_ anoncred.CredentialSet, err error) {
+	if e.Phase() <= CredGen {
 		return nil, ErrWrongPhase
 	}
-	msgs, err := e.channel.Get(ctx)
+	ctx, end := e.start(ctx, "pebble.credential_set")
+	defer func() { end(err) }()
+	msgs, err := e.readMessages(ctx, func(m Message) bool {
+		return m.Credential != nil || m.Delegation != nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	creds := make(map[util.HashValue]anoncred.PublicCredential)
-	for _, msg := range msgs {
-		if msg.Credential == nil {
-			continue
-		}
-		if msg.Credential.Verify(e.Id()) != nil {
-			continue
+	delegators := e.delegations(msgs)
+	verified := e.verifiedCredentials(msgs)
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	var keys []util.HashValue
+	for pkh := range verified {
+		if _, ok := delegators[pkh]; !ok {
+			keys = append(keys, pkh)
 		}
-		cred, err := e.credSys.ReadPublicCredential(msg.Credential.Credential)
-		if err != nil {
-			continue
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i][:], keys[j][:]) < 0
+	})
+	voters := make([]*structs.CredentialMessage, len(keys))
+	for i, pkh := range keys {
+		voters[i] = verified[pkh]
+	}
+	creds := make([]anoncred.PublicCredential, len(voters))
+	parallelFor(len(voters), func(i int) {
+		if ctx.Err() == nil {
+			creds[i], _ = e.credSys.ReadPublicCredential(voters[i].Credential)
 		}
-		creds[util.Hash(msg.Credential.PublicKey)] = cred
+	})
+	if err = ctx.Err(); err != nil {
+		return nil, err
 	}
 	var list []anoncred.PublicCredential
 	for _, c := range creds {
-		list = append(list, c)
+		if c != nil {
+			list = append(list, c)
+		}
 	}
+	e.add(ctx, "pebble.credentials", int64(len(list)))
 	return e.credSys.MakeCredentialSet(list)
 }
 
@@ -167,23 +605,34 @@ Retrieves the credential set.
 Generates a VDF solution.
 Encrypts the ballot using the VDF solution.
 Signs the encrypted ballot using the credential set and secret credential.
-Stores the signed ballot in the secrets manager.
+Adds the signed ballot to the ballot history of the secrets manager.
 Posts the signed ballot to the broadcast channel.
-Returns an error if the phase is incorrect or any step fails.
+Returns an error if the phase is incorrect or any step fails, and ErrAlreadyVoted if a
+ballot of the history is already on the channel, since only the first one counts.
 */
 func (e *Election) Vote(ctx context.Context, choices ...int) error {
-	if e.params.Phase() != Cast {
+	return e.VoteContests(ctx, [][]int{choices})
+}
+
+// Casts a vote with one list of choices per contest of the election.
+func (e *Election) VoteContests(ctx context.Context, choices [][]int) (err error) {
+	if e.Phase() != Cast {
 		return ErrWrongPhase
 	}
-	set, err := e.GetCredentialSet(ctx)
+	ctx, end := e.start(ctx, "pebble.vote")
+	defer func() { end(err) }()
+	posted, err := e.PostedBallot(ctx)
 	if err != nil {
 		return err
 	}
-	sol, err := e.vdf.Create(e.puzzleDuration())
+	if posted != nil {
+		return ErrAlreadyVoted
+	}
+	set, err := e.GetCredentialSet(ctx)
 	if err != nil {
 		return err
 	}
-	err = e.secrets.SetVdfSolution(sol)
+	encBallot, sol, err := e.EncryptBallot(ctx, choices)
 	if err != nil {
 		return err
 	}
@@ -191,41 +640,182 @@ func (e *Election) Vote(ctx context.Context, choices ...int) error {
 	if err != nil {
 		return err
 	}
-	ballot := e.method.Vote(choices...)
-	encBallot, err := ballot.Encrypt(sol)
+	signBallot, err := encBallot.Sign(set, sec, e.ballotDomain())
 	if err != nil {
 		return err
 	}
-	signBallot, err := encBallot.Sign(set, sec)
+	if _, ok := e.homomorphicMethod(); !ok {
+		err = e.secrets.SetVdfSolution(e.Id(), signBallot.SerialNo, sol)
+		if err != nil {
+			return err
+		}
+	}
+	err = e.secrets.AddBallot(secrets.BallotRecord{ElectionId: e.Id(), Ballot: signBallot, Time: e.Now(), TrackingCode: BallotTrackingCode(signBallot)})
 	if err != nil {
 		return err
 	}
-	err = e.secrets.SetBallot(signBallot)
+	return e.post(ctx, Message{SignedBallot: &signBallot})
+}
+
+/*
+Encrypts a ballot with one list of choices per contest, without signing or posting it,
+so that callers keeping secrets elsewhere can cast it with SignBallot.
+Returns the VDF solution opening the ballot in the Tally phase. Ballots of homomorphically
+tallied elections are only opened by the trustees, and have no VDF solution.
+*/
+func (e *Election) EncryptBallot(ctx context.Context, choices [][]int) (structs.EncryptedBallot, vdf.VdfSolution, error) {
+	if hm, ok := e.homomorphicMethod(); ok {
+		if len(choices) != 1 {
+			return structs.EncryptedBallot{}, vdf.VdfSolution{}, methods.ErrContestCount
+		}
+		b, err := hm.Vote(choices[0]...)
+		if err != nil {
+			return structs.EncryptedBallot{}, vdf.VdfSolution{}, err
+		}
+		eid := e.Id()
+		vb, err := e.Params().Trustees.EncryptVector(b, eid[:])
+		if err != nil {
+			return structs.EncryptedBallot{}, vdf.VdfSolution{}, err
+		}
+		return structs.EncryptedBallot{Payload: vb.Bytes()}, vdf.VdfSolution{}, nil
+	}
+	ballot, err := e.makeBallot(choices)
 	if err != nil {
-		return err
+		return structs.EncryptedBallot{}, vdf.VdfSolution{}, err
 	}
-	return e.channel.Post(ctx, Message{SignedBallot: &signBallot})
+	sol, err := e.createPuzzle(ctx)
+	if err != nil {
+		return structs.EncryptedBallot{}, sol, err
+	}
+	encBallot, err := ballot.EncryptWith(e.Params().CipherSuite, sol)
+	if err != nil {
+		return encBallot, sol, err
+	}
+	if e.Params().Trustees != nil {
+		c, err := e.Params().Trustees.Encrypt(ballot)
+		if err != nil {
+			return encBallot, sol, err
+		}
+		encBallot.Trustee = c.Bytes()
+	}
+	return encBallot, sol, nil
+}
+
+// Signs an encrypted ballot with the secret credential against the credential set of the election.
+// The signature proves that the ballot was cast by an eligible voter without revealing which one.
+func (e *Election) SignBallot(ctx context.Context, encBallot structs.EncryptedBallot, sec anoncred.SecretCredential) (structs.SignedBallot, error) {
+	set, err := e.GetCredentialSet(ctx)
+	if err != nil {
+		return structs.SignedBallot{}, err
+	}
+	return encBallot.Sign(set, sec, e.ballotDomain())
+}
+
+func (e *Election) makeBallot(choices [][]int) (structs.Ballot, error) {
+	if e.contests != nil {
+		return e.contests.Vote(choices)
+	}
+	if len(choices) != 1 {
+		return nil, methods.ErrContestCount
+	}
+	return e.method.Vote(choices[0]...)
+}
+
+// Tallies the decrypted ballots, returning the tally of each contest.
+func (e *Election) tally(ballots []structs.Ballot) []methods.Tally {
+	if e.contests != nil {
+		return e.contests.Tally(ballots)
+	}
+	return []methods.Tally{e.method.Tally(ballots)}
+}
+
+// Describes the tally of each contest in the progress with the contest's voting method.
+func (e *Election) Results(p ElectionProgress) []methods.Result {
+	contestMethods := []methods.VotingMethod{e.method}
+	if e.contests != nil {
+		contestMethods = e.contests.Methods
+	}
+	results := make([]methods.Result, len(p.Tallies))
+	for i, t := range p.Tallies {
+		if i < len(contestMethods) {
+			results[i] = contestMethods[i].Result(t, p.TieBreakSeed)
+		}
+	}
+	return results
+}
+
+// Creates the VDF puzzle of a ballot, of the difficulty set by WithVdfDifficulty if any.
+func (e *Election) createPuzzle(ctx context.Context) (vdf.VdfSolution, error) {
+	ivdf := e.timedVdf(ctx)
+	if e.vdfDifficulty == 0 {
+		return ivdf.Create(e.puzzleDuration())
+	}
+	dv, ok := ivdf.(vdf.DifficultyVDF)
+	if !ok {
+		return vdf.VdfSolution{}, ErrVdfDifficulty
+	}
+	return dv.CreateWithDifficulty(e.vdfDifficulty)
+}
+
+// Reports whether the VDF input declares a difficulty within the bounds of the params.
+// Inputs of VDFs that do not declare their difficulty are left to Verify.
+func (e *Election) vdfDifficultyValid(input []byte) bool {
+	dv, ok := e.currentVdf().(vdf.DifficultyVDF)
+	if !ok {
+		return true
+	}
+	_, err := dv.Difficulty(input)
+	return err == nil
 }
 
 func (e *Election) puzzleDuration() uint64 {
 	// Calculates the duration of the puzzle (VDF) based on the election parameters.
 	// Returns the puzzle duration as a uint64 value.
-	return uint64(e.params.TallyStart.Sub(e.params.CastStart).Seconds())
+	return uint64(e.Params().TallyStart.Sub(e.Params().CastStart).Seconds())
 }
 
 /*
-Retrieves the VDF solution from the secrets manager.
+Retrieves the VDF solution of the voter's ballot in this election from the secrets manager.
 Calls PostBallotDecryption with the VDF solution as the parameter.
 Returns an error if the VDF solution retrieval or posting fails.
 */
 func (e *Election) RevealBallotDecryption(ctx context.Context) error {
-	sol, err := e.secrets.GetVdfSolution()
+	sb, err := e.secrets.GetBallot(e.Id())
+	if err != nil {
+		return err
+	}
+	sol, err := e.secrets.GetVdfSolution(e.Id(), sb.SerialNo)
 	if err != nil {
 		return err
 	}
 	return e.PostBallotDecryption(ctx, sol)
 }
 
+/*
+Reveals the key of the voter's ballot in this election, derived from the VDF solution in the secrets manager.
+Voters whose VDF is solved can post their key as soon as the tally starts, so that their ballot
+is counted without waiting for the VDF proof, which may be slow to compute.
+Returns an error if the phase is not Tally or the VDF solution retrieval or posting fails.
+*/
+func (e *Election) RevealBallotKey(ctx context.Context) error {
+	if e.Phase() != Tally {
+		return ErrWrongPhase
+	}
+	sb, err := e.secrets.GetBallot(e.Id())
+	if err != nil {
+		return err
+	}
+	sol, err := e.secrets.GetVdfSolution(e.Id(), sb.SerialNo)
+	if err != nil {
+		return err
+	}
+	key, err := sb.EncryptedBallot.Suite.Key(sol)
+	if err != nil {
+		return err
+	}
+	return e.post(ctx, Message{KeyReveal: &structs.KeyRevealMessage{InputHash: util.Hash(sol.Input), Key: key}})
+}
+
 /*
 Posts the ballot decryption message to the broadcast channel.
 Checks if the current phase of the election allows posting ballot decryption.
@@ -234,92 +824,257 @@ Posts the message to the broadcast channel.
 Returns an error if the phase is incorrect or any step fails.
 */
 func (e *Election) PostBallotDecryption(ctx context.Context, sol vdf.VdfSolution) error {
-	if e.params.Phase() != Tally {
+	if e.Phase() != Tally {
 		return ErrWrongPhase
 	}
 	msg := structs.CreateDecryptionMessage(sol)
-	return e.channel.Post(ctx, Message{Decryption: &msg})
+	return e.post(ctx, Message{Decryption: &msg})
 }
 
 /*
 Retrieves the progress of the election.
+Applies any new organizer amendments.
 Determines the current phase of the election.
 Retrieves the credential set and messages from the broadcast channel.
 Processes the signed ballots and decryption messages to calculate the progress.
+Once the election has ended, the progress is kept until new messages are posted.
 Returns an ElectionProgress struct with the phase, count, total, and tally (if applicable), or an error.
 */
 func (e *Election) Progress(ctx context.Context) (p ElectionProgress, err error) {
-	p.Phase = e.params.Phase()
+	err = e.Refresh(ctx)
+	if err != nil {
+		return
+	}
+	p.Phase = e.Phase()
 	if p.Phase <= CredGen {
 		return
 	}
-	set, err := e.GetCredentialSet(ctx)
+	ctx, end := e.start(ctx, "pebble.progress")
+	defer func() {
+		e.add(ctx, "pebble.ballots.rejected", int64(len(p.Rejected)))
+		end(err)
+	}()
+	// Only the messages counted in the tally are kept in memory
+	msgs, err := e.readMessages(ctx, func(m Message) bool {
+		return m.SignedBallot != nil || m.Decryption != nil || m.DecryptionBatch != nil || m.TrusteeDecryption != nil ||
+			m.KeyReveal != nil || m.Credential != nil || m.Delegation != nil || m.DelegateClaim != nil
+	})
 	if err != nil {
 		return
 	}
-	msgs, err := e.channel.Get(ctx)
+	// The result of an ended election only changes with new messages, so it is not verified again until then
+	if p.Phase == End {
+		if final, ok := e.finalProgress(len(msgs)); ok {
+			return final, nil
+		}
+		defer func() {
+			if err == nil {
+				e.setFinalProgress(len(msgs), p)
+			}
+		}()
+	}
+	set, err := e.GetCredentialSet(ctx)
 	if err != nil {
 		return
 	}
+	if hm, ok := e.homomorphicMethod(); ok {
+		return e.homomorphicProgress(ctx, p, hm, set, msgs)
+	}
 	var signBallots []structs.SignedBallot
 	var decMsgs []structs.DecryptionMessage
+	var trusteeMsgs []structs.TrusteeDecryptionMessage
+	var reveals []structs.KeyRevealMessage
 	for _, msg := range msgs {
 		if msg.SignedBallot != nil {
 			signBallots = append(signBallots, *msg.SignedBallot)
-		} else if msg.Decryption != nil {
-			decMsgs = append(decMsgs, *msg.Decryption)
+		} else if msg.Decryption != nil || msg.DecryptionBatch != nil {
+			decMsgs = appendDecryptions(decMsgs, msg)
+		} else if msg.TrusteeDecryption != nil {
+			trusteeMsgs = append(trusteeMsgs, *msg.TrusteeDecryption)
+		} else if msg.KeyReveal != nil && !msg.Received.Before(e.Params().TallyStart) {
+			// Keys revealed before the tally, when the channel tells, are not counted
+			reveals = append(reveals, *msg.KeyReveal)
 		}
 	}
+	partials := collectTrusteePartials(trusteeMsgs)
+	weights := e.delegatedWeights(set, msgs)
+	domain := e.ballotDomain()
+	ivdf := e.timedVdf(ctx)
+	if p.Phase >= Tally {
+		bv := newBatchVerifier(ivdf)
+		bv.verifyFirst(signBallots, decMsgs)
+		ivdf = bv
+	}
 	var serialNos util.BytesSet
 	var decBallots []structs.Ballot
+	var decHashes []util.HashValue
 	validSignBallots := 0
 	validDecBallots := 0
 	invalidDecBallots := 0
-	for _, signBallot := range signBallots {
+	for i := range signBallots {
+		// Stop verifying once the caller is gone
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		signBallot := &signBallots[i]
 		if serialNos.Contains(signBallot.SerialNo) {
+			p.reject(signBallot, RejectDuplicateSerialNo)
 			continue
 		}
-		err = signBallot.Verify(set)
+		err = signBallot.Verify(set, domain)
 		if err != nil {
+			p.reject(signBallot, RejectInvalidSignature)
 			continue
 		}
+		// Ballots of another suite, such as a weaker legacy one, are not counted
+		if signBallot.EncryptedBallot.Suite != e.Params().CipherSuite {
+			p.reject(signBallot, RejectCipherSuite)
+			continue
+		}
+		// Puzzles below the minimum difficulty could be solved before the tally starts
+		if e.Params().MinVdfDifficulty != 0 && !e.vdfDifficultyValid(signBallot.EncryptedBallot.VdfInput) {
+			p.reject(signBallot, RejectVdfDifficulty)
+			continue
+		}
+		serialNos.Put(signBallot.SerialNo)
 		validSignBallots++
 		if p.Phase >= Tally {
-			ballot, err := decryptBallot(signBallot.EncryptedBallot, decMsgs, e.vdf)
+			var decHash util.HashValue
+			ballot, decProof, err := decryptBallot(signBallot.EncryptedBallot, decMsgs, reveals, ivdf)
+			if err == nil {
+				decHash = e.hash(util.DomainBallot, decProof)
+			} else if err == ErrDecryptionNotFound {
+				// Fall back to the trustees
+				ballot, err = decryptTrusteeBallot(signBallot.EncryptedBallot, e.Params().Trustees, partials)
+				decHash = e.hash(util.DomainBallot, signBallot.EncryptedBallot.Trustee, ballot)
+			}
 			if err != nil {
 				if err != ErrDecryptionNotFound {
+					p.reject(signBallot, RejectInvalidDecryption)
 					invalidDecBallots++
 				}
 				continue
 			}
 			decBallots = append(decBallots, ballot)
+			// Once more for each voter delegating to the ballot's caster
+			for i := uint64(0); i < weights[string(signBallot.SerialNo)]; i++ {
+				decBallots = append(decBallots, ballot)
+			}
+			decHashes = append(decHashes, decHash)
 			validDecBallots++
 		}
 	}
+	e.add(ctx, "pebble.ballots.verified", int64(validSignBallots))
 	if p.Phase == Cast {
 		p.Total = set.Len()
 		p.Count = validSignBallots
 	} else if p.Phase == Tally {
 		p.Total = validSignBallots - invalidDecBallots
 		p.Count = validDecBallots
-		p.Tally = e.method.Tally(decBallots)
+		p.Tallies = e.tally(decBallots)
+		p.Tally = p.Tallies[0]
+		p.TieBreakSeed = e.tieBreakSeed(decHashes)
 	} else {
 		p.Total = validSignBallots
 		p.Count = validDecBallots
-		p.Tally = e.method.Tally(decBallots)
+		p.Tallies = e.tally(decBallots)
+		p.Tally = p.Tallies[0]
+		p.TieBreakSeed = e.tieBreakSeed(decHashes)
 	}
 	return p, nil
 }
 
+// Returns the progress of the ended election if it was computed from n messages, as many as the channel now holds.
+func (e *Election) finalProgress(n int) (ElectionProgress, bool) {
+	e.finalMu.Lock()
+	defer e.finalMu.Unlock()
+	if e.final == nil || e.finalMessages != n {
+		return ElectionProgress{}, false
+	}
+	return e.final.clone(), true
+}
+
+func (e *Election) setFinalProgress(n int, p ElectionProgress) {
+	e.finalMu.Lock()
+	defer e.finalMu.Unlock()
+	p = p.clone()
+	e.final, e.finalMessages = &p, n
+}
+
+// Returns a copy of the progress sharing no slice or map with it, so that callers may change either.
+func (p ElectionProgress) clone() ElectionProgress {
+	c := p
+	c.Tally = append(methods.Tally(nil), p.Tally...)
+	if p.Tallies != nil {
+		c.Tallies = make([]methods.Tally, len(p.Tallies))
+		for i, t := range p.Tallies {
+			c.Tallies[i] = append(methods.Tally(nil), t...)
+		}
+	}
+	c.Rejected = append([]RejectedMessage(nil), p.Rejected...)
+	if p.Rejections != nil {
+		c.Rejections = make(map[RejectionReason]int, len(p.Rejections))
+		for reason, n := range p.Rejections {
+			c.Rejections[reason] = n
+		}
+	}
+	return c
+}
+
 /*
-Decrypts an encrypted ballot using the provided decryption messages and VDF.
-Takes the encrypted ballot, decryption messages, and VDF as input.
+Returns a channel receiving the messages posted to the election after the call,
+such as new credentials or decryptions, so that callers can react to them without polling.
+Messages are not verified; the channel is closed once ctx is done.
+*/
+func (e *Election) Watch(ctx context.Context) (<-chan Message, error) {
+	return e.channel.Watch(ctx)
+}
+
+// Posts the message to the channel with the proof of work required by the params.
+func (e *Election) post(ctx context.Context, m Message) error {
+	if e.Params().PowDifficulty != 0 {
+		m.SolvePow(e.Id(), e.Params().PowDifficulty)
+	}
+	return e.channel.Post(ctx, m)
+}
+
+// Returns the domain of ballot signatures, or nil for params older than version 8.
+func (e *Election) ballotDomain() *structs.BallotDomain {
+	if e.Params().Version < ParamsVersion8 {
+		return nil
+	}
+	return &structs.BallotDomain{ElectionId: e.Id(), Phase: byte(Cast)}
+}
+
+// Hashes data in domain with the hash scheme of the election.
+func (e *Election) hash(domain string, data ...[]byte) util.HashValue {
+	return e.Params().HashScheme().Sum(domain, data...)
+}
+
+// Hashes the sorted decryption message hashes, so the seed does not depend on message order
+// and cannot be known before the ballots are opened.
+func (e *Election) tieBreakSeed(hashes []util.HashValue) util.HashValue {
+	sort.Slice(hashes, func(i, j int) bool {
+		return bytes.Compare(hashes[i][:], hashes[j][:]) < 0
+	})
+	var w util.BufferWriter
+	for _, h := range hashes {
+		w.Write32(h)
+	}
+	return e.hash(util.DomainBallot, w.Buffer)
+}
+
+/*
+Decrypts an encrypted ballot using the provided decryption messages and VDF, or else the revealed keys.
 Checks if the VDF solution matches the input hash of the encrypted ballot.
 Verifies the VDF solution.
 Decrypts the ballot using the VDF solution.
-Returns the decrypted ballot or an error if the decryption is not found or fails.
+Falls back to the keys revealed for the input hash, skipping those that do not open the ballot.
+Returns the decrypted ballot and the bytes hashed into the tie-break seed: the decryption message used,
+or the key reveal followed by the ballot, since legacy keys can be computed from the ballot alone.
+Returns an error if the decryption is not found or fails.
 */
-func decryptBallot(encBallot structs.EncryptedBallot, msgs []structs.DecryptionMessage, ivdf vdf.VDF) (structs.Ballot, error) {
+func decryptBallot(encBallot structs.EncryptedBallot, msgs []structs.DecryptionMessage, reveals []structs.KeyRevealMessage, ivdf vdf.VDF) (structs.Ballot, []byte, error) {
 	vdfInputHash := util.Hash(encBallot.VdfInput)
 	for _, msg := range msgs {
 		if msg.InputHash == vdfInputHash {
@@ -330,10 +1085,22 @@ func decryptBallot(encBallot structs.EncryptedBallot, msgs []structs.DecryptionM
 			}
 			ballot, err := encBallot.Decrypt(sol)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
+			}
+			return ballot, msg.Bytes(), nil
+		}
+	}
+	for _, reveal := range reveals {
+		if reveal.InputHash == vdfInputHash {
+			ballot, err := encBallot.DecryptWithKey(reveal.Key)
+			if err == structs.ErrInvalidBallotKey {
+				continue
+			}
+			if err != nil {
+				return nil, nil, err
 			}
-			return ballot, nil
+			return ballot, util.Concat(reveal.Bytes(), ballot), nil
 		}
 	}
-	return nil, ErrDecryptionNotFound
+	return nil, nil, ErrDecryptionNotFound
 }
@@ -6,14 +6,88 @@ It allows the election parameters to be converted to a byte slice representation
 package voting
 
 import (
+	"bytes"
 	"errors"
+	"net/url"
 	"time"
 
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/trustee"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/methods"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
 )
 
-var errUnknownVersion = errors.New("pebble: unknown ElectionParams version")
+var (
+	errUnknownVersion = errors.New("pebble: unknown ElectionParams version")
+
+	ErrInvalidSchedule = errors.New("pebble: invalid election schedule")
+	ErrInvalidContests = errors.New("pebble: invalid election contests")
+	ErrParamsTooLarge  = errors.New("pebble: ElectionParams field too large for version")
+
+	ErrInvalidCredentialParams = errors.New("pebble: invalid credential system parameters reference")
+	ErrInvalidVdfDifficulty    = errors.New("pebble: invalid VDF difficulty bounds")
+
+	ErrUnsignedParams         = errors.New("pebble: ElectionParams not signed by the organizer")
+	ErrOrganizerMismatch      = errors.New("pebble: ElectionParams signed by an unexpected organizer")
+	ErrInvalidParamsSignature = errors.New("pebble: invalid ElectionParams signature")
+)
+
+// ElectionParams versions.
+// Version 1 adds an explicit registration window (CredGenStart, RegistrationEnd).
+// Version 2 adds the organizer public key and its signature over the params.
+// Version 3 adds multiple contests, each with its own voting method and choices.
+// Version 4 adds method-specific parameters, at the top level and per contest.
+// Version 5 adds the optional trustee key set for threshold decryption.
+// Version 6 encodes timestamps, counts and vector lengths as varints,
+// lifting the limits of 255 choices or contests and of 32767-byte fields.
+// Version 7 adds the hash algorithm, with domain-separated hashing of election data.
+// Version 8 binds ballot signatures to the election ID and the Cast phase.
+// Version 9 adds the proof-of-work difficulty required to post messages.
+// Version 10 adds the URL and hash of the credential system parameters.
+// Version 11 derives the election ID from the params, see ElectionId, and only applies
+// organizer actions whose receive time is known.
+// Version 12 adds the cipher suite of the ballots.
+// Version 13 allows trustee key sets with hybrid post-quantum keys.
+// Version 14 adds the minimum VDF difficulty, below which ballots are not counted.
+// Version 15 adds translations of the title, description, choices and contests.
+// Version 16 adds the seed of the order in which each voter is shown the choices.
+// Version 17 adds the organizer key set of which a threshold signs the organizer actions.
+const (
+	ParamsVersion0 uint32 = iota
+	ParamsVersion1
+	ParamsVersion2
+	ParamsVersion3
+	ParamsVersion4
+	ParamsVersion5
+	ParamsVersion6
+	ParamsVersion7
+	ParamsVersion8
+	ParamsVersion9
+	ParamsVersion10
+	ParamsVersion11
+	ParamsVersion12
+	ParamsVersion13
+	ParamsVersion14
+	ParamsVersion15
+	ParamsVersion16
+	ParamsVersion17
+
+	latestParamsVersion = ParamsVersion17
+)
+
+// Limits of the params encoding before version 6, and decoding limits from version 6.
+// Encoded params, including the eligibility list, take at most maxParamsSize bytes.
+const (
+	legacyMaxCount  = 255
+	legacyMaxVector = 0x7FFF
+	maxCount        = 1 << 16
+	maxVector       = 1 << 24
+	maxParamsSize   = 1 << 28
+)
+
+// Prefixed to the canonical params bytes before signing.
+const paramsSignatureContext = "pebble-params"
 
 type ElectionPhase uint8
 
@@ -26,20 +100,114 @@ const (
 	End
 )
 
+var phaseNames = [...]string{"Setup", "CredGen", "Cast", "Tally", "End"}
+
+func (ph ElectionPhase) String() string {
+	if int(ph) < len(phaseNames) {
+		return phaseNames[ph]
+	}
+	return "Unknown"
+}
+
 type ElectionParams struct {
 	Version                         uint32
+	CredGenStart, RegistrationEnd   time.Time
 	CastStart, TallyStart, TallyEnd time.Time
 	MaxVdfDifficulty                uint64
 	VotingMethod                    string
+	MethodParams                    []byte
 	Title, Description              string
 	Choices                         []string
+	Contests                        []Contest
+	Organizer                       pubkey.PublicKey
+	Signature                       []byte
 	EligibilityList                 *structs.EligibilityList
+	// If set, ballots are also encrypted to the trustees, who can decrypt them
+	// when voters do not reveal their VDF solutions.
+	Trustees *trustee.KeySet
+	// Hash algorithm of the HashScheme, from version 7.
+	HashAlgorithm util.HashAlgorithm
+	// Leading zero bits of the proof of work required for each posted message, from version 9.
+	PowDifficulty uint8
+	// Location and SHA-256 hash of the anoncred1 parameters of the election, from version 10.
+	// If not set, clients use anoncred.AnonCred1Instance.
+	CredentialParamsURL  string
+	CredentialParamsHash util.HashValue
+	// Cipher suite with which ballots are encrypted, from version 12.
+	// Ballots of another suite are not counted.
+	CipherSuite structs.CipherSuite
+	/*
+		Minimum difficulty of the VDF puzzles of ballots, from version 14. Each ballot declares
+		the difficulty of its puzzle within [MinVdfDifficulty, MaxVdfDifficulty], so that slow
+		devices can cast smaller puzzles; the minimum should take at least until TallyStart to
+		solve on the fastest hardware expected. Ballots out of bounds are not counted.
+	*/
+	MinVdfDifficulty uint64
+	// Texts of the params in other languages, from version 15, see Translation.
+	Translations []Translation
+	// Seed of the order of the choices shown to each voter, from version 16, see ChoiceOrder.
+	// Zero if the choices are shown in the order of the params.
+	ChoiceOrderSeed util.HashValue
+	// If set, the organizer actions need the signatures of a threshold of the set, from version 17.
+	Organizers *OrganizerSet
 }
 
-// Returns the current phase of the election based on the current time.
+// A single question of the election, with its own voting method and choices.
+type Contest struct {
+	Title        string
+	VotingMethod string
+	MethodParams []byte
+	Choices      []string
+}
+
+// Returns the contests of the election.
+// Params older than version 3, or without explicit contests, have a single contest
+// made of the top-level method and choices.
+func (p *ElectionParams) ContestList() []Contest {
+	if p.Version >= ParamsVersion3 && len(p.Contests) != 0 {
+		return p.Contests
+	}
+	return []Contest{{Title: p.Title, VotingMethod: p.VotingMethod, MethodParams: p.MethodParams, Choices: p.Choices}}
+}
+
+/*
+Returns the scheme hashing the ballots, credentials and params of the election.
+Params older than version 7 use the legacy scheme, so that existing elections still verify.
+*/
+func (p *ElectionParams) HashScheme() util.HashScheme {
+	if p.Version < ParamsVersion7 {
+		return util.LegacyHashScheme
+	}
+	return util.HashScheme{Algorithm: p.HashAlgorithm, Separated: true}
+}
+
+// Returns the hash of the params, including the organizer signature and eligibility list.
+func (p *ElectionParams) Hash() util.HashValue {
+	return p.HashScheme().Sum(util.DomainParams, p.Bytes())
+}
+
+/*
+Returns the ID of the election published with these params on the network of its channel:
+the hash of the network name and of the params, including the organizer signature, so that
+a channel cannot serve other params under the ID of an election, nor the election be replayed
+on another network. On broadcast servers, the rest of the channel address is the ID itself.
+Only binding from version 11; older elections have the ID assigned by their channel,
+see RequireDerivedId.
+*/
+func (p *ElectionParams) ElectionId(network string) ElectionID {
+	return p.HashScheme().Sum(util.DomainElection, []byte(network), p.Bytes())
+}
+
+// Returns the current phase of the election based on the local clock.
 func (p *ElectionParams) Phase() ElectionPhase {
-	now := time.Now()
-	if now.Before(p.CastStart) {
+	return p.PhaseAt(time.Now())
+}
+
+// Returns the phase of the election at the given time.
+func (p *ElectionParams) PhaseAt(now time.Time) ElectionPhase {
+	if p.Version >= ParamsVersion1 && now.Before(p.CredGenStart) {
+		return Setup
+	} else if now.Before(p.CastStart) {
 		return CredGen
 	} else if now.Before(p.TallyStart) {
 		return Cast
@@ -50,26 +218,394 @@ func (p *ElectionParams) Phase() ElectionPhase {
 	}
 }
 
+// Returns the time at which the phase starts, or the zero time for phases starting with the election.
+func (p *ElectionParams) PhaseStart(ph ElectionPhase) time.Time {
+	switch ph {
+	case CredGen:
+		if p.Version >= ParamsVersion1 {
+			return p.CredGenStart
+		}
+	case Cast:
+		return p.CastStart
+	case Tally:
+		return p.TallyStart
+	case End:
+		return p.TallyEnd
+	}
+	return time.Time{}
+}
+
+// Returns whether credentials may currently be posted.
+// Before version 1 registration stays open for the whole CredGen phase.
+func (p *ElectionParams) RegistrationOpen() bool {
+	return p.RegistrationOpenAt(time.Now())
+}
+
+// Returns whether credentials may be posted at the given time.
+func (p *ElectionParams) RegistrationOpenAt(now time.Time) bool {
+	if p.PhaseAt(now) != CredGen {
+		return false
+	}
+	return p.Version < ParamsVersion1 || now.Before(p.RegistrationEnd)
+}
+
+// Checks that the election schedule is consistent.
+func (p *ElectionParams) Validate() error {
+	if p.Version > latestParamsVersion {
+		return errUnknownVersion
+	}
+	if p.Version >= ParamsVersion1 {
+		if p.RegistrationEnd.Before(p.CredGenStart) || p.CastStart.Before(p.RegistrationEnd) {
+			return ErrInvalidSchedule
+		}
+	}
+	if !p.CastStart.Before(p.TallyStart) || p.TallyEnd.Before(p.TallyStart) {
+		return ErrInvalidSchedule
+	}
+	limit := p.countLimit()
+	if len(p.Contests) > limit {
+		return ErrInvalidContests
+	}
+	contests := p.ContestList()
+	for _, c := range contests {
+		if len(c.Choices) > limit {
+			return ErrInvalidContests
+		}
+		method, err := methods.Get(c.VotingMethod, len(c.Choices), c.MethodParams)
+		if err != nil {
+			return err
+		}
+		// Homomorphic tallying needs trustees and is only supported for single-contest elections
+		if _, ok := method.(methods.HomomorphicMethod); ok && (p.Trustees == nil || len(contests) != 1) {
+			return ErrInvalidContests
+		}
+	}
+	if p.Version < ParamsVersion6 && !p.fitsLegacyVectors() {
+		return ErrParamsTooLarge
+	}
+	if p.Version >= ParamsVersion7 && !p.HashAlgorithm.Available() {
+		return util.ErrUnknownHashAlgorithm
+	}
+	if p.PowDifficulty > maxPowDifficulty || (p.PowDifficulty != 0 && p.Version < ParamsVersion9) {
+		return ErrInvalidPowDifficulty
+	}
+	if p.CipherSuite != structs.SuiteAESGCM && p.Version < ParamsVersion12 {
+		return errUnknownVersion
+	}
+	if !p.CipherSuite.Available() {
+		return structs.ErrUnknownCipherSuite
+	}
+	if p.MinVdfDifficulty > p.MaxVdfDifficulty || (p.MinVdfDifficulty != 0 && p.Version < ParamsVersion14) {
+		return ErrInvalidVdfDifficulty
+	}
+	if p.ChoiceOrderSeed != (util.HashValue{}) && p.Version < ParamsVersion16 {
+		return errUnknownVersion
+	}
+	if p.Organizers != nil {
+		if p.Version < ParamsVersion17 {
+			return errUnknownVersion
+		}
+		if err := p.Organizers.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := p.validateTranslations(); err != nil {
+		return err
+	}
+	if p.CredentialParamsURL != "" {
+		u, err := url.Parse(p.CredentialParamsURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || p.Version < ParamsVersion10 {
+			return ErrInvalidCredentialParams
+		}
+	} else if p.CredentialParamsHash != (util.HashValue{}) {
+		return ErrInvalidCredentialParams
+	}
+	if p.Trustees != nil {
+		if p.Version < ParamsVersion5 || (p.Trustees.HybridKeys != nil && p.Version < ParamsVersion13) {
+			return errUnknownVersion
+		}
+		return p.Trustees.Validate()
+	}
+	return nil
+}
+
+// Returns the canonical bytes covered by the organizer signature,
+// that is the serialized params without the signature itself.
+func (p *ElectionParams) SigningBytes() []byte {
+	return util.Concat([]byte(paramsSignatureContext), p.encode(false))
+}
+
+/*
+Upgrades the params to at least the given version, keeping their meaning.
+Upgraded version 0 params keep registration open for the whole CredGen phase.
+*/
+func (p *ElectionParams) Upgrade(version uint32) {
+	if p.Version >= version {
+		return
+	}
+	if p.Version < ParamsVersion1 {
+		p.CredGenStart = time.Time{}
+		p.RegistrationEnd = p.CastStart
+	}
+	p.Version = version
+}
+
+// Signs the params with the organizer key, upgrading them to version 2 if needed.
+func (p *ElectionParams) Sign(k pubkey.PrivateKey) error {
+	p.Upgrade(ParamsVersion2)
+	p.Organizer = k.Public()
+	sig, err := k.Sign(p.SigningBytes())
+	if err != nil {
+		return err
+	}
+	p.Signature = sig
+	return nil
+}
+
+// Verifies the organizer signature. Params older than version 2 carry no signature.
+func (p *ElectionParams) VerifySignature() error {
+	if p.Version < ParamsVersion2 {
+		return nil
+	}
+	if p.Organizer.Verify(p.SigningBytes(), p.Signature) != nil {
+		return ErrInvalidParamsSignature
+	}
+	return nil
+}
+
+// Verifies that the params were signed by the given organizer.
+// An empty organizer key only checks the signature, if any.
+func (p *ElectionParams) VerifyOrganizer(organizer pubkey.PublicKey) error {
+	if len(organizer) == 0 {
+		return p.VerifySignature()
+	}
+	if p.Version < ParamsVersion2 {
+		return ErrUnsignedParams
+	}
+	if !bytes.Equal(p.Organizer, organizer) {
+		return ErrOrganizerMismatch
+	}
+	return p.VerifySignature()
+}
+
 /*
 Serializes the ElectionParams struct into a byte slice.
 Uses a BufferWriter from the util package to write each field in a specific order.
-Converts time values to Unix timestamps and writes them as uint64.
+Converts time values to Unix timestamps and writes them as uint64, or as varints from version 6.
 Writes other fields as vectors of bytes.
 Returns the serialized byte slice.
 */
 func (p *ElectionParams) Bytes() []byte {
-	var w util.BufferWriter
+	return p.encode(true)
+}
+
+// Returns the maximum number of contests, or of choices of a contest, for the params version.
+func (p *ElectionParams) countLimit() int {
+	if p.Version < ParamsVersion6 {
+		return legacyMaxCount
+	}
+	return maxCount
+}
+
+// Reports whether all variable-length fields fit the vector encoding used before version 6.
+func (p *ElectionParams) fitsLegacyVectors() bool {
+	fields := [][]byte{[]byte(p.VotingMethod), []byte(p.Title), []byte(p.Description), p.MethodParams, p.Organizer, p.Signature}
+	for _, c := range p.Choices {
+		fields = append(fields, []byte(c))
+	}
+	for _, c := range p.Contests {
+		fields = append(fields, []byte(c.Title), []byte(c.VotingMethod), c.MethodParams)
+		for _, choice := range c.Choices {
+			fields = append(fields, []byte(choice))
+		}
+	}
+	if p.Trustees != nil {
+		fields = append(fields, p.Trustees.Bytes())
+	}
+	for _, f := range fields {
+		if len(f) > legacyMaxVector {
+			return false
+		}
+	}
+	return true
+}
+
+// Upgrades the params to version 6 if their contests, choices or fields exceed the limits of earlier versions.
+func (p *ElectionParams) UpgradeForSize() {
+	if p.Version >= ParamsVersion6 {
+		return
+	}
+	tooMany := len(p.Contests) > legacyMaxCount
+	for _, c := range p.ContestList() {
+		tooMany = tooMany || len(c.Choices) > legacyMaxCount
+	}
+	if tooMany || !p.fitsLegacyVectors() {
+		p.Upgrade(ParamsVersion6)
+	}
+}
+
+// Writes params fields with the encoding of the params version.
+type paramsWriter struct {
+	util.BufferWriter
+	legacy bool
+}
+
+func (w *paramsWriter) uint(n uint64) {
+	if w.legacy {
+		w.WriteUint64(n)
+	} else {
+		w.WriteUvarint(n)
+	}
+}
+
+func (w *paramsWriter) count(n int) {
+	if w.legacy {
+		w.WriteByte(byte(n))
+	} else {
+		w.WriteUvarint(uint64(n))
+	}
+}
+
+func (w *paramsWriter) vector(p []byte) {
+	if w.legacy {
+		w.WriteVector(p)
+	} else {
+		w.WriteVarVector(p)
+	}
+}
+
+// Reads params fields with the encoding of the params version.
+type paramsReader struct {
+	*util.BufferReader
+	legacy bool
+}
+
+func (r paramsReader) uint() (uint64, error) {
+	if r.legacy {
+		return r.ReadUint64()
+	}
+	return r.ReadUvarint()
+}
+
+func (r paramsReader) time() (time.Time, error) {
+	t, err := r.uint()
+	return time.Unix(int64(t), 0), err
+}
+
+// Reads a count of items, each taking at least one byte.
+func (r paramsReader) count() (int, error) {
+	if !r.legacy {
+		return r.ReadCount(maxCount, 1)
+	}
+	n, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if !r.Holds(int(n), 1) {
+		return 0, util.ErrTooLarge
+	}
+	return int(n), nil
+}
+
+func (r paramsReader) vector() ([]byte, error) {
+	if r.legacy {
+		return r.ReadVector()
+	}
+	return r.ReadVarVector(maxVector)
+}
+
+func (r paramsReader) strings() ([]string, error) {
+	n, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, n)
+	for i := range res {
+		b, err := r.vector()
+		if err != nil {
+			return nil, err
+		}
+		res[i] = string(b)
+	}
+	return res, nil
+}
+
+func (p *ElectionParams) encode(withSignature bool) []byte {
+	w := paramsWriter{legacy: p.Version < ParamsVersion6}
 	w.WriteUint32(p.Version)
-	w.WriteUint64(uint64(p.CastStart.Unix()))
-	w.WriteUint64(uint64(p.TallyStart.Unix()))
-	w.WriteUint64(uint64(p.TallyEnd.Unix()))
-	w.WriteUint64(p.MaxVdfDifficulty)
-	w.WriteVector([]byte(p.VotingMethod))
-	w.WriteVector([]byte(p.Title))
-	w.WriteVector([]byte(p.Description))
-	w.WriteByte(byte(len(p.Choices)))
+	if p.Version >= ParamsVersion1 {
+		w.uint(uint64(p.CredGenStart.Unix()))
+		w.uint(uint64(p.RegistrationEnd.Unix()))
+	}
+	w.uint(uint64(p.CastStart.Unix()))
+	w.uint(uint64(p.TallyStart.Unix()))
+	w.uint(uint64(p.TallyEnd.Unix()))
+	w.uint(p.MaxVdfDifficulty)
+	w.vector([]byte(p.VotingMethod))
+	w.vector([]byte(p.Title))
+	w.vector([]byte(p.Description))
+	w.count(len(p.Choices))
 	for _, c := range p.Choices {
-		w.WriteVector([]byte(c))
+		w.vector([]byte(c))
+	}
+	if p.Version >= ParamsVersion4 {
+		w.vector(p.MethodParams)
+	}
+	if p.Version >= ParamsVersion3 {
+		w.count(len(p.Contests))
+		for _, c := range p.Contests {
+			w.vector([]byte(c.Title))
+			w.vector([]byte(c.VotingMethod))
+			if p.Version >= ParamsVersion4 {
+				w.vector(c.MethodParams)
+			}
+			w.count(len(c.Choices))
+			for _, choice := range c.Choices {
+				w.vector([]byte(choice))
+			}
+		}
+	}
+	if p.Version >= ParamsVersion5 {
+		if p.Trustees != nil {
+			w.vector(p.Trustees.Bytes())
+		} else {
+			w.vector(nil)
+		}
+	}
+	if p.Version >= ParamsVersion7 {
+		w.WriteByte(byte(p.HashAlgorithm))
+	}
+	if p.Version >= ParamsVersion9 {
+		w.WriteByte(p.PowDifficulty)
+	}
+	if p.Version >= ParamsVersion10 {
+		w.vector([]byte(p.CredentialParamsURL))
+		w.Write32(p.CredentialParamsHash)
+	}
+	if p.Version >= ParamsVersion12 {
+		w.WriteByte(byte(p.CipherSuite))
+	}
+	if p.Version >= ParamsVersion14 {
+		w.uint(p.MinVdfDifficulty)
+	}
+	if p.Version >= ParamsVersion15 {
+		w.translations(p.Translations)
+	}
+	if p.Version >= ParamsVersion16 {
+		w.Write32(p.ChoiceOrderSeed)
+	}
+	if p.Version >= ParamsVersion17 {
+		if p.Organizers != nil {
+			w.vector(p.Organizers.Bytes())
+		} else {
+			w.vector(nil)
+		}
+	}
+	if p.Version >= ParamsVersion2 {
+		w.vector(p.Organizer)
+		if withSignature {
+			w.vector(p.Signature)
+		}
 	}
 	w.Write(p.EligibilityList.Bytes())
 	return w.Buffer
@@ -83,64 +619,201 @@ Converts Unix timestamps back to time values.
 Returns an error if any reading or conversion fails.
 */
 func (p *ElectionParams) FromBytes(b []byte) (err error) {
-	r := util.NewBufferReader(b)
-	p.Version, err = r.ReadUint32()
+	if len(b) > maxParamsSize {
+		return util.ErrTooLarge
+	}
+	br := util.NewBufferReader(b)
+	p.Version, err = br.ReadUint32()
 	if err != nil {
 		return err
 	}
-	if p.Version != 0 {
+	if p.Version > latestParamsVersion {
 		return errUnknownVersion
 	}
-	if err != nil {
-		return err
+	r := paramsReader{br, p.Version < ParamsVersion6}
+	if p.Version >= ParamsVersion1 {
+		p.CredGenStart, err = r.time()
+		if err != nil {
+			return err
+		}
+		p.RegistrationEnd, err = r.time()
+		if err != nil {
+			return err
+		}
 	}
-	t, err := r.ReadUint64()
+	p.CastStart, err = r.time()
 	if err != nil {
 		return err
 	}
-	p.CastStart = time.Unix(int64(t), 0)
-	t, err = r.ReadUint64()
+	p.TallyStart, err = r.time()
 	if err != nil {
 		return err
 	}
-	p.TallyStart = time.Unix(int64(t), 0)
-	t, err = r.ReadUint64()
+	p.TallyEnd, err = r.time()
 	if err != nil {
 		return err
 	}
-	p.TallyEnd = time.Unix(int64(t), 0)
-	p.MaxVdfDifficulty, err = r.ReadUint64()
+	p.MaxVdfDifficulty, err = r.uint()
 	if err != nil {
 		return err
 	}
-	b, err = r.ReadVector()
+	b, err = r.vector()
 	if err != nil {
 		return err
 	}
 	p.VotingMethod = string(b)
-	b, err = r.ReadVector()
+	b, err = r.vector()
 	if err != nil {
 		return err
 	}
 	p.Title = string(b)
-	b, err = r.ReadVector()
+	b, err = r.vector()
 	if err != nil {
 		return err
 	}
 	p.Description = string(b)
-	numChoices, err := r.ReadByte()
+	p.Choices, err = r.strings()
 	if err != nil {
 		return err
 	}
-	p.Choices = make([]string, numChoices)
-	for i := range p.Choices {
-		b, err = r.ReadVector()
+	if p.Version >= ParamsVersion4 {
+		p.MethodParams, err = r.vector()
+		if err != nil {
+			return err
+		}
+	}
+	if p.Version >= ParamsVersion3 {
+		p.Contests, err = readContests(r, p.Version)
+		if err != nil {
+			return err
+		}
+	}
+	p.Trustees = nil
+	if p.Version >= ParamsVersion5 {
+		b, err = r.vector()
+		if err != nil {
+			return err
+		}
+		if len(b) != 0 {
+			p.Trustees = new(trustee.KeySet)
+			err = p.Trustees.FromBytes(b)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	p.HashAlgorithm = util.SHA256
+	if p.Version >= ParamsVersion7 {
+		alg, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		p.HashAlgorithm = util.HashAlgorithm(alg)
+	}
+	p.PowDifficulty = 0
+	if p.Version >= ParamsVersion9 {
+		p.PowDifficulty, err = r.ReadByte()
+		if err != nil {
+			return err
+		}
+	}
+	p.CredentialParamsURL, p.CredentialParamsHash = "", util.HashValue{}
+	if p.Version >= ParamsVersion10 {
+		b, err = r.vector()
+		if err != nil {
+			return err
+		}
+		p.CredentialParamsURL = string(b)
+		p.CredentialParamsHash, err = r.Read32()
+		if err != nil {
+			return err
+		}
+	}
+	p.CipherSuite = structs.SuiteAESGCM
+	if p.Version >= ParamsVersion12 {
+		suite, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		p.CipherSuite = structs.CipherSuite(suite)
+	}
+	p.MinVdfDifficulty = 0
+	if p.Version >= ParamsVersion14 {
+		p.MinVdfDifficulty, err = r.uint()
+		if err != nil {
+			return err
+		}
+	}
+	p.Translations = nil
+	if p.Version >= ParamsVersion15 {
+		p.Translations, err = r.translations()
+		if err != nil {
+			return err
+		}
+	}
+	p.ChoiceOrderSeed = util.HashValue{}
+	if p.Version >= ParamsVersion16 {
+		p.ChoiceOrderSeed, err = r.Read32()
+		if err != nil {
+			return err
+		}
+	}
+	p.Organizers = nil
+	if p.Version >= ParamsVersion17 {
+		b, err = r.vector()
+		if err != nil {
+			return err
+		}
+		if len(b) != 0 {
+			p.Organizers = new(OrganizerSet)
+			err = p.Organizers.FromBytes(b)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if p.Version >= ParamsVersion2 {
+		p.Organizer, err = r.vector()
+		if err != nil {
+			return err
+		}
+		p.Signature, err = r.vector()
 		if err != nil {
 			return err
 		}
-		p.Choices[i] = string(b)
 	}
 	p.EligibilityList = structs.NewEligibilityList()
 	err = p.EligibilityList.FromBytes(r.ReadRemaining())
 	return err
 }
+
+func readContests(r paramsReader, version uint32) ([]Contest, error) {
+	numContests, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	contests := make([]Contest, numContests)
+	for i := range contests {
+		b, err := r.vector()
+		if err != nil {
+			return nil, err
+		}
+		contests[i].Title = string(b)
+		b, err = r.vector()
+		if err != nil {
+			return nil, err
+		}
+		contests[i].VotingMethod = string(b)
+		if version >= ParamsVersion4 {
+			contests[i].MethodParams, err = r.vector()
+			if err != nil {
+				return nil, err
+			}
+		}
+		contests[i].Choices, err = r.strings()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return contests, nil
+}
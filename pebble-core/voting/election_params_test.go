@@ -0,0 +1,446 @@
+package voting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/vdf"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+// Builds a version 1 ElectionParams with a registration window before the cast phase.
+func generateParamsV1() *ElectionParams {
+	now := time.Unix(time.Now().Unix(), 0)
+	return &ElectionParams{
+		Version:         ParamsVersion1,
+		CredGenStart:    now.Add(-time.Minute),
+		RegistrationEnd: now.Add(time.Minute),
+		CastStart:       now.Add(2 * time.Minute),
+		TallyStart:      now.Add(3 * time.Minute),
+		TallyEnd:        now.Add(4 * time.Minute),
+		VotingMethod:    "Plurality",
+		Title:           "Title",
+		Choices:         []string{"A", "B"},
+		EligibilityList: structs.NewEligibilityList(),
+	}
+}
+
+func TestElectionParamsRoundTrip(t *testing.T) {
+	params := generateParamsV1()
+	var decoded ElectionParams
+	err := decoded.FromBytes(params.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.CredGenStart.Equal(params.CredGenStart) || !decoded.RegistrationEnd.Equal(params.RegistrationEnd) {
+		t.Error("registration window not preserved")
+	}
+	if !bytes.Equal(decoded.Bytes(), params.Bytes()) {
+		t.Error("re-encoded params differ from original")
+	}
+}
+
+func TestElectionParamsRegistrationWindow(t *testing.T) {
+	params := generateParamsV1()
+	if err := params.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if params.Phase() != CredGen || !params.RegistrationOpen() {
+		t.Error("registration should be open")
+	}
+	params.RegistrationEnd = params.CredGenStart
+	if params.RegistrationOpen() {
+		t.Error("registration should be closed")
+	}
+	params.CredGenStart = params.CastStart.Add(time.Second)
+	if params.Validate() != ErrInvalidSchedule {
+		t.Error("expected invalid schedule")
+	}
+	params.CredGenStart = time.Now().Add(time.Minute)
+	params.RegistrationEnd = params.CredGenStart
+	if params.Phase() != Setup {
+		t.Error("expected Setup phase before CredGenStart")
+	}
+}
+
+func TestElectionParamsSignature(t *testing.T) {
+	organizer, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := generateParamsV1()
+	err = params.Sign(organizer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ElectionParams
+	err = decoded.FromBytes(params.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = decoded.VerifyOrganizer(organizer.Public()); err != nil {
+		t.Fatal(err)
+	}
+	other, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.VerifyOrganizer(other.Public()) != ErrOrganizerMismatch {
+		t.Error("expected organizer mismatch")
+	}
+	decoded.Title = "Altered"
+	if decoded.VerifySignature() != ErrInvalidParamsSignature {
+		t.Error("expected invalid signature for altered params")
+	}
+	// Version 0 params keep registration open until voting starts
+	v0 := generateParamsV1()
+	v0.Version = ParamsVersion0
+	v0.CredGenStart, v0.RegistrationEnd = time.Time{}, time.Time{}
+	if err = v0.Sign(organizer); err != nil {
+		t.Fatal(err)
+	}
+	if err = decoded.FromBytes(v0.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Validate() != nil || decoded.Phase() != CredGen || !decoded.RegistrationOpen() {
+		t.Error("registration closed in signed version 0 params")
+	}
+}
+
+func TestElectionParamsVarintEncoding(t *testing.T) {
+	params := generateParamsV1()
+	params.Description = strings.Repeat("d", 0x8000)
+	params.Choices = make([]string, 300)
+	for i := range params.Choices {
+		params.Choices[i] = strconv.Itoa(i)
+	}
+	if params.Validate() != ErrInvalidContests {
+		t.Error("300 choices accepted before version 6")
+	}
+	params.UpgradeForSize()
+	if params.Version != ParamsVersion6 {
+		t.Fatal("params not upgraded")
+	}
+	if err := params.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	var decoded ElectionParams
+	if err := decoded.FromBytes(params.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Choices) != 300 || decoded.Choices[299] != "299" || decoded.Description != params.Description {
+		t.Error("varint params not preserved")
+	}
+	if !decoded.TallyEnd.Equal(params.TallyEnd) {
+		t.Error("timestamps not preserved")
+	}
+	if !bytes.Equal(decoded.Bytes(), params.Bytes()) {
+		t.Error("re-encoded params differ from original")
+	}
+	// Small params stay on their version
+	small := generateParamsV1()
+	small.UpgradeForSize()
+	if small.Version != ParamsVersion1 {
+		t.Error("small params upgraded")
+	}
+	small.Description = params.Description
+	if small.Validate() != ErrParamsTooLarge {
+		t.Error("oversized description accepted before version 6")
+	}
+}
+
+func TestElectionParamsHashAlgorithm(t *testing.T) {
+	params := generateParamsV1()
+	if params.HashScheme() != util.LegacyHashScheme {
+		t.Error("legacy params not hashed with the legacy scheme")
+	}
+	legacy := params.Hash()
+	params.Version = ParamsVersion7
+	params.HashAlgorithm = util.BLAKE3
+	if err := params.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	var decoded ElectionParams
+	if err := decoded.FromBytes(params.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.HashAlgorithm != util.BLAKE3 || decoded.HashScheme() != (util.HashScheme{Algorithm: util.BLAKE3, Separated: true}) {
+		t.Error("hash algorithm not preserved")
+	}
+	if decoded.Hash() == legacy {
+		t.Error("params hash does not depend on the scheme")
+	}
+	params.HashAlgorithm = 0xFF
+	if params.Validate() != util.ErrUnknownHashAlgorithm {
+		t.Error("unknown hash algorithm accepted")
+	}
+}
+
+func TestElectionParamsCredentialParams(t *testing.T) {
+	params := generateParamsV1()
+	params.CredentialParamsURL = "https://pebble.example.org/anoncred1-params.bin"
+	params.CredentialParamsHash = util.Hash([]byte("params"))
+	if params.Validate() != ErrInvalidCredentialParams {
+		t.Error("credential params reference accepted before version 10")
+	}
+	params.Upgrade(ParamsVersion10)
+	if err := params.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	var decoded ElectionParams
+	if err := decoded.FromBytes(params.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.CredentialParamsURL != params.CredentialParamsURL || decoded.CredentialParamsHash != params.CredentialParamsHash {
+		t.Error("credential params reference not preserved")
+	}
+	params.CredentialParamsURL = "file:///etc/passwd"
+	if params.Validate() != ErrInvalidCredentialParams {
+		t.Error("non-HTTP credential params URL accepted")
+	}
+}
+
+func TestElectionParamsCipherSuite(t *testing.T) {
+	params := generateParamsV1()
+	params.CipherSuite = structs.SuiteXChaCha20Poly1305
+	if params.Validate() != errUnknownVersion {
+		t.Error("cipher suite accepted before version 12")
+	}
+	params.Upgrade(ParamsVersion12)
+	if err := params.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	var decoded ElectionParams
+	if err := decoded.FromBytes(params.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.CipherSuite != structs.SuiteXChaCha20Poly1305 {
+		t.Error("cipher suite not preserved")
+	}
+	params.CipherSuite = 0xFF
+	if params.Validate() != structs.ErrUnknownCipherSuite {
+		t.Error("unknown cipher suite accepted")
+	}
+}
+
+func TestElectionParamsVdfDifficulty(t *testing.T) {
+	params := generateParamsV1()
+	params.MaxVdfDifficulty = 1000
+	params.MinVdfDifficulty = 200
+	if params.Validate() != ErrInvalidVdfDifficulty {
+		t.Error("minimum VDF difficulty accepted before version 14")
+	}
+	params.Upgrade(ParamsVersion14)
+	if err := params.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	var decoded ElectionParams
+	if err := decoded.FromBytes(params.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.MinVdfDifficulty != 200 {
+		t.Error("minimum VDF difficulty not preserved")
+	}
+	// Ballots declare their difficulty, checked against the bounds of the params
+	e := Election{params: params, vdf: newVdf(params)}
+	for _, d := range []uint64{100, 200, 1000, 1002} {
+		e.vdfDifficulty = d
+		sol, err := e.createPuzzle(context.Background())
+		valid := d >= 200 && d <= 1000
+		if (err == nil) != valid {
+			t.Errorf("difficulty %d: %v", d, err)
+		}
+		if err == nil && !e.vdfDifficultyValid(sol.Input) {
+			t.Errorf("difficulty %d not valid", d)
+		}
+	}
+	strict := *params
+	strict.MinVdfDifficulty = 400
+	sol, _ := e.vdf.(*vdf.PietrzakVdf).CreateWithDifficulty(200)
+	if (&Election{params: &strict, vdf: newVdf(&strict)}).vdfDifficultyValid(sol.Input) {
+		t.Error("difficulty below the minimum valid")
+	}
+	params.MinVdfDifficulty = 2000
+	if params.Validate() != ErrInvalidVdfDifficulty {
+		t.Error("minimum above the maximum accepted")
+	}
+}
+
+func TestElectionParamsTranslations(t *testing.T) {
+	params := generateParamsV1()
+	params.Translations = []Translation{
+		{Language: "fr", Title: "Titre", Choices: []string{"", "Bé"}},
+		{Language: "pt-BR", Description: "Descrição"},
+	}
+	if params.Validate() != errUnknownVersion {
+		t.Error("translations accepted before version 15")
+	}
+	params.Upgrade(ParamsVersion15)
+	if err := params.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	var decoded ElectionParams
+	if err := decoded.FromBytes(params.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Translations) != 2 || decoded.Translations[0].Choices[1] != "Bé" || decoded.Translations[1].Language != "pt-BR" {
+		t.Fatalf("translations %+v", decoded.Translations)
+	}
+	for prefs, want := range map[string]string{"fr-CA": "fr", "pt": "pt-BR", "de,FR": "fr", "de": "", "": ""} {
+		tr := params.Translation(strings.Split(prefs, ",")...)
+		if (tr == nil && want != "") || (tr != nil && tr.Language != want) {
+			t.Errorf("%q: translation %+v", prefs, tr)
+		}
+	}
+	fr := params.Localized("fr")
+	if fr.Title != "Titre" || fr.Choices[0] != "A" || fr.Choices[1] != "Bé" || params.Title != "Title" {
+		t.Errorf("localized %q %v", fr.Title, fr.Choices)
+	}
+	params.Translations = append(params.Translations, Translation{Language: "FR"})
+	if params.Validate() != ErrInvalidTranslation {
+		t.Error("duplicate language accepted")
+	}
+	params.Translations = []Translation{{Language: "fr", Choices: []string{"A", "B", "C"}}}
+	if params.Validate() != ErrInvalidTranslation {
+		t.Error("extra choices accepted")
+	}
+	params.Translations = []Translation{{Language: "1fr"}}
+	if params.Validate() != ErrInvalidTranslation {
+		t.Error("invalid language tag accepted")
+	}
+}
+
+func TestChoiceOrder(t *testing.T) {
+	params := generateParamsV1()
+	params.Choices = []string{"A", "B", "C", "D", "E", "F", "G", "H"}
+	if order := params.ChoiceOrder([]byte("serial"), 0); !sort.IntsAreSorted(order) || len(order) != 8 {
+		t.Errorf("order without seed %v", order)
+	}
+	params.ChoiceOrderSeed = util.HashValue{1}
+	if params.Validate() != errUnknownVersion {
+		t.Error("choice order seed accepted before version 16")
+	}
+	params.Upgrade(ParamsVersion16)
+	var decoded ElectionParams
+	if err := decoded.FromBytes(params.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ChoiceOrderSeed != params.ChoiceOrderSeed {
+		t.Error("choice order seed not preserved")
+	}
+	orders := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		serial := []byte{byte(i)}
+		order := params.ChoiceOrder(serial, 0)
+		if fmt.Sprint(order) != fmt.Sprint(decoded.ChoiceOrder(serial, 0)) {
+			t.Fatal("order not deterministic")
+		}
+		sorted := append([]int{}, order...)
+		sort.Ints(sorted)
+		if fmt.Sprint(sorted) != "[0 1 2 3 4 5 6 7]" {
+			t.Fatalf("order %v is not a permutation", order)
+		}
+		orders[fmt.Sprint(order)] = true
+	}
+	if len(orders) < 15 {
+		t.Errorf("%d distinct orders for 20 voters", len(orders))
+	}
+	if params.ChoiceOrder(nil, 1) != nil {
+		t.Error("order of a missing contest")
+	}
+}
+
+func TestPhaseCountdown(t *testing.T) {
+	params := generateParamsV1()
+	now := params.CredGenStart.Add(30 * time.Second)
+	c := params.CountdownAt(now)
+	if c.Phase != CredGen || c.Next != Cast || !c.Deadline.Equal(params.CastStart) || c.Remaining != params.CastStart.Sub(now) {
+		t.Errorf("unexpected countdown %+v", c)
+	}
+	if !c.RegistrationOpen || c.RegistrationRemaining != params.RegistrationEnd.Sub(now) {
+		t.Error("registration window not reported")
+	}
+	p, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded PhaseCountdown
+	if err = json.Unmarshal(p, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != c {
+		t.Errorf("countdown not preserved: %s", p)
+	}
+	c = params.CountdownAt(params.RegistrationEnd)
+	if c.Phase != CredGen || c.RegistrationOpen || c.RegistrationRemaining != 0 {
+		t.Error("registration should be closed")
+	}
+	c = params.CountdownAt(params.TallyEnd)
+	if c.Phase != End || c.Next != End || c.Remaining != 0 || !c.Deadline.IsZero() {
+		t.Errorf("unexpected countdown after the end %+v", c)
+	}
+}
+
+func TestPhaseStart(t *testing.T) {
+	params := generateParamsV1()
+	for ph := CredGen; ph <= End; ph++ {
+		if got := params.PhaseAt(params.PhaseStart(ph)); got != ph {
+			t.Errorf("%v starts in %v", ph, got)
+		}
+		if name, _ := ParsePhase(ph.String()); name != ph {
+			t.Errorf("%v not parsed", ph)
+		}
+	}
+}
+
+func TestElectionIdFromParams(t *testing.T) {
+	ctx := context.Background()
+	k, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := generateParamsV1()
+	params.Upgrade(ParamsVersion11)
+	if err = params.Sign(k); err != nil {
+		t.Fatal(err)
+	}
+	// Other checks may fail past the ID, without credential system parameters in the test directory
+	id := params.ElectionId(ServerNetwork)
+	if _, err = NewElection(ctx, NewMockBroadcastChannel(id, params), nil); err == ErrElectionIdMismatch {
+		t.Error("derived ID rejected")
+	}
+	// The same params on another network have another ID
+	transcript := NewTranscriptChannel(id, params, nil)
+	transcript.network = "other"
+	if _, err = NewElection(ctx, transcript, nil); err != ErrElectionIdMismatch {
+		t.Errorf("ID of another network accepted: %v", err)
+	}
+	if _, err = NewElection(ctx, NewMockBroadcastChannel(ElectionID{1}, params), nil); err != ErrElectionIdMismatch {
+		t.Errorf("channel ID accepted: %v", err)
+	}
+	amended := *params
+	amended.Title = "Other"
+	if amended.ElectionId(ServerNetwork) == id {
+		t.Error("ID independent of the params")
+	}
+	// Older elections keep the ID of their channel
+	params.Version = ParamsVersion10
+	if err = params.Sign(k); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewElection(ctx, NewMockBroadcastChannel(ElectionID{1}, params), nil); err == ErrElectionIdMismatch {
+		t.Error("ID of version 10 params checked")
+	}
+	if _, err = NewElection(ctx, NewMockBroadcastChannel(ElectionID{1}, params), nil, RequireDerivedId()); err != ErrElectionIdMismatch {
+		t.Errorf("version 10 params accepted for a derived ID: %v", err)
+	}
+}
@@ -2,26 +2,30 @@ package voting
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/timesource"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/vdf"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/methods"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/secrets"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
 )
 
 // This is a mock implementation of the SecretsManager interface.
-// It stores the private key, secret credential, signed ballot, and VDF solution.
+// It stores the private key, secret credential, ballot history, and VDF solution.
 // It implements the methods required by the SecretsManager interface.
 type mockSecretsManager struct {
 	privateKey       pubkey.PrivateKey
 	secretCredential anoncred.SecretCredential
-	ballot           structs.SignedBallot
+	ballots          []secrets.BallotRecord
 	solution         vdf.VdfSolution
 }
 
@@ -33,20 +37,33 @@ func (sm *mockSecretsManager) GetSecretCredential(sys anoncred.CredentialSystem)
 	return sm.secretCredential, nil
 }
 
-func (sm *mockSecretsManager) GetBallot() (structs.SignedBallot, error) {
-	return sm.ballot, nil
+func (sm *mockSecretsManager) SetSecretCredential(sec anoncred.SecretCredential) error {
+	sm.secretCredential = sec
+	return nil
+}
+
+func (sm *mockSecretsManager) GetBallot(electionId [32]byte) (structs.SignedBallot, error) {
+	rs := secrets.ElectionBallots(sm.ballots, electionId)
+	if len(rs) == 0 {
+		return structs.SignedBallot{}, secrets.ErrNoBallot
+	}
+	return rs[len(rs)-1].Ballot, nil
 }
 
-func (sm *mockSecretsManager) SetBallot(ballot structs.SignedBallot) error {
-	sm.ballot = ballot
+func (sm *mockSecretsManager) AddBallot(r secrets.BallotRecord) error {
+	sm.ballots = append(sm.ballots, r)
 	return nil
 }
 
-func (sm *mockSecretsManager) GetVdfSolution() (vdf.VdfSolution, error) {
+func (sm *mockSecretsManager) GetBallots() ([]secrets.BallotRecord, error) {
+	return sm.ballots, nil
+}
+
+func (sm *mockSecretsManager) GetVdfSolution(electionId [32]byte, serialNo []byte) (vdf.VdfSolution, error) {
 	return sm.solution, nil
 }
 
-func (sm *mockSecretsManager) SetVdfSolution(sol vdf.VdfSolution) error {
+func (sm *mockSecretsManager) SetVdfSolution(electionId [32]byte, serialNo []byte, sol vdf.VdfSolution) error {
 	sm.solution = sol
 	return nil
 }
@@ -145,7 +162,7 @@ func TestElection(t *testing.T) {
 	// A mock secrets manager (mockSecretsManager) is created.
 	secretsManager := new(mockSecretsManager)
 	// A mock broadcast channel (MockBroadcastChannel)is created.
-	broadcast := new(MockBroadcastChannel)
+	broadcast := NewMockBroadcastChannel(ElectionID{}, nil)
 	// An Election instance is initialized with the previously generated components.
 	var election Election
 	broadcast.params = &electionParams
@@ -153,7 +170,10 @@ func TestElection(t *testing.T) {
 	election.channel = broadcast
 	election.secrets = secretsManager
 	election.vdf = &vdf.PietrzakVdf{MaxDifficulty: 1000000, DifficultyConversion: 10000}
-	election.method = &methods.PluralityVoting{}
+	election.method, err = methods.Get(electionParams.VotingMethod, len(electionParams.Choices), electionParams.MethodParams)
+	if err != nil {
+		t.Fatal(err)
+	}
 	election.params = &electionParams
 	secretCredentials, err := generateSecretCredentials(credSys, len(privateKeys))
 	if err != nil {
@@ -189,6 +209,10 @@ func TestElection(t *testing.T) {
 		t.Log(err)
 		t.FailNow()
 	}
+	// The ballot is on the channel, so voting again is refused.
+	if err = election.Vote(ctx, 0); err != ErrAlreadyVoted {
+		t.Errorf("second vote: %v", err)
+	}
 	// The test waits until the current time reaches the tally phase start time specified in the election parameters.
 	for time.Now().Before(electionParams.TallyStart) {
 		time.Sleep(time.Second)
@@ -207,11 +231,334 @@ func TestElection(t *testing.T) {
 	}
 	fmt.Println("Progressing...")
 	// Once the tally phase ends, the test retrieves the election progress using the Progress method of the Election instance.
-	_, err = election.Progress(ctx)
+	progress, err := election.Progress(ctx)
 	// The election progress includes the current phase, the count of valid ballots, the total number of participants, and the tally results.
 	if err != nil {
 		t.Log(err)
 		t.FailNow()
 	}
+	// The ballot is counted, the voter and the tally building the same credential set.
+	if progress.Count != 1 || len(progress.Rejected) != 0 {
+		t.Errorf("ballot not counted: %+v", progress)
+	}
 	fmt.Println("Done!")
 }
+
+func TestRotateCredential(t *testing.T) {
+	ctx := context.Background()
+	credSys := new(anoncred.AnonCred1)
+	if err := credSys.SetupCircuit(2); err != nil {
+		t.Fatal(err)
+	}
+	privateKeys, err := generatePrivateKeys(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	electionParams := generateElectionParams(generateEligibilityList(privateKeys))
+	secretsManager := new(mockSecretsManager)
+	broadcast := NewMockBroadcastChannel(ElectionID{}, &electionParams)
+	clock := timesource.NewShifted(timesource.System{})
+	election := Election{
+		credSys: credSys,
+		channel: broadcast,
+		secrets: secretsManager,
+		params:  &electionParams,
+		clock:   clock,
+	}
+	for _, k := range privateKeys {
+		secretsManager.privateKey = k
+		secretsManager.secretCredential, err = credSys.GenerateSecretCredential()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = election.PostCredential(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := secretsManager.secretCredential
+	if err = election.RotateCredential(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Rotating again moves on to the next epoch
+	if err = election.RotateCredential(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if epoch, _ := election.credentialEpoch(ctx, privateKeys[1].Public()); epoch != 2 {
+		t.Errorf("credential epoch %d after two rotations", epoch)
+	}
+	oldPub, err := old.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := &structs.CredentialMessage{Credential: oldPub.Bytes(), Epoch: 1}
+	if err = stale.Sign(privateKeys[1], election.Id()); err != nil {
+		t.Fatal(err)
+	}
+	if err = broadcast.Post(ctx, Message{Credential: stale}); err != ErrStaleCredential {
+		t.Errorf("registration of a replaced epoch: %v", err)
+	}
+	// A rotation that cannot be posted keeps the registered credential
+	current := secretsManager.secretCredential
+	offline := errors.New("offline")
+	election.channel = offlineChannel{broadcast, offline}
+	if err = election.RotateCredential(ctx); err != offline {
+		t.Errorf("rotation while offline: %v", err)
+	}
+	if secretsManager.secretCredential != current {
+		t.Error("credential replaced by a rotation that was not posted")
+	}
+	election.channel = broadcast
+	clock.AdvanceTo(electionParams.CastStart)
+	if err = election.RotateCredential(ctx); err != ErrWrongPhase {
+		t.Errorf("rotation after registration: %v", err)
+	}
+	set, err := election.GetCredentialSet(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Len() != 2 {
+		t.Fatalf("%d credentials in the set", set.Len())
+	}
+	if _, err = set.Sign(old, []byte("ballot")); err == nil {
+		t.Error("replaced credential still in the set")
+	}
+	if _, err = set.Sign(secretsManager.secretCredential, []byte("ballot")); err != nil {
+		t.Error(err)
+	}
+}
+
+// A channel failing to post messages.
+type offlineChannel struct {
+	*MockBroadcastChannel
+	err error
+}
+
+func (c offlineChannel) Post(ctx context.Context, m Message) error {
+	return c.err
+}
+
+type recordingInstrumentation struct {
+	mu       sync.Mutex
+	ops      []string
+	counters map[string]int64
+	records  map[string]int
+}
+
+func (r *recordingInstrumentation) Start(ctx context.Context, op string) (context.Context, func(error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops = append(r.ops, op)
+	return ctx, func(error) {}
+}
+
+func (r *recordingInstrumentation) Add(ctx context.Context, counter string, n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters[counter] += n
+}
+
+func (r *recordingInstrumentation) Record(ctx context.Context, histogram string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[histogram]++
+}
+
+type stubVdf struct{}
+
+func (stubVdf) Create(seconds uint64) (vdf.VdfSolution, error) { return vdf.VdfSolution{}, nil }
+
+func (stubVdf) Solve(input []byte) (vdf.VdfSolution, error) {
+	return vdf.VdfSolution{Input: input}, nil
+}
+
+func (stubVdf) Verify(sol vdf.VdfSolution) error { return nil }
+
+func TestInstrumentation(t *testing.T) {
+	ctx := context.Background()
+	e := &Election{vdf: stubVdf{}}
+	if _, ok := e.timedVdf(ctx).(stubVdf); !ok {
+		t.Error("VDF timed without instrumentation")
+	}
+	rec := &recordingInstrumentation{counters: make(map[string]int64), records: make(map[string]int)}
+	WithInstrumentation(rec)(e)
+	ivdf := e.timedVdf(ctx)
+	sol, _ := ivdf.Create(1)
+	ivdf.Verify(sol)
+	ivdf.Verify(sol)
+	if rec.records["pebble.vdf.create"] != 1 || rec.records["pebble.vdf.verify"] != 2 || rec.counters["pebble.vdf.verifications"] != 2 {
+		t.Errorf("recorded %v, counted %v", rec.records, rec.counters)
+	}
+	_, end := e.start(ctx, "pebble.progress")
+	end(nil)
+	e.add(ctx, "pebble.ballots.verified", 0)
+	if len(rec.ops) != 1 || rec.ops[0] != "pebble.progress" {
+		t.Errorf("started %v", rec.ops)
+	}
+	if _, ok := rec.counters["pebble.ballots.verified"]; ok {
+		t.Error("counted zero")
+	}
+}
+
+func TestListen(t *testing.T) {
+	now := time.Now()
+	params := generateParamsV1()
+	params.CastStart = now.Add(-time.Minute)
+	params.TallyStart = now.Add(200 * time.Millisecond)
+	own := structs.SignedBallot{SerialNo: []byte("own")}
+	e := &Election{
+		channel: NewMockBroadcastChannel(ElectionID{}, nil),
+		secrets: &mockSecretsManager{ballots: []secrets.BallotRecord{{Ballot: own}}},
+		params:  params,
+	}
+	phases := make(chan ElectionPhase, 1)
+	accepted := make(chan structs.SignedBallot, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := e.Listen(ctx, ElectionListener{
+		OnPhaseChange: func(from, to ElectionPhase) {
+			if from != Cast {
+				t.Errorf("phase changed from %v", from)
+			}
+			phases <- to
+		},
+		OnBallotAccepted: func(sb structs.SignedBallot) {
+			accepted <- sb
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, serialNo := range []string{"other", "own", "own"} {
+		sb := structs.SignedBallot{SerialNo: []byte(serialNo)}
+		e.channel.Post(ctx, Message{SignedBallot: &sb})
+	}
+	select {
+	case sb := <-accepted:
+		if string(sb.SerialNo) != "own" {
+			t.Errorf("accepted ballot %q", sb.SerialNo)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ballot not accepted")
+	}
+	select {
+	case p := <-phases:
+		if p != Tally {
+			t.Errorf("changed to phase %v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("phase change not reported")
+	}
+	if len(accepted) != 0 {
+		t.Error("ballot accepted twice")
+	}
+}
+
+func TestProgressCancelled(t *testing.T) {
+	params := generateParamsV1()
+	params.CastStart = time.Now().Add(-time.Minute)
+	e := &Election{channel: NewMockBroadcastChannel(ElectionID{}, nil), params: params}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := e.Progress(ctx); err != context.Canceled {
+		t.Errorf("progress after cancellation: %v", err)
+	}
+}
+
+// Run with -race: amendments replace the params while other goroutines read them.
+func TestConcurrentRefresh(t *testing.T) {
+	ctx := context.Background()
+	organizer, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := generateParamsV1()
+	if err = params.Sign(organizer); err != nil {
+		t.Fatal(err)
+	}
+	e := &Election{channel: NewMockBroadcastChannel(ElectionID{}, params), params: params, base: params, vdf: newVdf(params)}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := e.Progress(ctx); err != nil {
+					t.Error(err)
+					return
+				}
+				e.Countdown()
+				e.timedVdf(ctx)
+			}
+		}()
+	}
+	for i := 1; i <= 10; i++ {
+		shift := time.Duration(i) * time.Minute
+		a := Amendment{Flags: AmendTallyStart | AmendTallyEnd, TallyStart: params.TallyStart.Add(shift), TallyEnd: params.TallyEnd.Add(shift)}
+		if err = e.Amend(ctx, organizer, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if !e.Params().TallyStart.Equal(params.TallyStart.Add(10 * time.Minute)) {
+		t.Error("amendments not applied")
+	}
+}
+
+func TestDecryptBallotReveal(t *testing.T) {
+	sol := vdf.VdfSolution{Input: []byte("input"), Output: []byte("output")}
+	eb, err := structs.Ballot("ballot").EncryptWith(structs.SuiteXChaCha20Poly1305, sol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := eb.Suite.Key(sol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reveal := structs.KeyRevealMessage{InputHash: util.Hash(sol.Input), Key: key}
+	m, err := MessageFromBytes(Message{KeyReveal: &reveal}.Bytes())
+	if err != nil || m.KeyReveal == nil || string(m.KeyReveal.Key) != string(key) {
+		t.Fatalf("key reveal not preserved: %v", err)
+	}
+	bogus := structs.KeyRevealMessage{InputHash: reveal.InputHash, Key: []byte("bogus")}
+	if _, _, err = decryptBallot(eb, nil, []structs.KeyRevealMessage{bogus}, stubVdf{}); err != ErrDecryptionNotFound {
+		t.Errorf("bogus key: %v", err)
+	}
+	// A bogus reveal does not block the real one
+	b, proof, err := decryptBallot(eb, nil, []structs.KeyRevealMessage{bogus, reveal}, stubVdf{})
+	if err != nil || string(b) != "ballot" {
+		t.Fatalf("ballot not decrypted with the revealed key: %v", err)
+	}
+	// The VDF solution, when posted, opens the ballot to the same plaintext
+	dec := structs.CreateDecryptionMessage(sol)
+	b2, proof2, err := decryptBallot(eb, []structs.DecryptionMessage{dec}, []structs.KeyRevealMessage{reveal}, stubVdf{})
+	if err != nil || string(b2) != string(b) {
+		t.Fatalf("ballot not decrypted with the VDF solution: %v", err)
+	}
+	if string(proof2) != string(dec.Bytes()) || string(proof) == string(proof2) {
+		t.Error("VDF decryption not preferred")
+	}
+}
+
+func TestFinalProgressCopy(t *testing.T) {
+	e := &Election{}
+	p := ElectionProgress{
+		Phase:      End,
+		Tally:      methods.Tally{{Index: 0, Count: 1}},
+		Tallies:    []methods.Tally{{{Index: 0, Count: 1}}},
+		Rejections: map[RejectionReason]int{RejectDuplicateSerialNo: 1},
+		Rejected:   []RejectedMessage{{Reason: RejectDuplicateSerialNo}},
+	}
+	e.setFinalProgress(3, p)
+	p.Tally[0].Count = 5
+	got, ok := e.finalProgress(3)
+	if !ok {
+		t.Fatal("final progress not cached")
+	}
+	got.Tallies[0][0].Count = 5
+	got.Rejections[RejectDuplicateSerialNo] = 5
+	got.Rejected[0].Reason = RejectInvalidSignature
+	got, _ = e.finalProgress(3)
+	if got.Tally[0].Count != 1 || got.Tallies[0][0].Count != 1 || got.Rejections[RejectDuplicateSerialNo] != 1 || got.Rejected[0].Reason != RejectDuplicateSerialNo {
+		t.Errorf("cached progress changed through a copy: %+v", got)
+	}
+}
@@ -0,0 +1,140 @@
+package voting
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+var ErrEligibilityUpdateNotAllowed = errors.New("pebble: eligibility updates are only allowed during registration")
+
+// Prefixed to the eligibility update bytes before signing.
+const eligibilityUpdateSignatureContext = "pebble-eligibility-update"
+
+/*
+Represents an organizer-signed change to the eligibility list, issued during the
+registration window (Setup or CredGen phase, until the end of registration). Updates received
+by the channel after the registration window are ignored. Sequence orders updates independently of amendments;
+each update's diff applies to the list resulting from the previous updates.
+Root-only eligibility lists cannot be updated.
+*/
+type EligibilityUpdate struct {
+	Sequence  uint32
+	Phase     ElectionPhase
+	Diff      structs.EligibilityDiff
+	Signature []byte
+}
+
+func (u *EligibilityUpdate) encode(withSignature bool) []byte {
+	var w util.BufferWriter
+	w.WriteUint32(u.Sequence)
+	w.WriteByte(byte(u.Phase))
+	w.WriteVector(u.Diff.Bytes())
+	if withSignature {
+		w.Write(u.Signature)
+	}
+	return w.Buffer
+}
+
+func (u *EligibilityUpdate) Bytes() []byte {
+	return u.encode(true)
+}
+
+func (u *EligibilityUpdate) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	u.Sequence, err = r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	phase, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	u.Phase = ElectionPhase(phase)
+	diff, err := r.ReadVector()
+	if err != nil {
+		return err
+	}
+	err = u.Diff.FromBytes(diff)
+	if err != nil {
+		return err
+	}
+	u.Signature = r.ReadRemaining()
+	return nil
+}
+
+func (u *EligibilityUpdate) signingBytes(eid ElectionID) []byte {
+	return util.Concat([]byte(eligibilityUpdateSignatureContext), eid[:], u.encode(false))
+}
+
+// Signs the update with the organizer key for the given election.
+func (u *EligibilityUpdate) Sign(k pubkey.PrivateKey, eid ElectionID) error {
+	var err error
+	u.Signature, err = k.Sign(u.signingBytes(eid))
+	return err
+}
+
+// Verifies the update signature against the organizer key or set in the params.
+func (u *EligibilityUpdate) Verify(p *ElectionParams, eid ElectionID) error {
+	return p.verifyOrganizerAction(u.signingBytes(eid), u.Signature)
+}
+
+// Reports whether eligibility updates are accepted at t, from setup to the end of registration.
+func (p *ElectionParams) eligibilityUpdatesOpenAt(t time.Time) bool {
+	return p.PhaseAt(t) == Setup || p.RegistrationOpenAt(t)
+}
+
+// Returns a copy of the params with the update applied to the eligibility list.
+func (u *EligibilityUpdate) Apply(p *ElectionParams) (*ElectionParams, error) {
+	if u.Phase != Setup && u.Phase != CredGen {
+		return nil, ErrEligibilityUpdateNotAllowed
+	}
+	list, err := p.EligibilityList.Apply(&u.Diff)
+	if err != nil {
+		return nil, err
+	}
+	q := *p
+	q.EligibilityList = list
+	return &q, nil
+}
+
+// Applies the valid eligibility updates found in msgs, in sequence order, to the params.
+// Updates with an invalid signature, a reused sequence number or a conflicting diff are skipped,
+// as are updates received after the registration window, or without a receive time in elections that require one.
+func applyEligibilityUpdates(p *ElectionParams, eid ElectionID, msgs []Message) *ElectionParams {
+	var updates []*EligibilityUpdate
+	for _, msg := range msgs {
+		if msg.EligibilityUpdate != nil && !p.missingReceiveTime(msg) && (msg.Received.IsZero() || p.eligibilityUpdatesOpenAt(msg.Received)) {
+			updates = append(updates, msg.EligibilityUpdate)
+		}
+	}
+	if len(updates) == 0 || p.Version < ParamsVersion2 {
+		return p
+	}
+	sort.SliceStable(updates, func(i, j int) bool {
+		return updates[i].Sequence < updates[j].Sequence
+	})
+	applied := false
+	var last uint32
+	for _, u := range updates {
+		if applied && u.Sequence <= last {
+			continue
+		}
+		if u.Verify(p, eid) != nil {
+			continue
+		}
+		q, err := u.Apply(p)
+		if err != nil {
+			continue
+		}
+		p = q
+		last = u.Sequence
+		applied = true
+	}
+	return p
+}
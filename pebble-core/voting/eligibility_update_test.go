@@ -0,0 +1,69 @@
+package voting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+func TestApplyEligibilityUpdates(t *testing.T) {
+	organizer, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := generateParamsV1()
+	err = params.Sign(organizer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var eid ElectionID
+	alice, bob := util.Hash([]byte("alice")), util.Hash([]byte("bob"))
+	first := EligibilityUpdate{Sequence: 0, Phase: CredGen}
+	first.Diff.Added = []structs.EligibilityChange{{KeyHash: alice}, {KeyHash: bob}}
+	second := EligibilityUpdate{Sequence: 1, Phase: CredGen}
+	second.Diff.Removed = []structs.EligibilityChange{{KeyHash: bob}}
+	late := EligibilityUpdate{Sequence: 2, Phase: Cast}
+	late.Diff.Removed = []structs.EligibilityChange{{KeyHash: alice}}
+	for _, u := range []*EligibilityUpdate{&first, &second, &late} {
+		if err := u.Sign(organizer, eid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var decoded EligibilityUpdate
+	if err = decoded.FromBytes(second.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	msgs := []Message{{EligibilityUpdate: &decoded}, {EligibilityUpdate: &late}, {EligibilityUpdate: &first}}
+	q := applyEligibilityUpdates(params, eid, msgs)
+	if !q.EligibilityList.Contains(alice) || q.EligibilityList.Contains(bob) || q.EligibilityList.Len() != 1 {
+		t.Error("updates not applied in sequence order")
+	}
+	if params.EligibilityList.Len() != 0 {
+		t.Error("published params modified")
+	}
+	// Voters missed at setup are added until the registration ends
+	carol := util.Hash([]byte("carol"))
+	added := EligibilityUpdate{Sequence: 3, Phase: CredGen}
+	added.Diff.Added = []structs.EligibilityChange{{KeyHash: carol}}
+	if err = added.Sign(organizer, eid); err != nil {
+		t.Fatal(err)
+	}
+	msg := Message{EligibilityUpdate: &added, Received: params.RegistrationEnd.Add(time.Second)}
+	if q = applyEligibilityUpdates(q, eid, []Message{msg}); q.EligibilityList.Contains(carol) {
+		t.Error("update received after the registration applied")
+	}
+	msg.Received = params.RegistrationEnd.Add(-time.Second)
+	if q = applyEligibilityUpdates(q, eid, []Message{msg}); !q.EligibilityList.Contains(carol) {
+		t.Error("update received during the registration not applied")
+	}
+	// Elections from version 11 need the receive time
+	recent := *params
+	recent.Version = ParamsVersion11
+	msg.Received = time.Time{}
+	if applyEligibilityUpdates(&recent, eid, []Message{msg}).EligibilityList.Contains(carol) {
+		t.Error("update without a receive time applied")
+	}
+}
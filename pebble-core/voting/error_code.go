@@ -0,0 +1,54 @@
+package voting
+
+import (
+	"errors"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/base32c"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/vdf"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+/*
+Returns the code of err as reported by the HTTP APIs: the code sent by the server
+for errors returned by a BroadcastClient, or the code of a known pebble error.
+Returns an empty code for other errors.
+*/
+func ErrorCodeOf(err error) util.ErrorCode {
+	var serr *statusError
+	if errors.As(err, &serr) {
+		return serr.apiCode
+	}
+	var aerr *util.APIError
+	if errors.As(err, &aerr) {
+		return aerr.Code
+	}
+	var verr *vdf.VdfError
+	if errors.As(err, &verr) {
+		return util.ErrorVdfFailed
+	}
+	switch {
+	case errors.Is(err, ErrWrongPhase), errors.Is(err, ErrRegistrationClosed), errors.Is(err, ErrEligibilityUpdateNotAllowed):
+		return util.ErrorWrongPhase
+	case errors.Is(err, ErrInvalidInvitation), errors.Is(err, ErrUnknownInvitationVersion),
+		errors.Is(err, base32c.ErrChar), errors.Is(err, base32c.ErrPadding),
+		errors.Is(err, base32c.ErrLen), errors.Is(err, base32c.ErrCheck):
+		return util.ErrorInvalidInvitation
+	case errors.Is(err, structs.ErrNotEligible), errors.Is(err, structs.ErrInvalidEligibilityProof),
+		errors.Is(err, ErrNoEligibilityProof):
+		return util.ErrorNotEligible
+	case errors.Is(err, ErrInvalidMessageType), errors.Is(err, ErrInvalidMessageSize),
+		errors.Is(err, ErrUnsupportedEnvelope), errors.Is(err, ErrCertificationSigner),
+		errors.Is(err, ErrDKGSigner), errors.Is(err, structs.ErrNonCanonicalBallot):
+		return util.ErrorInvalidMessage
+	case errors.Is(err, ErrDuplicateMessage), errors.Is(err, ErrAlreadyVoted), errors.Is(err, ErrStaleCredential):
+		return util.ErrorDuplicate
+	case errors.Is(err, ErrInsufficientWork):
+		return util.ErrorInsufficientWork
+	case errors.Is(err, util.ErrTooLarge):
+		return util.ErrorTooLarge
+	case errors.Is(err, ErrMessageNotFound):
+		return util.ErrorNotFound
+	}
+	return ""
+}
@@ -0,0 +1,144 @@
+package voting
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/trustee"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/methods"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+/*
+In elections with trustees whose single contest uses a methods.HomomorphicMethod,
+ballots are not time-locked: the payload of each EncryptedBallot is a trustee.VectorBallot,
+and the trustees only decrypt the per-slot sums of the valid ballots.
+*/
+
+// Returns the homomorphic method of the election, if it is tallied homomorphically.
+func (e *Election) homomorphicMethod() (methods.HomomorphicMethod, bool) {
+	if e.Params().Trustees == nil || (e.contests != nil && len(e.contests.Methods) != 1) {
+		return nil, false
+	}
+	hm, ok := e.method.(methods.HomomorphicMethod)
+	return hm, ok
+}
+
+// Verifies the signatures and proofs of the ballots in msgs, keeping the first ballot of each serial number,
+// and returns the per-slot sums with the number of ballots summed. Ballots with delegated weight are summed once per voter.
+// Rejected ballots are recorded in p, unless it is nil.
+func (e *Election) homomorphicSums(ctx context.Context, hm methods.HomomorphicMethod, set anoncred.CredentialSet, msgs []Message, p *ElectionProgress) ([]trustee.ElGamal, int, error) {
+	eid := e.Id()
+	weights := e.delegatedWeights(set, msgs)
+	domain := e.ballotDomain()
+	reject := func(sb *structs.SignedBallot, reason RejectionReason) {
+		if p != nil {
+			p.reject(sb, reason)
+		}
+	}
+	var serialNos util.BytesSet
+	var ballots []*trustee.VectorBallot
+	for _, msg := range msgs {
+		if msg.SignedBallot == nil {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		if serialNos.Contains(msg.SignedBallot.SerialNo) {
+			reject(msg.SignedBallot, RejectDuplicateSerialNo)
+			continue
+		}
+		if msg.SignedBallot.Verify(set, domain) != nil {
+			reject(msg.SignedBallot, RejectInvalidSignature)
+			continue
+		}
+		vb := new(trustee.VectorBallot)
+		if vb.FromBytes(msg.SignedBallot.EncryptedBallot.Payload) != nil {
+			reject(msg.SignedBallot, RejectInvalidBallot)
+			continue
+		}
+		if e.Params().Trustees.VerifyVector(vb, hm.Slots(), eid[:]) != nil {
+			reject(msg.SignedBallot, RejectInvalidBallot)
+			continue
+		}
+		serialNos.Put(msg.SignedBallot.SerialNo)
+		for i := uint64(0); i <= weights[string(msg.SignedBallot.SerialNo)]; i++ {
+			ballots = append(ballots, vb)
+		}
+	}
+	sums, err := trustee.AggregateVectors(ballots, hm.Slots())
+	return sums, len(ballots), err
+}
+
+// Computes the partial decryptions of share for the per-slot sums.
+func (e *Election) homomorphicPartials(ctx context.Context, hm methods.HomomorphicMethod, set anoncred.CredentialSet, msgs []Message, share trustee.Share) ([]structs.TrusteePartial, error) {
+	sums, _, err := e.homomorphicSums(ctx, hm, set, msgs, nil)
+	if err != nil {
+		return nil, err
+	}
+	var partials []structs.TrusteePartial
+	for _, sum := range sums {
+		// Sums of no ballots need no decryption
+		pd, err := share.Decrypt(sum.A)
+		if err != nil {
+			continue
+		}
+		partials = append(partials, structs.TrusteePartial{EphemeralHash: util.Hash(sum.A), PartialDecryption: pd})
+	}
+	return partials, nil
+}
+
+/*
+Fills in the progress of a homomorphic election. Once the trustees posted enough
+partial decryptions, Count is the number of ballots tallied and the tie-break seed is
+the hash of the sorted hashes of the decrypted sums and counts.
+*/
+func (e *Election) homomorphicProgress(ctx context.Context, p ElectionProgress, hm methods.HomomorphicMethod, set anoncred.CredentialSet, msgs []Message) (ElectionProgress, error) {
+	sums, n, err := e.homomorphicSums(ctx, hm, set, msgs, &p)
+	if err != nil {
+		return p, err
+	}
+	e.add(ctx, "pebble.ballots.verified", int64(n))
+	if p.Phase == Cast {
+		p.Total = set.Len()
+		p.Count = n
+		return p, nil
+	}
+	p.Total = n
+	var trusteeMsgs []structs.TrusteeDecryptionMessage
+	for _, msg := range msgs {
+		if msg.TrusteeDecryption != nil {
+			trusteeMsgs = append(trusteeMsgs, *msg.TrusteeDecryption)
+		}
+	}
+	partials := collectTrusteePartials(trusteeMsgs)
+	counts := make([]uint64, len(sums))
+	var hashes []util.HashValue
+	for i, sum := range sums {
+		var indices []uint32
+		var pds []trustee.PartialDecryption
+		if tp, ok := partials[util.Hash(sum.A)]; ok {
+			indices, pds = tp.indices, tp.partials
+		}
+		counts[i], err = e.Params().Trustees.DecryptCount(sum, indices, pds, uint64(n))
+		if err == trustee.ErrNotEnoughPartials {
+			// Not decrypted yet
+			p.Tallies = []methods.Tally{hm.TallyCounts(nil)}
+			p.Tally = p.Tallies[0]
+			return p, nil
+		} else if err != nil {
+			return p, err
+		}
+		var count [8]byte
+		binary.BigEndian.PutUint64(count[:], counts[i])
+		hashes = append(hashes, e.hash(util.DomainBallot, sum.A, sum.B, count[:]))
+	}
+	p.Count = n
+	p.Tallies = []methods.Tally{hm.TallyCounts(counts)}
+	p.Tally = p.Tallies[0]
+	p.TieBreakSeed = e.tieBreakSeed(hashes)
+	return p, nil
+}
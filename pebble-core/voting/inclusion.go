@@ -0,0 +1,222 @@
+package voting
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+var (
+	ErrInvalidInclusionProof = errors.New("pebble: invalid message inclusion proof")
+	ErrCheckpointUnsigned    = errors.New("pebble: log checkpoints require organizer-signed params")
+	ErrNoInclusionProofs     = errors.New("pebble: broadcast channel does not prove message inclusion")
+)
+
+// Prefixed to the signed bytes of log checkpoints.
+const logCheckpointContext = "pebble-log-checkpoint"
+
+// Maximum length of an inclusion path: the index of the leaf has 64 bits.
+const maxInclusionDepth = 64
+
+/*
+The state of the message log of an election, signed by the organizer: the number of messages
+and the Merkle root of their IDs in order (see util.MerkleRoot), with leaves H(0x00 || id).
+*/
+type LogCheckpoint struct {
+	Count     uint64
+	Root      util.HashValue
+	Signature []byte
+}
+
+func messageLeaf(id MessageID) util.HashValue {
+	return util.HashAll([]byte{0}, id[:])
+}
+
+func (c *LogCheckpoint) signingBytes(eid ElectionID) []byte {
+	var w util.BufferWriter
+	w.Write([]byte(logCheckpointContext))
+	w.Write(eid[:])
+	w.WriteUvarint(c.Count)
+	w.Write32(c.Root)
+	return w.Buffer
+}
+
+// Signs the checkpoint with the organizer key for the given election.
+func (c *LogCheckpoint) Sign(k pubkey.PrivateKey, eid ElectionID) error {
+	var err error
+	c.Signature, err = k.Sign(c.signingBytes(eid))
+	return err
+}
+
+// Verifies the checkpoint signature against the organizer key in the params.
+func (c *LogCheckpoint) Verify(p *ElectionParams, eid ElectionID) error {
+	if p.Version < ParamsVersion2 {
+		return ErrCheckpointUnsigned
+	}
+	return p.Organizer.Verify(c.signingBytes(eid), c.Signature)
+}
+
+/*
+Proves that a message is on the board of an election: the position of the message in the log
+and the sibling hashes from its leaf up to the root of a signed checkpoint. Anyone holding the
+params can check it against the message, so that voters can show that their ballot was posted.
+*/
+type InclusionProof struct {
+	Checkpoint LogCheckpoint
+	Index      uint64
+	Path       []util.HashValue
+}
+
+// Checks the checkpoint signature and that the message with the ID is in the checkpointed log.
+func (proof *InclusionProof) Verify(p *ElectionParams, eid ElectionID, id MessageID) error {
+	err := proof.Checkpoint.Verify(p, eid)
+	if err != nil {
+		return err
+	}
+	c := proof.Checkpoint
+	if !util.VerifyMerklePath(c.Root, c.Count, proof.Index, messageLeaf(id), proof.Path) {
+		return ErrInvalidInclusionProof
+	}
+	return nil
+}
+
+func (proof *InclusionProof) Bytes() []byte {
+	var w util.BufferWriter
+	w.WriteUvarint(proof.Checkpoint.Count)
+	w.Write32(proof.Checkpoint.Root)
+	w.WriteUvarint(proof.Index)
+	w.WriteUvarint(uint64(len(proof.Path)))
+	for _, h := range proof.Path {
+		w.Write32(h)
+	}
+	w.Write(proof.Checkpoint.Signature)
+	return w.Buffer
+}
+
+func (proof *InclusionProof) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	proof.Checkpoint.Count, err = r.ReadUvarint()
+	if err != nil {
+		return err
+	}
+	proof.Checkpoint.Root, err = r.Read32()
+	if err != nil {
+		return err
+	}
+	proof.Index, err = r.ReadUvarint()
+	if err != nil {
+		return err
+	}
+	n, err := r.ReadCount(maxInclusionDepth, 32)
+	if err != nil {
+		return err
+	}
+	proof.Path = make([]util.HashValue, n)
+	for i := range proof.Path {
+		proof.Path[i], err = r.Read32()
+		if err != nil {
+			return err
+		}
+	}
+	proof.Checkpoint.Signature = r.ReadRemaining()
+	return nil
+}
+
+/*
+Proves that the message with the ID is on the channel of the election, against a checkpoint
+of all the messages signed with the organizer key k. Returns ErrMessageNotFound if it is not.
+*/
+func (e *Election) ProveInclusion(ctx context.Context, id MessageID, k pubkey.PrivateKey) (*InclusionProof, error) {
+	if e.base == nil || e.base.Version < ParamsVersion2 {
+		return nil, ErrCheckpointUnsigned
+	}
+	if !bytes.Equal(k.Public(), e.base.Organizer) {
+		return nil, ErrOrganizerMismatch
+	}
+	var leaves []util.HashValue
+	index := -1
+	err := ForEachMessage(ctx, e.channel, func(m Message) error {
+		mid := m.Id()
+		if index < 0 && mid == id {
+			index = len(leaves)
+		}
+		leaves = append(leaves, messageLeaf(mid))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 {
+		return nil, ErrMessageNotFound
+	}
+	proof := &InclusionProof{
+		Checkpoint: LogCheckpoint{Count: uint64(len(leaves)), Root: util.MerkleRoot(leaves)},
+		Index:      uint64(index),
+		Path:       util.MerklePath(leaves, index),
+	}
+	err = proof.Checkpoint.Sign(k, e.Id())
+	if err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+/*
+Optionally implemented by broadcast channels whose server proves the inclusion of messages.
+
+InclusionProof(ctx context.Context, id MessageID): returns the proof of the message, unverified.
+*/
+type InclusionProvider interface {
+	InclusionProof(ctx context.Context, id MessageID) (*InclusionProof, error)
+}
+
+// Retrieves the inclusion proof of the message from the server's inclusion URI, or ErrMessageNotFound.
+func (bc *BroadcastClient) InclusionProof(ctx context.Context, id MessageID) (*InclusionProof, error) {
+	buf, err := bc.getBytes(ctx, bc.inclusionURI+"?id="+hex.EncodeToString(id[:]))
+	if serr, ok := err.(*statusError); ok && serr.code == http.StatusNotFound {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	proof := new(InclusionProof)
+	err = proof.FromBytes(buf)
+	if err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+/*
+Retrieves from the channel the proof that the voter's ballot is on the board, and verifies it
+against the params. The proof and the ballot (see PostedBallot) can be shown to third parties.
+*/
+func (e *Election) BallotInclusionProof(ctx context.Context) (*InclusionProof, error) {
+	provider, ok := e.channel.(InclusionProvider)
+	if !ok {
+		return nil, ErrNoInclusionProofs
+	}
+	posted, err := e.PostedBallot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if posted == nil {
+		return nil, ErrMessageNotFound
+	}
+	id := MessageID(posted.TrackingCode)
+	proof, err := provider.InclusionProof(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = proof.Verify(e.base, e.Id(), id)
+	if err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
@@ -0,0 +1,58 @@
+package voting
+
+import (
+	"context"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+func TestInclusionProof(t *testing.T) {
+	ctx := context.Background()
+	organizer, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := generateParamsV1()
+	params.Version = ParamsVersion2
+	if err = params.Sign(organizer); err != nil {
+		t.Fatal(err)
+	}
+	eid := ElectionID{1}
+	bc := NewMockBroadcastChannel(eid, params)
+	e := &Election{channel: bc, params: params, base: params}
+	var ids []MessageID
+	for i := 0; i < 5; i++ {
+		m := Message{Decryption: &structs.DecryptionMessage{Output: []byte{byte(i)}}}
+		bc.Post(ctx, m)
+		ids = append(ids, m.Id())
+	}
+	for i, id := range ids {
+		proof, err := e.ProveInclusion(ctx, id, organizer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proof.Index != uint64(i) || proof.Checkpoint.Count != 5 {
+			t.Errorf("message %d at %d of %d", i, proof.Index, proof.Checkpoint.Count)
+		}
+		var decoded InclusionProof
+		if err = decoded.FromBytes(proof.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		if err = decoded.Verify(params, eid, id); err != nil {
+			t.Errorf("message %d: %v", i, err)
+		}
+		if err = decoded.Verify(params, eid, ids[(i+1)%len(ids)]); err == nil {
+			t.Errorf("message %d: proof holds for another message", i)
+		}
+	}
+	proof, _ := e.ProveInclusion(ctx, ids[2], organizer)
+	proof.Checkpoint.Count++
+	if proof.Verify(params, eid, ids[2]) == nil {
+		t.Error("tampered checkpoint verified")
+	}
+	if _, err = e.ProveInclusion(ctx, MessageID{}, organizer); err != ErrMessageNotFound {
+		t.Errorf("unknown message proven: %v", err)
+	}
+}
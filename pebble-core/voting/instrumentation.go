@@ -0,0 +1,98 @@
+package voting
+
+import (
+	"context"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/vdf"
+)
+
+/*
+Receives traces and metrics of election processing, so that operators embedding pebble-core
+can see where the time goes. The methods map onto OpenTelemetry: Start onto Tracer.Start and
+Span.End, Add onto an Int64Counter and Record onto a Float64Histogram.
+Implementations must be safe for concurrent use.
+
+Operations: "pebble.credential_set" (building the credential set), "pebble.vote" and "pebble.progress".
+Counters: "pebble.credentials" (credentials in the set), "pebble.ballots.verified",
+"pebble.ballots.rejected" and "pebble.vdf.verifications".
+Histograms, in seconds: "pebble.vdf.create", "pebble.vdf.solve" and "pebble.vdf.verify".
+*/
+type Instrumentation interface {
+	// Starts an operation; end is called with its result once it completes.
+	Start(ctx context.Context, op string) (_ context.Context, end func(err error))
+	Add(ctx context.Context, counter string, n int64)
+	Record(ctx context.Context, histogram string, value float64)
+}
+
+// Reports the processing of the election to inst.
+func WithInstrumentation(inst Instrumentation) ElectionOption {
+	return func(e *Election) {
+		e.inst = inst
+	}
+}
+
+// Starts an operation if the election is instrumented.
+func (e *Election) start(ctx context.Context, op string) (context.Context, func(err error)) {
+	if e.inst == nil {
+		return ctx, func(error) {}
+	}
+	return e.inst.Start(ctx, op)
+}
+
+func (e *Election) add(ctx context.Context, counter string, n int64) {
+	if e.inst != nil && n != 0 {
+		e.inst.Add(ctx, counter, n)
+	}
+}
+
+// Returns the VDF of the election, timing its operations if the election is instrumented.
+func (e *Election) timedVdf(ctx context.Context) vdf.VDF {
+	if e.inst == nil {
+		return e.currentVdf()
+	}
+	return &timedVdf{e.currentVdf(), e.inst, ctx}
+}
+
+type timedVdf struct {
+	vdf.VDF
+	inst Instrumentation
+	ctx  context.Context
+}
+
+func (v *timedVdf) Create(seconds uint64) (vdf.VdfSolution, error) {
+	defer v.record("pebble.vdf.create", time.Now())
+	return v.VDF.Create(seconds)
+}
+
+func (v *timedVdf) CreateWithDifficulty(t uint64) (vdf.VdfSolution, error) {
+	dv, ok := v.VDF.(vdf.DifficultyVDF)
+	if !ok {
+		return vdf.VdfSolution{}, ErrVdfDifficulty
+	}
+	defer v.record("pebble.vdf.create", time.Now())
+	return dv.CreateWithDifficulty(t)
+}
+
+func (v *timedVdf) Difficulty(input []byte) (uint64, error) {
+	dv, ok := v.VDF.(vdf.DifficultyVDF)
+	if !ok {
+		return 0, ErrVdfDifficulty
+	}
+	return dv.Difficulty(input)
+}
+
+func (v *timedVdf) Solve(input []byte) (vdf.VdfSolution, error) {
+	defer v.record("pebble.vdf.solve", time.Now())
+	return v.VDF.Solve(input)
+}
+
+func (v *timedVdf) Verify(sol vdf.VdfSolution) error {
+	defer v.record("pebble.vdf.verify", time.Now())
+	v.inst.Add(v.ctx, "pebble.vdf.verifications", 1)
+	return v.VDF.Verify(sol)
+}
+
+func (v *timedVdf) record(histogram string, start time.Time) {
+	v.inst.Record(v.ctx, histogram, time.Since(start).Seconds())
+}
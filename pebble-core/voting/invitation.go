@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	"github.com/giry-dev/pebble-voting-app/pebble-core/base32c"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
 )
 
@@ -12,51 +13,166 @@ var (
 	ErrInvalidInvitation        = errors.New("pebble: invalid invitation")
 )
 
-const invitationVersion uint32 = 0x1b68c700
+const (
+	invitationVersion uint32 = 0x1b68c700
+	// Adds the organizer public key used to verify the ElectionParams signature.
+	invitationVersion1 uint32 = 0x1b68c701
+	// Encodes the server count and vector lengths as varints, with an optional organizer key.
+	invitationVersion2 uint32 = 0x1b68c702
+	// Appends the pinned server public key hash.
+	invitationVersion3 uint32 = 0x1b68c703
+	// Appends the access token of a private election, after a possibly empty server pin.
+	invitationVersion4 uint32 = 0x1b68c704
+
+	maxInvitationServers = 1 << 10
+	maxInvitationVector  = 1 << 16
+	// Maximum length of an encoded invitation string.
+	maxInvitationLength = 1 << 20
+)
 
 // Represents an invitation to join a network or participate in an activity.
 // Contains the network name, address, and a list of servers associated with the invitation.
+// Organizer is optional and pins the key expected to have signed the election params.
+// ServerPin is optional and pins the TLS public key of the servers, see ServerPin.
+// AccessToken is set for private elections, whose servers require it to read the election.
 type Invitation struct {
-	Network string
-	Address []byte
-	Servers []string
+	Network     string
+	Address     []byte
+	Servers     []string
+	Organizer   pubkey.PublicKey
+	ServerPin   []byte
+	AccessToken []byte
 }
 
 /*
 Converts the Invitation struct into a string representation.
-Serializes the invitation data by encoding it with base32c encoding.
+Serializes the invitation data by encoding it with base32c encoding,
+with a checksum correcting a mistyped character.
 Returns the encoded string.
 */
 func (inv Invitation) String() string {
 	var w util.BufferWriter
-	w.WriteUint32(invitationVersion)
+	if !inv.fitsLegacy() || len(inv.ServerPin) != 0 || len(inv.AccessToken) != 0 {
+		if len(inv.AccessToken) != 0 {
+			w.WriteUint32(invitationVersion4)
+		} else if len(inv.ServerPin) != 0 {
+			w.WriteUint32(invitationVersion3)
+		} else {
+			w.WriteUint32(invitationVersion2)
+		}
+		w.WriteVarVector(inv.Address)
+		w.WriteUvarint(uint64(len(inv.Servers)))
+		for _, s := range inv.Servers {
+			w.WriteVarVector([]byte(s))
+		}
+		w.WriteVarVector(inv.Organizer)
+		if len(inv.ServerPin) != 0 || len(inv.AccessToken) != 0 {
+			w.WriteVarVector(inv.ServerPin)
+		}
+		if len(inv.AccessToken) != 0 {
+			w.WriteVarVector(inv.AccessToken)
+		}
+		return base32c.CorrectableEncode(w.Buffer)
+	}
+	if len(inv.Organizer) != 0 {
+		w.WriteUint32(invitationVersion1)
+	} else {
+		w.WriteUint32(invitationVersion)
+	}
 	w.WriteVector(inv.Address)
 	w.WriteByte(byte(len(inv.Servers)))
 	for _, s := range inv.Servers {
 		w.WriteVector([]byte(s))
 	}
-	return base32c.CheckEncode(w.Buffer)
+	if len(inv.Organizer) != 0 {
+		w.WriteVector(inv.Organizer)
+	}
+	return base32c.CorrectableEncode(w.Buffer)
+}
+
+// Returns the ID of the election hosted at the address of the invitation,
+// which broadcast servers encode in base32c.
+func (inv Invitation) ElectionId() (id ElectionID, err error) {
+	p, err := base32c.Decode(string(inv.Address))
+	if err != nil || len(p) != len(id) {
+		return id, ErrInvalidInvitation
+	}
+	copy(id[:], p)
+	return id, nil
+}
+
+// Reports whether the invitation fits the encoding of versions 0 and 1.
+func (inv Invitation) fitsLegacy() bool {
+	if len(inv.Servers) > 255 || len(inv.Address) > 0x7FFF || len(inv.Organizer) > 0x7FFF {
+		return false
+	}
+	for _, s := range inv.Servers {
+		if len(s) > 0x7FFF {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeInvitationV2(r *util.BufferReader, v uint32) (inv Invitation, err error) {
+	inv.Address, err = r.ReadVarVector(maxInvitationVector)
+	if err != nil {
+		return
+	}
+	numServers, err := r.ReadCount(maxInvitationServers, 1)
+	if err != nil {
+		return
+	}
+	inv.Servers = make([]string, numServers)
+	for i := range inv.Servers {
+		b, err := r.ReadVarVector(maxInvitationVector)
+		if err != nil {
+			return inv, err
+		}
+		inv.Servers[i] = string(b)
+	}
+	inv.Organizer, err = r.ReadVarVector(maxInvitationVector)
+	if err != nil || v == invitationVersion2 {
+		return
+	}
+	inv.ServerPin, err = r.ReadVarVector(maxInvitationVector)
+	if err != nil || v == invitationVersion3 {
+		return
+	}
+	inv.AccessToken, err = r.ReadVarVector(maxInvitationVector)
+	return
 }
 
 /*
 Decodes the encoded invitation string and returns the corresponding Invitation struct.
 Takes the encoded invitation string as input.
-Decodes the base32c-encoded string to obtain the byte slice.
+Decodes the base32c-encoded string to obtain the byte slice, correcting a single mistyped character.
 Reads the version from the byte slice and verifies that it matches the expected invitation version.
 Reads the address and server information from the byte slice.
 Constructs and returns the Invitation struct with the decoded data.
 */
 func DecodeInvitation(s string) (inv Invitation, err error) {
-	p, err := base32c.CheckDecode(s)
+	if len(s) > maxInvitationLength {
+		return inv, util.ErrTooLarge
+	}
+	p, _, err := base32c.CheckDecodeWithCorrection(s)
 	if err != nil {
 		return inv, err
 	}
+	return decodeInvitation(p)
+}
+
+// Decodes the bytes of an invitation string.
+func decodeInvitation(p []byte) (inv Invitation, err error) {
 	r := util.NewBufferReader(p)
 	v, err := r.ReadUint32()
 	if err != nil {
 		return
 	}
-	if v != invitationVersion {
+	if v == invitationVersion2 || v == invitationVersion3 || v == invitationVersion4 {
+		return decodeInvitationV2(r, v)
+	}
+	if v != invitationVersion && v != invitationVersion1 {
 		return inv, ErrUnknownInvitationVersion
 	}
 	inv.Address, err = r.ReadVector()
@@ -67,6 +183,9 @@ func DecodeInvitation(s string) (inv Invitation, err error) {
 	if err != nil {
 		return
 	}
+	if !r.Holds(int(numServers), 1) {
+		return inv, util.ErrTooLarge
+	}
 	inv.Servers = make([]string, numServers)
 	for i := range inv.Servers {
 		b, err := r.ReadVector()
@@ -75,5 +194,8 @@ func DecodeInvitation(s string) (inv Invitation, err error) {
 		}
 		inv.Servers[i] = string(b)
 	}
+	if v == invitationVersion1 {
+		inv.Organizer, err = r.ReadVector()
+	}
 	return
 }
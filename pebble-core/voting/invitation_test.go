@@ -0,0 +1,53 @@
+package voting
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestInvitationVersions(t *testing.T) {
+	inv := Invitation{Network: "mock", Address: []byte("election"), Servers: []string{"https://a.example"}}
+	for _, n := range []int{1, 300} {
+		inv.Servers = inv.Servers[:0]
+		for i := 0; i < n; i++ {
+			inv.Servers = append(inv.Servers, "https://s"+strconv.Itoa(i)+".example")
+		}
+		decoded, err := DecodeInvitation(inv.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(decoded.Address) != "election" || len(decoded.Servers) != n || decoded.Servers[n-1] != inv.Servers[n-1] {
+			t.Errorf("%d servers: invitation not preserved", n)
+		}
+	}
+	if inv.fitsLegacy() {
+		t.Error("300 servers fit the legacy encoding")
+	}
+}
+
+func TestInvitationServerPin(t *testing.T) {
+	inv := Invitation{Address: []byte("election"), Servers: []string{"https://a.example"}, ServerPin: []byte("pin")}
+	decoded, err := DecodeInvitation(inv.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded.ServerPin) != "pin" || decoded.Servers[0] != inv.Servers[0] {
+		t.Error("server pin not preserved")
+	}
+}
+
+func TestInvitationAccessToken(t *testing.T) {
+	inv := Invitation{Address: []byte("election"), Servers: []string{"https://a.example"}, AccessToken: []byte("token")}
+	decoded, err := DecodeInvitation(inv.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded.AccessToken) != "token" || len(decoded.ServerPin) != 0 {
+		t.Error("access token not preserved")
+	}
+	inv.ServerPin = []byte("pin")
+	decoded, _ = DecodeInvitation(inv.String())
+	if string(decoded.AccessToken) != "token" || string(decoded.ServerPin) != "pin" {
+		t.Error("access token and server pin not preserved")
+	}
+}
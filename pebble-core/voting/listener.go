@@ -0,0 +1,127 @@
+package voting
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+/*
+Callbacks for the events of an election, registered with Election.Listen.
+Callbacks are called one at a time from the listening goroutine; nil ones are skipped.
+*/
+type ElectionListener struct {
+	// Called when the election moves to a new phase, according to its time source.
+	OnPhaseChange func(from, to ElectionPhase)
+	// Called once the ballot stored in the voter's secrets manager appears on the broadcast channel.
+	OnBallotAccepted func(ballot structs.SignedBallot)
+	// Called once the election has ended, with the final progress.
+	OnTallyFinal func(p ElectionProgress)
+	// Called when reading the channel or the final progress fails.
+	OnError func(err error)
+}
+
+/*
+Starts calling the listener on the events of the election until ctx is done,
+instead of polling Progress in a loop. Phase changes are detected with timers
+set to the phase deadlines, and ballots by watching the broadcast channel.
+If the voter's ballot is already on the channel or the election has already ended,
+the callbacks are called right away. The final progress is computed in the
+listening goroutine, so the election must not be used concurrently at that time.
+*/
+func (e *Election) Listen(ctx context.Context, l ElectionListener) error {
+	msgs, err := e.channel.Watch(ctx)
+	if err != nil {
+		return err
+	}
+	go e.listen(ctx, l, msgs)
+	return nil
+}
+
+func (e *Election) listen(ctx context.Context, l ElectionListener, msgs <-chan Message) {
+	// Ballots posted before the watch started
+	accepted := l.OnBallotAccepted == nil
+	if !accepted {
+		if own := e.ownBallot(); own != nil {
+			posted, err := e.readMessages(ctx, func(m Message) bool {
+				return m.SignedBallot != nil
+			})
+			if err != nil {
+				l.error(err)
+			}
+			for _, m := range posted {
+				if !accepted && bytes.Equal(m.Bytes(), own) {
+					accepted = true
+					l.OnBallotAccepted(*m.SignedBallot)
+				}
+			}
+		}
+	}
+	phase := e.Phase()
+	if phase == End {
+		e.finalize(ctx, l)
+		return
+	}
+	for {
+		timer := time.NewTimer(e.Countdown().Remaining)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case m, ok := <-msgs:
+			timer.Stop()
+			if !ok {
+				return
+			}
+			if !accepted && m.SignedBallot != nil {
+				if own := e.ownBallot(); own != nil && bytes.Equal(m.Bytes(), own) {
+					accepted = true
+					l.OnBallotAccepted(*m.SignedBallot)
+				}
+			}
+		case <-timer.C:
+		}
+		if p := e.Phase(); p != phase {
+			if l.OnPhaseChange != nil {
+				l.OnPhaseChange(phase, p)
+			}
+			phase = p
+			if phase == End {
+				e.finalize(ctx, l)
+				return
+			}
+		}
+	}
+}
+
+// Returns the message encoding of the voter's ballot, or nil if the voter has not cast one.
+func (e *Election) ownBallot() []byte {
+	if e.secrets == nil {
+		return nil
+	}
+	sb, err := e.secrets.GetBallot(e.Id())
+	if err != nil || sb.SerialNo == nil {
+		return nil
+	}
+	return Message{SignedBallot: &sb}.Bytes()
+}
+
+func (e *Election) finalize(ctx context.Context, l ElectionListener) {
+	if l.OnTallyFinal == nil {
+		return
+	}
+	p, err := e.Progress(ctx)
+	if err != nil {
+		l.error(err)
+		return
+	}
+	l.OnTallyFinal(p)
+}
+
+func (l ElectionListener) error(err error) {
+	if l.OnError != nil {
+		l.OnError(err)
+	}
+}
@@ -0,0 +1,231 @@
+package voting
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidTranslation = errors.New("pebble: invalid ElectionParams translation")
+
+// Longest language tag accepted, as in the registry of BCP 47.
+const maxLanguageTagLen = 35
+
+/*
+The texts of the params in another language, from version 15, for communities voting in
+several languages in a single election. Language is a BCP 47 tag, such as "fr" or "pt-BR".
+Choices and Contests follow the order of the params; missing or empty strings are shown
+in the language of the params.
+*/
+type Translation struct {
+	Language           string
+	Title, Description string
+	Choices            []string
+	Contests           []ContestTranslation
+}
+
+// The title and choices of a contest in a Translation.
+type ContestTranslation struct {
+	Title   string
+	Choices []string
+}
+
+// Checks the syntax of a BCP 47 tag: alphanumeric subtags of at most 8 characters, starting with letters.
+func validLanguageTag(tag string) bool {
+	if len(tag) == 0 || len(tag) > maxLanguageTagLen {
+		return false
+	}
+	for i, sub := range strings.Split(tag, "-") {
+		if len(sub) == 0 || len(sub) > 8 {
+			return false
+		}
+		for _, c := range sub {
+			letter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+			if !letter && (i == 0 || c < '0' || c > '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Checks that the translations have valid and distinct tags, and no more choices or contests than the params.
+func (p *ElectionParams) validateTranslations() error {
+	if len(p.Translations) == 0 {
+		return nil
+	}
+	if p.Version < ParamsVersion15 {
+		return errUnknownVersion
+	}
+	seen := make(map[string]bool, len(p.Translations))
+	for _, t := range p.Translations {
+		tag := strings.ToLower(t.Language)
+		if !validLanguageTag(tag) || seen[tag] || len(t.Choices) > len(p.Choices) || len(t.Contests) > len(p.Contests) {
+			return ErrInvalidTranslation
+		}
+		seen[tag] = true
+		for i, c := range t.Contests {
+			if len(c.Choices) > len(p.Contests[i].Choices) {
+				return ErrInvalidTranslation
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the language tags of the translations of the params.
+func (p *ElectionParams) Languages() []string {
+	tags := make([]string, len(p.Translations))
+	for i, t := range p.Translations {
+		tags[i] = t.Language
+	}
+	return tags
+}
+
+func (p *ElectionParams) findTranslation(match func(tag string) bool) *Translation {
+	for i := range p.Translations {
+		if match(strings.ToLower(p.Translations[i].Language)) {
+			return &p.Translations[i]
+		}
+	}
+	return nil
+}
+
+/*
+Returns the translation best matching the languages preferred by the reader, most preferred
+first, or nil if the params are best read in their own language. Each preferred tag is looked
+up as is, then with its last subtags removed ("pt-BR" then "pt"), then among the regional
+variants of its language ("pt-PT" for "pt") before trying the next preferred tag.
+*/
+func (p *ElectionParams) Translation(prefs ...string) *Translation {
+	for _, pref := range prefs {
+		pref = strings.ToLower(pref)
+		for tag := pref; tag != ""; {
+			if t := p.findTranslation(func(l string) bool { return l == tag }); t != nil {
+				return t
+			}
+			i := strings.LastIndexByte(tag, '-')
+			if i < 0 {
+				break
+			}
+			tag = tag[:i]
+		}
+		lang := strings.SplitN(pref, "-", 2)[0]
+		if t := p.findTranslation(func(l string) bool { return strings.HasPrefix(l, lang+"-") }); t != nil {
+			return t
+		}
+	}
+	return nil
+}
+
+// Returns the translation t of s, unless it is empty.
+func translated(s, t string) string {
+	if t != "" {
+		return t
+	}
+	return s
+}
+
+// Returns the translation of index i of ts of s, if any.
+func translatedAt(s string, ts []string, i int) string {
+	if i < len(ts) {
+		return translated(s, ts[i])
+	}
+	return s
+}
+
+/*
+Returns a copy of the params with their title, description, choices and contests in the
+language best matching the preferences (see Translation), for display. Texts that are not
+translated are kept. The copy no longer matches the organizer signature.
+*/
+func (p *ElectionParams) Localized(prefs ...string) *ElectionParams {
+	t := p.Translation(prefs...)
+	if t == nil {
+		return p
+	}
+	l := *p
+	l.Title = translated(p.Title, t.Title)
+	l.Description = translated(p.Description, t.Description)
+	l.Choices = make([]string, len(p.Choices))
+	for i, c := range p.Choices {
+		l.Choices[i] = translatedAt(c, t.Choices, i)
+	}
+	l.Contests = make([]Contest, len(p.Contests))
+	for i, c := range p.Contests {
+		l.Contests[i] = c
+		if i >= len(t.Contests) {
+			continue
+		}
+		ct := t.Contests[i]
+		l.Contests[i].Title = translated(c.Title, ct.Title)
+		l.Contests[i].Choices = make([]string, len(c.Choices))
+		for j, choice := range c.Choices {
+			l.Contests[i].Choices[j] = translatedAt(choice, ct.Choices, j)
+		}
+	}
+	return &l
+}
+
+func (w *paramsWriter) translations(ts []Translation) {
+	w.count(len(ts))
+	for _, t := range ts {
+		w.vector([]byte(t.Language))
+		w.vector([]byte(t.Title))
+		w.vector([]byte(t.Description))
+		w.strings(t.Choices)
+		w.count(len(t.Contests))
+		for _, c := range t.Contests {
+			w.vector([]byte(c.Title))
+			w.strings(c.Choices)
+		}
+	}
+}
+
+func (w *paramsWriter) strings(ss []string) {
+	w.count(len(ss))
+	for _, s := range ss {
+		w.vector([]byte(s))
+	}
+}
+
+func (r paramsReader) translations() ([]Translation, error) {
+	n, err := r.count()
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	ts := make([]Translation, n)
+	for i := range ts {
+		t := &ts[i]
+		var texts [3][]byte
+		for j := range texts {
+			texts[j], err = r.vector()
+			if err != nil {
+				return nil, err
+			}
+		}
+		t.Language, t.Title, t.Description = string(texts[0]), string(texts[1]), string(texts[2])
+		t.Choices, err = r.strings()
+		if err != nil {
+			return nil, err
+		}
+		nc, err := r.count()
+		if err != nil {
+			return nil, err
+		}
+		if nc != 0 {
+			t.Contests = make([]ContestTranslation, nc)
+		}
+		for j := range t.Contests {
+			b, err := r.vector()
+			if err != nil {
+				return nil, err
+			}
+			t.Contests[j].Title = string(b)
+			t.Contests[j].Choices, err = r.strings()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ts, nil
+}
@@ -0,0 +1,125 @@
+package voting
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/base32c"
+)
+
+var ErrCacheWithoutId = errors.New("pebble: only elections invited by their ID can be cached")
+
+/*
+Caches the params and messages downloaded by the client in dir, in files named after the
+election ID, so that a restarted client only downloads the messages posted since, and reads
+the election from the cache while the server cannot be reached. The messages are kept in a
+FileStore, numbered by their sequence on the server. Only one client may use the cache of an
+election at a time; Close releases it.
+*/
+func WithMessageCache(dir string) BroadcastClientOption {
+	return func(bc *BroadcastClient) {
+		bc.cacheDir = dir
+	}
+}
+
+// Opens the cache of the election in the cache directory.
+func (bc *BroadcastClient) openCache() error {
+	if bc.id == (ElectionID{}) {
+		return ErrCacheWithoutId
+	}
+	name := filepath.Join(bc.cacheDir, base32c.Encode(bc.id[:]))
+	bc.cacheParams = name + ".params"
+	var err error
+	bc.cache, err = OpenFileStore(name + ".messages")
+	return err
+}
+
+// Releases the message cache of the client, if any.
+func (bc *BroadcastClient) Close() error {
+	if bc.cache == nil {
+		return nil
+	}
+	return bc.cache.Close()
+}
+
+// Reports whether the request failed without reaching the server, in which case the cache is read.
+func unreachable(err error) bool {
+	var uerr *url.Error
+	return errors.As(err, &uerr)
+}
+
+/*
+Stores the params downloaded in buf, or returns the cached params if the server could not be reached.
+The params are verified by the caller either way.
+*/
+func (bc *BroadcastClient) cachedParams(buf []byte, err error) ([]byte, error) {
+	if err == nil {
+		return buf, os.WriteFile(bc.cacheParams, buf, 0600)
+	}
+	if unreachable(err) {
+		if cached, rerr := os.ReadFile(bc.cacheParams); rerr == nil {
+			return cached, nil
+		}
+	}
+	return nil, err
+}
+
+// Appends the messages posted since the cached ones to the cache, which is left as it is if the server cannot be reached.
+func (bc *BroadcastClient) syncCache(ctx context.Context) error {
+	bc.cacheMu.Lock()
+	defer bc.cacheMu.Unlock()
+	n, err := bc.cache.Len(ctx)
+	if err != nil {
+		return err
+	}
+	msgs, _, _, err := bc.getSince(ctx, int(n), 0)
+	if err != nil {
+		if unreachable(err) && ctx.Err() == nil {
+			return nil
+		}
+		return err
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	// Servers without receipts number the messages implicitly
+	for i := range msgs {
+		if msgs[i].Sequence == 0 {
+			msgs[i].Sequence = n + uint64(i) + 1
+		}
+	}
+	return bc.cache.Append(ctx, msgs)
+}
+
+// Syncs the cache and returns an iterator over the cached messages.
+func (bc *BroadcastClient) streamCache(ctx context.Context) (MessageIterator, error) {
+	err := bc.syncCache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return bc.cache.Iterate(ctx, 0)
+}
+
+// Syncs the cache and returns the cached messages.
+func (bc *BroadcastClient) getCache(ctx context.Context) ([]Message, error) {
+	it, err := bc.streamCache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	var msgs []Message
+	for {
+		m, err := it.Next()
+		if err == io.EOF {
+			return msgs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+}
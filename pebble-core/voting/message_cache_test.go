@@ -0,0 +1,81 @@
+package voting
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/base32c"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+func TestMessageCache(t *testing.T) {
+	ctx := context.Background()
+	params := generateParamsV1()
+	id := params.ElectionId(ServerNetwork)
+	mock := NewMockBroadcastChannel(id, params)
+	var requested []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/params/") {
+			w.Write(params.Bytes())
+			return
+		}
+		msgs, _ := mock.Get(ctx)
+		since, _ := strconv.Atoi(req.URL.Query().Get("since"))
+		requested = append(requested, since)
+		w.Header().Set("Pebble-Framing", "3")
+		w.Header().Set("Pebble-Message-Count", strconv.Itoa(len(msgs)))
+		w.Write(EncodeReceiptEnvelopes(msgs[since:]))
+	}))
+	inv := Invitation{Address: []byte(base32c.Encode(id[:])), Servers: []string{srv.URL}}
+	dir := t.TempDir()
+	post := func(i byte) {
+		mock.Post(ctx, Message{Decryption: &structs.DecryptionMessage{Output: []byte{i}}})
+	}
+	post(0)
+	post(1)
+	bc, err := NewBroadcastClient(inv, WithMessageCache(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bc.Params(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, err := bc.Get(ctx); err != nil || len(msgs) != 2 {
+		t.Fatalf("%d messages: %v", len(msgs), err)
+	}
+	bc.Close()
+	// A restarted client only downloads the new messages
+	post(2)
+	bc, err = NewBroadcastClient(inv, WithMessageCache(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := bc.Get(ctx)
+	if err != nil || len(msgs) != 3 || msgs[2].Decryption.Output[0] != 2 || msgs[2].Sequence != 3 {
+		t.Fatalf("%d messages: %v", len(msgs), err)
+	}
+	if len(requested) != 2 || requested[1] != 2 {
+		t.Errorf("requested messages since %v", requested)
+	}
+	bc.Close()
+	// The cache is read while the server is unreachable
+	srv.Close()
+	bc, err = NewBroadcastClient(inv, WithMessageCache(dir), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+	if p, err := bc.Params(ctx); err != nil || p.ElectionId(ServerNetwork) != id {
+		t.Errorf("cached params not read: %v", err)
+	}
+	if msgs, err = bc.Get(ctx); err != nil || len(msgs) != 3 {
+		t.Errorf("%d cached messages: %v", len(msgs), err)
+	}
+	if _, err = NewBroadcastClient(Invitation{Address: []byte("election"), Servers: []string{srv.URL}}, WithMessageCache(dir)); err != ErrCacheWithoutId {
+		t.Errorf("cached election without ID: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package voting
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+var ErrMessageNotFound = errors.New("pebble: message not found")
+
+/*
+Identifies a message by the SHA-256 hash of its bytes, so that the same message has the same ID
+on every channel, whatever its envelope, sequence number or receive time.
+*/
+type MessageID = [32]byte
+
+// Returns the ID of the message.
+func (m Message) Id() MessageID {
+	return util.Hash(m.Bytes())
+}
+
+/*
+Optionally implemented by broadcast channels that look up messages by ID, such as to reconcile
+channels or to check that a receipt refers to a posted message.
+
+Has(ctx context.Context, id MessageID): reports whether the message was posted to the channel.
+GetById(ctx context.Context, id MessageID): returns the message, with its sequence number and
+receive time if the channel knows them, or ErrMessageNotFound.
+*/
+type MessageIndex interface {
+	Has(ctx context.Context, id MessageID) (bool, error)
+	GetById(ctx context.Context, id MessageID) (Message, error)
+}
+
+// Returns the message of the channel with the ID, looking through all the messages unless the channel is a MessageIndex.
+func GetMessageById(ctx context.Context, bc BroadcastChannel, id MessageID) (Message, error) {
+	if idx, ok := bc.(MessageIndex); ok {
+		return idx.GetById(ctx, id)
+	}
+	var found *Message
+	err := ForEachMessage(ctx, bc, func(m Message) error {
+		if found == nil && m.Id() == id {
+			found = &m
+		}
+		return nil
+	})
+	if err != nil {
+		return Message{}, err
+	}
+	if found == nil {
+		return Message{}, ErrMessageNotFound
+	}
+	return *found, nil
+}
+
+// Reports whether the message with the ID was posted to the channel.
+func HasMessage(ctx context.Context, bc BroadcastChannel, id MessageID) (bool, error) {
+	if idx, ok := bc.(MessageIndex); ok {
+		return idx.Has(ctx, id)
+	}
+	_, err := GetMessageById(ctx, bc, id)
+	if err == ErrMessageNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (bc *StoreChannel) Has(ctx context.Context, id MessageID) (bool, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	_, ok := bc.seen[id]
+	return ok, nil
+}
+
+// Reads the message from the store at the position recorded when it was posted.
+func (bc *StoreChannel) GetById(ctx context.Context, id MessageID) (Message, error) {
+	bc.mu.Lock()
+	seq, ok := bc.seen[id]
+	bc.mu.Unlock()
+	if !ok {
+		return Message{}, ErrMessageNotFound
+	}
+	it, err := bc.store.Iterate(ctx, seq-1)
+	if err != nil {
+		return Message{}, err
+	}
+	defer it.Close()
+	return it.Next()
+}
+
+func (bc *TranscriptChannel) Has(ctx context.Context, id MessageID) (bool, error) {
+	_, err := bc.GetById(ctx, id)
+	return err == nil, nil
+}
+
+func (bc *TranscriptChannel) GetById(ctx context.Context, id MessageID) (Message, error) {
+	for _, m := range bc.messages {
+		if m.Id() == id {
+			return m, nil
+		}
+	}
+	return Message{}, ErrMessageNotFound
+}
+
+func (bc *BroadcastClient) Has(ctx context.Context, id MessageID) (bool, error) {
+	_, err := bc.GetById(ctx, id)
+	if err == ErrMessageNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+/*
+Requests the message from the server's messages URI with the id query parameter.
+Servers that do not support the parameter respond with all the messages, which are then searched.
+*/
+func (bc *BroadcastClient) GetById(ctx context.Context, id MessageID) (Message, error) {
+	buf, header, err := bc.get(ctx, bc.messagesURI+"?framing=3&id="+hex.EncodeToString(id[:]), 0)
+	if serr, ok := err.(*statusError); ok && serr.code == http.StatusNotFound {
+		return Message{}, ErrMessageNotFound
+	}
+	if err != nil {
+		return Message{}, err
+	}
+	var msgs []Message
+	if envelopeFraming(header) {
+		msgs, err = decodeEnvelopes(buf, false, bc.skipped())
+	} else {
+		msgs, err = decodeMessages(buf, bc.skipped())
+	}
+	if err != nil {
+		return Message{}, err
+	}
+	return NewTranscriptChannel(bc.id, nil, msgs).GetById(ctx, id)
+}
@@ -0,0 +1,47 @@
+package voting
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+func TestMessageIndex(t *testing.T) {
+	ctx := context.Background()
+	bc := NewMockBroadcastChannel(ElectionID{}, nil)
+	var ids []MessageID
+	for i := 0; i < 3; i++ {
+		m := Message{Decryption: &structs.DecryptionMessage{Output: []byte{byte(i)}}}
+		bc.Post(ctx, m)
+		ids = append(ids, m.Id())
+	}
+	m, err := bc.GetById(ctx, ids[1])
+	if err != nil || m.Sequence != 2 || m.Id() != ids[1] {
+		t.Errorf("message %d: %v", m.Sequence, err)
+	}
+	if _, err = bc.GetById(ctx, MessageID{}); err != ErrMessageNotFound {
+		t.Errorf("unknown message found: %v", err)
+	}
+	msgs, _ := bc.Get(ctx)
+	// Servers ignoring the id parameter list all the messages, which the client searches
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Pebble-Framing", "3")
+		w.Write(EncodeReceiptEnvelopes(msgs))
+	}))
+	defer srv.Close()
+	client, err := NewBroadcastClient(Invitation{Address: []byte("election"), Servers: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range []BroadcastChannel{bc, NewTranscriptChannel(ElectionID{}, nil, msgs), client} {
+		if ok, err := HasMessage(ctx, ch, ids[2]); !ok || err != nil {
+			t.Errorf("%T: message not found: %v", ch, err)
+		}
+		if ok, err := HasMessage(ctx, ch, MessageID{}); ok || err != nil {
+			t.Errorf("%T: unknown message found: %v", ch, err)
+		}
+	}
+}
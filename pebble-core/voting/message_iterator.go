@@ -0,0 +1,91 @@
+package voting
+
+import (
+	"context"
+	"io"
+)
+
+/*
+Iterates over the messages of a broadcast channel in order.
+
+Next(): returns the next message, or io.EOF after the last one.
+Close(): releases the resources of the iterator, which may be closed before reaching the end.
+*/
+type MessageIterator interface {
+	Next() (Message, error)
+	Close() error
+}
+
+/*
+Optionally implemented by broadcast channels that can read their messages one at a time,
+so that long logs can be processed with bounded memory.
+
+Stream(ctx context.Context): returns an iterator over the messages of the broadcast channel.
+*/
+type MessageStreamer interface {
+	Stream(ctx context.Context) (MessageIterator, error)
+}
+
+type sliceIterator struct {
+	msgs []Message
+}
+
+func (it *sliceIterator) Next() (Message, error) {
+	if len(it.msgs) == 0 {
+		return Message{}, io.EOF
+	}
+	m := it.msgs[0]
+	it.msgs = it.msgs[1:]
+	return m, nil
+}
+
+func (it *sliceIterator) Close() error {
+	it.msgs = nil
+	return nil
+}
+
+// Returns an iterator over the messages of the channel, streaming them if the channel is a MessageStreamer.
+func StreamMessages(ctx context.Context, bc BroadcastChannel) (MessageIterator, error) {
+	if s, ok := bc.(MessageStreamer); ok {
+		return s.Stream(ctx)
+	}
+	msgs, err := bc.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &sliceIterator{msgs}, nil
+}
+
+// Calls f on each message of the channel in order, stopping at the first error.
+func ForEachMessage(ctx context.Context, bc BroadcastChannel, f func(Message) error) error {
+	it, err := StreamMessages(ctx, bc)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for {
+		m, err := it.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = f(m)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Reads the messages of the election channel for which keep returns true, streaming the others past.
+func (e *Election) readMessages(ctx context.Context, keep func(Message) bool) ([]Message, error) {
+	var msgs []Message
+	err := ForEachMessage(ctx, e.channel, func(m Message) error {
+		if keep(m) {
+			msgs = append(msgs, m)
+		}
+		return nil
+	})
+	return msgs, err
+}
@@ -0,0 +1,236 @@
+package voting
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+var ErrStoreSequence = errors.New("pebble: appended message out of sequence")
+
+/*
+Storage of the messages of a broadcast channel, in the order they were stored.
+A StoreChannel implements the posting rules and the watches on top of it,
+so that a new backend only needs to store messages.
+The channel serializes its calls to Append.
+
+Append(ctx context.Context, msgs []Message): stores the messages after the previous ones, all or none of them.
+
+	The messages carry their receive times, and sequence numbers continuing from Len.
+
+Iterate(ctx context.Context, from uint64): returns an iterator over the messages, skipping the first from.
+Len(ctx context.Context): returns the number of messages stored.
+Head(ctx context.Context): returns the ChainHead of the messages stored, which identifies the whole log.
+*/
+type MessageStore interface {
+	Append(ctx context.Context, msgs []Message) error
+	Iterate(ctx context.Context, from uint64) (MessageIterator, error)
+	Len(ctx context.Context) (uint64, error)
+	Head(ctx context.Context) (util.HashValue, error)
+}
+
+var chainHashScheme = util.HashScheme{Algorithm: util.SHA256, Separated: true}
+
+/*
+Returns the head of a log of messages ending with m, given the head prev of the messages
+before it, starting from the zero hash. Only the message bytes are hashed: stores holding
+the same messages in the same order have the same head, whatever their receive times.
+*/
+func ChainHead(prev util.HashValue, m Message) util.HashValue {
+	return chainHashScheme.Sum(util.DomainChain, prev[:], m.Bytes())
+}
+
+// Checks that the messages appended to a store of n messages are numbered from n+1.
+func checkSequence(n uint64, msgs []Message) error {
+	for i, m := range msgs {
+		if m.Sequence != n+uint64(i)+1 {
+			return ErrStoreSequence
+		}
+	}
+	return nil
+}
+
+// A MessageStore keeping the messages in memory.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	messages []Message
+	head     util.HashValue
+}
+
+func NewMemoryStore() *MemoryStore {
+	return new(MemoryStore)
+}
+
+func (s *MemoryStore) Append(ctx context.Context, msgs []Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := checkSequence(uint64(len(s.messages)), msgs); err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		s.head = ChainHead(s.head, m)
+	}
+	s.messages = append(s.messages, msgs...)
+	return nil
+}
+
+// Messages are only ever appended, so the iterator reads a snapshot of the stored slice.
+func (s *MemoryStore) Iterate(ctx context.Context, from uint64) (MessageIterator, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if from > uint64(len(s.messages)) {
+		from = uint64(len(s.messages))
+	}
+	return &sliceIterator{s.messages[from:]}, nil
+}
+
+func (s *MemoryStore) Len(ctx context.Context) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return uint64(len(s.messages)), nil
+}
+
+func (s *MemoryStore) Head(ctx context.Context) (util.HashValue, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.head, nil
+}
+
+/*
+A MessageStore appending the messages to a file, in envelopes as served with framing
+version 3, so that the file is also a transcript of the election. The file is read once
+when opened to find the length and the head; iterators then read it one message at a time.
+A batch partially written by a crash is truncated when the file is opened again.
+*/
+type FileStore struct {
+	mu   sync.RWMutex
+	file *os.File
+	// Size of the complete envelopes in the file.
+	size int64
+	n    uint64
+	head util.HashValue
+}
+
+// Opens the store in the file at path, creating it if needed.
+func OpenFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStore{file: f}
+	r := bufio.NewReader(io.NewSectionReader(f, 0, 1<<62))
+	for {
+		m, size, err := readStoredEnvelope(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		s.size += size
+		s.n++
+		s.head = ChainHead(s.head, m)
+	}
+	err = f.Truncate(s.size)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reads the next envelope of the file, returning its message and its size in bytes.
+func readStoredEnvelope(r *bufio.Reader) (Message, int64, error) {
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return Message{}, 0, err
+	}
+	if l > maxMessageSize {
+		return Message{}, 0, util.ErrTooLarge
+	}
+	b := make([]byte, l)
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return Message{}, 0, err
+	}
+	m, _, err := decodeEnvelope(b, true, nil)
+	var w util.BufferWriter
+	w.WriteUvarint(l)
+	return m, int64(len(w.Buffer)) + int64(l), err
+}
+
+func (s *FileStore) Append(ctx context.Context, msgs []Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := checkSequence(s.n, msgs); err != nil {
+		return err
+	}
+	p := EncodeReceiptEnvelopes(msgs)
+	_, err := s.file.WriteAt(p, s.size)
+	if err == nil {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		// Readers stop at the known size, and the next append overwrites the rest
+		return err
+	}
+	s.size += int64(len(p))
+	s.n += uint64(len(msgs))
+	for _, m := range msgs {
+		s.head = ChainHead(s.head, m)
+	}
+	return nil
+}
+
+func (s *FileStore) Iterate(ctx context.Context, from uint64) (MessageIterator, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	it := &fileIterator{r: bufio.NewReader(io.NewSectionReader(s.file, 0, s.size))}
+	for ; from != 0; from-- {
+		_, err := it.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return it, nil
+}
+
+func (s *FileStore) Len(ctx context.Context) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.n, nil
+}
+
+func (s *FileStore) Head(ctx context.Context) (util.HashValue, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.head, nil
+}
+
+// Closes the file. The store cannot be used afterwards.
+func (s *FileStore) Close() error {
+	return s.file.Close()
+}
+
+// Reads the messages of a FileStore up to its size when the iterator was created.
+type fileIterator struct {
+	r *bufio.Reader
+}
+
+func (it *fileIterator) Next() (Message, error) {
+	m, _, err := readStoredEnvelope(it.r)
+	return m, err
+}
+
+func (it *fileIterator) Close() error {
+	return nil
+}
@@ -0,0 +1,75 @@
+package voting
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "messages")
+	fs, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := NewMemoryStore()
+	var posted []Message
+	for i := 0; i < 4; i++ {
+		posted = append(posted, Message{Decryption: &structs.DecryptionMessage{Output: []byte{byte(i)}}, PowNonce: uint64(i)})
+	}
+	bc, err := NewStoreChannel(ctx, ElectionID{}, nil, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.PostAll(ctx, posted[:3])
+	mbc, _ := NewStoreChannel(ctx, ElectionID{}, nil, mem)
+	mbc.PostAll(ctx, posted[:3])
+	if err = fs.Append(ctx, []Message{posted[3]}); err != ErrStoreSequence {
+		t.Errorf("append out of sequence: %v", err)
+	}
+	fh, _ := fs.Head(ctx)
+	mh, _ := mem.Head(ctx)
+	if fh != mh {
+		t.Error("heads of the same messages differ")
+	}
+	fs.Close()
+
+	// A partially written envelope is dropped when reopening
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.Write([]byte{100, 1})
+	f.Close()
+	fs, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	if n, _ := fs.Len(ctx); n != 3 {
+		t.Fatalf("%d messages after reopening", n)
+	}
+	if h, _ := fs.Head(ctx); h != mh {
+		t.Error("head changed after reopening")
+	}
+	bc, err = NewStoreChannel(ctx, ElectionID{}, nil, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.SetReportDuplicates(true)
+	if err = bc.Post(ctx, posted[1]); err != ErrDuplicateMessage {
+		t.Errorf("duplicate of a stored message: %v", err)
+	}
+	if err = bc.Post(ctx, posted[3]); err != nil {
+		t.Fatal(err)
+	}
+	it, _ := fs.Iterate(ctx, 2)
+	defer it.Close()
+	for i := 2; i < 4; i++ {
+		m, err := it.Next()
+		if err != nil || m.Sequence != uint64(i+1) || m.PowNonce != uint64(i) || m.Decryption.Output[0] != byte(i) {
+			t.Fatalf("message %d: %+v, %v", i, m, err)
+		}
+	}
+}
@@ -1,33 +1,93 @@
 package methods
 
-import "github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+import (
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+// Parameters of approval voting.
+// MaxApprovals bounds the number of choices approved by a ballot, 0 meaning no bound.
+type ApprovalParams struct {
+	MaxApprovals uint16
+}
+
+func (p ApprovalParams) Bytes() []byte {
+	var w util.BufferWriter
+	w.WriteUint16(p.MaxApprovals)
+	return w.Buffer
+}
+
+func (p *ApprovalParams) FromBytes(b []byte) error {
+	r := util.NewBufferReader(b)
+	var err error
+	p.MaxApprovals, err = r.ReadUint16()
+	if err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return ErrInvalidMethodParams
+	}
+	return nil
+}
 
 type ApprovalVoting struct {
-	choices int
+	choices      int
+	maxApprovals int
 }
 
-func (m *ApprovalVoting) Vote(choices ...int) structs.Ballot {
+func newApprovalVoting(numChoices int, params []byte) (*ApprovalVoting, error) {
+	m := &ApprovalVoting{choices: numChoices}
+	if len(params) == 0 {
+		return m, nil
+	}
+	var p ApprovalParams
+	if p.FromBytes(params) != nil || int(p.MaxApprovals) > numChoices {
+		return nil, ErrInvalidMethodParams
+	}
+	m.maxApprovals = int(p.MaxApprovals)
+	return m, nil
+}
+
+// Approving no choice casts a blank ballot, of the same length as the other ballots.
+func (m *ApprovalVoting) Vote(choices ...int) (structs.Ballot, error) {
+	if err := checkChoices(choices, m.choices); err != nil {
+		return nil, err
+	}
+	if m.maxApprovals != 0 && len(choices) > m.maxApprovals {
+		return nil, ErrTooManyChoices
+	}
 	b := make(structs.Ballot, m.choices)
 	for _, c := range choices {
 		b[c] = 1
 	}
-	return b
+	return b, nil
 }
 
 func (m *ApprovalVoting) Tally(ballots []structs.Ballot) Tally {
-	tally := make(Tally, m.choices)
-	for i := 0; i < m.choices; i++ {
-		tally[i].Index = i
-	}
+	tally := newTally(m.choices)
 loop:
 	for _, b := range ballots {
+		// Empty ballots are blank ballots of earlier versions
+		if len(b) == 0 {
+			tally.addBlank()
+			continue
+		}
 		if len(b) != m.choices {
 			continue
 		}
+		approvals := 0
 		for _, approval := range b {
 			if approval > 1 {
 				continue loop
 			}
+			approvals += int(approval)
+		}
+		if approvals == 0 {
+			tally.addBlank()
+			continue
+		}
+		if m.maxApprovals != 0 && approvals > m.maxApprovals {
+			continue
 		}
 		for i, approval := range b {
 			tally[i].Count += uint64(approval)
@@ -0,0 +1,78 @@
+package methods
+
+import "github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+
+/*
+Implemented by methods whose ballots are vectors of 0/1 slots summing to 1,
+which elections with trustees encrypt slot by slot and tally homomorphically:
+only the per-slot sums are decrypted, never individual ballots.
+*/
+type HomomorphicMethod interface {
+	VotingMethod
+	// Number of slots of a ballot.
+	Slots() int
+	// Builds the tally from the decrypted per-slot sums.
+	TallyCounts(counts []uint64) Tally
+}
+
+/*
+Plurality voting with homomorphic tallying.
+Ballots have one slot per choice followed by a blank slot, exactly one of which is set.
+*/
+type HomomorphicPluralityVoting struct {
+	choices int
+}
+
+func (m *HomomorphicPluralityVoting) Slots() int {
+	return m.choices + 1
+}
+
+func (m *HomomorphicPluralityVoting) Vote(choices ...int) (structs.Ballot, error) {
+	if len(choices) > 1 {
+		return nil, ErrTooManyChoices
+	}
+	if err := checkChoices(choices, m.choices); err != nil {
+		return nil, err
+	}
+	b := make(structs.Ballot, m.Slots())
+	if len(choices) == 0 {
+		b[m.choices] = 1
+	} else {
+		b[choices[0]] = 1
+	}
+	return b, nil
+}
+
+// Tallies plaintext ballots, skipping ballots that are not a single set slot.
+func (m *HomomorphicPluralityVoting) Tally(ballots []structs.Ballot) Tally {
+	counts := make([]uint64, m.Slots())
+loop:
+	for _, b := range ballots {
+		if len(b) != m.Slots() {
+			continue
+		}
+		set := -1
+		for i, v := range b {
+			if v > 1 || (v == 1 && set >= 0) {
+				continue loop
+			}
+			if v == 1 {
+				set = i
+			}
+		}
+		if set >= 0 {
+			counts[set]++
+		}
+	}
+	return m.TallyCounts(counts)
+}
+
+func (m *HomomorphicPluralityVoting) TallyCounts(counts []uint64) Tally {
+	tally := newTally(m.choices)
+	for i := range tally {
+		if i < len(counts) {
+			tally[i].Count = counts[i]
+		}
+	}
+	return tally
+}
@@ -0,0 +1,69 @@
+package methods
+
+import (
+	"errors"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+var ErrContestCount = errors.New("pebble: wrong number of contests in ballot")
+
+// Combines the voting methods of several contests.
+// A multi-contest ballot holds one vector per contest, in contest order,
+// each containing the ballot of that contest's voting method.
+type MultiContest struct {
+	Methods []VotingMethod
+}
+
+// Creates a ballot from the selections of each contest.
+func (m *MultiContest) Vote(choices [][]int) (structs.Ballot, error) {
+	if len(choices) != len(m.Methods) {
+		return nil, ErrContestCount
+	}
+	var w util.BufferWriter
+	for i, method := range m.Methods {
+		b, err := method.Vote(choices[i]...)
+		if err != nil {
+			return nil, err
+		}
+		w.WriteVector(b)
+	}
+	return w.Buffer, nil
+}
+
+// Splits a multi-contest ballot into the ballots of each contest.
+func (m *MultiContest) Split(b structs.Ballot) ([]structs.Ballot, error) {
+	r := util.NewBufferReader(b)
+	ballots := make([]structs.Ballot, len(m.Methods))
+	for i := range ballots {
+		p, err := r.ReadVector()
+		if err != nil {
+			return nil, err
+		}
+		ballots[i] = p
+	}
+	if r.Len() != 0 {
+		return nil, ErrContestCount
+	}
+	return ballots, nil
+}
+
+// Tallies each contest separately. Malformed ballots are ignored in every contest.
+func (m *MultiContest) Tally(ballots []structs.Ballot) []Tally {
+	perContest := make([][]structs.Ballot, len(m.Methods))
+	for _, b := range ballots {
+		split, err := m.Split(b)
+		if err != nil {
+			continue
+		}
+		for i, cb := range split {
+			perContest[i] = append(perContest[i], cb)
+		}
+	}
+	tallies := make([]Tally, len(m.Methods))
+	for i, method := range m.Methods {
+		tallies[i] = method.Tally(perContest[i])
+	}
+	return tallies
+}
@@ -0,0 +1,33 @@
+package methods
+
+import (
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+func TestMultiContestTally(t *testing.T) {
+	m := &MultiContest{Methods: []VotingMethod{&PluralityVoting{3}, &ApprovalVoting{choices: 2}}}
+	var ballots []structs.Ballot
+	for _, choices := range [][][]int{{{0}, {0, 1}}, {{2}, {1}}, {{2}, {}}} {
+		b, err := m.Vote(choices)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ballots = append(ballots, b)
+	}
+	ballots = append(ballots, structs.Ballot{1, 2})
+	tallies := m.Tally(ballots)
+	if len(tallies) != 2 {
+		t.Fatalf("expected 2 tallies, got %d", len(tallies))
+	}
+	if tallies[0][0].Count != 1 || tallies[0][2].Count != 2 {
+		t.Errorf("unexpected plurality tally %v", tallies[0])
+	}
+	if tallies[1][0].Count != 1 || tallies[1][1].Count != 2 {
+		t.Errorf("unexpected approval tally %v", tallies[1])
+	}
+	if _, err := m.Vote([][]int{{0}}); err != ErrContestCount {
+		t.Error("expected contest count error")
+	}
+}
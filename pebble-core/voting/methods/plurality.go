@@ -2,28 +2,64 @@ package methods
 
 import "github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
 
+/*
+Plurality voting. A ballot holds the index of the choice, big-endian over the fewest bytes
+leaving the all-0xFF value unused, which marks blank ballots: every ballot of an election has
+the same length, so the ciphertext length does not reveal blank votes.
+*/
 type PluralityVoting struct {
 	choices int
 }
 
-func (m *PluralityVoting) Vote(choices ...int) structs.Ballot {
-	if len(choices) != 1 {
-		panic("more than one choice in plurality voting")
+// Returns the length of the ballots.
+func (m *PluralityVoting) width() int {
+	n := 1
+	for m.choices >= 1<<(8*n)-1 {
+		n++
 	}
-	return []byte{byte(choices[0])}
+	return n
 }
 
-func (m *PluralityVoting) Tally(ballots []structs.Ballot) Tally {
-	tally := make(Tally, m.choices)
-	for i := 0; i < m.choices; i++ {
-		tally[i].Index = i
+func (m *PluralityVoting) Vote(choices ...int) (structs.Ballot, error) {
+	if len(choices) > 1 {
+		return nil, ErrTooManyChoices
+	}
+	if err := checkChoices(choices, m.choices); err != nil {
+		return nil, err
+	}
+	b := make(structs.Ballot, m.width())
+	c := -1
+	if len(choices) == 1 {
+		c = choices[0]
 	}
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(c)
+		c >>= 8
+	}
+	return b, nil
+}
+
+func (m *PluralityVoting) Tally(ballots []structs.Ballot) Tally {
+	tally := newTally(m.choices)
 	for _, b := range ballots {
-		if len(b) != 1 {
+		// Empty ballots are blank ballots of earlier versions
+		if len(b) == 0 {
+			tally.addBlank()
+			continue
+		}
+		if len(b) != m.width() {
+			continue
+		}
+		c, blank := 0, true
+		for _, v := range b {
+			c = c<<8 | int(v)
+			blank = blank && v == 0xFF
+		}
+		if blank {
+			tally.addBlank()
 			continue
 		}
-		c := int(b[0])
-		if c > m.choices {
+		if c >= m.choices {
 			continue
 		}
 		tally[c].Count++
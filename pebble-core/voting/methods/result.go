@@ -0,0 +1,198 @@
+package methods
+
+import (
+	"errors"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+var ErrInvalidResult = errors.New("pebble: invalid result encoding")
+
+// Upper bound on the choices, winners and rounds of a decoded result.
+const maxResultEntries = 1 << 16
+
+/*
+The count of a choice in a result. Percent is the share of the votes for choices,
+excluding blank ballots; with approval voting, the share of all approvals.
+*/
+type ChoiceResult struct {
+	Index   int     `json:"index"`
+	Count   uint64  `json:"count"`
+	Percent float64 `json:"percent"`
+}
+
+/*
+A round of a multi-round method, such as instant-runoff or single transferable vote:
+the counts of the choices still in the running, and the choices elected or
+eliminated at the end of the round.
+*/
+type RoundResult struct {
+	Counts     []ChoiceResult `json:"counts"`
+	Elected    []int          `json:"elected,omitempty"`
+	Eliminated []int          `json:"eliminated,omitempty"`
+}
+
+/*
+The structured result of a contest, which callers can render without knowing the voting method.
+Choices holds the final count of every choice in index order, and Winners the winning choices
+in order, ties broken with the tie-break seed. Rounds is empty for single-round methods.
+*/
+type Result struct {
+	Blank   uint64         `json:"blank"`
+	Choices []ChoiceResult `json:"choices"`
+	Winners []int          `json:"winners"`
+	Rounds  []RoundResult  `json:"rounds,omitempty"`
+}
+
+// Returns the counts of the choices of the tally in index order, with their percentages.
+func choiceResults(t Tally) []ChoiceResult {
+	choices := t.Choices()
+	res := make([]ChoiceResult, len(choices))
+	for i, c := range choices {
+		res[i] = ChoiceResult{Index: c.Index, Count: c.Count}
+	}
+	setPercents(res)
+	return res
+}
+
+func setPercents(counts []ChoiceResult) {
+	var total uint64
+	for _, c := range counts {
+		total += c.Count
+	}
+	for i := range counts {
+		counts[i].Percent = 0
+		if total != 0 {
+			counts[i].Percent = 100 * float64(counts[i].Count) / float64(total)
+		}
+	}
+}
+
+// Builds the result of a single-round method electing the choice with the highest count.
+func singleWinnerResult(t Tally, seed util.HashValue) Result {
+	r := Result{Blank: t.Blank(), Choices: choiceResults(t), Winners: []int{}}
+	if winner, ok := t.Winner(seed); ok {
+		r.Winners = append(r.Winners, winner)
+	}
+	return r
+}
+
+func (m *PluralityVoting) Result(t Tally, seed util.HashValue) Result {
+	return singleWinnerResult(t, seed)
+}
+
+func (m *ApprovalVoting) Result(t Tally, seed util.HashValue) Result {
+	return singleWinnerResult(t, seed)
+}
+
+func (m *HomomorphicPluralityVoting) Result(t Tally, seed util.HashValue) Result {
+	return singleWinnerResult(t, seed)
+}
+
+func writeChoiceResults(w *util.BufferWriter, counts []ChoiceResult) {
+	w.WriteUvarint(uint64(len(counts)))
+	for _, c := range counts {
+		w.WriteUvarint(uint64(c.Index))
+		w.WriteUvarint(c.Count)
+	}
+}
+
+func writeIndices(w *util.BufferWriter, indices []int) {
+	w.WriteUvarint(uint64(len(indices)))
+	for _, i := range indices {
+		w.WriteUvarint(uint64(i))
+	}
+}
+
+/*
+Serializes the result. Percentages are not encoded, as they follow from the counts.
+Each list is prefixed with its length and choice indices and counts are varints:
+
+	blank, choices (index, count), winners, rounds (counts, elected, eliminated)
+*/
+func (r *Result) Bytes() []byte {
+	var w util.BufferWriter
+	w.WriteUvarint(r.Blank)
+	writeChoiceResults(&w, r.Choices)
+	writeIndices(&w, r.Winners)
+	w.WriteUvarint(uint64(len(r.Rounds)))
+	for _, round := range r.Rounds {
+		writeChoiceResults(&w, round.Counts)
+		writeIndices(&w, round.Elected)
+		writeIndices(&w, round.Eliminated)
+	}
+	return w.Buffer
+}
+
+func readChoiceResults(r *util.BufferReader) ([]ChoiceResult, error) {
+	// Each entry has an index and a count
+	n, err := r.ReadCount(maxResultEntries, 2)
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]ChoiceResult, n)
+	for i := range counts {
+		index, err := r.ReadUvarintMax(maxResultEntries)
+		if err != nil {
+			return nil, err
+		}
+		counts[i].Index = int(index)
+		if counts[i].Count, err = r.ReadUvarint(); err != nil {
+			return nil, err
+		}
+	}
+	setPercents(counts)
+	return counts, nil
+}
+
+func readIndices(r *util.BufferReader) ([]int, error) {
+	n, err := r.ReadCount(maxResultEntries, 1)
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]int, n)
+	for i := range indices {
+		index, err := r.ReadUvarintMax(maxResultEntries)
+		if err != nil {
+			return nil, err
+		}
+		indices[i] = int(index)
+	}
+	return indices, nil
+}
+
+func (r *Result) FromBytes(p []byte) error {
+	br := util.NewBufferReader(p)
+	var err error
+	if r.Blank, err = br.ReadUvarint(); err != nil {
+		return err
+	}
+	if r.Choices, err = readChoiceResults(br); err != nil {
+		return err
+	}
+	if r.Winners, err = readIndices(br); err != nil {
+		return err
+	}
+	n, err := br.ReadUvarintMax(maxResultEntries)
+	if err != nil {
+		return err
+	}
+	r.Rounds = nil
+	for i := uint64(0); i < n; i++ {
+		var round RoundResult
+		if round.Counts, err = readChoiceResults(br); err != nil {
+			return err
+		}
+		if round.Elected, err = readIndices(br); err != nil {
+			return err
+		}
+		if round.Eliminated, err = readIndices(br); err != nil {
+			return err
+		}
+		r.Rounds = append(r.Rounds, round)
+	}
+	if br.Len() != 0 {
+		return ErrInvalidResult
+	}
+	return nil
+}
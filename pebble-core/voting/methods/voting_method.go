@@ -1,20 +1,37 @@
 package methods
 
 import (
+	"bytes"
 	"errors"
 	"sort"
 
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
 )
 
-var ErrUnknownVotingMethod = errors.New("pebble: unknown voting method")
+var (
+	ErrUnknownVotingMethod = errors.New("pebble: unknown voting method")
+	ErrInvalidMethodParams = errors.New("pebble: invalid voting method parameters")
+	ErrInvalidChoice       = errors.New("pebble: invalid or repeated choice")
+	ErrTooManyChoices      = errors.New("pebble: more choices than the voting method allows")
+)
 
-func Get(method string, numChoices int) (VotingMethod, error) {
+// Returns the voting method with the given name.
+// params is the method-specific parameters blob from the ElectionParams, parsed by the method.
+func Get(method string, numChoices int, params []byte) (VotingMethod, error) {
 	switch method {
 	case "Approval":
-		return &ApprovalVoting{numChoices}, nil
+		return newApprovalVoting(numChoices, params)
 	case "Plurality":
+		if len(params) != 0 {
+			return nil, ErrInvalidMethodParams
+		}
 		return &PluralityVoting{numChoices}, nil
+	case "HomomorphicPlurality":
+		if len(params) != 0 {
+			return nil, ErrInvalidMethodParams
+		}
+		return &HomomorphicPluralityVoting{numChoices}, nil
 	default:
 		return nil, ErrUnknownVotingMethod
 	}
@@ -25,11 +42,76 @@ type TallyCount struct {
 	Count uint64
 }
 
+// Index of the tally entry counting blank ballots.
+// A blank ballot is cast by voting with no choices, and has the length of the other ballots of the method.
+const BlankIndex = -1
+
+/*
+Per-choice counts, followed by an entry with index BlankIndex counting blank ballots.
+The tally therefore has one more entry than there are choices: use Choices to index the
+counts by choice, and Blank for the blank count.
+*/
 type Tally []TallyCount
 
+// Creates a tally for the given number of choices, with a trailing blank entry.
+func newTally(choices int) Tally {
+	tally := make(Tally, choices+1)
+	for i := 0; i < choices; i++ {
+		tally[i].Index = i
+	}
+	tally[choices].Index = BlankIndex
+	return tally
+}
+
+func (t Tally) addBlank() {
+	for i := range t {
+		if t[i].Index == BlankIndex {
+			t[i].Count++
+			return
+		}
+	}
+}
+
+// Returns the number of blank ballots.
+func (t Tally) Blank() uint64 {
+	for _, c := range t {
+		if c.Index == BlankIndex {
+			return c.Count
+		}
+	}
+	return 0
+}
+
+// Returns the per-choice counts, without the blank entry.
+func (t Tally) Choices() Tally {
+	res := make(Tally, 0, len(t))
+	for _, c := range t {
+		if c.Index != BlankIndex {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// Vote with no choices returns a blank ballot, and fails with ErrInvalidChoice or ErrTooManyChoices
+// for choices the tally would not count.
+// Result describes a tally of the method, breaking ties with the seed.
 type VotingMethod interface {
-	Vote(choices ...int) structs.Ballot
+	Vote(choices ...int) (structs.Ballot, error)
 	Tally(ballots []structs.Ballot) Tally
+	Result(t Tally, seed util.HashValue) Result
+}
+
+// Checks that the choices are distinct indices of one of numChoices choices.
+func checkChoices(choices []int, numChoices int) error {
+	seen := make(map[int]bool, len(choices))
+	for _, c := range choices {
+		if c < 0 || c >= numChoices || seen[c] {
+			return ErrInvalidChoice
+		}
+		seen[c] = true
+	}
+	return nil
 }
 
 func (t Tally) Sort() {
@@ -52,3 +134,39 @@ func (t Tally) Swap(i, j int) {
 	t[i] = t[j]
 	t[j] = tmp
 }
+
+// Returns the key ordering tied choices: Hash(seed || index).
+func tieBreakKey(seed util.HashValue, index int) util.HashValue {
+	var w util.BufferWriter
+	w.WriteUint32(uint32(index))
+	return util.HashAll(seed[:], w.Buffer)
+}
+
+/*
+Returns the choices ranked by decreasing count, without the blank entry.
+Ties are broken by ordering the tied choices by increasing Hash(seed || index),
+with the index as a 4-byte big-endian integer, so anyone knowing the seed can
+recompute the ranking.
+*/
+func (t Tally) Rank(seed util.HashValue) Tally {
+	ranked := t.Choices()
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Count != ranked[j].Count {
+			return ranked[i].Count > ranked[j].Count
+		}
+		ki := tieBreakKey(seed, ranked[i].Index)
+		kj := tieBreakKey(seed, ranked[j].Index)
+		return bytes.Compare(ki[:], kj[:]) < 0
+	})
+	return ranked
+}
+
+// Returns the index of the winning choice, breaking ties with the seed as in Rank.
+// Returns false if there are no choices.
+func (t Tally) Winner(seed util.HashValue) (int, bool) {
+	ranked := t.Rank(seed)
+	if len(ranked) == 0 {
+		return 0, false
+	}
+	return ranked[0].Index, true
+}
@@ -0,0 +1,139 @@
+package methods
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+// Returns the ballot of the choices, failing the test if they are invalid.
+func vote(t *testing.T, m VotingMethod, choices ...int) structs.Ballot {
+	t.Helper()
+	b, err := m.Vote(choices...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestBlankBallots(t *testing.T) {
+	m := &PluralityVoting{2}
+	ballots := []structs.Ballot{vote(t, m), vote(t, m, 1), vote(t, m), {5}}
+	tally := m.Tally(ballots)
+	if tally.Blank() != 2 {
+		t.Errorf("expected 2 blank ballots, got %d", tally.Blank())
+	}
+	choices := tally.Choices()
+	if len(choices) != 2 || choices[0].Count != 0 || choices[1].Count != 1 {
+		t.Errorf("unexpected choice counts %v", choices)
+	}
+	// Blank ballots have the length of the other ballots
+	for _, m := range []VotingMethod{&PluralityVoting{2}, &PluralityVoting{300}, &ApprovalVoting{choices: 3}} {
+		blank, vote := vote(t, m), vote(t, m, 1)
+		if len(blank) != len(vote) {
+			t.Errorf("%T: blank ballot of %d bytes, vote of %d", m, len(blank), len(vote))
+		}
+		tally := m.Tally([]structs.Ballot{blank, vote, {}})
+		if tally.Blank() != 2 || tally.Choices()[1].Count != 1 {
+			t.Errorf("%T: unexpected tally %v", m, tally)
+		}
+	}
+	if m := (&PluralityVoting{300}); m.Tally([]structs.Ballot{vote(t, m, 299)}).Choices()[299].Count != 1 {
+		t.Error("choice above 255 not counted")
+	}
+}
+
+func TestApprovalParams(t *testing.T) {
+	params := ApprovalParams{MaxApprovals: 1}.Bytes()
+	m, err := Get("Approval", 3, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tally := m.Tally([]structs.Ballot{vote(t, m, 0), {1, 1, 0}})
+	if tally[0].Count != 1 || tally[1].Count != 0 {
+		t.Errorf("ballot exceeding MaxApprovals was counted: %v", tally)
+	}
+	if _, err = m.Vote(0, 1); err != ErrTooManyChoices {
+		t.Errorf("vote exceeding MaxApprovals: %v", err)
+	}
+	for _, choices := range [][]int{{3}, {-1}, {0, 0}} {
+		if _, err = m.Vote(choices...); err != ErrInvalidChoice {
+			t.Errorf("vote for %v: %v", choices, err)
+		}
+	}
+	if _, err = (&PluralityVoting{3}).Vote(0, 1); err != ErrTooManyChoices {
+		t.Errorf("plurality vote for two choices: %v", err)
+	}
+	if _, err = Get("Approval", 3, ApprovalParams{MaxApprovals: 4}.Bytes()); err != ErrInvalidMethodParams {
+		t.Error("expected invalid params for MaxApprovals above the number of choices")
+	}
+	if _, err = Get("Plurality", 3, params); err != ErrInvalidMethodParams {
+		t.Error("expected invalid params for plurality")
+	}
+}
+
+func TestRankTieBreak(t *testing.T) {
+	m := &PluralityVoting{3}
+	tally := m.Tally([]structs.Ballot{vote(t, m, 0), vote(t, m, 2), vote(t, m, 1), vote(t, m, 2), vote(t, m, 0)})
+	var seed util.HashValue
+	ranked := tally.Rank(seed)
+	if ranked[2].Index != 1 {
+		t.Errorf("choice with fewest votes ranked %v", ranked)
+	}
+	k0, k2 := tieBreakKey(seed, 0), tieBreakKey(seed, 2)
+	first := 2
+	if bytes.Compare(k0[:], k2[:]) < 0 {
+		first = 0
+	}
+	if winner, ok := tally.Winner(seed); !ok || winner != first {
+		t.Errorf("expected winner %d, got %d", first, winner)
+	}
+}
+
+func TestHomomorphicPlurality(t *testing.T) {
+	m, err := Get("HomomorphicPlurality", 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hm, ok := m.(HomomorphicMethod)
+	if !ok || hm.Slots() != 3 {
+		t.Fatal("expected a homomorphic method with a blank slot")
+	}
+	if !bytes.Equal(vote(t, m), structs.Ballot{0, 0, 1}) {
+		t.Error("blank vote should set the blank slot")
+	}
+	tally := m.Tally([]structs.Ballot{vote(t, m, 1), vote(t, m), vote(t, m, 1), {1, 1, 0}})
+	if tally[1].Count != 2 || tally.Blank() != 1 || tally[0].Count != 0 {
+		t.Errorf("unexpected tally %v", tally)
+	}
+}
+
+func TestResult(t *testing.T) {
+	m, err := Get("Plurality", 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tally := m.Tally([]structs.Ballot{vote(t, m, 0), vote(t, m, 2), vote(t, m, 2), vote(t, m), vote(t, m, 1)})
+	r := m.Result(tally, util.HashValue{})
+	if r.Blank != 1 || len(r.Choices) != 3 || r.Choices[2].Count != 2 || r.Choices[2].Percent != 50 {
+		t.Errorf("unexpected choices %+v", r.Choices)
+	}
+	if len(r.Winners) != 1 || r.Winners[0] != 2 {
+		t.Errorf("unexpected winners %v", r.Winners)
+	}
+	r.Rounds = []RoundResult{{Counts: r.Choices, Eliminated: []int{1}}}
+	var decoded Result
+	if err = decoded.FromBytes(r.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Choices, r.Choices) || !reflect.DeepEqual(decoded.Winners, r.Winners) ||
+		len(decoded.Rounds) != 1 || !reflect.DeepEqual(decoded.Rounds[0].Eliminated, []int{1}) {
+		t.Errorf("result not preserved: %+v", decoded)
+	}
+	if decoded.FromBytes(append(r.Bytes(), 0)) != ErrInvalidResult {
+		t.Error("trailing bytes accepted")
+	}
+}
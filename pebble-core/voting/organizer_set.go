@@ -0,0 +1,347 @@
+package voting
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+var (
+	ErrInvalidOrganizerSet  = errors.New("pebble: invalid organizer key set")
+	ErrOrganizerThreshold   = errors.New("pebble: organizer action signed by fewer organizers than the threshold")
+	ErrNotOrganizerAction   = errors.New("pebble: message is not an organizer action")
+	ErrEligibilityUnchanged = errors.New("pebble: eligibility list unchanged")
+)
+
+const maxOrganizers = 255
+
+/*
+The organizer keys of an election of which Threshold must sign each organizer action, so that no
+single administrator can alter a live election alone. Amendments, eligibility updates and the
+certification of the result by the organizer then carry the signatures of the keys of the set
+(see Election.Cosign) instead of a signature of the organizer key, which still signs the params.
+*/
+type OrganizerSet struct {
+	Keys      []pubkey.PublicKey
+	Threshold uint32
+}
+
+// Checks that the threshold is reachable and that the keys are distinct.
+func (s *OrganizerSet) Validate() error {
+	if len(s.Keys) == 0 || len(s.Keys) > maxOrganizers || s.Threshold == 0 || int(s.Threshold) > len(s.Keys) {
+		return ErrInvalidOrganizerSet
+	}
+	seen := make(map[string]bool, len(s.Keys))
+	for _, k := range s.Keys {
+		if len(k) == 0 || seen[string(k)] {
+			return ErrInvalidOrganizerSet
+		}
+		seen[string(k)] = true
+	}
+	return nil
+}
+
+func (s *OrganizerSet) Bytes() []byte {
+	var w util.BufferWriter
+	w.WriteUint32(s.Threshold)
+	w.WriteUint32(uint32(len(s.Keys)))
+	for _, k := range s.Keys {
+		w.WriteVector(k)
+	}
+	return w.Buffer
+}
+
+func (s *OrganizerSet) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	s.Threshold, err = r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	n, err := r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	if n > maxOrganizers {
+		return ErrInvalidOrganizerSet
+	}
+	s.Keys = make([]pubkey.PublicKey, n)
+	for i := range s.Keys {
+		s.Keys[i], err = r.ReadVector()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the index of the key in the set, or -1 if it is not in the set.
+func (s *OrganizerSet) index(pk pubkey.PublicKey) int {
+	for i, k := range s.Keys {
+		if bytes.Equal(k, pk) {
+			return i
+		}
+	}
+	return -1
+}
+
+// The signature of the key of an OrganizerSet at Index.
+type organizerSignature struct {
+	Index     uint32
+	Signature []byte
+}
+
+// Encodes the signatures in the signature field of an organizer action, in index order.
+func encodeOrganizerSignatures(sigs []organizerSignature) []byte {
+	var w util.BufferWriter
+	w.WriteUint32(uint32(len(sigs)))
+	for _, sig := range sigs {
+		w.WriteUint32(sig.Index)
+		w.WriteVector(sig.Signature)
+	}
+	return w.Buffer
+}
+
+func decodeOrganizerSignatures(p []byte) ([]organizerSignature, error) {
+	r := util.NewBufferReader(p)
+	n, err := r.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
+	if n > maxOrganizers {
+		return nil, ErrInvalidOrganizerSet
+	}
+	sigs := make([]organizerSignature, n)
+	for i := range sigs {
+		sigs[i].Index, err = r.ReadUint32()
+		if err != nil {
+			return nil, err
+		}
+		sigs[i].Signature, err = r.ReadVector()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sigs, nil
+}
+
+// Returns the signatures sig with the signature of k over msg added, replacing any earlier signature of k.
+func (s *OrganizerSet) cosign(k pubkey.PrivateKey, msg, sig []byte) ([]byte, error) {
+	idx := s.index(k.Public())
+	if idx < 0 {
+		return nil, ErrOrganizerMismatch
+	}
+	var sigs []organizerSignature
+	if len(sig) != 0 {
+		var err error
+		sigs, err = decodeOrganizerSignatures(sig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	signature, err := k.Sign(msg)
+	if err != nil {
+		return nil, err
+	}
+	kept := sigs[:0]
+	for _, other := range sigs {
+		if other.Index != uint32(idx) {
+			kept = append(kept, other)
+		}
+	}
+	sigs = append(kept, organizerSignature{uint32(idx), signature})
+	sort.Slice(sigs, func(i, j int) bool {
+		return sigs[i].Index < sigs[j].Index
+	})
+	return encodeOrganizerSignatures(sigs), nil
+}
+
+// Verifies that sig holds valid signatures over msg by at least Threshold distinct keys of the set.
+func (s *OrganizerSet) Verify(msg, sig []byte) error {
+	sigs, err := decodeOrganizerSignatures(sig)
+	if err != nil {
+		return err
+	}
+	valid := make(map[uint32]bool)
+	for _, entry := range sigs {
+		if int(entry.Index) >= len(s.Keys) || valid[entry.Index] {
+			continue
+		}
+		if s.Keys[entry.Index].Verify(msg, entry.Signature) == nil {
+			valid[entry.Index] = true
+		}
+	}
+	if len(valid) < int(s.Threshold) {
+		return ErrOrganizerThreshold
+	}
+	return nil
+}
+
+// Returns sig with the signature of k over an organizer action msg added: k must be the organizer key, or a key of the organizer set.
+func (p *ElectionParams) signOrganizerAction(k pubkey.PrivateKey, msg, sig []byte) ([]byte, error) {
+	if p.Organizers != nil {
+		return p.Organizers.cosign(k, msg, sig)
+	}
+	if !bytes.Equal(k.Public(), p.Organizer) {
+		return nil, ErrOrganizerMismatch
+	}
+	return k.Sign(msg)
+}
+
+// Verifies the signature of an organizer action msg, against the organizer set if any and the organizer key otherwise.
+func (p *ElectionParams) verifyOrganizerAction(msg, sig []byte) error {
+	if p.Organizers != nil {
+		return p.Organizers.Verify(msg, sig)
+	}
+	return p.Organizer.Verify(msg, sig)
+}
+
+/*
+Reports whether the organizer action m lacks the receive time its phase is checked against.
+Elections from version 11 are served with receive times, so their actions without one are
+skipped rather than trusted with the phase they claim; older elections may lack them.
+*/
+func (p *ElectionParams) missingReceiveTime(m Message) bool {
+	return m.Received.IsZero() && p.Version >= ParamsVersion11
+}
+
+// Returns the signed bytes of the organizer action in m and its signature field.
+func organizerAction(m *Message, eid ElectionID) ([]byte, *[]byte, error) {
+	switch {
+	case m.Amendment != nil:
+		return m.Amendment.signingBytes(eid), &m.Amendment.Signature, nil
+	case m.EligibilityUpdate != nil:
+		return m.EligibilityUpdate.signingBytes(eid), &m.EligibilityUpdate.Signature, nil
+	case m.Certification != nil && m.Certification.Trustee == 0:
+		return m.Certification.signingBytes(eid), &m.Certification.Signature, nil
+	}
+	return nil, nil, ErrNotOrganizerAction
+}
+
+/*
+Adds the signature of the organizer key k to the organizer action in m, prepared with
+PrepareAmendment, PrepareEligibilityUpdate or PrepareCertification.
+Without an organizer set in the params, k must be the organizer key. With one, k must be a key of
+the set, and the organizers pass the action around as m.Bytes() (see MessageFromBytes) until a
+threshold of them signed it.
+*/
+func (e *Election) Cosign(k pubkey.PrivateKey, m *Message) error {
+	if e.base == nil || e.base.Version < ParamsVersion2 {
+		return ErrAmendmentUnsigned
+	}
+	msg, sig, err := organizerAction(m, e.Id())
+	if err != nil {
+		return err
+	}
+	signed, err := e.Params().signOrganizerAction(k, msg, *sig)
+	if err != nil {
+		return err
+	}
+	*sig = signed
+	return nil
+}
+
+/*
+Posts an organizer action signed with Cosign and applies it to the params.
+Fails with ErrOrganizerThreshold if it lacks the signatures of a threshold of the organizer set,
+and with ErrAmendmentNotAllowed or ErrEligibilityUpdateNotAllowed if the election moved on
+from the phase in which the action was prepared.
+*/
+func (e *Election) PostOrganizerAction(ctx context.Context, m Message) error {
+	msg, sig, err := organizerAction(&m, e.Id())
+	if err != nil {
+		return err
+	}
+	if m.Amendment != nil && m.Amendment.Phase != e.Phase() {
+		return ErrAmendmentNotAllowed
+	}
+	if m.EligibilityUpdate != nil && !e.Params().eligibilityUpdatesOpenAt(e.Now()) {
+		return ErrEligibilityUpdateNotAllowed
+	}
+	err = e.Params().verifyOrganizerAction(msg, *sig)
+	if err != nil {
+		return err
+	}
+	var params *ElectionParams
+	if m.Amendment != nil {
+		params, err = m.Amendment.Apply(e.Params())
+	} else if m.EligibilityUpdate != nil {
+		params, err = m.EligibilityUpdate.Apply(e.Params())
+	}
+	if err != nil {
+		return err
+	}
+	err = e.post(ctx, m)
+	if err != nil {
+		return err
+	}
+	if params != nil {
+		e.updateParams(params)
+	}
+	return nil
+}
+
+/*
+Returns the unsigned amendment a to post, with the next sequence number and the current phase,
+after checking it against the rules for that phase.
+*/
+func (e *Election) PrepareAmendment(ctx context.Context, a Amendment) (Message, error) {
+	if e.base == nil || e.base.Version < ParamsVersion2 {
+		return Message{}, ErrAmendmentUnsigned
+	}
+	err := e.Refresh(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+	msgs, err := e.channel.Get(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+	a.Sequence = 0
+	for _, msg := range msgs {
+		if msg.Amendment != nil && msg.Amendment.Sequence >= a.Sequence {
+			a.Sequence = msg.Amendment.Sequence + 1
+		}
+	}
+	a.Phase = e.Phase()
+	a.Signature = nil
+	_, err = a.Apply(e.Params())
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{Amendment: &a}, nil
+}
+
+/*
+Returns the unsigned eligibility update replacing the eligibility list by list during the
+registration window. Fails with ErrEligibilityUnchanged if the lists are the same.
+*/
+func (e *Election) PrepareEligibilityUpdate(ctx context.Context, list *structs.EligibilityList) (Message, error) {
+	u, err := e.eligibilityUpdate(ctx, func(current *structs.EligibilityList) (*structs.EligibilityDiff, error) {
+		return structs.DiffEligibilityLists(current, list)
+	})
+	if err != nil {
+		return Message{}, err
+	}
+	if u == nil {
+		return Message{}, ErrEligibilityUnchanged
+	}
+	return Message{EligibilityUpdate: u}, nil
+}
+
+// Computes the final result and returns its unsigned certification by the organizer.
+func (e *Election) PrepareCertification(ctx context.Context) (Message, error) {
+	if e.base == nil || e.base.Version < ParamsVersion2 {
+		return Message{}, ErrAmendmentUnsigned
+	}
+	c, err := e.certification(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{Certification: c}, nil
+}
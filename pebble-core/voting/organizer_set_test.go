@@ -0,0 +1,125 @@
+package voting
+
+import (
+	"context"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+func TestOrganizerSet(t *testing.T) {
+	ctx := context.Background()
+	host, err := pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admins := make([]pubkey.PrivateKey, 3)
+	set := &OrganizerSet{Threshold: 2}
+	for i := range admins {
+		admins[i], err = pubkey.GenerateKey(pubkey.KeyTypeEd25519)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set.Keys = append(set.Keys, admins[i].Public())
+	}
+	params := generateParamsV1()
+	params.Upgrade(ParamsVersion17)
+	params.Organizers = &OrganizerSet{Keys: set.Keys, Threshold: 4}
+	if err = params.Validate(); err != ErrInvalidOrganizerSet {
+		t.Errorf("unreachable threshold: %v", err)
+	}
+	params.Organizers = set
+	if err = params.Sign(host); err != nil {
+		t.Fatal(err)
+	}
+	var decoded ElectionParams
+	if err = decoded.FromBytes(params.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Organizers == nil || decoded.Organizers.Threshold != 2 || len(decoded.Organizers.Keys) != 3 || decoded.VerifySignature() != nil {
+		t.Fatal("organizer set not preserved")
+	}
+
+	eid := ElectionID{1}
+	e := &Election{channel: NewMockBroadcastChannel(eid, params), params: params, base: params}
+	a := Amendment{Flags: AmendTitle, Title: "Moved"}
+	if err = e.Amend(ctx, admins[0], a); err != ErrOrganizerThreshold {
+		t.Errorf("amendment of a single organizer: %v", err)
+	}
+	if err = e.Amend(ctx, host, a); err != ErrOrganizerMismatch {
+		t.Errorf("amendment of the params signer: %v", err)
+	}
+	m, err := e.PrepareAmendment(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Cosign(admins[0], &m); err != nil {
+		t.Fatal(err)
+	}
+	// Signing again replaces the signature instead of counting twice
+	if err = e.Cosign(admins[0], &m); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.PostOrganizerAction(ctx, m); err != ErrOrganizerThreshold {
+		t.Errorf("amendment signed twice by one organizer: %v", err)
+	}
+	m, err = MessageFromBytes(m.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Cosign(admins[2], &m); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.PostOrganizerAction(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	if e.Params().Title != "Moved" {
+		t.Error("amendment not applied")
+	}
+	msgs, err := e.channel.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applyAmendments(params, eid, msgs).Title != "Moved" {
+		t.Error("amendment not applied by other clients")
+	}
+
+	// A signature listed twice does not reach the threshold
+	forged := *m.Amendment
+	forged.Sequence++
+	forged.Title = "Forged"
+	forged.Signature = nil
+	single := Message{Amendment: &forged, Received: msgs[len(msgs)-1].Received}
+	if err = e.Cosign(admins[1], &single); err != nil {
+		t.Fatal(err)
+	}
+	if forged.Verify(params, eid) == nil {
+		t.Error("amendment of a single organizer verified")
+	}
+	if m.Amendment.Verify(params, eid) != nil {
+		t.Error("cosigned amendment not verified")
+	}
+	sigs, err := decodeOrganizerSignatures(forged.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged.Signature = encodeOrganizerSignatures(append(sigs, sigs[0]))
+	if applyAmendments(params, eid, append(msgs, single)).Title != "Moved" {
+		t.Error("amendment of a single organizer applied")
+	}
+
+	c := ResultCertification{TallyHash: util.Hash([]byte("result"))}
+	m = Message{Certification: &c}
+	for _, k := range admins[1:] {
+		if err = c.Verify(params, eid); err == nil {
+			t.Error("certification verified below the threshold")
+		}
+		if err = e.Cosign(k, &m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = c.Verify(params, eid); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,65 @@
+package voting
+
+import (
+	"errors"
+	"math/bits"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+/*
+Hashcash-style spam protection for open channels: when the params set a PowDifficulty,
+each posted message carries a nonce such that the hash of the election ID, the nonce and
+the message bytes starts with PowDifficulty zero bits. The nonce travels in the message
+envelope, and channel implementations verify it before accepting the message.
+*/
+
+// Prefixed to the hashed proof-of-work data.
+const powContext = "pebble-pow"
+
+// Above this difficulty, messages could not be posted in reasonable time.
+const maxPowDifficulty = 40
+
+var (
+	ErrInvalidPowDifficulty = errors.New("pebble: invalid proof-of-work difficulty")
+	ErrInsufficientWork     = errors.New("pebble: insufficient proof of work")
+)
+
+func powHash(eid ElectionID, nonce uint64, msg []byte) util.HashValue {
+	var w util.BufferWriter
+	w.Write([]byte(powContext))
+	w.Write32(eid)
+	w.WriteUint64(nonce)
+	return util.HashAll(w.Buffer, msg)
+}
+
+// Returns the number of leading zero bits of h.
+func leadingZeroBits(h util.HashValue) int {
+	n := 0
+	for _, b := range h {
+		n += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return n
+}
+
+// Finds a nonce proving difficulty bits of work on the message for the election.
+// Nonces start at 1, a zero nonce meaning that the message carries no proof of work.
+func (m *Message) SolvePow(eid ElectionID, difficulty uint8) {
+	p := m.Bytes()
+	for m.PowNonce = 1; leadingZeroBits(powHash(eid, m.PowNonce, p)) < int(difficulty); m.PowNonce++ {
+	}
+}
+
+// Checks that the message carries a proof of at least difficulty bits of work for the election.
+func (m Message) VerifyPow(eid ElectionID, difficulty uint8) error {
+	if difficulty == 0 {
+		return nil
+	}
+	if m.PowNonce == 0 || leadingZeroBits(powHash(eid, m.PowNonce, m.Bytes())) < int(difficulty) {
+		return ErrInsufficientWork
+	}
+	return nil
+}
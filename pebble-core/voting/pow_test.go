@@ -0,0 +1,52 @@
+package voting
+
+import (
+	"context"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+func TestProofOfWork(t *testing.T) {
+	eid := util.Hash([]byte("election"))
+	m := Message{Decryption: &structs.DecryptionMessage{Output: []byte("output")}}
+	if m.VerifyPow(eid, 8) != ErrInsufficientWork {
+		t.Error("message without proof of work accepted")
+	}
+	m.SolvePow(eid, 8)
+	if err := m.VerifyPow(eid, 8); err != nil {
+		t.Fatal(err)
+	}
+	if m.VerifyPow(util.Hash([]byte("other")), 8) == nil && m.VerifyPow(util.Hash([]byte("third")), 8) == nil {
+		t.Error("proof of work not bound to the election")
+	}
+	decoded, err := DecodeEnvelopeBatch(EncodeEnvelopes([]Message{m}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || decoded[0].PowNonce != m.PowNonce {
+		t.Fatal("nonce not carried by the envelope")
+	}
+	params := generateParamsV1()
+	params.Version = ParamsVersion9
+	params.PowDifficulty = 8
+	if err = params.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	var p ElectionParams
+	if err = p.FromBytes(params.Bytes()); err != nil || p.PowDifficulty != 8 {
+		t.Fatal("difficulty not preserved")
+	}
+	bc := NewMockBroadcastChannel(eid, params)
+	if bc.Post(context.Background(), Message{Decryption: m.Decryption}) != ErrInsufficientWork {
+		t.Error("channel accepted a message without proof of work")
+	}
+	if err = bc.Post(context.Background(), decoded[0]); err != nil {
+		t.Error(err)
+	}
+	params.PowDifficulty = maxPowDifficulty + 1
+	if params.Validate() != ErrInvalidPowDifficulty {
+		t.Error("excessive difficulty accepted")
+	}
+}
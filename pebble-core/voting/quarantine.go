@@ -0,0 +1,65 @@
+package voting
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+A message that could not be read or was rejected, kept for auditors investigating attacks.
+Data holds the raw bytes as received, Source where they came from, such as the
+server URI or the address of the poster, and Reason why the message was dropped.
+*/
+type QuarantinedMessage struct {
+	Time   time.Time
+	Source string
+	Reason string
+	Data   []byte
+}
+
+// Receives the messages dropped by broadcast clients and servers. Implementations must be safe for concurrent use.
+type QuarantineSink interface {
+	Quarantine(m QuarantinedMessage)
+}
+
+// A quarantine sink that auditors can search, such as MemoryQuarantine.
+type QuarantineStore interface {
+	QuarantineSink
+	Query(since time.Time, keep func(QuarantinedMessage) bool) []QuarantinedMessage
+}
+
+// Keeps the latest quarantined messages in memory, dropping the oldest ones beyond the limit.
+type MemoryQuarantine struct {
+	mu      sync.Mutex
+	max     int
+	entries []QuarantinedMessage
+}
+
+// Creates a store of at most max messages; zero keeps all of them.
+func NewMemoryQuarantine(max int) *MemoryQuarantine {
+	return &MemoryQuarantine{max: max}
+}
+
+func (q *MemoryQuarantine) Quarantine(m QuarantinedMessage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.entries = append(q.entries, m)
+	if q.max > 0 && len(q.entries) > q.max {
+		q.entries = append(q.entries[:0:0], q.entries[len(q.entries)-q.max:]...)
+	}
+}
+
+// Returns the messages quarantined at or after since for which keep returns true,
+// oldest first. A nil keep returns all of them.
+func (q *MemoryQuarantine) Query(since time.Time, keep func(QuarantinedMessage) bool) []QuarantinedMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var res []QuarantinedMessage
+	for _, m := range q.entries {
+		if m.Time.Before(since) || (keep != nil && !keep(m)) {
+			continue
+		}
+		res = append(res, m)
+	}
+	return res
+}
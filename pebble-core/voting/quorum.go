@@ -0,0 +1,262 @@
+package voting
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+var (
+	ErrNoQuorum         = errors.New("pebble: not enough servers answered")
+	ErrParamsDiscrepant = errors.New("pebble: servers disagree on the election params")
+)
+
+// A message that was missing from the messages returned by one of the channels of a QuorumChannel.
+type Discrepancy struct {
+	Channel int
+	Missing []Message
+}
+
+/*
+Reads from several broadcast channels of the same election, typically the servers
+listed in an invitation, so that a single lying server cannot hide messages.
+Reads query k of the channels, moving on to the next ones when a channel fails,
+and return the union of their messages in the order they were first seen.
+Messages missing from some of the answers are reported to the discrepancy handler.
+Posts are sent to all the channels and must be accepted by at least k of them.
+*/
+type QuorumChannel struct {
+	channels      []BroadcastChannel
+	k             int
+	onDiscrepancy func(Discrepancy)
+}
+
+func NewQuorumChannel(channels []BroadcastChannel, k int) (*QuorumChannel, error) {
+	if k < 1 || k > len(channels) {
+		return nil, ErrNoQuorum
+	}
+	return &QuorumChannel{channels: channels, k: k}, nil
+}
+
+// Sets the function called with each discrepancy found by a read.
+func (q *QuorumChannel) SetDiscrepancyHandler(f func(Discrepancy)) {
+	q.onDiscrepancy = f
+}
+
+func (q *QuorumChannel) Id() ElectionID {
+	return q.channels[0].Id()
+}
+
+func (q *QuorumChannel) Network() string {
+	return ChannelNetwork(q.channels[0])
+}
+
+/*
+Calls f concurrently on k channels, replacing each failed channel by the next one.
+Returns the indices of the channels for which f succeeded, in order,
+or ErrNoQuorum if fewer than k succeeded.
+*/
+func (q *QuorumChannel) query(f func(i int, bc BroadcastChannel) error) ([]int, error) {
+	var ok []int
+	next := 0
+	for len(ok) < q.k && next < len(q.channels) {
+		n := q.k - len(ok)
+		if n > len(q.channels)-next {
+			n = len(q.channels) - next
+		}
+		errs := make([]error, n)
+		var wg sync.WaitGroup
+		for j := 0; j < n; j++ {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				errs[j] = f(next+j, q.channels[next+j])
+			}(j)
+		}
+		wg.Wait()
+		for j, err := range errs {
+			if err == nil {
+				ok = append(ok, next+j)
+			}
+		}
+		next += n
+	}
+	if len(ok) < q.k {
+		return nil, ErrNoQuorum
+	}
+	return ok, nil
+}
+
+// Returns the params of the election, which all the queried channels must agree on.
+func (q *QuorumChannel) Params(ctx context.Context) (*ElectionParams, error) {
+	params := make([]*ElectionParams, len(q.channels))
+	ok, err := q.query(func(i int, bc BroadcastChannel) (err error) {
+		params[i], err = bc.Params(ctx)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	p := params[ok[0]]
+	for _, i := range ok[1:] {
+		if !bytes.Equal(params[i].Bytes(), p.Bytes()) {
+			return nil, ErrParamsDiscrepant
+		}
+	}
+	return p, nil
+}
+
+func (q *QuorumChannel) Get(ctx context.Context) ([]Message, error) {
+	answers := make([][]Message, len(q.channels))
+	ok, err := q.query(func(i int, bc BroadcastChannel) (err error) {
+		answers[i], err = bc.Get(ctx)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	var union []Message
+	seen := make(map[util.HashValue]bool)
+	sets := make([]map[util.HashValue]bool, len(q.channels))
+	for _, i := range ok {
+		sets[i] = make(map[util.HashValue]bool)
+		for _, m := range answers[i] {
+			h := util.Hash(m.Bytes())
+			sets[i][h] = true
+			if !seen[h] {
+				seen[h] = true
+				union = append(union, m)
+			}
+		}
+	}
+	if q.onDiscrepancy != nil {
+		for _, i := range ok {
+			if len(sets[i]) == len(seen) {
+				continue
+			}
+			d := Discrepancy{Channel: i}
+			for _, m := range union {
+				if !sets[i][util.Hash(m.Bytes())] {
+					d.Missing = append(d.Missing, m)
+				}
+			}
+			q.onDiscrepancy(d)
+		}
+	}
+	return union, nil
+}
+
+// Posts the message to all the channels, succeeding if at least k of them accepted it.
+// A channel that already had the message accepted it.
+func (q *QuorumChannel) Post(ctx context.Context, m Message) error {
+	return q.PostAll(ctx, []Message{m})
+}
+
+func (q *QuorumChannel) PostAll(ctx context.Context, msgs []Message) error {
+	errs := make([]error, len(q.channels))
+	var wg sync.WaitGroup
+	for i, bc := range q.channels {
+		wg.Add(1)
+		go func(i int, bc BroadcastChannel) {
+			defer wg.Done()
+			errs[i] = PostAll(ctx, bc, msgs)
+		}(i, bc)
+	}
+	wg.Wait()
+	accepted := 0
+	var lastErr error
+	for _, err := range errs {
+		if err == nil || err == ErrDuplicateMessage {
+			accepted++
+		} else {
+			lastErr = err
+		}
+	}
+	if accepted < q.k {
+		return lastErr
+	}
+	return nil
+}
+
+// Merges the messages posted to k of the channels, dropping those already sent by another channel.
+func (q *QuorumChannel) Watch(ctx context.Context) (<-chan Message, error) {
+	watches := make([]<-chan Message, len(q.channels))
+	ctx, cancel := context.WithCancel(ctx)
+	ok, err := q.query(func(i int, bc BroadcastChannel) (err error) {
+		watches[i], err = bc.Watch(ctx)
+		return
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	merged := make(chan Message)
+	var wg sync.WaitGroup
+	for _, i := range ok {
+		wg.Add(1)
+		go func(w <-chan Message) {
+			defer wg.Done()
+			for m := range w {
+				select {
+				case merged <- m:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(watches[i])
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+	ch := make(chan Message)
+	go func() {
+		defer cancel()
+		defer close(ch)
+		seen := make(map[util.HashValue]bool)
+		for m := range merged {
+			h := util.Hash(m.Bytes())
+			if seen[h] {
+				continue
+			}
+			seen[h] = true
+			select {
+			case ch <- m:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Retrieves the eligibility list from the first channel distributing it.
+// Lists and proofs can be checked against the root in the params, so a single server is asked.
+func (q *QuorumChannel) EligibilityList(ctx context.Context) (*structs.EligibilityList, error) {
+	for _, bc := range q.channels {
+		if p, ok := bc.(EligibilityProvider); ok {
+			list, err := p.EligibilityList(ctx)
+			if err == nil {
+				return list, nil
+			}
+		}
+	}
+	return nil, ErrNoQuorum
+}
+
+// Retrieves an eligibility proof from the first channel distributing them.
+func (q *QuorumChannel) EligibilityProof(ctx context.Context, pkh util.HashValue) (*structs.EligibilityProof, error) {
+	for _, bc := range q.channels {
+		if p, ok := bc.(EligibilityProvider); ok {
+			proof, err := p.EligibilityProof(ctx, pkh)
+			if err == nil {
+				return proof, nil
+			}
+		}
+	}
+	return nil, ErrNoQuorum
+}
@@ -0,0 +1,57 @@
+package voting
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+type failingChannel struct {
+	*MockBroadcastChannel
+}
+
+func (failingChannel) Get(ctx context.Context) ([]Message, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestQuorumChannel(t *testing.T) {
+	ctx := context.Background()
+	a := NewMockBroadcastChannel(ElectionID{}, nil)
+	b := NewMockBroadcastChannel(ElectionID{}, nil)
+	first := Message{Decryption: &structs.DecryptionMessage{Output: []byte("first")}}
+	hidden := Message{Decryption: &structs.DecryptionMessage{Output: []byte("hidden")}}
+	a.Post(ctx, first)
+	a.Post(ctx, hidden)
+	b.Post(ctx, first)
+	q, err := NewQuorumChannel([]BroadcastChannel{failingChannel{a}, b, a}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []Discrepancy
+	q.SetDiscrepancyHandler(func(d Discrepancy) {
+		found = append(found, d)
+	})
+	msgs, err := q.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || string(msgs[1].Decryption.Output) != "hidden" {
+		t.Error("hidden message not read")
+	}
+	if len(found) != 1 || found[0].Channel != 1 || len(found[0].Missing) != 1 {
+		t.Errorf("discrepancy not flagged: %v", found)
+	}
+	last := Message{Decryption: &structs.DecryptionMessage{Output: []byte("last")}}
+	if err = q.Post(ctx, last); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, _ = b.Get(ctx); len(msgs) != 2 {
+		t.Error("message not posted to all channels")
+	}
+	q, _ = NewQuorumChannel([]BroadcastChannel{failingChannel{a}, b}, 2)
+	if _, err = q.Get(ctx); err != ErrNoQuorum {
+		t.Errorf("read without quorum: %v", err)
+	}
+}
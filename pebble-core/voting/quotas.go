@@ -0,0 +1,53 @@
+package voting
+
+import (
+	"errors"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+var ErrQuotaExceeded = errors.New("pebble: posting quota exceeded")
+
+/*
+Limits on the messages a channel accepts, enforced at post time. Zero limits are unlimited.
+
+CredentialsPerKey: credential messages of epoch zero per eligible public key.
+RotationsPerKey: credential messages of a nonzero epoch per eligible public key, over all epochs,
+so that counting the epoch up does not renew the allowance of a voter.
+BallotsPerSerialNo: signed ballots per credential serial number.
+DecryptionsPerInput: decryption messages per VDF input. Decryptions are not verified at post time,
+so this is kept above one, lest a bogus decryption block the real one.
+Key reveals are counted separately under the same limit.
+*/
+type PostingQuotas struct {
+	CredentialsPerKey   int
+	RotationsPerKey     int
+	BallotsPerSerialNo  int
+	DecryptionsPerInput int
+}
+
+var DefaultPostingQuotas = PostingQuotas{
+	CredentialsPerKey:   1,
+	RotationsPerKey:     4,
+	BallotsPerSerialNo:  1,
+	DecryptionsPerInput: 8,
+}
+
+// Returns the key under which the message is counted and its limit, or an empty key if it is not limited.
+func (q *PostingQuotas) key(m Message) (string, int) {
+	switch {
+	case m.Credential != nil && m.Credential.Epoch != 0 && q.RotationsPerKey != 0:
+		pkh := util.Hash(m.Credential.PublicKey)
+		return "r" + string(pkh[:]), q.RotationsPerKey
+	case m.Credential != nil && m.Credential.Epoch == 0 && q.CredentialsPerKey != 0:
+		pkh := util.Hash(m.Credential.PublicKey)
+		return "c" + string(pkh[:]), q.CredentialsPerKey
+	case m.SignedBallot != nil && q.BallotsPerSerialNo != 0:
+		return "b" + string(m.SignedBallot.SerialNo), q.BallotsPerSerialNo
+	case m.Decryption != nil && q.DecryptionsPerInput != 0:
+		return "d" + string(m.Decryption.InputHash[:]), q.DecryptionsPerInput
+	case m.KeyReveal != nil && q.DecryptionsPerInput != 0:
+		return "k" + string(m.KeyReveal.InputHash[:]), q.DecryptionsPerInput
+	}
+	return "", 0
+}
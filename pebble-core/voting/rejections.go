@@ -0,0 +1,48 @@
+package voting
+
+import (
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+// Reasons for which Progress does not count a ballot.
+type RejectionReason uint8
+
+const (
+	// The ballot signature does not verify against the credential set.
+	RejectInvalidSignature RejectionReason = iota + 1
+	// A ballot with the same serial number was counted before.
+	RejectDuplicateSerialNo
+	// The posted decryption of the ballot is invalid, or decrypts to an unreadable ballot.
+	RejectInvalidDecryption
+	// The encrypted ballot is malformed, or its proofs of well-formedness do not verify.
+	RejectInvalidBallot
+	// The ballot is encrypted with another cipher suite than the params specify.
+	RejectCipherSuite
+	// The VDF puzzle of the ballot declares a difficulty out of the bounds of the params.
+	RejectVdfDifficulty
+)
+
+var rejectionNames = [...]string{"", "invalid-signature", "duplicate-serial-no", "invalid-decryption", "invalid-ballot", "cipher-suite", "vdf-difficulty"}
+
+func (r RejectionReason) String() string {
+	if r != 0 && int(r) < len(rejectionNames) {
+		return rejectionNames[r]
+	}
+	return "unknown"
+}
+
+// A ballot message that was not counted, identified by the hash of its bytes.
+type RejectedMessage struct {
+	Hash   util.HashValue
+	Reason RejectionReason
+}
+
+// Records that the signed ballot was not counted.
+func (p *ElectionProgress) reject(sb *structs.SignedBallot, reason RejectionReason) {
+	if p.Rejections == nil {
+		p.Rejections = make(map[RejectionReason]int)
+	}
+	p.Rejections[reason]++
+	p.Rejected = append(p.Rejected, RejectedMessage{util.Hash(Message{SignedBallot: sb}.Bytes()), reason})
+}
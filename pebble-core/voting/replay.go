@@ -0,0 +1,83 @@
+package voting
+
+import (
+	"context"
+	"errors"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+var ErrReplayResult = errors.New("pebble: recounted result differs from the archived result")
+
+// The outcome of recounting an ended election from its messages.
+type Verification struct {
+	Progress      ElectionProgress
+	Result        *ResultExport
+	TallyHash     util.HashValue
+	Certification CertificationStatus
+}
+
+/*
+Recounts the final result of the election from the messages of its channel, verifying every
+credential, ballot and decryption as Progress does, and collects the certifications posted for it.
+The result is verified once Certification.Certified is set: the organizer, and a threshold of
+trustees if any, then signed the tally hash recomputed here.
+*/
+func (e *Election) Verify(ctx context.Context) (v Verification, err error) {
+	v.Progress, err = e.Progress(ctx)
+	if err != nil {
+		return
+	}
+	if v.Progress.Phase != End {
+		return v, ErrWrongPhase
+	}
+	v.Result = e.resultExport(v.Progress)
+	v.TallyHash = v.Result.Hash(e.Params().HashScheme())
+	v.Certification, err = e.Certification(ctx, v.Progress)
+	return
+}
+
+// Mounts the archive as a read-only broadcast channel, which distributes its full eligibility list if it has one.
+func (a *Archive) Channel() *TranscriptChannel {
+	bc := NewTranscriptChannel(a.Id, a.Params, a.Messages)
+	bc.eligibility = a.Eligibility
+	bc.network = a.Network
+	return bc
+}
+
+// Returns the head of the archived message log (see ChainHead), which identifies the transcript.
+func (a *Archive) TranscriptHash() util.HashValue {
+	if len(a.Checkpoints) == 0 {
+		return util.HashValue{}
+	}
+	return a.Checkpoints[len(a.Checkpoints)-1].Head
+}
+
+// The election mounted from an archive and its recount.
+type ArchiveReplay struct {
+	Election *Election
+	Verification
+	TranscriptHash util.HashValue
+}
+
+/*
+Replays an archive read by ReadArchive, for third-party audits: recounts the election from the
+archived messages with Election.Verify, and checks the recount against the result sealed in the
+archive, if any. The certifications are among the messages, so that Certification tells whether
+the published certifications sign the recounted result. Options are applied to the election,
+e.g. WithTimeSource.
+*/
+func ReplayArchive(ctx context.Context, a *Archive, opts ...ElectionOption) (*ArchiveReplay, error) {
+	e, err := NewElection(ctx, a.Channel(), nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	v, err := e.Verify(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if a.Result != nil && a.TallyHash != v.TallyHash {
+		return nil, ErrReplayResult
+	}
+	return &ArchiveReplay{Election: e, Verification: v, TranscriptHash: a.TranscriptHash()}, nil
+}
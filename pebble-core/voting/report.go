@@ -0,0 +1,240 @@
+package voting
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+)
+
+// A contest of an election in a report.
+type ContestReport struct {
+	Title   string   `json:"title"`
+	Method  string   `json:"method"`
+	Choices []string `json:"choices"`
+}
+
+// The schedule of an election in a report. RegistrationEnd is zero before version 1.
+type ScheduleReport struct {
+	CredGenStart    time.Time `json:"credGenStart"`
+	RegistrationEnd time.Time `json:"registrationEnd"`
+	CastStart       time.Time `json:"castStart"`
+	TallyStart      time.Time `json:"tallyStart"`
+	TallyEnd        time.Time `json:"tallyEnd"`
+}
+
+/*
+The participation in an election in a report: the size of the eligibility list, zero for open
+elections, the credentials registered, the valid ballots cast and the ballots counted so far.
+*/
+type TurnoutReport struct {
+	Eligible   int `json:"eligible"`
+	Registered int `json:"registered"`
+	Cast       int `json:"cast"`
+	Counted    int `json:"counted"`
+}
+
+// The certifications of the result in a report, see CertificationStatus.
+type CertificationReport struct {
+	Certified   bool     `json:"certified"`
+	Organizer   bool     `json:"organizer"`
+	Trustees    []uint32 `json:"trustees,omitempty"`
+	Conflicting int      `json:"conflicting"`
+}
+
+/*
+Something in the messages of an election that observers should look into, such as rejected
+ballots. Kind is one of rejected-ballot (Detail being the RejectionReason), out-of-phase (messages
+of the type in Detail received outside their phase), unopened-ballot, uncertified-result and
+conflicting-certification.
+*/
+type Anomaly struct {
+	Kind   string `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+	Count  int    `json:"count"`
+}
+
+/*
+A summary of an election for publication alongside its result: its params and schedule, the
+turnout, the messages of the channel counted by phase of receipt and by type, the result and
+its certifications once the election ended, and the anomalies found. Messages the channel does
+not date are counted under the Unknown phase.
+*/
+type ElectionReport struct {
+	Election        string               `json:"election"`
+	Generated       time.Time            `json:"generated"`
+	Phase           string               `json:"phase"`
+	Title           string               `json:"title"`
+	Description     string               `json:"description,omitempty"`
+	Version         uint32               `json:"version"`
+	Organizer       string               `json:"organizer,omitempty"`
+	Contests        []ContestReport      `json:"contests"`
+	Schedule        ScheduleReport       `json:"schedule"`
+	Turnout         TurnoutReport        `json:"turnout"`
+	Messages        int                  `json:"messages"`
+	MessagesByPhase map[string]int       `json:"messagesByPhase"`
+	MessagesByType  map[string]int       `json:"messagesByType"`
+	Result          *ResultExport        `json:"result,omitempty"`
+	TallyHash       string               `json:"tallyHash,omitempty"`
+	Certification   *CertificationReport `json:"certification,omitempty"`
+	Anomalies       []Anomaly            `json:"anomalies"`
+}
+
+// Names the type of a message in reports.
+func messageKind(m Message) string {
+	switch {
+	case m.ElectionParams != nil:
+		return "params"
+	case m.Credential != nil:
+		return "credential"
+	case m.SignedBallot != nil:
+		return "ballot"
+	case m.Decryption != nil:
+		return "decryption"
+	case m.DecryptionBatch != nil:
+		return "decryption-batch"
+	case m.KeyReveal != nil:
+		return "key-reveal"
+	case m.Amendment != nil:
+		return "amendment"
+	case m.EligibilityUpdate != nil:
+		return "eligibility-update"
+	case m.TrusteeDecryption != nil:
+		return "trustee-decryption"
+	case m.Delegation != nil:
+		return "delegation"
+	case m.DelegateClaim != nil:
+		return "delegate-claim"
+	case m.Certification != nil:
+		return "certification"
+	case m.DKGDealing != nil:
+		return "dkg-dealing"
+	case m.DKGComplaint != nil:
+		return "dkg-complaint"
+	}
+	return "unknown"
+}
+
+// Reports whether the message was received outside the phases in which it is accepted.
+func (e *Election) outOfPhase(m Message) bool {
+	ph := e.Params().PhaseAt(m.Received)
+	switch {
+	case m.Credential != nil:
+		return !e.Params().RegistrationOpenAt(m.Received)
+	case m.SignedBallot != nil:
+		return ph != Cast
+	case m.Decryption != nil, m.DecryptionBatch != nil, m.KeyReveal != nil, m.TrusteeDecryption != nil:
+		return ph != Tally
+	case m.Certification != nil:
+		return ph != End
+	}
+	return false
+}
+
+/*
+Builds the summary report of the election from all the messages of its channel,
+verifying them as Progress does. The result is only reported once the election ended.
+*/
+func (e *Election) Report(ctx context.Context) (*ElectionReport, error) {
+	p, err := e.Progress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id := e.Id()
+	params := e.Params()
+	r := &ElectionReport{
+		Election:    hex.EncodeToString(id[:]),
+		Generated:   e.Now().UTC(),
+		Phase:       p.Phase.String(),
+		Title:       params.Title,
+		Description: params.Description,
+		Version:     params.Version,
+		Schedule: ScheduleReport{
+			CredGenStart:    params.CredGenStart,
+			RegistrationEnd: params.RegistrationEnd,
+			CastStart:       params.CastStart,
+			TallyStart:      params.TallyStart,
+			TallyEnd:        params.TallyEnd,
+		},
+		MessagesByPhase: make(map[string]int),
+		MessagesByType:  make(map[string]int),
+		Anomalies:       []Anomaly{},
+	}
+	for _, c := range params.ContestList() {
+		r.Contests = append(r.Contests, ContestReport{Title: c.Title, Method: c.VotingMethod, Choices: c.Choices})
+	}
+	if len(params.Organizer) != 0 {
+		r.Organizer, _ = params.Organizer.String()
+	}
+	if params.EligibilityList != nil {
+		r.Turnout.Eligible = params.EligibilityList.Len()
+	}
+	outOfPhase := make(map[string]int)
+	err = ForEachMessage(ctx, e.channel, func(m Message) error {
+		kind := messageKind(m)
+		r.Messages++
+		r.MessagesByType[kind]++
+		if m.Received.IsZero() {
+			r.MessagesByPhase["Unknown"]++
+			return nil
+		}
+		r.MessagesByPhase[params.PhaseAt(m.Received).String()]++
+		if e.outOfPhase(m) {
+			outOfPhase[kind]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p.Phase > CredGen {
+		set, err := e.GetCredentialSet(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.Turnout.Registered = set.Len()
+	} else {
+		r.Turnout.Registered = r.MessagesByType["credential"]
+	}
+	if p.Phase == Cast {
+		r.Turnout.Cast = p.Count
+	} else if p.Phase > Cast {
+		r.Turnout.Cast, r.Turnout.Counted = p.Total, p.Count
+	}
+	for reason := RejectInvalidSignature; int(reason) < len(rejectionNames); reason++ {
+		if n := p.Rejections[reason]; n != 0 {
+			r.Anomalies = append(r.Anomalies, Anomaly{Kind: "rejected-ballot", Detail: reason.String(), Count: n})
+		}
+	}
+	for _, kind := range []string{"credential", "ballot", "decryption", "decryption-batch", "key-reveal", "trustee-decryption", "certification"} {
+		if n := outOfPhase[kind]; n != 0 {
+			r.Anomalies = append(r.Anomalies, Anomaly{Kind: "out-of-phase", Detail: kind, Count: n})
+		}
+	}
+	if p.Phase != End {
+		return r, nil
+	}
+	// Ballots with an invalid decryption are already reported as rejected
+	if n := r.Turnout.Cast - r.Turnout.Counted - p.Rejections[RejectInvalidDecryption]; n > 0 {
+		r.Anomalies = append(r.Anomalies, Anomaly{Kind: "unopened-ballot", Count: n})
+	}
+	r.Result = e.resultExport(p)
+	hash := r.Result.Hash(params.HashScheme())
+	r.TallyHash = hex.EncodeToString(hash[:])
+	cert, err := e.Certification(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	r.Certification = &CertificationReport{
+		Certified:   cert.Certified,
+		Organizer:   cert.Organizer,
+		Trustees:    cert.Trustees,
+		Conflicting: len(cert.Conflicting),
+	}
+	if !cert.Certified {
+		r.Anomalies = append(r.Anomalies, Anomaly{Kind: "uncertified-result", Count: 1})
+	}
+	if len(cert.Conflicting) != 0 {
+		r.Anomalies = append(r.Anomalies, Anomaly{Kind: "conflicting-certification", Count: len(cert.Conflicting)})
+	}
+	return r, nil
+}
@@ -0,0 +1,110 @@
+package voting
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+// The count of a choice of a contest in a result export.
+type ChoiceExport struct {
+	Name  string `json:"name"`
+	Count uint64 `json:"count"`
+}
+
+// The result of a contest in a result export. Winners are choice indices, in order.
+type ContestExport struct {
+	Title   string         `json:"title"`
+	Method  string         `json:"method"`
+	Choices []ChoiceExport `json:"choices"`
+	Blank   uint64         `json:"blank"`
+	Winners []int          `json:"winners"`
+}
+
+/*
+The final result of an election as a self-contained artifact.
+Valid is the number of counted ballots, Total the number of valid signed ballots,
+and the IDs and seeds are hex-encoded.
+*/
+type ResultExport struct {
+	Election     string          `json:"election"`
+	Valid        int             `json:"valid"`
+	Total        int             `json:"total"`
+	TieBreakSeed string          `json:"tieBreakSeed"`
+	Contests     []ContestExport `json:"contests"`
+}
+
+/*
+Builds the export of the result in the progress, which must be in the End phase.
+Contests are in the order of the params, and choices in index order.
+*/
+func (e *Election) ExportResult(p ElectionProgress) (*ResultExport, error) {
+	if p.Phase != End {
+		return nil, ErrWrongPhase
+	}
+	return e.resultExport(p), nil
+}
+
+func (e *Election) resultExport(p ElectionProgress) *ResultExport {
+	id := e.Id()
+	r := &ResultExport{
+		Election:     hex.EncodeToString(id[:]),
+		Valid:        p.Count,
+		Total:        p.Total,
+		TieBreakSeed: hex.EncodeToString(p.TieBreakSeed[:]),
+		Contests:     []ContestExport{},
+	}
+	contests := e.Params().ContestList()
+	for i, res := range e.Results(p) {
+		if i >= len(contests) {
+			break
+		}
+		c := ContestExport{
+			Title:   contests[i].Title,
+			Method:  contests[i].VotingMethod,
+			Choices: make([]ChoiceExport, len(contests[i].Choices)),
+			Blank:   res.Blank,
+			Winners: append([]int{}, res.Winners...),
+		}
+		for j, name := range contests[i].Choices {
+			c.Choices[j].Name = name
+		}
+		for _, count := range res.Choices {
+			if count.Index < len(c.Choices) {
+				c.Choices[count.Index].Count = count.Count
+			}
+		}
+		r.Contests = append(r.Contests, c)
+	}
+	return r
+}
+
+/*
+Returns the canonical JSON encoding of the export, which is what certifications and auditors sign over:
+object keys in the order of the struct fields, no whitespace, strings escaped as by encoding/json
+except that <, > and & are kept as is, and no trailing newline.
+Percentages are left out, so that the encoding involves no floating-point numbers.
+*/
+func (r *ResultExport) CanonicalJSON() []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	// Only plain strings and integers: encoding cannot fail
+	enc.Encode(r)
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// Hashes the canonical JSON encoding of the export with the hash scheme of the election, in the tally domain.
+func (r *ResultExport) Hash(scheme util.HashScheme) util.HashValue {
+	return scheme.Sum(util.DomainTally, r.CanonicalJSON())
+}
+
+/*
+Returns the hash of the result in the progress: the hash of the canonical JSON encoding
+of its export. Everyone tallying the same messages obtains the same hash.
+*/
+func (e *Election) TallyHash(p ElectionProgress) util.HashValue {
+	return e.resultExport(p).Hash(e.Params().HashScheme())
+}
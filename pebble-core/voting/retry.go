@@ -0,0 +1,164 @@
+package voting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+/*
+Controls how a BroadcastClient retries failed requests.
+Transport errors, server errors and rate limiting are retried up to MaxAttempts times in total,
+waiting between attempts with exponential backoff from InitialBackoff up to MaxBackoff,
+with random jitter so that clients do not retry in lockstep.
+Each attempt is abandoned after RequestTimeout, unless it is zero.
+*/
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	RequestTimeout time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	RequestTimeout: 30 * time.Second,
+}
+
+// A request answered by the server with an unexpected status code.
+// The body holds the message of the error, and apiCode its code if the server sent a JSON error envelope.
+type statusError struct {
+	code    int
+	body    []byte
+	apiCode util.ErrorCode
+}
+
+func (err *statusError) Error() string {
+	if err.apiCode != "" {
+		return fmt.Sprintf("pebble: server error %d (%s): %s", err.code, err.apiCode, err.body)
+	}
+	return fmt.Sprintf("pebble: server error %d: %s", err.code, err.body)
+}
+
+// Reads the body of an unsuccessful response into a statusError and closes it.
+func readStatusError(resp *http.Response) error {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	serr := &statusError{code: resp.StatusCode, body: body}
+	var env util.ErrorEnvelope
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") && json.Unmarshal(body, &env) == nil && env.Error.Code != "" {
+		serr.body = []byte(env.Error.Message)
+		serr.apiCode = env.Error.Code
+	}
+	return serr
+}
+
+// Maximum size of a response body read by the clients, after decompression.
+const maxResponseSize = 1 << 30
+
+// Reads a response body, failing with util.ErrTooLarge if it exceeds maxResponseSize.
+func readBody(r io.Reader) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, maxResponseSize+1))
+	if err == nil && len(body) > maxResponseSize {
+		return nil, util.ErrTooLarge
+	}
+	return body, err
+}
+
+// Whether the request may succeed when sent again.
+// Errors other than status errors come from the transport, and are retried unless
+// the server is not trusted or its response is too large.
+func retryable(err error) bool {
+	if serr, ok := err.(*statusError); ok {
+		return serr.code >= 500 || serr.code == http.StatusTooManyRequests
+	}
+	return !errors.Is(err, ErrServerKeyMismatch) && !errors.Is(err, util.ErrTooLarge)
+}
+
+// Returns the wait before the attempt following attempt n, picked uniformly
+// between half and all of the exponential backoff.
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := p.InitialBackoff
+	for i := 0; i < n && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Returns the context of a single attempt, bounded by the request timeout plus
+// the time the server may wait before responding.
+func (p RetryPolicy) attemptContext(ctx context.Context, wait time.Duration) (context.Context, context.CancelFunc) {
+	if p.RequestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.RequestTimeout+wait)
+}
+
+// Calls attempt with increasing attempt numbers until it succeeds, fails with
+// an error that is not retryable, the attempts are exhausted or ctx is done.
+func (p RetryPolicy) retry(ctx context.Context, attempt func(n int) error) error {
+	for n := 0; ; n++ {
+		err := attempt(n)
+		if err == nil || !retryable(err) || n+1 >= p.MaxAttempts {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		t := time.NewTimer(p.backoff(n))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+/*
+Sends req with c, retrying failed attempts under the policy, and returns the body of the first response
+with status 200. Other responses fail with an error carrying the status and, if the server sent a JSON
+error envelope, its code, see ErrorCodeOf. Requests with a body must be replayable, see http.Request.GetBody.
+For clients of the other HTTP APIs of the servers.
+*/
+func (p RetryPolicy) Do(ctx context.Context, c *http.Client, req *http.Request) (body []byte, err error) {
+	err = p.retry(ctx, func(n int) error {
+		actx, cancel := p.attemptContext(ctx, 0)
+		defer cancel()
+		r := req.Clone(actx)
+		if req.GetBody != nil {
+			b, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			r.Body = b
+		}
+		resp, err := c.Do(r)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return readStatusError(resp)
+		}
+		defer resp.Body.Close()
+		body, err = readBody(resp.Body)
+		return err
+	})
+	return
+}
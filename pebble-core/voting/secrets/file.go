@@ -0,0 +1,292 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/vdf"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+var (
+	ErrNoPrivateKey  = errors.New("pebble: no private key stored")
+	ErrNoBallot      = errors.New("pebble: no ballot stored")
+	ErrNoVdfSolution = errors.New("pebble: no VDF solution stored")
+)
+
+/*
+A SecretsManager storing the secrets of a voter in a JSON file,
+readable by the owner only. The secret credential is generated on first use,
+and replaced by SetSecretCredential.
+Every update rewrites the file through a temporary file, so that a crash leaves
+either the previous or the new secrets.
+*/
+type FileManager struct {
+	mu   sync.Mutex
+	path string
+	data fileSecrets
+}
+
+type fileSecrets struct {
+	PrivateKey       []byte         `json:"privateKey,omitempty"`
+	SecretCredential []byte         `json:"secretCredential,omitempty"`
+	Ballots          []fileBallot   `json:"ballots,omitempty"`
+	Solutions        []fileSolution `json:"solutions,omitempty"`
+	// Solution of files written before solutions were keyed, returned for any ballot without one
+	// while no ballot keeps its election, as it could be of another election otherwise.
+	Solution *fileSolution `json:"solution,omitempty"`
+	// Single ballot of files written before the ballot history, moved to Ballots when opened.
+	Ballot        []byte `json:"ballot,omitempty"`
+	BallotTrustee bool   `json:"ballotTrustee,omitempty"`
+}
+
+type fileBallot struct {
+	ElectionId []byte `json:"electionId,omitempty"`
+	Ballot     []byte `json:"ballot"`
+	// Set if the ballot carries a trustee ciphertext.
+	Trustee bool `json:"trustee,omitempty"`
+	// Set if the ballot is serialized with its cipher suite, see structs.EncryptedBallot.BytesWithSuite.
+	Suite        bool      `json:"suite,omitempty"`
+	Time         time.Time `json:"time"`
+	TrackingCode []byte    `json:"trackingCode,omitempty"`
+}
+
+func (b *fileBallot) record() (r BallotRecord, err error) {
+	if b.Suite {
+		err = r.Ballot.FromBytesWithSuite(b.Ballot)
+	} else if b.Trustee {
+		err = r.Ballot.FromBytesWithTrustee(b.Ballot)
+	} else {
+		err = r.Ballot.FromBytes(b.Ballot)
+	}
+	r.Time = b.Time
+	copy(r.ElectionId[:], b.ElectionId)
+	copy(r.TrackingCode[:], b.TrackingCode)
+	return
+}
+
+type fileSolution struct {
+	ElectionId []byte `json:"electionId,omitempty"`
+	SerialNo   []byte `json:"serialNo,omitempty"`
+	Input      []byte `json:"input"`
+	Output     []byte `json:"output"`
+	Proof      []byte `json:"proof"`
+}
+
+// Opens the secrets stored at path, which does not need to exist yet.
+func OpenFile(path string) (*FileManager, error) {
+	m := &FileManager{path: path}
+	p, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(p, &m.data)
+	if err != nil {
+		return nil, err
+	}
+	if m.data.Ballot != nil {
+		// The time and tracking code of the legacy ballot are unknown
+		m.data.Ballots = append([]fileBallot{{Ballot: m.data.Ballot, Trustee: m.data.BallotTrustee}}, m.data.Ballots...)
+		m.data.Ballot, m.data.BallotTrustee = nil, false
+	}
+	return m, nil
+}
+
+// Stores the private key of the voter, replacing any previous one.
+func (m *FileManager) SetPrivateKey(k pubkey.PrivateKey) error {
+	p, err := k.Bytes()
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data.PrivateKey = p
+	return m.save()
+}
+
+func (m *FileManager) GetPrivateKey() (pubkey.PrivateKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data.PrivateKey == nil {
+		return pubkey.PrivateKey{}, ErrNoPrivateKey
+	}
+	return pubkey.PrivateKeyFromBytes(m.data.PrivateKey)
+}
+
+func (m *FileManager) GetSecretCredential(sys anoncred.CredentialSystem) (anoncred.SecretCredential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data.SecretCredential != nil {
+		return sys.ReadSecretCredential(m.data.SecretCredential)
+	}
+	sec, err := sys.GenerateSecretCredential()
+	if err != nil {
+		return nil, err
+	}
+	m.data.SecretCredential = sec.Bytes()
+	err = m.save()
+	if err != nil {
+		m.data.SecretCredential = nil
+		return nil, err
+	}
+	return sec, nil
+}
+
+func (m *FileManager) SetSecretCredential(sec anoncred.SecretCredential) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prev := m.data.SecretCredential
+	m.data.SecretCredential = sec.Bytes()
+	err := m.save()
+	if err != nil {
+		m.data.SecretCredential = prev
+	}
+	return err
+}
+
+// Returns the latest ballot signed by the voter in the election.
+func (m *FileManager) GetBallot(electionId [32]byte) (structs.SignedBallot, error) {
+	rs, err := m.GetBallots()
+	if err != nil {
+		return structs.SignedBallot{}, err
+	}
+	rs = ElectionBallots(rs, electionId)
+	if len(rs) == 0 {
+		return structs.SignedBallot{}, ErrNoBallot
+	}
+	return rs[len(rs)-1].Ballot, nil
+}
+
+// Adds a ballot to the history.
+func (m *FileManager) AddBallot(r BallotRecord) error {
+	b := fileBallot{Trustee: r.Ballot.EncryptedBallot.Trustee != nil, Time: r.Time, TrackingCode: r.TrackingCode[:]}
+	if r.ElectionId != ([32]byte{}) {
+		b.ElectionId = r.ElectionId[:]
+	}
+	b.Suite = r.Ballot.EncryptedBallot.Suite != structs.SuiteAESGCM
+	if b.Suite {
+		b.Ballot = r.Ballot.BytesWithSuite()
+	} else if b.Trustee {
+		b.Ballot = r.Ballot.BytesWithTrustee()
+	} else {
+		b.Ballot = r.Ballot.Bytes()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data.Ballots = append(m.data.Ballots, b)
+	err := m.save()
+	if err != nil {
+		m.data.Ballots = m.data.Ballots[:len(m.data.Ballots)-1]
+	}
+	return err
+}
+
+// Returns the ballots signed by the voter in every election, oldest first.
+// A ballot stored before the history was kept has a zero time and tracking code.
+func (m *FileManager) GetBallots() ([]BallotRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rs := make([]BallotRecord, len(m.data.Ballots))
+	for i := range m.data.Ballots {
+		var err error
+		rs[i], err = m.data.Ballots[i].record()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+// Returns the index of the solution for the ballot, or -1. The caller holds the lock.
+func (m *FileManager) solutionIndex(electionId [32]byte, serialNo []byte) int {
+	for i, s := range m.data.Solutions {
+		if bytes.Equal(s.ElectionId, electionId[:]) && bytes.Equal(s.SerialNo, serialNo) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *FileManager) GetVdfSolution(electionId [32]byte, serialNo []byte) (vdf.VdfSolution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var s *fileSolution
+	if i := m.solutionIndex(electionId, serialNo); i >= 0 {
+		s = &m.data.Solutions[i]
+	} else if m.singleElection() {
+		s = m.data.Solution
+	}
+	if s == nil {
+		return vdf.VdfSolution{}, ErrNoVdfSolution
+	}
+	return vdf.VdfSolution{Input: s.Input, Output: s.Output, Proof: s.Proof}, nil
+}
+
+// Reports whether no ballot keeps its election, so that the secrets are of a single election. The caller holds the lock.
+func (m *FileManager) singleElection() bool {
+	for _, b := range m.data.Ballots {
+		if len(b.ElectionId) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Stores the solution of the ballot, replacing the solution of a previous ballot with the same serial number.
+func (m *FileManager) SetVdfSolution(electionId [32]byte, serialNo []byte, sol vdf.VdfSolution) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := fileSolution{ElectionId: electionId[:], SerialNo: serialNo, Input: sol.Input, Output: sol.Output, Proof: sol.Proof}
+	i := m.solutionIndex(electionId, serialNo)
+	if i < 0 {
+		m.data.Solutions = append(m.data.Solutions, s)
+		err := m.save()
+		if err != nil {
+			m.data.Solutions = m.data.Solutions[:len(m.data.Solutions)-1]
+		}
+		return err
+	}
+	prev := m.data.Solutions[i]
+	m.data.Solutions[i] = s
+	err := m.save()
+	if err != nil {
+		m.data.Solutions[i] = prev
+	}
+	return err
+}
+
+// Writes the secrets to the file. The caller holds the lock.
+func (m *FileManager) save() error {
+	p, err := json.Marshal(&m.data)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(m.path), ".pebble-secrets-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	// Temporary files are created readable by the owner only
+	_, err = f.Write(p)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
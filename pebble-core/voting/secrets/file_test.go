@@ -0,0 +1,92 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/vdf"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+func TestFileBallotHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	legacy := structs.SignedBallot{SerialNo: []byte("s"), Signature: []byte("legacy")}
+	err := ioutil.WriteFile(path, []byte(`{"ballot":"`+base64.StdEncoding.EncodeToString(legacy.Bytes())+`"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Round(0)
+	err = m.AddBallot(BallotRecord{ElectionId: [32]byte{1}, Ballot: structs.SignedBallot{SerialNo: []byte("s"), Signature: []byte("new")}, Time: now, TrackingCode: [32]byte{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := m.GetBallots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 2 || string(rs[0].Ballot.Signature) != "legacy" || !rs[0].Time.IsZero() {
+		t.Fatalf("ballots %+v", rs)
+	}
+	if string(rs[1].Ballot.Signature) != "new" || !rs[1].Time.Equal(now) || rs[1].TrackingCode != [32]byte{1} || rs[1].ElectionId != [32]byte{1} {
+		t.Errorf("ballot %+v", rs[1])
+	}
+	b, err := m.GetBallot([32]byte{1})
+	if err != nil || string(b.Signature) != "new" {
+		t.Errorf("latest ballot %q, %v", b.Signature, err)
+	}
+	// The legacy ballot is not of another election once ballots keep their election
+	if _, err = m.GetBallot([32]byte{2}); err != ErrNoBallot {
+		t.Errorf("ballot of another election: %v", err)
+	}
+}
+
+func TestFileVdfSolutions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	err := ioutil.WriteFile(path, []byte(`{"solution":{"input":"AQ==","output":"AQ==","proof":"AQ=="}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e1, e2 := [32]byte{1}, [32]byte{2}
+	for i, id := range [][32]byte{e1, e2, e1} {
+		err = m.SetVdfSolution(id, []byte("s"), vdf.VdfSolution{Input: []byte{byte(i + 2)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err = OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		id    [32]byte
+		input byte
+	}{{e1, 4}, {e2, 3}, {[32]byte{3}, 1}} {
+		sol, err := m.GetVdfSolution(c.id, []byte("s"))
+		if err != nil || len(sol.Input) != 1 || sol.Input[0] != c.input {
+			t.Errorf("election %d: solution %v, %v", c.id[0], sol.Input, err)
+		}
+	}
+	// Once a ballot keeps its election, the legacy solution may be of another election
+	err = m.AddBallot(BallotRecord{ElectionId: e2, Ballot: structs.SignedBallot{SerialNo: []byte("s")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.GetVdfSolution([32]byte{3}, []byte("s")); err != ErrNoVdfSolution {
+		t.Errorf("legacy solution returned for another election: %v", err)
+	}
+}
@@ -1,17 +1,70 @@
 package secrets
 
 import (
+	"time"
+
 	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/vdf"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
 )
 
+// A ballot signed by the voter, kept as a receipt.
+type BallotRecord struct {
+	// Election the ballot was cast in, zero for ballots stored before records kept it.
+	ElectionId [32]byte
+	Ballot     structs.SignedBallot
+	// Time the ballot was signed.
+	Time time.Time
+	// Hash of the ballot message, identifying it on the broadcast channel.
+	TrackingCode util.HashValue
+}
+
+/*
+Stores the secrets of a voter, which may be shared by several elections.
+Every ballot the voter signs is added to the ballot history, oldest first, with the ID of
+its election; GetBallot returns the latest one of an election (see ElectionBallots).
+VDF solutions are keyed by election ID and ballot serial number, so that the manager
+keeps the decryption material of each ballot.
+*/
 type SecretsManager interface {
 	GetPrivateKey() (pubkey.PrivateKey, error)
 	GetSecretCredential(sys anoncred.CredentialSystem) (anoncred.SecretCredential, error)
-	GetBallot() (structs.SignedBallot, error)
-	SetBallot(ballot structs.SignedBallot) error
-	GetVdfSolution() (vdf.VdfSolution, error)
-	SetVdfSolution(sol vdf.VdfSolution) error
+	GetBallot(electionId [32]byte) (structs.SignedBallot, error)
+	AddBallot(r BallotRecord) error
+	GetBallots() ([]BallotRecord, error)
+	GetVdfSolution(electionId [32]byte, serialNo []byte) (vdf.VdfSolution, error)
+	SetVdfSolution(electionId [32]byte, serialNo []byte, sol vdf.VdfSolution) error
+}
+
+/*
+Implemented by secrets managers able to replace the secret credential of the voter,
+see voting.Election.RotateCredential.
+*/
+type CredentialRotator interface {
+	// Stores the secret credential, replacing the current one once its public credential is registered.
+	SetSecretCredential(sec anoncred.SecretCredential) error
+}
+
+/*
+Returns the records of the ballots cast in the election, oldest first.
+Records stored before they kept the election ID are of the election only while no record
+keeps an ID, that is while the secrets were used with a single election.
+*/
+func ElectionBallots(rs []BallotRecord, electionId [32]byte) []BallotRecord {
+	var res []BallotRecord
+	legacy := true
+	for _, r := range rs {
+		if r.ElectionId != ([32]byte{}) {
+			legacy = false
+		}
+		if r.ElectionId == electionId {
+			res = append(res, r)
+		}
+	}
+	if legacy {
+		return rs
+	}
+	return res
 }
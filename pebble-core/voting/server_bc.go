@@ -1,34 +1,226 @@
 package voting
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
 )
 
+var ErrUnsupportedTransport = errors.New("pebble: cannot configure the transport of the http client")
+
 // Represents a client for interacting with a broadcast server.
 // Contains an HTTP client and the URIs for retrieving election parameters and messages from the server.
+// If organizer is set, the election parameters must be signed by that key.
 type BroadcastClient struct {
-	client                 http.Client
-	paramsURI, messagesURI string
+	client                                 *http.Client
+	policy                                 RetryPolicy
+	paramsURI, messagesURI, eligibilityURI string
+	countdownURI, inclusionURI             string
+	organizer                              pubkey.PublicKey
+	authorization                          string
+	accessToken                            string
+	serverPin                              []byte
+	proxy                                  func(*http.Request) (*url.URL, error)
+	quarantine                             QuarantineSink
+	// Zero if the invitation address is not an election ID.
+	id      ElectionID
+	network string
+	// Cache of the params and messages, see WithMessageCache.
+	cacheDir, cacheParams string
+	cache                 *FileStore
+	cacheMu               sync.Mutex
+}
+
+type BroadcastClientOption func(*BroadcastClient)
+
+// Header carrying the hex-encoded access token of private elections, see Invitation.
+const AccessTokenHeader = "Pebble-Access-Token"
+
+// Sets the timeouts and retries of the client's requests.
+func WithRetryPolicy(p RetryPolicy) BroadcastClientOption {
+	return func(bc *BroadcastClient) {
+		bc.policy = p
+	}
+}
+
+// Sends the client's requests with c instead of http.DefaultClient.
+func WithHTTPClient(c *http.Client) BroadcastClientOption {
+	return func(bc *BroadcastClient) {
+		bc.client = c
+	}
+}
+
+// Authenticates the client's requests with a bearer token.
+func WithBearerToken(token string) BroadcastClientOption {
+	return func(bc *BroadcastClient) {
+		bc.authorization = "Bearer " + token
+	}
+}
+
+// Authenticates the client's requests with HTTP basic authentication.
+func WithBasicAuth(username, password string) BroadcastClientOption {
+	return func(bc *BroadcastClient) {
+		bc.authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	}
+}
+
+// Reads a private election with the access token, overriding the token carried by the invitation.
+func WithAccessToken(token []byte) BroadcastClientOption {
+	return func(bc *BroadcastClient) {
+		bc.accessToken = hex.EncodeToString(token)
+	}
+}
+
+// Only trusts a server whose TLS public key hashes to pin, see ServerPin.
+// Overrides the pin carried by the invitation.
+func WithServerPin(pin []byte) BroadcastClientOption {
+	return func(bc *BroadcastClient) {
+		bc.serverPin = pin
+	}
+}
+
+/*
+Sends the client's requests through the proxy at proxyURL, with scheme http, https or socks5.
+SOCKS5 proxies resolve the server's host name themselves, so the server may be a Tor onion service.
+*/
+func WithProxy(proxyURL *url.URL) BroadcastClientOption {
+	return func(bc *BroadcastClient) {
+		bc.proxy = http.ProxyURL(proxyURL)
+	}
+}
+
+/*
+Sends the client's requests over Tor through its SOCKS5 proxy at addr, e.g. "127.0.0.1:9050".
+Each request is isolated on its own circuit by using random proxy credentials,
+so that the server cannot link the requests of a voter, such as the posts of
+their credential and their ballot, by their address.
+*/
+func WithTor(addr string) BroadcastClientOption {
+	return func(bc *BroadcastClient) {
+		bc.proxy = func(req *http.Request) (*url.URL, error) {
+			var isolation [16]byte
+			_, err := rand.Read(isolation[:])
+			if err != nil {
+				return nil, err
+			}
+			u := hex.EncodeToString(isolation[:])
+			return &url.URL{Scheme: "socks5", User: url.UserPassword(u[:16], u[16:]), Host: addr}, nil
+		}
+	}
+}
+
+// Records the messages sent by the server that cannot be read in sink, rather than dropping them silently.
+func WithQuarantine(sink QuarantineSink) BroadcastClientOption {
+	return func(bc *BroadcastClient) {
+		bc.quarantine = sink
+	}
+}
+
+/*
+Creates a client for the first server listed in the invitation.
+The organizer key carried by the invitation, if any, is pinned for params verification,
+and the server pin, if any, for the TLS connections to the server.
+A pinned server must be reached over HTTPS. Pinning and proxies require the HTTP client
+to use an *http.Transport, which is copied rather than modified.
+*/
+func NewBroadcastClient(inv Invitation, opts ...BroadcastClientOption) (*BroadcastClient, error) {
+	if len(inv.Servers) == 0 || len(inv.Address) == 0 {
+		return nil, ErrInvalidInvitation
+	}
+	server := strings.TrimSuffix(inv.Servers[0], "/")
+	bc := &BroadcastClient{
+		client:         http.DefaultClient,
+		policy:         DefaultRetryPolicy,
+		paramsURI:      server + "/params/" + string(inv.Address),
+		messagesURI:    server + "/messages/" + string(inv.Address),
+		eligibilityURI: server + "/eligibility/" + string(inv.Address),
+		countdownURI:   server + "/countdown/" + string(inv.Address),
+		inclusionURI:   server + "/inclusion/" + string(inv.Address),
+		organizer:      inv.Organizer,
+		serverPin:      inv.ServerPin,
+		accessToken:    hex.EncodeToString(inv.AccessToken),
+	}
+	bc.id, _ = inv.ElectionId()
+	bc.network = inv.Network
+	if bc.network == "" {
+		bc.network = ServerNetwork
+	}
+	for _, opt := range opts {
+		opt(bc)
+	}
+	if len(bc.serverPin) != 0 && !strings.HasPrefix(server, "https://") {
+		return nil, ErrServerNotPinnable
+	}
+	if len(bc.serverPin) != 0 || bc.proxy != nil {
+		rt := bc.client.Transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+		t, ok := rt.(*http.Transport)
+		if !ok {
+			return nil, ErrUnsupportedTransport
+		}
+		t = t.Clone()
+		if bc.proxy != nil {
+			t.Proxy = bc.proxy
+		}
+		if len(bc.serverPin) != 0 {
+			pinTransport(t, bc.serverPin)
+		}
+		client := *bc.client
+		client.Transport = t
+		bc.client = &client
+	}
+	if bc.cacheDir != "" {
+		if err := bc.openCache(); err != nil {
+			return nil, err
+		}
+	}
+	return bc, nil
+}
+
+// Returns the ID of the election, decoded from the invitation address.
+func (bc *BroadcastClient) Id() ElectionID {
+	return bc.id
+}
+
+// Returns the network named by the invitation, ServerNetwork if it names none.
+func (bc *BroadcastClient) Network() string {
+	return bc.network
 }
 
 /*
 Sends an HTTP GET request to the server's params URI.
 Retrieves the response body and reads it into a byte buffer.
 Creates a new ElectionParams struct and populates it by calling the FromBytes() method, passing the byte buffer as the input.
+Verifies the organizer signature against the pinned organizer key.
 Returns the populated ElectionParams struct or an error if there was a problem retrieving or parsing the response.
 */
-func (bc *BroadcastClient) Params() (*ElectionParams, error) {
-	resp, err := bc.client.Get(bc.paramsURI)
-	if err != nil {
-		return nil, err
+func (bc *BroadcastClient) Params(ctx context.Context) (*ElectionParams, error) {
+	buf, err := bc.getBytes(ctx, bc.paramsURI)
+	if bc.cache != nil {
+		buf, err = bc.cachedParams(buf, err)
 	}
-	defer resp.Body.Close()
-	buf, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
@@ -37,73 +229,405 @@ func (bc *BroadcastClient) Params() (*ElectionParams, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = p.VerifyOrganizer(bc.organizer)
+	if err != nil {
+		return nil, err
+	}
 	return p, nil
 }
 
 /*
-Sends an HTTP GET request to the server's messages URI.
-Retrieves the response body and reads it into a byte buffer.
-Creates a new util.BufferReader and initializes an empty slice of Message structs.
-Parses the byte buffer to extract individual messages by reading the message kind (represented by a byte) and the message bytes.
-Based on the message kind, creates a new structs.CredentialMessage, structs.SignedBallot, or structs.DecryptionMessage and populates it by calling the respective FromBytes() method.
-Appends the populated message to the slice of Message structs.
-Returns the slice of Message structs or an error if there was a problem retrieving or parsing the response.
+Sends an HTTP GET request to the server's messages URI, requesting framing version 3.
+Servers reply with the framing they support in the Pebble-Framing header: version 2 and 3 responses
+are decoded with DecodeEnvelopes, and older responses with DecodeMessages.
+Messages of unknown type are skipped. With a message cache, only the messages after the cached ones are requested.
+Returns the messages or an error if there was a problem retrieving or parsing the response.
 */
-func (bc *BroadcastClient) Get() ([]Message, error) {
-	resp, err := bc.client.Get(bc.messagesURI)
+func (bc *BroadcastClient) Get(ctx context.Context) ([]Message, error) {
+	if bc.cache != nil {
+		return bc.getCache(ctx)
+	}
+	buf, header, err := bc.get(ctx, bc.messagesURI+"?framing=3", 0)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	buf, err := io.ReadAll(resp.Body)
+	if envelopeFraming(header) {
+		return decodeEnvelopes(buf, false, bc.skipped())
+	}
+	return decodeMessages(buf, bc.skipped())
+}
+
+// Reports whether a response lists messages in envelopes: framing version 2, or 3 with receipts.
+func envelopeFraming(header http.Header) bool {
+	f := header.Get("Pebble-Framing")
+	return f == "2" || f == "3"
+}
+
+// Returns the function quarantining the messages skipped when decoding a response, or nil if there is no quarantine.
+func (bc *BroadcastClient) skipped() func(b []byte, err error) {
+	if bc.quarantine == nil {
+		return nil
+	}
+	return func(b []byte, err error) {
+		bc.quarantine.Quarantine(QuarantinedMessage{
+			Time:   time.Now(),
+			Source: bc.messagesURI,
+			Reason: err.Error(),
+			Data:   b,
+		})
+	}
+}
+
+/*
+Streams the messages from the server's messages URI with framing version 3,
+decoding them as the response body arrives rather than reading it whole.
+Only opening the stream is retried, and the request timeout does not apply to reading it.
+Servers that do not reply with envelopes, framing version 2 or 3, are read with Get.
+With a message cache, the new messages are added to the cache, which is then read.
+*/
+func (bc *BroadcastClient) Stream(ctx context.Context) (MessageIterator, error) {
+	if bc.cache != nil {
+		return bc.streamCache(ctx)
+	}
+	var resp *http.Response
+	err := bc.policy.retry(ctx, func(n int) error {
+		var err error
+		resp, err = bc.do(ctx, http.MethodGet, bc.messagesURI+"?framing=3", nil)
+		if err == nil && resp.StatusCode != http.StatusOK {
+			err = readStatusError(resp)
+		}
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	r := util.NewBufferReader(buf)
-	var msgs []Message
-	for r.Len() != 0 {
-		kind, err := r.ReadByte()
+	if !envelopeFraming(resp.Header) {
+		resp.Body.Close()
+		msgs, err := bc.Get(ctx)
 		if err != nil {
 			return nil, err
 		}
-		m, err := r.ReadVector()
+		return &sliceIterator{msgs}, nil
+	}
+	it := &envelopeIterator{body: resp.Body, skipped: bc.skipped()}
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
 		if err != nil {
+			resp.Body.Close()
 			return nil, err
 		}
-		switch ElectionPhase(kind) {
-		case CredGen:
-			msg := new(structs.CredentialMessage)
-			err = msg.FromBytes(m)
-			if err == nil {
-				msgs = append(msgs, Message{Credential: msg})
+		it.r = bufio.NewReader(gz)
+	} else {
+		it.r = bufio.NewReader(resp.Body)
+	}
+	return it, nil
+}
+
+/*
+Sends a long-polling HTTP GET request to the server's messages URI, returning the messages
+after the first since ones and the total number of messages. If there are no such messages yet,
+the server waits for up to wait (at most a minute) for one to be posted before responding.
+Servers that do not support long polling respond at once with all the messages, of which
+those after the first since are returned.
+*/
+func (bc *BroadcastClient) GetSince(ctx context.Context, since int, wait time.Duration) ([]Message, int, error) {
+	msgs, total, _, err := bc.getSince(ctx, since, wait)
+	return msgs, total, err
+}
+
+// Like GetSince, additionally reporting whether the server supports long polling.
+func (bc *BroadcastClient) getSince(ctx context.Context, since int, wait time.Duration) (msgs []Message, total int, longPoll bool, err error) {
+	uri := bc.messagesURI + "?framing=3&since=" + strconv.Itoa(since)
+	if wait > 0 {
+		uri += "&wait=" + wait.String()
+	}
+	buf, header, err := bc.get(ctx, uri, wait)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if envelopeFraming(header) {
+		msgs, err = decodeEnvelopes(buf, false, bc.skipped())
+	} else {
+		msgs, err = decodeMessages(buf, bc.skipped())
+	}
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if count := header.Get("Pebble-Message-Count"); count != "" {
+		total, err = strconv.Atoi(count)
+		return msgs, total, true, err
+	}
+	total = len(msgs)
+	if since > total {
+		since = total
+	}
+	return msgs[since:], total, false, nil
+}
+
+// How long the server is asked to wait for new messages by Watch.
+const watchLongPollWait = 30 * time.Second
+
+// Interval between polls of servers that do not support long polling by Watch.
+const watchPollInterval = 5 * time.Second
+
+/*
+Long-polls the server's messages URI, sending the messages posted after the call on the returned channel.
+Servers that do not support long polling are polled at regular intervals instead.
+The channel is closed once ctx is done or a poll fails after exhausting its retries.
+*/
+func (bc *BroadcastClient) Watch(ctx context.Context) (<-chan Message, error) {
+	_, next, longPoll, err := bc.getSince(ctx, math.MaxInt32, 0)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan Message)
+	go func() {
+		defer close(ch)
+		for {
+			if !longPoll {
+				t := time.NewTimer(watchPollInterval)
+				select {
+				case <-t.C:
+				case <-ctx.Done():
+					t.Stop()
+					return
+				}
 			}
-		case Cast:
-			msg := new(structs.SignedBallot)
-			err = msg.FromBytes(m)
-			if err == nil {
-				msgs = append(msgs, Message{SignedBallot: msg})
+			msgs, total, lp, err := bc.getSince(ctx, next, watchLongPollWait)
+			if err != nil {
+				return
 			}
-		case Tally:
-			msg := new(structs.DecryptionMessage)
-			err = msg.FromBytes(m)
-			if err == nil {
-				msgs = append(msgs, Message{Decryption: msg})
+			next, longPoll = total, lp
+			for _, m := range msgs {
+				select {
+				case ch <- m:
+				case <-ctx.Done():
+					return
+				}
 			}
 		}
+	}()
+	return ch, nil
+}
+
+// Decodes message envelopes from a response body.
+type envelopeIterator struct {
+	body    io.ReadCloser
+	r       *bufio.Reader
+	skipped func(b []byte, err error)
+}
+
+func (it *envelopeIterator) Next() (Message, error) {
+	for {
+		n, err := binary.ReadUvarint(it.r)
+		if err != nil {
+			return Message{}, err
+		}
+		if n > maxMessageSize {
+			return Message{}, util.ErrTooLarge
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(it.r, b)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return Message{}, err
+		}
+		m, ok, err := decodeEnvelope(b, false, it.skipped)
+		if err != nil || ok {
+			return m, err
+		}
 	}
-	return msgs, nil
+}
+
+func (it *envelopeIterator) Close() error {
+	return it.body.Close()
 }
 
 /*
 Sends an HTTP POST request to the server's messages URI.
 Creates a byte buffer from the input Message by calling the Bytes() method.
 Sends the byte buffer as the request body with the content type set to "application/octet-stream".
-Returns an error if there was a problem sending the request or closing the response body.
+A message carrying a proof of work is posted in an envelope with PostAll.
+Returns an error if there was a problem sending the request or the server rejected the message.
+*/
+func (bc *BroadcastClient) Post(ctx context.Context, m Message) error {
+	if m.PowNonce != 0 {
+		return bc.PostAll(ctx, []Message{m})
+	}
+	return bc.post(ctx, bc.messagesURI, m.Bytes())
+}
+
+/*
+Sends an HTTP POST request to the server's messages URI with framing version 2,
+posting all the messages in a single request with their proofs of work.
+The server validates the whole batch before posting any of them.
 */
-func (bc *BroadcastClient) Post(m Message) error {
-	resp, err := bc.client.Post(bc.messagesURI, "application/octet-stream", bytes.NewReader(m.Bytes()))
+func (bc *BroadcastClient) PostAll(ctx context.Context, msgs []Message) error {
+	return bc.post(ctx, bc.messagesURI+"?framing=2", EncodeEnvelopes(msgs))
+}
+
+// Sends a single authenticated HTTP request, accepting gzip content encoding for GET requests.
+func (bc *BroadcastClient) do(ctx context.Context, method, uri string, body []byte) (*http.Response, error) {
+	req, err := bc.newRequest(ctx, method, uri, body)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return bc.client.Do(req)
+}
+
+func (bc *BroadcastClient) newRequest(ctx context.Context, method, uri string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uri, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if bc.authorization != "" {
+		req.Header.Set("Authorization", bc.authorization)
+	}
+	if bc.accessToken != "" {
+		req.Header.Set(AccessTokenHeader, bc.accessToken)
+	}
+	if method == http.MethodGet {
+		req.Header.Set("Accept-Encoding", "gzip")
+	} else {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	return req, nil
+}
+
+/*
+Sends an HTTP POST request with body to uri, retrying failed attempts.
+Posting is idempotent since servers reject duplicate messages: a retry rejected as a duplicate
+means that an earlier attempt was accepted but its response was lost, and counts as a success.
+*/
+func (bc *BroadcastClient) post(ctx context.Context, uri string, body []byte) error {
+	return bc.policy.retry(ctx, func(n int) error {
+		actx, cancel := bc.policy.attemptContext(ctx, 0)
+		defer cancel()
+		resp, err := bc.do(actx, http.MethodPost, uri, body)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusConflict && n > 0 {
+			return resp.Body.Close()
+		}
+		if resp.StatusCode != http.StatusOK {
+			return readStatusError(resp)
+		}
+		return resp.Body.Close()
+	})
+}
+
+/*
+Sends an HTTP GET request to uri and returns the response body, retrying failed attempts.
+The request accepts gzip content encoding, and a compressed body is decompressed
+regardless of whether the transport handles compression.
+*/
+func (bc *BroadcastClient) getBytes(ctx context.Context, uri string) ([]byte, error) {
+	buf, _, err := bc.get(ctx, uri, 0)
+	return buf, err
+}
+
+/*
+Like getBytes, additionally returning the response headers.
+The request timeout is extended by wait for long-polling requests.
+An attempt interrupted while reading the body is resumed by the next one with a Range request
+for the rest of the uncompressed body, which servers of append-only logs answer with status 206.
+*/
+func (bc *BroadcastClient) get(ctx context.Context, uri string, wait time.Duration) (buf []byte, header http.Header, err error) {
+	var partial []byte
+	err = bc.policy.retry(ctx, func(n int) error {
+		actx, cancel := bc.policy.attemptContext(ctx, wait)
+		defer cancel()
+		req, err := bc.newRequest(actx, http.MethodGet, uri, nil)
+		if err != nil {
+			return err
+		}
+		if len(partial) != 0 {
+			req.Header.Set("Range", "bytes="+strconv.Itoa(len(partial))+"-")
+		}
+		resp, err := bc.client.Do(req)
+		if err != nil {
+			return err
+		}
+		switch {
+		case resp.StatusCode == http.StatusPartialContent && len(partial) != 0 && rangeStart(resp.Header) == len(partial):
+		case resp.StatusCode == http.StatusOK:
+			// Servers ignoring the range send the whole body again
+			partial = nil
+		default:
+			return readStatusError(resp)
+		}
+		defer resp.Body.Close()
+		body := io.Reader(resp.Body)
+		if resp.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(resp.Body)
+			if err != nil {
+				return err
+			}
+			defer gz.Close()
+			body = gz
+		}
+		b, err := readBody(body)
+		if len(partial)+len(b) > maxResponseSize {
+			return util.ErrTooLarge
+		}
+		partial = append(partial, b...)
+		if err != nil {
+			return err
+		}
+		buf, header = partial, resp.Header
+		return nil
+	})
+	return
+}
+
+// Returns the first byte of the range of a response with status 206, or -1 if the header is invalid.
+func rangeStart(header http.Header) int {
+	var start, end, size int
+	_, err := fmt.Sscanf(header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size)
+	if err != nil {
+		return -1
+	}
+	return start
+}
+
+// Retrieves the current phase of the election and the time left until the next one, according to the server's clock.
+func (bc *BroadcastClient) Countdown(ctx context.Context) (PhaseCountdown, error) {
+	var c PhaseCountdown
+	buf, err := bc.getBytes(ctx, bc.countdownURI)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(buf, &c)
+	return c, err
+}
+
+// Retrieves the full eligibility list from the server's eligibility URI.
+func (bc *BroadcastClient) EligibilityList(ctx context.Context) (*structs.EligibilityList, error) {
+	buf, err := bc.getBytes(ctx, bc.eligibilityURI)
+	if err != nil {
+		return nil, err
+	}
+	list := structs.NewEligibilityList()
+	err = list.FromBytes(buf)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Retrieves the inclusion proof of pkh from the server's eligibility URI.
+func (bc *BroadcastClient) EligibilityProof(ctx context.Context, pkh util.HashValue) (*structs.EligibilityProof, error) {
+	buf, err := bc.getBytes(ctx, bc.eligibilityURI+"?key="+hex.EncodeToString(pkh[:]))
+	if err != nil {
+		return nil, err
+	}
+	proof := new(structs.EligibilityProof)
+	err = proof.FromBytes(buf)
+	if err != nil {
+		return nil, err
 	}
-	return resp.Body.Close()
+	return proof, nil
 }
@@ -0,0 +1,51 @@
+package voting
+
+import (
+	"sync"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+// Hashes the signed parts of messages into signature cache keys, with their lengths so that keys cannot collide.
+var signatureCacheScheme = util.HashScheme{Algorithm: util.SHA256, Separated: true}
+
+/*
+Remembers which messages of an election carry a valid signature, so that reading the
+messages again only verifies those posted since. Keys must cover the signer, the signed
+data and the signature. The cache is safe for concurrent use.
+*/
+type signatureCache struct {
+	mu    sync.Mutex
+	valid map[util.HashValue]bool
+}
+
+// Reports which of the messages with the given keys carry a valid signature,
+// calling verify on the indices of the messages not seen before.
+func (c *signatureCache) verify(keys []util.HashValue, verify func(idx []int) []bool) []bool {
+	valid := make([]bool, len(keys))
+	var unknown []int
+	c.mu.Lock()
+	for i, k := range keys {
+		v, ok := c.valid[k]
+		if ok {
+			valid[i] = v
+		} else {
+			unknown = append(unknown, i)
+		}
+	}
+	c.mu.Unlock()
+	if len(unknown) == 0 {
+		return valid
+	}
+	res := verify(unknown)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.valid == nil {
+		c.valid = make(map[util.HashValue]bool)
+	}
+	for j, i := range unknown {
+		valid[i] = res[j]
+		c.valid[keys[i]] = res[j]
+	}
+	return valid
+}
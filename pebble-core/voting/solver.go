@@ -0,0 +1,127 @@
+package voting
+
+import (
+	"context"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/vdf"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+// Number of solutions posted in each decryption batch by SolveBallots, keeping batches well below maxMessageSize.
+const solveBatchSize = 1024
+
+/*
+Returns the VDF inputs of the counted ballots of the election that no valid decryption or key reveal opens,
+that is the ballots whose voters did not reveal them, in the order they were cast.
+Ballots of homomorphically tallied elections have no VDF, and none is returned.
+Ballots with invalid signatures, of another cipher suite or whose VDF difficulty is out of bounds are
+left out, since they are not counted anyway; so are ballots opened by the trustees, if any.
+*/
+func (e *Election) UnopenedBallots(ctx context.Context) ([][]byte, error) {
+	// Ballots tallied homomorphically have no VDF, and are only opened by the trustees
+	if _, ok := e.homomorphicMethod(); ok {
+		return nil, nil
+	}
+	err := e.Refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	set, err := e.GetCredentialSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := e.readMessages(ctx, func(m Message) bool {
+		return m.SignedBallot != nil || m.Decryption != nil || m.DecryptionBatch != nil ||
+			m.TrusteeDecryption != nil || m.KeyReveal != nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var signBallots []structs.SignedBallot
+	var decMsgs []structs.DecryptionMessage
+	var trusteeMsgs []structs.TrusteeDecryptionMessage
+	var reveals []structs.KeyRevealMessage
+	for _, msg := range msgs {
+		if msg.SignedBallot != nil {
+			signBallots = append(signBallots, *msg.SignedBallot)
+		} else if msg.Decryption != nil || msg.DecryptionBatch != nil {
+			decMsgs = appendDecryptions(decMsgs, msg)
+		} else if msg.TrusteeDecryption != nil {
+			trusteeMsgs = append(trusteeMsgs, *msg.TrusteeDecryption)
+		} else if msg.KeyReveal != nil {
+			reveals = append(reveals, *msg.KeyReveal)
+		}
+	}
+	partials := collectTrusteePartials(trusteeMsgs)
+	bv := newBatchVerifier(e.timedVdf(ctx))
+	bv.verifyFirst(signBallots, decMsgs)
+	domain := e.ballotDomain()
+	var serialNos, inputs util.BytesSet
+	var unopened [][]byte
+	for i := range signBallots {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		sb := &signBallots[i]
+		eb := sb.EncryptedBallot
+		if serialNos.Contains(sb.SerialNo) || inputs.Contains(eb.VdfInput) || sb.Verify(set, domain) != nil ||
+			eb.Suite != e.Params().CipherSuite || !e.vdfDifficultyValid(eb.VdfInput) {
+			continue
+		}
+		serialNos.Put(sb.SerialNo)
+		_, _, err = decryptBallot(eb, decMsgs, reveals, bv)
+		if err == ErrDecryptionNotFound {
+			_, err = decryptTrusteeBallot(eb, e.Params().Trustees, partials)
+		}
+		if err == ErrDecryptionNotFound {
+			inputs.Put(eb.VdfInput)
+			unopened = append(unopened, eb.VdfInput)
+		}
+	}
+	return unopened, nil
+}
+
+/*
+Solves the VDF puzzles of the unopened ballots of the election on concurrent workers, and posts
+their solutions in decryption batches, so that anyone can open the ballots of voters who did not
+reveal them. Puzzles harder than the MaxVdfDifficulty of the params fail to solve and are skipped.
+Returns the number of solutions posted, or an error if the phase is not Tally or posting fails.
+*/
+func (e *Election) SolveBallots(ctx context.Context) (int, error) {
+	if e.Phase() != Tally {
+		return 0, ErrWrongPhase
+	}
+	inputs, err := e.UnopenedBallots(ctx)
+	if err != nil {
+		return 0, err
+	}
+	ivdf := e.timedVdf(ctx)
+	sols := make([]vdf.VdfSolution, len(inputs))
+	solved := make([]bool, len(inputs))
+	parallelFor(len(inputs), func(i int) {
+		if ctx.Err() != nil {
+			return
+		}
+		sol, err := ivdf.Solve(inputs[i])
+		sols[i], solved[i] = sol, err == nil
+	})
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
+	var batch []vdf.VdfSolution
+	posted := 0
+	for i := range sols {
+		if solved[i] {
+			batch = append(batch, sols[i])
+		}
+		if len(batch) == solveBatchSize || (i == len(sols)-1 && len(batch) != 0) {
+			if err = e.PostDecryptionBatch(ctx, batch); err != nil {
+				return posted, err
+			}
+			posted += len(batch)
+			batch = nil
+		}
+	}
+	return posted, nil
+}
@@ -2,8 +2,6 @@ package structs
 
 import (
 	"bytes"
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
 	"errors"
@@ -16,13 +14,21 @@ import (
 
 type Ballot []byte
 
+/*
+A ballot encrypted with a key derived from its VDF solution, with the cipher suite of the election.
+In elections with trustees, Trustee additionally holds the ballot encrypted
+to the joint trustee key (a serialized trustee.Ciphertext).
+*/
 type EncryptedBallot struct {
 	VdfInput, Payload []byte
+	Trustee           []byte
+	Suite             CipherSuite
 }
 
 var (
 	ErrMismatchedVdfSolution = errors.New("pebble: mismatched VDF solution")
 	ErrPayloadTooShort       = errors.New("pebble: ballot payload too short")
+	ErrNonCanonicalBallot    = errors.New("pebble: legacy cipher suite ballot in the suite encoding")
 )
 
 func (b *EncryptedBallot) Bytes() []byte {
@@ -43,6 +49,100 @@ func (b *EncryptedBallot) FromBytes(p []byte) error {
 	return nil
 }
 
+// Serializes the ballot with its trustee ciphertext.
+func (b *EncryptedBallot) BytesWithTrustee() []byte {
+	var w util.BufferWriter
+	w.WriteVector(b.VdfInput)
+	w.WriteVector(b.Trustee)
+	w.Write(b.Payload)
+	return w.Buffer
+}
+
+func (b *EncryptedBallot) FromBytesWithTrustee(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	b.VdfInput, err = r.ReadVector()
+	if err != nil {
+		return err
+	}
+	b.Trustee, err = r.ReadVector()
+	if err != nil {
+		return err
+	}
+	b.Payload = r.ReadRemaining()
+	return nil
+}
+
+/*
+Serializes the ballot with its cipher suite and trustee ciphertext, if any.
+Ballots of the legacy suite SuiteAESGCM are serialized without their suite, by Bytes or BytesWithTrustee.
+*/
+func (b *EncryptedBallot) BytesWithSuite() []byte {
+	var w util.BufferWriter
+	w.WriteByte(byte(b.Suite))
+	w.WriteVector(b.VdfInput)
+	w.WriteVector(b.Trustee)
+	w.Write(b.Payload)
+	return w.Buffer
+}
+
+func (b *EncryptedBallot) FromBytesWithSuite(p []byte) error {
+	r := util.NewBufferReader(p)
+	suite, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	b.Suite = CipherSuite(suite)
+	if b.Suite == SuiteAESGCM {
+		return ErrNonCanonicalBallot
+	}
+	b.VdfInput, err = r.ReadVector()
+	if err != nil {
+		return err
+	}
+	b.Trustee, err = r.ReadVector()
+	if err != nil {
+		return err
+	}
+	if len(b.Trustee) == 0 {
+		b.Trustee = nil
+	}
+	b.Payload = r.ReadRemaining()
+	return nil
+}
+
+// Prefixed to the ballot bytes signed for a BallotDomain.
+const ballotSignatureContext = "pebble-ballot"
+
+/*
+Binds a ballot signature to an election and phase, so that a ballot cannot be replayed
+in another election sharing the same credential set. Ballots of elections predating
+domains are signed without one.
+*/
+type BallotDomain struct {
+	ElectionId util.HashValue
+	Phase      byte
+}
+
+// Returns the bytes covered by the ballot signature.
+func (b *EncryptedBallot) signedBytes(domain *BallotDomain) []byte {
+	p := b.Bytes()
+	if b.Suite != SuiteAESGCM {
+		p = b.BytesWithSuite()
+	} else if b.Trustee != nil {
+		p = b.BytesWithTrustee()
+	}
+	if domain == nil {
+		return p
+	}
+	var w util.BufferWriter
+	w.Write([]byte(ballotSignatureContext))
+	w.Write32(domain.ElectionId)
+	w.WriteByte(domain.Phase)
+	w.Write(p)
+	return w.Buffer
+}
+
 type SignedBallot struct {
 	EncryptedBallot EncryptedBallot
 	SerialNo        []byte
@@ -72,51 +172,138 @@ func (b *SignedBallot) FromBytes(p []byte) error {
 	return nil
 }
 
-func createCipher(vdfInput []byte) (cipher.AEAD, error) {
-	key := sha256.Sum256(vdfInput)
-	block, err := aes.NewCipher(key[:])
+// Serializes a signed ballot carrying a trustee ciphertext.
+func (b *SignedBallot) BytesWithTrustee() []byte {
+	var w util.BufferWriter
+	w.WriteVector(b.SerialNo)
+	w.WriteVector(b.Signature)
+	w.Write(b.EncryptedBallot.BytesWithTrustee())
+	return w.Buffer
+}
+
+func (b *SignedBallot) FromBytesWithTrustee(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	b.SerialNo, err = r.ReadVector()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	b.Signature, err = r.ReadVector()
+	if err != nil {
+		return err
+	}
+	return b.EncryptedBallot.FromBytesWithTrustee(r.ReadRemaining())
+}
+
+// Serializes a signed ballot with its cipher suite, see EncryptedBallot.BytesWithSuite.
+func (b *SignedBallot) BytesWithSuite() []byte {
+	var w util.BufferWriter
+	w.WriteVector(b.SerialNo)
+	w.WriteVector(b.Signature)
+	w.Write(b.EncryptedBallot.BytesWithSuite())
+	return w.Buffer
+}
+
+func (b *SignedBallot) FromBytesWithSuite(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	b.SerialNo, err = r.ReadVector()
+	if err != nil {
+		return err
+	}
+	b.Signature, err = r.ReadVector()
+	if err != nil {
+		return err
 	}
-	return cipher.NewGCM(block)
+	return b.EncryptedBallot.FromBytesWithSuite(r.ReadRemaining())
+}
+
+// Encrypts the ballot with the legacy cipher suite SuiteAESGCM.
+func (b Ballot) Encrypt(sol vdf.VdfSolution) (EncryptedBallot, error) {
+	return b.EncryptWith(SuiteAESGCM, sol)
 }
 
-func (b Ballot) Encrypt(sol vdf.VdfSolution) (eb EncryptedBallot, err error) {
-	cipher, err := createCipher(sol.Input)
+// Encrypts the ballot with the cipher suite, so that it can only be opened with the VDF solution or the key derived from it.
+func (b Ballot) EncryptWith(suite CipherSuite, sol vdf.VdfSolution) (eb EncryptedBallot, err error) {
+	key, err := suite.Key(sol)
+	if err != nil {
+		return
+	}
+	aead, err := suite.aead(key)
 	if err != nil {
 		return
 	}
-	nonce := make([]byte, 12)
+	nonce := make([]byte, aead.NonceSize())
 	_, err = io.ReadFull(rand.Reader, nonce)
 	if err != nil {
 		return
 	}
-	eb.Payload = util.Concat(nonce, cipher.Seal(nil, nonce, b, nil))
+	var commitment []byte
+	if suite.commitsKey() {
+		h := keyCommitment(key)
+		commitment = h[:]
+	}
+	eb.Payload = util.Concat(commitment, nonce, aead.Seal(nil, nonce, b, suite.additionalData(sol.Input)))
 	eb.VdfInput = sol.Input
+	eb.Suite = suite
 	return
 }
 
+// Decrypts the ballot with the VDF solution, using the cipher suite of the ballot.
 func (eb *EncryptedBallot) Decrypt(sol vdf.VdfSolution) (Ballot, error) {
 	if !bytes.Equal(sol.Input, eb.VdfInput) {
 		return nil, ErrMismatchedVdfSolution
 	}
-	cipher, err := createCipher(sol.Input)
+	key, err := eb.Suite.Key(sol)
+	if err != nil {
+		return nil, err
+	}
+	return eb.DecryptWithKey(key)
+}
+
+/*
+Decrypts the ballot with its key, as revealed by the voter instead of the VDF solution.
+Fails with ErrInvalidBallotKey if the key is not the one derived from the VDF solution:
+the key of the legacy suite is the hash of the VDF input, and other suites commit to it in the payload,
+so that the key and the VDF solution always open the ballot to the same plaintext.
+*/
+func (eb *EncryptedBallot) DecryptWithKey(key []byte) (Ballot, error) {
+	if !eb.Suite.Available() {
+		return nil, ErrUnknownCipherSuite
+	}
+	payload := eb.Payload
+	if eb.Suite.commitsKey() {
+		commitment := keyCommitment(key)
+		if len(payload) < len(commitment) {
+			return nil, ErrPayloadTooShort
+		}
+		if !bytes.Equal(payload[:len(commitment)], commitment[:]) {
+			return nil, ErrInvalidBallotKey
+		}
+		payload = payload[len(commitment):]
+	} else if h := sha256.Sum256(eb.VdfInput); !bytes.Equal(key, h[:]) {
+		return nil, ErrInvalidBallotKey
+	}
+	aead, err := eb.Suite.aead(key)
 	if err != nil {
 		return nil, err
 	}
-	if len(eb.Payload) < 12 {
+	n := aead.NonceSize()
+	if len(payload) < n {
 		return nil, ErrPayloadTooShort
 	}
-	return cipher.Open(nil, eb.Payload[:12], eb.Payload[12:], nil)
+	return aead.Open(nil, payload[:n], payload[n:], eb.Suite.additionalData(eb.VdfInput))
 }
 
-func (eb *EncryptedBallot) Sign(set anoncred.CredentialSet, cred anoncred.SecretCredential) (sb SignedBallot, err error) {
+// Signs the ballot with the anonymous credential, in the given domain if not nil.
+func (eb *EncryptedBallot) Sign(set anoncred.CredentialSet, cred anoncred.SecretCredential, domain *BallotDomain) (sb SignedBallot, err error) {
 	sb.EncryptedBallot = *eb
 	sb.SerialNo = cred.SerialNo()
-	sb.Signature, err = set.Sign(cred, eb.Bytes())
+	sb.Signature, err = set.Sign(cred, eb.signedBytes(domain))
 	return
 }
 
-func (b *SignedBallot) Verify(set anoncred.CredentialSet) error {
-	return set.Verify(b.SerialNo, b.Signature, b.Bytes())
+// Verifies the ballot signature in the given domain, which must be the domain the ballot was signed in.
+func (b *SignedBallot) Verify(set anoncred.CredentialSet, domain *BallotDomain) error {
+	return set.Verify(b.SerialNo, b.Signature, b.EncryptedBallot.signedBytes(domain))
 }
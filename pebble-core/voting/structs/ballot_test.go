@@ -0,0 +1,149 @@
+package structs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/vdf"
+)
+
+// Credential set whose signatures are plain hashes of the serial number and message.
+type hashCredentialSet struct{}
+
+type hashSecretCredential []byte
+
+func (c hashSecretCredential) Bytes() []byte                              { return c }
+func (c hashSecretCredential) Public() (anoncred.PublicCredential, error) { return nil, nil }
+func (c hashSecretCredential) SerialNo() []byte                           { return c }
+
+func (hashCredentialSet) Len() int { return 1 }
+
+func (hashCredentialSet) Sign(secret anoncred.SecretCredential, msg []byte) ([]byte, error) {
+	h := util.HashAll(secret.SerialNo(), msg)
+	return h[:], nil
+}
+
+func (hashCredentialSet) Verify(serialNo, sig, msg []byte) error {
+	if h := util.HashAll(serialNo, msg); string(h[:]) != string(sig) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func TestBallotDomain(t *testing.T) {
+	var set hashCredentialSet
+	cred := hashSecretCredential("serial")
+	eb := EncryptedBallot{VdfInput: []byte("input"), Payload: []byte("payload")}
+	domain := &BallotDomain{ElectionId: util.Hash([]byte("election")), Phase: 2}
+	sb, err := eb.Sign(set, cred, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sb.Verify(set, domain); err != nil {
+		t.Errorf("ballot not verified in its domain: %v", err)
+	}
+	other := &BallotDomain{ElectionId: util.Hash([]byte("other")), Phase: 2}
+	if sb.Verify(set, other) == nil {
+		t.Error("ballot verified in another election")
+	}
+	if sb.Verify(set, &BallotDomain{ElectionId: domain.ElectionId, Phase: 3}) == nil {
+		t.Error("ballot verified in another phase")
+	}
+	if sb.Verify(set, nil) == nil {
+		t.Error("domain ballot verified as a legacy ballot")
+	}
+	legacy, err := eb.Sign(set, cred, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = legacy.Verify(set, nil); err != nil {
+		t.Errorf("legacy ballot not verified: %v", err)
+	}
+	eb.Trustee = []byte("ciphertext")
+	sb, _ = eb.Sign(set, cred, domain)
+	sb.EncryptedBallot.Trustee = []byte("replaced")
+	if sb.Verify(set, domain) == nil {
+		t.Error("trustee ciphertext not covered by the signature")
+	}
+}
+
+func TestCipherSuites(t *testing.T) {
+	sol := vdf.VdfSolution{Input: []byte("input"), Output: []byte("output")}
+	for _, suite := range []CipherSuite{SuiteAESGCM, SuiteXChaCha20Poly1305} {
+		eb, err := Ballot("ballot").EncryptWith(suite, sol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded SignedBallot
+		sb := SignedBallot{EncryptedBallot: eb, SerialNo: []byte("serial"), Signature: []byte("sig")}
+		if suite == SuiteAESGCM {
+			err = decoded.FromBytes(sb.Bytes())
+		} else {
+			err = decoded.FromBytesWithSuite(sb.BytesWithSuite())
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.EncryptedBallot.Suite != suite {
+			t.Errorf("%v: suite not preserved", suite)
+		}
+		b, err := decoded.EncryptedBallot.Decrypt(sol)
+		if err != nil || string(b) != "ballot" {
+			t.Errorf("%v: ballot not decrypted: %v", suite, err)
+		}
+		// Only the new suite is keyed with the VDF output
+		_, err = eb.Decrypt(vdf.VdfSolution{Input: sol.Input, Output: []byte("other")})
+		if (err == nil) != (suite == SuiteAESGCM) {
+			t.Errorf("%v: decryption with another output: %v", suite, err)
+		}
+	}
+	eb := EncryptedBallot{VdfInput: []byte("input"), Payload: []byte("payload")}
+	if eb.FromBytesWithSuite(eb.BytesWithSuite()) != ErrNonCanonicalBallot {
+		t.Error("legacy suite accepted in the suite encoding")
+	}
+	eb.Suite = 0xFF
+	if _, err := eb.Decrypt(vdf.VdfSolution{Input: eb.VdfInput}); err != ErrUnknownCipherSuite {
+		t.Errorf("unknown suite: %v", err)
+	}
+	// The suite is covered by the signature, so that a ballot cannot be relabeled
+	var set hashCredentialSet
+	eb.Suite = SuiteXChaCha20Poly1305
+	sb, _ := eb.Sign(set, hashSecretCredential("serial"), nil)
+	sb.EncryptedBallot.Suite = SuiteAESGCM
+	if sb.Verify(set, nil) == nil {
+		t.Error("cipher suite not covered by the signature")
+	}
+}
+
+func TestDecryptWithKey(t *testing.T) {
+	sol := vdf.VdfSolution{Input: []byte("input"), Output: []byte("output")}
+	for _, suite := range []CipherSuite{SuiteAESGCM, SuiteXChaCha20Poly1305} {
+		eb, err := Ballot("ballot").EncryptWith(suite, sol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := suite.Key(sol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := eb.DecryptWithKey(key)
+		if err != nil || string(b) != "ballot" {
+			t.Errorf("%v: ballot not decrypted with its key: %v", suite, err)
+		}
+		other := append([]byte(nil), key...)
+		other[0] ^= 1
+		if _, err = eb.DecryptWithKey(other); err != ErrInvalidBallotKey {
+			t.Errorf("%v: other key: %v", suite, err)
+		}
+	}
+	// A key must not open a payload committed to another key, lest the VDF solution open it to another ballot
+	eb, _ := Ballot("ballot").EncryptWith(SuiteXChaCha20Poly1305, sol)
+	forged, _ := Ballot("forged").EncryptWith(SuiteXChaCha20Poly1305, vdf.VdfSolution{Input: sol.Input, Output: []byte("other")})
+	copy(forged.Payload, eb.Payload[:32])
+	key, _ := SuiteXChaCha20Poly1305.Key(sol)
+	if _, err := forged.DecryptWithKey(key); err == nil {
+		t.Error("forged payload opened")
+	}
+}
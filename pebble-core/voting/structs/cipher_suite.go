@@ -0,0 +1,116 @@
+package structs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/vdf"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+var (
+	ErrUnknownCipherSuite = errors.New("pebble: unknown cipher suite")
+	ErrInvalidBallotKey   = errors.New("pebble: key does not open the ballot")
+)
+
+/*
+Identifies the authenticated encryption of ballots under a key derived from their VDF solution.
+Values are serialized in the params and ballots and must not change.
+*/
+type CipherSuite byte
+
+const (
+	// AES-256-GCM keyed with the SHA-256 hash of the VDF input, with a 12-byte nonce.
+	SuiteAESGCM CipherSuite = iota
+	// XChaCha20-Poly1305 keyed with HKDF-SHA256 of the VDF output, salted with the VDF input,
+	// which is also authenticated as additional data, with a 24-byte nonce.
+	// The payload starts with a commitment to the key, see EncryptedBallot.DecryptWithKey.
+	SuiteXChaCha20Poly1305
+)
+
+const (
+	// Info of the HKDF key derivation of SuiteXChaCha20Poly1305.
+	ballotKeyInfo = "pebble-ballot-key"
+	// Prefixed to the key hashed into the key commitment.
+	ballotKeyCommitmentContext = "pebble-ballot-key-commitment"
+)
+
+var cipherSuiteNames = map[CipherSuite]string{
+	SuiteAESGCM:            "aes-gcm",
+	SuiteXChaCha20Poly1305: "xchacha20-poly1305",
+}
+
+func (s CipherSuite) String() string {
+	if name, ok := cipherSuiteNames[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+func ParseCipherSuite(name string) (CipherSuite, error) {
+	for s, n := range cipherSuiteNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return 0, ErrUnknownCipherSuite
+}
+
+func (s CipherSuite) Available() bool {
+	_, ok := cipherSuiteNames[s]
+	return ok
+}
+
+// Derives the key of the ballots encrypted with the suite from their VDF solution.
+func (s CipherSuite) Key(sol vdf.VdfSolution) ([]byte, error) {
+	switch s {
+	case SuiteAESGCM:
+		key := sha256.Sum256(sol.Input)
+		return key[:], nil
+	case SuiteXChaCha20Poly1305:
+		key := make([]byte, chacha20poly1305.KeySize)
+		_, err := io.ReadFull(hkdf.New(sha256.New, sol.Output, sol.Input, []byte(ballotKeyInfo)), key)
+		return key, err
+	}
+	return nil, ErrUnknownCipherSuite
+}
+
+// Returns the AEAD of the suite with the key. The nonce is prefixed to the ciphertext.
+func (s CipherSuite) aead(key []byte) (cipher.AEAD, error) {
+	switch s {
+	case SuiteAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case SuiteXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	}
+	return nil, ErrUnknownCipherSuite
+}
+
+func (s CipherSuite) additionalData(vdfInput []byte) []byte {
+	if s == SuiteAESGCM {
+		return nil
+	}
+	return vdfInput
+}
+
+/*
+Whether the payloads of the suite start with a commitment to the key. AEADs do not commit
+to their key: without a commitment, a voter could craft a payload that a revealed key
+opens to another ballot than the key derived from the VDF solution.
+*/
+func (s CipherSuite) commitsKey() bool {
+	return s != SuiteAESGCM
+}
+
+func keyCommitment(key []byte) util.HashValue {
+	return sha256.Sum256(util.Concat([]byte(ballotKeyCommitmentContext), key))
+}
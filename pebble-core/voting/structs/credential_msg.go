@@ -1,16 +1,30 @@
 package structs
 
 import (
+	"encoding/binary"
+
 	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
 	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
 )
 
+// Proof is only set in elections whose EligibilityList holds a Merkle root,
+// and is serialized by BytesWithProof.
 type CredentialMessage struct {
 	Credential []byte
 	PublicKey  pubkey.PublicKey
 	Signature  []byte
+	Proof      *EligibilityProof
+	/*
+		Registration epoch of the credential, signed with it and serialized by BytesWithEpoch when
+		not zero. A credential replaces the credentials of the voter of lower epochs and is never
+		replaced by them, so that a registration replayed after a rotation is ignored.
+	*/
+	Epoch uint32
 }
 
+// Prefixed to the credential in the signed bytes of credentials of a nonzero epoch.
+const credentialEpochContext = "pebble-credential-epoch"
+
 func (c *CredentialMessage) Bytes() []byte {
 	var w util.BufferWriter
 	w.WriteVector(c.Credential)
@@ -34,13 +48,115 @@ func (c *CredentialMessage) FromBytes(p []byte) error {
 	return nil
 }
 
+// Serializes the message with its eligibility proof, which is not covered by the signature.
+func (c *CredentialMessage) BytesWithProof() []byte {
+	var w util.BufferWriter
+	w.WriteVector(c.Credential)
+	w.WriteVector(c.PublicKey)
+	w.WriteVector(c.Proof.Bytes())
+	w.Write(c.Signature)
+	return w.Buffer
+}
+
+func (c *CredentialMessage) FromBytesWithProof(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	c.Credential, err = r.ReadVector()
+	if err != nil {
+		return err
+	}
+	c.PublicKey, err = r.ReadVector()
+	if err != nil {
+		return err
+	}
+	proof, err := r.ReadVector()
+	if err != nil {
+		return err
+	}
+	c.Proof = new(EligibilityProof)
+	err = c.Proof.FromBytes(proof)
+	if err != nil {
+		return err
+	}
+	c.Signature = r.ReadRemaining()
+	return nil
+}
+
+// Serializes the message with its epoch and its eligibility proof, if any.
+func (c *CredentialMessage) BytesWithEpoch() []byte {
+	var w util.BufferWriter
+	w.WriteUint32(c.Epoch)
+	w.WriteVector(c.Credential)
+	w.WriteVector(c.PublicKey)
+	var proof []byte
+	if c.Proof != nil {
+		proof = c.Proof.Bytes()
+	}
+	w.WriteVector(proof)
+	w.Write(c.Signature)
+	return w.Buffer
+}
+
+func (c *CredentialMessage) FromBytesWithEpoch(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	c.Epoch, err = r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	c.Credential, err = r.ReadVector()
+	if err != nil {
+		return err
+	}
+	c.PublicKey, err = r.ReadVector()
+	if err != nil {
+		return err
+	}
+	proof, err := r.ReadVector()
+	if err != nil {
+		return err
+	}
+	if len(proof) != 0 {
+		c.Proof = new(EligibilityProof)
+		err = c.Proof.FromBytes(proof)
+		if err != nil {
+			return err
+		}
+	}
+	c.Signature = r.ReadRemaining()
+	return nil
+}
+
+// Returns the bytes signed by the voter key, for signers outside of pebble-core such as wallets.
+func (c *CredentialMessage) SigningBytes(eid util.HashValue) []byte {
+	if c.Epoch == 0 {
+		return util.Concat(eid[:], c.Credential)
+	}
+	var epoch [4]byte
+	binary.BigEndian.PutUint32(epoch[:], c.Epoch)
+	return util.Concat(eid[:], []byte(credentialEpochContext), epoch[:], c.Credential)
+}
+
 func (c *CredentialMessage) Sign(k pubkey.PrivateKey, eid util.HashValue) error {
 	var err error
 	c.PublicKey = k.Public()
-	c.Signature, err = k.Sign(util.Concat(eid[:], c.Credential))
+	c.Signature, err = k.Sign(c.SigningBytes(eid))
 	return err
 }
 
 func (c *CredentialMessage) Verify(eid util.HashValue) error {
-	return c.PublicKey.Verify(util.Concat(eid[:], c.Credential), c.Signature)
+	return c.PublicKey.Verify(c.SigningBytes(eid), c.Signature)
+}
+
+// Verifies the signatures of several credential messages in batches with pubkey.VerifyAll and reports which are valid.
+func VerifyCredentialMessages(msgs []*CredentialMessage, eid util.HashValue) []bool {
+	keys := make([]pubkey.PublicKey, len(msgs))
+	signed := make([][]byte, len(msgs))
+	sigs := make([][]byte, len(msgs))
+	for i, c := range msgs {
+		keys[i] = c.PublicKey
+		signed[i] = c.SigningBytes(eid)
+		sigs[i] = c.Signature
+	}
+	return pubkey.VerifyAll(keys, signed, sigs)
 }
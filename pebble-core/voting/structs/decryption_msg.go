@@ -36,3 +36,86 @@ func (d *DecryptionMessage) FromBytes(p []byte) error {
 	d.Proof = r.ReadRemaining()
 	return nil
 }
+
+// Bounds of decryption batches: number of decryptions, and length of each output and proof.
+const (
+	MaxDecryptionBatch     = 4096
+	maxDecryptionVectorLen = 1 << 16
+)
+
+/*
+Carries the VDF solutions of many ballots, such as posted by a solver service revealing the
+ballots of voters who did not. Each decryption counts as if posted alone.
+*/
+type DecryptionBatchMessage struct {
+	Decryptions []DecryptionMessage
+}
+
+func (m *DecryptionBatchMessage) Bytes() []byte {
+	var w util.BufferWriter
+	w.WriteUvarint(uint64(len(m.Decryptions)))
+	for _, d := range m.Decryptions {
+		w.Write32(d.InputHash)
+		w.WriteVarVector(d.Output)
+		w.WriteVarVector(d.Proof)
+	}
+	return w.Buffer
+}
+
+func (m *DecryptionBatchMessage) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	n, err := r.ReadCount(MaxDecryptionBatch, 32+2)
+	if err != nil {
+		return err
+	}
+	m.Decryptions = make([]DecryptionMessage, n)
+	for i := range m.Decryptions {
+		d := &m.Decryptions[i]
+		d.InputHash, err = r.Read32()
+		if err != nil {
+			return err
+		}
+		d.Output, err = r.ReadVarVector(maxDecryptionVectorLen)
+		if err != nil {
+			return err
+		}
+		d.Proof, err = r.ReadVarVector(maxDecryptionVectorLen)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Maximum length of revealed ballot keys.
+const maxBallotKeyLength = 64
+
+/*
+Reveals the key of a voter's ballot, computed from its VDF solution, so that the ballot can be
+decrypted without the VDF proof. Keys are checked against the ballot by EncryptedBallot.DecryptWithKey.
+*/
+type KeyRevealMessage struct {
+	InputHash [32]byte
+	Key       []byte
+}
+
+func (m *KeyRevealMessage) Bytes() []byte {
+	var w util.BufferWriter
+	w.Write32(m.InputHash)
+	w.Write(m.Key)
+	return w.Buffer
+}
+
+func (m *KeyRevealMessage) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	m.InputHash, err = r.Read32()
+	if err != nil {
+		return err
+	}
+	m.Key = r.ReadRemaining()
+	if len(m.Key) > maxBallotKeyLength {
+		return util.ErrTooLarge
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package structs
+
+import (
+	"github.com/giry-dev/pebble-voting-app/pebble-core/anoncred"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+const (
+	delegationSignatureContext    = "pebble-delegation"
+	delegateClaimSignatureContext = "pebble-delegate-claim"
+)
+
+/*
+Delegates the ballot weight of a voter to the holder of another credential.
+Delegate is the hash of the public credential of the delegate. The message is signed
+with the eligible key of the delegator, whose own credential no longer counts.
+Proof is only set in elections whose EligibilityList holds a Merkle root.
+*/
+type DelegationMessage struct {
+	Delegate  util.HashValue
+	PublicKey pubkey.PublicKey
+	Proof     *EligibilityProof
+	Signature []byte
+}
+
+func (d *DelegationMessage) Bytes() []byte {
+	var w util.BufferWriter
+	w.Write32(d.Delegate)
+	w.WriteVector(d.PublicKey)
+	if d.Proof != nil {
+		w.WriteVector(d.Proof.Bytes())
+	} else {
+		w.WriteVector(nil)
+	}
+	w.Write(d.Signature)
+	return w.Buffer
+}
+
+func (d *DelegationMessage) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	d.Delegate, err = r.Read32()
+	if err != nil {
+		return err
+	}
+	d.PublicKey, err = r.ReadVector()
+	if err != nil {
+		return err
+	}
+	proof, err := r.ReadVector()
+	if err != nil {
+		return err
+	}
+	d.Proof = nil
+	if len(proof) != 0 {
+		d.Proof = new(EligibilityProof)
+		err = d.Proof.FromBytes(proof)
+		if err != nil {
+			return err
+		}
+	}
+	d.Signature = r.ReadRemaining()
+	return nil
+}
+
+func (d *DelegationMessage) signingBytes(eid util.HashValue) []byte {
+	return util.Concat([]byte(delegationSignatureContext), eid[:], d.Delegate[:])
+}
+
+func (d *DelegationMessage) Sign(k pubkey.PrivateKey, eid util.HashValue) error {
+	var err error
+	d.PublicKey = k.Public()
+	d.Signature, err = k.Sign(d.signingBytes(eid))
+	return err
+}
+
+func (d *DelegationMessage) Verify(eid util.HashValue) error {
+	return d.PublicKey.Verify(d.signingBytes(eid), d.Signature)
+}
+
+// Verifies the signatures of several delegation messages in batches with pubkey.VerifyAll and reports which are valid.
+func VerifyDelegationMessages(msgs []*DelegationMessage, eid util.HashValue) []bool {
+	keys := make([]pubkey.PublicKey, len(msgs))
+	signed := make([][]byte, len(msgs))
+	sigs := make([][]byte, len(msgs))
+	for i, d := range msgs {
+		keys[i] = d.PublicKey
+		signed[i] = d.signingBytes(eid)
+		sigs[i] = d.Signature
+	}
+	return pubkey.VerifyAll(keys, signed, sigs)
+}
+
+/*
+Posted by a delegate to receive the weight delegated to their credential.
+Links the serial number of the delegate's ballot to their eligible key, revealing
+which ballot is theirs. Both the key and the anonymous credential sign the claim,
+so only the holder of the credential can claim its serial number.
+*/
+type DelegateClaimMessage struct {
+	SerialNo      []byte
+	PublicKey     pubkey.PublicKey
+	CredSignature []byte
+	Signature     []byte
+}
+
+func (c *DelegateClaimMessage) Bytes() []byte {
+	var w util.BufferWriter
+	w.WriteVector(c.SerialNo)
+	w.WriteVector(c.PublicKey)
+	w.WriteVector(c.CredSignature)
+	w.Write(c.Signature)
+	return w.Buffer
+}
+
+func (c *DelegateClaimMessage) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	c.SerialNo, err = r.ReadVector()
+	if err != nil {
+		return err
+	}
+	c.PublicKey, err = r.ReadVector()
+	if err != nil {
+		return err
+	}
+	c.CredSignature, err = r.ReadVector()
+	if err != nil {
+		return err
+	}
+	c.Signature = r.ReadRemaining()
+	return nil
+}
+
+func (c *DelegateClaimMessage) signingBytes(eid util.HashValue) []byte {
+	var w util.BufferWriter
+	w.Write([]byte(delegateClaimSignatureContext))
+	w.Write32(eid)
+	w.WriteVector(c.SerialNo)
+	w.WriteVector(c.PublicKey)
+	return w.Buffer
+}
+
+// Signs the claim with the eligible key k and the secret credential, whose serial number is claimed.
+func (c *DelegateClaimMessage) Sign(k pubkey.PrivateKey, set anoncred.CredentialSet, cred anoncred.SecretCredential, eid util.HashValue) error {
+	var err error
+	c.SerialNo = cred.SerialNo()
+	c.PublicKey = k.Public()
+	c.CredSignature, err = set.Sign(cred, c.signingBytes(eid))
+	if err != nil {
+		return err
+	}
+	c.Signature, err = k.Sign(c.signingBytes(eid))
+	return err
+}
+
+func (c *DelegateClaimMessage) Verify(set anoncred.CredentialSet, eid util.HashValue) error {
+	msg := c.signingBytes(eid)
+	err := c.PublicKey.Verify(msg, c.Signature)
+	if err != nil {
+		return err
+	}
+	return set.Verify(c.SerialNo, c.CredSignature, msg)
+}
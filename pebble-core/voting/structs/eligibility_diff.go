@@ -0,0 +1,198 @@
+package structs
+
+import (
+	"errors"
+	"io"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+var ErrEligibilityConflict = errors.New("pebble: conflicting identity commitments in EligibilityList")
+
+// A change to the entry of a public key hash. Old is zero for added entries, New for removed entries.
+type EligibilityChange struct {
+	KeyHash util.HashValue
+	Old     util.HashValue
+	New     util.HashValue
+}
+
+/*
+Lists the entries added to, removed from, and whose identity commitment changed
+between two eligibility lists. Changes are in list order.
+*/
+type EligibilityDiff struct {
+	Added   []EligibilityChange
+	Removed []EligibilityChange
+	Changed []EligibilityChange
+}
+
+// Reports whether the diff has no changes.
+func (d *EligibilityDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Computes the changes turning list a into list b. Both lists must be full lists with the same hash algorithm.
+func DiffEligibilityLists(a, b *EligibilityList) (*EligibilityDiff, error) {
+	if a.rootOnly || b.rootOnly {
+		return nil, ErrRootOnly
+	}
+	if a.algorithm != b.algorithm {
+		return nil, ErrAlgorithm
+	}
+	d := new(EligibilityDiff)
+	for _, pkh := range a.publicKeyHashes {
+		old := a.idCommitments[pkh]
+		idCom, ok := b.idCommitments[pkh]
+		if !ok {
+			d.Removed = append(d.Removed, EligibilityChange{KeyHash: pkh, Old: old})
+		} else if idCom != old {
+			d.Changed = append(d.Changed, EligibilityChange{KeyHash: pkh, Old: old, New: idCom})
+		}
+	}
+	for _, pkh := range b.publicKeyHashes {
+		if _, ok := a.idCommitments[pkh]; !ok {
+			d.Added = append(d.Added, EligibilityChange{KeyHash: pkh, New: b.idCommitments[pkh]})
+		}
+	}
+	return d, nil
+}
+
+/*
+Returns a copy of the list with the diff applied: removed entries are dropped,
+changed entries updated in place, and added entries appended.
+Fails with ErrEligibilityConflict if the list does not match the state the diff was computed from.
+*/
+func (list *EligibilityList) Apply(d *EligibilityDiff) (*EligibilityList, error) {
+	if list.rootOnly {
+		return nil, ErrRootOnly
+	}
+	update := make(map[util.HashValue]util.HashValue, len(d.Changed))
+	removed := make(map[util.HashValue]bool, len(d.Removed))
+	for _, c := range d.Changed {
+		if idCom, ok := list.idCommitments[c.KeyHash]; !ok || idCom != c.Old {
+			return nil, ErrEligibilityConflict
+		}
+		update[c.KeyHash] = c.New
+	}
+	for _, c := range d.Removed {
+		if idCom, ok := list.idCommitments[c.KeyHash]; !ok || idCom != c.Old {
+			return nil, ErrEligibilityConflict
+		}
+		removed[c.KeyHash] = true
+	}
+	res := NewEligibilityList()
+	res.algorithm = list.algorithm
+	for _, pkh := range list.publicKeyHashes {
+		if removed[pkh] {
+			continue
+		}
+		idCom, ok := update[pkh]
+		if !ok {
+			idCom = list.idCommitments[pkh]
+		}
+		res.Add(pkh, idCom)
+	}
+	for _, c := range d.Added {
+		if !res.Add(c.KeyHash, c.New) {
+			return nil, ErrDuplicateKey
+		}
+	}
+	return res, nil
+}
+
+func writeChanges(w *util.BufferWriter, changes []EligibilityChange) {
+	w.WriteUint32(uint32(len(changes)))
+	for _, c := range changes {
+		w.Write32(c.KeyHash)
+		w.Write32(c.Old)
+		w.Write32(c.New)
+	}
+}
+
+func readChanges(r *util.BufferReader) ([]EligibilityChange, error) {
+	n, err := r.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
+	if int(n) > r.Len()/96 {
+		return nil, io.ErrShortBuffer
+	}
+	changes := make([]EligibilityChange, n)
+	for i := range changes {
+		for _, h := range []*util.HashValue{&changes[i].KeyHash, &changes[i].Old, &changes[i].New} {
+			*h, err = r.Read32()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return changes, nil
+}
+
+func (d *EligibilityDiff) Bytes() []byte {
+	var w util.BufferWriter
+	writeChanges(&w, d.Added)
+	writeChanges(&w, d.Removed)
+	writeChanges(&w, d.Changed)
+	return w.Buffer
+}
+
+func (d *EligibilityDiff) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	d.Added, err = readChanges(r)
+	if err != nil {
+		return err
+	}
+	d.Removed, err = readChanges(r)
+	if err != nil {
+		return err
+	}
+	d.Changed, err = readChanges(r)
+	return err
+}
+
+// Rules for merging entries present in several lists with different identity commitments.
+type MergeRule byte
+
+const (
+	// Fail with ErrEligibilityConflict.
+	MergeStrict MergeRule = iota
+	// Keep the commitment of the first list containing the entry.
+	MergeKeepFirst
+	// Keep the commitment of the last list containing the entry.
+	MergeKeepLast
+)
+
+/*
+Merges full lists into a new list. Entries keep the order in which they first appear;
+conflicting identity commitments are resolved according to rule.
+The lists must have the same hash algorithm.
+*/
+func MergeEligibilityLists(rule MergeRule, lists ...*EligibilityList) (*EligibilityList, error) {
+	res := NewEligibilityList()
+	for i, list := range lists {
+		if list.rootOnly {
+			return nil, ErrRootOnly
+		}
+		if i == 0 {
+			res.algorithm = list.algorithm
+		} else if list.algorithm != res.algorithm {
+			return nil, ErrAlgorithm
+		}
+		for _, pkh := range list.publicKeyHashes {
+			idCom := list.idCommitments[pkh]
+			if res.Add(pkh, idCom) || res.idCommitments[pkh] == idCom {
+				continue
+			}
+			switch rule {
+			case MergeKeepFirst:
+			case MergeKeepLast:
+				res.idCommitments[pkh] = idCom
+			default:
+				return nil, ErrEligibilityConflict
+			}
+		}
+	}
+	return res, nil
+}
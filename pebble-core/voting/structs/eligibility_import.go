@@ -0,0 +1,260 @@
+package structs
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/pubkey"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+var ErrMissingKey = errors.New("pebble: entry has neither key nor keyHash")
+
+/*
+A voter entry of an imported eligibility list.
+Either Key (a public key string accepted by pubkey.Parse) or KeyHash (hex) must be set.
+The identity commitment is IdCommitment (hex) if set, the hash of Id if set, or zero.
+Weight is informational, e.g. a token balance, and is not part of the list.
+*/
+type EligibilityEntry struct {
+	Key          string `json:"key,omitempty"`
+	KeyHash      string `json:"keyHash,omitempty"`
+	Id           string `json:"id,omitempty"`
+	IdCommitment string `json:"idCommitment,omitempty"`
+	Weight       string `json:"weight,omitempty"`
+}
+
+// An entry skipped during import. Line is the CSV line or 1-based JSON array index.
+type EligibilityIssue struct {
+	Line  int
+	Entry EligibilityEntry
+	Err   error
+}
+
+// Summarizes an import: number of voters added, and skipped duplicate or invalid entries.
+type EligibilityReport struct {
+	Added      int
+	Duplicates []EligibilityIssue
+	Invalid    []EligibilityIssue
+}
+
+func (r *EligibilityReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d added, %d duplicates, %d invalid\n", r.Added, len(r.Duplicates), len(r.Invalid))
+	for _, issue := range r.Duplicates {
+		fmt.Fprintf(&b, "line %d: duplicate %s%s\n", issue.Line, issue.Entry.Key, issue.Entry.KeyHash)
+	}
+	for _, issue := range r.Invalid {
+		fmt.Fprintf(&b, "line %d: %v\n", issue.Line, issue.Err)
+	}
+	return b.String()
+}
+
+func decodeHash(s string) (h util.HashValue, err error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return h, err
+	}
+	if len(b) != len(h) {
+		return h, fmt.Errorf("pebble: invalid hash length %d", len(b))
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+func (e *EligibilityEntry) hashes() (pkh, idCom util.HashValue, err error) {
+	switch {
+	case e.Key != "":
+		pk, err := pubkey.Parse(e.Key)
+		if err != nil {
+			return pkh, idCom, err
+		}
+		pkh = util.Hash(pk)
+	case e.KeyHash != "":
+		pkh, err = decodeHash(e.KeyHash)
+		if err != nil {
+			return pkh, idCom, err
+		}
+	default:
+		return pkh, idCom, ErrMissingKey
+	}
+	if e.IdCommitment != "" {
+		idCom, err = decodeHash(e.IdCommitment)
+	} else if e.Id != "" {
+		idCom = util.Hash([]byte(e.Id))
+	}
+	return pkh, idCom, err
+}
+
+/*
+Builds an EligibilityList from entries, skipping invalid entries and duplicate keys
+(the first occurrence is kept). Entries are sorted by key hash, so the list bytes
+do not depend on the input order.
+*/
+func NewEligibilityListFromEntries(entries []EligibilityEntry) (*EligibilityList, *EligibilityReport) {
+	type entry struct{ pkh, idCom util.HashValue }
+	report := new(EligibilityReport)
+	seen := make(map[util.HashValue]bool)
+	var valid []entry
+	for i, e := range entries {
+		pkh, idCom, err := e.hashes()
+		if err != nil {
+			report.Invalid = append(report.Invalid, EligibilityIssue{i + 1, e, err})
+			continue
+		}
+		if seen[pkh] {
+			report.Duplicates = append(report.Duplicates, EligibilityIssue{i + 1, e, ErrDuplicateKey})
+			continue
+		}
+		seen[pkh] = true
+		valid = append(valid, entry{pkh, idCom})
+	}
+	sort.Slice(valid, func(i, j int) bool {
+		return bytes.Compare(valid[i].pkh[:], valid[j].pkh[:]) < 0
+	})
+	list := NewEligibilityList()
+	for _, e := range valid {
+		list.Add(e.pkh, e.idCom)
+	}
+	report.Added = len(valid)
+	return list, report
+}
+
+var csvColumns = []string{"key", "keyHash", "id", "idCommitment"}
+
+/*
+Reads eligibility entries from CSV.
+If the first record is a header naming columns among key, keyHash, id and idCommitment,
+columns are mapped by name. Otherwise the first column holds a public key or
+a 64 hex digit key hash, and the optional second column the voter id.
+Line numbers in the report start at 1 with the first record.
+*/
+func ReadEligibilityCSV(r io.Reader) (*EligibilityList, *EligibilityReport, error) {
+	entries, first, err := readCSVEntries(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	list, report := NewEligibilityListFromEntries(entries)
+	// Account for the header line
+	for _, issues := range [][]EligibilityIssue{report.Duplicates, report.Invalid} {
+		for i := range issues {
+			issues[i].Line += first
+		}
+	}
+	return list, report, nil
+}
+
+// Reads the entries of CSV in the format of ReadEligibilityCSV, without building a list.
+func ReadEligibilityEntriesCSV(r io.Reader) ([]EligibilityEntry, error) {
+	entries, _, err := readCSVEntries(r)
+	return entries, err
+}
+
+// Reads the entries of CSV, and returns the number of header lines.
+func readCSVEntries(r io.Reader) ([]EligibilityEntry, int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, 0, err
+	}
+	columns := map[string]int{"key": 0, "id": 1}
+	first := 0
+	if len(records) != 0 && isCSVHeader(records[0]) {
+		columns = make(map[string]int)
+		for i, name := range records[0] {
+			columns[strings.TrimSpace(name)] = i
+		}
+		first = 1
+	}
+	field := func(rec []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+	var entries []EligibilityEntry
+	for _, rec := range records[first:] {
+		e := EligibilityEntry{
+			Key:          field(rec, "key"),
+			KeyHash:      field(rec, "keyHash"),
+			Id:           field(rec, "id"),
+			IdCommitment: field(rec, "idCommitment"),
+		}
+		if first == 0 && len(e.Key) == 2*len(util.HashValue{}) {
+			if _, err := decodeHash(e.Key); err == nil {
+				e.Key, e.KeyHash = "", e.Key
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, first, nil
+}
+
+func isCSVHeader(rec []string) bool {
+	for _, name := range rec {
+		for _, col := range csvColumns {
+			if strings.TrimSpace(name) == col {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Reads eligibility entries from a JSON array of EligibilityEntry objects.
+func ReadEligibilityJSON(r io.Reader) (*EligibilityList, *EligibilityReport, error) {
+	var entries []EligibilityEntry
+	err := json.NewDecoder(r).Decode(&entries)
+	if err != nil {
+		return nil, nil, err
+	}
+	list, report := NewEligibilityListFromEntries(entries)
+	return list, report, nil
+}
+
+// Returns the entries of a full list as key hashes and identity commitments, in list order.
+func (list *EligibilityList) Entries() []EligibilityEntry {
+	entries := make([]EligibilityEntry, len(list.publicKeyHashes))
+	for i, pkh := range list.publicKeyHashes {
+		idCom := list.idCommitments[pkh]
+		entries[i] = EligibilityEntry{
+			KeyHash:      hex.EncodeToString(pkh[:]),
+			IdCommitment: hex.EncodeToString(idCom[:]),
+		}
+	}
+	return entries
+}
+
+// Writes the list as CSV with keyHash and idCommitment columns.
+func (list *EligibilityList) WriteCSV(w io.Writer) error {
+	if list.rootOnly {
+		return ErrRootOnly
+	}
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"keyHash", "idCommitment"})
+	for _, e := range list.Entries() {
+		cw.Write([]string{e.KeyHash, e.IdCommitment})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Writes the list as a JSON array of EligibilityEntry objects.
+func (list *EligibilityList) WriteJSON(w io.Writer) error {
+	if list.rootOnly {
+		return ErrRootOnly
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(list.Entries())
+}
@@ -2,20 +2,53 @@ package structs
 
 import (
 	"errors"
+	"sync"
 
 	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
 )
 
-const ellMagic = 0x454c4c01
+const (
+	ellMagic = 0x454c4c01
+	// Root-only lists: the Merkle root and entry count of the full list.
+	ellRootMagic = 0x454c4c02
+	// Lists whose key hash algorithm is not SHA-256, identified by a byte following the magic.
+	ellAlgMagic     = 0x454c4c03
+	ellRootAlgMagic = 0x454c4c04
+)
 
 var (
 	ErrDuplicateKey = errors.New("pebble: duplicate key in EligibilityList")
 	ErrUnknownMagic = errors.New("pebble: unknown EligibilityList magic")
+	ErrNotEligible  = errors.New("pebble: public key not in EligibilityList")
+	ErrRootOnly     = errors.New("pebble: EligibilityList only holds a Merkle root")
+	ErrAlgorithm    = errors.New("pebble: EligibilityLists with different hash algorithms")
 )
 
+/*
+Lists the public key hashes of eligible voters with their identity commitments.
+For large electorates, a list may hold only the Merkle root of the full list;
+voters then prove their eligibility with an EligibilityProof obtained from
+the full list, which is distributed separately.
+
+Public keys are hashed with the hash algorithm of the list (see HashKey), SHA-256
+unless set with NewEligibilityListWithAlgorithm. Lists of other algorithms are
+serialized with a distinct magic followed by the algorithm, so that readers which
+do not know the algorithm fail instead of looking up the wrong hashes.
+
+The Merkle tree and the positions of the keys are cached for Root and Proof,
+and rebuilt after the list changes.
+*/
 type EligibilityList struct {
+	algorithm       util.HashAlgorithm
 	publicKeyHashes []util.HashValue
 	idCommitments   map[util.HashValue]util.HashValue
+	rootOnly        bool
+	root            util.HashValue
+	count           uint32
+
+	mu        sync.Mutex
+	levels    [][]util.HashValue
+	positions map[util.HashValue]int
 }
 
 func NewEligibilityList() *EligibilityList {
@@ -24,12 +57,54 @@ func NewEligibilityList() *EligibilityList {
 	return ell
 }
 
+// Creates an empty list hashing public keys with alg. Panics if alg is not registered.
+func NewEligibilityListWithAlgorithm(alg util.HashAlgorithm) *EligibilityList {
+	if !alg.Available() {
+		panic(util.ErrUnknownHashAlgorithm)
+	}
+	ell := NewEligibilityList()
+	ell.algorithm = alg
+	return ell
+}
+
+// Returns the algorithm hashing the public keys of the list.
+func (list *EligibilityList) HashAlgorithm() util.HashAlgorithm {
+	return list.algorithm
+}
+
+// Returns the hash of public key pk looked up in the list.
+func (list *EligibilityList) HashKey(pk []byte) (h util.HashValue) {
+	if list.algorithm == util.SHA256 {
+		return util.Hash(pk)
+	}
+	f, err := list.algorithm.New()
+	if err != nil {
+		panic(err)
+	}
+	f.Write(pk)
+	f.Sum(h[:0])
+	return
+}
+
+// Creates a root-only list committing to a full list of count entries.
+func NewEligibilityRoot(root util.HashValue, count uint32) *EligibilityList {
+	ell := NewEligibilityList()
+	ell.rootOnly = true
+	ell.root = root
+	ell.count = count
+	return ell
+}
+
 func (list *EligibilityList) Add(pkh, idCom util.HashValue) bool {
+	if list.rootOnly {
+		return false
+	}
 	if _, exists := list.idCommitments[pkh]; exists {
 		return false
 	}
 	list.publicKeyHashes = append(list.publicKeyHashes, pkh)
 	list.idCommitments[pkh] = idCom
+	list.invalidate()
 	return true
 }
 
@@ -38,14 +113,133 @@ func (list *EligibilityList) IdCommitment(pkh util.HashValue) (idCom util.HashVa
 	return
 }
 
+// Reports whether pkh is in the list. Always false for root-only lists.
 func (list *EligibilityList) Contains(pkh util.HashValue) bool {
 	_, ok := list.idCommitments[pkh]
 	return ok
 }
 
+// Reports whether the list only holds the Merkle root of the full list.
+func (list *EligibilityList) RootOnly() bool {
+	return list.rootOnly
+}
+
+// Returns the number of entries of the full list.
+func (list *EligibilityList) Len() int {
+	if list.rootOnly {
+		return int(list.count)
+	}
+	return len(list.publicKeyHashes)
+}
+
+func (list *EligibilityList) leaves() []util.HashValue {
+	leaves := make([]util.HashValue, len(list.publicKeyHashes))
+	for i, pkh := range list.publicKeyHashes {
+		leaves[i] = merkleLeaf(pkh, list.idCommitments[pkh])
+	}
+	return leaves
+}
+
+func (list *EligibilityList) invalidate() {
+	list.mu.Lock()
+	list.levels = nil
+	list.positions = nil
+	list.mu.Unlock()
+}
+
+// Returns the levels of the Merkle tree and the positions of the keys, building them if needed.
+func (list *EligibilityList) tree() ([][]util.HashValue, map[util.HashValue]int) {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	if list.levels == nil {
+		list.levels = util.MerkleLevels(list.leaves())
+		list.positions = make(map[util.HashValue]int, len(list.publicKeyHashes))
+		for i, pkh := range list.publicKeyHashes {
+			list.positions[pkh] = i
+		}
+	}
+	return list.levels, list.positions
+}
+
+// Returns the Merkle root of the full list.
+func (list *EligibilityList) Root() util.HashValue {
+	if list.rootOnly {
+		return list.root
+	}
+	if len(list.publicKeyHashes) == 0 {
+		return util.HashValue{}
+	}
+	levels, _ := list.tree()
+	return levels[len(levels)-1][0]
+}
+
+// Returns the root-only list committing to this list.
+func (list *EligibilityList) Commitment() *EligibilityList {
+	root := NewEligibilityRoot(list.Root(), uint32(list.Len()))
+	root.algorithm = list.algorithm
+	return root
+}
+
+// Builds the inclusion proof of pkh. Requires the full list.
+func (list *EligibilityList) Proof(pkh util.HashValue) (*EligibilityProof, error) {
+	if list.rootOnly {
+		return nil, ErrRootOnly
+	}
+	idCom, ok := list.idCommitments[pkh]
+	if !ok {
+		return nil, ErrNotEligible
+	}
+	levels, positions := list.tree()
+	index := positions[pkh]
+	return &EligibilityProof{
+		Index:        uint32(index),
+		IdCommitment: idCom,
+		Path:         util.MerkleLevelsPath(levels, index),
+	}, nil
+}
+
+/*
+Checks that pkh is eligible and returns its identity commitment.
+Full lists look pkh up and ignore the proof; root-only lists require
+a valid inclusion proof.
+*/
+func (list *EligibilityList) Verify(pkh util.HashValue, proof *EligibilityProof) (util.HashValue, error) {
+	if !list.rootOnly {
+		idCom, ok := list.idCommitments[pkh]
+		if !ok {
+			return idCom, ErrNotEligible
+		}
+		return idCom, nil
+	}
+	if proof == nil {
+		return util.HashValue{}, ErrNotEligible
+	}
+	if err := proof.Verify(list.root, list.count, pkh); err != nil {
+		return util.HashValue{}, err
+	}
+	return proof.IdCommitment, nil
+}
+
 func (list *EligibilityList) Bytes() []byte {
 	var w util.BufferWriter
-	w.WriteUint32(ellMagic)
+	// SHA-256 lists keep the original format, so that existing params keep their bytes
+	if list.rootOnly {
+		if list.algorithm == util.SHA256 {
+			w.WriteUint32(ellRootMagic)
+		} else {
+			w.WriteUint32(ellRootAlgMagic)
+			w.WriteByte(byte(list.algorithm))
+		}
+		w.Write(list.root[:])
+		w.WriteUint32(list.count)
+		return w.Buffer
+	}
+	if list.algorithm == util.SHA256 {
+		w.WriteUint32(ellMagic)
+	} else {
+		w.WriteUint32(ellAlgMagic)
+		w.WriteByte(byte(list.algorithm))
+	}
 	for _, pkh := range list.publicKeyHashes {
 		w.Write(pkh[:])
 		c, _ := list.IdCommitment(pkh)
@@ -60,11 +254,34 @@ func (list *EligibilityList) FromBytes(p []byte) error {
 	if err != nil {
 		return err
 	}
-	if m != ellMagic {
+	list.publicKeyHashes = nil
+	list.idCommitments = make(map[util.HashValue]util.HashValue)
+	list.rootOnly = false
+	list.algorithm = util.SHA256
+	list.invalidate()
+	if m == ellAlgMagic || m == ellRootAlgMagic {
+		alg, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		list.algorithm = util.HashAlgorithm(alg)
+		if list.algorithm == util.SHA256 || !list.algorithm.Available() {
+			return util.ErrUnknownHashAlgorithm
+		}
+	}
+	switch m {
+	case ellMagic, ellAlgMagic:
+	case ellRootMagic, ellRootAlgMagic:
+		list.rootOnly = true
+		list.root, err = r.Read32()
+		if err != nil {
+			return err
+		}
+		list.count, err = r.ReadUint32()
+		return err
+	default:
 		return ErrUnknownMagic
 	}
-	list.publicKeyHashes = nil
-	list.idCommitments = nil
 	for r.Len() != 0 {
 		pkh, err := r.Read32()
 		if err != nil {
@@ -0,0 +1,196 @@
+package structs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+func generateList(n int) *EligibilityList {
+	list := NewEligibilityList()
+	for i := 0; i < n; i++ {
+		list.Add(util.Hash([]byte{byte(i), 0}), util.Hash([]byte{byte(i), 1}))
+	}
+	return list
+}
+
+func TestEligibilityListRoundTrip(t *testing.T) {
+	list := generateList(3)
+	decoded := NewEligibilityList()
+	if err := decoded.FromBytes(list.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Len() != 3 || !decoded.Contains(util.Hash([]byte{2, 0})) {
+		t.Error("entries not preserved")
+	}
+	root := list.Commitment()
+	if err := decoded.FromBytes(root.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.RootOnly() || decoded.Root() != list.Root() || decoded.Len() != 3 {
+		t.Error("root-only list not preserved")
+	}
+}
+
+func TestEligibilityListAlgorithm(t *testing.T) {
+	pk := []byte("public key")
+	list := NewEligibilityListWithAlgorithm(util.BLAKE3)
+	list.Add(list.HashKey(pk), util.Hash([]byte("id")))
+	if list.HashKey(pk) == util.Hash(pk) {
+		t.Error("key hashed with SHA-256")
+	}
+	p := list.Bytes()
+	if !bytes.Equal(p[:5], []byte{0x45, 0x4c, 0x4c, 0x03, byte(util.BLAKE3)}) {
+		t.Errorf("serialized as %x", p[:5])
+	}
+	decoded := NewEligibilityList()
+	if err := decoded.FromBytes(p); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.HashAlgorithm() != util.BLAKE3 || !decoded.Contains(decoded.HashKey(pk)) {
+		t.Error("hash algorithm not preserved")
+	}
+	if err := decoded.FromBytes(list.Commitment().Bytes()); err != nil || decoded.HashAlgorithm() != util.BLAKE3 {
+		t.Errorf("root-only list algorithm not preserved: %v", err)
+	}
+	// SHA-256 lists keep the original magic
+	if p = generateList(1).Bytes(); !bytes.Equal(p[:4], []byte{0x45, 0x4c, 0x4c, 0x01}) {
+		t.Errorf("SHA-256 list serialized as %x", p[:4])
+	}
+	p = list.Bytes()
+	p[4] = 0xFF
+	if err := decoded.FromBytes(p); err != util.ErrUnknownHashAlgorithm {
+		t.Errorf("unknown algorithm: %v", err)
+	}
+	if _, err := DiffEligibilityLists(generateList(1), list); err != ErrAlgorithm {
+		t.Errorf("diff of lists with different algorithms: %v", err)
+	}
+}
+
+func TestEligibilityProofs(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		list := generateList(n)
+		root := list.Commitment()
+		for i := 0; i < n; i++ {
+			pkh := util.Hash([]byte{byte(i), 0})
+			proof, err := list.Proof(pkh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded EligibilityProof
+			if err = decoded.FromBytes(proof.Bytes()); err != nil {
+				t.Fatal(err)
+			}
+			idCom, err := root.Verify(pkh, &decoded)
+			if err != nil {
+				t.Fatalf("proof %d of %d: %v", i, n, err)
+			}
+			if idCom != util.Hash([]byte{byte(i), 1}) {
+				t.Error("wrong identity commitment")
+			}
+			if _, err = root.Verify(util.Hash([]byte{byte(i), 2}), proof); err != ErrInvalidEligibilityProof {
+				t.Error("proof should not verify for another key")
+			}
+		}
+		if _, err := root.Verify(util.Hash([]byte{0, 0}), nil); err != ErrNotEligible {
+			t.Error("root-only list should require a proof")
+		}
+
+		// The cached tree is rebuilt after the list changes
+		pkh := util.Hash([]byte{byte(n), 0})
+		list.Add(pkh, util.Hash([]byte{byte(n), 1}))
+		if list.Root() != util.MerkleRoot(list.leaves()) {
+			t.Fatalf("stale root after adding to %d entries", n)
+		}
+		proof, err := list.Proof(pkh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = list.Commitment().Verify(pkh, proof); err != nil {
+			t.Errorf("proof of the added key: %v", err)
+		}
+		if err = list.FromBytes(generateList(n).Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		if list.Root() != root.Root() {
+			t.Errorf("stale root after decoding %d entries", n)
+		}
+	}
+}
+
+func TestEligibilityImport(t *testing.T) {
+	h1 := util.Hash([]byte("voter 1"))
+	h2 := util.Hash([]byte("voter 2"))
+	k1, k2 := hex.EncodeToString(h1[:]), hex.EncodeToString(h2[:])
+	csvIn := "keyHash,id\n" + k2 + ",bob\n" + k1 + ",alice\n" + k2 + ",carol\nnot-hex,dave\n"
+	list, report, err := ReadEligibilityCSV(strings.NewReader(csvIn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Added != 2 || len(report.Duplicates) != 1 || len(report.Invalid) != 1 {
+		t.Fatalf("unexpected report: %s", report)
+	}
+	if report.Duplicates[0].Line != 4 || report.Invalid[0].Line != 5 {
+		t.Errorf("unexpected report lines: %s", report)
+	}
+	jsonIn := `[{"keyHash":"` + k1 + `","id":"alice"},{"keyHash":"` + k2 + `","id":"bob"}]`
+	fromJson, _, err := ReadEligibilityJSON(strings.NewReader(jsonIn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(list.Bytes(), fromJson.Bytes()) {
+		t.Error("list bytes depend on input order or format")
+	}
+	var out bytes.Buffer
+	if err = list.WriteCSV(&out); err != nil {
+		t.Fatal(err)
+	}
+	reread, _, err := ReadEligibilityCSV(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(list.Bytes(), reread.Bytes()) {
+		t.Error("CSV export does not round trip")
+	}
+}
+
+func TestEligibilityDiffMerge(t *testing.T) {
+	a := generateList(4)
+	b := generateList(3)
+	b.idCommitments[util.Hash([]byte{1, 0})] = util.Hash([]byte{1, 2})
+	b.Add(util.Hash([]byte{9, 0}), util.Hash([]byte{9, 1}))
+	diff, err := DiffEligibilityLists(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Added) != 1 || len(diff.Removed) != 1 || len(diff.Changed) != 1 {
+		t.Fatalf("unexpected diff %+v", diff)
+	}
+	var decoded EligibilityDiff
+	if err = decoded.FromBytes(diff.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	c, err := a.Apply(&decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c.Bytes(), b.Bytes()) {
+		t.Error("applied diff does not reproduce the target list")
+	}
+	if _, err = b.Apply(diff); err != ErrEligibilityConflict {
+		t.Error("diff should not apply to another base list")
+	}
+	if _, err = MergeEligibilityLists(MergeStrict, a, b); err != ErrEligibilityConflict {
+		t.Error("strict merge should fail on conflicts")
+	}
+	m, err := MergeEligibilityLists(MergeKeepLast, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idCom, _ := m.IdCommitment(util.Hash([]byte{1, 0})); m.Len() != 5 || idCom != util.Hash([]byte{1, 2}) {
+		t.Error("merge did not keep the last commitment")
+	}
+}
@@ -0,0 +1,71 @@
+package structs
+
+import (
+	"errors"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+var ErrInvalidEligibilityProof = errors.New("pebble: invalid eligibility proof")
+
+/*
+Proves that a public key hash belongs to an EligibilityList committed to by its Merkle root.
+
+The tree is built over the list entries in order, see util.MerkleRoot. Leaves are H(0x00 || pkh || idCom).
+Path holds the sibling hashes from the leaf up.
+*/
+type EligibilityProof struct {
+	Index        uint32
+	IdCommitment util.HashValue
+	Path         []util.HashValue
+}
+
+// Maximum length of a path: the index of the leaf has 32 bits.
+const maxProofDepth = 32
+
+func merkleLeaf(pkh, idCom util.HashValue) util.HashValue {
+	return util.HashAll([]byte{0}, pkh[:], idCom[:])
+}
+
+// Checks the proof for pkh against the root of a tree with count leaves.
+func (proof *EligibilityProof) Verify(root util.HashValue, count uint32, pkh util.HashValue) error {
+	if !util.VerifyMerklePath(root, uint64(count), uint64(proof.Index), merkleLeaf(pkh, proof.IdCommitment), proof.Path) {
+		return ErrInvalidEligibilityProof
+	}
+	return nil
+}
+
+func (proof *EligibilityProof) Bytes() []byte {
+	var w util.BufferWriter
+	w.WriteUint32(proof.Index)
+	w.Write(proof.IdCommitment[:])
+	for _, h := range proof.Path {
+		w.Write(h[:])
+	}
+	return w.Buffer
+}
+
+func (proof *EligibilityProof) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	proof.Index, err = r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	proof.IdCommitment, err = r.Read32()
+	if err != nil {
+		return err
+	}
+	proof.Path = nil
+	if r.Len() > maxProofDepth*len(util.HashValue{}) {
+		return util.ErrTooLarge
+	}
+	for r.Len() != 0 {
+		h, err := r.Read32()
+		if err != nil {
+			return err
+		}
+		proof.Path = append(proof.Path, h)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package structs
+
+import (
+	"github.com/giry-dev/pebble-voting-app/pebble-core/trustee"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+)
+
+const trusteePartialLength = 32 + trustee.PointLength + trustee.ProofLength
+
+// Maximum length of the hybrid secret shares in partial decryptions.
+const maxHybridShareLength = 32
+
+// The partial decryption of the trustee ciphertext whose ephemeral key hashes to EphemeralHash.
+type TrusteePartial struct {
+	EphemeralHash util.HashValue
+	trustee.PartialDecryption
+}
+
+// Carries the partial decryptions of trustee Index for the ballots of an election.
+type TrusteeDecryptionMessage struct {
+	Index    uint32
+	Partials []TrusteePartial
+}
+
+func (m *TrusteeDecryptionMessage) Bytes() []byte {
+	var w util.BufferWriter
+	w.WriteUint32(m.Index)
+	for _, p := range m.Partials {
+		w.Write32(p.EphemeralHash)
+		w.Write(p.Point)
+		w.Write(p.Proof)
+	}
+	return w.Buffer
+}
+
+func (m *TrusteeDecryptionMessage) FromBytes(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	m.Index, err = r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	m.Partials = nil
+	for r.Len() != 0 {
+		b, err := r.ReadBytes(trusteePartialLength)
+		if err != nil {
+			return err
+		}
+		var partial TrusteePartial
+		copy(partial.EphemeralHash[:], b)
+		partial.Point = b[32 : 32+trustee.PointLength]
+		partial.Proof = b[32+trustee.PointLength:]
+		m.Partials = append(m.Partials, partial)
+	}
+	return nil
+}
+
+// Whether a partial carries a share of a hybrid secret, and so must be serialized with BytesWithShares.
+func (m *TrusteeDecryptionMessage) HasShares() bool {
+	for _, p := range m.Partials {
+		if p.Share != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Serializes the partials with the shares of the hybrid secrets of their ciphertexts, empty for other ciphertexts.
+func (m *TrusteeDecryptionMessage) BytesWithShares() []byte {
+	var w util.BufferWriter
+	w.WriteUint32(m.Index)
+	for _, p := range m.Partials {
+		w.Write32(p.EphemeralHash)
+		w.Write(p.Point)
+		w.Write(p.Proof)
+		w.WriteVarVector(p.Share)
+	}
+	return w.Buffer
+}
+
+func (m *TrusteeDecryptionMessage) FromBytesWithShares(p []byte) error {
+	r := util.NewBufferReader(p)
+	var err error
+	m.Index, err = r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	m.Partials = nil
+	for r.Len() != 0 {
+		b, err := r.ReadBytes(trusteePartialLength)
+		if err != nil {
+			return err
+		}
+		var partial TrusteePartial
+		copy(partial.EphemeralHash[:], b)
+		partial.Point = b[32 : 32+trustee.PointLength]
+		partial.Proof = b[32+trustee.PointLength:]
+		partial.Share, err = r.ReadVarVector(maxHybridShareLength)
+		if err != nil {
+			return err
+		}
+		if len(partial.Share) == 0 {
+			partial.Share = nil
+		}
+		m.Partials = append(m.Partials, partial)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package voting
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Time between the syncs of a Syncer configured without an interval.
+const DefaultSyncInterval = 30 * time.Second
+
+// Configures a Syncer.
+type SyncConfig struct {
+	// Time between syncs, DefaultSyncInterval if zero.
+	Interval time.Duration
+	// Maximum random delay added to each interval, spreading the syncs of many elections.
+	Jitter time.Duration
+	// Whether the decryption of the voter's ballot is posted once the tally starts.
+	AutoReveal bool
+	// Called when a sync fails; the next sync is tried after the interval anyway.
+	OnError func(err error)
+}
+
+/*
+Keeps a joined election up to date in the background, for clients holding several elections:
+every interval, reads the new messages, recomputes the progress and performs the pending
+actions of the voter, so that requests return the last progress without waiting on the channel.
+*/
+type Syncer struct {
+	e   *Election
+	cfg SyncConfig
+
+	mu       sync.RWMutex
+	progress ElectionProgress
+	synced   time.Time
+	err      error
+	revealed bool
+}
+
+func NewSyncer(e *Election, cfg SyncConfig) *Syncer {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultSyncInterval
+	}
+	return &Syncer{e: e, cfg: cfg}
+}
+
+// Syncs the election every interval until ctx is done, starting right away.
+func (s *Syncer) Run(ctx context.Context) {
+	for {
+		err := s.Sync(ctx)
+		if err != nil && ctx.Err() == nil && s.cfg.OnError != nil {
+			s.cfg.OnError(err)
+		}
+		wait := s.cfg.Interval
+		if s.cfg.Jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(s.cfg.Jitter)))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Reads the new messages of the election, recomputes its progress and performs the pending actions.
+func (s *Syncer) Sync(ctx context.Context) error {
+	p, err := s.e.Progress(ctx)
+	if err == nil && p.Phase == Tally {
+		err = s.reveal(ctx)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+	if err == nil {
+		s.progress, s.synced = p, s.e.Now()
+	}
+	return err
+}
+
+// Posts the decryption of the voter's ballot once, if enabled and the voter cast a ballot.
+func (s *Syncer) reveal(ctx context.Context) error {
+	s.mu.RLock()
+	done := s.revealed || !s.cfg.AutoReveal || s.e.secrets == nil
+	s.mu.RUnlock()
+	if done {
+		return nil
+	}
+	sb, err := s.e.secrets.GetBallot(s.e.Id())
+	if err != nil || sb.SerialNo == nil {
+		return nil
+	}
+	err = s.e.RevealBallotDecryption(ctx)
+	if err != nil && err != ErrDuplicateMessage {
+		return err
+	}
+	s.mu.Lock()
+	s.revealed = true
+	s.mu.Unlock()
+	return nil
+}
+
+/*
+Returns the progress computed by the last successful sync and the time of that sync,
+which is zero before the first one, along with the error of the last sync.
+*/
+func (s *Syncer) Progress() (ElectionProgress, time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.progress, s.synced, s.err
+}
@@ -0,0 +1,117 @@
+package voting
+
+import (
+	"context"
+	"errors"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+var (
+	ErrReadOnlyChannel    = errors.New("pebble: cannot post to a transcript")
+	ErrTranscriptNoParams = errors.New("pebble: transcript has no election params")
+)
+
+/*
+A read-only broadcast channel over an archived message log, for recounting an election
+without network access. No messages are ever posted, so watches only end with their context.
+*/
+type TranscriptChannel struct {
+	id       ElectionID
+	network  string
+	params   *ElectionParams
+	messages []Message
+	// Full eligibility list, for archives of elections whose params only hold its root.
+	eligibility *structs.EligibilityList
+}
+
+func NewTranscriptChannel(id ElectionID, params *ElectionParams, msgs []Message) *TranscriptChannel {
+	return &TranscriptChannel{id: id, network: ServerNetwork, params: params, messages: msgs}
+}
+
+/*
+Encodes a transcript: the params followed by the messages of the election,
+in message envelopes as served by broadcast servers with framing version 3.
+*/
+func EncodeTranscript(params *ElectionParams, msgs []Message) []byte {
+	return EncodeReceiptEnvelopes(append([]Message{{ElectionParams: params}}, msgs...))
+}
+
+/*
+Decodes a transcript of election id: a list of message envelopes, such as a response
+of a broadcast server with framing version 3, possibly starting with the params.
+Organizer actions of elections from version 11 are only applied with the receive times of framing version 3.
+Params overrides the params found in the transcript, and is required if there are none.
+*/
+func ReadTranscript(id ElectionID, p []byte, params *ElectionParams) (*TranscriptChannel, error) {
+	all, err := DecodeEnvelopes(p)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []Message
+	for _, m := range all {
+		if m.ElectionParams == nil {
+			msgs = append(msgs, m)
+		} else if params == nil {
+			params = m.ElectionParams
+		}
+	}
+	if params == nil {
+		return nil, ErrTranscriptNoParams
+	}
+	return NewTranscriptChannel(id, params, msgs), nil
+}
+
+func (bc *TranscriptChannel) Id() ElectionID {
+	return bc.id
+}
+
+// Returns the network of the election, ServerNetwork unless mounted from an archive of another network.
+func (bc *TranscriptChannel) Network() string {
+	return bc.network
+}
+
+func (bc *TranscriptChannel) Params(ctx context.Context) (*ElectionParams, error) {
+	return bc.params, nil
+}
+
+func (bc *TranscriptChannel) Get(ctx context.Context) ([]Message, error) {
+	return bc.messages, nil
+}
+
+func (bc *TranscriptChannel) Stream(ctx context.Context) (MessageIterator, error) {
+	return &sliceIterator{bc.messages}, nil
+}
+
+func (bc *TranscriptChannel) Post(ctx context.Context, m Message) error {
+	return ErrReadOnlyChannel
+}
+
+func (bc *TranscriptChannel) PostAll(ctx context.Context, msgs []Message) error {
+	return ErrReadOnlyChannel
+}
+
+func (bc *TranscriptChannel) Watch(ctx context.Context) (<-chan Message, error) {
+	ch := make(chan Message)
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (bc *TranscriptChannel) EligibilityList(ctx context.Context) (*structs.EligibilityList, error) {
+	if bc.eligibility == nil {
+		return bc.params.EligibilityList, nil
+	}
+	return bc.eligibility, nil
+}
+
+func (bc *TranscriptChannel) EligibilityProof(ctx context.Context, pkh util.HashValue) (*structs.EligibilityProof, error) {
+	list, err := bc.EligibilityList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return list.Proof(pkh)
+}
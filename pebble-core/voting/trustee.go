@@ -0,0 +1,117 @@
+package voting
+
+import (
+	"context"
+	"errors"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/trustee"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+var ErrNoTrustees = errors.New("pebble: election has no trustees")
+
+// Partial decryptions of a trustee ciphertext, with the index of the trustee that posted each.
+type trusteePartials struct {
+	indices  []uint32
+	partials []trustee.PartialDecryption
+}
+
+// Groups the partial decryptions of the messages by ephemeral key hash.
+func collectTrusteePartials(msgs []structs.TrusteeDecryptionMessage) map[util.HashValue]*trusteePartials {
+	res := make(map[util.HashValue]*trusteePartials)
+	for _, msg := range msgs {
+		for _, p := range msg.Partials {
+			tp, ok := res[p.EphemeralHash]
+			if !ok {
+				tp = new(trusteePartials)
+				res[p.EphemeralHash] = tp
+			}
+			tp.indices = append(tp.indices, msg.Index)
+			tp.partials = append(tp.partials, p.PartialDecryption)
+		}
+	}
+	return res
+}
+
+/*
+Decrypts the trustee ciphertext of a ballot from the posted partial decryptions.
+Returns ErrDecryptionNotFound if the ballot has no trustee ciphertext or not enough partials were posted.
+*/
+func decryptTrusteeBallot(encBallot structs.EncryptedBallot, ks *trustee.KeySet, partials map[util.HashValue]*trusteePartials) (structs.Ballot, error) {
+	if ks == nil || encBallot.Trustee == nil {
+		return nil, ErrDecryptionNotFound
+	}
+	var c trustee.Ciphertext
+	err := c.FromBytes(encBallot.Trustee)
+	if err != nil {
+		return nil, err
+	}
+	tp, ok := partials[util.Hash(c.Ephemeral)]
+	if !ok {
+		return nil, ErrDecryptionNotFound
+	}
+	ballot, err := ks.Combine(c, tp.indices, tp.partials)
+	if err == trustee.ErrNotEnoughPartials {
+		return nil, ErrDecryptionNotFound
+	}
+	return ballot, err
+}
+
+/*
+Posts the partial decryptions of trustee share for all valid ballots carrying a trustee ciphertext,
+or for the per-slot sums of the ballots in homomorphically tallied elections.
+Trustees may decrypt as soon as the Tally phase starts, without waiting for voters to reveal their VDF solutions.
+*/
+func (e *Election) PostTrusteeDecryption(ctx context.Context, share trustee.Share) error {
+	if e.Params().Trustees == nil {
+		return ErrNoTrustees
+	}
+	if e.Phase() != Tally {
+		return ErrWrongPhase
+	}
+	err := e.Params().Trustees.VerifyShare(share)
+	if err != nil {
+		return err
+	}
+	set, err := e.GetCredentialSet(ctx)
+	if err != nil {
+		return err
+	}
+	msgs, err := e.readMessages(ctx, func(m Message) bool {
+		return m.SignedBallot != nil || m.Credential != nil || m.Delegation != nil || m.DelegateClaim != nil
+	})
+	if err != nil {
+		return err
+	}
+	msg := &structs.TrusteeDecryptionMessage{Index: share.Index}
+	if hm, ok := e.homomorphicMethod(); ok {
+		msg.Partials, err = e.homomorphicPartials(ctx, hm, set, msgs, share)
+		if err != nil {
+			return err
+		}
+		return e.post(ctx, Message{TrusteeDecryption: msg})
+	}
+	domain := e.ballotDomain()
+	for _, m := range msgs {
+		if m.SignedBallot == nil || m.SignedBallot.EncryptedBallot.Trustee == nil {
+			continue
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if m.SignedBallot.Verify(set, domain) != nil {
+			continue
+		}
+		var c trustee.Ciphertext
+		if c.FromBytes(m.SignedBallot.EncryptedBallot.Trustee) != nil {
+			continue
+		}
+		pd, err := share.DecryptCiphertext(e.Params().Trustees, c)
+		if err != nil {
+			continue
+		}
+		msg.Partials = append(msg.Partials, structs.TrusteePartial{EphemeralHash: util.Hash(c.Ephemeral), PartialDecryption: pd})
+	}
+	return e.post(ctx, Message{TrusteeDecryption: msg})
+}
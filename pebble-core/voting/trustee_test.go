@@ -0,0 +1,87 @@
+package voting
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/giry-dev/pebble-voting-app/pebble-core/trustee"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/util"
+	"github.com/giry-dev/pebble-voting-app/pebble-core/voting/structs"
+)
+
+func TestTrusteeDecryption(t *testing.T) {
+	ks, shares, err := trustee.Deal(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testTrusteeDecryption(t, ks, shares, ParamsVersion5)
+}
+
+func TestHybridTrusteeDecryption(t *testing.T) {
+	ks, shares, err := trustee.DealHybrid(2, 3)
+	if err == trustee.ErrHybridUnavailable {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := generateParamsV1()
+	params.Version = ParamsVersion12
+	params.Trustees = ks
+	if params.Validate() != errUnknownVersion {
+		t.Error("hybrid trustee keys accepted before version 13")
+	}
+	testTrusteeDecryption(t, ks, shares, ParamsVersion13)
+}
+
+func testTrusteeDecryption(t *testing.T, ks *trustee.KeySet, shares []trustee.Share, version uint32) {
+	params := generateParamsV1()
+	params.Version = version
+	params.Trustees = ks
+	var decodedParams ElectionParams
+	if err := decodedParams.FromBytes(params.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := decodedParams.Validate(); err != nil || !bytes.Equal(decodedParams.Trustees.Bytes(), ks.Bytes()) {
+		t.Fatal("trustee key set not preserved")
+	}
+	ballot := structs.Ballot{1, 2, 3}
+	c, err := ks.Encrypt(ballot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb := &structs.SignedBallot{
+		EncryptedBallot: structs.EncryptedBallot{VdfInput: []byte{1}, Payload: []byte{2}, Trustee: c.Bytes()},
+		SerialNo:        []byte{3},
+		Signature:       []byte{4},
+	}
+	m, err := MessageFromBytes(Message{SignedBallot: sb}.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	eb := m.SignedBallot.EncryptedBallot
+	var trusteeMsgs []structs.TrusteeDecryptionMessage
+	for _, share := range shares[1:] {
+		pd, err := share.DecryptCiphertext(ks, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := structs.TrusteeDecryptionMessage{Index: share.Index}
+		msg.Partials = append(msg.Partials, structs.TrusteePartial{EphemeralHash: util.Hash(c.Ephemeral), PartialDecryption: pd})
+		m, err := MessageFromBytes(Message{TrusteeDecryption: &msg}.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		trusteeMsgs = append(trusteeMsgs, *m.TrusteeDecryption)
+	}
+	if _, err = decryptTrusteeBallot(eb, ks, collectTrusteePartials(trusteeMsgs[:1])); err != ErrDecryptionNotFound {
+		t.Error("ballot decrypted below threshold")
+	}
+	decrypted, err := decryptTrusteeBallot(eb, ks, collectTrusteePartials(trusteeMsgs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, ballot) {
+		t.Error("wrong ballot")
+	}
+}
@@ -0,0 +1,31 @@
+package voting
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Calls f(i) for each i in [0, n) on GOMAXPROCS concurrent workers and waits for them to finish.
+func parallelFor(n int, f func(i int)) {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > n {
+		workers = n
+	}
+	var next int64 = -1
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				f(i)
+			}
+		}()
+	}
+	wg.Wait()
+}